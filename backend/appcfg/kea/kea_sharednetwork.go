@@ -0,0 +1,59 @@
+package keaconfig
+
+// Represents the arguments of the network4-subnet-add, network6-subnet-add,
+// network4-subnet-del and network6-subnet-del commands. They comprise the
+// shared network name and the local subnet ID.
+type SubnetCmdsSharedNetworkSubnet struct {
+	Name string `mapstructure:"name" json:"name"`
+	ID   int64  `mapstructure:"id" json:"id"`
+}
+
+// Represents a deleted shared network. It includes the fields required by
+// Kea to find the shared network and delete it using network4-del or
+// network6-del. The SubnetsAction specifies whether the subnets belonging
+// to the shared network should be deleted or kept as global subnets.
+type SubnetCmdsDeletedSharedNetwork struct {
+	Name          string `mapstructure:"name" json:"name"`
+	SubnetsAction string `mapstructure:"subnets-action" json:"subnets-action,omitempty"`
+}
+
+// Returns a shared network having the specified name. The second returned
+// value is false if the shared network was not found.
+func (c *Map) GetSharedNetworkByName(name string) (map[string]interface{}, bool) {
+	if networkList, ok := c.GetTopLevelList("shared-networks"); ok {
+		for _, n := range networkList {
+			if network, ok := n.(map[string]interface{}); ok {
+				if networkName, ok := network["name"].(string); ok && networkName == name {
+					return network, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// Converts a shared network to the format used in the network4-add and
+// network6-add commands. The existing parameter holds an optional shared
+// network definition taken from the daemon's configuration. If it is
+// specified, the returned shared network inherits its parameters. The
+// parameters specified by the caller override the inherited ones. The
+// parameter having a nil value is removed from the shared network. The
+// returned shared network never contains subnets. They must be added
+// with the network4-subnet-add or network6-subnet-add commands.
+func CreateSubnetCmdsSharedNetwork(name string, parameters map[string]interface{}, existing map[string]interface{}) map[string]interface{} {
+	network := make(map[string]interface{})
+	for key, value := range existing {
+		network[key] = value
+	}
+	for key, value := range parameters {
+		if value == nil {
+			delete(network, key)
+			continue
+		}
+		network[key] = value
+	}
+	delete(network, "subnet4")
+	delete(network, "subnet6")
+	network["name"] = name
+	return network
+}
@@ -0,0 +1,59 @@
+package keaconfig
+
+import (
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+)
+
+// Test that the shared network can be found by name.
+func TestGetSharedNetworkByName(t *testing.T) {
+	cfg := getTestConfigWithIPv4Subnets(t)
+
+	network, ok := cfg.GetSharedNetworkByName("foo")
+	require.True(t, ok)
+	require.NotNil(t, network)
+	require.Equal(t, "foo", network["name"])
+
+	_, ok = cfg.GetSharedNetworkByName("baz")
+	require.False(t, ok)
+}
+
+// Test that the shared network for the network4-add command is created
+// from the existing network and the specified parameters.
+func TestCreateSubnetCmdsSharedNetwork(t *testing.T) {
+	existing := map[string]interface{}{
+		"name":           "foo",
+		"interface":      "eth0",
+		"valid-lifetime": 3600,
+		"subnet4": []interface{}{
+			map[string]interface{}{
+				"id":     1,
+				"subnet": "192.0.2.0/24",
+			},
+		},
+	}
+	parameters := map[string]interface{}{
+		"valid-lifetime": 7200,
+		"interface":      nil,
+		"client-class":   "bar",
+	}
+	network := CreateSubnetCmdsSharedNetwork("baz", parameters, existing)
+	require.Len(t, network, 3)
+	require.Equal(t, "baz", network["name"])
+	require.Equal(t, 7200, network["valid-lifetime"])
+	require.Equal(t, "bar", network["client-class"])
+
+	// The existing network should not be modified.
+	require.Equal(t, "foo", existing["name"])
+	require.Contains(t, existing, "interface")
+	require.Contains(t, existing, "subnet4")
+}
+
+// Test that the shared network is created when there is no existing
+// shared network.
+func TestCreateSubnetCmdsSharedNetworkNoExisting(t *testing.T) {
+	network := CreateSubnetCmdsSharedNetwork("foo", nil, nil)
+	require.Len(t, network, 1)
+	require.Equal(t, "foo", network["name"])
+}
@@ -3,6 +3,7 @@ package keaconfig
 import (
 	"bytes"
 	"net"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -173,3 +174,164 @@ func (c *Map) DecodeTopLevelSubnets(decodedSubnets interface{}) error {
 	}
 	return nil
 }
+
+// Interface of a subnet convertible to a Kea subnet.
+type SubnetAccessor interface {
+	GetPrefix() string
+	GetClientClass() string
+	GetAddressPoolRanges() []string
+	GetPrefixPools() []struct {
+		Prefix       string
+		DelegatedLen int
+	}
+	GetLocalSubnetID(int64) (int64, error)
+}
+
+// Represents a deleted subnet. It includes the fields required by Kea
+// to find the subnet and delete it using subnet4-del or subnet6-del.
+type SubnetCmdsDeletedSubnet struct {
+	ID int64 `mapstructure:"id" json:"id"`
+}
+
+// Returns a subnet having the specified local subnet ID. It searches for
+// the subnet among the top level subnets and the subnets belonging to the
+// shared networks. The second returned value is false if the subnet was
+// not found.
+func (c *Map) GetSubnetByID(localSubnetID int64) (map[string]interface{}, bool) {
+	rootName, ok := c.GetRootName()
+	if !ok {
+		return nil, false
+	}
+	var subnetParamName string
+	switch rootName {
+	case RootNameDHCPv4:
+		subnetParamName = "subnet4"
+	case RootNameDHCPv6:
+		subnetParamName = "subnet6"
+	default:
+		return nil, false
+	}
+	matchID := func(subnets []interface{}) (map[string]interface{}, bool) {
+		for _, s := range subnets {
+			if subnet, ok := s.(map[string]interface{}); ok {
+				if id, ok := subnet["id"].(float64); ok && int64(id) == localSubnetID {
+					return subnet, true
+				}
+			}
+		}
+		return nil, false
+	}
+	if subnetList, ok := c.GetTopLevelList(subnetParamName); ok {
+		if subnet, ok := matchID(subnetList); ok {
+			return subnet, true
+		}
+	}
+	if networkList, ok := c.GetTopLevelList("shared-networks"); ok {
+		for _, n := range networkList {
+			if network, ok := n.(map[string]interface{}); ok {
+				if subnetList, ok := network[subnetParamName].([]interface{}); ok {
+					if subnet, ok := matchID(subnetList); ok {
+						return subnet, true
+					}
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// Converts a subnet representation in Stork to the Kea subnet format used
+// in the subnet_cmds hook library commands (e.g., subnet4-add, subnet6-update).
+// The daemonID selects the local subnet ID appropriate for a given daemon.
+// Note that a subnet in Stork can be shared by multiple daemons. The
+// existing parameter holds an optional subnet definition taken from the
+// daemon's configuration. If it is specified, the returned subnet inherits
+// the parameters not managed by Stork (e.g., options, relay information)
+// from it. The subnet ID is omitted when the local subnet ID is 0. In this
+// case, Kea assigns the subnet ID on its own.
+func CreateSubnetCmdsSubnet(daemonID int64, subnet SubnetAccessor, existing map[string]interface{}) (map[string]interface{}, error) {
+	localSubnetID, err := subnet.GetLocalSubnetID(daemonID)
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = net.ParseCIDR(subnet.GetPrefix())
+	if err != nil {
+		return nil, errors.Errorf("invalid subnet prefix %s", subnet.GetPrefix())
+	}
+	keaSubnet := make(map[string]interface{})
+	for key, value := range existing {
+		keaSubnet[key] = value
+	}
+	if localSubnetID != 0 {
+		keaSubnet["id"] = localSubnetID
+	}
+	keaSubnet["subnet"] = subnet.GetPrefix()
+
+	if clientClass := subnet.GetClientClass(); len(clientClass) > 0 {
+		keaSubnet["client-class"] = clientClass
+	} else {
+		delete(keaSubnet, "client-class")
+	}
+
+	// Pools specified in Stork replace the pools from the existing subnet.
+	// The pools may contain additional parameters in the configuration,
+	// e.g. options. Preserve them if the pool boundaries did not change.
+	existingPools := make(map[string]interface{})
+	if pools, ok := existing["pools"].([]interface{}); ok {
+		for _, p := range pools {
+			if pool, ok := p.(map[string]interface{}); ok {
+				if poolRange, ok := pool["pool"].(string); ok {
+					existingPools[strings.ReplaceAll(poolRange, " ", "")] = pool
+				}
+			}
+		}
+	}
+	pools := []interface{}{}
+	for _, poolRange := range subnet.GetAddressPoolRanges() {
+		if pool, ok := existingPools[strings.ReplaceAll(poolRange, " ", "")]; ok {
+			pools = append(pools, pool)
+			continue
+		}
+		pools = append(pools, map[string]interface{}{
+			"pool": poolRange,
+		})
+	}
+	keaSubnet["pools"] = pools
+
+	// Prefix delegation pools are only supported by the DHCPv6 servers.
+	if prefixPools := subnet.GetPrefixPools(); len(prefixPools) > 0 {
+		pdPools := []interface{}{}
+		for _, p := range prefixPools {
+			prefix, network, err := net.ParseCIDR(p.Prefix)
+			if err != nil {
+				return nil, errors.Errorf("invalid delegated prefix pool %s", p.Prefix)
+			}
+			prefixLen, _ := network.Mask.Size()
+			pdPools = append(pdPools, map[string]interface{}{
+				"prefix":        prefix.String(),
+				"prefix-len":    prefixLen,
+				"delegated-len": p.DelegatedLen,
+			})
+		}
+		keaSubnet["pd-pools"] = pdPools
+	} else {
+		delete(keaSubnet, "pd-pools")
+	}
+	return keaSubnet, nil
+}
+
+// Converts a subnet representation in Stork to a structure accepted by the
+// subnet4-del and subnet6-del commands in Kea. This structure comprises
+// the local subnet ID used by the given daemon.
+func CreateSubnetCmdsDeletedSubnet(daemonID int64, subnet SubnetAccessor) (*SubnetCmdsDeletedSubnet, error) {
+	localSubnetID, err := subnet.GetLocalSubnetID(daemonID)
+	if err != nil {
+		return nil, err
+	}
+	if localSubnetID == 0 {
+		return nil, errors.Errorf("unable to delete subnet %s with unknown ID", subnet.GetPrefix())
+	}
+	return &SubnetCmdsDeletedSubnet{
+		ID: localSubnetID,
+	}, nil
+}
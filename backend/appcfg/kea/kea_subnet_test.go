@@ -3,6 +3,7 @@ package keaconfig
 import (
 	"testing"
 
+	"github.com/pkg/errors"
 	require "github.com/stretchr/testify/require"
 )
 
@@ -370,3 +371,156 @@ func TestDecodeIPv4SubnetsWithHostReservationModes(t *testing.T) {
 	require.False(t, val)
 	require.True(t, set)
 }
+
+// Test subnet implementing the SubnetAccessor interface.
+type testSubnet struct {
+	prefix      string
+	clientClass string
+	pools       []string
+	prefixPools []struct {
+		Prefix       string
+		DelegatedLen int
+	}
+	localSubnetID int64
+	err           error
+}
+
+// Returns subnet prefix.
+func (s testSubnet) GetPrefix() string {
+	return s.prefix
+}
+
+// Returns client class.
+func (s testSubnet) GetClientClass() string {
+	return s.clientClass
+}
+
+// Returns address pools.
+func (s testSubnet) GetAddressPoolRanges() []string {
+	return s.pools
+}
+
+// Returns delegated prefix pools.
+func (s testSubnet) GetPrefixPools() []struct {
+	Prefix       string
+	DelegatedLen int
+} {
+	return s.prefixPools
+}
+
+// Returns local subnet ID or an error.
+func (s testSubnet) GetLocalSubnetID(int64) (int64, error) {
+	return s.localSubnetID, s.err
+}
+
+// Test that the subnet can be found by local subnet ID.
+func TestGetSubnetByID(t *testing.T) {
+	cfg := getTestConfigWithIPv4Subnets(t)
+
+	subnet, ok := cfg.GetSubnetByID(234)
+	require.True(t, ok)
+	require.Equal(t, "192.0.3.0/24", subnet["subnet"])
+
+	subnet, ok = cfg.GetSubnetByID(890)
+	require.True(t, ok)
+	require.Equal(t, "10.4.0.0/16", subnet["subnet"])
+
+	_, ok = cfg.GetSubnetByID(1000)
+	require.False(t, ok)
+}
+
+// Test conversion of a subnet to the format used by subnet_cmds.
+func TestCreateSubnetCmdsSubnet(t *testing.T) {
+	subnet := testSubnet{
+		prefix:        "2001:db8:1::/64",
+		clientClass:   "foo",
+		pools:         []string{"2001:db8:1::10-2001:db8:1::100"},
+		localSubnetID: 123,
+		prefixPools: []struct {
+			Prefix       string
+			DelegatedLen int
+		}{
+			{
+				Prefix:       "3000::/48",
+				DelegatedLen: 64,
+			},
+		},
+	}
+	keaSubnet, err := CreateSubnetCmdsSubnet(1, subnet, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 123, keaSubnet["id"])
+	require.Equal(t, "2001:db8:1::/64", keaSubnet["subnet"])
+	require.Equal(t, "foo", keaSubnet["client-class"])
+	require.Len(t, keaSubnet["pools"], 1)
+	require.Equal(t, "2001:db8:1::10-2001:db8:1::100", keaSubnet["pools"].([]interface{})[0].(map[string]interface{})["pool"])
+	require.Len(t, keaSubnet["pd-pools"], 1)
+	pdPool := keaSubnet["pd-pools"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, "3000::", pdPool["prefix"])
+	require.Equal(t, 48, pdPool["prefix-len"])
+	require.Equal(t, 64, pdPool["delegated-len"])
+}
+
+// Test that the parameters not managed by Stork are inherited from the
+// existing subnet configuration.
+func TestCreateSubnetCmdsSubnetExisting(t *testing.T) {
+	subnet := testSubnet{
+		prefix:        "192.0.2.0/24",
+		pools:         []string{"192.0.2.10-192.0.2.20", "192.0.2.30-192.0.2.40"},
+		localSubnetID: 123,
+	}
+	existing := map[string]interface{}{
+		"id":             float64(123),
+		"subnet":         "192.0.2.0/24",
+		"client-class":   "bar",
+		"valid-lifetime": float64(3600),
+		"pools": []interface{}{
+			map[string]interface{}{
+				"pool": "192.0.2.10 - 192.0.2.20",
+				"option-data": []interface{}{
+					map[string]interface{}{
+						"name": "routers",
+						"data": "192.0.2.1",
+					},
+				},
+			},
+			map[string]interface{}{
+				"pool": "192.0.2.50-192.0.2.60",
+			},
+		},
+	}
+	keaSubnet, err := CreateSubnetCmdsSubnet(1, subnet, existing)
+	require.NoError(t, err)
+	require.EqualValues(t, 123, keaSubnet["id"])
+	require.EqualValues(t, 3600, keaSubnet["valid-lifetime"])
+	require.NotContains(t, keaSubnet, "client-class")
+	require.NotContains(t, keaSubnet, "pd-pools")
+
+	pools := keaSubnet["pools"].([]interface{})
+	require.Len(t, pools, 2)
+	require.Contains(t, pools[0], "option-data")
+	require.Equal(t, "192.0.2.30-192.0.2.40", pools[1].(map[string]interface{})["pool"])
+
+	// The existing subnet must not be modified.
+	require.Equal(t, "bar", existing["client-class"])
+}
+
+// Test that an error is returned when the subnet is malformed or when
+// the local subnet ID can't be determined.
+func TestCreateSubnetCmdsSubnetError(t *testing.T) {
+	_, err := CreateSubnetCmdsSubnet(1, testSubnet{prefix: "192.0.2.0/24", err: errors.New("error")}, nil)
+	require.Error(t, err)
+
+	_, err = CreateSubnetCmdsSubnet(1, testSubnet{prefix: "192.0.2.0"}, nil)
+	require.Error(t, err)
+}
+
+// Test conversion of a subnet to the format used by subnet4-del and subnet6-del.
+func TestCreateSubnetCmdsDeletedSubnet(t *testing.T) {
+	deleted, err := CreateSubnetCmdsDeletedSubnet(1, testSubnet{prefix: "192.0.2.0/24", localSubnetID: 123})
+	require.NoError(t, err)
+	require.NotNil(t, deleted)
+	require.EqualValues(t, 123, deleted.ID)
+
+	_, err = CreateSubnetCmdsDeletedSubnet(1, testSubnet{prefix: "192.0.2.0/24"})
+	require.Error(t, err)
+}
@@ -465,12 +465,17 @@ func (c *Map) HideSensitiveData() {
 	hideSensitiveData((*map[string]interface{})(c))
 }
 
+// Checks if the value having the specified key holds sensitive data.
+func isSensitiveKey(key string) bool {
+	keyNormalized := strings.ToLower(key)
+	return keyNormalized == "password" || keyNormalized == "secret" || keyNormalized == "token"
+}
+
 // Hide any sensitive data in the object. Data is sensitive if its key is equal to "password", "token" or "secret".
 func hideSensitiveData(obj *map[string]interface{}) {
 	for entryKey, entryValue := range *obj {
 		// Check if the value holds sensitive data.
-		entryKeyNormalized := strings.ToLower(entryKey)
-		if entryKeyNormalized == "password" || entryKeyNormalized == "secret" || entryKeyNormalized == "token" {
+		if isSensitiveKey(entryKey) {
 			(*obj)[entryKey] = nil
 			continue
 		}
@@ -541,3 +546,176 @@ func (c *Map) DeleteClientClasses() {
 		delete(node, "client-classes")
 	}
 }
+
+// Merges the specified value of the global parameter into its existing
+// value. The maps are merged recursively, so the entries not specified in
+// the new value are preserved. The map entry having a nil value is removed
+// unless it holds sensitive data. The sensitive data are hidden when the
+// configuration is returned to the user, so the nil value means that the
+// existing value should be preserved. The lists are replaced with the new
+// values but the hidden sensitive data of the maps in the lists are
+// restored from the existing maps having the same positions. The hidden
+// sensitive data that cannot be restored are removed. Other values
+// are replaced with the new values.
+func mergeGlobalParameter(existing, value interface{}) interface{} {
+	switch newValue := value.(type) {
+	case map[string]interface{}:
+		existingMap, ok := existing.(map[string]interface{})
+		if !ok {
+			return newValue
+		}
+		merged := make(map[string]interface{})
+		for key, entry := range existingMap {
+			merged[key] = entry
+		}
+		for key, entry := range newValue {
+			if entry == nil {
+				if !isSensitiveKey(key) {
+					delete(merged, key)
+				}
+				continue
+			}
+			merged[key] = mergeGlobalParameter(existingMap[key], entry)
+		}
+		return merged
+	case []interface{}:
+		existingList, _ := existing.([]interface{})
+		merged := make([]interface{}, 0, len(newValue))
+		for i, item := range newValue {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				merged = append(merged, item)
+				continue
+			}
+			var existingItemMap map[string]interface{}
+			if i < len(existingList) {
+				existingItemMap, _ = existingList[i].(map[string]interface{})
+			}
+			mergedItem := make(map[string]interface{})
+			for key, entry := range itemMap {
+				if entry == nil && isSensitiveKey(key) {
+					if existingEntry, ok := existingItemMap[key]; ok {
+						mergedItem[key] = existingEntry
+					}
+					continue
+				}
+				mergedItem[key] = entry
+			}
+			merged = append(merged, mergedItem)
+		}
+		return merged
+	default:
+		return value
+	}
+}
+
+// Returns a copy of the configuration with the modified global parameters.
+// The returned configuration contains only the root node (e.g., Dhcp4) and
+// it can be sent to Kea in the config-test and config-set commands. The
+// parameters specified by the caller are merged into the existing ones (see
+// mergeGlobalParameter). The parameter having a nil value is removed from
+// the configuration. The parameters managed by other commands (e.g.,
+// subnets, shared networks, host reservations) and the control socket
+// configuration cannot be modified with this function. The original
+// configuration is not modified.
+func (c *Map) CreateConfigWithGlobalParameters(parameters map[string]interface{}) (*Map, error) {
+	rootName, ok := c.GetRootName()
+	if !ok {
+		return nil, errors.New("configuration lacks the root node")
+	}
+	rootNode, ok := c.getRootNode()
+	if !ok {
+		return nil, errors.Errorf("configuration root node %s is not a map", rootName)
+	}
+	newRootNode := make(map[string]interface{})
+	for key, value := range rootNode {
+		newRootNode[key] = value
+	}
+	for key, value := range parameters {
+		switch key {
+		case "subnet4", "subnet6", "shared-networks", "reservations", "control-socket", "hooks-libraries":
+			return nil, errors.Errorf("global parameter %s cannot be modified", key)
+		}
+		if value == nil {
+			delete(newRootNode, key)
+			continue
+		}
+		newRootNode[key] = mergeGlobalParameter(newRootNode[key], value)
+	}
+	return &Map{
+		rootName: newRootNode,
+	}, nil
+}
+
+// Returns a copy of the subnets list with the host reservations removed
+// from each subnet. The original subnets are not modified.
+func copySubnetsWithoutReservations(subnets []interface{}) []interface{} {
+	newSubnets := make([]interface{}, 0, len(subnets))
+	for _, s := range subnets {
+		subnet, ok := s.(map[string]interface{})
+		if !ok {
+			newSubnets = append(newSubnets, s)
+			continue
+		}
+		newSubnet := make(map[string]interface{})
+		for key, value := range subnet {
+			if key != "reservations" {
+				newSubnet[key] = value
+			}
+		}
+		newSubnets = append(newSubnets, newSubnet)
+	}
+	return newSubnets
+}
+
+// Returns a copy of the configuration with all host reservations removed.
+// It removes the global reservations and the reservations in the subnets,
+// including the subnets belonging to the shared networks. The returned
+// configuration contains only the root node (e.g., Dhcp4) and it can be
+// sent to Kea in the config-test and config-set commands. The original
+// configuration is not modified.
+func (c *Map) CreateConfigWithoutReservations() (*Map, error) {
+	rootName, ok := c.GetRootName()
+	if !ok {
+		return nil, errors.New("configuration lacks the root node")
+	}
+	rootNode, ok := c.getRootNode()
+	if !ok {
+		return nil, errors.Errorf("configuration root node %s is not a map", rootName)
+	}
+	newRootNode := make(map[string]interface{})
+	for key, value := range rootNode {
+		switch key {
+		case "reservations":
+			continue
+		case "subnet4", "subnet6":
+			if subnets, ok := value.([]interface{}); ok {
+				value = copySubnetsWithoutReservations(subnets)
+			}
+		case "shared-networks":
+			if networks, ok := value.([]interface{}); ok {
+				newNetworks := make([]interface{}, 0, len(networks))
+				for _, n := range networks {
+					network, ok := n.(map[string]interface{})
+					if !ok {
+						newNetworks = append(newNetworks, n)
+						continue
+					}
+					newNetwork := make(map[string]interface{})
+					for networkKey, networkValue := range network {
+						if subnets, ok := networkValue.([]interface{}); ok && (networkKey == "subnet4" || networkKey == "subnet6") {
+							networkValue = copySubnetsWithoutReservations(subnets)
+						}
+						newNetwork[networkKey] = networkValue
+					}
+					newNetworks = append(newNetworks, newNetwork)
+				}
+				value = newNetworks
+			}
+		}
+		newRootNode[key] = value
+	}
+	return &Map{
+		rootName: newRootNode,
+	}, nil
+}
@@ -1,6 +1,7 @@
 package keaconfig
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -1002,3 +1003,250 @@ func TestDeleteClientClasses(t *testing.T) {
 		require.Empty(t, clientClasses)
 	}
 }
+
+// Test that the configuration with modified global parameters is created
+// and the original configuration remains unchanged.
+func TestCreateConfigWithGlobalParameters(t *testing.T) {
+	configStr := `{
+        "Dhcp4": {
+            "valid-lifetime": 3600,
+            "renew-timer": 900,
+            "ddns-send-updates": true,
+            "subnet4": [
+                {
+                    "id": 1,
+                    "subnet": "192.0.2.0/24"
+                }
+            ]
+        },
+        "Logging": {}
+    }`
+	cfg, err := NewFromJSON(configStr)
+	require.NoError(t, err)
+	require.NotNil(t, cfg)
+
+	parameters := map[string]interface{}{
+		"valid-lifetime": 7200,
+		"renew-timer":    nil,
+		"option-data": []interface{}{
+			map[string]interface{}{
+				"name": "domain-name-servers",
+				"data": "192.0.2.1",
+			},
+		},
+	}
+	newCfg, err := cfg.CreateConfigWithGlobalParameters(parameters)
+	require.NoError(t, err)
+	require.NotNil(t, newCfg)
+
+	// The new configuration should only contain the root node.
+	require.Len(t, *newCfg, 1)
+	validLifetime, ok := newCfg.getTopLevelEntry("valid-lifetime")
+	require.True(t, ok)
+	require.EqualValues(t, 7200, validLifetime)
+	_, ok = newCfg.getTopLevelEntry("renew-timer")
+	require.False(t, ok)
+	ddnsSendUpdates, ok := newCfg.getTopLevelEntry("ddns-send-updates")
+	require.True(t, ok)
+	require.Equal(t, true, ddnsSendUpdates)
+	optionData, ok := newCfg.GetTopLevelList("option-data")
+	require.True(t, ok)
+	require.Len(t, optionData, 1)
+	subnets, ok := newCfg.GetTopLevelList("subnet4")
+	require.True(t, ok)
+	require.Len(t, subnets, 1)
+
+	// The original configuration should not be modified.
+	validLifetime, ok = cfg.getTopLevelEntry("valid-lifetime")
+	require.True(t, ok)
+	require.EqualValues(t, 3600, validLifetime)
+	_, ok = cfg.getTopLevelEntry("renew-timer")
+	require.True(t, ok)
+	_, ok = cfg.getTopLevelEntry("option-data")
+	require.False(t, ok)
+}
+
+// Test that the maps are merged into the existing global parameters and
+// the hidden sensitive data are preserved.
+func TestCreateConfigWithGlobalParametersMerge(t *testing.T) {
+	cfg, err := NewFromJSON(`{
+        "Dhcp4": {
+            "lease-database": {
+                "type": "postgresql",
+                "name": "kea",
+                "user": "kea",
+                "password": "secret",
+                "connect-timeout": 10
+            },
+            "hosts-databases": [
+                {
+                    "type": "mysql",
+                    "name": "hosts",
+                    "password": "hosts-secret"
+                }
+            ],
+            "dhcp-ddns": {
+                "enable-updates": false
+            }
+        }
+    }`)
+	require.NoError(t, err)
+
+	// The parameters returned to the user with the sensitive data hidden
+	// and modified by the user.
+	parameters := map[string]interface{}{
+		"lease-database": map[string]interface{}{
+			"type":            "postgresql",
+			"name":            "kea-leases",
+			"password":        nil,
+			"connect-timeout": nil,
+		},
+		"hosts-databases": []interface{}{
+			map[string]interface{}{
+				"type":     "mysql",
+				"name":     "hosts2",
+				"password": nil,
+			},
+			map[string]interface{}{
+				"type":     "postgresql",
+				"name":     "hosts3",
+				"password": nil,
+			},
+		},
+		"dhcp-ddns": map[string]interface{}{
+			"enable-updates": true,
+		},
+	}
+	newCfg, err := cfg.CreateConfigWithGlobalParameters(parameters)
+	require.NoError(t, err)
+
+	leaseDatabase, ok := newCfg.GetTopLevelMap("lease-database")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{
+		"type":     "postgresql",
+		"name":     "kea-leases",
+		"user":     "kea",
+		"password": "secret",
+	}, leaseDatabase)
+
+	hostsDatabases, ok := newCfg.GetTopLevelList("hosts-databases")
+	require.True(t, ok)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"type":     "mysql",
+			"name":     "hosts2",
+			"password": "hosts-secret",
+		},
+		map[string]interface{}{
+			"type": "postgresql",
+			"name": "hosts3",
+		},
+	}, hostsDatabases)
+
+	dhcpDdns, ok := newCfg.GetTopLevelMap("dhcp-ddns")
+	require.True(t, ok)
+	require.Equal(t, true, dhcpDdns["enable-updates"])
+
+	// The original configuration should not be modified.
+	leaseDatabase, ok = cfg.GetTopLevelMap("lease-database")
+	require.True(t, ok)
+	require.Equal(t, "kea", leaseDatabase["name"])
+	require.EqualValues(t, 10, leaseDatabase["connect-timeout"])
+}
+
+// Test that the global parameters managed by other commands cannot be
+// modified.
+func TestCreateConfigWithGlobalParametersProtected(t *testing.T) {
+	cfg, err := NewFromJSON(`{"Dhcp6": {}}`)
+	require.NoError(t, err)
+
+	for _, key := range []string{"subnet6", "shared-networks", "reservations", "control-socket", "hooks-libraries"} {
+		_, err = cfg.CreateConfigWithGlobalParameters(map[string]interface{}{
+			key: []interface{}{},
+		})
+		require.Error(t, err, key)
+	}
+
+	// The configuration without the root node.
+	cfg = &Map{}
+	_, err = cfg.CreateConfigWithGlobalParameters(nil)
+	require.Error(t, err)
+}
+
+// Test creating a copy of the configuration without host reservations.
+func TestCreateConfigWithoutReservations(t *testing.T) {
+	cfg, err := NewFromJSON(`{
+		"Dhcp4": {
+			"valid-lifetime": 3600,
+			"reservations": [
+				{ "hw-address": "01:02:03:04:05:06" }
+			],
+			"subnet4": [
+				{
+					"id": 1,
+					"subnet": "192.0.2.0/24",
+					"reservations": [
+						{ "hw-address": "01:02:03:04:05:07" }
+					]
+				}
+			],
+			"shared-networks": [
+				{
+					"name": "foo",
+					"subnet4": [
+						{
+							"id": 2,
+							"subnet": "192.0.3.0/24",
+							"reservations": [
+								{ "hw-address": "01:02:03:04:05:08" }
+							]
+						}
+					]
+				}
+			]
+		}
+	}`)
+	require.NoError(t, err)
+
+	newCfg, err := cfg.CreateConfigWithoutReservations()
+	require.NoError(t, err)
+	require.NotNil(t, newCfg)
+
+	encoded, err := json.Marshal(newCfg)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"Dhcp4": {
+			"valid-lifetime": 3600,
+			"subnet4": [
+				{
+					"id": 1,
+					"subnet": "192.0.2.0/24"
+				}
+			],
+			"shared-networks": [
+				{
+					"name": "foo",
+					"subnet4": [
+						{
+							"id": 2,
+							"subnet": "192.0.3.0/24"
+						}
+					]
+				}
+			]
+		}
+	}`, string(encoded))
+
+	// The original configuration should be unchanged.
+	reservations, ok := cfg.GetTopLevelList("reservations")
+	require.True(t, ok)
+	require.Len(t, reservations, 1)
+	subnet, ok := cfg.GetSubnetByID(2)
+	require.True(t, ok)
+	require.Contains(t, subnet, "reservations")
+
+	// The configuration without the root node.
+	cfg = &Map{}
+	_, err = cfg.CreateConfigWithoutReservations()
+	require.Error(t, err)
+}
@@ -0,0 +1,225 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/eventcenter"
+	storkutil "isc.org/stork/util"
+)
+
+// Alert rules engine. It periodically evaluates the alert rules stored
+// in the database against the metrics calculated by the server. It
+// generates the events when the alerts fire and when they are resolved.
+type Engine struct {
+	db          *pg.DB
+	eventCenter eventcenter.EventCenter
+	executor    *storkutil.PeriodicExecutor
+}
+
+// Value of the metric for a particular object. The label identifies
+// the object, e.g. a subnet prefix. It is empty for the global metrics.
+type metricSample struct {
+	label    string
+	value    float64
+	subnetID int64
+}
+
+// Key identifying the alert raised by the rule for the object.
+type alertKey struct {
+	ruleID int64
+	label  string
+}
+
+// Creates an instance of the alert rules engine and starts evaluating
+// the rules according to the interval specified in the database.
+func NewEngine(db *pg.DB, eventCenter eventcenter.EventCenter) (*Engine, error) {
+	engine := &Engine{
+		db:          db,
+		eventCenter: eventCenter,
+	}
+	intervalSettingName := "alert_rules_evaluation_interval"
+
+	executor, err := storkutil.NewPeriodicExecutor("alert rules engine",
+		engine.evaluate,
+		func() (int64, error) {
+			interval, err := dbmodel.GetSettingInt(db, intervalSettingName)
+			return interval, errors.WithMessagef(err, "problem getting interval setting %s from db",
+				intervalSettingName)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	engine.executor = executor
+	return engine, nil
+}
+
+// Stops evaluating the alert rules.
+func (engine *Engine) Shutdown() {
+	engine.executor.Shutdown()
+}
+
+// Calculates the current metrics and evaluates the alert rules.
+func (engine *Engine) evaluate() error {
+	metrics, err := dbmodel.GetCalculatedMetrics(engine.db)
+	if err != nil {
+		return err
+	}
+	return evaluateRules(engine.db, engine.eventCenter, metrics, storkutil.UTCNow())
+}
+
+// Returns the values of the metric for all objects. The utilizations are
+// expressed in percent.
+func getMetricSamples(metric dbmodel.AlertMetric, metrics *dbmodel.CalculatedMetrics) []metricSample {
+	samples := []metricSample{}
+	switch metric {
+	case dbmodel.AlertMetricSubnetAddressUtilization:
+		for _, m := range metrics.SubnetMetrics {
+			samples = append(samples, metricSample{m.Label, float64(m.AddrUtilization) / 10, m.ID})
+		}
+	case dbmodel.AlertMetricSubnetPdUtilization:
+		for _, m := range metrics.SubnetMetrics {
+			samples = append(samples, metricSample{m.Label, float64(m.PdUtilization) / 10, m.ID})
+		}
+	case dbmodel.AlertMetricSharedNetworkAddressUtilization:
+		for _, m := range metrics.SharedNetworkMetrics {
+			samples = append(samples, metricSample{m.Label, float64(m.AddrUtilization) / 10, 0})
+		}
+	case dbmodel.AlertMetricSharedNetworkPdUtilization:
+		for _, m := range metrics.SharedNetworkMetrics {
+			samples = append(samples, metricSample{m.Label, float64(m.PdUtilization) / 10, 0})
+		}
+	case dbmodel.AlertMetricPoolAddressUtilization:
+		for _, m := range metrics.PoolMetrics {
+			label := fmt.Sprintf("%s in %s", m.Pool, m.Subnet)
+			samples = append(samples, metricSample{label, float64(m.Utilization) / 10, 0})
+		}
+	case dbmodel.AlertMetricUnreachableMachines:
+		samples = append(samples, metricSample{"", float64(metrics.UnreachableMachines), 0})
+	case dbmodel.AlertMetricHADegradedServers:
+		for _, m := range metrics.HAMetrics {
+			samples = append(samples, metricSample{m.GetLabel(), float64(m.GetDegradedServers()), 0})
+		}
+	case dbmodel.AlertMetricConfigReviewIssues:
+		samples = append(samples, metricSample{"", float64(metrics.ConfigReviewIssues), 0})
+	}
+	return samples
+}
+
+// Returns the text describing the metric value of the alert.
+func describeAlert(rule *dbmodel.AlertRule, alert *dbmodel.Alert) string {
+	metric := rule.Metric
+	if len(alert.Label) > 0 {
+		metric = fmt.Sprintf("%s of %s", rule.Metric, alert.Label)
+	}
+	return fmt.Sprintf("%s is %g (threshold %s %g)", metric, alert.Value, rule.Operator, rule.Threshold)
+}
+
+// Returns the objects the alert event relates to.
+func getAlertEventObjects(alert *dbmodel.Alert) []interface{} {
+	if alert.SubnetID != nil {
+		return []interface{}{&dbmodel.Subnet{ID: *alert.SubnetID}}
+	}
+	return nil
+}
+
+// Evaluates the enabled alert rules against the metrics. A new pending
+// alert is created when the rule condition is met for an object for the
+// first time. The alert fires when the condition has been met for the
+// rule duration. The alerts are deleted when the condition is no longer
+// met or the rule has been disabled. The events are generated when the
+// alerts fire and when the firing alerts are resolved.
+func evaluateRules(db dbops.DBI, eventCenter eventcenter.EventCenter, metrics *dbmodel.CalculatedMetrics, now time.Time) error {
+	rules, err := dbmodel.GetAllAlertRules(db)
+	if err != nil {
+		return err
+	}
+	alerts, err := dbmodel.GetAllAlerts(db)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[alertKey]*dbmodel.Alert)
+	for i := range alerts {
+		existing[alertKey{alerts[i].RuleID, alerts[i].Label}] = &alerts[i]
+	}
+
+	var lastErr error
+	active := make(map[alertKey]bool)
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled {
+			continue
+		}
+		for _, sample := range getMetricSamples(rule.Metric, metrics) {
+			if !rule.IsMet(sample.value) {
+				continue
+			}
+			key := alertKey{rule.ID, sample.label}
+			active[key] = true
+
+			alert, ok := existing[key]
+			if !ok {
+				alert = &dbmodel.Alert{
+					RuleID:    rule.ID,
+					Label:     sample.label,
+					StartedAt: now,
+				}
+			}
+			alert.Value = sample.value
+			alert.SubnetID = nil
+			if sample.subnetID != 0 {
+				subnetID := sample.subnetID
+				alert.SubnetID = &subnetID
+			}
+			fired := !alert.IsFiring() && now.Sub(alert.StartedAt) >= time.Duration(rule.Duration)*time.Second
+			if fired {
+				alert.FiredAt = now
+			}
+
+			if ok {
+				err = dbmodel.UpdateAlert(db, alert)
+			} else {
+				err = dbmodel.AddAlert(db, alert)
+			}
+			if err != nil {
+				lastErr = err
+				log.Errorf("Cannot store alert for rule %s: %s", rule.Name, err)
+				continue
+			}
+
+			if fired {
+				event := eventcenter.CreateEvent(rule.Severity,
+					fmt.Sprintf("alert %s is firing: %s", rule.Name, describeAlert(rule, alert)),
+					getAlertEventObjects(alert)...)
+				eventCenter.AddEvent(event)
+			}
+		}
+	}
+
+	for i := range alerts {
+		alert := &alerts[i]
+		if active[alertKey{alert.RuleID, alert.Label}] {
+			continue
+		}
+		if err = dbmodel.DeleteAlert(db, alert.ID); err != nil {
+			lastErr = err
+			log.Errorf("Cannot delete alert with ID %d: %s", alert.ID, err)
+			continue
+		}
+		if alert.IsFiring() && alert.Rule != nil {
+			event := eventcenter.CreateEvent(dbmodel.EvInfo,
+				fmt.Sprintf("alert %s resolved: %s", alert.Rule.Name, describeAlert(alert.Rule, alert)),
+				getAlertEventObjects(alert)...)
+			eventCenter.AddEvent(event)
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,254 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	storktest "isc.org/stork/server/test/dbmodel"
+)
+
+// Returns the metrics used in the tests.
+func newTestMetrics() *dbmodel.CalculatedMetrics {
+	return &dbmodel.CalculatedMetrics{
+		UnreachableMachines: 2,
+		ConfigReviewIssues:  5,
+		SubnetMetrics: []dbmodel.CalculatedNetworkMetrics{
+			{ID: 1, Label: "192.0.2.0/24", AddrUtilization: 955, PdUtilization: 0},
+			{ID: 2, Label: "2001:db8:1::/64", AddrUtilization: 100, PdUtilization: 500},
+		},
+		SharedNetworkMetrics: []dbmodel.CalculatedNetworkMetrics{
+			{ID: 1, Label: "foo", AddrUtilization: 800, PdUtilization: 10},
+		},
+		PoolMetrics: []dbmodel.CalculatedPoolMetrics{
+			{Subnet: "192.0.2.0/24", Pool: "192.0.2.10-192.0.2.20", Utilization: 1000},
+		},
+		HAMetrics: []dbmodel.CalculatedHAMetrics{
+			{
+				ServiceID:          1,
+				Name:               "ha",
+				PrimaryID:          1,
+				SecondaryID:        2,
+				PrimaryLastState:   dbmodel.HAStatePartnerDown,
+				SecondaryLastState: dbmodel.HAStateUnavailable,
+				PrimaryReachable:   true,
+			},
+		},
+	}
+}
+
+// Test that the metric values are selected for the rules.
+func TestGetMetricSamples(t *testing.T) {
+	metrics := newTestMetrics()
+
+	samples := getMetricSamples(dbmodel.AlertMetricSubnetAddressUtilization, metrics)
+	require.Len(t, samples, 2)
+	require.Equal(t, "192.0.2.0/24", samples[0].label)
+	require.InDelta(t, 95.5, samples[0].value, 0.001)
+	require.EqualValues(t, 1, samples[0].subnetID)
+	require.InDelta(t, 10, samples[1].value, 0.001)
+
+	samples = getMetricSamples(dbmodel.AlertMetricSubnetPdUtilization, metrics)
+	require.Len(t, samples, 2)
+	require.InDelta(t, 50, samples[1].value, 0.001)
+
+	samples = getMetricSamples(dbmodel.AlertMetricSharedNetworkAddressUtilization, metrics)
+	require.Len(t, samples, 1)
+	require.Equal(t, "foo", samples[0].label)
+	require.InDelta(t, 80, samples[0].value, 0.001)
+	require.Zero(t, samples[0].subnetID)
+
+	samples = getMetricSamples(dbmodel.AlertMetricSharedNetworkPdUtilization, metrics)
+	require.Len(t, samples, 1)
+	require.InDelta(t, 1, samples[0].value, 0.001)
+
+	samples = getMetricSamples(dbmodel.AlertMetricPoolAddressUtilization, metrics)
+	require.Len(t, samples, 1)
+	require.Equal(t, "192.0.2.10-192.0.2.20 in 192.0.2.0/24", samples[0].label)
+	require.InDelta(t, 100, samples[0].value, 0.001)
+
+	samples = getMetricSamples(dbmodel.AlertMetricUnreachableMachines, metrics)
+	require.Len(t, samples, 1)
+	require.Empty(t, samples[0].label)
+	require.EqualValues(t, 2, samples[0].value)
+
+	samples = getMetricSamples(dbmodel.AlertMetricHADegradedServers, metrics)
+	require.Len(t, samples, 1)
+	require.Equal(t, "ha", samples[0].label)
+	require.EqualValues(t, 2, samples[0].value)
+
+	samples = getMetricSamples(dbmodel.AlertMetricConfigReviewIssues, metrics)
+	require.Len(t, samples, 1)
+	require.EqualValues(t, 5, samples[0].value)
+
+	require.Empty(t, getMetricSamples("foo", metrics))
+}
+
+// Test the description of the alerts used in the events.
+func TestDescribeAlert(t *testing.T) {
+	rule := &dbmodel.AlertRule{
+		Metric:    dbmodel.AlertMetricSubnetAddressUtilization,
+		Operator:  dbmodel.AlertOperatorGreater,
+		Threshold: 90,
+	}
+	alert := &dbmodel.Alert{
+		Label: "192.0.2.0/24",
+		Value: 95.5,
+	}
+	require.Equal(t, "subnet-address-utilization of 192.0.2.0/24 is 95.5 (threshold > 90)", describeAlert(rule, alert))
+
+	rule.Metric = dbmodel.AlertMetricUnreachableMachines
+	rule.Threshold = 0
+	alert = &dbmodel.Alert{Value: 2}
+	require.Equal(t, "unreachable-machines is 2 (threshold > 0)", describeAlert(rule, alert))
+}
+
+// Test that the alerts become pending, fire and are resolved as the
+// metrics change and that the events are generated.
+func TestEvaluateRules(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err := dbmodel.AddSubnet(db, subnet)
+	require.NoError(t, err)
+
+	utilizationRule := &dbmodel.AlertRule{
+		Name:      "high utilization",
+		Metric:    dbmodel.AlertMetricSubnetAddressUtilization,
+		Operator:  dbmodel.AlertOperatorGreater,
+		Threshold: 90,
+		Duration:  300,
+		Severity:  dbmodel.EvWarning,
+		Enabled:   true,
+	}
+	err = dbmodel.AddAlertRule(db, utilizationRule)
+	require.NoError(t, err)
+	unreachableRule := &dbmodel.AlertRule{
+		Name:     "unreachable",
+		Metric:   dbmodel.AlertMetricUnreachableMachines,
+		Operator: dbmodel.AlertOperatorGreater,
+		Severity: dbmodel.EvError,
+		Enabled:  true,
+	}
+	err = dbmodel.AddAlertRule(db, unreachableRule)
+	require.NoError(t, err)
+	disabledRule := &dbmodel.AlertRule{
+		Name:     "config review",
+		Metric:   dbmodel.AlertMetricConfigReviewIssues,
+		Operator: dbmodel.AlertOperatorGreater,
+		Enabled:  false,
+	}
+	err = dbmodel.AddAlertRule(db, disabledRule)
+	require.NoError(t, err)
+
+	metrics := newTestMetrics()
+	metrics.SubnetMetrics[0].ID = subnet.ID
+	fec := &storktest.FakeEventCenter{}
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	// The utilization alert is pending and the unreachable machines
+	// alert fires immediately because its duration is zero.
+	err = evaluateRules(db, fec, metrics, now)
+	require.NoError(t, err)
+
+	alerts, err := dbmodel.GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	require.Equal(t, utilizationRule.ID, alerts[0].RuleID)
+	require.Equal(t, "192.0.2.0/24", alerts[0].Label)
+	require.False(t, alerts[0].IsFiring())
+	require.NotNil(t, alerts[0].SubnetID)
+	require.Equal(t, subnet.ID, *alerts[0].SubnetID)
+	require.Equal(t, unreachableRule.ID, alerts[1].RuleID)
+	require.True(t, alerts[1].IsFiring())
+
+	require.Len(t, fec.Events, 1)
+	require.EqualValues(t, dbmodel.EvError, fec.Events[0].Level)
+	require.Contains(t, fec.Events[0].Text, "alert unreachable is firing")
+
+	// The utilization condition has not been met for the rule duration.
+	err = evaluateRules(db, fec, metrics, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, fec.Events, 1)
+
+	// The utilization alert fires after the rule duration.
+	metrics.SubnetMetrics[0].AddrUtilization = 970
+	err = evaluateRules(db, fec, metrics, now.Add(5*time.Minute))
+	require.NoError(t, err)
+
+	alerts, err = dbmodel.GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	require.True(t, alerts[0].IsFiring())
+	require.InDelta(t, 97, alerts[0].Value, 0.001)
+	require.Equal(t, now, alerts[0].StartedAt)
+
+	require.Len(t, fec.Events, 2)
+	require.EqualValues(t, dbmodel.EvWarning, fec.Events[1].Level)
+	require.Contains(t, fec.Events[1].Text, "alert high utilization is firing")
+	require.Equal(t, subnet.ID, fec.Events[1].Relations.SubnetID)
+
+	// The firing alerts do not generate the events again.
+	err = evaluateRules(db, fec, metrics, now.Add(6*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, fec.Events, 2)
+
+	// Resolve the alerts.
+	metrics.SubnetMetrics[0].AddrUtilization = 500
+	metrics.UnreachableMachines = 0
+	err = evaluateRules(db, fec, metrics, now.Add(7*time.Minute))
+	require.NoError(t, err)
+
+	alerts, err = dbmodel.GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Empty(t, alerts)
+
+	require.Len(t, fec.Events, 4)
+	require.EqualValues(t, dbmodel.EvInfo, fec.Events[2].Level)
+	require.Contains(t, fec.Events[2].Text, "alert high utilization resolved")
+	require.EqualValues(t, dbmodel.EvInfo, fec.Events[3].Level)
+	require.Contains(t, fec.Events[3].Text, "alert unreachable resolved")
+}
+
+// Test that the pending alerts of the disabled rules are removed without
+// generating the events.
+func TestEvaluateRulesDisabledRule(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	rule := &dbmodel.AlertRule{
+		Name:     "config review",
+		Metric:   dbmodel.AlertMetricConfigReviewIssues,
+		Operator: dbmodel.AlertOperatorGreater,
+		Duration: 60,
+		Enabled:  true,
+	}
+	err := dbmodel.AddAlertRule(db, rule)
+	require.NoError(t, err)
+
+	fec := &storktest.FakeEventCenter{}
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	err = evaluateRules(db, fec, newTestMetrics(), now)
+	require.NoError(t, err)
+
+	alerts, err := dbmodel.GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+
+	rule.Enabled = false
+	err = dbmodel.UpdateAlertRule(db, rule)
+	require.NoError(t, err)
+
+	err = evaluateRules(db, fec, newTestMetrics(), now.Add(2*time.Minute))
+	require.NoError(t, err)
+
+	alerts, err = dbmodel.GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Empty(t, alerts)
+	require.Empty(t, fec.Events)
+}
@@ -2,13 +2,19 @@ package kea
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 
 	pkgerrors "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	keaconfig "isc.org/stork/appcfg/kea"
 	keactrl "isc.org/stork/appctrl/kea"
 	agentcomm "isc.org/stork/server/agentcomm"
 	config "isc.org/stork/server/config"
+	"isc.org/stork/server/configreview"
 	dbmodel "isc.org/stork/server/database/model"
+	storkutil "isc.org/stork/util"
 )
 
 // A configuration manager module responsible for Kea configuration.
@@ -39,6 +45,22 @@ func (module *ConfigModule) Commit(ctx context.Context) (context.Context, error)
 			ctx, err = module.commitHostUpdate(ctx)
 		case "host_delete":
 			ctx, err = module.commitHostDelete(ctx)
+		case "subnet_add":
+			ctx, err = module.commitSubnetAdd(ctx)
+		case "subnet_update":
+			ctx, err = module.commitSubnetUpdate(ctx)
+		case "subnet_delete":
+			ctx, err = module.commitSubnetDelete(ctx)
+		case "shared_network_add":
+			ctx, err = module.commitSharedNetworkAdd(ctx)
+		case "shared_network_update":
+			ctx, err = module.commitSharedNetworkUpdate(ctx)
+		case "global_parameters_update":
+			ctx, err = module.commitGlobalParametersUpdate(ctx)
+		case "config_rollback":
+			ctx, err = module.commitConfigRollback(ctx)
+		case "hosts_migration":
+			ctx, err = module.commitHostsMigration(ctx)
 		default:
 			err = pkgerrors.Errorf("unknown operation %s when called Commit()", pu.Operation)
 		}
@@ -60,22 +82,58 @@ func (module *ConfigModule) BeginHostAdd(ctx context.Context) (context.Context,
 // Applies new host reservation. It prepares necessary commands to be sent
 // to Kea upon commit.
 func (module *ConfigModule) ApplyHostAdd(ctx context.Context, host *dbmodel.Host) (context.Context, error) {
+	commands, err := module.createHostAddCommands(host)
+	if err != nil {
+		return ctx, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// Applies a batch of new host reservations. It prepares necessary commands
+// to be sent to Kea upon commit. The commands are sent in the order of the
+// hosts. Sending the commands stops at the first failure, so the hosts
+// preceding the failed one are created in Kea.
+func (module *ConfigModule) ApplyHostsAdd(ctx context.Context, hosts []*dbmodel.Host) (context.Context, error) {
+	if len(hosts) == 0 {
+		return ctx, pkgerrors.New("no hosts applied")
+	}
+	var commands []interface{}
+	for _, host := range hosts {
+		hostCommands, err := module.createHostAddCommands(host)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, hostCommands...)
+	}
+	var err error
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// Creates the reservation-add commands for the new host reservation and
+// associates them with the apps receiving them.
+func (module *ConfigModule) createHostAddCommands(host *dbmodel.Host) ([]interface{}, error) {
 	if len(host.LocalHosts) == 0 {
-		return ctx, pkgerrors.Errorf("applied host %d is not associated with any daemon", host.ID)
+		return nil, pkgerrors.Errorf("applied host %d is not associated with any daemon", host.ID)
 	}
 	var commands []interface{}
 	for _, lh := range host.LocalHosts {
 		if lh.Daemon == nil {
-			return ctx, pkgerrors.Errorf("applied host %d is associated with nil daemon", host.ID)
+			return nil, pkgerrors.Errorf("applied host %d is associated with nil daemon", host.ID)
 		}
 		if lh.Daemon.App == nil {
-			return ctx, pkgerrors.Errorf("applied host %d is associated with nil app", host.ID)
+			return nil, pkgerrors.Errorf("applied host %d is associated with nil app", host.ID)
 		}
 		// Convert the host information to Kea reservation.
 		lookup := module.manager.GetDHCPOptionDefinitionLookup()
 		reservation, err := keaconfig.CreateHostCmdsReservation(lh.DaemonID, lookup, host)
 		if err != nil {
-			return ctx, err
+			return nil, err
 		}
 		// Create command arguments.
 		arguments := make(map[string]interface{})
@@ -86,16 +144,12 @@ func (module *ConfigModule) ApplyHostAdd(ctx context.Context, host *dbmodel.Host
 		appCommand["app"] = lh.Daemon.App
 		commands = append(commands, appCommand)
 	}
-	var err error
-	if ctx, err = config.SetValueForUpdate(ctx, 0, "commands", commands); err != nil {
-		return ctx, err
-	}
-	return ctx, nil
+	return commands, nil
 }
 
 // Create the host reservation in the Kea servers.
 func (module *ConfigModule) commitHostAdd(ctx context.Context) (context.Context, error) {
-	return module.commitHostChanges(ctx)
+	return module.commitChanges(ctx)
 }
 
 // Begins a host reservation update. It fetches the specified host reservation
@@ -195,7 +249,7 @@ func (module *ConfigModule) ApplyHostUpdate(ctx context.Context, host *dbmodel.H
 
 // Create the updated host reservation in the Kea servers.
 func (module *ConfigModule) commitHostUpdate(ctx context.Context) (context.Context, error) {
-	return module.commitHostChanges(ctx)
+	return module.commitChanges(ctx)
 }
 
 // Begins deleting a host reservation. Currently it is no-op but may evolve
@@ -251,7 +305,7 @@ func (module *ConfigModule) commitHostDelete(ctx context.Context) (context.Conte
 		return ctx, pkgerrors.New("context lacks state")
 	}
 	var err error
-	ctx, err = module.commitHostChanges(ctx)
+	ctx, err = module.commitChanges(ctx)
 	if err != nil {
 		return ctx, err
 	}
@@ -268,76 +322,1696 @@ func (module *ConfigModule) commitHostDelete(ctx context.Context) (context.Conte
 	return ctx, nil
 }
 
-// Generic function used to commit host changes (i.e., delete,  add or update host reservation)
-// using the data stored in the context.
-func (module *ConfigModule) commitHostChanges(ctx context.Context) (context.Context, error) {
+// Returns the name of the subnet list in the configuration of the
+// specified daemon, i.e. subnet4 or subnet6. The returned name is also
+// a prefix of the subnet_cmds hook library commands, e.g. subnet4-add.
+func getSubnetParamName(daemon *dbmodel.Daemon) (string, error) {
+	switch daemon.Name {
+	case dhcp4:
+		return "subnet4", nil
+	case dhcp6:
+		return "subnet6", nil
+	default:
+		return "", pkgerrors.Errorf("daemon %s does not support subnets", daemon.Name)
+	}
+}
+
+// Creates a copy of the subnet including only the information required to
+// commit the subnet into the database. It excludes the daemons and other
+// data which would unnecessarily bloat the transaction state stored in the
+// database when the configuration change is scheduled.
+func newSubnetForCommit(subnet *dbmodel.Subnet) dbmodel.Subnet {
+	subnetForCommit := dbmodel.Subnet{
+		ID:              subnet.ID,
+		Prefix:          subnet.Prefix,
+		ClientClass:     subnet.ClientClass,
+		SharedNetworkID: subnet.SharedNetworkID,
+	}
+	for _, p := range subnet.AddressPools {
+		subnetForCommit.AddressPools = append(subnetForCommit.AddressPools, dbmodel.AddressPool{
+			LowerBound: p.LowerBound,
+			UpperBound: p.UpperBound,
+		})
+	}
+	for _, p := range subnet.PrefixPools {
+		subnetForCommit.PrefixPools = append(subnetForCommit.PrefixPools, dbmodel.PrefixPool{
+			Prefix:       p.Prefix,
+			DelegatedLen: p.DelegatedLen,
+		})
+	}
+	for _, ls := range subnet.LocalSubnets {
+		subnetForCommit.LocalSubnets = append(subnetForCommit.LocalSubnets, &dbmodel.LocalSubnet{
+			DaemonID:      ls.DaemonID,
+			LocalSubnetID: ls.LocalSubnetID,
+		})
+	}
+	return subnetForCommit
+}
+
+// Validates the local subnet before creating a command for it. It checks
+// that the local subnet is associated with a daemon and an app, and that
+// the daemon supports the subnet's family.
+func validateLocalSubnet(subnet *dbmodel.Subnet, ls *dbmodel.LocalSubnet) (string, error) {
+	if ls.Daemon == nil {
+		return "", pkgerrors.Errorf("subnet %s is associated with nil daemon", subnet.Prefix)
+	}
+	if ls.Daemon.App == nil {
+		return "", pkgerrors.Errorf("subnet %s is associated with nil app", subnet.Prefix)
+	}
+	subnetParamName, err := getSubnetParamName(ls.Daemon)
+	if err != nil {
+		return "", err
+	}
+	if (subnet.GetFamily() == 4) != (subnetParamName == "subnet4") {
+		return "", pkgerrors.Errorf("subnet %s cannot be configured in %s daemon", subnet.Prefix, ls.Daemon.Name)
+	}
+	return subnetParamName, nil
+}
+
+// Creates a subnet4-add or subnet6-add command for the specified local subnet
+// and associates it with an app receiving this command. The existing parameter
+// holds the subnet from the daemon's configuration. It is used when the
+// subnet is updated and is nil when the subnet is added.
+func newSubnetAddOrUpdateCommand(subnet *dbmodel.Subnet, ls *dbmodel.LocalSubnet, operation string, existing map[string]any) (map[string]any, error) {
+	subnetParamName, err := validateLocalSubnet(subnet, ls)
+	if err != nil {
+		return nil, err
+	}
+	// Convert the subnet information to Kea subnet.
+	keaSubnet, err := keaconfig.CreateSubnetCmdsSubnet(ls.DaemonID, subnet, existing)
+	if err != nil {
+		return nil, err
+	}
+	// Create command arguments.
+	arguments := make(map[string]any)
+	arguments[subnetParamName] = []any{keaSubnet}
+	// Associate the command with an app receiving this command.
+	appCommand := make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand(fmt.Sprintf("%s-%s", subnetParamName, operation), []string{ls.Daemon.Name}, arguments)
+	appCommand["app"] = ls.Daemon.App
+	return appCommand, nil
+}
+
+// Creates a subnet4-del or subnet6-del command for the specified local subnet
+// and associates it with an app receiving this command.
+func newSubnetDeleteCommand(subnet *dbmodel.Subnet, ls *dbmodel.LocalSubnet) (map[string]any, error) {
+	subnetParamName, err := validateLocalSubnet(subnet, ls)
+	if err != nil {
+		return nil, err
+	}
+	// Convert the subnet information to the subnet4-del or subnet6-del arguments.
+	arguments, err := keaconfig.CreateSubnetCmdsDeletedSubnet(ls.DaemonID, subnet)
+	if err != nil {
+		return nil, err
+	}
+	// Associate the command with an app receiving this command.
+	appCommand := make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand(fmt.Sprintf("%s-del", subnetParamName), []string{ls.Daemon.Name}, arguments)
+	appCommand["app"] = ls.Daemon.App
+	return appCommand, nil
+}
+
+// Begins adding a new subnet. It initializes transaction state.
+func (module *ConfigModule) BeginSubnetAdd(ctx context.Context) (context.Context, error) {
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_add")
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies new subnet. It locks the configurations of the daemons which
+// should receive the subnet and prepares necessary commands to be sent
+// to Kea upon commit.
+func (module *ConfigModule) ApplySubnetAdd(ctx context.Context, subnet *dbmodel.Subnet) (context.Context, error) {
+	if len(subnet.LocalSubnets) == 0 {
+		return ctx, pkgerrors.Errorf("applied subnet %s is not associated with any daemon", subnet.Prefix)
+	}
+	var (
+		commands  []any
+		daemonIDs []int64
+	)
+	for _, ls := range subnet.LocalSubnets {
+		appCommand, err := newSubnetAddOrUpdateCommand(subnet, ls, "add", nil)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommand)
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	// Try to lock configurations.
+	ctx, err := module.manager.Lock(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_add", daemonIDs...)
+	if err := state.SetValueForUpdate(0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	if err := state.SetValueForUpdate(0, "subnet", newSubnetForCommit(subnet)); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Creates the subnet in the Kea servers and in the database.
+func (module *ConfigModule) commitSubnetAdd(ctx context.Context) (context.Context, error) {
+	return module.commitSubnetChanges(ctx, func(subnet *dbmodel.Subnet) error {
+		return dbmodel.AddSubnetWithLocalSubnets(module.manager.GetDB(), subnet)
+	})
+}
+
+// Begins a subnet update. It fetches the specified subnet from the database
+// and stores it in the context state. Then, it locks the daemons associated
+// with the subnet for updates.
+func (module *ConfigModule) BeginSubnetUpdate(ctx context.Context, subnetID int64) (context.Context, error) {
+	// Try to get the subnet to be updated from the database.
+	subnet, err := dbmodel.GetSubnet(module.manager.GetDB(), subnetID)
+	if err != nil {
+		// Internal database error.
+		return ctx, err
+	}
+	// Subnet does not exist.
+	if subnet == nil {
+		return ctx, pkgerrors.WithStack(config.NewSubnetNotFoundError(subnetID))
+	}
+	// Get the list of daemons for whose configurations must be locked for
+	// updates.
+	var daemonIDs []int64
+	for _, ls := range subnet.LocalSubnets {
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	// Try to lock configurations.
+	ctx, err = module.manager.Lock(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_update", daemonIDs...)
+	if err := state.SetValueForUpdate(0, "subnet_before_update", *subnet); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies updated subnet. It prepares necessary commands to be sent to Kea
+// upon commit. The subnet is updated with subnet4-update or subnet6-update
+// in the daemons which already have it. The remaining daemons receive
+// subnet4-add or subnet6-add. The subnet is deleted from the daemons which
+// no longer have it, using subnet4-del or subnet6-del. The updated subnet
+// inherits the parameters not managed by Stork from the daemons'
+// configurations.
+func (module *ConfigModule) ApplySubnetUpdate(ctx context.Context, subnet *dbmodel.Subnet) (context.Context, error) {
+	if len(subnet.LocalSubnets) == 0 {
+		return ctx, pkgerrors.Errorf("applied subnet %s is not associated with any daemon", subnet.Prefix)
+	}
+	// Retrieve existing subnet from the context. We will need it for sending
+	// the subnet4-del or subnet6-del commands to the daemons which no longer
+	// have the subnet.
+	existingSubnetIface, err := config.GetValueForUpdate(ctx, 0, "subnet_before_update")
+	if err != nil {
+		return ctx, err
+	}
+	existingSubnet := existingSubnetIface.(dbmodel.Subnet)
+	subnet.ID = existingSubnet.ID
+
+	// The daemons which already have the subnet must keep its ID. Otherwise,
+	// the subnet updated in Kea wouldn't match the subnet in the database.
+	for _, ls := range subnet.LocalSubnets {
+		localSubnetID, err := existingSubnet.GetLocalSubnetID(ls.DaemonID)
+		if err != nil {
+			continue
+		}
+		if ls.LocalSubnetID != localSubnetID {
+			return ctx, pkgerrors.Errorf("cannot change the ID of subnet %s from %d to %d in the daemon with ID %d",
+				subnet.Prefix, localSubnetID, ls.LocalSubnetID, ls.DaemonID)
+		}
+	}
+
+	var (
+		commands  []any
+		daemonIDs []int64
+	)
+	// First, delete the subnet from the daemons which no longer have it.
+	for _, ls := range existingSubnet.LocalSubnets {
+		if _, err := subnet.GetLocalSubnetID(ls.DaemonID); err == nil {
+			continue
+		}
+		appCommand, err := newSubnetDeleteCommand(&existingSubnet, ls)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommand)
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	// Update the subnet in the remaining daemons or add it when the daemon
+	// didn't have this subnet.
+	for _, ls := range subnet.LocalSubnets {
+		var appCommand map[string]any
+		if localSubnetID, err := existingSubnet.GetLocalSubnetID(ls.DaemonID); err == nil {
+			var existing map[string]any
+			if ls.Daemon != nil && ls.Daemon.KeaDaemon != nil && ls.Daemon.KeaDaemon.Config != nil {
+				existing, _ = ls.Daemon.KeaDaemon.Config.GetSubnetByID(localSubnetID)
+			}
+			appCommand, err = newSubnetAddOrUpdateCommand(subnet, ls, "update", existing)
+			if err != nil {
+				return ctx, err
+			}
+		} else {
+			appCommand, err = newSubnetAddOrUpdateCommand(subnet, ls, "add", nil)
+			if err != nil {
+				return ctx, err
+			}
+		}
+		commands = append(commands, appCommand)
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	// The daemons which receive the subnet for the first time have not been
+	// locked when the transaction began.
+	ctx, err = module.manager.LockMore(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// The subnet update does not move the subnet to another shared network.
+	subnetForCommit := newSubnetForCommit(subnet)
+	subnetForCommit.SharedNetworkID = existingSubnet.SharedNetworkID
+
+	state, _ := config.GetTransactionState(ctx)
+	state.Updates[0].DaemonIDs = daemonIDs
+	if err := state.SetValueForUpdate(0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	if err := state.SetValueForUpdate(0, "subnet", subnetForCommit); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, state)
+	return ctx, nil
+}
+
+// Updates the subnet in the Kea servers and in the database.
+func (module *ConfigModule) commitSubnetUpdate(ctx context.Context) (context.Context, error) {
+	return module.commitSubnetChanges(ctx, func(subnet *dbmodel.Subnet) error {
+		return dbmodel.UpdateSubnetWithLocalSubnets(module.manager.GetDB(), subnet)
+	})
+}
+
+// Begins deleting a subnet. Currently it is no-op but may evolve
+// in the future.
+func (module *ConfigModule) BeginSubnetDelete(ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+// Creates requests to delete a subnet. It locks the configurations of the
+// daemons having the subnet and prepares necessary commands to be sent to
+// Kea upon commit.
+func (module *ConfigModule) ApplySubnetDelete(ctx context.Context, subnet *dbmodel.Subnet) (context.Context, error) {
+	if len(subnet.LocalSubnets) == 0 {
+		return ctx, pkgerrors.Errorf("deleted subnet %d is not associated with any daemon", subnet.ID)
+	}
+	var (
+		commands  []any
+		daemonIDs []int64
+	)
+	for _, ls := range subnet.LocalSubnets {
+		appCommand, err := newSubnetDeleteCommand(subnet, ls)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommand)
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	// Try to lock configurations.
+	ctx, err := module.manager.Lock(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_delete", daemonIDs...)
+	if err := state.SetValueForUpdate(0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	if err := state.SetValueForUpdate(0, "id", subnet.ID); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Deletes the subnet from the Kea servers and from the database.
+func (module *ConfigModule) commitSubnetDelete(ctx context.Context) (context.Context, error) {
 	state, ok := config.GetTransactionState(ctx)
 	if !ok {
 		return ctx, pkgerrors.New("context lacks state")
 	}
+	var err error
+	ctx, err = module.commitChanges(ctx)
+	if err != nil {
+		return ctx, err
+	}
 	for _, update := range state.Updates {
-		// Retrieve associations between the commands and apps.
-		appCommands, ok := update.Recipe["commands"]
+		subnetID, err := update.GetRecipeValueAsInt64("id")
+		if err != nil {
+			return ctx, err
+		}
+		err = dbmodel.DeleteSubnet(module.manager.GetDB(), subnetID)
+		if err != nil {
+			return ctx, err
+		}
+		module.beginConfigReviews(update.DaemonIDs)
+	}
+	return ctx, nil
+}
+
+// Generic function used to commit subnet changes (i.e., add or update a
+// subnet). It sends the commands to Kea and calls the specified function
+// to store the subnet held in the context in the database. Finally, it
+// begins the configuration reviews for the updated daemons.
+func (module *ConfigModule) commitSubnetChanges(ctx context.Context, commitToDB func(*dbmodel.Subnet) error) (context.Context, error) {
+	state, ok := config.GetTransactionState(ctx)
+	if !ok {
+		return ctx, pkgerrors.New("context lacks state")
+	}
+	var err error
+	ctx, err = module.commitChanges(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	for i, update := range state.Updates {
+		subnetIface, ok := update.Recipe["subnet"]
 		if !ok {
-			return ctx, pkgerrors.New("Kea commands not found in the context")
+			return ctx, pkgerrors.New("subnet not found in the context")
 		}
-		// Iterate over the associations.
-		for _, acs := range appCommands.([]interface{}) {
-			// Split the commands and apps.
-			var (
-				command keactrl.Command
-				app     agentcomm.ControlledApp
-			)
-			if state.Scheduled {
-				// If the context has been re-created after scheduling the config
-				// change in the database we use a simplified structure holding the
-				// App information.
-				var commandApp struct {
-					Command keactrl.Command
-					App     config.App
-				}
-				if err := config.DecodeContextData(acs, &commandApp); err != nil {
-					return ctx, err
-				}
-				app = commandApp.App
-				command = commandApp.Command
-			} else {
-				// We didn't schedule the change so we have an original context
-				// with an app represented using dbmodel.App structure.
-				var commandApp struct {
-					Command keactrl.Command
-					App     dbmodel.App
-				}
-				if err := config.DecodeContextData(acs, &commandApp); err != nil {
-					return ctx, err
-				}
-				app = commandApp.App
-				command = commandApp.Command
-			}
-			// Send the command to Kea.
-			var response keactrl.ResponseList
-			result, err := module.manager.GetConnectedAgents().ForwardToKeaOverHTTP(context.Background(), app, []keactrl.SerializableCommand{command}, &response)
-			// There was no error in communication between the server and the agent but
-			// the agent could have issues with the Kea response.
-			if err == nil {
-				// Let's check if the agent found errors in communication with Kea.
-				// If not, the individual Kea instances could return error codes as
-				// a result of processing the commands.
-				if err = result.GetFirstError(); err == nil {
-					for _, r := range response {
-						// Let's check if the individual Kea servers returned error
-						// codes for the processed commands.
-						if err = keactrl.GetResponseError(r); err != nil {
-							break
-						}
-					}
-				}
-			}
+		var subnet dbmodel.Subnet
+		if err := config.DecodeContextData(subnetIface, &subnet); err != nil {
+			return ctx, err
+		}
+		if err := commitToDB(&subnet); err != nil {
+			return ctx, err
+		}
+		// Store the committed subnet. The new subnet has been assigned
+		// an ID in the database.
+		if ctx, err = config.SetValueForUpdate(ctx, i, "subnet", subnet); err != nil {
+			return ctx, err
+		}
+		module.beginConfigReviews(update.DaemonIDs)
+	}
+	return ctx, nil
+}
+
+// Holds a collection of unique daemons in the order in which they were added.
+// It is used to generate the commands for the daemons in a predictable order.
+type orderedDaemons struct {
+	daemons []*dbmodel.Daemon
+	index   map[int64]*dbmodel.Daemon
+}
+
+// Creates new empty collection of daemons.
+func newOrderedDaemons() *orderedDaemons {
+	return &orderedDaemons{
+		index: make(map[int64]*dbmodel.Daemon),
+	}
+}
+
+// Adds the daemon to the collection unless it already exists.
+func (od *orderedDaemons) add(daemon *dbmodel.Daemon) {
+	if _, ok := od.index[daemon.ID]; ok {
+		return
+	}
+	od.daemons = append(od.daemons, daemon)
+	od.index[daemon.ID] = daemon
+}
+
+// Returns the daemon having the specified ID or nil if it doesn't exist.
+func (od *orderedDaemons) get(daemonID int64) *dbmodel.Daemon {
+	return od.index[daemonID]
+}
+
+// Returns the IDs of the daemons in the collection.
+func (od *orderedDaemons) getIDs() (daemonIDs []int64) {
+	for _, daemon := range od.daemons {
+		daemonIDs = append(daemonIDs, daemon.ID)
+	}
+	return
+}
+
+// Creates a command managing a shared network (e.g., network4-add,
+// network6-subnet-del) for the specified daemon and associates it with
+// an app receiving this command. The operation is a suffix of the command
+// name following the network4 or network6 prefix.
+func newSharedNetworkCommand(daemon *dbmodel.Daemon, operation string, arguments any) (map[string]any, error) {
+	if daemon.App == nil {
+		return nil, pkgerrors.Errorf("daemon %d is associated with nil app", daemon.ID)
+	}
+	var prefix string
+	switch daemon.Name {
+	case dhcp4:
+		prefix = "network4"
+	case dhcp6:
+		prefix = "network6"
+	default:
+		return nil, pkgerrors.Errorf("daemon %s does not support shared networks", daemon.Name)
+	}
+	appCommand := make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand(fmt.Sprintf("%s-%s", prefix, operation), []string{daemon.Name}, arguments)
+	appCommand["app"] = daemon.App
+	return appCommand, nil
+}
+
+// Creates a network4-add or network6-add command for the specified daemon.
+// The existing parameter holds the shared network from the daemon's
+// configuration. It is nil when the shared network is created in the daemon
+// from scratch.
+func newSharedNetworkAddCommand(daemon *dbmodel.Daemon, name string, parameters map[string]any, existing map[string]any) (map[string]any, error) {
+	arguments := map[string]any{
+		"shared-networks": []any{
+			keaconfig.CreateSubnetCmdsSharedNetwork(name, parameters, existing),
+		},
+	}
+	return newSharedNetworkCommand(daemon, "add", arguments)
+}
+
+// Creates a network4-del or network6-del command for the specified daemon.
+// The subnets belonging to the shared network are not deleted. They become
+// global subnets.
+func newSharedNetworkDeleteCommand(daemon *dbmodel.Daemon, name string) (map[string]any, error) {
+	arguments := &keaconfig.SubnetCmdsDeletedSharedNetwork{
+		Name:          name,
+		SubnetsAction: "keep",
+	}
+	return newSharedNetworkCommand(daemon, "del", arguments)
+}
+
+// Creates a network4-subnet-add or network6-subnet-add command adding the
+// subnet to the shared network in the specified daemon. If the operation
+// is "subnet-del", the command removes the subnet from the shared network.
+func newSharedNetworkSubnetCommand(ls *dbmodel.LocalSubnet, name, operation string) (map[string]any, error) {
+	if ls.LocalSubnetID == 0 {
+		return nil, pkgerrors.Errorf("unable to move subnet %d with unknown ID in daemon %d", ls.SubnetID, ls.DaemonID)
+	}
+	arguments := &keaconfig.SubnetCmdsSharedNetworkSubnet{
+		Name: name,
+		ID:   ls.LocalSubnetID,
+	}
+	return newSharedNetworkCommand(ls.Daemon, operation, arguments)
+}
+
+// Creates the commands moving the subnet into the shared network having the
+// specified name. If the subnet belongs to another shared network, it is
+// first removed from this network.
+func newSharedNetworkMoveSubnetCommands(subnet *dbmodel.Subnet, name string) (commands []any, err error) {
+	var previousName string
+	if subnet.SharedNetworkID != 0 {
+		if subnet.SharedNetwork == nil {
+			return nil, pkgerrors.Errorf("subnet %s lacks the shared network information", subnet.Prefix)
+		}
+		previousName = subnet.SharedNetwork.Name
+	}
+	for _, ls := range subnet.LocalSubnets {
+		if _, err = validateLocalSubnet(subnet, ls); err != nil {
+			return nil, err
+		}
+		if len(previousName) > 0 {
+			appCommand, err := newSharedNetworkSubnetCommand(ls, previousName, "subnet-del")
 			if err != nil {
-				err = pkgerrors.WithMessagef(err, "%s command to %s failed", command.GetCommand(), app.GetName())
-				return ctx, err
+				return nil, err
 			}
+			commands = append(commands, appCommand)
+		}
+		appCommand, err := newSharedNetworkSubnetCommand(ls, name, "subnet-add")
+		if err != nil {
+			return nil, err
 		}
+		commands = append(commands, appCommand)
 	}
-	return ctx, nil
+	return commands, nil
+}
+
+// Creates network4-del or network6-del commands deleting the shared networks
+// which no longer contain any subnets in a daemon after the specified subnets
+// are moved into the shared network having the specified ID. The shared
+// networks left without subnets are deleted from the database upon commit,
+// so they must also be deleted from the daemons. The subnets must include
+// the shared networks they currently belong to, along with the subnets of
+// these shared networks. Otherwise, the shared networks are not deleted.
+func newEmptiedSharedNetworkDeleteCommands(subnets []dbmodel.Subnet, networkID int64) (commands []any, err error) {
+	moved := make(map[int64]bool)
+	var previousNetworks []*dbmodel.SharedNetwork
+	for _, subnet := range subnets {
+		if subnet.SharedNetworkID == 0 || subnet.SharedNetworkID == networkID {
+			continue
+		}
+		moved[subnet.ID] = true
+		if subnet.SharedNetwork == nil {
+			continue
+		}
+		present := false
+		for _, network := range previousNetworks {
+			if network.ID == subnet.SharedNetworkID {
+				present = true
+				break
+			}
+		}
+		if !present {
+			previousNetworks = append(previousNetworks, subnet.SharedNetwork)
+		}
+	}
+	for _, network := range previousNetworks {
+		// Find the daemons still having some subnets in the shared network.
+		daemons := newOrderedDaemons()
+		remaining := make(map[int64]bool)
+		for _, subnet := range network.Subnets {
+			for _, ls := range subnet.LocalSubnets {
+				if ls.Daemon == nil {
+					continue
+				}
+				daemons.add(ls.Daemon)
+				if !moved[subnet.ID] {
+					remaining[ls.DaemonID] = true
+				}
+			}
+		}
+		for _, daemon := range daemons.daemons {
+			if remaining[daemon.ID] {
+				continue
+			}
+			appCommand, err := newSharedNetworkDeleteCommand(daemon, network.Name)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, appCommand)
+		}
+	}
+	return commands, nil
+}
+
+// Validates the shared network before creating the commands. It checks that
+// the shared network has a name and all its subnets belong to the same
+// family. If the family of the shared network is not set, it is set to the
+// family of the subnets.
+func validateSharedNetwork(network *dbmodel.SharedNetwork) error {
+	if len(network.Name) == 0 {
+		return pkgerrors.New("shared network name must not be empty")
+	}
+	for _, subnet := range network.Subnets {
+		if network.Family == 0 {
+			network.Family = subnet.GetFamily()
+		}
+		if subnet.GetFamily() != network.Family {
+			return pkgerrors.Errorf("subnet %s cannot be added to the IPv%d shared network %s",
+				subnet.Prefix, network.Family, network.Name)
+		}
+	}
+	return nil
+}
+
+// Creates a copy of the shared network including only the information
+// required to commit the shared network into the database. The subnets
+// merely contain their IDs.
+func newSharedNetworkForCommit(network *dbmodel.SharedNetwork) dbmodel.SharedNetwork {
+	networkForCommit := dbmodel.SharedNetwork{
+		ID:     network.ID,
+		Name:   network.Name,
+		Family: network.Family,
+	}
+	for _, s := range network.Subnets {
+		networkForCommit.Subnets = append(networkForCommit.Subnets, dbmodel.Subnet{
+			ID: s.ID,
+		})
+	}
+	return networkForCommit
+}
+
+// Begins adding a new shared network. It initializes transaction state.
+func (module *ConfigModule) BeginSharedNetworkAdd(ctx context.Context) (context.Context, error) {
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "shared_network_add")
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies new shared network. The subnets listed in the shared network are
+// moved into it. They must already exist and they must be populated with
+// the daemons. The shared network is created in all daemons having these
+// subnets. The parameters hold the Kea parameters of the shared network
+// (e.g., interface, relay). It locks the configurations of the daemons and
+// prepares necessary commands to be sent to Kea upon commit.
+func (module *ConfigModule) ApplySharedNetworkAdd(ctx context.Context, network *dbmodel.SharedNetwork, parameters map[string]any) (context.Context, error) {
+	if len(network.Subnets) == 0 {
+		return ctx, pkgerrors.Errorf("shared network %s must contain at least one subnet", network.Name)
+	}
+	if err := validateSharedNetwork(network); err != nil {
+		return ctx, err
+	}
+	// Find the daemons which should receive the shared network.
+	daemons := newOrderedDaemons()
+	for i := range network.Subnets {
+		for _, ls := range network.Subnets[i].LocalSubnets {
+			if _, err := validateLocalSubnet(&network.Subnets[i], ls); err != nil {
+				return ctx, err
+			}
+			daemons.add(ls.Daemon)
+		}
+	}
+	// Create the shared network first. Then, move the subnets into it.
+	var commands []any
+	for _, daemon := range daemons.daemons {
+		appCommand, err := newSharedNetworkAddCommand(daemon, network.Name, parameters, nil)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommand)
+	}
+	for i := range network.Subnets {
+		appCommands, err := newSharedNetworkMoveSubnetCommands(&network.Subnets[i], network.Name)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommands...)
+	}
+	// Delete the shared networks left without subnets.
+	appCommands, err := newEmptiedSharedNetworkDeleteCommands(network.Subnets, 0)
+	if err != nil {
+		return ctx, err
+	}
+	commands = append(commands, appCommands...)
+	// Try to lock configurations.
+	daemonIDs := daemons.getIDs()
+	ctx, err = module.manager.Lock(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "shared_network_add", daemonIDs...)
+	if err := state.SetValueForUpdate(0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	if err := state.SetValueForUpdate(0, "shared_network", newSharedNetworkForCommit(network)); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Creates the shared network in the Kea servers and in the database.
+func (module *ConfigModule) commitSharedNetworkAdd(ctx context.Context) (context.Context, error) {
+	return module.commitSharedNetworkChanges(ctx, func(network *dbmodel.SharedNetwork) error {
+		return dbmodel.AddSharedNetworkWithExistingSubnets(module.manager.GetDB(), network)
+	})
+}
+
+// Begins a shared network update. It fetches the specified shared network
+// with its subnets from the database and stores it in the context state.
+// Then, it locks the daemons associated with the shared network for updates.
+func (module *ConfigModule) BeginSharedNetworkUpdate(ctx context.Context, sharedNetworkID int64) (context.Context, error) {
+	// Try to get the shared network to be updated from the database.
+	network, err := dbmodel.GetSharedNetworkWithSubnets(module.manager.GetDB(), sharedNetworkID)
+	if err != nil {
+		// Internal database error.
+		return ctx, err
+	}
+	// Shared network does not exist.
+	if network == nil {
+		return ctx, pkgerrors.WithStack(config.NewSharedNetworkNotFoundError(sharedNetworkID))
+	}
+	// Get the list of daemons for whose configurations must be locked for
+	// updates.
+	daemons := newOrderedDaemons()
+	for _, subnet := range network.Subnets {
+		for _, ls := range subnet.LocalSubnets {
+			if ls.Daemon != nil {
+				daemons.add(ls.Daemon)
+			}
+		}
+	}
+	daemonIDs := daemons.getIDs()
+	// Try to lock configurations.
+	ctx, err = module.manager.Lock(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "shared_network_update", daemonIDs...)
+	if err := state.SetValueForUpdate(0, "shared_network_before_update", *network); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies updated shared network. The subnets listed in the shared network
+// are the subnets which should belong to the shared network after the update.
+// They must be populated with the daemons. The remaining subnets are removed
+// from the shared network and become global subnets. The parameters hold the
+// Kea parameters to be modified in the shared network. The parameters having
+// nil values are removed from the shared network. The parameters not
+// specified are inherited from the daemons' configurations.
+//
+// Kea does not provide commands to modify a shared network. Thus, a renamed
+// shared network or the shared network with modified parameters is first
+// deleted from the daemons, keeping its subnets as global subnets, and then
+// re-created. Its subnets are moved back into the re-created shared network.
+// The shared network is deleted from the daemons having no subnets belonging
+// to this network after the update.
+func (module *ConfigModule) ApplySharedNetworkUpdate(ctx context.Context, network *dbmodel.SharedNetwork, parameters map[string]any) (context.Context, error) {
+	// Retrieve existing shared network from the context.
+	existingNetworkIface, err := config.GetValueForUpdate(ctx, 0, "shared_network_before_update")
+	if err != nil {
+		return ctx, err
+	}
+	existingNetwork := existingNetworkIface.(dbmodel.SharedNetwork)
+	network.ID = existingNetwork.ID
+	if network.Family == 0 {
+		network.Family = existingNetwork.Family
+	}
+	if err := validateSharedNetwork(network); err != nil {
+		return ctx, err
+	}
+	recreate := network.Name != existingNetwork.Name || len(parameters) > 0
+
+	// Collect the daemons having the shared network before and after the update.
+	existingDaemons := newOrderedDaemons()
+	existingMembers := make(map[int64]bool)
+	for _, subnet := range existingNetwork.Subnets {
+		existingMembers[subnet.ID] = true
+		for _, ls := range subnet.LocalSubnets {
+			if ls.Daemon != nil {
+				existingDaemons.add(ls.Daemon)
+			}
+		}
+	}
+	daemons := newOrderedDaemons()
+	members := make(map[int64]bool)
+	for i, subnet := range network.Subnets {
+		members[subnet.ID] = true
+		for _, ls := range subnet.LocalSubnets {
+			if _, err := validateLocalSubnet(&network.Subnets[i], ls); err != nil {
+				return ctx, err
+			}
+			daemons.add(ls.Daemon)
+		}
+	}
+
+	var commands []any
+	for _, existingDaemon := range existingDaemons.daemons {
+		daemon := daemons.get(existingDaemon.ID)
+		if daemon == nil {
+			// The daemon no longer has any subnets belonging to the shared network.
+			appCommand, err := newSharedNetworkDeleteCommand(existingDaemon, existingNetwork.Name)
+			if err != nil {
+				return ctx, err
+			}
+			commands = append(commands, appCommand)
+			continue
+		}
+		if recreate {
+			// Re-create the shared network inheriting the parameters from the
+			// daemon's configuration.
+			var existing map[string]any
+			if daemon.KeaDaemon != nil && daemon.KeaDaemon.Config != nil {
+				existing, _ = daemon.KeaDaemon.Config.GetSharedNetworkByName(existingNetwork.Name)
+			}
+			appCommand, err := newSharedNetworkDeleteCommand(daemon, existingNetwork.Name)
+			if err != nil {
+				return ctx, err
+			}
+			commands = append(commands, appCommand)
+			appCommand, err = newSharedNetworkAddCommand(daemon, network.Name, parameters, existing)
+			if err != nil {
+				return ctx, err
+			}
+			commands = append(commands, appCommand)
+			// Move the remaining subnets back into the re-created shared network.
+			for _, subnet := range network.Subnets {
+				if !existingMembers[subnet.ID] {
+					continue
+				}
+				for _, ls := range subnet.LocalSubnets {
+					if ls.DaemonID != daemon.ID {
+						continue
+					}
+					appCommand, err := newSharedNetworkSubnetCommand(ls, network.Name, "subnet-add")
+					if err != nil {
+						return ctx, err
+					}
+					commands = append(commands, appCommand)
+				}
+			}
+			continue
+		}
+		// Remove the subnets which no longer belong to the shared network.
+		for _, subnet := range existingNetwork.Subnets {
+			if members[subnet.ID] {
+				continue
+			}
+			for _, ls := range subnet.LocalSubnets {
+				if ls.DaemonID != daemon.ID {
+					continue
+				}
+				appCommand, err := newSharedNetworkSubnetCommand(ls, existingNetwork.Name, "subnet-del")
+				if err != nil {
+					return ctx, err
+				}
+				commands = append(commands, appCommand)
+			}
+		}
+	}
+	// Create the shared network in the daemons which didn't have it.
+	for _, daemon := range daemons.daemons {
+		if existingDaemons.get(daemon.ID) != nil {
+			continue
+		}
+		appCommand, err := newSharedNetworkAddCommand(daemon, network.Name, parameters, nil)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommand)
+	}
+	// Move the new subnets into the shared network.
+	for i, subnet := range network.Subnets {
+		if existingMembers[subnet.ID] {
+			continue
+		}
+		appCommands, err := newSharedNetworkMoveSubnetCommands(&network.Subnets[i], network.Name)
+		if err != nil {
+			return ctx, err
+		}
+		commands = append(commands, appCommands...)
+	}
+	// Delete the shared networks left without subnets.
+	appCommands, err := newEmptiedSharedNetworkDeleteCommands(network.Subnets, network.ID)
+	if err != nil {
+		return ctx, err
+	}
+	commands = append(commands, appCommands...)
+	// Include all daemons affected by the update.
+	for _, daemon := range daemons.daemons {
+		existingDaemons.add(daemon)
+	}
+	// The daemons which receive the shared network for the first time have
+	// not been locked when the transaction began.
+	ctx, err = module.manager.LockMore(ctx, existingDaemons.getIDs()...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	state, _ := config.GetTransactionState(ctx)
+	state.Updates[0].DaemonIDs = existingDaemons.getIDs()
+	if err := state.SetValueForUpdate(0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	if err := state.SetValueForUpdate(0, "shared_network", newSharedNetworkForCommit(network)); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, state)
+	return ctx, nil
+}
+
+// Updates the shared network in the Kea servers and in the database.
+func (module *ConfigModule) commitSharedNetworkUpdate(ctx context.Context) (context.Context, error) {
+	return module.commitSharedNetworkChanges(ctx, func(network *dbmodel.SharedNetwork) error {
+		return dbmodel.UpdateSharedNetworkWithExistingSubnets(module.manager.GetDB(), network)
+	})
+}
+
+// Generic function used to commit shared network changes (i.e., add or
+// update a shared network). It sends the commands to Kea and calls the
+// specified function to store the shared network held in the context in
+// the database. The shared networks which no longer contain any subnets
+// are deleted from the database. Finally, it begins the configuration
+// reviews for the updated daemons.
+func (module *ConfigModule) commitSharedNetworkChanges(ctx context.Context, commitToDB func(*dbmodel.SharedNetwork) error) (context.Context, error) {
+	state, ok := config.GetTransactionState(ctx)
+	if !ok {
+		return ctx, pkgerrors.New("context lacks state")
+	}
+	var err error
+	ctx, err = module.commitChanges(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	for i, update := range state.Updates {
+		networkIface, ok := update.Recipe["shared_network"]
+		if !ok {
+			return ctx, pkgerrors.New("shared network not found in the context")
+		}
+		var network dbmodel.SharedNetwork
+		if err := config.DecodeContextData(networkIface, &network); err != nil {
+			return ctx, err
+		}
+		if err := commitToDB(&network); err != nil {
+			return ctx, err
+		}
+		// Store the committed shared network. The new shared network has
+		// been assigned an ID in the database.
+		if ctx, err = config.SetValueForUpdate(ctx, i, "shared_network", network); err != nil {
+			return ctx, err
+		}
+		if _, err := dbmodel.DeleteEmptySharedNetworks(module.manager.GetDB()); err != nil {
+			return ctx, err
+		}
+		module.beginConfigReviews(update.DaemonIDs)
+	}
+	return ctx, nil
+}
+
+// Begins updating global parameters in the specified daemons. It fetches
+// the daemons with their configurations from the database and stores them
+// in the context state. Then, it locks the daemons for updates.
+func (module *ConfigModule) BeginGlobalParametersUpdate(ctx context.Context, daemonIDs []int64) (context.Context, error) {
+	if len(daemonIDs) == 0 {
+		return ctx, pkgerrors.New("no daemons specified for the global parameters update")
+	}
+	var daemons []dbmodel.Daemon
+	for _, daemonID := range daemonIDs {
+		daemon, err := dbmodel.GetDaemonByID(module.manager.GetDB(), daemonID)
+		if err != nil {
+			// Internal database error.
+			return ctx, err
+		}
+		// Daemon does not exist.
+		if daemon == nil {
+			return ctx, pkgerrors.WithStack(config.NewDaemonNotFoundError(daemonID))
+		}
+		if daemon.Name != dhcp4 && daemon.Name != dhcp6 {
+			return ctx, pkgerrors.Errorf("daemon %d is not a Kea DHCP server", daemonID)
+		}
+		if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+			return ctx, pkgerrors.Errorf("configuration of the daemon %d is not available", daemonID)
+		}
+		daemons = append(daemons, *daemon)
+	}
+	// Try to lock configurations.
+	ctx, err := module.manager.Lock(ctx, daemonIDs...)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "global_parameters_update", daemonIDs...)
+	if err := state.SetValueForUpdate(0, "daemons_before_update", daemons); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies the global parameters update. The parameters hold the global Kea
+// parameters to be modified (e.g., lifetimes, timers, DDNS settings, global
+// option-data). The parameters having nil values are removed from the
+// configurations. The parameters are validated against the daemons'
+// configurations held in the database. The configurations sent to the
+// daemons are created upon commit from the configurations fetched from the
+// daemons with the config-get commands, so the changes made in the daemons
+// after fetching their configurations by Stork are not lost.
+func (module *ConfigModule) ApplyGlobalParametersUpdate(ctx context.Context, parameters map[string]any) (context.Context, error) {
+	if len(parameters) == 0 {
+		return ctx, pkgerrors.New("no global parameters specified for the update")
+	}
+	// Retrieve the daemons from the context.
+	daemonsIface, err := config.GetValueForUpdate(ctx, 0, "daemons_before_update")
+	if err != nil {
+		return ctx, err
+	}
+	daemons := daemonsIface.([]dbmodel.Daemon)
+
+	var configGetCommands []any
+	for _, daemon := range daemons {
+		if daemon.App == nil {
+			return ctx, pkgerrors.Errorf("daemon %d is associated with nil app", daemon.ID)
+		}
+		if _, err := daemon.KeaDaemon.Config.CreateConfigWithGlobalParameters(parameters); err != nil {
+			return ctx, pkgerrors.WithMessagef(err, "problem with updating global parameters of the daemon %d", daemon.ID)
+		}
+		appCommand := make(map[string]any)
+		appCommand["command"] = keactrl.NewCommand("config-get", []string{daemon.Name}, nil)
+		appCommand["app"] = daemon.App
+		configGetCommands = append(configGetCommands, appCommand)
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "parameters", parameters); err != nil {
+		return ctx, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "config_get_commands", configGetCommands); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// Updates the global parameters in the Kea servers. It fetches the current
+// configurations from the daemons with the config-get commands and merges
+// the parameters into them. Next, it sends the config-test commands to all
+// daemons. If any of the daemons rejects the new configuration, the update
+// is aborted and none of the daemons is reconfigured. Otherwise, it sends
+// the config-set and config-write commands.
+func (module *ConfigModule) commitGlobalParametersUpdate(ctx context.Context) (context.Context, error) {
+	state, ok := config.GetTransactionState(ctx)
+	if !ok {
+		return ctx, pkgerrors.New("context lacks state")
+	}
+	for _, update := range state.Updates {
+		var parameters map[string]any
+		if err := config.DecodeContextData(update.Recipe["parameters"], &parameters); err != nil {
+			return ctx, err
+		}
+		acsList, ok := update.Recipe["config_get_commands"].([]any)
+		if !ok {
+			return ctx, pkgerrors.New("Kea config-get commands not found in the context")
+		}
+		var (
+			apps        []agentcomm.ControlledApp
+			daemonNames [][]string
+			configs     []*keaconfig.Map
+		)
+		for _, acs := range acsList {
+			command, app, err := decodeAppCommand(state.Scheduled, acs)
+			if err != nil {
+				return ctx, err
+			}
+			cfg, err := module.getConfig(command, app)
+			if err != nil {
+				return ctx, err
+			}
+			newCfg, err := cfg.CreateConfigWithGlobalParameters(parameters)
+			if err != nil {
+				return ctx, pkgerrors.WithMessagef(err, "problem with updating global parameters in %s", app.GetName())
+			}
+			apps = append(apps, app)
+			daemonNames = append(daemonNames, command.Daemons)
+			configs = append(configs, newCfg)
+		}
+		// Test the new configurations first.
+		for i, app := range apps {
+			command := keactrl.NewCommand("config-test", daemonNames[i], *configs[i])
+			if _, err := module.sendCommand(*command, app); err != nil {
+				return ctx, pkgerrors.WithMessage(err, "new configuration rejected; aborting the global parameters update")
+			}
+		}
+		// Apply the new configurations and persist them.
+		for i, app := range apps {
+			command := keactrl.NewCommand("config-set", daemonNames[i], *configs[i])
+			if _, err := module.sendCommand(*command, app); err != nil {
+				return ctx, err
+			}
+			command = keactrl.NewCommand("config-write", daemonNames[i], nil)
+			if _, err := module.sendCommand(*command, app); err != nil {
+				return ctx, err
+			}
+		}
+		module.beginConfigReviews(update.DaemonIDs)
+	}
+	return ctx, nil
+}
+
+// Begins the rollback of the daemon's configuration to one of its
+// configuration snapshots. It fetches the daemon from the database
+// and stores it in the context state. Then, it locks the daemon for
+// updates.
+func (module *ConfigModule) BeginConfigRollback(ctx context.Context, daemonID int64) (context.Context, error) {
+	daemon, err := dbmodel.GetDaemonByID(module.manager.GetDB(), daemonID)
+	if err != nil {
+		// Internal database error.
+		return ctx, err
+	}
+	// Daemon does not exist.
+	if daemon == nil {
+		return ctx, pkgerrors.WithStack(config.NewDaemonNotFoundError(daemonID))
+	}
+	if daemon.KeaDaemon == nil {
+		return ctx, pkgerrors.Errorf("daemon %d is not a Kea daemon", daemonID)
+	}
+	// Try to lock configurations.
+	ctx, err = module.manager.Lock(ctx, daemonID)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "config_rollback", daemonID)
+	if err := state.SetValueForUpdate(0, "daemon_before_rollback", *daemon); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies the configuration rollback. The snapshot holds the configuration
+// to be restored and it must belong to the daemon for which the rollback
+// has begun. The function prepares the config-test command to be sent to
+// the daemon upon commit before the configuration is restored. If the daemon
+// accepts the configuration, the config-set and config-write commands are
+// sent.
+func (module *ConfigModule) ApplyConfigRollback(ctx context.Context, snapshot *dbmodel.ConfigSnapshot) (context.Context, error) {
+	// Retrieve the daemon from the context.
+	daemonIface, err := config.GetValueForUpdate(ctx, 0, "daemon_before_rollback")
+	if err != nil {
+		return ctx, err
+	}
+	daemon := daemonIface.(dbmodel.Daemon)
+	if daemon.App == nil {
+		return ctx, pkgerrors.Errorf("daemon %d is associated with nil app", daemon.ID)
+	}
+	if snapshot == nil || snapshot.Config == nil || snapshot.Config.Map == nil {
+		return ctx, pkgerrors.Errorf("no configuration specified for the rollback of the daemon %d", daemon.ID)
+	}
+	if snapshot.DaemonID != daemon.ID {
+		return ctx, pkgerrors.Errorf("configuration snapshot %d does not belong to the daemon %d", snapshot.ID, daemon.ID)
+	}
+	cfg := *snapshot.Config.Map
+
+	// Test the configuration first.
+	appCommand := make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand("config-test", []string{daemon.Name}, cfg)
+	appCommand["app"] = daemon.App
+	testCommands := []any{appCommand}
+
+	// Restore the configuration and persist it.
+	appCommand = make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand("config-set", []string{daemon.Name}, cfg)
+	appCommand["app"] = daemon.App
+	commands := []any{appCommand}
+
+	appCommand = make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand("config-write", []string{daemon.Name}, nil)
+	appCommand["app"] = daemon.App
+	commands = append(commands, appCommand)
+
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "snapshot_id", snapshot.ID); err != nil {
+		return ctx, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "test_commands", testCommands); err != nil {
+		return ctx, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "commands", commands); err != nil {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// Restores the daemon's configuration. It sends the config-test command
+// first. If the daemon rejects the configuration, the rollback is aborted.
+// Otherwise, it sends the config-set and config-write commands.
+func (module *ConfigModule) commitConfigRollback(ctx context.Context) (context.Context, error) {
+	return module.commitTestedChanges(ctx, "configuration rollback")
+}
+
+// Begins the migration of the host reservations from the daemon's
+// configuration file into the host database used by the daemon. It
+// fetches the daemon from the database and checks that it uses the
+// host_cmds hooks library and a host database. Then, it locks the daemon
+// for updates.
+func (module *ConfigModule) BeginHostsMigration(ctx context.Context, daemonID int64) (context.Context, error) {
+	daemon, err := dbmodel.GetDaemonByID(module.manager.GetDB(), daemonID)
+	if err != nil {
+		// Internal database error.
+		return ctx, err
+	}
+	// Daemon does not exist.
+	if daemon == nil {
+		return ctx, pkgerrors.WithStack(config.NewDaemonNotFoundError(daemonID))
+	}
+	if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+		return ctx, pkgerrors.Errorf("daemon %d is not a Kea daemon or its configuration is unknown", daemonID)
+	}
+	if daemon.Name != dhcp4 && daemon.Name != dhcp6 {
+		return ctx, pkgerrors.Errorf("daemon %d is not a DHCP daemon", daemonID)
+	}
+	if _, _, ok := daemon.KeaDaemon.Config.GetHooksLibrary("libdhcp_host_cmds"); !ok {
+		return ctx, pkgerrors.Errorf("daemon %d does not use the host_cmds hooks library", daemonID)
+	}
+	if len(daemon.KeaDaemon.Config.GetAllDatabases().Hosts) == 0 {
+		return ctx, pkgerrors.Errorf("daemon %d does not use a host database", daemonID)
+	}
+	// Try to lock configurations.
+	ctx, err = module.manager.Lock(ctx, daemonID)
+	if err != nil {
+		return ctx, pkgerrors.WithStack(config.NewLockError())
+	}
+	// Create transaction state.
+	state := config.NewTransactionStateWithUpdate("kea", "hosts_migration", daemonID)
+	if err := state.SetValueForUpdate(0, "daemon_before_migration", *daemon); err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, *state)
+	return ctx, nil
+}
+
+// Applies the migration of the host reservations from the daemon's
+// configuration file into the host database. It prepares the
+// reservation-add commands for the global and subnet specific host
+// reservations found in the configuration and the reservation-del
+// commands reverting them. The configuration without the reservations
+// is created from the current configuration fetched from the daemon
+// upon commit. The migration is refused when the number of the
+// reservations in the configuration differs from the number of the host
+// reservations from the configuration held in the Stork database. It
+// indicates that the Stork database is outdated and the migration should
+// be retried after the next configuration pull. It returns the number of
+// the migrated host reservations.
+func (module *ConfigModule) ApplyHostsMigration(ctx context.Context) (context.Context, int64, error) {
+	// Retrieve the daemon from the context.
+	daemonIface, err := config.GetValueForUpdate(ctx, 0, "daemon_before_migration")
+	if err != nil {
+		return ctx, 0, err
+	}
+	daemon := daemonIface.(dbmodel.Daemon)
+	if daemon.App == nil {
+		return ctx, 0, pkgerrors.Errorf("daemon %d is associated with nil app", daemon.ID)
+	}
+	lookup := module.manager.GetDHCPOptionDefinitionLookup()
+	reservations, err := detectHostReservationsFromConfig(module.manager.GetDB(), &daemon, lookup)
+	if err != nil {
+		return ctx, 0, err
+	}
+	if len(reservations) == 0 {
+		return ctx, 0, pkgerrors.Errorf("daemon %d has no host reservations in the configuration", daemon.ID)
+	}
+	_, total, err := dbmodel.GetHostsByDaemonID(module.manager.GetDB(), daemon.ID, dbmodel.HostDataSourceConfig)
+	if err != nil {
+		return ctx, 0, err
+	}
+	if total != int64(len(reservations)) {
+		return ctx, 0, pkgerrors.Errorf("daemon %d has %d host reservations in the configuration but %d in the Stork database; the Stork database is not up to date",
+			daemon.ID, len(reservations), total)
+	}
+
+	// The configuration is fetched from the daemon upon commit.
+	appCommand := make(map[string]any)
+	appCommand["command"] = keactrl.NewCommand("config-get", []string{daemon.Name}, nil)
+	appCommand["app"] = daemon.App
+	configGetCommands := []any{appCommand}
+
+	// Add the reservations to the host database. Each reservation-add
+	// command has a corresponding reservation-get command verifying that
+	// the reservation has been added and a reservation-del command sent
+	// when the migration fails.
+	var (
+		commands         []any
+		verifyCommands   []any
+		rollbackCommands []any
+		hostKeys         []string
+	)
+	for i := range reservations {
+		reservation, err := keaconfig.CreateReservation(daemon.ID, lookup, &reservations[i].Host)
+		if err != nil {
+			return ctx, 0, err
+		}
+		ids := reservations[i].Host.GetHostIdentifiers()
+		if len(ids) == 0 {
+			return ctx, 0, pkgerrors.Errorf("host reservation %s in subnet %d lacks a DHCP identifier", reservations[i].Host.Hostname, reservations[i].SubnetID)
+		}
+		arguments := make(map[string]any)
+		arguments["reservation"] = keaconfig.HostCmdsReservation{
+			Reservation: *reservation,
+			SubnetID:    reservations[i].SubnetID,
+		}
+		appCommand = make(map[string]any)
+		appCommand["command"] = keactrl.NewCommand("reservation-add", []string{daemon.Name}, arguments)
+		appCommand["app"] = daemon.App
+		commands = append(commands, appCommand)
+
+		// The reservation-get and reservation-del commands take the same
+		// arguments identifying the reservation.
+		identifier := keaconfig.HostCmdsDeletedReservation{
+			IdentifierType: ids[0].Type,
+			Identifier:     storkutil.BytesToHex(ids[0].Value),
+			SubnetID:       reservations[i].SubnetID,
+		}
+		appCommand = make(map[string]any)
+		appCommand["command"] = keactrl.NewCommand("reservation-get", []string{daemon.Name}, identifier)
+		appCommand["app"] = daemon.App
+		verifyCommands = append(verifyCommands, appCommand)
+
+		appCommand = make(map[string]any)
+		appCommand["command"] = keactrl.NewCommand("reservation-del", []string{daemon.Name}, identifier)
+		appCommand["app"] = daemon.App
+		rollbackCommands = append(rollbackCommands, appCommand)
+
+		hostKeys = append(hostKeys, getMigratedHostKey(&reservations[i].Host))
+	}
+
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "migrated_hosts", int64(len(reservations))); err != nil {
+		return ctx, 0, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "migrated_host_keys", hostKeys); err != nil {
+		return ctx, 0, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "config_get_commands", configGetCommands); err != nil {
+		return ctx, 0, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "commands", commands); err != nil {
+		return ctx, 0, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "verify_commands", verifyCommands); err != nil {
+		return ctx, 0, err
+	}
+	if ctx, err = config.SetValueForUpdate(ctx, 0, "rollback_commands", rollbackCommands); err != nil {
+		return ctx, 0, err
+	}
+	return ctx, int64(len(reservations)), nil
+}
+
+// Returns a key identifying the migrated host reservation. It comprises
+// the sorted DHCP identifiers of the host. The keys are used to check
+// that the same set of the host reservations is held in the daemon's
+// configuration and in the Stork database.
+func getMigratedHostKey(host *dbmodel.Host) string {
+	var ids []string
+	for _, id := range host.GetHostIdentifiers() {
+		ids = append(ids, fmt.Sprintf("%s=%s", id.Type, storkutil.BytesToHex(id.Value)))
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// Checks that the keys of the host reservations are the same as the keys
+// of the migrated host reservations, regardless of their order.
+func hasSameMigratedHostKeys(migratedKeys []string, hosts []dbmodel.Host) bool {
+	if len(migratedKeys) != len(hosts) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, key := range migratedKeys {
+		counts[key]++
+	}
+	for i := range hosts {
+		key := getMigratedHostKey(&hosts[i])
+		if counts[key] == 0 {
+			return false
+		}
+		counts[key]--
+	}
+	return true
+}
+
+// Migrates the host reservations into the host database. It fetches the
+// current configuration from the daemon and checks that it holds the
+// migrated host reservations. It sends the config-test command with the
+// configuration without the reservations. If the daemon rejects it, the
+// migration is aborted. Otherwise, it sends the reservation-add commands.
+// If any of them fails, the reservations added so far are deleted from
+// the host database. Next, it checks that the migrated reservations match
+// the host reservations from the configuration held in the Stork database.
+// Finally, it sends the config-set and config-write commands removing the
+// reservations from the configuration.
+func (module *ConfigModule) commitHostsMigration(ctx context.Context) (context.Context, error) {
+	state, ok := config.GetTransactionState(ctx)
+	if !ok {
+		return ctx, pkgerrors.New("context lacks state")
+	}
+	for _, update := range state.Updates {
+		if len(update.DaemonIDs) == 0 {
+			return ctx, pkgerrors.New("daemon not found in the context")
+		}
+		daemonID := update.DaemonIDs[0]
+		var migratedKeys []string
+		if err := config.DecodeContextData(update.Recipe["migrated_host_keys"], &migratedKeys); err != nil {
+			return ctx, err
+		}
+		acsList, ok := update.Recipe["config_get_commands"].([]any)
+		if !ok || len(acsList) == 0 {
+			return ctx, pkgerrors.New("Kea config-get commands not found in the context")
+		}
+		addList, ok := update.Recipe["commands"].([]any)
+		if !ok {
+			return ctx, pkgerrors.New("Kea commands not found in the context")
+		}
+		verifyList, ok := update.Recipe["verify_commands"].([]any)
+		if !ok || len(verifyList) != len(addList) {
+			return ctx, pkgerrors.New("Kea verify commands not found in the context")
+		}
+		rollbackList, ok := update.Recipe["rollback_commands"].([]any)
+		if !ok || len(rollbackList) != len(addList) {
+			return ctx, pkgerrors.New("Kea rollback commands not found in the context")
+		}
+		command, app, err := decodeAppCommand(state.Scheduled, acsList[0])
+		if err != nil {
+			return ctx, err
+		}
+		cfg, err := module.getConfig(command, app)
+		if err != nil {
+			return ctx, err
+		}
+		// Make sure that the configuration has not changed since the
+		// migration began. Otherwise, some reservations would be removed
+		// from the configuration without being migrated.
+		daemon := &dbmodel.Daemon{
+			ID:   daemonID,
+			Name: command.Daemons[0],
+			KeaDaemon: &dbmodel.KeaDaemon{
+				Config: cfg,
+			},
+		}
+		reservations, err := detectHostReservationsFromConfig(module.manager.GetDB(), daemon, module.manager.GetDHCPOptionDefinitionLookup())
+		if err != nil {
+			return ctx, err
+		}
+		var hosts []dbmodel.Host
+		for _, reservation := range reservations {
+			hosts = append(hosts, reservation.Host)
+		}
+		if !hasSameMigratedHostKeys(migratedKeys, hosts) {
+			return ctx, pkgerrors.Errorf("host reservations in the configuration of %s have changed; aborting the host reservations migration", app.GetName())
+		}
+		newCfg, err := cfg.CreateConfigWithoutReservations()
+		if err != nil {
+			return ctx, err
+		}
+		if _, err = module.sendCommand(*keactrl.NewCommand("config-test", command.Daemons, *newCfg), app); err != nil {
+			return ctx, pkgerrors.WithMessage(err, "new configuration rejected; aborting the host reservations migration")
+		}
+		// Add the reservations to the host database.
+		for i := range addList {
+			addCommand, addApp, err := decodeAppCommand(state.Scheduled, addList[i])
+			if err == nil {
+				_, err = module.sendCommand(addCommand, addApp)
+			}
+			if err != nil {
+				module.rollbackHostsMigration(state.Scheduled, rollbackList[:i])
+				return ctx, pkgerrors.WithMessage(err, "problem with adding host reservations to the host database; aborting the host reservations migration")
+			}
+		}
+		// Make sure that the reservations are in the host database before
+		// removing them from the configuration.
+		for i := range verifyList {
+			if err := module.verifyMigratedHost(state.Scheduled, verifyList[i]); err != nil {
+				module.rollbackHostsMigration(state.Scheduled, rollbackList)
+				return ctx, pkgerrors.WithMessage(err, "aborting the host reservations migration")
+			}
+		}
+		// Remove the reservations from the configuration and persist it.
+		if _, err = module.sendCommand(*keactrl.NewCommand("config-set", command.Daemons, *newCfg), app); err != nil {
+			module.rollbackHostsMigration(state.Scheduled, rollbackList)
+			return ctx, pkgerrors.WithMessage(err, "aborting the host reservations migration")
+		}
+		if _, err = module.sendCommand(*keactrl.NewCommand("config-write", command.Daemons, nil), app); err != nil {
+			// Restore the reservations in the configuration before deleting
+			// them from the host database, so they are not lost.
+			if _, restoreErr := module.sendCommand(*keactrl.NewCommand("config-set", command.Daemons, *cfg), app); restoreErr != nil {
+				log.WithError(restoreErr).Error("Problem with restoring the configuration after the failed host reservations migration")
+			}
+			module.rollbackHostsMigration(state.Scheduled, rollbackList)
+			return ctx, pkgerrors.WithMessage(err, "aborting the host reservations migration")
+		}
+	}
+	return ctx, nil
+}
+
+// Sends the reservation-get command to check that the migrated host
+// reservation is in the host database. It returns an error when the
+// reservation is not found.
+func (module *ConfigModule) verifyMigratedHost(scheduled bool, acs any) error {
+	command, app, err := decodeAppCommand(scheduled, acs)
+	if err != nil {
+		return err
+	}
+	response, err := module.sendCommand(command, app)
+	if err != nil {
+		return err
+	}
+	if len(response) == 0 || response[0].Result == keactrl.ResponseEmpty {
+		return pkgerrors.Errorf("migrated host reservation %+v not found in the host database of %s",
+			command.Arguments, app.GetName())
+	}
+	return nil
+}
+
+// Deletes the host reservations added to the host database during the
+// failed migration. The errors are logged because the migration has
+// already failed and the remaining reservations should be deleted anyway.
+func (module *ConfigModule) rollbackHostsMigration(scheduled bool, rollbackCommands []any) {
+	for _, acs := range rollbackCommands {
+		command, app, err := decodeAppCommand(scheduled, acs)
+		if err == nil {
+			_, err = module.sendCommand(command, app)
+		}
+		if err != nil {
+			log.WithError(err).Error("Problem with deleting a migrated host reservation from the host database")
+		}
+	}
+}
+
+// Generic function used to commit configuration changes replacing entire
+// daemons' configurations. It sends the config-test commands stored in the
+// context to all daemons first. If any of the daemons rejects its new
+// configuration, the operation is aborted and none of the daemons is
+// reconfigured. Otherwise, it sends the commands committing the changes
+// and begins the configuration reviews for the reconfigured daemons. The
+// operation name is used in the error message.
+func (module *ConfigModule) commitTestedChanges(ctx context.Context, operation string) (context.Context, error) {
+	state, ok := config.GetTransactionState(ctx)
+	if !ok {
+		return ctx, pkgerrors.New("context lacks state")
+	}
+	for _, update := range state.Updates {
+		testCommands, ok := update.Recipe["test_commands"]
+		if !ok {
+			return ctx, pkgerrors.New("Kea config-test commands not found in the context")
+		}
+		if err := module.sendCommands(state.Scheduled, testCommands); err != nil {
+			return ctx, pkgerrors.WithMessagef(err, "new configuration rejected; aborting the %s", operation)
+		}
+	}
+	ctx, err := module.commitChanges(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	for _, update := range state.Updates {
+		module.beginConfigReviews(update.DaemonIDs)
+	}
+	return ctx, nil
+}
+
+// Begins configuration reviews for the daemons whose configurations have
+// been modified. The reviews are not started when the review dispatcher
+// is unavailable.
+func (module *ConfigModule) beginConfigReviews(daemonIDs []int64) {
+	dispatcher := module.manager.GetReviewDispatcher()
+	if dispatcher == nil {
+		return
+	}
+	for _, daemonID := range daemonIDs {
+		daemon, err := dbmodel.GetDaemonByID(module.manager.GetDB(), daemonID)
+		if err != nil {
+			log.WithError(err).Warnf("Problem with getting daemon %d to begin its configuration review", daemonID)
+			continue
+		}
+		if daemon == nil {
+			continue
+		}
+		_ = dispatcher.BeginReview(daemon, configreview.ConfigModified, nil)
+	}
+}
+
+// Generic function used to commit configuration changes (e.g., delete, add or
+// update host reservation or subnet) using the data stored in the context.
+func (module *ConfigModule) commitChanges(ctx context.Context) (context.Context, error) {
+	state, ok := config.GetTransactionState(ctx)
+	if !ok {
+		return ctx, pkgerrors.New("context lacks state")
+	}
+	for _, update := range state.Updates {
+		// Retrieve associations between the commands and apps.
+		appCommands, ok := update.Recipe["commands"]
+		if !ok {
+			return ctx, pkgerrors.New("Kea commands not found in the context")
+		}
+		if err := module.sendCommands(state.Scheduled, appCommands); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+// Sends the commands to the apps associated with them. The appCommands
+// holds a list of associations between the commands and apps stored in
+// the transaction state. The scheduled flag indicates whether the state
+// has been re-created after scheduling the config change in the database.
+// It returns an error when sending any of the commands fails or Kea
+// returns an error in response to any of the commands. The commands
+// following the failed command are not sent.
+func (module *ConfigModule) sendCommands(scheduled bool, appCommands any) error {
+	acsList, ok := appCommands.([]interface{})
+	if !ok {
+		return pkgerrors.New("Kea commands in the context have invalid type")
+	}
+	// Iterate over the associations.
+	for _, acs := range acsList {
+		command, app, err := decodeAppCommand(scheduled, acs)
+		if err != nil {
+			return err
+		}
+		if _, err = module.sendCommand(command, app); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Splits the association between the command and app stored in the
+// transaction state into the command and app. The scheduled flag indicates
+// whether the state has been re-created after scheduling the config change
+// in the database.
+func decodeAppCommand(scheduled bool, acs any) (command keactrl.Command, app agentcomm.ControlledApp, err error) {
+	if scheduled {
+		// If the context has been re-created after scheduling the config
+		// change in the database we use a simplified structure holding the
+		// App information.
+		var commandApp struct {
+			Command keactrl.Command
+			App     config.App
+		}
+		if err = config.DecodeContextData(acs, &commandApp); err != nil {
+			return
+		}
+		return commandApp.Command, commandApp.App, nil
+	}
+	// We didn't schedule the change so we have an original context
+	// with an app represented using dbmodel.App structure.
+	var commandApp struct {
+		Command keactrl.Command
+		App     dbmodel.App
+	}
+	if err = config.DecodeContextData(acs, &commandApp); err != nil {
+		return
+	}
+	return commandApp.Command, commandApp.App, nil
+}
+
+// Sends the command to the app and returns the Kea response. It returns an
+// error when sending the command fails or Kea returns an error in response
+// to the command.
+func (module *ConfigModule) sendCommand(command keactrl.Command, app agentcomm.ControlledApp) (keactrl.ResponseList, error) {
+	var response keactrl.ResponseList
+	result, err := module.manager.GetConnectedAgents().ForwardToKeaOverHTTP(context.Background(), app, []keactrl.SerializableCommand{command}, &response)
+	// There was no error in communication between the server and the agent but
+	// the agent could have issues with the Kea response.
+	if err == nil {
+		// Let's check if the agent found errors in communication with Kea.
+		// If not, the individual Kea instances could return error codes as
+		// a result of processing the commands.
+		if err = result.GetFirstError(); err == nil {
+			for _, r := range response {
+				// Let's check if the individual Kea servers returned error
+				// codes for the processed commands.
+				if err = keactrl.GetResponseError(r); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil {
+		return nil, pkgerrors.WithMessagef(err, "%s command to %s failed", command.GetCommand(), app.GetName())
+	}
+	return response, nil
+}
+
+// Sends the config-get command to the app and returns the current
+// configuration of the daemon.
+func (module *ConfigModule) getConfig(command keactrl.Command, app agentcomm.ControlledApp) (*dbmodel.KeaConfig, error) {
+	response, err := module.sendCommand(command, app)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) == 0 || response[0].Arguments == nil {
+		return nil, pkgerrors.Errorf("%s command to %s returned no configuration", command.GetCommand(), app.GetName())
+	}
+	return dbmodel.NewKeaConfig(response[0].Arguments), nil
 }
@@ -2,6 +2,7 @@ package kea
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	agentcommtest "isc.org/stork/server/agentcomm/test"
 	appstest "isc.org/stork/server/apps/test"
 	"isc.org/stork/server/config"
+	"isc.org/stork/server/configreview"
 	dbmodel "isc.org/stork/server/database/model"
 	dbtest "isc.org/stork/server/database/test"
 	storktestdbmodel "isc.org/stork/server/test/dbmodel"
@@ -22,9 +24,10 @@ import (
 // Test config manager. Besides returning database and agents instance
 // it also provides additional functions useful in testing.
 type testManager struct {
-	db     *pg.DB
-	agents agentcomm.ConnectedAgents
-	lookup keaconfig.DHCPOptionDefinitionLookup
+	db               *pg.DB
+	agents           agentcomm.ConnectedAgents
+	lookup           keaconfig.DHCPOptionDefinitionLookup
+	reviewDispatcher configreview.Dispatcher
 
 	locks map[int64]bool
 }
@@ -32,9 +35,10 @@ type testManager struct {
 // Creates new test config manager instance.
 func newTestManager(server config.ManagerAccessors) *testManager {
 	return &testManager{
-		db:     server.GetDB(),
-		agents: server.GetConnectedAgents(),
-		locks:  make(map[int64]bool),
+		db:               server.GetDB(),
+		agents:           server.GetConnectedAgents(),
+		reviewDispatcher: server.GetReviewDispatcher(),
+		locks:            make(map[int64]bool),
 	}
 }
 
@@ -54,6 +58,11 @@ func (tm *testManager) GetDHCPOptionDefinitionLookup() keaconfig.DHCPOptionDefin
 	return tm.lookup
 }
 
+// Returns an interface to the review dispatcher.
+func (tm *testManager) GetReviewDispatcher() configreview.Dispatcher {
+	return tm.reviewDispatcher
+}
+
 // Applies locks on specified daemons.
 func (tm *testManager) Lock(ctx context.Context, daemonIDs ...int64) (context.Context, error) {
 	for _, id := range daemonIDs {
@@ -62,6 +71,11 @@ func (tm *testManager) Lock(ctx context.Context, daemonIDs ...int64) (context.Co
 	return ctx, nil
 }
 
+// Applies locks on additional daemons.
+func (tm *testManager) LockMore(ctx context.Context, daemonIDs ...int64) (context.Context, error) {
+	return tm.Lock(ctx, daemonIDs...)
+}
+
 // Removes all locks.
 func (tm *testManager) Unlock(ctx context.Context) {
 	tm.locks = make(map[int64]bool)
@@ -259,6 +273,89 @@ func TestApplyHostAdd(t *testing.T) {
 	require.Equal(t, app, host.LocalHosts[1].Daemon.App)
 }
 
+// Test that the commands are prepared for a batch of new hosts.
+func TestApplyHostsAdd(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DefLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := config.NewTransactionStateWithUpdate("kea", "host_add")
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	daemon := &dbmodel.Daemon{
+		Name: "dhcp4",
+		App: &dbmodel.App{
+			AccessPoints: []*dbmodel.AccessPoint{
+				{
+					Type:    dbmodel.AccessPointControl,
+					Address: "192.0.2.1",
+					Port:    1234,
+				},
+			},
+		},
+	}
+	var hosts []*dbmodel.Host
+	for i := 1; i <= 3; i++ {
+		hosts = append(hosts, &dbmodel.Host{
+			ID:       int64(i),
+			Hostname: fmt.Sprintf("host%d.example.org", i),
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{1, 2, 3, 4, 5, byte(i)},
+				},
+			},
+			LocalHosts: []dbmodel.LocalHost{
+				{
+					DaemonID: 1,
+					Daemon:   daemon,
+				},
+			},
+		})
+	}
+	ctx, err := module.ApplyHostsAdd(ctx, hosts)
+	require.NoError(t, err)
+
+	returnedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, returnedState.Updates, 1)
+	update := returnedState.Updates[0]
+	require.Equal(t, "host_add", update.Operation)
+	require.Contains(t, update.Recipe, "commands")
+
+	// There should be one command per host, in the order of the hosts.
+	commands := update.Recipe["commands"].([]interface{})
+	require.Len(t, commands, 3)
+	for i := range commands {
+		command, ok := commands[i].(map[string]interface{})["command"].(*keactrl.Command)
+		require.True(t, ok)
+		require.JSONEq(t,
+			fmt.Sprintf(`{
+                 "command": "reservation-add",
+                 "service": [ "dhcp4" ],
+                 "arguments": {
+                     "reservation": {
+                         "subnet-id": 0,
+                         "hw-address": "01020304050%d",
+                         "hostname": "host%d.example.org"
+                     }
+                 }
+             }`, i+1, i+1),
+			command.Marshal())
+	}
+
+	// Applying an empty batch is an error.
+	_, err = module.ApplyHostsAdd(ctx, []*dbmodel.Host{})
+	require.Error(t, err)
+
+	// All hosts must be associated with daemons.
+	hosts[1].LocalHosts = nil
+	_, err = module.ApplyHostsAdd(ctx, hosts)
+	require.Error(t, err)
+}
+
 // Test committing added host, i.e. actually sending control commands to Kea.
 func TestCommitHostAdd(t *testing.T) {
 	// Create the config manager instance "connected to" fake agents.
@@ -1327,3 +1424,2480 @@ func TestCommitScheduledHostDelete(t *testing.T) {
 	require.NoError(t, err)
 	require.Nil(t, returnedHost)
 }
+
+// Returns a daemon instance with an app having a control access point
+// with the specified address and port. It is used in the subnet tests.
+func newTestSubnetDaemon(id int64, name, address string, port int64) *dbmodel.Daemon {
+	return &dbmodel.Daemon{
+		ID:   id,
+		Name: name,
+		App: &dbmodel.App{
+			AccessPoints: []*dbmodel.AccessPoint{
+				{
+					Type:    dbmodel.AccessPointControl,
+					Address: address,
+					Port:    port,
+				},
+			},
+		},
+	}
+}
+
+// Test first stage of adding a new subnet.
+func TestBeginSubnetAdd(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSubnetAdd(context.Background())
+	require.NoError(t, err)
+
+	// There should be no locks on any daemons.
+	require.Empty(t, manager.locks)
+
+	// Make sure that the transaction state has been created.
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "kea", state.Updates[0].Target)
+	require.Equal(t, "subnet_add", state.Updates[0].Operation)
+}
+
+// Test second stage of adding a new subnet.
+func TestApplySubnetAdd(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	// Transaction state is required because typically it is created by the
+	// BeginSubnetAdd function.
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_add")
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// Simulate submitting new subnet. The subnet is associated with two
+	// different daemons.
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+		AddressPools: []dbmodel.AddressPool{
+			{
+				LowerBound: "192.0.2.10",
+				UpperBound: "192.0.2.20",
+			},
+		},
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234),
+			},
+			{
+				DaemonID:      2,
+				LocalSubnetID: 234,
+				Daemon:        newTestSubnetDaemon(2, "dhcp4", "192.0.2.2", 2345),
+			},
+		},
+	}
+	ctx, err := module.ApplySubnetAdd(ctx, subnet)
+	require.NoError(t, err)
+
+	// Make sure that the transaction state has been updated and that the
+	// daemons have been locked.
+	updatedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, updatedState.Updates, 1)
+	require.Equal(t, "kea", updatedState.Updates[0].Target)
+	require.Equal(t, "subnet_add", updatedState.Updates[0].Operation)
+	require.ElementsMatch(t, []int64{1, 2}, updatedState.Updates[0].DaemonIDs)
+	require.Contains(t, manager.locks, int64(1))
+	require.Contains(t, manager.locks, int64(2))
+
+	// Make sure that the commands have been prepared.
+	commands, ok := updatedState.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 2)
+
+	for i, c := range commands {
+		command := c.(map[string]any)["command"].(*keactrl.Command)
+		require.JSONEq(t, fmt.Sprintf(`{
+                "command": "subnet4-add",
+                "service": [ "dhcp4" ],
+                "arguments": {
+                    "subnet4": [
+                        {
+                            "id": %d,
+                            "subnet": "192.0.2.0/24",
+                            "pools": [
+                                {
+                                    "pool": "192.0.2.10-192.0.2.20"
+                                }
+                            ]
+                        }
+                    ]
+                }
+            }`, subnet.LocalSubnets[i].LocalSubnetID),
+			command.Marshal())
+		app := c.(map[string]any)["app"].(*dbmodel.App)
+		require.Equal(t, subnet.LocalSubnets[i].Daemon.App, app)
+	}
+
+	// The subnet to be stored in the database should not include daemons.
+	storedSubnet, ok := updatedState.Updates[0].Recipe["subnet"].(dbmodel.Subnet)
+	require.True(t, ok)
+	require.Equal(t, "192.0.2.0/24", storedSubnet.Prefix)
+	require.Len(t, storedSubnet.AddressPools, 1)
+	require.Len(t, storedSubnet.LocalSubnets, 2)
+	require.Nil(t, storedSubnet.LocalSubnets[0].Daemon)
+	require.Nil(t, storedSubnet.LocalSubnets[1].Daemon)
+}
+
+// Test that the subnet cannot be applied when it is not associated with
+// any daemons or the family of the subnet and daemon mismatch.
+func TestApplySubnetAddInvalid(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_add")
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// No daemons.
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	_, err := module.ApplySubnetAdd(ctx, subnet)
+	require.Error(t, err)
+
+	// IPv4 subnet and DHCPv6 server.
+	subnet.LocalSubnets = []*dbmodel.LocalSubnet{
+		{
+			DaemonID: 1,
+			Daemon:   newTestSubnetDaemon(1, "dhcp6", "192.0.2.1", 1234),
+		},
+	}
+	_, err = module.ApplySubnetAdd(ctx, subnet)
+	require.Error(t, err)
+	require.Empty(t, manager.locks)
+}
+
+// Test committing added subnet, i.e. actually sending control commands
+// to Kea and adding the subnet to the database.
+func TestCommitSubnetAdd(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	dispatcher := &storktestdbmodel.FakeDispatcher{}
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:               db,
+		Agents:           agents,
+		DefLookup:        dbmodel.NewDHCPOptionDefinitionLookup(),
+		ReviewDispatcher: dispatcher,
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSubnetAdd(context.Background())
+	require.NoError(t, err)
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.3.0/24",
+		AddressPools: []dbmodel.AddressPool{
+			{
+				LowerBound: "192.0.3.10",
+				UpperBound: "192.0.3.20",
+			},
+		},
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      apps[0].Daemons[0].ID,
+				LocalSubnetID: 123,
+			},
+			{
+				DaemonID:      apps[1].Daemons[0].ID,
+				LocalSubnetID: 123,
+			},
+		},
+	}
+	err = subnet.PopulateDaemons(db)
+	require.NoError(t, err)
+
+	ctx, err = module.ApplySubnetAdd(ctx, subnet)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	// Make sure that the commands were sent to appropriate servers.
+	require.Len(t, agents.RecordedURLs, 2)
+	require.Equal(t, "http://localhost:1234/", agents.RecordedURLs[0])
+	require.Equal(t, "http://localhost:1235/", agents.RecordedURLs[1])
+
+	require.Len(t, agents.RecordedCommands, 2)
+	for _, command := range agents.RecordedCommands {
+		require.Equal(t, "subnet4-add", command.GetCommand())
+	}
+
+	// The subnet should have been added to the database.
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.3.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+	require.Len(t, subnets[0].AddressPools, 1)
+	require.Equal(t, "192.0.3.10", subnets[0].AddressPools[0].LowerBound)
+	require.Equal(t, "192.0.3.20", subnets[0].AddressPools[0].UpperBound)
+	require.Len(t, subnets[0].LocalSubnets, 2)
+	require.EqualValues(t, 123, subnets[0].LocalSubnets[0].LocalSubnetID)
+	require.EqualValues(t, 123, subnets[0].LocalSubnets[1].LocalSubnetID)
+
+	// The config reviews should have been started for both daemons.
+	require.Len(t, dispatcher.CallLog, 2)
+	for _, call := range dispatcher.CallLog {
+		require.Equal(t, "BeginReview", call.CallName)
+		require.Equal(t, configreview.ConfigModified, call.Trigger)
+	}
+}
+
+// Test that scheduled subnet add is correctly recovered from the database
+// and committed.
+func TestCommitScheduledSubnetAdd(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    agents,
+		DefLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	// User is required to associate the config change with a user.
+	user := &dbmodel.SystemUser{
+		Login:    "test",
+		Lastname: "test",
+		Name:     "test",
+		Password: "test",
+	}
+	_, err := dbmodel.CreateUser(db, user)
+	require.NoError(t, err)
+	require.NotZero(t, user.ID)
+
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_add")
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// Set user id in the context.
+	ctx = context.WithValue(ctx, config.UserContextKey, int64(user.ID))
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "2001:db8:2::/64",
+		PrefixPools: []dbmodel.PrefixPool{
+			{
+				Prefix:       "3000::/48",
+				DelegatedLen: 64,
+			},
+		},
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      apps[0].Daemons[1].ID,
+				LocalSubnetID: 321,
+			},
+		},
+	}
+	err = subnet.PopulateDaemons(db)
+	require.NoError(t, err)
+
+	ctx, err = module.ApplySubnetAdd(ctx, subnet)
+	require.NoError(t, err)
+
+	// Simulate scheduling the config change and retrieving it from the database.
+	ctx = manager.scheduleAndGetChange(ctx, t)
+	require.NotNil(t, ctx)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedURLs, 1)
+	require.Equal(t, "http://localhost:1234/", agents.RecordedURLs[0])
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t,
+		`{
+             "command": "subnet6-add",
+             "service": [ "dhcp6" ],
+             "arguments": {
+                 "subnet6": [
+                     {
+                         "id": 321,
+                         "subnet": "2001:db8:2::/64",
+                         "pools": [],
+                         "pd-pools": [
+                             {
+                                 "prefix": "3000::",
+                                 "prefix-len": 48,
+                                 "delegated-len": 64
+                             }
+                         ]
+                     }
+                 ]
+             }
+         }`,
+		agents.RecordedCommands[0].Marshal())
+
+	// The subnet should have been added to the database.
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "2001:db8:2::/64")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+	require.Len(t, subnets[0].PrefixPools, 1)
+	require.Len(t, subnets[0].LocalSubnets, 1)
+	require.EqualValues(t, 321, subnets[0].LocalSubnets[0].LocalSubnetID)
+}
+
+// Test the first stage of updating a subnet. It checks that the subnet
+// information is fetched from the database and stored in the context.
+// It also checks that appropriate locks are applied.
+func TestBeginSubnetUpdate(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	ctx, err := module.BeginSubnetUpdate(context.Background(), subnets[0].ID)
+	require.NoError(t, err)
+
+	// Make sure that the locks have been applied on the daemons owning
+	// the subnet.
+	require.Contains(t, manager.locks, apps[0].Daemons[0].ID)
+	require.Contains(t, manager.locks, apps[1].Daemons[0].ID)
+
+	// Make sure that the subnet information has been stored in the context.
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "kea", state.Updates[0].Target)
+	require.Equal(t, "subnet_update", state.Updates[0].Operation)
+	require.Contains(t, state.Updates[0].Recipe, "subnet_before_update")
+
+	// Non-existing subnet.
+	_, err = module.BeginSubnetUpdate(context.Background(), 1000)
+	var subnetNotFound *config.SubnetNotFoundError
+	require.ErrorAs(t, err, &subnetNotFound)
+}
+
+// Test second stage of a subnet update. The subnet is updated in one
+// daemon, deleted from another one and added to a third one.
+func TestApplySubnetUpdate(t *testing.T) {
+	existingSubnet := dbmodel.Subnet{
+		ID:              1,
+		Prefix:          "192.0.2.0/24",
+		SharedNetworkID: 5,
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234),
+			},
+			{
+				DaemonID:      2,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(2, "dhcp4", "192.0.2.2", 2345),
+			},
+		},
+	}
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	// Transaction state is required because typically it is created by the
+	// BeginSubnetUpdate function.
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_update", 1, 2)
+	err := state.SetValueForUpdate(0, "subnet_before_update", existingSubnet)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// The existing configuration of the first daemon includes the option
+	// data which should be preserved after the update.
+	daemon1 := newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234)
+	daemon1.KeaDaemon = &dbmodel.KeaDaemon{}
+	daemon1.KeaDaemon.Config, err = dbmodel.NewKeaConfigFromJSON(`{
+        "Dhcp4": {
+            "subnet4": [
+                {
+                    "id": 123,
+                    "subnet": "192.0.2.0/24",
+                    "option-data": [
+                        {
+                            "name": "routers",
+                            "data": "192.0.2.1"
+                        }
+                    ]
+                }
+            ]
+        }
+    }`)
+	require.NoError(t, err)
+
+	subnet := &dbmodel.Subnet{
+		ID:          1,
+		Prefix:      "192.0.2.0/24",
+		ClientClass: "foo",
+		AddressPools: []dbmodel.AddressPool{
+			{
+				LowerBound: "192.0.2.10",
+				UpperBound: "192.0.2.30",
+			},
+		},
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+				Daemon:        daemon1,
+			},
+			{
+				DaemonID:      3,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(3, "dhcp4", "192.0.2.3", 3456),
+			},
+		},
+	}
+	ctx, err = module.ApplySubnetUpdate(ctx, subnet)
+	require.NoError(t, err)
+
+	updatedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, updatedState.Updates, 1)
+	require.Equal(t, []int64{2, 1, 3}, updatedState.Updates[0].DaemonIDs)
+
+	// The daemon receiving the subnet for the first time should be locked.
+	require.Contains(t, manager.locks, int64(3))
+
+	commands, ok := updatedState.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 3)
+
+	// The subnet should be deleted from the second daemon.
+	command := commands[0].(map[string]any)["command"].(*keactrl.Command)
+	require.JSONEq(t, `{
+            "command": "subnet4-del",
+            "service": [ "dhcp4" ],
+            "arguments": {
+                "id": 123
+            }
+        }`, command.Marshal())
+
+	// The subnet should be updated in the first daemon. The option data
+	// should be preserved.
+	command = commands[1].(map[string]any)["command"].(*keactrl.Command)
+	require.JSONEq(t, `{
+            "command": "subnet4-update",
+            "service": [ "dhcp4" ],
+            "arguments": {
+                "subnet4": [
+                    {
+                        "id": 123,
+                        "subnet": "192.0.2.0/24",
+                        "client-class": "foo",
+                        "pools": [
+                            {
+                                "pool": "192.0.2.10-192.0.2.30"
+                            }
+                        ],
+                        "option-data": [
+                            {
+                                "name": "routers",
+                                "data": "192.0.2.1"
+                            }
+                        ]
+                    }
+                ]
+            }
+        }`, command.Marshal())
+
+	// The subnet should be added to the third daemon.
+	command = commands[2].(map[string]any)["command"].(*keactrl.Command)
+	require.JSONEq(t, `{
+            "command": "subnet4-add",
+            "service": [ "dhcp4" ],
+            "arguments": {
+                "subnet4": [
+                    {
+                        "id": 123,
+                        "subnet": "192.0.2.0/24",
+                        "client-class": "foo",
+                        "pools": [
+                            {
+                                "pool": "192.0.2.10-192.0.2.30"
+                            }
+                        ]
+                    }
+                ]
+            }
+        }`, command.Marshal())
+
+	// The subnet should remain in the same shared network.
+	storedSubnet, ok := updatedState.Updates[0].Recipe["subnet"].(dbmodel.Subnet)
+	require.True(t, ok)
+	require.EqualValues(t, 5, storedSubnet.SharedNetworkID)
+}
+
+// Test that the subnet update takes the subnet ID from the existing subnet
+// and rejects changing the subnet ID in the daemons having the subnet.
+func TestApplySubnetUpdateExistingIDs(t *testing.T) {
+	existingSubnet := dbmodel.Subnet{
+		ID:     1,
+		Prefix: "192.0.2.0/24",
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234),
+			},
+		},
+	}
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := config.NewTransactionStateWithUpdate("kea", "subnet_update", 1)
+	err := state.SetValueForUpdate(0, "subnet_before_update", existingSubnet)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// The subnet ID specified in the update is ignored.
+	subnet := &dbmodel.Subnet{
+		ID:     2,
+		Prefix: "192.0.2.0/24",
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234),
+			},
+		},
+	}
+	updatedCtx, err := module.ApplySubnetUpdate(ctx, subnet)
+	require.NoError(t, err)
+	updatedState, ok := config.GetTransactionState(updatedCtx)
+	require.True(t, ok)
+	storedSubnet, ok := updatedState.Updates[0].Recipe["subnet"].(dbmodel.Subnet)
+	require.True(t, ok)
+	require.EqualValues(t, 1, storedSubnet.ID)
+
+	// Changing the subnet ID in the daemon having the subnet is not allowed.
+	subnet.LocalSubnets[0].LocalSubnetID = 124
+	_, err = module.ApplySubnetUpdate(ctx, subnet)
+	require.ErrorContains(t, err, "cannot change the ID of subnet 192.0.2.0/24 from 123 to 124")
+}
+
+// Test committing updated subnet, i.e. actually sending control commands
+// to Kea and updating the subnet in the database.
+func TestCommitSubnetUpdate(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	dispatcher := &storktestdbmodel.FakeDispatcher{}
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:               db,
+		Agents:           agents,
+		DefLookup:        dbmodel.NewDHCPOptionDefinitionLookup(),
+		ReviewDispatcher: dispatcher,
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	ctx, err := module.BeginSubnetUpdate(context.Background(), subnets[0].ID)
+	require.NoError(t, err)
+
+	// Remove the subnet from the second daemon and add a pool.
+	subnet := &dbmodel.Subnet{
+		ID:     subnets[0].ID,
+		Prefix: "192.0.2.0/24",
+		AddressPools: []dbmodel.AddressPool{
+			{
+				LowerBound: "192.0.2.50",
+				UpperBound: "192.0.2.60",
+			},
+		},
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      apps[0].Daemons[0].ID,
+				LocalSubnetID: 111,
+			},
+		},
+	}
+	err = subnet.PopulateDaemons(db)
+	require.NoError(t, err)
+
+	ctx, err = module.ApplySubnetUpdate(ctx, subnet)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 2)
+	require.Equal(t, "subnet4-del", agents.RecordedCommands[0].GetCommand())
+	require.Equal(t, "subnet4-update", agents.RecordedCommands[1].GetCommand())
+
+	// Make sure that the subnet has been updated in the database.
+	updatedSubnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, updatedSubnet)
+	require.Len(t, updatedSubnet.AddressPools, 1)
+	require.Equal(t, "192.0.2.50", updatedSubnet.AddressPools[0].LowerBound)
+	require.Len(t, updatedSubnet.LocalSubnets, 1)
+	require.Equal(t, apps[0].Daemons[0].ID, updatedSubnet.LocalSubnets[0].DaemonID)
+
+	// The config reviews should have been started for both daemons.
+	require.Len(t, dispatcher.CallLog, 2)
+}
+
+// Test preparing commands to delete a subnet.
+func TestApplySubnetDelete(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSubnetDelete(context.Background())
+	require.NoError(t, err)
+
+	subnet := &dbmodel.Subnet{
+		ID:     1,
+		Prefix: "2001:db8:1::/64",
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+				Daemon:        newTestSubnetDaemon(1, "dhcp6", "192.0.2.1", 1234),
+			},
+		},
+	}
+	ctx, err = module.ApplySubnetDelete(ctx, subnet)
+	require.NoError(t, err)
+
+	require.Contains(t, manager.locks, int64(1))
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "subnet_delete", state.Updates[0].Operation)
+	require.EqualValues(t, 1, state.Updates[0].Recipe["id"])
+
+	commands, ok := state.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 1)
+	command := commands[0].(map[string]any)["command"].(*keactrl.Command)
+	require.JSONEq(t, `{
+            "command": "subnet6-del",
+            "service": [ "dhcp6" ],
+            "arguments": {
+                "id": 123
+            }
+        }`, command.Marshal())
+}
+
+// Test committing subnet deletion, i.e. actually sending control commands
+// to Kea and deleting the subnet from the database.
+func TestCommitSubnetDelete(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	storktestdbmodel.AddTestHosts(t, db)
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    agents,
+		DefLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "2001:db8:1::/64")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	subnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+
+	ctx, err := module.ApplySubnetDelete(context.Background(), subnet)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 2)
+	for _, command := range agents.RecordedCommands {
+		require.Equal(t, "subnet6-del", command.GetCommand())
+	}
+
+	// The subnet should be gone.
+	subnet, err = dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.Nil(t, subnet)
+}
+
+// Test first stage of adding a new shared network.
+func TestBeginSharedNetworkAdd(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSharedNetworkAdd(context.Background())
+	require.NoError(t, err)
+
+	// There should be no locks on any daemons.
+	require.Empty(t, manager.locks)
+
+	// Make sure that the transaction state has been created.
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "kea", state.Updates[0].Target)
+	require.Equal(t, "shared_network_add", state.Updates[0].Operation)
+}
+
+// Test second stage of adding a new shared network. The network comprises
+// a global subnet and a subnet moved from another shared network.
+func TestApplySharedNetworkAdd(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSharedNetworkAdd(context.Background())
+	require.NoError(t, err)
+
+	daemon1 := newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234)
+	daemon2 := newTestSubnetDaemon(2, "dhcp4", "192.0.2.2", 2345)
+
+	network := &dbmodel.SharedNetwork{
+		Name: "foo",
+		Subnets: []dbmodel.Subnet{
+			{
+				ID:     1,
+				Prefix: "192.0.2.0/24",
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      1,
+						LocalSubnetID: 11,
+						Daemon:        daemon1,
+					},
+				},
+			},
+			{
+				ID:              2,
+				Prefix:          "192.0.3.0/24",
+				SharedNetworkID: 5,
+				SharedNetwork: &dbmodel.SharedNetwork{
+					ID:   5,
+					Name: "bar",
+				},
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      2,
+						LocalSubnetID: 22,
+						Daemon:        daemon2,
+					},
+				},
+			},
+		},
+	}
+	parameters := map[string]any{
+		"interface": "eth0",
+	}
+	ctx, err = module.ApplySharedNetworkAdd(ctx, network, parameters)
+	require.NoError(t, err)
+
+	require.Contains(t, manager.locks, int64(1))
+	require.Contains(t, manager.locks, int64(2))
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "shared_network_add", state.Updates[0].Operation)
+	require.Equal(t, []int64{1, 2}, state.Updates[0].DaemonIDs)
+
+	commands, ok := state.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 5)
+
+	expected := []string{
+		`{"command": "network4-add", "service": ["dhcp4"], "arguments": {"shared-networks": [{"name": "foo", "interface": "eth0"}]}}`,
+		`{"command": "network4-add", "service": ["dhcp4"], "arguments": {"shared-networks": [{"name": "foo", "interface": "eth0"}]}}`,
+		`{"command": "network4-subnet-add", "service": ["dhcp4"], "arguments": {"name": "foo", "id": 11}}`,
+		`{"command": "network4-subnet-del", "service": ["dhcp4"], "arguments": {"name": "bar", "id": 22}}`,
+		`{"command": "network4-subnet-add", "service": ["dhcp4"], "arguments": {"name": "foo", "id": 22}}`,
+	}
+	for i, c := range commands {
+		command := c.(map[string]any)["command"].(*keactrl.Command)
+		require.JSONEq(t, expected[i], command.Marshal())
+	}
+	require.Equal(t, daemon1.App, commands[0].(map[string]any)["app"])
+	require.Equal(t, daemon2.App, commands[1].(map[string]any)["app"])
+
+	// The shared network to be stored in the database should merely contain
+	// subnet IDs.
+	storedNetwork, ok := state.Updates[0].Recipe["shared_network"].(dbmodel.SharedNetwork)
+	require.True(t, ok)
+	require.Equal(t, "foo", storedNetwork.Name)
+	require.EqualValues(t, 4, storedNetwork.Family)
+	require.Len(t, storedNetwork.Subnets, 2)
+	require.EqualValues(t, 1, storedNetwork.Subnets[0].ID)
+	require.Empty(t, storedNetwork.Subnets[0].LocalSubnets)
+	require.EqualValues(t, 2, storedNetwork.Subnets[1].ID)
+}
+
+// Test that the shared networks left without subnets after moving the
+// subnets into a new shared network are deleted from the daemons.
+func TestApplySharedNetworkAddDeleteEmptied(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSharedNetworkAdd(context.Background())
+	require.NoError(t, err)
+
+	daemon1 := newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234)
+	daemon2 := newTestSubnetDaemon(2, "dhcp4", "192.0.2.2", 2345)
+
+	// The shared network bar contains two subnets. The first one is
+	// configured in both daemons. The second one is only configured in
+	// the second daemon.
+	previousNetwork := &dbmodel.SharedNetwork{
+		ID:   5,
+		Name: "bar",
+		Subnets: []dbmodel.Subnet{
+			{
+				ID:              1,
+				Prefix:          "192.0.2.0/24",
+				SharedNetworkID: 5,
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{DaemonID: 1, LocalSubnetID: 11, Daemon: daemon1},
+					{DaemonID: 2, LocalSubnetID: 11, Daemon: daemon2},
+				},
+			},
+			{
+				ID:              2,
+				Prefix:          "192.0.3.0/24",
+				SharedNetworkID: 5,
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{DaemonID: 2, LocalSubnetID: 22, Daemon: daemon2},
+				},
+			},
+		},
+	}
+	// Move the first subnet into the new shared network. The shared network
+	// bar becomes empty in the first daemon.
+	movedSubnet := previousNetwork.Subnets[0]
+	movedSubnet.SharedNetwork = previousNetwork
+	network := &dbmodel.SharedNetwork{
+		Name:    "foo",
+		Subnets: []dbmodel.Subnet{movedSubnet},
+	}
+	ctx, err = module.ApplySharedNetworkAdd(ctx, network, nil)
+	require.NoError(t, err)
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	commands, ok := state.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 7)
+
+	expected := []string{
+		`{"command": "network4-add", "service": ["dhcp4"], "arguments": {"shared-networks": [{"name": "foo"}]}}`,
+		`{"command": "network4-add", "service": ["dhcp4"], "arguments": {"shared-networks": [{"name": "foo"}]}}`,
+		`{"command": "network4-subnet-del", "service": ["dhcp4"], "arguments": {"name": "bar", "id": 11}}`,
+		`{"command": "network4-subnet-add", "service": ["dhcp4"], "arguments": {"name": "foo", "id": 11}}`,
+		`{"command": "network4-subnet-del", "service": ["dhcp4"], "arguments": {"name": "bar", "id": 11}}`,
+		`{"command": "network4-subnet-add", "service": ["dhcp4"], "arguments": {"name": "foo", "id": 11}}`,
+		`{"command": "network4-del", "service": ["dhcp4"], "arguments": {"name": "bar", "subnets-action": "keep"}}`,
+	}
+	for i, c := range commands {
+		command := c.(map[string]any)["command"].(*keactrl.Command)
+		require.JSONEq(t, expected[i], command.Marshal())
+	}
+	require.Equal(t, daemon1.App, commands[6].(map[string]any)["app"])
+}
+
+// Test that the shared network cannot be applied when it has no name,
+// no subnets or the subnets of different families.
+func TestApplySharedNetworkAddInvalid(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginSharedNetworkAdd(context.Background())
+	require.NoError(t, err)
+
+	// No subnets.
+	network := &dbmodel.SharedNetwork{
+		Name: "foo",
+	}
+	_, err = module.ApplySharedNetworkAdd(ctx, network, nil)
+	require.Error(t, err)
+
+	// No name.
+	network = &dbmodel.SharedNetwork{
+		Subnets: []dbmodel.Subnet{
+			{
+				ID:     1,
+				Prefix: "192.0.2.0/24",
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      1,
+						LocalSubnetID: 1,
+						Daemon:        newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234),
+					},
+				},
+			},
+		},
+	}
+	_, err = module.ApplySharedNetworkAdd(ctx, network, nil)
+	require.Error(t, err)
+
+	// Mixed families.
+	network.Name = "foo"
+	network.Subnets = append(network.Subnets, dbmodel.Subnet{
+		ID:     2,
+		Prefix: "2001:db8:1::/64",
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{
+				DaemonID:      2,
+				LocalSubnetID: 2,
+				Daemon:        newTestSubnetDaemon(2, "dhcp6", "192.0.2.1", 1234),
+			},
+		},
+	})
+	_, err = module.ApplySharedNetworkAdd(ctx, network, nil)
+	require.Error(t, err)
+	require.Empty(t, manager.locks)
+}
+
+// Test second stage of updating a shared network when the shared network is
+// renamed. The shared network should be re-created in the daemons and its
+// remaining subnets should be moved back into it.
+func TestApplySharedNetworkUpdateRename(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	daemon1 := newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234)
+	daemon1.KeaDaemon = &dbmodel.KeaDaemon{
+		Config: dbmodel.NewKeaConfig(&map[string]any{
+			"Dhcp4": map[string]any{
+				"shared-networks": []any{
+					map[string]any{
+						"name":           "foo",
+						"valid-lifetime": 3600,
+						"subnet4": []any{
+							map[string]any{
+								"id":     11,
+								"subnet": "192.0.2.0/24",
+							},
+						},
+					},
+				},
+			},
+		}),
+	}
+	daemon2 := newTestSubnetDaemon(2, "dhcp4", "192.0.2.2", 2345)
+
+	// The shared network comprises two subnets. The first subnet belongs to
+	// the first daemon and the second subnet belongs to the second daemon.
+	existingNetwork := dbmodel.SharedNetwork{
+		ID:     5,
+		Name:   "foo",
+		Family: 4,
+		Subnets: []dbmodel.Subnet{
+			{
+				ID:              1,
+				Prefix:          "192.0.2.0/24",
+				SharedNetworkID: 5,
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      1,
+						LocalSubnetID: 11,
+						Daemon:        daemon1,
+					},
+				},
+			},
+			{
+				ID:              2,
+				Prefix:          "192.0.3.0/24",
+				SharedNetworkID: 5,
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      2,
+						LocalSubnetID: 22,
+						Daemon:        daemon2,
+					},
+				},
+			},
+		},
+	}
+	state := config.NewTransactionStateWithUpdate("kea", "shared_network_update", 1, 2)
+	err := state.SetValueForUpdate(0, "shared_network_before_update", existingNetwork)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// Rename the shared network and remove the second subnet from it.
+	network := &dbmodel.SharedNetwork{
+		Name: "bar",
+		Subnets: []dbmodel.Subnet{
+			existingNetwork.Subnets[0],
+		},
+	}
+	ctx, err = module.ApplySharedNetworkUpdate(ctx, network, nil)
+	require.NoError(t, err)
+
+	updatedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Equal(t, []int64{1, 2}, updatedState.Updates[0].DaemonIDs)
+
+	commands, ok := updatedState.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 4)
+
+	// The shared network should inherit the valid-lifetime from the
+	// configuration of the first daemon. It should be deleted from the
+	// second daemon.
+	expected := []string{
+		`{"command": "network4-del", "service": ["dhcp4"], "arguments": {"name": "foo", "subnets-action": "keep"}}`,
+		`{"command": "network4-add", "service": ["dhcp4"], "arguments": {"shared-networks": [{"name": "bar", "valid-lifetime": 3600}]}}`,
+		`{"command": "network4-subnet-add", "service": ["dhcp4"], "arguments": {"name": "bar", "id": 11}}`,
+		`{"command": "network4-del", "service": ["dhcp4"], "arguments": {"name": "foo", "subnets-action": "keep"}}`,
+	}
+	for i, c := range commands {
+		command := c.(map[string]any)["command"].(*keactrl.Command)
+		require.JSONEq(t, expected[i], command.Marshal())
+	}
+	require.Equal(t, daemon2.App, commands[3].(map[string]any)["app"])
+
+	storedNetwork, ok := updatedState.Updates[0].Recipe["shared_network"].(dbmodel.SharedNetwork)
+	require.True(t, ok)
+	require.EqualValues(t, 5, storedNetwork.ID)
+	require.Equal(t, "bar", storedNetwork.Name)
+	require.Len(t, storedNetwork.Subnets, 1)
+	require.EqualValues(t, 1, storedNetwork.Subnets[0].ID)
+}
+
+// Test second stage of updating a shared network when the subnets are
+// moved into and out of the shared network without renaming it.
+func TestApplySharedNetworkUpdateMoveSubnets(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	daemon1 := newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234)
+	daemon2 := newTestSubnetDaemon(2, "dhcp4", "192.0.2.2", 2345)
+
+	existingNetwork := dbmodel.SharedNetwork{
+		ID:     5,
+		Name:   "foo",
+		Family: 4,
+		Subnets: []dbmodel.Subnet{
+			{
+				ID:              1,
+				Prefix:          "192.0.2.0/24",
+				SharedNetworkID: 5,
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      1,
+						LocalSubnetID: 11,
+						Daemon:        daemon1,
+					},
+				},
+			},
+			{
+				ID:              2,
+				Prefix:          "192.0.3.0/24",
+				SharedNetworkID: 5,
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      1,
+						LocalSubnetID: 22,
+						Daemon:        daemon1,
+					},
+				},
+			},
+		},
+	}
+	state := config.NewTransactionStateWithUpdate("kea", "shared_network_update", 1)
+	err := state.SetValueForUpdate(0, "shared_network_before_update", existingNetwork)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	// Remove the second subnet from the shared network and add a subnet
+	// belonging to another shared network in the second daemon.
+	network := &dbmodel.SharedNetwork{
+		Name: "foo",
+		Subnets: []dbmodel.Subnet{
+			existingNetwork.Subnets[0],
+			{
+				ID:              3,
+				Prefix:          "192.0.4.0/24",
+				SharedNetworkID: 6,
+				SharedNetwork: &dbmodel.SharedNetwork{
+					ID:   6,
+					Name: "bar",
+				},
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      2,
+						LocalSubnetID: 33,
+						Daemon:        daemon2,
+					},
+				},
+			},
+		},
+	}
+	ctx, err = module.ApplySharedNetworkUpdate(ctx, network, nil)
+	require.NoError(t, err)
+
+	// The daemon receiving the shared network for the first time should
+	// be locked.
+	require.Contains(t, manager.locks, int64(1))
+	require.Contains(t, manager.locks, int64(2))
+
+	updatedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Equal(t, []int64{1, 2}, updatedState.Updates[0].DaemonIDs)
+
+	commands, ok := updatedState.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 4)
+
+	expected := []string{
+		`{"command": "network4-subnet-del", "service": ["dhcp4"], "arguments": {"name": "foo", "id": 22}}`,
+		`{"command": "network4-add", "service": ["dhcp4"], "arguments": {"shared-networks": [{"name": "foo"}]}}`,
+		`{"command": "network4-subnet-del", "service": ["dhcp4"], "arguments": {"name": "bar", "id": 33}}`,
+		`{"command": "network4-subnet-add", "service": ["dhcp4"], "arguments": {"name": "foo", "id": 33}}`,
+	}
+	for i, c := range commands {
+		command := c.(map[string]any)["command"].(*keactrl.Command)
+		require.JSONEq(t, expected[i], command.Marshal())
+	}
+}
+
+// Test committing added shared network, i.e. actually sending control
+// commands to Kea and adding the shared network to the database.
+func TestCommitSharedNetworkAdd(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	storktestdbmodel.AddTestHosts(t, db)
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	dispatcher := &storktestdbmodel.FakeDispatcher{}
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:               db,
+		Agents:           agents,
+		DefLookup:        dbmodel.NewDHCPOptionDefinitionLookup(),
+		ReviewDispatcher: dispatcher,
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	ctx, err := module.BeginSharedNetworkAdd(context.Background())
+	require.NoError(t, err)
+
+	network := &dbmodel.SharedNetwork{
+		Name: "foo",
+		Subnets: []dbmodel.Subnet{
+			{
+				ID: subnets[0].ID,
+			},
+		},
+	}
+	err = network.PopulateSubnets(db)
+	require.NoError(t, err)
+
+	ctx, err = module.ApplySharedNetworkAdd(ctx, network, nil)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	// The shared network should have been created in both daemons and the
+	// subnet should have been moved into it.
+	require.Len(t, agents.RecordedCommands, 4)
+	require.Equal(t, "network4-add", agents.RecordedCommands[0].GetCommand())
+	require.Equal(t, "network4-add", agents.RecordedCommands[1].GetCommand())
+	require.Equal(t, "network4-subnet-add", agents.RecordedCommands[2].GetCommand())
+	require.Equal(t, "network4-subnet-add", agents.RecordedCommands[3].GetCommand())
+
+	// The shared network should have been added to the database.
+	subnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+	require.NotZero(t, subnet.SharedNetworkID)
+	require.NotNil(t, subnet.SharedNetwork)
+	require.Equal(t, "foo", subnet.SharedNetwork.Name)
+
+	// The config reviews should have been started for both daemons.
+	require.Len(t, dispatcher.CallLog, 2)
+}
+
+// Test committing updated shared network, i.e. actually sending control
+// commands to Kea and updating the shared network in the database.
+func TestCommitSharedNetworkUpdate(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	storktestdbmodel.AddTestHosts(t, db)
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    agents,
+		DefLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	})
+
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	// Create the shared network with the subnet in the database.
+	network := &dbmodel.SharedNetwork{
+		Name:   "foo",
+		Family: 4,
+		Subnets: []dbmodel.Subnet{
+			{
+				ID: subnets[0].ID,
+			},
+		},
+	}
+	err = dbmodel.AddSharedNetworkWithExistingSubnets(db, network)
+	require.NoError(t, err)
+
+	ctx, err := module.BeginSharedNetworkUpdate(context.Background(), network.ID)
+	require.NoError(t, err)
+
+	// Rename the shared network.
+	updatedNetwork := &dbmodel.SharedNetwork{
+		Name: "bar",
+		Subnets: []dbmodel.Subnet{
+			{
+				ID: subnets[0].ID,
+			},
+		},
+	}
+	err = updatedNetwork.PopulateSubnets(db)
+	require.NoError(t, err)
+
+	ctx, err = module.ApplySharedNetworkUpdate(ctx, updatedNetwork, nil)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	// The shared network should have been re-created in both daemons.
+	require.Len(t, agents.RecordedCommands, 6)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, "network4-del", agents.RecordedCommands[3*i].GetCommand())
+		require.Equal(t, "network4-add", agents.RecordedCommands[3*i+1].GetCommand())
+		require.Equal(t, "network4-subnet-add", agents.RecordedCommands[3*i+2].GetCommand())
+	}
+
+	// The shared network should have been renamed in the database.
+	returned, err := dbmodel.GetSharedNetworkWithSubnets(db, network.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, "bar", returned.Name)
+	require.Len(t, returned.Subnets, 1)
+}
+
+// Test that an attempt to begin updating non-existing shared network
+// returns an error.
+func TestBeginSharedNetworkUpdateNotFound(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	_, err := module.BeginSharedNetworkUpdate(context.Background(), 1024)
+	var notFound *config.SharedNetworkNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+// Returns a transaction state for updating global parameters in two
+// DHCPv4 servers having test configurations.
+func newTestGlobalParametersUpdateState(t *testing.T) *config.TransactionState {
+	var daemons []dbmodel.Daemon
+	for i := 1; i <= 2; i++ {
+		daemon := newTestSubnetDaemon(int64(i), "dhcp4", fmt.Sprintf("192.0.2.%d", i), int64(1233+i))
+		daemon.App.Name = fmt.Sprintf("kea@192.0.2.%d", i)
+		cfg, err := dbmodel.NewKeaConfigFromJSON(`{
+            "Dhcp4": {
+                "valid-lifetime": 3600,
+                "renew-timer": 900,
+                "subnet4": [
+                    {
+                        "id": 1,
+                        "subnet": "192.0.2.0/24"
+                    }
+                ]
+            }
+        }`)
+		require.NoError(t, err)
+		daemon.KeaDaemon = &dbmodel.KeaDaemon{
+			Config: cfg,
+		}
+		daemons = append(daemons, *daemon)
+	}
+	state := config.NewTransactionStateWithUpdate("kea", "global_parameters_update", 1, 2)
+	err := state.SetValueForUpdate(0, "daemons_before_update", daemons)
+	require.NoError(t, err)
+	return state
+}
+
+// Test second stage of updating global parameters.
+func TestApplyGlobalParametersUpdate(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestGlobalParametersUpdateState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	parameters := map[string]any{
+		"valid-lifetime":    7200,
+		"renew-timer":       nil,
+		"ddns-send-updates": true,
+	}
+	ctx, err := module.ApplyGlobalParametersUpdate(ctx, parameters)
+	require.NoError(t, err)
+
+	updatedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, updatedState.Updates, 1)
+	require.Equal(t, "global_parameters_update", updatedState.Updates[0].Operation)
+
+	// The parameters should be stored for the commit.
+	require.Equal(t, parameters, updatedState.Updates[0].Recipe["parameters"])
+
+	// The current configurations should be fetched from both daemons
+	// upon commit.
+	configGetCommands, ok := updatedState.Updates[0].Recipe["config_get_commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, configGetCommands, 2)
+	for i, c := range configGetCommands {
+		command := c.(map[string]any)["command"].(*keactrl.Command)
+		require.JSONEq(t, `{
+            "command": "config-get",
+            "service": [ "dhcp4" ]
+        }`, command.Marshal())
+		app := c.(map[string]any)["app"].(*dbmodel.App)
+		require.Equal(t, fmt.Sprintf("kea@192.0.2.%d", i+1), app.Name)
+	}
+}
+
+// Test that applying global parameters fails when no parameters are
+// specified or the parameters cannot be modified.
+func TestApplyGlobalParametersUpdateInvalid(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestGlobalParametersUpdateState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	_, err := module.ApplyGlobalParametersUpdate(ctx, map[string]any{})
+	require.Error(t, err)
+
+	_, err = module.ApplyGlobalParametersUpdate(ctx, map[string]any{
+		"subnet4": []any{},
+	})
+	require.Error(t, err)
+}
+
+// Mock returning the current configurations of the daemons in response
+// to the first two commands (config-get) and empty responses to the
+// subsequent commands. The configurations differ from the ones held in
+// the Stork database and contain the database credentials.
+func mockGlobalParametersConfigGet(callNo int, cmdResponses []interface{}) {
+	if callNo >= 2 {
+		return
+	}
+	json := []byte(`[
+        {
+            "result": 0,
+            "arguments": {
+                "Dhcp4": {
+                    "valid-lifetime": 3600,
+                    "renew-timer": 900,
+                    "rebind-timer": 1800,
+                    "lease-database": {
+                        "type": "postgresql",
+                        "name": "kea",
+                        "user": "kea",
+                        "password": "secret"
+                    },
+                    "subnet4": [
+                        {
+                            "id": 1,
+                            "subnet": "192.0.2.0/24"
+                        }
+                    ]
+                }
+            }
+        }
+    ]`)
+	command := keactrl.NewCommand("config-get", []string{"dhcp4"}, nil)
+	_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+}
+
+// Test committing updated global parameters, i.e. fetching the current
+// configurations from Kea, testing the new configurations and applying
+// them.
+func TestCommitGlobalParametersUpdate(t *testing.T) {
+	agents := agentcommtest.NewKeaFakeAgents(mockGlobalParametersConfigGet)
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestGlobalParametersUpdateState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	ctx, err := module.ApplyGlobalParametersUpdate(ctx, map[string]any{
+		"valid-lifetime": 7200,
+		"renew-timer":    nil,
+		"lease-database": map[string]any{
+			"type":     "postgresql",
+			"name":     "kea-leases",
+			"password": nil,
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	// The configurations should be fetched and tested in both daemons
+	// before they are applied.
+	require.Len(t, agents.RecordedCommands, 8)
+	expected := []string{
+		"config-get", "config-get",
+		"config-test", "config-test",
+		"config-set", "config-write", "config-set", "config-write",
+	}
+	for i, command := range agents.RecordedCommands {
+		require.Equal(t, expected[i], command.GetCommand())
+	}
+	require.Equal(t, "http://192.0.2.1:1234/", agents.RecordedURLs[0])
+	require.Equal(t, "http://192.0.2.2:1235/", agents.RecordedURLs[1])
+	require.Equal(t, "http://192.0.2.1:1234/", agents.RecordedURLs[4])
+	require.Equal(t, "http://192.0.2.2:1235/", agents.RecordedURLs[6])
+
+	// The new configurations should be created from the fetched ones.
+	// The parameters not specified by the user and the database
+	// credentials should be preserved.
+	for _, i := range []int{2, 3, 4, 6} {
+		require.JSONEq(t, fmt.Sprintf(`{
+            "command": "%s",
+            "service": [ "dhcp4" ],
+            "arguments": {
+                "Dhcp4": {
+                    "valid-lifetime": 7200,
+                    "rebind-timer": 1800,
+                    "lease-database": {
+                        "type": "postgresql",
+                        "name": "kea-leases",
+                        "user": "kea",
+                        "password": "secret"
+                    },
+                    "subnet4": [
+                        {
+                            "id": 1,
+                            "subnet": "192.0.2.0/24"
+                        }
+                    ]
+                }
+            }
+        }`, expected[i]), agents.RecordedCommands[i].Marshal())
+	}
+}
+
+// Test that the global parameters update is aborted when fetching the
+// current configuration from any of the daemons fails.
+func TestCommitGlobalParametersUpdateConfigGetError(t *testing.T) {
+	agents := agentcommtest.NewKeaFakeAgents(mockGlobalParametersConfigGet, func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 1,
+                "text": "unable to get configuration"
+            }
+        ]`)
+		command := keactrl.NewCommand("config-get", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestGlobalParametersUpdateState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	ctx, err := module.ApplyGlobalParametersUpdate(ctx, map[string]any{
+		"valid-lifetime": 7200,
+	})
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "config-get command to kea@192.0.2.2 failed")
+
+	// None of the daemons should be reconfigured.
+	require.Len(t, agents.RecordedCommands, 2)
+	for _, command := range agents.RecordedCommands {
+		require.Equal(t, "config-get", command.GetCommand())
+	}
+}
+
+// Test that the global parameters update is aborted when any of the
+// daemons rejects the new configuration.
+func TestCommitGlobalParametersUpdateRejected(t *testing.T) {
+	agents := agentcommtest.NewKeaFakeAgents(mockGlobalParametersConfigGet, mockGlobalParametersConfigGet, func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 0,
+                "text": "Configuration seems sane."
+            }
+        ]`)
+		command := keactrl.NewCommand("config-test", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	}, func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 1,
+                "text": "invalid valid-lifetime"
+            }
+        ]`)
+		command := keactrl.NewCommand("config-test", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestGlobalParametersUpdateState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	ctx, err := module.ApplyGlobalParametersUpdate(ctx, map[string]any{
+		"valid-lifetime": -1,
+	})
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "config-test command to kea@192.0.2.2 failed")
+	require.ErrorContains(t, err, "invalid valid-lifetime")
+
+	// None of the daemons should be reconfigured.
+	require.Len(t, agents.RecordedCommands, 4)
+	expected := []string{"config-get", "config-get", "config-test", "config-test"}
+	for i, command := range agents.RecordedCommands {
+		require.Equal(t, expected[i], command.GetCommand())
+	}
+}
+
+// Test first stage of updating global parameters. It should fetch the
+// daemons with their configurations and lock them.
+func TestBeginGlobalParametersUpdate(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	daemonIDs := []int64{apps[0].Daemons[0].ID, apps[1].Daemons[0].ID}
+	ctx, err := module.BeginGlobalParametersUpdate(context.Background(), daemonIDs)
+	require.NoError(t, err)
+
+	// The daemons should be locked.
+	require.Contains(t, manager.locks, daemonIDs[0])
+	require.Contains(t, manager.locks, daemonIDs[1])
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "global_parameters_update", state.Updates[0].Operation)
+	require.Equal(t, daemonIDs, state.Updates[0].DaemonIDs)
+
+	daemons, ok := state.Updates[0].Recipe["daemons_before_update"].([]dbmodel.Daemon)
+	require.True(t, ok)
+	require.Len(t, daemons, 2)
+	for _, daemon := range daemons {
+		require.NotNil(t, daemon.KeaDaemon)
+		require.NotNil(t, daemon.KeaDaemon.Config)
+	}
+
+	// Non-existing daemon.
+	_, err = module.BeginGlobalParametersUpdate(context.Background(), []int64{1024})
+	var notFound *config.DaemonNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+// Returns a transaction state for the configuration rollback of a DHCPv4
+// daemon.
+func newTestConfigRollbackState(t *testing.T) *config.TransactionState {
+	daemon := newTestSubnetDaemon(1, "dhcp4", "192.0.2.1", 1234)
+	daemon.App.Name = "kea@192.0.2.1"
+	cfg, err := dbmodel.NewKeaConfigFromJSON(`{
+        "Dhcp4": {
+            "valid-lifetime": 7200
+        }
+    }`)
+	require.NoError(t, err)
+	daemon.KeaDaemon = &dbmodel.KeaDaemon{
+		Config: cfg,
+	}
+	state := config.NewTransactionStateWithUpdate("kea", "config_rollback", 1)
+	err = state.SetValueForUpdate(0, "daemon_before_rollback", *daemon)
+	require.NoError(t, err)
+	return state
+}
+
+// Returns a configuration snapshot of the daemon used in the rollback tests.
+func newTestConfigRollbackSnapshot(t *testing.T) *dbmodel.ConfigSnapshot {
+	cfg, err := dbmodel.NewKeaConfigFromJSON(`{
+        "Dhcp4": {
+            "valid-lifetime": 3600
+        }
+    }`)
+	require.NoError(t, err)
+	return &dbmodel.ConfigSnapshot{
+		ID:       5,
+		DaemonID: 1,
+		Config:   cfg,
+	}
+}
+
+// Test second stage of the configuration rollback.
+func TestApplyConfigRollback(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestConfigRollbackState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	ctx, err := module.ApplyConfigRollback(ctx, newTestConfigRollbackSnapshot(t))
+	require.NoError(t, err)
+
+	updatedState, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, updatedState.Updates, 1)
+	require.Equal(t, "config_rollback", updatedState.Updates[0].Operation)
+	require.EqualValues(t, 5, updatedState.Updates[0].Recipe["snapshot_id"])
+
+	testCommands, ok := updatedState.Updates[0].Recipe["test_commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, testCommands, 1)
+	command := testCommands[0].(map[string]any)["command"].(*keactrl.Command)
+	require.JSONEq(t, `{
+        "command": "config-test",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "Dhcp4": {
+                "valid-lifetime": 3600
+            }
+        }
+    }`, command.Marshal())
+
+	commands, ok := updatedState.Updates[0].Recipe["commands"].([]any)
+	require.True(t, ok)
+	require.Len(t, commands, 2)
+	command = commands[0].(map[string]any)["command"].(*keactrl.Command)
+	require.Equal(t, "config-set", command.GetCommand())
+	command = commands[1].(map[string]any)["command"].(*keactrl.Command)
+	require.Equal(t, "config-write", command.GetCommand())
+}
+
+// Test that the configuration rollback fails when the snapshot lacks the
+// configuration or belongs to another daemon.
+func TestApplyConfigRollbackInvalid(t *testing.T) {
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestConfigRollbackState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	_, err := module.ApplyConfigRollback(ctx, nil)
+	require.Error(t, err)
+
+	_, err = module.ApplyConfigRollback(ctx, &dbmodel.ConfigSnapshot{ID: 5, DaemonID: 1})
+	require.Error(t, err)
+
+	snapshot := newTestConfigRollbackSnapshot(t)
+	snapshot.DaemonID = 2
+	_, err = module.ApplyConfigRollback(ctx, snapshot)
+	require.ErrorContains(t, err, "does not belong to the daemon 1")
+}
+
+// Test committing the configuration rollback, i.e. testing the configuration
+// in Kea and restoring it.
+func TestCommitConfigRollback(t *testing.T) {
+	agents := agentcommtest.NewKeaFakeAgents()
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestConfigRollbackState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	ctx, err := module.ApplyConfigRollback(ctx, newTestConfigRollbackSnapshot(t))
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 3)
+	expected := []string{"config-test", "config-set", "config-write"}
+	for i, command := range agents.RecordedCommands {
+		require.Equal(t, expected[i], command.GetCommand())
+		require.Equal(t, "http://192.0.2.1:1234/", agents.RecordedURLs[i])
+	}
+}
+
+// Test that the configuration review begins after the configuration
+// rollback is committed.
+func TestCommitConfigRollbackBeginsReview(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+	daemon := apps[0].Daemons[0]
+	daemon.App = &apps[0]
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	dispatcher := &storktestdbmodel.FakeDispatcher{}
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:               db,
+		Agents:           agents,
+		ReviewDispatcher: dispatcher,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := config.NewTransactionStateWithUpdate("kea", "config_rollback", daemon.ID)
+	err := state.SetValueForUpdate(0, "daemon_before_rollback", *daemon)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	snapshot := newTestConfigRollbackSnapshot(t)
+	snapshot.DaemonID = daemon.ID
+	ctx, err = module.ApplyConfigRollback(ctx, snapshot)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, dispatcher.CallLog, 1)
+	require.Equal(t, "BeginReview", dispatcher.CallLog[0].CallName)
+}
+
+// Test that the configuration rollback is aborted when the daemon rejects
+// the configuration.
+func TestCommitConfigRollbackRejected(t *testing.T) {
+	agents := agentcommtest.NewKeaFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 1,
+                "text": "unsupported parameter"
+            }
+        ]`)
+		command := keactrl.NewCommand("config-test", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	state := newTestConfigRollbackState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+
+	ctx, err := module.ApplyConfigRollback(ctx, newTestConfigRollbackSnapshot(t))
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "aborting the configuration rollback")
+	require.ErrorContains(t, err, "unsupported parameter")
+
+	// The configuration should not be restored.
+	require.Len(t, agents.RecordedCommands, 1)
+	require.Equal(t, "config-test", agents.RecordedCommands[0].GetCommand())
+}
+
+// Test committing the scheduled configuration rollback.
+func TestCommitScheduledConfigRollback(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	agents := agentcommtest.NewKeaFakeAgents()
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:     db,
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	// User is required to associate the config change with a user.
+	user := &dbmodel.SystemUser{
+		Login:    "test",
+		Lastname: "test",
+		Name:     "test",
+		Password: "test",
+	}
+	_, err := dbmodel.CreateUser(db, user)
+	require.NoError(t, err)
+	require.NotZero(t, user.ID)
+
+	state := newTestConfigRollbackState(t)
+	ctx := context.WithValue(context.Background(), config.StateContextKey, *state)
+	ctx = context.WithValue(ctx, config.UserContextKey, int64(user.ID))
+
+	ctx, err = module.ApplyConfigRollback(ctx, newTestConfigRollbackSnapshot(t))
+	require.NoError(t, err)
+
+	// Simulate scheduling the config change and retrieving it from the database.
+	ctx = manager.scheduleAndGetChange(ctx, t)
+	require.NotNil(t, ctx)
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 3)
+	require.JSONEq(t, `{
+        "command": "config-set",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "Dhcp4": {
+                "valid-lifetime": 3600
+            }
+        }
+    }`, agents.RecordedCommands[1].Marshal())
+	require.Equal(t, "http://192.0.2.1:1234/", agents.RecordedURLs[1])
+}
+
+// Test the first stage of the configuration rollback. It checks that the
+// daemon is fetched from the database and locked.
+func TestBeginConfigRollback(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	daemonID := apps[0].Daemons[0].ID
+	ctx, err := module.BeginConfigRollback(context.Background(), daemonID)
+	require.NoError(t, err)
+
+	// The daemon should be locked.
+	require.Contains(t, manager.locks, daemonID)
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "config_rollback", state.Updates[0].Operation)
+	require.Equal(t, []int64{daemonID}, state.Updates[0].DaemonIDs)
+
+	daemon, ok := state.Updates[0].Recipe["daemon_before_rollback"].(dbmodel.Daemon)
+	require.True(t, ok)
+	require.Equal(t, daemonID, daemon.ID)
+	require.NotNil(t, daemon.App)
+
+	// Non-existing daemon.
+	_, err = module.BeginConfigRollback(context.Background(), 1024)
+	var notFound *config.DaemonNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+// Returns the configuration of the DHCPv4 daemon used in the host
+// reservations migration tests. It includes the global host reservation
+// and the host reservations in the top level subnet and in the shared
+// network. The daemon uses the host_cmds hooks library and a host
+// database unless the host database is not requested.
+func getTestHostsMigrationConfig(hostsDatabase bool) string {
+	hostsDatabaseConfig := ""
+	if hostsDatabase {
+		hostsDatabaseConfig = `
+            "hosts-database": {
+                "type": "postgresql",
+                "name": "kea"
+            },`
+	}
+	return fmt.Sprintf(`{
+        "Dhcp4": {%s
+            "reservations": [
+                {
+                    "hw-address": "01:02:03:04:05:06",
+                    "hostname": "global.example.org"
+                }
+            ],
+            "subnet4": [
+                {
+                    "id": 1,
+                    "subnet": "192.0.2.0/24",
+                    "reservations": [
+                        {
+                            "hw-address": "01:02:03:04:05:07",
+                            "ip-address": "192.0.2.10"
+                        }
+                    ]
+                }
+            ],
+            "shared-networks": [
+                {
+                    "name": "foo",
+                    "subnet4": [
+                        {
+                            "id": 2,
+                            "subnet": "192.0.3.0/24",
+                            "reservations": [
+                                {
+                                    "hw-address": "01:02:03:04:05:08",
+                                    "ip-address": "192.0.3.10"
+                                }
+                            ]
+                        }
+                    ]
+                }
+            ],
+            "hooks-libraries": [
+                {
+                    "library": "libdhcp_host_cmds.so"
+                }
+            ]
+        }
+    }`, hostsDatabaseConfig)
+}
+
+// Adds a machine and a Kea app with a DHCPv4 daemon to the database. The
+// daemon's configuration includes the global host reservation and the
+// host reservations in the top level subnet and in the shared network.
+// The daemon uses the host_cmds hooks library and a host database unless
+// the host database is not requested. It also adds the host reservations
+// from the configuration to the database.
+func addTestHostsMigrationApp(t *testing.T, db *pg.DB, hostsDatabase bool) *dbmodel.Daemon {
+	machine := &dbmodel.Machine{
+		Address:   "192.0.2.1",
+		AgentPort: 8080,
+	}
+	err := dbmodel.AddMachine(db, machine)
+	require.NoError(t, err)
+
+	cfg, err := dbmodel.NewKeaConfigFromJSON(getTestHostsMigrationConfig(hostsDatabase))
+	require.NoError(t, err)
+
+	accessPoints := dbmodel.AppendAccessPoint(nil, dbmodel.AccessPointControl, "192.0.2.1", "", 1234, false)
+	app := &dbmodel.App{
+		MachineID:    machine.ID,
+		Type:         dbmodel.AppTypeKea,
+		AccessPoints: accessPoints,
+		Daemons: []*dbmodel.Daemon{
+			{
+				Name:   dhcp4,
+				Active: true,
+				KeaDaemon: &dbmodel.KeaDaemon{
+					Config: cfg,
+				},
+			},
+		},
+	}
+	daemons, err := dbmodel.AddApp(db, app)
+	require.NoError(t, err)
+	require.Len(t, daemons, 1)
+
+	for i := 0; i < 3; i++ {
+		host := &dbmodel.Host{
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{1, 2, 3, 4, 5, byte(6 + i)},
+				},
+			},
+			LocalHosts: []dbmodel.LocalHost{
+				{
+					DaemonID:   daemons[0].ID,
+					DataSource: dbmodel.HostDataSourceConfig,
+				},
+			},
+		}
+		err = dbmodel.AddHost(db, host)
+		require.NoError(t, err)
+	}
+	return daemons[0]
+}
+
+// Test the first stage of the host reservations migration. It checks that
+// the daemon is fetched from the database and locked.
+func TestBeginHostsMigration(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	// The daemon should be locked.
+	require.Contains(t, manager.locks, daemon.ID)
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.Len(t, state.Updates, 1)
+	require.Equal(t, "hosts_migration", state.Updates[0].Operation)
+	require.Equal(t, []int64{daemon.ID}, state.Updates[0].DaemonIDs)
+
+	recipeDaemon, ok := state.Updates[0].Recipe["daemon_before_migration"].(dbmodel.Daemon)
+	require.True(t, ok)
+	require.Equal(t, daemon.ID, recipeDaemon.ID)
+	require.NotNil(t, recipeDaemon.App)
+
+	// Non-existing daemon.
+	_, err = module.BeginHostsMigration(context.Background(), 1024)
+	var notFound *config.DaemonNotFoundError
+	require.ErrorAs(t, err, &notFound)
+}
+
+// Test that the host reservations migration cannot begin when the daemon
+// does not use a host database.
+func TestBeginHostsMigrationNoHostsDatabase(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, false)
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	_, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.ErrorContains(t, err, "does not use a host database")
+	require.Empty(t, manager.locks)
+}
+
+// Returns the daemon's configuration in response to the first command
+// (config-get) sent during the host reservations migration.
+func mockHostsMigrationConfigGet(callNo int, cmdResponses []interface{}) {
+	if callNo > 0 {
+		return
+	}
+	json := []byte(fmt.Sprintf(`[
+        {
+            "result": 0,
+            "arguments": %s
+        }
+    ]`, getTestHostsMigrationConfig(true)))
+	command := keactrl.NewCommand("config-get", []string{"dhcp4"}, nil)
+	_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+}
+
+// Test applying and committing the host reservations migration.
+func TestApplyAndCommitHostsMigration(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	agents := agentcommtest.NewKeaFakeAgents(mockHostsMigrationConfigGet)
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:     db,
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	ctx, migrated, err := module.ApplyHostsMigration(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, migrated)
+
+	state, ok := config.GetTransactionState(ctx)
+	require.True(t, ok)
+	require.EqualValues(t, 3, state.Updates[0].Recipe["migrated_hosts"])
+
+	_, err = module.Commit(ctx)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 7)
+	require.Equal(t, "config-get", agents.RecordedCommands[0].GetCommand())
+	require.Equal(t, "config-test", agents.RecordedCommands[1].GetCommand())
+	require.JSONEq(t, `{
+        "command": "reservation-add",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "reservation": {
+                "hw-address": "010203040506",
+                "hostname": "global.example.org",
+                "subnet-id": 0
+            }
+        }
+    }`, agents.RecordedCommands[2].Marshal())
+	require.JSONEq(t, `{
+        "command": "reservation-add",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "reservation": {
+                "hw-address": "010203040507",
+                "ip-address": "192.0.2.10",
+                "subnet-id": 1
+            }
+        }
+    }`, agents.RecordedCommands[3].Marshal())
+	require.JSONEq(t, `{
+        "command": "reservation-add",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "reservation": {
+                "hw-address": "010203040508",
+                "ip-address": "192.0.3.10",
+                "subnet-id": 2
+            }
+        }
+    }`, agents.RecordedCommands[4].Marshal())
+	// The reservations should be verified in the host database.
+	require.JSONEq(t, `{
+        "command": "reservation-get",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "identifier-type": "hw-address",
+            "identifier": "010203040506",
+            "subnet-id": 0
+        }
+    }`, agents.RecordedCommands[5].Marshal())
+	require.Equal(t, "reservation-get", agents.RecordedCommands[6].GetCommand())
+	require.Equal(t, "reservation-get", agents.RecordedCommands[7].GetCommand())
+	require.Equal(t, "config-set", agents.RecordedCommands[8].GetCommand())
+	require.Equal(t, "config-write", agents.RecordedCommands[9].GetCommand())
+
+	// The configuration sent to the daemon should lack the reservations.
+	require.NotContains(t, agents.RecordedCommands[8].Marshal(), "reservations")
+	require.Contains(t, agents.RecordedCommands[8].Marshal(), "192.0.3.0/24")
+}
+
+// Test that the host reservations migration is rolled back when one of the
+// migrated reservations is not found in the host database.
+func TestCommitHostsMigrationVerifyFailed(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	// The reservations are added but the second one is not found.
+	agents := agentcommtest.NewKeaFakeAgents(mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, func(callNo int, cmdResponses []interface{}) {
+		if callNo != 6 {
+			return
+		}
+		json := []byte(`[
+            {
+                "result": 3,
+                "text": "Host not found."
+            }
+        ]`)
+		command := keactrl.NewCommand("reservation-get", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:     db,
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	ctx, _, err = module.ApplyHostsMigration(ctx)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "not found in the host database")
+
+	// All reservations should be deleted and the configuration should be
+	// left untouched.
+	require.Len(t, agents.RecordedCommands, 10)
+	for i := 7; i < 10; i++ {
+		require.Equal(t, "reservation-del", agents.RecordedCommands[i].GetCommand())
+	}
+}
+
+// Test that the host reservations migration is rolled back when writing
+// the configuration fails.
+func TestCommitHostsMigrationConfigWriteFailed(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	agents := agentcommtest.NewKeaFakeAgents(mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, func(callNo int, cmdResponses []interface{}) {
+		if callNo != 9 {
+			return
+		}
+		json := []byte(`[
+            {
+                "result": 1,
+                "text": "unable to write the configuration"
+            }
+        ]`)
+		command := keactrl.NewCommand("config-write", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:     db,
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	ctx, _, err = module.ApplyHostsMigration(ctx)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "aborting the host reservations migration")
+
+	// The original configuration should be restored and the reservations
+	// deleted from the host database.
+	require.Len(t, agents.RecordedCommands, 14)
+	require.Equal(t, "config-write", agents.RecordedCommands[9].GetCommand())
+	require.Equal(t, "config-set", agents.RecordedCommands[10].GetCommand())
+	require.Contains(t, agents.RecordedCommands[10].Marshal(), "reservations")
+	for i := 11; i < 14; i++ {
+		require.Equal(t, "reservation-del", agents.RecordedCommands[i].GetCommand())
+	}
+}
+
+// Test that the host reservations added to the host database are deleted
+// when adding one of the reservations fails.
+func TestCommitHostsMigrationRollback(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	agents := agentcommtest.NewKeaFakeAgents(mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, mockHostsMigrationConfigGet, func(callNo int, cmdResponses []interface{}) {
+		if callNo != 3 {
+			return
+		}
+		json := []byte(`[
+            {
+                "result": 1,
+                "text": "unable to add the reservation"
+            }
+        ]`)
+		command := keactrl.NewCommand("reservation-add", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:     db,
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	ctx, _, err = module.ApplyHostsMigration(ctx)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "aborting the host reservations migration")
+
+	// The first reservation should be deleted and the configuration
+	// should be left untouched.
+	require.Len(t, agents.RecordedCommands, 5)
+	require.Equal(t, "config-get", agents.RecordedCommands[0].GetCommand())
+	require.Equal(t, "config-test", agents.RecordedCommands[1].GetCommand())
+	require.Equal(t, "reservation-add", agents.RecordedCommands[2].GetCommand())
+	require.Equal(t, "reservation-add", agents.RecordedCommands[3].GetCommand())
+	require.JSONEq(t, `{
+        "command": "reservation-del",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "identifier-type": "hw-address",
+            "identifier": "010203040506",
+            "subnet-id": 0
+        }
+    }`, agents.RecordedCommands[4].Marshal())
+}
+
+// Test that the host reservations migration is aborted when the host
+// reservations in the daemon's configuration have changed since the
+// migration began.
+func TestCommitHostsMigrationConfigChanged(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	agents := agentcommtest.NewKeaFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 0,
+                "arguments": {
+                    "Dhcp4": {
+                        "reservations": [
+                            {
+                                "hw-address": "01:02:03:04:05:09",
+                                "hostname": "new.example.org"
+                            }
+                        ]
+                    }
+                }
+            }
+        ]`)
+		command := keactrl.NewCommand("config-get", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB:     db,
+		Agents: agents,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	ctx, _, err = module.ApplyHostsMigration(ctx)
+	require.NoError(t, err)
+
+	_, err = module.Commit(ctx)
+	require.ErrorContains(t, err, "have changed")
+
+	// Only the configuration should be fetched.
+	require.Len(t, agents.RecordedCommands, 1)
+	require.Equal(t, "config-get", agents.RecordedCommands[0].GetCommand())
+}
+
+// Test that the host reservations migration is refused when the host
+// reservations in the Stork database do not match the configuration.
+func TestApplyHostsMigrationOutdated(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestHostsMigrationApp(t, db, true)
+
+	// Remove one of the hosts from the Stork database.
+	hosts, _, err := dbmodel.GetHostsByDaemonID(db, daemon.ID, dbmodel.HostDataSourceConfig)
+	require.NoError(t, err)
+	require.Len(t, hosts, 3)
+	err = dbmodel.DeleteHost(db, hosts[2].ID)
+	require.NoError(t, err)
+
+	manager := newTestManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	module := NewConfigModule(manager)
+	require.NotNil(t, module)
+
+	ctx, err := module.BeginHostsMigration(context.Background(), daemon.ID)
+	require.NoError(t, err)
+
+	_, _, err = module.ApplyHostsMigration(ctx)
+	require.ErrorContains(t, err, "the Stork database is not up to date")
+}
+
+// Test comparing the keys of the migrated host reservations with the
+// host reservations.
+func TestHasSameMigratedHostKeys(t *testing.T) {
+	hosts := []dbmodel.Host{
+		{
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{1, 2, 3, 4, 5, 6},
+				},
+				{
+					Type:  "client-id",
+					Value: []byte{1, 2},
+				},
+			},
+		},
+		{
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{1, 2, 3, 4, 5, 7},
+				},
+			},
+		},
+	}
+	require.Equal(t, "client-id=0102,hw-address=010203040506", getMigratedHostKey(&hosts[0]))
+
+	keys := []string{getMigratedHostKey(&hosts[1]), getMigratedHostKey(&hosts[0])}
+	require.True(t, hasSameMigratedHostKeys(keys, hosts))
+	require.False(t, hasSameMigratedHostKeys(keys[:1], hosts))
+	require.False(t, hasSameMigratedHostKeys([]string{keys[0], keys[0]}, hosts))
+}
@@ -0,0 +1,228 @@
+package kea
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"isc.org/stork/server/agentcomm"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/eventcenter"
+	storkutil "isc.org/stork/util"
+)
+
+const (
+	// Length of the utilization history used to forecast the exhaustion.
+	exhaustionForecastWindow = 7 * 24 * time.Hour
+	// Resolution at which the utilization history is fitted.
+	exhaustionForecastResolution = time.Hour
+	// Minimum number of the samples required to forecast the exhaustion.
+	exhaustionForecastMinSamples = 6
+	// The exhaustion predicted further in the future is ignored.
+	exhaustionForecastMaxRange = 10 * 365 * 24 * time.Hour
+)
+
+// Instance of the puller that periodically forecasts the exhaustion of
+// the subnets and pools using their utilization history. It emits a
+// warning event when the exhaustion is predicted within the horizon
+// configured in the settings.
+type ExhaustionForecastPuller struct {
+	*agentcomm.PeriodicPuller
+	EventCenter eventcenter.EventCenter
+}
+
+// Create an instance of the puller that periodically forecasts the
+// exhaustion of the subnets and pools.
+func NewExhaustionForecastPuller(db *dbops.PgDB, agents agentcomm.ConnectedAgents, eventCenter eventcenter.EventCenter) (*ExhaustionForecastPuller, error) {
+	puller := &ExhaustionForecastPuller{
+		EventCenter: eventCenter,
+	}
+	periodicPuller, err := agentcomm.NewPeriodicPuller(db, agents, "Exhaustion forecast puller",
+		"exhaustion_forecast_puller_interval", puller.pull)
+	if err != nil {
+		return nil, err
+	}
+	puller.PeriodicPuller = periodicPuller
+	return puller, nil
+}
+
+// Stops the timer triggering the exhaustion forecasts.
+func (puller *ExhaustionForecastPuller) Shutdown() {
+	puller.PeriodicPuller.Shutdown()
+}
+
+// Fits a line to the utilization samples using the least squares method
+// and returns the time when the utilization reaches 100%. The utilization
+// function selects the utilization from the sample. It returns zero time
+// when there are not enough samples, the utilization does not grow or the
+// exhaustion is too far in the future. If the line has already reached
+// 100% the current time is returned.
+func forecastExhaustion(samples []dbmodel.UtilizationSample, utilization func(*dbmodel.UtilizationSample) int16, now time.Time) time.Time {
+	if len(samples) < exhaustionForecastMinSamples {
+		return time.Time{}
+	}
+	base := samples[0].SampledAt
+	var meanX, meanY float64
+	for i := range samples {
+		meanX += samples[i].SampledAt.Sub(base).Seconds()
+		meanY += float64(utilization(&samples[i])) / 1000
+	}
+	n := float64(len(samples))
+	meanX /= n
+	meanY /= n
+
+	var sxx, sxy float64
+	for i := range samples {
+		dx := samples[i].SampledAt.Sub(base).Seconds() - meanX
+		dy := float64(utilization(&samples[i]))/1000 - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+	}
+	if sxx == 0 {
+		return time.Time{}
+	}
+	slope := sxy / sxx
+	if slope <= 0 {
+		return time.Time{}
+	}
+	intercept := meanY - slope*meanX
+	exhaustionX := (1 - intercept) / slope
+	if exhaustionX > now.Sub(base).Seconds()+exhaustionForecastMaxRange.Seconds() {
+		return time.Time{}
+	}
+	exhaustion := base.Add(time.Duration(exhaustionX * float64(time.Second))).Round(time.Second)
+	if exhaustion.Before(now) {
+		return now
+	}
+	return exhaustion
+}
+
+// Returns the address utilization of the sample.
+func getAddrUtilization(sample *dbmodel.UtilizationSample) int16 {
+	return sample.AddrUtilization
+}
+
+// Returns the delegated prefix utilization of the sample.
+func getPdUtilization(sample *dbmodel.UtilizationSample) int16 {
+	return sample.PdUtilization
+}
+
+// Returns the earlier of the two forecasts ignoring the zero ones.
+func earlierForecast(first, second time.Time) time.Time {
+	if first.IsZero() || (!second.IsZero() && second.Before(first)) {
+		return second
+	}
+	return first
+}
+
+// Checks if the exhaustion has just been predicted within the horizon,
+// i.e. the previous forecast was beyond the horizon or there was no
+// forecast at all.
+func isNewlyWithinHorizon(previous, current, horizon time.Time) bool {
+	if current.IsZero() || current.After(horizon) {
+		return false
+	}
+	return previous.IsZero() || previous.After(horizon)
+}
+
+// Forecasts the exhaustion of all subnets and pools and stores the
+// forecasts in the database. It emits a warning event for each subnet and
+// pool for which the exhaustion has just been predicted within the horizon.
+func (puller *ExhaustionForecastPuller) pull() error {
+	horizonDays, err := dbmodel.GetSettingInt(puller.DB, "exhaustion_forecast_horizon")
+	if err != nil {
+		return err
+	}
+	now := storkutil.UTCNow()
+	from := now.Add(-exhaustionForecastWindow)
+	horizon := now.Add(time.Duration(horizonDays) * 24 * time.Hour)
+
+	subnets, err := dbmodel.GetAllSubnets(puller.DB, 0)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	forecastsCount := 0
+	for i := range subnets {
+		subnet := &subnets[i]
+		history, err := dbmodel.GetSubnetUtilizationHistory(puller.DB, subnet.ID, from, now, exhaustionForecastResolution)
+		if err != nil {
+			lastErr = err
+			log.Errorf("Cannot forecast exhaustion of subnet %d: %s", subnet.ID, err)
+			continue
+		}
+		forecast := earlierForecast(
+			forecastExhaustion(history, getAddrUtilization, now),
+			forecastExhaustion(history, getPdUtilization, now),
+		)
+		if isNewlyWithinHorizon(subnet.ExhaustionForecast, forecast, horizon) {
+			puller.EventCenter.AddWarningEvent(
+				fmt.Sprintf("{subnet} is projected to be exhausted on %s", forecast.Format(time.RFC3339)),
+				subnet)
+		}
+		if !forecast.Equal(subnet.ExhaustionForecast) {
+			if err = subnet.UpdateExhaustionForecast(puller.DB, forecast); err != nil {
+				lastErr = err
+				log.Errorf("Cannot update exhaustion forecast of subnet %d: %s", subnet.ID, err)
+			}
+		}
+		if !forecast.IsZero() {
+			forecastsCount++
+		}
+
+		for j := range subnet.AddressPools {
+			pool := &subnet.AddressPools[j]
+			history, err := dbmodel.GetAddressPoolUtilizationHistory(puller.DB, pool.ID, from, now, exhaustionForecastResolution)
+			if err != nil {
+				lastErr = err
+				log.Errorf("Cannot forecast exhaustion of address pool %d: %s", pool.ID, err)
+				continue
+			}
+			forecast := forecastExhaustion(history, getAddrUtilization, now)
+			if isNewlyWithinHorizon(pool.ExhaustionForecast, forecast, horizon) {
+				puller.EventCenter.AddWarningEvent(
+					fmt.Sprintf("pool %s-%s in {subnet} is projected to be exhausted on %s",
+						pool.LowerBound, pool.UpperBound, forecast.Format(time.RFC3339)),
+					subnet)
+			}
+			if !forecast.Equal(pool.ExhaustionForecast) {
+				if err = pool.UpdateExhaustionForecast(puller.DB, forecast); err != nil {
+					lastErr = err
+					log.Errorf("Cannot update exhaustion forecast of address pool %d: %s", pool.ID, err)
+				}
+			}
+		}
+
+		for j := range subnet.PrefixPools {
+			pool := &subnet.PrefixPools[j]
+			history, err := dbmodel.GetPrefixPoolUtilizationHistory(puller.DB, pool.ID, from, now, exhaustionForecastResolution)
+			if err != nil {
+				lastErr = err
+				log.Errorf("Cannot forecast exhaustion of prefix pool %d: %s", pool.ID, err)
+				continue
+			}
+			forecast := forecastExhaustion(history, getPdUtilization, now)
+			if isNewlyWithinHorizon(pool.ExhaustionForecast, forecast, horizon) {
+				puller.EventCenter.AddWarningEvent(
+					fmt.Sprintf("prefix pool %s in {subnet} is projected to be exhausted on %s",
+						pool.Prefix, forecast.Format(time.RFC3339)),
+					subnet)
+			}
+			if !forecast.Equal(pool.ExhaustionForecast) {
+				if err = pool.UpdateExhaustionForecast(puller.DB, forecast); err != nil {
+					lastErr = err
+					log.Errorf("Cannot update exhaustion forecast of prefix pool %d: %s", pool.ID, err)
+				}
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"subnets_count":   len(subnets),
+		"forecasts_count": forecastsCount,
+	}).Info("Completed forecasting subnets exhaustion")
+
+	return lastErr
+}
@@ -0,0 +1,189 @@
+package kea
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	storktest "isc.org/stork/server/test/dbmodel"
+)
+
+// Returns the hourly utilization samples beginning at the specified time.
+// The address utilization grows by the specified step every hour.
+func newGrowingUtilizationSamples(begin time.Time, count int, initial, step int16) []dbmodel.UtilizationSample {
+	samples := []dbmodel.UtilizationSample{}
+	for i := 0; i < count; i++ {
+		samples = append(samples, dbmodel.UtilizationSample{
+			SampledAt:       begin.Add(time.Duration(i) * time.Hour),
+			AddrUtilization: initial + int16(i)*step,
+			SampleCount:     1,
+		})
+	}
+	return samples
+}
+
+// Test that the exhaustion is forecast from the linearly growing utilization.
+func TestForecastExhaustion(t *testing.T) {
+	begin := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	now := begin.Add(10 * time.Hour)
+
+	// The utilization grows by 1% every hour starting from 10%. It reaches
+	// 100% after 90 hours.
+	samples := newGrowingUtilizationSamples(begin, 10, 100, 10)
+	forecast := forecastExhaustion(samples, getAddrUtilization, now)
+	require.Equal(t, begin.Add(90*time.Hour), forecast)
+
+	// The delegated prefix utilization does not grow.
+	forecast = forecastExhaustion(samples, getPdUtilization, now)
+	require.Zero(t, forecast)
+}
+
+// Test that the exhaustion is not forecast when the utilization does not
+// grow or there are not enough samples.
+func TestForecastExhaustionNoGrowth(t *testing.T) {
+	begin := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	now := begin.Add(10 * time.Hour)
+
+	// Decreasing utilization.
+	samples := newGrowingUtilizationSamples(begin, 10, 500, -10)
+	require.Zero(t, forecastExhaustion(samples, getAddrUtilization, now))
+
+	// Too few samples.
+	samples = newGrowingUtilizationSamples(begin, exhaustionForecastMinSamples-1, 100, 10)
+	require.Zero(t, forecastExhaustion(samples, getAddrUtilization, now))
+
+	// All samples at the same time.
+	samples = newGrowingUtilizationSamples(begin, 10, 100, 10)
+	for i := range samples {
+		samples[i].SampledAt = begin
+	}
+	require.Zero(t, forecastExhaustion(samples, getAddrUtilization, now))
+}
+
+// Test that the exhaustion predicted too far in the future is ignored.
+func TestForecastExhaustionTooFar(t *testing.T) {
+	begin := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	now := begin.Add(10 * time.Hour)
+
+	// The utilization grows by 0.1% in a year.
+	samples := []dbmodel.UtilizationSample{}
+	for i := 0; i < 10; i++ {
+		samples = append(samples, dbmodel.UtilizationSample{
+			SampledAt:       begin.Add(time.Duration(i) * 24 * 365 * time.Hour / 10),
+			AddrUtilization: 100 + int16(i/9),
+		})
+	}
+	require.Zero(t, forecastExhaustion(samples, getAddrUtilization, now))
+}
+
+// Test that the current time is returned when the fitted line has already
+// reached 100%.
+func TestForecastExhaustionAlreadyExhausted(t *testing.T) {
+	begin := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	now := begin.Add(100 * time.Hour)
+	samples := newGrowingUtilizationSamples(begin, 10, 900, 10)
+	require.Equal(t, now, forecastExhaustion(samples, getAddrUtilization, now))
+}
+
+// Test selecting the earlier of the forecasts.
+func TestEarlierForecast(t *testing.T) {
+	first := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	require.Equal(t, first, earlierForecast(first, second))
+	require.Equal(t, first, earlierForecast(second, first))
+	require.Equal(t, first, earlierForecast(first, time.Time{}))
+	require.Equal(t, second, earlierForecast(time.Time{}, second))
+	require.Zero(t, earlierForecast(time.Time{}, time.Time{}))
+}
+
+// Test checking if the exhaustion has just been predicted within the horizon.
+func TestIsNewlyWithinHorizon(t *testing.T) {
+	horizon := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	before := horizon.Add(-time.Hour)
+	after := horizon.Add(time.Hour)
+
+	require.True(t, isNewlyWithinHorizon(time.Time{}, before, horizon))
+	require.True(t, isNewlyWithinHorizon(after, before, horizon))
+	require.False(t, isNewlyWithinHorizon(before, before.Add(time.Minute), horizon))
+	require.False(t, isNewlyWithinHorizon(time.Time{}, after, horizon))
+	require.False(t, isNewlyWithinHorizon(before, time.Time{}, horizon))
+}
+
+// Test that the puller stores the forecasts and emits the events when the
+// exhaustion is predicted within the horizon.
+func TestExhaustionForecastPullerPull(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+		AddressPools: []dbmodel.AddressPool{
+			{
+				LowerBound: "192.0.2.10",
+				UpperBound: "192.0.2.100",
+			},
+		},
+	}
+	err = dbmodel.AddSubnet(db, subnet)
+	require.NoError(t, err)
+
+	// The subnet utilization grows by 1% every hour and the pool
+	// utilization grows by 0.1% every hour.
+	begin := time.Now().UTC().Add(-10 * time.Hour).Truncate(time.Hour)
+	samples := []*dbmodel.UtilizationSample{}
+	for i := 0; i < 10; i++ {
+		samples = append(samples, &dbmodel.UtilizationSample{
+			SubnetID:        subnet.ID,
+			SampledAt:       begin.Add(time.Duration(i) * time.Hour),
+			AddrUtilization: int16(100 + i*10),
+			SampleCount:     1,
+		}, &dbmodel.UtilizationSample{
+			AddressPoolID:   subnet.AddressPools[0].ID,
+			SampledAt:       begin.Add(time.Duration(i) * time.Hour),
+			AddrUtilization: int16(100 + i),
+			SampleCount:     1,
+		})
+	}
+	err = dbmodel.AddUtilizationSamples(db, samples)
+	require.NoError(t, err)
+
+	fec := &storktest.FakeEventCenter{}
+	puller, err := NewExhaustionForecastPuller(db, agentcommtest.NewFakeAgents(nil, nil), fec)
+	require.NoError(t, err)
+	defer puller.Shutdown()
+
+	err = puller.pull()
+	require.NoError(t, err)
+
+	returned, err := dbmodel.GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.WithinDuration(t, begin.Add(90*time.Hour), returned.ExhaustionForecast, time.Second)
+	require.Len(t, returned.AddressPools, 1)
+	require.WithinDuration(t, begin.Add(900*time.Hour), returned.AddressPools[0].ExhaustionForecast, time.Second)
+
+	// The subnet exhaustion is within the default horizon of 30 days but
+	// the pool exhaustion is not.
+	require.Len(t, fec.Events, 1)
+	require.Equal(t, dbmodel.EvWarning, fec.Events[0].Level)
+	require.Contains(t, fec.Events[0].Text, "projected to be exhausted")
+	require.Equal(t, subnet.ID, fec.Events[0].Relations.SubnetID)
+
+	// The forecast has not changed, so no new event is emitted.
+	err = puller.pull()
+	require.NoError(t, err)
+	require.Len(t, fec.Events, 1)
+
+	// Extend the horizon so the pool exhaustion falls within it.
+	err = dbmodel.SetSettingInt(db, "exhaustion_forecast_horizon", 60)
+	require.NoError(t, err)
+	err = puller.pull()
+	require.NoError(t, err)
+	require.Len(t, fec.Events, 2)
+	require.Contains(t, fec.Events[1].Text, "pool 192.0.2.10-192.0.2.100")
+}
@@ -637,3 +637,76 @@ func detectGlobalHostsFromConfig(dbi dbops.DBI, daemon *dbmodel.Daemon, lookup k
 	// Merge new hosts into the existing global hosts.
 	return mergeHosts(dbi, int64(0), hosts)
 }
+
+// Host reservation specified in the daemon's configuration file. The
+// subnet ID is the ID of the subnet holding the reservation in the
+// daemon's configuration or 0 for the global reservations.
+type configHostReservation struct {
+	SubnetID int64
+	Host     dbmodel.Host
+}
+
+// For a given Kea daemon it detects the global and subnet specific host
+// reservations configured in the configuration file. It includes the
+// reservations in the subnets belonging to the shared networks.
+func detectHostReservationsFromConfig(dbi dbops.DBI, daemon *dbmodel.Daemon, lookup keaconfig.DHCPOptionDefinitionLookup) (reservations []configHostReservation, err error) {
+	globalHosts, err := detectGlobalHostsFromConfig(dbi, daemon, lookup)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range globalHosts {
+		reservations = append(reservations, configHostReservation{
+			Host: host,
+		})
+	}
+	if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+		return reservations, nil
+	}
+	subnetParamName := "subnet4"
+	if daemon.Name == dhcp6 {
+		subnetParamName = "subnet6"
+	}
+	// Collect the top level subnets and the subnets in the shared networks.
+	var subnets []interface{}
+	if subnetList, ok := daemon.KeaDaemon.Config.GetTopLevelList(subnetParamName); ok {
+		subnets = append(subnets, subnetList...)
+	}
+	if networkList, ok := daemon.KeaDaemon.Config.GetTopLevelList("shared-networks"); ok {
+		for _, n := range networkList {
+			if network, ok := n.(map[string]interface{}); ok {
+				if subnetList, ok := network[subnetParamName].([]interface{}); ok {
+					subnets = append(subnets, subnetList...)
+				}
+			}
+		}
+	}
+	for _, s := range subnets {
+		subnet, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		reservationsList, ok := subnet["reservations"].([]interface{})
+		if !ok {
+			continue
+		}
+		subnetID, ok := subnet["id"].(float64)
+		if !ok {
+			return nil, errors.Errorf("subnet %v with host reservations lacks an ID", subnet["subnet"])
+		}
+		for _, r := range reservationsList {
+			reservationMap, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			host, err := dbmodel.NewHostFromKea(&reservationMap, daemon, dbmodel.HostDataSourceConfig, lookup)
+			if err != nil {
+				return nil, errors.WithMessagef(err, "problem parsing host reservation in subnet %d", int64(subnetID))
+			}
+			reservations = append(reservations, configHostReservation{
+				SubnetID: int64(subnetID),
+				Host:     *host,
+			})
+		}
+	}
+	return reservations, nil
+}
@@ -2,6 +2,7 @@ package kea
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"reflect"
 
@@ -272,10 +273,200 @@ func GetLeases6ByHostname(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App,
 	return leases, err
 }
 
+// Sends lease4-get-all or lease6-get-all command to Kea to fetch all leases
+// in the subnet having the specified ID in the Kea configuration. The
+// lease4-get-page and lease6-get-page commands are not used because they
+// do not support filtering by subnet.
+func GetLeasesBySubnetID(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, daemonName string, subnetID int64) (leases []dbmodel.Lease, err error) {
+	commandName := "lease4-get-all"
+	if daemonName == dbmodel.DaemonNameDHCPv6 {
+		commandName = "lease6-get-all"
+	}
+	arguments := map[string]interface{}{
+		"subnets": []int64{subnetID},
+	}
+	command := keactrl.NewCommand(commandName, []string{daemonName}, arguments)
+	response := make([]LeaseGetMultipleResponse, 1)
+	ctx := context.Background()
+	respResult, err := agents.ForwardToKeaOverHTTP(ctx, dbApp, []keactrl.SerializableCommand{command}, &response)
+	if err != nil {
+		return leases, err
+	}
+	if respResult.Error != nil {
+		return leases, respResult.Error
+	}
+	if len(response) == 0 {
+		return leases, errors.Errorf("invalid response to %s command received", commandName)
+	}
+	if response[0].Result == keactrl.ResponseEmpty {
+		return leases, nil
+	}
+	if err = validateGetLeasesResponse(commandName, response[0].Result, response[0].Arguments); err != nil {
+		return leases, err
+	}
+	leases = response[0].Arguments.Leases
+	for i := range leases {
+		leases[i].AppID = dbApp.ID
+		leases[i].App = dbApp
+	}
+	return leases, nil
+}
+
+// Fetches all leases in the subnet from the Kea servers serving this
+// subnet. The subnet must include the local subnets. The servers without
+// the lease_cmds hooks library are skipped. The Kea apps that returned
+// an error are returned in the second value. Such failures do not
+// preclude the function from returning leases found on other servers.
+// The third returned value indicates a general error, e.g. issues with
+// Stork database communication.
+func FindLeasesBySubnet(db *dbops.PgDB, agents agentcomm.ConnectedAgents, subnet *dbmodel.Subnet) (leases []dbmodel.Lease, erredApps []*dbmodel.App, err error) {
+	for _, ls := range subnet.LocalSubnets {
+		daemon, err := dbmodel.GetDaemonByID(db, ls.DaemonID)
+		if err != nil {
+			err = errors.WithMessagef(err, "failed to fetch daemon while searching for leases in subnet %d", subnet.ID)
+			return leases, erredApps, err
+		}
+		if daemon == nil || daemon.App == nil || !daemonHasLeaseCmdsHook(daemon) {
+			continue
+		}
+		daemonLeases, err := GetLeasesBySubnetID(agents, daemon.App, daemon.Name, ls.LocalSubnetID)
+		if err != nil {
+			log.Warn(err)
+			erredApps = append(erredApps, daemon.App)
+			continue
+		}
+		leases = append(leases, daemonLeases...)
+	}
+	return leases, erredApps, nil
+}
+
+// Error returned when Kea responds with the empty status to a command
+// modifying a lease. It indicates that the lease does not exist.
+type LeaseNotFoundError struct {
+	commandName string
+	ipAddress   string
+}
+
+// Creates new instance of the LeaseNotFoundError.
+func NewLeaseNotFoundError(commandName, ipAddress string) *LeaseNotFoundError {
+	return &LeaseNotFoundError{
+		commandName: commandName,
+		ipAddress:   ipAddress,
+	}
+}
+
+// Returns error string.
+func (e *LeaseNotFoundError) Error() string {
+	return fmt.Sprintf("lease %s not found by Kea in response to %s command", e.ipAddress, e.commandName)
+}
+
+// Sends a command modifying leases, e.g. lease4-del, to Kea and checks
+// the response. If Kea responds with the empty status, the
+// LeaseNotFoundError is returned unless the empty status is allowed.
+// The ipAddress is used in the error message.
+func sendLeaseCommand(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, command *keactrl.Command, ipAddress string, allowEmpty bool) error {
+	var response keactrl.ResponseList
+	ctx := context.Background()
+	respResult, err := agents.ForwardToKeaOverHTTP(ctx, dbApp, []keactrl.SerializableCommand{command}, &response)
+	if err != nil {
+		return err
+	}
+	if err = respResult.GetFirstError(); err != nil {
+		return err
+	}
+	if len(response) == 0 {
+		return errors.Errorf("invalid response to %s command received", command.GetCommand())
+	}
+	if err = keactrl.GetResponseError(response[0]); err != nil {
+		return err
+	}
+	if response[0].Result == keactrl.ResponseEmpty && !allowEmpty {
+		return errors.WithStack(NewLeaseNotFoundError(command.GetCommand(), ipAddress))
+	}
+	return nil
+}
+
+// Sends lease4-del command to Kea to delete the lease for the specified
+// IPv4 address. It returns the LeaseNotFoundError if the lease does not
+// exist.
+func DeleteLease4(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, ipaddress string) error {
+	arguments := map[string]interface{}{
+		"ip-address": ipaddress,
+	}
+	command := keactrl.NewCommand("lease4-del", []string{"dhcp4"}, arguments)
+	return sendLeaseCommand(agents, dbApp, command, ipaddress, false)
+}
+
+// Sends lease6-del command to Kea to delete the lease of the specified
+// type (IA_NA or IA_PD) for the IPv6 address or prefix. It returns the
+// LeaseNotFoundError if the lease does not exist.
+func DeleteLease6(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, leaseType, ipaddress string) error {
+	arguments := map[string]interface{}{
+		"ip-address": ipaddress,
+		"type":       leaseType,
+	}
+	command := keactrl.NewCommand("lease6-del", []string{"dhcp6"}, arguments)
+	return sendLeaseCommand(agents, dbApp, command, ipaddress, false)
+}
+
+// Sends lease4-update command to Kea to update an existing DHCPv4 lease.
+// The IP address, hardware address and subnet ID are mandatory. The
+// remaining lease parameters are only sent when they are set.
+func UpdateLease4(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, lease keadata.Lease) error {
+	if len(lease.IPAddress) == 0 || len(lease.HWAddress) == 0 {
+		return errors.New("IP address and hardware address are required to update a lease")
+	}
+	arguments := map[string]interface{}{
+		"ip-address": lease.IPAddress,
+		"hw-address": lease.HWAddress,
+		"subnet-id":  lease.SubnetID,
+		"fqdn-fwd":   lease.FqdnFwd,
+		"fqdn-rev":   lease.FqdnRev,
+	}
+	if lease.ValidLifetime > 0 {
+		arguments["valid-lft"] = lease.ValidLifetime
+	}
+	if len(lease.Hostname) > 0 {
+		arguments["hostname"] = lease.Hostname
+	}
+	if len(lease.ClientID) > 0 {
+		arguments["client-id"] = lease.ClientID
+	}
+	command := keactrl.NewCommand("lease4-update", []string{"dhcp4"}, arguments)
+	return sendLeaseCommand(agents, dbApp, command, lease.IPAddress, false)
+}
+
+// Sends lease4-wipe command to Kea to delete all DHCPv4 leases in the
+// subnet having the specified ID in the Kea configuration. Wiping a
+// subnet without leases is not an error.
+func WipeLeases4(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, subnetID int64) error {
+	arguments := map[string]interface{}{
+		"subnet-id": subnetID,
+	}
+	command := keactrl.NewCommand("lease4-wipe", []string{"dhcp4"}, arguments)
+	return sendLeaseCommand(agents, dbApp, command, "", true)
+}
+
+// Sends lease4-resend-ddns command to Kea to resend the DNS update for
+// the DHCPv4 lease with the specified IP address. It returns the
+// LeaseNotFoundError if the lease does not exist.
+func ResendLease4DDNS(agents agentcomm.ConnectedAgents, dbApp *dbmodel.App, ipaddress string) error {
+	arguments := map[string]interface{}{
+		"ip-address": ipaddress,
+	}
+	command := keactrl.NewCommand("lease4-resend-ddns", []string{"dhcp4"}, arguments)
+	return sendLeaseCommand(agents, dbApp, command, ipaddress, false)
+}
+
 // Convenience function checking if a daemon being a part of the specified app
 // has the libdhcp_lease_cmds hooks library configured.
 func hasLeaseCmdsHook(app *dbmodel.App, daemonName string) bool {
-	daemon := app.GetDaemonByName(daemonName)
+	return daemonHasLeaseCmdsHook(app.GetDaemonByName(daemonName))
+}
+
+// Convenience function checking if the daemon has the libdhcp_lease_cmds
+// hooks library configured.
+func daemonHasLeaseCmdsHook(daemon *dbmodel.Daemon) bool {
 	if daemon != nil && daemon.KeaDaemon != nil && daemon.KeaDaemon.Config != nil {
 		if _, _, ok := daemon.KeaDaemon.Config.GetHooksLibrary("libdhcp_lease_cmds"); ok {
 			return true
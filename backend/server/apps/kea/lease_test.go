@@ -1,6 +1,8 @@
 package kea
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	require "github.com/stretchr/testify/require"
@@ -1482,3 +1484,303 @@ func TestFindHostLeaseConflictsSkipDetection(t *testing.T) {
 		})
 	}
 }
+
+// Returns a function generating a mock response with the specified result
+// to the lease command.
+func mockLeaseCommandResult(commandName, daemonName string, result int) func(int, []interface{}) {
+	return func(callNo int, responses []interface{}) {
+		json := []byte(fmt.Sprintf(`[
+            {
+                "result": %d,
+                "text": "Lease command result"
+            }
+        ]`, result))
+		command := keactrl.NewCommand(commandName, []string{daemonName}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, responses[0])
+	}
+}
+
+// Returns the app used in the tests of the lease commands.
+func newTestLeaseCommandApp() *dbmodel.App {
+	accessPoints := []*dbmodel.AccessPoint{}
+	accessPoints = dbmodel.AppendAccessPoint(accessPoints, dbmodel.AccessPointControl, "localhost", "", 8000, false)
+	return &dbmodel.App{
+		ID:           1,
+		AccessPoints: accessPoints,
+	}
+}
+
+// Test sending lease4-del command to Kea.
+func TestDeleteLease4(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-del", "dhcp4", keactrl.ResponseSuccess), nil)
+
+	err := DeleteLease4(agents, newTestLeaseCommandApp(), "192.0.2.1")
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease4-del",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "ip-address": "192.0.2.1"
+        }
+    }`, agents.RecordedCommands[0].Marshal())
+}
+
+// Test that deleting non-existing DHCPv4 lease returns LeaseNotFoundError.
+func TestDeleteLease4NotFound(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-del", "dhcp4", keactrl.ResponseEmpty), nil)
+
+	err := DeleteLease4(agents, newTestLeaseCommandApp(), "192.0.2.1")
+	var notFound *LeaseNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	require.ErrorContains(t, err, "lease 192.0.2.1 not found")
+}
+
+// Test that an error returned by Kea in response to lease4-del command
+// is reported.
+func TestDeleteLease4Error(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-del", "dhcp4", keactrl.ResponseError), nil)
+
+	err := DeleteLease4(agents, newTestLeaseCommandApp(), "192.0.2.1")
+	require.Error(t, err)
+	var notFound *LeaseNotFoundError
+	require.False(t, errors.As(err, &notFound))
+}
+
+// Test sending lease6-del command to Kea.
+func TestDeleteLease6(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease6-del", "dhcp6", keactrl.ResponseSuccess), nil)
+
+	err := DeleteLease6(agents, newTestLeaseCommandApp(), "IA_PD", "3000::")
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease6-del",
+        "service": [ "dhcp6" ],
+        "arguments": {
+            "ip-address": "3000::",
+            "type": "IA_PD"
+        }
+    }`, agents.RecordedCommands[0].Marshal())
+}
+
+// Test sending lease4-update command to Kea.
+func TestUpdateLease4(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-update", "dhcp4", keactrl.ResponseSuccess), nil)
+
+	lease := keadata.Lease{
+		IPAddress:     "192.0.2.1",
+		HWAddress:     "01:02:03:04:05:06",
+		SubnetID:      1,
+		ValidLifetime: 3600,
+		Hostname:      "myhost.example.org",
+	}
+	err := UpdateLease4(agents, newTestLeaseCommandApp(), lease)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease4-update",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "ip-address": "192.0.2.1",
+            "hw-address": "01:02:03:04:05:06",
+            "subnet-id": 1,
+            "valid-lft": 3600,
+            "hostname": "myhost.example.org",
+            "fqdn-fwd": false,
+            "fqdn-rev": false
+        }
+    }`, agents.RecordedCommands[0].Marshal())
+
+	// The hardware address is mandatory.
+	lease.HWAddress = ""
+	err = UpdateLease4(agents, newTestLeaseCommandApp(), lease)
+	require.Error(t, err)
+	require.Len(t, agents.RecordedCommands, 1)
+}
+
+// Test sending lease4-wipe command to Kea. Wiping the subnet without
+// leases is not an error.
+func TestWipeLeases4(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-wipe", "dhcp4", keactrl.ResponseEmpty), nil)
+
+	err := WipeLeases4(agents, newTestLeaseCommandApp(), 12)
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease4-wipe",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "subnet-id": 12
+        }
+    }`, agents.RecordedCommands[0].Marshal())
+}
+
+// Test sending lease4-resend-ddns command to Kea.
+func TestResendLease4DDNS(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-resend-ddns", "dhcp4", keactrl.ResponseSuccess), nil)
+
+	err := ResendLease4DDNS(agents, newTestLeaseCommandApp(), "192.0.2.1")
+	require.NoError(t, err)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease4-resend-ddns",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "ip-address": "192.0.2.1"
+        }
+    }`, agents.RecordedCommands[0].Marshal())
+}
+
+// Generates a success mock response to lease4-get-all command.
+func mockLeases4GetAll(callNo int, responses []interface{}) {
+	json := []byte(`[
+        {
+            "result": 0,
+            "text": "2 IPv4 lease(s) found.",
+            "arguments": {
+                "leases": [
+                    {
+                        "cltt": 12345678,
+                        "hostname": "first.example.org",
+                        "hw-address": "08:08:08:08:08:08",
+                        "ip-address": "192.0.2.1",
+                        "state": 0,
+                        "subnet-id": 12,
+                        "valid-lft": 3600
+                    },
+                    {
+                        "cltt": 12345678,
+                        "hw-address": "09:09:09:09:09:09",
+                        "ip-address": "192.0.2.2",
+                        "state": 1,
+                        "subnet-id": 12,
+                        "valid-lft": 3600
+                    }
+                ]
+            }
+        }
+    ]`)
+	command := keactrl.NewCommand("lease4-get-all", []string{"dhcp4"}, nil)
+	_ = keactrl.UnmarshalResponseList(command, json, responses[0])
+}
+
+// Test sending lease4-get-all command with the subnets filter to Kea.
+func TestGetLeasesBySubnetID(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	app := newTestLeaseCommandApp()
+
+	leases, err := GetLeasesBySubnetID(agents, app, dbmodel.DaemonNameDHCPv4, 12)
+	require.NoError(t, err)
+	require.Len(t, leases, 2)
+
+	require.Equal(t, "192.0.2.1", leases[0].IPAddress)
+	require.Equal(t, "first.example.org", leases[0].Hostname)
+	require.EqualValues(t, app.ID, leases[0].AppID)
+	require.NotNil(t, leases[0].App)
+	require.Equal(t, "192.0.2.2", leases[1].IPAddress)
+	require.EqualValues(t, 1, leases[1].State)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease4-get-all",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "subnets": [ 12 ]
+        }
+    }`, agents.RecordedCommands[0].Marshal())
+}
+
+// Test that lease6-get-all command is sent to the DHCPv6 server and the
+// empty response is handled.
+func TestGetLeasesBySubnetIDEmpty(t *testing.T) {
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease6-get-all", "dhcp6", keactrl.ResponseEmpty), nil)
+
+	leases, err := GetLeasesBySubnetID(agents, newTestLeaseCommandApp(), dbmodel.DaemonNameDHCPv6, 13)
+	require.NoError(t, err)
+	require.Empty(t, leases)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.Equal(t, "lease6-get-all", agents.RecordedCommands[0].GetCommand())
+}
+
+// Test fetching the leases in the subnet from the Kea servers serving
+// the subnet.
+func TestFindLeasesBySubnet(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	machine := &dbmodel.Machine{
+		Address:   "localhost",
+		AgentPort: 8080,
+	}
+	err := dbmodel.AddMachine(db, machine)
+	require.NoError(t, err)
+
+	// Add two apps. The first one uses the lease_cmds hooks library.
+	var daemons []*dbmodel.Daemon
+	for i, library := range []string{"libdhcp_lease_cmds.so", "libdhcp_host_cmds.so"} {
+		accessPoints := []*dbmodel.AccessPoint{}
+		accessPoints = dbmodel.AppendAccessPoint(accessPoints, dbmodel.AccessPointControl, "localhost", "", int64(8000+i), false)
+		app := &dbmodel.App{
+			MachineID:    machine.ID,
+			Type:         dbmodel.AppTypeKea,
+			AccessPoints: accessPoints,
+			Daemons: []*dbmodel.Daemon{
+				{
+					Name: dbmodel.DaemonNameDHCPv4,
+					KeaDaemon: &dbmodel.KeaDaemon{
+						Config: dbmodel.NewKeaConfig(&map[string]interface{}{
+							"Dhcp4": map[string]interface{}{
+								"hooks-libraries": []interface{}{
+									map[string]interface{}{
+										"library": library,
+									},
+								},
+							},
+						}),
+					},
+				},
+			},
+		}
+		addedDaemons, err := dbmodel.AddApp(db, app)
+		require.NoError(t, err)
+		daemons = append(daemons, addedDaemons...)
+	}
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err = dbmodel.AddSubnet(db, subnet)
+	require.NoError(t, err)
+	for _, daemon := range daemons {
+		err = dbmodel.AddDaemonToSubnet(db, subnet, daemon)
+		require.NoError(t, err)
+	}
+	subnet, err = dbmodel.GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.Len(t, subnet.LocalSubnets, 2)
+
+	agents := agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	leases, erredApps, err := FindLeasesBySubnet(db, agents, subnet)
+	require.NoError(t, err)
+	require.Empty(t, erredApps)
+	require.Len(t, leases, 2)
+
+	// Only the daemon using the lease_cmds hooks library should be queried.
+	require.Len(t, agents.RecordedCommands, 1)
+	require.Equal(t, daemons[0].AppID, leases[0].AppID)
+
+	// Test the case when the Kea server returns an error.
+	agents = agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-get-all", "dhcp4", keactrl.ResponseError), nil)
+	leases, erredApps, err = FindLeasesBySubnet(db, agents, subnet)
+	require.NoError(t, err)
+	require.Empty(t, leases)
+	require.Len(t, erredApps, 1)
+	require.Equal(t, daemons[0].AppID, erredApps[0].ID)
+}
@@ -0,0 +1,150 @@
+package kea
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"isc.org/stork/server/agentcomm"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/eventcenter"
+)
+
+// Instance of the puller that periodically scans the leases in the subnets
+// having host reservations and records the addresses leased to the clients
+// other than the ones holding the reservations.
+type LeaseConflictsPuller struct {
+	*agentcomm.PeriodicPuller
+	EventCenter eventcenter.EventCenter
+}
+
+// Create an instance of the puller that periodically detects the conflicts
+// between the leases and the host reservations.
+func NewLeaseConflictsPuller(db *dbops.PgDB, agents agentcomm.ConnectedAgents, eventCenter eventcenter.EventCenter) (*LeaseConflictsPuller, error) {
+	puller := &LeaseConflictsPuller{
+		EventCenter: eventCenter,
+	}
+	periodicPuller, err := agentcomm.NewPeriodicPuller(db, agents, "Kea lease conflicts puller",
+		"kea_lease_conflicts_puller_interval", puller.pull)
+	if err != nil {
+		return nil, err
+	}
+	puller.PeriodicPuller = periodicPuller
+	return puller, nil
+}
+
+// Stops the timer triggering the lease conflicts detection.
+func (puller *LeaseConflictsPuller) Shutdown() {
+	puller.PeriodicPuller.Shutdown()
+}
+
+// Detects the lease conflicts in all subnets having host reservations,
+// stores them in the database and emits an event for each newly detected
+// conflict.
+func (puller *LeaseConflictsPuller) pull() error {
+	conflicts, unchecked, err := DetectLeaseConflicts(puller.DB, puller.Agents)
+	if err != nil {
+		return err
+	}
+	added, err := dbmodel.ReplaceLeaseConflicts(puller.DB, conflicts, unchecked)
+	if err != nil {
+		return err
+	}
+	for _, c := range added {
+		details := fmt.Sprintf("host ID: %d\nhardware address: %s\nclient ID: %s\nDUID: %s\nhostname: %s",
+			c.HostID, c.HWAddress, c.ClientID, c.DUID, c.Hostname)
+		puller.EventCenter.AddWarningEvent(
+			fmt.Sprintf("address %s reserved in {subnet} is leased by {daemon} to another client", c.Address),
+			c.Subnet, c.Daemon, details)
+	}
+
+	log.WithFields(log.Fields{
+		"conflicts_count": len(conflicts),
+		"new_count":       len(added),
+		"unchecked_count": len(unchecked),
+	}).Info("Completed detecting lease conflicts")
+
+	return nil
+}
+
+// Returns the address of the lease in the format used in the host
+// reservations, i.e. with the prefix length for the delegated prefixes.
+func getLeaseReservationAddress(lease *dbmodel.Lease) string {
+	if lease.PrefixLength > 0 && lease.PrefixLength < 128 {
+		return fmt.Sprintf("%s/%d", lease.IPAddress, lease.PrefixLength)
+	}
+	return lease.IPAddress
+}
+
+// Scans the leases in all subnets having host reservations and returns
+// the conflicts, i.e. the addresses leased to the clients other than the
+// ones holding the reservations. The subnets and daemons for which the
+// leases cannot be fetched are returned in the second value, so the
+// conflicts previously detected for them can be preserved. An error is
+// returned only if there is a problem with database communication. The
+// returned conflicts have the Subnet and Daemon relations set.
+func DetectLeaseConflicts(db *dbops.PgDB, agents agentcomm.ConnectedAgents) (conflicts []dbmodel.LeaseConflict, unchecked []dbmodel.LeaseConflictScope, err error) {
+	subnets, err := dbmodel.GetAllSubnets(db, 0)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "failed to fetch subnets while detecting lease conflicts")
+	}
+	for i := range subnets {
+		subnet := &subnets[i]
+		hosts, err := dbmodel.GetHostsBySubnetID(db, subnet.ID)
+		if err != nil {
+			return nil, nil, errors.WithMessagef(err, "failed to fetch hosts in subnet %d while detecting lease conflicts", subnet.ID)
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+		leases, erredApps, err := FindLeasesBySubnet(db, agents, subnet)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, app := range erredApps {
+			for _, ls := range subnet.LocalSubnets {
+				if ls.Daemon != nil && ls.Daemon.AppID == app.ID {
+					unchecked = append(unchecked, dbmodel.LeaseConflictScope{
+						SubnetID: subnet.ID,
+						DaemonID: ls.DaemonID,
+					})
+				}
+			}
+		}
+		for j := range leases {
+			lease := &leases[j]
+			address := getLeaseReservationAddress(lease)
+			for k := range hosts {
+				host := &hosts[k]
+				if !host.HasIPAddress(address) || len(findHostLeaseConflicts(host, []dbmodel.Lease{*lease})) == 0 {
+					continue
+				}
+				// Find the daemon which has leased the address.
+				var daemon *dbmodel.Daemon
+				for _, ls := range subnet.LocalSubnets {
+					if ls.Daemon != nil && ls.Daemon.AppID == lease.AppID {
+						daemon = ls.Daemon
+						break
+					}
+				}
+				if daemon == nil {
+					continue
+				}
+				conflicts = append(conflicts, dbmodel.LeaseConflict{
+					SubnetID:  subnet.ID,
+					Subnet:    subnet,
+					HostID:    host.ID,
+					DaemonID:  daemon.ID,
+					Daemon:    daemon,
+					Address:   address,
+					HWAddress: lease.HWAddress,
+					ClientID:  lease.ClientID,
+					DUID:      lease.DUID,
+					Hostname:  lease.Hostname,
+				})
+			}
+		}
+	}
+	return conflicts, unchecked, nil
+}
@@ -0,0 +1,236 @@
+package kea
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	keactrl "isc.org/stork/appctrl/kea"
+	keadata "isc.org/stork/appdata/kea"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	storktest "isc.org/stork/server/test/dbmodel"
+)
+
+// Adds a Kea app with the lease_cmds hooks library, a subnet served by
+// this app and two host reservations in the subnet. The reservation for
+// the 192.0.2.1 address matches the lease returned by mockLeases4GetAll.
+// The reservation for the 192.0.2.2 address has a different hardware
+// address than the lease. It returns the subnet, the hosts and the daemon.
+func addTestLeaseConflictsSubnet(t *testing.T, db *dbops.PgDB) (*dbmodel.Subnet, []dbmodel.Host, *dbmodel.Daemon) {
+	machine := &dbmodel.Machine{
+		Address:   "localhost",
+		AgentPort: 8080,
+	}
+	err := dbmodel.AddMachine(db, machine)
+	require.NoError(t, err)
+
+	accessPoints := []*dbmodel.AccessPoint{}
+	accessPoints = dbmodel.AppendAccessPoint(accessPoints, dbmodel.AccessPointControl, "localhost", "", 8000, false)
+	app := &dbmodel.App{
+		MachineID:    machine.ID,
+		Type:         dbmodel.AppTypeKea,
+		AccessPoints: accessPoints,
+		Daemons: []*dbmodel.Daemon{
+			{
+				Name: dbmodel.DaemonNameDHCPv4,
+				KeaDaemon: &dbmodel.KeaDaemon{
+					Config: dbmodel.NewKeaConfig(&map[string]interface{}{
+						"Dhcp4": map[string]interface{}{
+							"hooks-libraries": []interface{}{
+								map[string]interface{}{
+									"library": "libdhcp_lease_cmds.so",
+								},
+							},
+						},
+					}),
+				},
+			},
+		},
+	}
+	daemons, err := dbmodel.AddApp(db, app)
+	require.NoError(t, err)
+	require.Len(t, daemons, 1)
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err = dbmodel.AddSubnet(db, subnet)
+	require.NoError(t, err)
+	err = dbmodel.AddDaemonToSubnet(db, subnet, daemons[0])
+	require.NoError(t, err)
+
+	hosts := []dbmodel.Host{
+		{
+			SubnetID: subnet.ID,
+			Hostname: "first.example.org",
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{8, 8, 8, 8, 8, 8},
+				},
+			},
+			IPReservations: []dbmodel.IPReservation{
+				{
+					Address: "192.0.2.1",
+				},
+			},
+		},
+		{
+			SubnetID: subnet.ID,
+			Hostname: "printer.example.org",
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{10, 10, 10, 10, 10, 10},
+				},
+			},
+			IPReservations: []dbmodel.IPReservation{
+				{
+					Address: "192.0.2.2",
+				},
+			},
+		},
+	}
+	for i := range hosts {
+		err = dbmodel.AddHost(db, &hosts[i])
+		require.NoError(t, err)
+	}
+	return subnet, hosts, daemons[0]
+}
+
+// Test that the address of the lease is converted to the format used in
+// the host reservations.
+func TestGetLeaseReservationAddress(t *testing.T) {
+	lease := &dbmodel.Lease{
+		Lease: keadata.Lease{
+			IPAddress: "192.0.2.1",
+		},
+	}
+	require.Equal(t, "192.0.2.1", getLeaseReservationAddress(lease))
+
+	lease.IPAddress = "2001:db8:1::1"
+	lease.PrefixLength = 128
+	require.Equal(t, "2001:db8:1::1", getLeaseReservationAddress(lease))
+
+	lease.IPAddress = "3000::"
+	lease.PrefixLength = 64
+	require.Equal(t, "3000::/64", getLeaseReservationAddress(lease))
+}
+
+// Test that the addresses leased to the clients other than the ones
+// holding the reservations are detected.
+func TestDetectLeaseConflicts(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet, hosts, daemon := addTestLeaseConflictsSubnet(t, db)
+
+	agents := agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	conflicts, unchecked, err := DetectLeaseConflicts(db, agents)
+	require.NoError(t, err)
+	require.Len(t, conflicts, 1)
+	require.Empty(t, unchecked)
+
+	require.Equal(t, subnet.ID, conflicts[0].SubnetID)
+	require.NotNil(t, conflicts[0].Subnet)
+	require.Equal(t, hosts[1].ID, conflicts[0].HostID)
+	require.Equal(t, daemon.ID, conflicts[0].DaemonID)
+	require.NotNil(t, conflicts[0].Daemon)
+	require.Equal(t, "192.0.2.2", conflicts[0].Address)
+	require.Equal(t, "09:09:09:09:09:09", conflicts[0].HWAddress)
+
+	require.Len(t, agents.RecordedCommands, 1)
+	require.Equal(t, "lease4-get-all", agents.RecordedCommands[0].GetCommand())
+}
+
+// Test that the subnets without reservations are not scanned and the
+// subnets for which the leases cannot be fetched are reported as unchecked.
+func TestDetectLeaseConflictsNoLeases(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet, hosts, daemon := addTestLeaseConflictsSubnet(t, db)
+
+	agents := agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-get-all", "dhcp4", keactrl.ResponseError), nil)
+	conflicts, unchecked, err := DetectLeaseConflicts(db, agents)
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+	require.Len(t, agents.RecordedCommands, 1)
+
+	// The subnet should be reported as unchecked.
+	require.Len(t, unchecked, 1)
+	require.Equal(t, subnet.ID, unchecked[0].SubnetID)
+	require.Equal(t, daemon.ID, unchecked[0].DaemonID)
+
+	for _, host := range hosts {
+		err = dbmodel.DeleteHost(db, host.ID)
+		require.NoError(t, err)
+	}
+
+	agents = agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	conflicts, unchecked, err = DetectLeaseConflicts(db, agents)
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+	require.Empty(t, unchecked)
+	require.Empty(t, agents.RecordedCommands)
+}
+
+// Test that the puller stores the detected conflicts and emits an event
+// only when a new conflict appears.
+func TestLeaseConflictsPullerPull(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	subnet, hosts, _ := addTestLeaseConflictsSubnet(t, db)
+
+	agents := agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	fec := &storktest.FakeEventCenter{}
+	puller, err := NewLeaseConflictsPuller(db, agents, fec)
+	require.NoError(t, err)
+	defer puller.Shutdown()
+
+	err = puller.pull()
+	require.NoError(t, err)
+
+	conflicts, total, err := dbmodel.GetLeaseConflictsByPage(db, 0, 0, &subnet.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, hosts[1].ID, conflicts[0].HostID)
+
+	require.Len(t, fec.Events, 1)
+	require.Contains(t, fec.Events[0].Text, "192.0.2.2")
+	require.Equal(t, dbmodel.EvWarning, fec.Events[0].Level)
+	require.Equal(t, subnet.ID, fec.Events[0].Relations.SubnetID)
+
+	// The conflict persists, so no new event should be emitted and the
+	// conflict should be preserved.
+	err = puller.pull()
+	require.NoError(t, err)
+
+	conflictsAgain, total, err := dbmodel.GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, conflicts[0].ID, conflictsAgain[0].ID)
+	require.Len(t, fec.Events, 1)
+
+	// The leases cannot be fetched, so the conflict should be preserved.
+	puller.Agents = agentcommtest.NewFakeAgents(mockLeaseCommandResult("lease4-get-all", "dhcp4", keactrl.ResponseError), nil)
+	err = puller.pull()
+	require.NoError(t, err)
+
+	conflictsAgain, total, err = dbmodel.GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, conflicts[0].ID, conflictsAgain[0].ID)
+
+	// The conflict is detected again but it is not new.
+	puller.Agents = agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	err = puller.pull()
+	require.NoError(t, err)
+	require.Len(t, fec.Events, 1)
+}
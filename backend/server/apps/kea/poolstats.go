@@ -0,0 +1,274 @@
+package kea
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	keactrl "isc.org/stork/appctrl/kea"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	storkutil "isc.org/stork/util"
+)
+
+// Represents unmarshaled response from Kea daemon to the statistic-get-all
+// command. Each statistic is a list of the samples. Each sample is a pair
+// of the value and the timestamp. The most recent sample is first. The
+// values are held in the raw form to avoid losing precision of the large
+// integers.
+type StatisticGetAllResponse struct {
+	keactrl.ResponseHeader
+	Arguments map[string][][]json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Matches the names of the pool statistics returned by Kea, e.g.
+// subnet[1].pool[0].assigned-addresses or subnet[2].pd-pool[1].total-pds.
+var poolStatisticNamePattern = regexp.MustCompile(`^subnet\[(\d+)\]\.(pool|pd-pool)\[(\d+)\]\.(total-addresses|assigned-addresses|declined-addresses|total-nas|assigned-nas|declined-nas|total-pds|assigned-pds)$`)
+
+// Identifies the pool statistics returned by a daemon. Kea identifies the
+// pools by their positions in the subnet in the daemon's configuration.
+// The positions can differ between the daemons serving the subnet and
+// the order of the pools in the database. Therefore, the pools are
+// identified by their boundaries found at these positions in the daemon's
+// configuration.
+type poolStatsKey struct {
+	DaemonID      int64
+	LocalSubnetID int64
+	PrefixPool    bool
+	Pool          string
+}
+
+// Returns the address pool identifier used in the pool statistics key.
+func getAddressPoolStatsKey(lowerBound, upperBound string) string {
+	return fmt.Sprintf("%s-%s", lowerBound, upperBound)
+}
+
+// Returns the prefix pool identifier used in the pool statistics key.
+func getPrefixPoolStatsKey(prefix string, delegatedLen int) string {
+	return fmt.Sprintf("%s:%d", prefix, delegatedLen)
+}
+
+// Returns the identifiers of the address and prefix pools of the subnet
+// in the order in which they are specified in the daemon's configuration.
+// The identifier is empty for a pool that cannot be parsed.
+func getDaemonPoolStatsKeys(config *dbmodel.KeaConfig, localSubnetID int64) (addressPools []string, prefixPools []string) {
+	rawSubnet, ok := config.GetSubnetByID(localSubnetID)
+	if !ok {
+		return
+	}
+	var subnet dbmodel.KeaConfigSubnet
+	if err := mapstructure.Decode(rawSubnet, &subnet); err != nil {
+		return
+	}
+	for _, p := range subnet.Pools {
+		var key string
+		if pool, err := dbmodel.NewAddressPoolFromRange(p.Pool); err == nil {
+			key = getAddressPoolStatsKey(pool.LowerBound, pool.UpperBound)
+		}
+		addressPools = append(addressPools, key)
+	}
+	for _, p := range subnet.PdPools {
+		var key string
+		if pool, err := dbmodel.NewPrefixPool(fmt.Sprintf("%s/%d", p.Prefix, p.PrefixLen), p.DelegatedLen); err == nil {
+			key = getPrefixPoolStatsKey(pool.Prefix, pool.DelegatedLen)
+		}
+		prefixPools = append(prefixPools, key)
+	}
+	return
+}
+
+// Collects the pool statistics returned by the daemons during a single
+// pull and calculates the statistics of the pools held in the database.
+type poolStatsCollector struct {
+	stats map[poolStatsKey]map[string]*big.Int
+}
+
+// Constructor of the pool statistics collector.
+func newPoolStatsCollector() *poolStatsCollector {
+	return &poolStatsCollector{
+		stats: make(map[poolStatsKey]map[string]*big.Int),
+	}
+}
+
+// Processes the response to the statistic-get-all command and records
+// the pool statistics returned by the daemon. The pools are matched with
+// the pools in the daemon's configuration using their positions in the
+// subnet. The other statistics and the statistics of the pools not found
+// in the configuration are ignored.
+func (c *poolStatsCollector) addResponse(daemon *dbmodel.Daemon, response interface{}) error {
+	statsResp, ok := response.(*[]StatisticGetAllResponse)
+	if !ok || len(*statsResp) == 0 {
+		return errors.Errorf("response to statistic-get-all from daemon %d is empty", daemon.ID)
+	}
+	sr := (*statsResp)[0]
+	if sr.Result != keactrl.ResponseSuccess {
+		return errors.Errorf("daemon %d returned an error to statistic-get-all: %s", daemon.ID, sr.Text)
+	}
+	if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+		return errors.Errorf("configuration of daemon %d is unknown; cannot match the pool statistics", daemon.ID)
+	}
+	// The pools of the subnets in the daemon's configuration by local
+	// subnet ID.
+	addressPools := make(map[int64][]string)
+	prefixPools := make(map[int64][]string)
+	for name, samples := range sr.Arguments {
+		match := poolStatisticNamePattern.FindStringSubmatch(name)
+		if match == nil || len(samples) == 0 || len(samples[0]) == 0 {
+			continue
+		}
+		localSubnetID, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		index, err := strconv.Atoi(match[3])
+		if err != nil {
+			continue
+		}
+		value, ok := new(big.Int).SetString(string(samples[0][0]), 10)
+		if !ok {
+			log.Warnf("Invalid value %s of the statistic %s returned by daemon %d", samples[0][0], name, daemon.ID)
+			continue
+		}
+		if _, exists := addressPools[localSubnetID]; !exists {
+			addressPools[localSubnetID], prefixPools[localSubnetID] = getDaemonPoolStatsKeys(daemon.KeaDaemon.Config, localSubnetID)
+		}
+		pools := addressPools[localSubnetID]
+		prefixPool := match[2] == "pd-pool"
+		if prefixPool {
+			pools = prefixPools[localSubnetID]
+		}
+		if index >= len(pools) || len(pools[index]) == 0 {
+			log.Debugf("Statistic %s returned by daemon %d does not match any pool in its configuration", name, daemon.ID)
+			continue
+		}
+		key := poolStatsKey{
+			DaemonID:      daemon.ID,
+			LocalSubnetID: localSubnetID,
+			PrefixPool:    prefixPool,
+			Pool:          pools[index],
+		}
+		if _, exists := c.stats[key]; !exists {
+			c.stats[key] = make(map[string]*big.Int)
+		}
+		c.stats[key][match[4]] = value
+	}
+	return nil
+}
+
+// Sums the specified statistics of the pool returned by the daemons serving
+// the subnet. The pool is identified by the key returned by the
+// getAddressPoolStatsKey or getPrefixPoolStatsKey function. The daemons
+// in the excluded set are skipped. It returns a nil map if none of the
+// daemons returned the statistics of the pool.
+func (c *poolStatsCollector) sumPoolStats(subnet *dbmodel.Subnet, prefixPool bool, pool string, statNames []string, excludedDaemons map[int64]bool) map[string]*storkutil.BigCounter {
+	var sums map[string]*storkutil.BigCounter
+	for _, ls := range subnet.LocalSubnets {
+		if excludedDaemons[ls.DaemonID] {
+			continue
+		}
+		stats, ok := c.stats[poolStatsKey{
+			DaemonID:      ls.DaemonID,
+			LocalSubnetID: ls.LocalSubnetID,
+			PrefixPool:    prefixPool,
+			Pool:          pool,
+		}]
+		if !ok {
+			continue
+		}
+		if sums == nil {
+			sums = make(map[string]*storkutil.BigCounter)
+			for _, name := range statNames {
+				sums[name] = storkutil.NewBigCounter(0)
+			}
+		}
+		for _, name := range statNames {
+			if value, ok := stats[name]; ok {
+				if _, ok := sums[name].AddBigInt(value); !ok {
+					log.Warnf("Pool %s in subnet %d contains negative value for statistic: %s", pool, subnet.ID, name)
+				}
+			}
+		}
+	}
+	return sums
+}
+
+// Converts the summed statistics to the form stored in the database.
+func convertPoolStats(sums map[string]*storkutil.BigCounter) dbmodel.SubnetStats {
+	stats := dbmodel.SubnetStats{}
+	for name, sum := range sums {
+		stats[name] = sum.ConvertToNativeType()
+	}
+	return stats
+}
+
+// Updates the statistics and the utilization of the pools in the database
+// using the collected statistics. The statistics of the pools are summed
+// across the daemons serving the subnet, except the excluded ones, e.g.
+// passive HA servers. The pools are matched by their boundaries.
+// It returns the utilization samples of the updated pools to be recorded
+// in the utilization history.
+func (c *poolStatsCollector) updatePools(dbi dbops.DBI, excludedDaemons map[int64]bool, sampledAt time.Time) ([]*dbmodel.UtilizationSample, error) {
+	if len(c.stats) == 0 {
+		return nil, nil
+	}
+	subnets, err := dbmodel.GetAllSubnets(dbi, 0)
+	if err != nil {
+		return nil, err
+	}
+	var samples []*dbmodel.UtilizationSample
+	var lastErr error
+	for i := range subnets {
+		subnet := &subnets[i]
+		addressStatNames := []string{"total-addresses", "assigned-addresses", "declined-addresses"}
+		if subnet.GetFamily() == 6 {
+			addressStatNames = []string{"total-nas", "assigned-nas", "declined-nas"}
+		}
+		for j := range subnet.AddressPools {
+			pool := &subnet.AddressPools[j]
+			sums := c.sumPoolStats(subnet, false, getAddressPoolStatsKey(pool.LowerBound, pool.UpperBound), addressStatNames, excludedDaemons)
+			if sums == nil {
+				continue
+			}
+			utilization := sums[addressStatNames[1]].DivideSafeBy(sums[addressStatNames[0]])
+			if err := pool.UpdateStatistics(dbi, convertPoolStats(sums), utilization); err != nil {
+				log.Errorf("Cannot update utilization (%.3f) in pool %d: %s", utilization, pool.ID, err)
+				lastErr = err
+				continue
+			}
+			samples = append(samples, &dbmodel.UtilizationSample{
+				AddressPoolID:   pool.ID,
+				SampledAt:       sampledAt,
+				AddrUtilization: pool.Utilization,
+				Stats:           pool.Stats,
+				SampleCount:     1,
+			})
+		}
+		for j := range subnet.PrefixPools {
+			pool := &subnet.PrefixPools[j]
+			sums := c.sumPoolStats(subnet, true, getPrefixPoolStatsKey(pool.Prefix, pool.DelegatedLen), []string{"total-pds", "assigned-pds"}, excludedDaemons)
+			if sums == nil {
+				continue
+			}
+			utilization := sums["assigned-pds"].DivideSafeBy(sums["total-pds"])
+			if err := pool.UpdateStatistics(dbi, convertPoolStats(sums), utilization); err != nil {
+				log.Errorf("Cannot update utilization (%.3f) in prefix pool %d: %s", utilization, pool.ID, err)
+				lastErr = err
+				continue
+			}
+			samples = append(samples, &dbmodel.UtilizationSample{
+				PrefixPoolID:  pool.ID,
+				SampledAt:     sampledAt,
+				PdUtilization: pool.Utilization,
+				Stats:         pool.Stats,
+				SampleCount:   1,
+			})
+		}
+	}
+	return samples, lastErr
+}
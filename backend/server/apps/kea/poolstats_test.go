@@ -0,0 +1,309 @@
+package kea
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	keactrl "isc.org/stork/appctrl/kea"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Returns a response to the statistic-get-all command holding the specified
+// statistics. Each statistic holds a single sample.
+func newStatisticGetAllResponse(t *testing.T, stats map[string]int64) *[]StatisticGetAllResponse {
+	arguments := make(map[string][][]json.RawMessage)
+	for name, value := range stats {
+		raw, err := json.Marshal(value)
+		require.NoError(t, err)
+		arguments[name] = [][]json.RawMessage{
+			{raw, json.RawMessage(`"2021-10-14 10:44:18.687247"`)},
+		}
+	}
+	return &[]StatisticGetAllResponse{
+		{
+			ResponseHeader: keactrl.ResponseHeader{
+				Result: keactrl.ResponseSuccess,
+			},
+			Arguments: arguments,
+		},
+	}
+}
+
+// Returns a daemon with the specified configuration used in the pool
+// statistics tests.
+func newTestPoolStatsDaemon(t *testing.T, id int64, config string) *dbmodel.Daemon {
+	cfg, err := dbmodel.NewKeaConfigFromJSON(config)
+	require.NoError(t, err)
+	return &dbmodel.Daemon{
+		ID: id,
+		KeaDaemon: &dbmodel.KeaDaemon{
+			Config: cfg,
+		},
+	}
+}
+
+// Test that the pool statistics are extracted from the response to the
+// statistic-get-all command and the other statistics are ignored.
+func TestPoolStatsCollectorAddResponse(t *testing.T) {
+	collector := newPoolStatsCollector()
+	daemon := newTestPoolStatsDaemon(t, 1, `{
+        "Dhcp6": {
+            "subnet6": [
+                {
+                    "id": 10,
+                    "subnet": "2001:db8:1::/64",
+                    "pools": [
+                        { "pool": "2001:db8:1::10-2001:db8:1::ff" },
+                        { "pool": "2001:db8:1::1:0/112" }
+                    ]
+                },
+                {
+                    "id": 20,
+                    "subnet": "2001:db8:2::/64",
+                    "pd-pools": [
+                        {
+                            "prefix": "3000::",
+                            "prefix-len": 48,
+                            "delegated-len": 64
+                        }
+                    ]
+                }
+            ]
+        }
+    }`)
+
+	response := newStatisticGetAllResponse(t, map[string]int64{
+		"subnet[10].pool[0].total-nas":        240,
+		"subnet[10].pool[0].assigned-nas":     16,
+		"subnet[10].pool[1].total-nas":        65536,
+		"subnet[20].pd-pool[0].total-pds":     65536,
+		"subnet[10].total-nas":                65776,
+		"subnet[10].pool[0].reclaimed-leases": 3,
+		"subnet[10].pool[2].total-nas":        10,
+		"subnet[30].pool[0].total-nas":        10,
+		"pkt6-received":                       100,
+	})
+	err := collector.addResponse(daemon, response)
+	require.NoError(t, err)
+	require.Len(t, collector.stats, 3)
+
+	stats := collector.stats[poolStatsKey{DaemonID: 1, LocalSubnetID: 10, Pool: "2001:db8:1::10-2001:db8:1::ff"}]
+	require.Len(t, stats, 2)
+	require.EqualValues(t, 240, stats["total-nas"].Int64())
+	require.EqualValues(t, 16, stats["assigned-nas"].Int64())
+
+	stats = collector.stats[poolStatsKey{DaemonID: 1, LocalSubnetID: 10, Pool: "2001:db8:1::1:0-2001:db8:1::1:ffff"}]
+	require.Len(t, stats, 1)
+	require.EqualValues(t, 65536, stats["total-nas"].Int64())
+
+	stats = collector.stats[poolStatsKey{DaemonID: 1, LocalSubnetID: 20, PrefixPool: true, Pool: "3000::/48:64"}]
+	require.Len(t, stats, 1)
+	require.EqualValues(t, 65536, stats["total-pds"].Int64())
+}
+
+// Test that the large pool statistics are parsed without losing precision.
+func TestPoolStatsCollectorAddResponseBigValue(t *testing.T) {
+	collector := newPoolStatsCollector()
+	daemon := newTestPoolStatsDaemon(t, 1, `{
+        "Dhcp6": {
+            "subnet6": [
+                {
+                    "id": 1,
+                    "subnet": "2001:db8:1::/64",
+                    "pools": [
+                        { "pool": "2001:db8:1::/64" }
+                    ]
+                }
+            ]
+        }
+    }`)
+
+	response := &[]StatisticGetAllResponse{
+		{
+			Arguments: map[string][][]json.RawMessage{
+				"subnet[1].pool[0].total-nas": {
+					{json.RawMessage("18446744073709551616"), json.RawMessage(`"2021-10-14 10:44:18.687247"`)},
+				},
+			},
+		},
+	}
+	err := collector.addResponse(daemon, response)
+	require.NoError(t, err)
+
+	expected, _ := new(big.Int).SetString("18446744073709551616", 10)
+	stats := collector.stats[poolStatsKey{DaemonID: 1, LocalSubnetID: 1, Pool: "2001:db8:1::-2001:db8:1:0:ffff:ffff:ffff:ffff"}]
+	require.Zero(t, expected.Cmp(stats["total-nas"]))
+}
+
+// Test that an error is returned when the daemon returned an error or
+// an empty response to the statistic-get-all command, or its configuration
+// is unknown.
+func TestPoolStatsCollectorAddResponseError(t *testing.T) {
+	collector := newPoolStatsCollector()
+	daemon := newTestPoolStatsDaemon(t, 1, `{ "Dhcp4": { } }`)
+
+	err := collector.addResponse(daemon, &[]StatisticGetAllResponse{})
+	require.Error(t, err)
+
+	err = collector.addResponse(daemon, &[]StatisticGetAllResponse{
+		{
+			ResponseHeader: keactrl.ResponseHeader{
+				Result: keactrl.ResponseError,
+				Text:   "unable to process",
+			},
+		},
+	})
+	require.ErrorContains(t, err, "unable to process")
+
+	err = collector.addResponse(&dbmodel.Daemon{ID: 2}, newStatisticGetAllResponse(t, map[string]int64{
+		"subnet[10].pool[0].total-addresses": 100,
+	}))
+	require.ErrorContains(t, err, "configuration of daemon 2 is unknown")
+	require.Empty(t, collector.stats)
+}
+
+// Test that the pool statistics returned by the daemons serving the
+// subnet are summed and the excluded daemons are skipped. The daemons
+// specify the pools in a different order.
+func TestPoolStatsCollectorSumPoolStats(t *testing.T) {
+	collector := newPoolStatsCollector()
+
+	err := collector.addResponse(newTestPoolStatsDaemon(t, 1, `{
+        "Dhcp4": {
+            "subnet4": [
+                {
+                    "id": 10,
+                    "subnet": "192.0.2.0/24",
+                    "pools": [
+                        { "pool": "192.0.2.1 - 192.0.2.100" },
+                        { "pool": "192.0.2.150 - 192.0.2.199" }
+                    ]
+                }
+            ]
+        }
+    }`), newStatisticGetAllResponse(t, map[string]int64{
+		"subnet[10].pool[0].total-addresses":    100,
+		"subnet[10].pool[0].assigned-addresses": 10,
+	}))
+	require.NoError(t, err)
+	err = collector.addResponse(newTestPoolStatsDaemon(t, 2, `{
+        "Dhcp4": {
+            "subnet4": [
+                {
+                    "id": 11,
+                    "subnet": "192.0.2.0/24",
+                    "pools": [
+                        { "pool": "192.0.2.150 - 192.0.2.199" },
+                        { "pool": "192.0.2.1 - 192.0.2.100" }
+                    ]
+                }
+            ]
+        }
+    }`), newStatisticGetAllResponse(t, map[string]int64{
+		"subnet[11].pool[0].total-addresses":    50,
+		"subnet[11].pool[0].assigned-addresses": 5,
+		"subnet[11].pool[1].total-addresses":    100,
+		"subnet[11].pool[1].assigned-addresses": 20,
+	}))
+	require.NoError(t, err)
+
+	subnet := &dbmodel.Subnet{
+		ID: 1,
+		LocalSubnets: []*dbmodel.LocalSubnet{
+			{DaemonID: 1, LocalSubnetID: 10},
+			{DaemonID: 2, LocalSubnetID: 11},
+			{DaemonID: 3, LocalSubnetID: 12},
+		},
+	}
+	statNames := []string{"total-addresses", "assigned-addresses", "declined-addresses"}
+	firstPool := getAddressPoolStatsKey("192.0.2.1", "192.0.2.100")
+	secondPool := getAddressPoolStatsKey("192.0.2.150", "192.0.2.199")
+
+	sums := collector.sumPoolStats(subnet, false, firstPool, statNames, map[int64]bool{})
+	require.Len(t, sums, 3)
+	require.EqualValues(t, 200, sums["total-addresses"].ToInt64())
+	require.EqualValues(t, 30, sums["assigned-addresses"].ToInt64())
+	require.Zero(t, sums["declined-addresses"].ToInt64())
+
+	sums = collector.sumPoolStats(subnet, false, firstPool, statNames, map[int64]bool{2: true})
+	require.EqualValues(t, 100, sums["total-addresses"].ToInt64())
+	require.EqualValues(t, 10, sums["assigned-addresses"].ToInt64())
+
+	// The second pool statistics are returned by the second daemon only.
+	sums = collector.sumPoolStats(subnet, false, secondPool, statNames, map[int64]bool{})
+	require.EqualValues(t, 50, sums["total-addresses"].ToInt64())
+	require.EqualValues(t, 5, sums["assigned-addresses"].ToInt64())
+
+	// No statistics for the unknown pool and the prefix pool.
+	require.Nil(t, collector.sumPoolStats(subnet, false, getAddressPoolStatsKey("192.0.2.200", "192.0.2.210"), statNames, map[int64]bool{}))
+	require.Nil(t, collector.sumPoolStats(subnet, true, firstPool, []string{"total-pds"}, map[int64]bool{}))
+}
+
+// Test that the statistics and utilization of the address and prefix
+// pools are stored in the database.
+func TestPoolStatsCollectorUpdatePools(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	dhcp4, dhcp6 := createDhcpConfigs()
+	app := createAppWithSubnets(t, db, 0, dhcp4, dhcp6)
+
+	collector := newPoolStatsCollector()
+	for _, daemon := range app.Daemons {
+		var response *[]StatisticGetAllResponse
+		if daemon.Name == dbmodel.DaemonNameDHCPv4 {
+			response = newStatisticGetAllResponse(t, map[string]int64{
+				"subnet[20].pool[0].total-addresses":    10,
+				"subnet[20].pool[0].assigned-addresses": 4,
+			})
+		} else {
+			response = newStatisticGetAllResponse(t, map[string]int64{
+				"subnet[50].pool[0].total-nas":       1000,
+				"subnet[50].pool[0].assigned-nas":    100,
+				"subnet[50].pd-pool[0].total-pds":    200,
+				"subnet[50].pd-pool[0].assigned-pds": 50,
+			})
+		}
+		err := collector.addResponse(daemon, response)
+		require.NoError(t, err)
+	}
+
+	samples, err := collector.updatePools(db, map[int64]bool{}, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	for _, sample := range samples {
+		require.True(t, (sample.AddressPoolID != 0) != (sample.PrefixPoolID != 0))
+		require.Zero(t, sample.SubnetID)
+	}
+
+	subnets, err := dbmodel.GetAllSubnets(db, 0)
+	require.NoError(t, err)
+
+	var checked int
+	for _, subnet := range subnets {
+		switch subnet.Prefix {
+		case "192.0.3.0/24":
+			require.Len(t, subnet.AddressPools, 1)
+			pool := subnet.AddressPools[0]
+			require.EqualValues(t, 400, pool.Utilization)
+			require.EqualValues(t, 10, pool.Stats["total-addresses"])
+			require.EqualValues(t, 4, pool.Stats["assigned-addresses"])
+			require.NotZero(t, pool.StatsCollectedAt)
+			checked++
+		case "2001:db8:3::/64":
+			require.Len(t, subnet.AddressPools, 1)
+			require.EqualValues(t, 100, subnet.AddressPools[0].Utilization)
+			require.EqualValues(t, 1000, subnet.AddressPools[0].Stats["total-nas"])
+			require.Len(t, subnet.PrefixPools, 1)
+			require.EqualValues(t, 250, subnet.PrefixPools[0].Utilization)
+			require.EqualValues(t, 50, subnet.PrefixPools[0].Stats["assigned-pds"])
+			require.NotZero(t, subnet.PrefixPools[0].StatsCollectedAt)
+			checked++
+		}
+	}
+	require.Equal(t, 2, checked)
+}
@@ -11,11 +11,13 @@ import (
 	keactrl "isc.org/stork/appctrl/kea"
 	"isc.org/stork/server/agentcomm"
 	dbmodel "isc.org/stork/server/database/model"
+	storkutil "isc.org/stork/util"
 )
 
 type StatsPuller struct {
 	*agentcomm.PeriodicPuller
 	*RpsWorker
+	poolStats *poolStatsCollector
 }
 
 // Create a StatsPuller object that in background pulls Kea stats about leases.
@@ -53,6 +55,9 @@ func (statsPuller *StatsPuller) pullStats() error {
 		return err
 	}
 
+	// Pool statistics are collected from all apps before updating the pools.
+	statsPuller.poolStats = newPoolStatsCollector()
+
 	// get lease stats from each kea app
 	var lastErr error
 	appsOkCnt := 0
@@ -117,6 +122,10 @@ func (statsPuller *StatsPuller) pullStats() error {
 	}
 	counter.setExcludedDaemons(excludedDaemons)
 
+	// The samples of the utilization history recorded during this pull.
+	sampledAt := storkutil.UTCNow()
+	var samples []*dbmodel.UtilizationSample
+
 	// go through all Subnets and:
 	// 1) estimate utilization per Subnet and per SharedNetwork
 	// 2) estimate global stats
@@ -133,7 +142,18 @@ func (statsPuller *StatsPuller) pullStats() error {
 				su.GetAddressUtilization(), su.GetDelegatedPrefixUtilization(), sn.ID, err)
 			continue
 		}
+
+		sample := dbmodel.NewUtilizationSample(su, sampledAt)
+		sample.SubnetID = sn.ID
+		samples = append(samples, sample)
+	}
+
+	// pool utilization
+	poolSamples, err := statsPuller.poolStats.updatePools(statsPuller.DB, counter.excludedDaemons, sampledAt)
+	if err != nil {
+		lastErr = err
 	}
+	samples = append(samples, poolSamples...)
 
 	// shared network utilization
 	for sharedNetworkID, u := range counter.sharedNetworks {
@@ -147,6 +167,20 @@ func (statsPuller *StatsPuller) pullStats() error {
 				u.GetAddressUtilization(), u.GetDelegatedPrefixUtilization(), sharedNetworkID, err)
 			continue
 		}
+
+		sample := dbmodel.NewUtilizationSample(u, sampledAt)
+		sample.SharedNetworkID = sharedNetworkID
+		samples = append(samples, sample)
+	}
+
+	// utilization history
+	err = dbmodel.AddUtilizationSamples(statsPuller.DB, samples)
+	if err == nil {
+		err = dbmodel.DownsampleUtilizationSamples(statsPuller.DB, sampledAt)
+	}
+	if err != nil {
+		lastErr = err
+		log.Errorf("Cannot update utilization history: %s", err)
 	}
 
 	// global stats to collect
@@ -272,6 +306,10 @@ func (statsPuller *StatsPuller) getStatsFromApp(dbApp *dbmodel.App) error {
 	cmdDaemons := []*dbmodel.Daemon{}
 	responses := []interface{}{}
 
+	// The commands fetching the pool statistics are sent after the other
+	// commands.
+	poolStatsDaemons := []*dbmodel.Daemon{}
+
 	// Iterate over active daemons, adding commands and response containers
 	// for dhcp4 and dhcp6 daemons.
 	for _, d := range dbApp.Daemons {
@@ -300,6 +338,8 @@ func (statsPuller *StatsPuller) getStatsFromApp(dbApp *dbmodel.App) error {
 					cmdDaemons = append(cmdDaemons, d)
 					responses = append(responses, RpsAddCmd4(&cmds, dhcp4Daemons))
 				}
+
+				poolStatsDaemons = append(poolStatsDaemons, d)
 			case dhcp6:
 
 				// Add daemon, cmd and response for DHCP6 lease stats
@@ -317,10 +357,23 @@ func (statsPuller *StatsPuller) getStatsFromApp(dbApp *dbmodel.App) error {
 					cmdDaemons = append(cmdDaemons, d)
 					responses = append(responses, RpsAddCmd6(&cmds, dhcp6Daemons))
 				}
+
+				poolStatsDaemons = append(poolStatsDaemons, d)
 			}
 		}
 	}
 
+	// Add daemon, cmd and response for the pool stats. Kea returns the pool
+	// stats only in response to the statistic-get-all command.
+	for _, d := range poolStatsDaemons {
+		cmdDaemons = append(cmdDaemons, d)
+		cmds = append(cmds, &keactrl.Command{
+			Command: "statistic-get-all",
+			Daemons: []string{d.Name},
+		})
+		responses = append(responses, &[]StatisticGetAllResponse{})
+	}
+
 	// If there are no commands, nothing to do
 	if len(cmds) == 0 {
 		return nil
@@ -365,6 +418,17 @@ func (statsPuller *StatsPuller) processAppResponses(dbApp *dbmodel.App, cmds []*
 
 	var lastErr error
 	for idx := 0; idx < len(cmds); idx++ {
+		if cmds[idx].Command == "statistic-get-all" {
+			// The pool stats are not supported by older Kea versions, so
+			// the problems with them are not considered errors.
+			if statsPuller.poolStats != nil {
+				err = statsPuller.poolStats.addResponse(cmdDaemons[idx], responses[idx])
+				if err != nil {
+					log.Warnf("Problem handling statistic-get-all response: %+v", err)
+				}
+			}
+			continue
+		}
 		switch cmdDaemons[idx].Name {
 		case dhcp4:
 			switch cmds[idx].Command {
@@ -5,6 +5,7 @@ import (
 	"math"
 	"math/big"
 	"testing"
+	"time"
 
 	"github.com/go-pg/pg/v10"
 	"github.com/stretchr/testify/require"
@@ -477,6 +478,14 @@ func checkStatsPullerPullStats(t *testing.T, statsFormat string) {
 	subnets, _ := dbmodel.GetAllSubnets(db, 0)
 
 	for _, sn := range subnets {
+		// The utilization should be recorded in the history.
+		history, err := dbmodel.GetSubnetUtilizationHistory(db, sn.ID, time.Time{}, time.Now().UTC(), 0)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		require.Equal(t, sn.AddrUtilization, history[0].AddrUtilization)
+		require.Equal(t, sn.PdUtilization, history[0].PdUtilization)
+		require.EqualValues(t, 1, history[0].SampleCount)
+
 		switch sn.LocalSubnets[0].LocalSubnetID {
 		case 10:
 			require.InDelta(t, 111.0/256.0, float64(sn.AddrUtilization)/1000.0, 0.001)
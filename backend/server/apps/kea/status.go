@@ -10,6 +10,7 @@ import (
 	"isc.org/stork/server/agentcomm"
 	dbops "isc.org/stork/server/database"
 	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/eventcenter"
 	storkutil "isc.org/stork/util"
 )
 
@@ -85,14 +86,18 @@ type appStatus []daemonStatus
 
 // Instance of the puller which periodically checks the status of the Kea apps.
 // Besides basic status information the High Availability status is fetched.
+// The puller raises an event when it detects a failover.
 type HAStatusPuller struct {
 	*agentcomm.PeriodicPuller
+	EventCenter eventcenter.EventCenter
 }
 
 // Create an instance of the puller which periodically checks the status of
 // the Kea apps.
-func NewHAStatusPuller(db *dbops.PgDB, agents agentcomm.ConnectedAgents) (*HAStatusPuller, error) {
-	puller := &HAStatusPuller{}
+func NewHAStatusPuller(db *dbops.PgDB, agents agentcomm.ConnectedAgents, eventCenter eventcenter.EventCenter) (*HAStatusPuller, error) {
+	puller := &HAStatusPuller{
+		EventCenter: eventCenter,
+	}
 	periodicPuller, err := agentcomm.NewPeriodicPuller(db, agents, "Kea Status puller",
 		"kea_status_puller_interval", puller.pullData)
 	if err != nil {
@@ -279,10 +284,16 @@ func (puller *HAStatusPuller) pullDataForApp(app *dbmodel.App) (bool, bool) {
 	// command. These values will indicate that we can't say what is happening
 	// with the server we failed to connect to.
 	var haServices []dbmodel.Service
+	previousStates := make(map[*dbmodel.BaseHAService][2]dbmodel.HAState)
 	for j := range dbServices {
 		if dbServices[j].HAService == nil {
 			continue
 		}
+		// Remember the states to detect the failover.
+		previousStates[dbServices[j].HAService] = [2]dbmodel.HAState{
+			dbServices[j].HAService.PrimaryLastState,
+			dbServices[j].HAService.SecondaryLastState,
+		}
 		for _, d := range app.Daemons {
 			switch d.ID {
 			case dbServices[j].HAService.PrimaryID:
@@ -342,12 +353,49 @@ func (puller *HAStatusPuller) pullDataForApp(app *dbmodel.App) (bool, bool) {
 		}
 	}
 
+	puller.raiseFailoverEvents(app, previousStates)
+
 	// Update the services as appropriate regardless if we successfully communicated
 	// with the servers or not.
 	puller.commitHAServicesStatus(app.ID, haServices)
 	return true, true
 }
 
+// Raises a warning event for each server of the app's HA services which
+// has transitioned to the partner-down state, i.e. has taken over the
+// responsibilities of its partner.
+func (puller *HAStatusPuller) raiseFailoverEvents(app *dbmodel.App, previousStates map[*dbmodel.BaseHAService][2]dbmodel.HAState) {
+	if puller.EventCenter == nil {
+		return
+	}
+	for service, states := range previousStates {
+		var daemon *dbmodel.Daemon
+		for _, d := range app.Daemons {
+			if d.ID == service.PrimaryID || d.ID == service.SecondaryID {
+				daemon = d
+				break
+			}
+		}
+		if daemon == nil {
+			continue
+		}
+		roles := []struct {
+			name          string
+			previousState dbmodel.HAState
+			state         dbmodel.HAState
+		}{
+			{"primary", states[0], service.PrimaryLastState},
+			{"secondary", states[1], service.SecondaryLastState},
+		}
+		for _, role := range roles {
+			if role.state == dbmodel.HAStatePartnerDown && role.previousState != dbmodel.HAStatePartnerDown {
+				text := fmt.Sprintf("HA failover detected for {daemon}: the %s server is in the partner-down state", role.name)
+				puller.EventCenter.AddWarningEvent(text, daemon, app, app.Machine)
+			}
+		}
+	}
+}
+
 // Sends the status-get command to Kea DHCP servers and returns this status to the caller.
 func getDHCPStatus(ctx context.Context, agents agentcomm.ConnectedAgents, dbApp *dbmodel.App) (appStatus, error) {
 	// This command is only sent to the DHCP daemons.
@@ -2,6 +2,7 @@ package kea
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -498,7 +499,7 @@ func TestNewHAStatusPuller(t *testing.T) {
 	err := dbmodel.InitializeSettings(db, 0)
 	require.NoError(t, err)
 
-	puller, err := NewHAStatusPuller(db, nil)
+	puller, err := NewHAStatusPuller(db, nil, nil)
 	require.NoError(t, err)
 	require.NotNil(t, puller)
 	defer puller.Shutdown()
@@ -574,7 +575,7 @@ func testPullHAStatus(t *testing.T, version178 bool) {
 	}
 
 	// Create the puller which normally fetches the HA status periodically.
-	puller, err := NewHAStatusPuller(db, fa)
+	puller, err := NewHAStatusPuller(db, fa, fec)
 	require.NoError(t, err)
 	require.NotNil(t, puller)
 
@@ -650,10 +651,27 @@ func testPullHAStatus(t *testing.T, version178 bool) {
 		require.EqualValues(t, 15, service.HAService.PrimaryAnalyzedPackets)
 	}
 
+	// No failover has been detected so far.
+	countFailoverEvents := func() (count int) {
+		for _, event := range fec.Events {
+			if strings.Contains(event.Text, "HA failover detected") {
+				require.EqualValues(t, dbmodel.EvWarning, event.Level)
+				require.Contains(t, event.Text, "the primary server is in the partner-down state")
+				count++
+			}
+		}
+		return
+	}
+	require.Zero(t, countFailoverEvents())
+
 	// Pull the data again.
 	err = puller.pullData()
 	require.NoError(t, err)
 
+	// The primary server of the DHCPv4 service is now in the partner-down
+	// state.
+	require.EqualValues(t, 1, countFailoverEvents())
+
 	// There should still be two services, one for DHCPv4 and one for DHCPv6.
 	services, err = dbmodel.GetDetailedAllServices(db)
 	require.NoError(t, err)
@@ -14,6 +14,7 @@ import (
 	"isc.org/stork/server/agentcomm"
 	"isc.org/stork/server/apps/kea"
 	"isc.org/stork/server/config"
+	"isc.org/stork/server/configreview"
 	dbmodel "isc.org/stork/server/database/model"
 )
 
@@ -42,6 +43,9 @@ type configManagerImpl struct {
 	// Interface to the instance providing functions to search for
 	// option definitions.
 	lookup keaconfig.DHCPOptionDefinitionLookup
+	// Interface to the dispatcher running configuration reviews after
+	// committing the configuration changes.
+	reviewDispatcher configreview.Dispatcher
 	// Holds contexts for present transactions. The unique context
 	// identifier exchanged between the server and the client is a
 	// key of this map.
@@ -159,12 +163,13 @@ func (manager *configManagerImpl) unlock(ctx context.Context) {
 // instance of the Stork Server holding the state.).
 func NewManager(server config.ManagerAccessors) config.Manager {
 	manager := &configManagerImpl{
-		db:       server.GetDB(),
-		agents:   server.GetConnectedAgents(),
-		lookup:   server.GetDHCPOptionDefinitionLookup(),
-		contexts: make(map[int64]contextPair),
-		locks:    make(map[int64]configLock),
-		mutex:    &sync.RWMutex{},
+		db:               server.GetDB(),
+		agents:           server.GetConnectedAgents(),
+		lookup:           server.GetDHCPOptionDefinitionLookup(),
+		reviewDispatcher: server.GetReviewDispatcher(),
+		contexts:         make(map[int64]contextPair),
+		locks:            make(map[int64]configLock),
+		mutex:            &sync.RWMutex{},
 	}
 	keaConfigModule := kea.NewConfigModule(manager)
 	manager.kea = keaConfigModule
@@ -189,6 +194,11 @@ func (manager *configManagerImpl) GetDHCPOptionDefinitionLookup() keaconfig.DHCP
 	return manager.lookup
 }
 
+// Returns an interface to the dispatcher running configuration reviews.
+func (manager *configManagerImpl) GetReviewDispatcher() configreview.Dispatcher {
+	return manager.reviewDispatcher
+}
+
 // Returns Kea configuration module of the configuration manager.
 func (manager *configManagerImpl) GetKeaModule() config.KeaModule {
 	return manager.kea
@@ -305,6 +315,46 @@ func (manager *configManagerImpl) Lock(ctx context.Context, daemonIDs ...int64)
 	return ctx, nil
 }
 
+// Attempts to lock configurations of additional daemons with the lock key
+// already stored in the context. It is used when the daemons affected by
+// the configuration change are only known after the change is applied.
+// The daemons already locked with this context are skipped. If an attempt
+// to lock any of the configurations fails, it will remove the locks
+// acquired by this call and return an error. The previously acquired
+// locks are preserved.
+func (manager *configManagerImpl) LockMore(ctx context.Context, daemonIDs ...int64) (context.Context, error) {
+	if _, ok := ctx.Value(config.LockContextKey).(config.LockKey); !ok {
+		return manager.Lock(ctx, daemonIDs...)
+	}
+	lockedIDs, _ := ctx.Value(config.DaemonsContextKey).([]int64)
+	locked := make(map[int64]bool)
+	for _, id := range lockedIDs {
+		locked[id] = true
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	var newIDs []int64
+	for _, id := range daemonIDs {
+		if locked[id] {
+			continue
+		}
+		if err := manager.lock(ctx, id); err != nil {
+			// Locking failed. Remove the locks applied by this call.
+			for _, uid := range newIDs {
+				manager.unlockDaemon(ctx, uid)
+			}
+			return ctx, err
+		}
+		locked[id] = true
+		newIDs = append(newIDs, id)
+	}
+	if len(newIDs) > 0 {
+		daemonIDs := append(append([]int64{}, lockedIDs...), newIDs...)
+		ctx = context.WithValue(ctx, config.DaemonsContextKey, daemonIDs)
+	}
+	return ctx, nil
+}
+
 // Removes locks from the specified daemons' configurations if the
 // key stored in the context matches.
 func (manager *configManagerImpl) Unlock(ctx context.Context) {
@@ -353,7 +403,8 @@ func (manager *configManagerImpl) Commit(ctx context.Context) (context.Context,
 }
 
 // Commit all configuration changes in the database which are due, i.e. for which
-// the deadline_at time expired.
+// the deadline_at time expired. The changes pending approval or rejected are
+// not committed.
 func (manager *configManagerImpl) CommitDue() error {
 	// Get due configuration changes.
 	changes, err := dbmodel.GetDueConfigChanges(manager.GetDB())
@@ -397,6 +448,9 @@ func (manager *configManagerImpl) CommitDue() error {
 
 // Schedules sending the changes queued in the context to one or multiple daemons.
 // The deadline parameter specifies the time when the changes should be committed.
+// If the config_change_required_approvals setting is greater than zero, the
+// scheduled change awaits the approvals of other users and it is not committed
+// until it gathers the required number of approvals.
 func (manager *configManagerImpl) Schedule(ctx context.Context, deadline time.Time) (context.Context, error) {
 	state, ok := config.GetTransactionState(ctx)
 	if !ok {
@@ -406,11 +460,23 @@ func (manager *configManagerImpl) Schedule(ctx context.Context, deadline time.Ti
 	if !ok {
 		return ctx, pkgerrors.Errorf("context lacks user key")
 	}
+	// The config change must be approved by the specified number of users
+	// before it is committed.
+	requiredApprovals, err := dbmodel.GetSettingInt(manager.db, "config_change_required_approvals")
+	if err != nil {
+		return ctx, err
+	}
+	approvalStatus := dbmodel.ScheduledConfigChangeApprovalApproved
+	if requiredApprovals > 0 {
+		approvalStatus = dbmodel.ScheduledConfigChangeApprovalPending
+	}
 	// Create the config change entry in the database.
 	scc := &dbmodel.ScheduledConfigChange{
-		DeadlineAt: deadline,
-		UserID:     userID,
-		Updates:    state.Updates,
+		DeadlineAt:        deadline,
+		UserID:            userID,
+		Updates:           state.Updates,
+		ApprovalStatus:    approvalStatus,
+		RequiredApprovals: requiredApprovals,
 	}
 	if err := dbmodel.AddScheduledConfigChange(manager.db, scc); err != nil {
 		return ctx, err
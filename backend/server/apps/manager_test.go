@@ -602,6 +602,10 @@ func TestSchedule(t *testing.T) {
 	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
 	defer teardown()
 
+	// The settings hold the number of required approvals.
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
 	manager := NewManager(&appstest.ManagerAccessorsWrapper{
 		DB: db,
 	})
@@ -676,6 +680,7 @@ func TestSchedule(t *testing.T) {
 	require.Equal(t, "kea", changes[0].Updates[0].Target)
 	require.Equal(t, "host_add", changes[0].Updates[0].Operation)
 	require.NotNil(t, changes[0].Updates[0].Recipe)
+	require.Equal(t, dbmodel.ScheduledConfigChangeApprovalApproved, changes[0].ApprovalStatus)
 
 	// Make sure the app information was retrieved.
 	require.Contains(t, changes[0].Updates[0].Recipe, "app")
@@ -709,3 +714,113 @@ func TestSchedule(t *testing.T) {
 	require.EqualValues(t, 1, tags[1].GetAppID())
 	require.Equal(t, dbmodel.AppTypeKea, tags[1].GetAppType())
 }
+
+// Test that the scheduled config change awaits approvals when they are
+// required and that it is not committed until it is approved.
+func TestScheduleRequiringApprovals(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+	err = dbmodel.SetSettingInt(db, "config_change_required_approvals", 1)
+	require.NoError(t, err)
+
+	// Create the users scheduling and approving the change.
+	var users []*dbmodel.SystemUser
+	for _, login := range []string{"owner", "approver"} {
+		user := &dbmodel.SystemUser{
+			Login:    login,
+			Lastname: "test",
+			Name:     "test",
+			Password: "test",
+		}
+		_, err = dbmodel.CreateUser(db, user)
+		require.NoError(t, err)
+		users = append(users, user)
+	}
+
+	manager := NewManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	require.NotNil(t, manager)
+
+	impl := manager.(*configManagerImpl)
+	fkm := newFakeKeaModuleCommit()
+	impl.keaCommit = fkm
+
+	ctx, err := manager.CreateContext(int64(users[0].ID))
+	require.NoError(t, err)
+	state := config.TransactionState{
+		Updates: []*config.Update{
+			config.NewUpdate("kea", "host_add"),
+		},
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, state)
+
+	// Schedule the change with the deadline in the past.
+	_, err = manager.Schedule(ctx, storkutil.UTCNow().Add(-time.Second*10))
+	require.NoError(t, err)
+
+	changes, err := dbmodel.GetScheduledConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, dbmodel.ScheduledConfigChangeApprovalPending, changes[0].ApprovalStatus)
+	require.EqualValues(t, 1, changes[0].RequiredApprovals)
+
+	// The change hasn't been approved so it should not be committed.
+	err = manager.CommitDue()
+	require.NoError(t, err)
+	require.Empty(t, fkm.ops)
+
+	// Approve the change and commit it.
+	err = dbmodel.AddScheduledConfigChangeReview(db, &dbmodel.ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: changes[0].ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                dbmodel.ScheduledConfigChangeReviewApprove,
+	})
+	require.NoError(t, err)
+
+	err = manager.CommitDue()
+	require.NoError(t, err)
+	require.Len(t, fkm.ops, 1)
+}
+
+// Test that the configurations of additional daemons can be locked with
+// the lock already held in the context.
+func TestLockMore(t *testing.T) {
+	manager := NewManager(&appstest.ManagerAccessorsWrapper{})
+	require.NotNil(t, manager)
+
+	ctx1, err := manager.CreateContext(123)
+	require.NoError(t, err)
+	ctx1, err = manager.Lock(ctx1, 1, 2)
+	require.NoError(t, err)
+
+	// Another user locks daemon 4.
+	ctx2, err := manager.CreateContext(234)
+	require.NoError(t, err)
+	ctx2, err = manager.Lock(ctx2, 4)
+	require.NoError(t, err)
+
+	// The daemons already locked by the first user are skipped.
+	ctx1, err = manager.LockMore(ctx1, 2, 3)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 2, 3}, ctx1.Value(config.DaemonsContextKey))
+
+	// Locking the daemon locked by another user fails. The locks acquired
+	// by this call are released and the previous locks are preserved.
+	_, err = manager.LockMore(ctx1, 5, 4)
+	require.Error(t, err)
+	_, err = manager.Lock(ctx2, 5)
+	require.NoError(t, err)
+	_, err = manager.Lock(ctx2, 3)
+	require.Error(t, err)
+
+	// All daemons locked by the first user are unlocked together.
+	manager.Unlock(ctx1)
+	for _, id := range []int64{1, 2, 3} {
+		_, err = manager.Lock(ctx2, id)
+		require.NoError(t, err)
+	}
+}
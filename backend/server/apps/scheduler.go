@@ -0,0 +1,107 @@
+package apps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"isc.org/stork/server/config"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+)
+
+const (
+	// Maximum time between the checks for the due config changes. The
+	// scheduler checks the changes periodically even when it is not woken
+	// up, so the changes modified without waking it up are committed too.
+	configChangeSchedulerMaxInterval = time.Minute
+	// Minimum time between the checks for the due config changes. It
+	// prevents from busy looping when the due changes can't be committed.
+	configChangeSchedulerMinInterval = time.Second
+)
+
+// Commits the scheduled config changes when their deadlines expire. It
+// sleeps until the deadline of the nearest approved config change. It
+// should be woken up when the scheduled config changes are added,
+// approved or rescheduled, so it can recalculate the wake-up time.
+type ConfigChangeScheduler struct {
+	db      *dbops.PgDB
+	manager config.Manager
+	wakeup  chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      *sync.WaitGroup
+}
+
+// Creates the scheduler and starts committing the scheduled config
+// changes with the specified config manager.
+func NewConfigChangeScheduler(db *dbops.PgDB, manager config.Manager) *ConfigChangeScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler := &ConfigChangeScheduler{
+		db:      db,
+		manager: manager,
+		wakeup:  make(chan struct{}, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		wg:      &sync.WaitGroup{},
+	}
+	scheduler.wg.Add(1)
+	go scheduler.mainLoop()
+	return scheduler
+}
+
+// Wakes up the scheduler to commit the due config changes and to
+// recalculate the time of committing the next change. It doesn't block.
+func (scheduler *ConfigChangeScheduler) Wake() {
+	select {
+	case scheduler.wakeup <- struct{}{}:
+	default:
+		// The scheduler has already been woken up.
+	}
+}
+
+// Stops committing the scheduled config changes.
+func (scheduler *ConfigChangeScheduler) Shutdown() {
+	scheduler.cancel()
+	scheduler.wg.Wait()
+}
+
+// Returns the time to wait until the next scheduled config change is
+// due. It is limited to the minimum and maximum interval between the
+// checks.
+func (scheduler *ConfigChangeScheduler) getWaitTime() time.Duration {
+	duration, exists, err := dbmodel.GetTimeToNextScheduledConfigChange(scheduler.db)
+	if err != nil {
+		log.Errorf("Problem getting time to the next scheduled config change: %+v", err)
+		return configChangeSchedulerMaxInterval
+	}
+	switch {
+	case !exists || duration > configChangeSchedulerMaxInterval:
+		return configChangeSchedulerMaxInterval
+	case duration < configChangeSchedulerMinInterval:
+		return configChangeSchedulerMinInterval
+	default:
+		return duration
+	}
+}
+
+// Commits the due config changes and waits for the next change until
+// the scheduler is stopped.
+func (scheduler *ConfigChangeScheduler) mainLoop() {
+	defer scheduler.wg.Done()
+	for {
+		if err := scheduler.manager.CommitDue(); err != nil {
+			log.Errorf("Problem committing scheduled config changes: %+v", err)
+		}
+		timer := time.NewTimer(scheduler.getWaitTime())
+		select {
+		case <-scheduler.ctx.Done():
+			timer.Stop()
+			return
+		case <-scheduler.wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
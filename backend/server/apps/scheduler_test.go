@@ -0,0 +1,63 @@
+package apps
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	appstest "isc.org/stork/server/apps/test"
+	"isc.org/stork/server/config"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	storkutil "isc.org/stork/util"
+)
+
+// Test that the scheduler commits the scheduled config change when its
+// deadline expires.
+func TestConfigChangeSchedulerCommitsDueChange(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	user := &dbmodel.SystemUser{
+		Login:    "owner",
+		Lastname: "test",
+		Name:     "test",
+		Password: "test",
+	}
+	_, err = dbmodel.CreateUser(db, user)
+	require.NoError(t, err)
+
+	manager := NewManager(&appstest.ManagerAccessorsWrapper{
+		DB: db,
+	})
+	manager.(*configManagerImpl).keaCommit = newFakeKeaModuleCommit()
+
+	scheduler := NewConfigChangeScheduler(db, manager)
+	defer scheduler.Shutdown()
+
+	ctx, err := manager.CreateContext(int64(user.ID))
+	require.NoError(t, err)
+	state := config.TransactionState{
+		Updates: []*config.Update{
+			config.NewUpdate("kea", "config_rollback"),
+		},
+	}
+	ctx = context.WithValue(ctx, config.StateContextKey, state)
+
+	_, err = manager.Schedule(ctx, storkutil.UTCNow().Add(time.Second))
+	require.NoError(t, err)
+	scheduler.Wake()
+
+	changes, err := dbmodel.GetScheduledConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	require.Eventually(t, func() bool {
+		change, err := dbmodel.GetScheduledConfigChange(db, changes[0].ID)
+		return err == nil && change != nil && change.Executed
+	}, 5*time.Second, 100*time.Millisecond)
+}
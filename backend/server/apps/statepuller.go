@@ -16,6 +16,30 @@ import (
 	"isc.org/stork/server/eventcenter"
 )
 
+// Type of the context key holding the source of the configuration snapshots.
+type configSnapshotSourceKeyType int
+
+// Context key holding the source of the configuration snapshots taken
+// while getting the state of the machines and their apps.
+const configSnapshotSourceKey configSnapshotSourceKeyType = 0
+
+// Returns a copy of the context holding the source of the configuration
+// snapshots. The GetMachineAndAppsState function takes the snapshots of
+// the modified Kea configurations and records this source in them.
+func WithConfigSnapshotSource(ctx context.Context, source dbmodel.ConfigSnapshotSource) context.Context {
+	return context.WithValue(ctx, configSnapshotSourceKey, source)
+}
+
+// Returns the source of the configuration snapshots held in the context.
+// If the context lacks the source, it is assumed that the state is fetched
+// on user's request.
+func getConfigSnapshotSource(ctx context.Context) dbmodel.ConfigSnapshotSource {
+	if source, ok := ctx.Value(configSnapshotSourceKey).(dbmodel.ConfigSnapshotSource); ok {
+		return source
+	}
+	return dbmodel.ConfigSnapshotSourceUserRequest
+}
+
 // Instance of the puller which periodically checks the status of the Kea apps.
 // Besides basic status information the High Availability status is fetched.
 type StatePuller struct {
@@ -61,7 +85,7 @@ func (puller *StatePuller) pullData() error {
 	okCnt := 0
 	for _, dbM := range dbMachines {
 		dbM2 := dbM
-		ctx := context.Background()
+		ctx := WithConfigSnapshotSource(context.Background(), dbmodel.ConfigSnapshotSourceStatePuller)
 		errStr := GetMachineAndAppsState(ctx, puller.DB, &dbM2, puller.Agents, puller.EventCenter, puller.ReviewDispatcher, puller.DHCPOptionDefinitionLookup)
 		if errStr != "" {
 			lastErr = errors.New(errStr)
@@ -275,6 +299,8 @@ func GetMachineAndAppsState(ctx context.Context, db *dbops.PgDB, dbMachine *dbmo
 			state := kea.GetAppState(ctx2, agents, dbApp, eventCenter)
 			err = kea.CommitAppIntoDB(db, dbApp, eventCenter, state, lookup)
 			if err == nil {
+				// Record the history of the daemons' configurations.
+				conditionallyAddKeaConfigSnapshots(db, dbApp, state, getConfigSnapshotSource(ctx))
 				// Let's now identify new daemons or the daemons with updated
 				// configurations and schedule configuration reviews for them
 				conditionallyBeginKeaConfigReviews(dbApp, state, reviewDispatcher)
@@ -299,6 +325,24 @@ func GetMachineAndAppsState(ctx context.Context, db *dbops.PgDB, dbMachine *dbmo
 	return ""
 }
 
+// This function iterates over the app's daemons and takes the snapshots of
+// their configurations if they have changed since the last snapshot. The
+// daemons whose configurations haven't changed since the last state pull
+// are skipped. The errors are logged but they don't interrupt the pull.
+func conditionallyAddKeaConfigSnapshots(db *dbops.PgDB, dbApp *dbmodel.App, state *kea.AppStateMeta, source dbmodel.ConfigSnapshotSource) {
+	for _, daemon := range dbApp.Daemons {
+		if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+			continue
+		}
+		if state != nil && state.SameConfigDaemons != nil && state.SameConfigDaemons[daemon.Name] {
+			continue
+		}
+		if _, err := dbmodel.AddConfigSnapshotIfChanged(db, daemon, source); err != nil {
+			log.WithError(err).Errorf("Cannot store configuration snapshot for daemon %d", daemon.ID)
+		}
+	}
+}
+
 // This function iterates over the app's daemons and checks if a new config
 // review should be performed. It is performed when daemon's configuration
 // or dispatcher's signature has changed.
@@ -1,6 +1,7 @@
 package apps
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -140,6 +141,16 @@ func TestStatePullerPullData(t *testing.T) {
 	require.Equal(t, "BeginReview", fd.CallLog[0].CallName)
 }
 
+// Test that the source of the configuration snapshots is held in the context.
+func TestConfigSnapshotSourceContext(t *testing.T) {
+	// By default, the state is fetched on user's request.
+	ctx := context.Background()
+	require.Equal(t, dbmodel.ConfigSnapshotSourceUserRequest, getConfigSnapshotSource(ctx))
+
+	ctx = WithConfigSnapshotSource(ctx, dbmodel.ConfigSnapshotSourceStatePuller)
+	require.Equal(t, dbmodel.ConfigSnapshotSourceStatePuller, getConfigSnapshotSource(ctx))
+}
+
 // Check appCompare.
 func TestAppCompare(t *testing.T) {
 	// no access points so not equal
@@ -4,13 +4,15 @@ import (
 	"github.com/go-pg/pg/v10"
 	keaconfig "isc.org/stork/appcfg/kea"
 	agentcomm "isc.org/stork/server/agentcomm"
+	"isc.org/stork/server/configreview"
 )
 
 // Implements ManagerAccessors interface for unit tests.
 type ManagerAccessorsWrapper struct {
-	DB        *pg.DB
-	Agents    agentcomm.ConnectedAgents
-	DefLookup keaconfig.DHCPOptionDefinitionLookup
+	DB               *pg.DB
+	Agents           agentcomm.ConnectedAgents
+	DefLookup        keaconfig.DHCPOptionDefinitionLookup
+	ReviewDispatcher configreview.Dispatcher
 }
 
 // Returns an instance of the database handler used by the configuration manager.
@@ -28,3 +30,8 @@ func (w ManagerAccessorsWrapper) GetConnectedAgents() agentcomm.ConnectedAgents
 func (w ManagerAccessorsWrapper) GetDHCPOptionDefinitionLookup() keaconfig.DHCPOptionDefinitionLookup {
 	return w.DefLookup
 }
+
+// Returns an interface to the dispatcher running configuration reviews.
+func (w ManagerAccessorsWrapper) GetReviewDispatcher() configreview.Dispatcher {
+	return w.ReviewDispatcher
+}
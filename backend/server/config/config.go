@@ -9,6 +9,7 @@ import (
 	pkgerrors "github.com/pkg/errors"
 	keaconfig "isc.org/stork/appcfg/kea"
 	agentcomm "isc.org/stork/server/agentcomm"
+	"isc.org/stork/server/configreview"
 	dbmodel "isc.org/stork/server/database/model"
 )
 
@@ -33,10 +34,27 @@ type LockKey int64
 type KeaModule interface {
 	BeginHostAdd(context.Context) (context.Context, error)
 	ApplyHostAdd(context.Context, *dbmodel.Host) (context.Context, error)
+	ApplyHostsAdd(context.Context, []*dbmodel.Host) (context.Context, error)
 	BeginHostUpdate(context.Context, int64) (context.Context, error)
 	ApplyHostUpdate(context.Context, *dbmodel.Host) (context.Context, error)
 	BeginHostDelete(context.Context) (context.Context, error)
 	ApplyHostDelete(context.Context, *dbmodel.Host) (context.Context, error)
+	BeginSubnetAdd(context.Context) (context.Context, error)
+	ApplySubnetAdd(context.Context, *dbmodel.Subnet) (context.Context, error)
+	BeginSubnetUpdate(context.Context, int64) (context.Context, error)
+	ApplySubnetUpdate(context.Context, *dbmodel.Subnet) (context.Context, error)
+	BeginSubnetDelete(context.Context) (context.Context, error)
+	ApplySubnetDelete(context.Context, *dbmodel.Subnet) (context.Context, error)
+	BeginSharedNetworkAdd(context.Context) (context.Context, error)
+	ApplySharedNetworkAdd(context.Context, *dbmodel.SharedNetwork, map[string]any) (context.Context, error)
+	BeginSharedNetworkUpdate(context.Context, int64) (context.Context, error)
+	ApplySharedNetworkUpdate(context.Context, *dbmodel.SharedNetwork, map[string]any) (context.Context, error)
+	BeginGlobalParametersUpdate(context.Context, []int64) (context.Context, error)
+	ApplyGlobalParametersUpdate(context.Context, map[string]any) (context.Context, error)
+	BeginConfigRollback(context.Context, int64) (context.Context, error)
+	ApplyConfigRollback(context.Context, *dbmodel.ConfigSnapshot) (context.Context, error)
+	BeginHostsMigration(context.Context, int64) (context.Context, error)
+	ApplyHostsMigration(context.Context) (context.Context, int64, error)
 }
 
 // Interface of the Kea configuration module used by the manager to
@@ -76,6 +94,9 @@ type ManagerAccessors interface {
 	// Returns an interface to the instance providing the DHCP option definition
 	// lookup logic.
 	GetDHCPOptionDefinitionLookup() keaconfig.DHCPOptionDefinitionLookup
+	// Returns an interface to the dispatcher running configuration reviews
+	// after the configuration changes.
+	GetReviewDispatcher() configreview.Dispatcher
 }
 
 // Configuration manager interface exposing functions available to the
@@ -89,6 +110,9 @@ type ModuleManager interface {
 type ManagerLocker interface {
 	// Locks the daemons' configurations for update.
 	Lock(context.Context, ...int64) (context.Context, error)
+	// Locks the configurations of additional daemons using the lock key
+	// already held in the context.
+	LockMore(context.Context, ...int64) (context.Context, error)
 	// Unlocks the daemons' configurations.
 	Unlock(context.Context)
 }
@@ -136,7 +160,16 @@ func (state *TransactionState) GetValueForUpdate(updateIndex int, valueName stri
 }
 
 // Decodes data stored as a map in the context/transaction into a custom structure.
+// The time values are converted from strings because they are serialized this
+// way when the transaction is scheduled.
 func DecodeContextData(input interface{}, output interface{}) error {
-	err := mapstructure.Decode(input, output)
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
+		Result:     output,
+	})
+	if err != nil {
+		return pkgerrors.WithStack(err)
+	}
+	err = decoder.Decode(input)
 	return pkgerrors.WithStack(err)
 }
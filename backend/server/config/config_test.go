@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -81,3 +82,17 @@ func TestDecodeContextData(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "bar", output.Foo)
 }
+
+// Test that the DecodeContextData converts the time values serialized
+// as strings.
+func TestDecodeContextDataTime(t *testing.T) {
+	input := map[string]interface{}{
+		"createdAt": "2022-09-17T11:12:13Z",
+	}
+	output := struct {
+		CreatedAt time.Time
+	}{}
+	err := DecodeContextData(input, &output)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 9, 17, 11, 12, 13, 0, time.UTC), output.CreatedAt)
+}
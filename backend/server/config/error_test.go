@@ -12,6 +12,24 @@ func TestHostNotFoundError(t *testing.T) {
 	require.EqualError(t, err, "host with ID 123 not found")
 }
 
+// Test creation of an error which indicates that subnet was not found.
+func TestSubnetNotFoundError(t *testing.T) {
+	err := NewSubnetNotFoundError(123)
+	require.EqualError(t, err, "subnet with ID 123 not found")
+}
+
+// Test creation of an error which indicates that shared network was not found.
+func TestSharedNetworkNotFoundError(t *testing.T) {
+	err := NewSharedNetworkNotFoundError(123)
+	require.EqualError(t, err, "shared network with ID 123 not found")
+}
+
+// Test creation of an error which indicates that the daemon is not found.
+func TestDaemonNotFoundError(t *testing.T) {
+	err := NewDaemonNotFoundError(123)
+	require.EqualError(t, err, "daemon with ID 123 not found")
+}
+
 // Test creation of an error which indicates a problem with locking
 // configuration.
 func TestLockError(t *testing.T) {
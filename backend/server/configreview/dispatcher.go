@@ -108,6 +108,20 @@ func newReviewContext(db *dbops.PgDB, daemon *dbmodel.Daemon, trigger Trigger, c
 	return ctx
 }
 
+// Adds the daemon to the daemons referenced in the review unless it is
+// the subject daemon or it has been already added.
+func (c *ReviewContext) addRefDaemon(daemon *dbmodel.Daemon) {
+	if daemon.ID == c.subjectDaemon.ID {
+		return
+	}
+	for _, refDaemon := range c.refDaemons {
+		if refDaemon.ID == daemon.ID {
+			return
+		}
+	}
+	c.refDaemons = append(c.refDaemons, daemon)
+}
+
 // Returns a number of the generated reports.
 func (c *ReviewContext) getReportsCount() int {
 	return len(c.reports)
@@ -901,6 +915,7 @@ func RegisterDefaultCheckers(dispatcher Dispatcher) {
 	dispatcher.RegisterChecker(KeaDHCPDaemon, "out_of_pool_reservation", ExtendDefaultTriggers(DBHostsModified), reservationsOutOfPool)
 	dispatcher.RegisterChecker(KeaDHCPDaemon, "overlapping_subnet", GetDefaultTriggers(), subnetsOverlapping)
 	dispatcher.RegisterChecker(KeaDHCPDaemon, "canonical_prefix", GetDefaultTriggers(), canonicalPrefixes)
+	dispatcher.RegisterChecker(KeaDHCPDaemon, "ha_peers_consistency", GetDefaultTriggers(), haPeersConsistency)
 }
 
 // Fetches all checker preferences from the database and loads them into
@@ -831,3 +831,330 @@ func getCanonicalPrefix(prefix string) (string, bool) {
 	}
 	return candidate.GetNetworkPrefixWithLength(), true
 }
+
+// Subnet parameters which must be the same in the configurations of
+// the HA peers.
+type haPeerSubnet struct {
+	prefix string
+	pools  []string
+}
+
+// Returns the subnets (global and from shared networks) from the
+// configuration indexed by the subnet IDs. The pools are formatted
+// as strings and sorted.
+func getHAPeerSubnets(config *dbmodel.KeaConfig) (map[int64]haPeerSubnet, error) {
+	type minimalSubnet struct {
+		ID      int64
+		Subnet  string
+		Pools   []keaconfig.Pool
+		PdPools []keaconfig.PdPool `mapstructure:"pd-pools"`
+	}
+	var decodedSubnets []minimalSubnet
+	if err := config.DecodeTopLevelSubnets(&decodedSubnets); err != nil {
+		return nil, err
+	}
+	var decodedSharedNetworks []struct {
+		Subnet4 []minimalSubnet
+		Subnet6 []minimalSubnet
+	}
+	if err := config.DecodeSharedNetworks(&decodedSharedNetworks); err != nil {
+		return nil, err
+	}
+	for _, sharedNetwork := range decodedSharedNetworks {
+		decodedSubnets = append(decodedSubnets, sharedNetwork.Subnet4...)
+		decodedSubnets = append(decodedSubnets, sharedNetwork.Subnet6...)
+	}
+
+	subnets := make(map[int64]haPeerSubnet)
+	for _, decodedSubnet := range decodedSubnets {
+		subnet := haPeerSubnet{
+			prefix: decodedSubnet.Subnet,
+			pools:  []string{},
+		}
+		for _, pool := range decodedSubnet.Pools {
+			subnet.pools = append(subnet.pools, strings.ReplaceAll(pool.Pool, " ", ""))
+		}
+		for _, pdPool := range decodedSubnet.PdPools {
+			subnet.pools = append(subnet.pools, fmt.Sprintf("%s/%d delegated /%d",
+				pdPool.Prefix, pdPool.PrefixLen, pdPool.DelegatedLen))
+		}
+		sort.Strings(subnet.pools)
+		subnets[decodedSubnet.ID] = subnet
+	}
+	return subnets, nil
+}
+
+// Returns the name of the HA peer used in the issue descriptions. It is
+// the name of the server from its HA configuration if available.
+func getHAPeerName(peer *dbmodel.Daemon, params *keaconfig.HA) string {
+	if params != nil && params.ThisServerName != nil && len(*params.ThisServerName) > 0 {
+		return fmt.Sprintf("the peer %s", *params.ThisServerName)
+	}
+	return fmt.Sprintf("the peer daemon %d", peer.ID)
+}
+
+// Returns the string value or the default value if the value is nil.
+func getStringOrDefault(value *string, defaultValue string) string {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// Returns the int value or the default value if the value is nil.
+func getIntOrDefault(value *int, defaultValue int) int {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// Returns the bool value or the default value if the value is nil.
+func getBoolOrDefault(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// Compares the HA hooks library parameters of the reviewed daemon and
+// its peer. It returns the descriptions of the found differences.
+func compareHAParams(params, peerParams *keaconfig.HA, peerName string) (issues []string) {
+	if mode, peerMode := getStringOrDefault(params.Mode, "load-balancing"), getStringOrDefault(peerParams.Mode, "load-balancing"); mode != peerMode {
+		issues = append(issues, fmt.Sprintf("mode %s differs from %s in %s", mode, peerMode, peerName))
+	}
+
+	// The timing parameters are compared with the Kea defaults applied.
+	timings := []struct {
+		name         string
+		value        *int
+		peerValue    *int
+		defaultValue int
+	}{
+		{"heartbeat-delay", params.HeartbeatDelay, peerParams.HeartbeatDelay, 10000},
+		{"max-response-delay", params.MaxResponseDelay, peerParams.MaxResponseDelay, 60000},
+		{"max-ack-delay", params.MaxAckDelay, peerParams.MaxAckDelay, 10000},
+		{"max-unacked-clients", params.MaxUnackedClients, peerParams.MaxUnackedClients, 10},
+	}
+	for _, timing := range timings {
+		value := getIntOrDefault(timing.value, timing.defaultValue)
+		peerValue := getIntOrDefault(timing.peerValue, timing.defaultValue)
+		if value != peerValue {
+			issues = append(issues, fmt.Sprintf("%s %d differs from %d in %s", timing.name, value, peerValue, peerName))
+		}
+	}
+
+	if name := getStringOrDefault(params.ThisServerName, ""); len(name) > 0 && name == getStringOrDefault(peerParams.ThisServerName, "") {
+		issues = append(issues, fmt.Sprintf("this-server-name %s is also used by %s", name, peerName))
+	}
+
+	// Compare the peers lists.
+	peers := make(map[string]keaconfig.Peer)
+	for _, peer := range params.Peers {
+		peers[getStringOrDefault(peer.Name, "")] = peer
+	}
+	peerPeers := make(map[string]keaconfig.Peer)
+	for _, peer := range peerParams.Peers {
+		peerPeers[getStringOrDefault(peer.Name, "")] = peer
+	}
+	names := []string{}
+	for name := range peers {
+		names = append(names, name)
+	}
+	for name := range peerPeers {
+		if _, ok := peers[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		peer, ok := peers[name]
+		peerPeer, peerOk := peerPeers[name]
+		switch {
+		case !peerOk:
+			issues = append(issues, fmt.Sprintf("peer %s is not configured in %s", name, peerName))
+		case !ok:
+			issues = append(issues, fmt.Sprintf("peer %s configured in %s is missing", name, peerName))
+		default:
+			if url, peerURL := getStringOrDefault(peer.URL, ""), getStringOrDefault(peerPeer.URL, ""); url != peerURL {
+				issues = append(issues, fmt.Sprintf("peer %s has URL %s and %s in %s", name, url, peerURL, peerName))
+			}
+			if role, peerRole := getStringOrDefault(peer.Role, ""), getStringOrDefault(peerPeer.Role, ""); role != peerRole {
+				issues = append(issues, fmt.Sprintf("peer %s has role %s and %s in %s", name, role, peerRole, peerName))
+			}
+			if autoFailover, peerAutoFailover := getBoolOrDefault(peer.AutoFailover, true), getBoolOrDefault(peerPeer.AutoFailover, true); autoFailover != peerAutoFailover {
+				issues = append(issues, fmt.Sprintf("peer %s has auto-failover %t and %t in %s", name, autoFailover, peerAutoFailover, peerName))
+			}
+		}
+	}
+	return issues
+}
+
+// Compares the subnets of the reviewed daemon and its peer. It returns
+// the descriptions of the found differences.
+func compareHAPeerSubnets(subnets, peerSubnets map[int64]haPeerSubnet, peerName string) (issues []string) {
+	ids := []int64{}
+	for id := range subnets {
+		ids = append(ids, id)
+	}
+	for id := range peerSubnets {
+		if _, ok := subnets[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	formatPools := func(pools []string) string {
+		if len(pools) == 0 {
+			return "none"
+		}
+		return strings.Join(pools, ", ")
+	}
+
+	for _, id := range ids {
+		subnet, ok := subnets[id]
+		peerSubnet, peerOk := peerSubnets[id]
+		switch {
+		case !peerOk:
+			issues = append(issues, fmt.Sprintf("subnet %s (subnet-id %d) is not configured in %s", subnet.prefix, id, peerName))
+		case !ok:
+			issues = append(issues, fmt.Sprintf("subnet %s (subnet-id %d) configured in %s is missing", peerSubnet.prefix, id, peerName))
+		case subnet.prefix != peerSubnet.prefix:
+			issues = append(issues, fmt.Sprintf("subnet-id %d has prefix %s and %s in %s", id, subnet.prefix, peerSubnet.prefix, peerName))
+		case strings.Join(subnet.pools, ";") != strings.Join(peerSubnet.pools, ";"):
+			issues = append(issues, fmt.Sprintf("subnet %s (subnet-id %d) has pools %s and %s in %s", subnet.prefix, id,
+				formatPools(subnet.pools), formatPools(peerSubnet.pools), peerName))
+		}
+	}
+	return issues
+}
+
+// Returns the daemons belonging to the same HA services as the reviewed
+// daemon. The daemons without configurations are skipped.
+func getHAPeers(ctx *ReviewContext) ([]*dbmodel.Daemon, error) {
+	services, err := dbmodel.GetDetailedServicesByDaemonID(ctx.db, ctx.subjectDaemon.ID)
+	if err != nil {
+		return nil, err
+	}
+	peers := []*dbmodel.Daemon{}
+	presentPeers := make(map[int64]bool)
+	for _, service := range services {
+		if service.HAService == nil {
+			continue
+		}
+		for _, daemon := range service.Daemons {
+			if daemon.ID == ctx.subjectDaemon.ID || presentPeers[daemon.ID] ||
+				daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+				continue
+			}
+			presentPeers[daemon.ID] = true
+			peers = append(peers, daemon)
+		}
+	}
+	return peers, nil
+}
+
+// The checker verifying that the HA hooks library parameters, the subnets
+// and the pools are consistent in the configurations of the daemons in
+// the same HA relationship. It also verifies that this-server-name points
+// to one of the configured peers. The peers are added to the referenced
+// daemons, so their reports are updated as well.
+func haPeersConsistency(ctx *ReviewContext) (*Report, error) {
+	if ctx.subjectDaemon.Name != dbmodel.DaemonNameDHCPv4 &&
+		ctx.subjectDaemon.Name != dbmodel.DaemonNameDHCPv6 {
+		return nil, errors.Errorf("unsupported daemon %s", ctx.subjectDaemon.Name)
+	}
+
+	config := ctx.subjectDaemon.KeaDaemon.Config
+	_, params, ok := config.GetHAHooksLibrary()
+	if !ok {
+		return nil, nil
+	}
+
+	var issues []string
+	if name := getStringOrDefault(params.ThisServerName, ""); len(name) > 0 {
+		found := false
+		for _, peer := range params.Peers {
+			if getStringOrDefault(peer.Name, "") == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			issues = append(issues, fmt.Sprintf("this-server-name %s does not match any of the configured peers", name))
+		}
+	}
+
+	peers, err := getHAPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets map[int64]haPeerSubnet
+	var inconsistentPeers []*dbmodel.Daemon
+	for _, peer := range peers {
+		ctx.addRefDaemon(peer)
+
+		var peerIssues []string
+		_, peerParams, ok := peer.KeaDaemon.Config.GetHAHooksLibrary()
+		if !ok {
+			peerIssues = append(peerIssues, fmt.Sprintf("HA hooks library is not configured in %s", getHAPeerName(peer, nil)))
+		} else {
+			peerIssues = compareHAParams(&params, &peerParams, getHAPeerName(peer, &peerParams))
+		}
+
+		// The subnets are only compared between the daemons of the same
+		// type.
+		if peer.Name == ctx.subjectDaemon.Name {
+			if subnets == nil {
+				if subnets, err = getHAPeerSubnets(config); err != nil {
+					return nil, err
+				}
+			}
+			peerSubnets, err := getHAPeerSubnets(peer.KeaDaemon.Config)
+			if err != nil {
+				return nil, err
+			}
+			peerIssues = append(peerIssues, compareHAPeerSubnets(subnets, peerSubnets, getHAPeerName(peer, &peerParams))...)
+		}
+
+		if len(peerIssues) > 0 {
+			inconsistentPeers = append(inconsistentPeers, peer)
+			issues = append(issues, peerIssues...)
+		}
+	}
+
+	if len(issues) == 0 {
+		return nil, nil
+	}
+
+	// Limits the issues count to avoid producing too huge review message.
+	maxIssues := 10
+	maxExceedMessage := ""
+	if len(issues) > maxIssues {
+		issues = issues[:maxIssues]
+		maxExceedMessage = " at least"
+	}
+	for i := range issues {
+		issues[i] = fmt.Sprintf("%d. %s", i+1, issues[i])
+	}
+
+	// Each inconsistent peer is referenced in the report.
+	peerPlaceholders := ""
+	if len(inconsistentPeers) > 0 {
+		peerPlaceholders = " with " + strings.TrimSuffix(strings.Repeat("{daemon}, ", len(inconsistentPeers)), ", ")
+	}
+
+	report := NewReport(ctx, fmt.Sprintf("Kea {daemon} HA configuration is inconsistent%s. "+
+		"Stork found%s %s. Mismatched HA configurations of the peers may cause "+
+		"failover problems.\n%s",
+		peerPlaceholders, maxExceedMessage, storkutil.FormatNoun(int64(len(issues)), "difference", "s"),
+		strings.Join(issues, "; "))).
+		referencingDaemon(ctx.subjectDaemon)
+	for _, peer := range inconsistentPeers {
+		report = report.referencingDaemon(peer)
+	}
+	return report.create()
+}
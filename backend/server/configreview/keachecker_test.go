@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	keaconfig "isc.org/stork/appcfg/kea"
 	dbops "isc.org/stork/server/database"
 	dbmodel "isc.org/stork/server/database/model"
 	dbtest "isc.org/stork/server/database/test"
@@ -2469,3 +2470,246 @@ func BenchmarkOverlapsBinaryPrefixesOnly(b *testing.B) {
 		_ = findOverlaps(subnets, maximumOverlaps)
 	}
 }
+
+// Returns the DHCPv4 server configuration with the HA hooks library.
+// The parameters are inserted into the HA configuration.
+func getHAConfig(haParams, subnets string) string {
+	return fmt.Sprintf(`{
+		"Dhcp4": {
+			"hooks-libraries": [
+				{
+					"library": "/usr/lib/kea/libdhcp_ha.so",
+					"parameters": {
+						"high-availability": [
+							{
+								%s
+							}
+						]
+					}
+				}
+			],
+			"subnet4": [ %s ]
+		}
+	}`, haParams, subnets)
+}
+
+// Test that the differences between the HA hooks library parameters are
+// found.
+func TestCompareHAParams(t *testing.T) {
+	mode := "load-balancing"
+	otherMode := "hot-standby"
+	heartbeatDelay := 10000
+	otherHeartbeatDelay := 5000
+	name1 := "server1"
+	name2 := "server2"
+	name3 := "server3"
+	url1 := "http://192.0.2.1:8000"
+	url2 := "http://192.0.2.2:8000"
+	otherURL := "http://192.0.2.22:8000"
+	primary := "primary"
+	secondary := "secondary"
+	autoFailover := false
+
+	params := keaconfig.HA{
+		ThisServerName: &name1,
+		Mode:           &mode,
+		HeartbeatDelay: &heartbeatDelay,
+		Peers: []keaconfig.Peer{
+			{Name: &name1, URL: &url1, Role: &primary},
+			{Name: &name2, URL: &url2, Role: &secondary},
+		},
+	}
+
+	// The default values are equal to the explicit values.
+	peerParams := keaconfig.HA{
+		ThisServerName: &name2,
+		Peers: []keaconfig.Peer{
+			{Name: &name2, URL: &url2, Role: &secondary},
+			{Name: &name1, URL: &url1, Role: &primary},
+		},
+	}
+	require.Empty(t, compareHAParams(&params, &peerParams, "the peer server2"))
+
+	peerParams = keaconfig.HA{
+		ThisServerName: &name1,
+		Mode:           &otherMode,
+		HeartbeatDelay: &otherHeartbeatDelay,
+		Peers: []keaconfig.Peer{
+			{Name: &name2, URL: &otherURL, Role: &primary, AutoFailover: &autoFailover},
+			{Name: &name3, URL: &url1, Role: &primary},
+		},
+	}
+	issues := compareHAParams(&params, &peerParams, "the peer server2")
+	require.Equal(t, []string{
+		"mode load-balancing differs from hot-standby in the peer server2",
+		"heartbeat-delay 10000 differs from 5000 in the peer server2",
+		"this-server-name server1 is also used by the peer server2",
+		"peer server1 is not configured in the peer server2",
+		"peer server2 has URL http://192.0.2.2:8000 and http://192.0.2.22:8000 in the peer server2",
+		"peer server2 has role secondary and primary in the peer server2",
+		"peer server2 has auto-failover true and false in the peer server2",
+		"peer server3 configured in the peer server2 is missing",
+	}, issues)
+}
+
+// Test that the differences between the subnets and pools of the HA peers
+// are found.
+func TestCompareHAPeerSubnets(t *testing.T) {
+	config, err := dbmodel.NewKeaConfigFromJSON(getHAConfig(`"mode": "hot-standby"`, `
+		{ "id": 1, "subnet": "192.0.2.0/24", "pools": [ { "pool": "192.0.2.10 - 192.0.2.20" } ] },
+		{ "id": 2, "subnet": "198.51.100.0/24" },
+		{ "id": 3, "subnet": "203.0.113.0/24", "pools": [ { "pool": "203.0.113.10-203.0.113.20" } ] },
+		{ "id": 4, "subnet": "10.0.0.0/8" }`))
+	require.NoError(t, err)
+	subnets, err := getHAPeerSubnets(config)
+	require.NoError(t, err)
+	require.Len(t, subnets, 4)
+	require.Equal(t, []string{"192.0.2.10-192.0.2.20"}, subnets[1].pools)
+
+	peerConfig, err := dbmodel.NewKeaConfigFromJSON(getHAConfig(`"mode": "hot-standby"`, `
+		{ "id": 1, "subnet": "192.0.2.0/24", "pools": [ { "pool": "192.0.2.10-192.0.2.20" } ] },
+		{ "id": 2, "subnet": "198.51.100.0/25" },
+		{ "id": 3, "subnet": "203.0.113.0/24", "pools": [ { "pool": "203.0.113.10-203.0.113.30" } ] },
+		{ "id": 5, "subnet": "10.0.0.0/8" }`))
+	require.NoError(t, err)
+	peerSubnets, err := getHAPeerSubnets(peerConfig)
+	require.NoError(t, err)
+
+	issues := compareHAPeerSubnets(subnets, peerSubnets, "the peer server2")
+	require.Equal(t, []string{
+		"subnet-id 2 has prefix 198.51.100.0/24 and 198.51.100.0/25 in the peer server2",
+		"subnet 203.0.113.0/24 (subnet-id 3) has pools 203.0.113.10-203.0.113.20 and 203.0.113.10-203.0.113.30 in the peer server2",
+		"subnet 10.0.0.0/8 (subnet-id 4) is not configured in the peer server2",
+		"subnet 10.0.0.0/8 (subnet-id 5) configured in the peer server2 is missing",
+	}, issues)
+}
+
+// Test that the checker reports the inconsistent configurations of the
+// daemons in the HA relationship.
+func TestHAPeersConsistency(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	haParams := func(thisServerName, heartbeatDelay string) string {
+		return fmt.Sprintf(`
+			"this-server-name": "%s",
+			"mode": "hot-standby",
+			"heartbeat-delay": %s,
+			"peers": [
+				{ "name": "server1", "url": "http://192.0.2.1:8000", "role": "primary" },
+				{ "name": "server2", "url": "http://192.0.2.2:8000", "role": "standby" }
+			]`, thisServerName, heartbeatDelay)
+	}
+	subnets := `{ "id": 1, "subnet": "192.0.2.0/24", "pools": [ { "pool": "192.0.2.10-192.0.2.20" } ] }`
+
+	var daemons []*dbmodel.Daemon
+	for i, configStr := range []string{
+		getHAConfig(haParams("server1", "10000"), subnets),
+		getHAConfig(haParams("server2", "5000"), `{ "id": 2, "subnet": "198.51.100.0/24" }`),
+		getHAConfig(haParams("server2", "10000"), subnets),
+	} {
+		machine := &dbmodel.Machine{
+			Address:   fmt.Sprintf("192.0.2.%d", i+1),
+			AgentPort: 8080,
+		}
+		require.NoError(t, dbmodel.AddMachine(db, machine))
+		config, err := dbmodel.NewKeaConfigFromJSON(configStr)
+		require.NoError(t, err)
+		app := &dbmodel.App{
+			MachineID: machine.ID,
+			Type:      dbmodel.AppTypeKea,
+			Daemons: []*dbmodel.Daemon{
+				{
+					Name:   dbmodel.DaemonNameDHCPv4,
+					Active: true,
+					KeaDaemon: &dbmodel.KeaDaemon{
+						Config: config,
+					},
+				},
+			},
+		}
+		addedDaemons, err := dbmodel.AddApp(db, app)
+		require.NoError(t, err)
+		daemons = append(daemons, addedDaemons...)
+	}
+
+	// The first daemon is not in the HA relationship yet.
+	ctx := newReviewContext(db, daemons[0], ManualRun, nil)
+	report, err := haPeersConsistency(ctx)
+	require.NoError(t, err)
+	require.Nil(t, report)
+	require.Empty(t, ctx.refDaemons)
+
+	// The first two daemons are in the HA relationship.
+	service := &dbmodel.Service{
+		BaseService: dbmodel.BaseService{
+			Name:        "ha",
+			ServiceType: "ha_dhcp",
+			Daemons:     daemons[:2],
+		},
+		HAService: &dbmodel.BaseHAService{
+			HAType:      dbmodel.HATypeDhcp4,
+			HAMode:      dbmodel.HAModeHotStandby,
+			PrimaryID:   daemons[0].ID,
+			SecondaryID: daemons[1].ID,
+		},
+	}
+	require.NoError(t, dbmodel.AddService(db, service))
+
+	ctx = newReviewContext(db, daemons[0], ManualRun, nil)
+	report, err = haPeersConsistency(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	require.Equal(t, "Kea {daemon} HA configuration is inconsistent with {daemon}. "+
+		"Stork found 3 differences. Mismatched HA configurations of the peers may cause failover problems.\n"+
+		"1. heartbeat-delay 10000 differs from 5000 in the peer server2; "+
+		"2. subnet 192.0.2.0/24 (subnet-id 1) is not configured in the peer server2; "+
+		"3. subnet 198.51.100.0/24 (subnet-id 2) configured in the peer server2 is missing", *report.content)
+	require.Equal(t, []int64{daemons[0].ID, daemons[1].ID}, report.refDaemonIDs)
+	require.Len(t, ctx.refDaemons, 1)
+	require.Equal(t, daemons[1].ID, ctx.refDaemons[0].ID)
+
+	// Replace the inconsistent peer with the consistent one.
+	_, err = dbmodel.DeleteDaemonFromService(db, service.ID, daemons[1].ID)
+	require.NoError(t, err)
+	require.NoError(t, dbmodel.AddDaemonToService(db, service.ID, daemons[2]))
+
+	ctx = newReviewContext(db, daemons[0], ManualRun, nil)
+	report, err = haPeersConsistency(ctx)
+	require.NoError(t, err)
+	require.Nil(t, report)
+	// The consistent peer is referenced, so its reports are updated.
+	require.Len(t, ctx.refDaemons, 1)
+	require.Equal(t, daemons[2].ID, ctx.refDaemons[0].ID)
+}
+
+// Test that the checker reports this-server-name not pointing at any of
+// the peers.
+func TestHAPeersConsistencyThisServerName(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	ctx := createReviewContext(t, db, getHAConfig(`
+		"this-server-name": "server3",
+		"mode": "hot-standby",
+		"peers": [
+			{ "name": "server1", "url": "http://192.0.2.1:8000", "role": "primary" },
+			{ "name": "server2", "url": "http://192.0.2.2:8000", "role": "standby" }
+		]`, ""))
+	report, err := haPeersConsistency(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	require.Equal(t, "Kea {daemon} HA configuration is inconsistent. "+
+		"Stork found 1 difference. Mismatched HA configurations of the peers may cause failover problems.\n"+
+		"1. this-server-name server3 does not match any of the configured peers", *report.content)
+	require.Equal(t, []int64{1}, report.refDaemonIDs)
+}
+
+// Test that the checker doesn't report anything for the daemon without
+// the HA hooks library.
+func TestHAPeersConsistencyNoHA(t *testing.T) {
+	ctx := createReviewContext(t, nil, `{ "Dhcp4": { "subnet4": [] } }`)
+	report, err := haPeersConsistency(ctx)
+	require.NoError(t, err)
+	require.Nil(t, report)
+}
@@ -0,0 +1,29 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			CREATE TABLE IF NOT EXISTS config_snapshot (
+				id BIGSERIAL NOT NULL PRIMARY KEY,
+				created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT timezone('utc'::text, now()) NOT NULL,
+				daemon_id BIGINT NOT NULL,
+				config JSONB NOT NULL,
+				config_hash TEXT,
+				source TEXT NOT NULL,
+				CONSTRAINT config_snapshot_daemon_id_fk FOREIGN KEY (daemon_id)
+					REFERENCES daemon (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE
+			);
+			CREATE INDEX config_snapshot_daemon_id_created_at_idx ON config_snapshot USING btree (daemon_id, created_at);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS config_snapshot;
+        `)
+		return err
+	})
+}
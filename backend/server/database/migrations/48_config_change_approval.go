@@ -0,0 +1,44 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- The config changes scheduled before introducing the approvals
+			-- are considered approved.
+			ALTER TABLE scheduled_config_change
+				ADD COLUMN IF NOT EXISTS approval_status TEXT NOT NULL DEFAULT 'approved',
+				ADD COLUMN IF NOT EXISTS required_approvals BIGINT NOT NULL DEFAULT 0;
+
+			-- Create a table holding the approvals, rejections and comments
+			-- of the scheduled config changes.
+			CREATE TABLE IF NOT EXISTS scheduled_config_change_review (
+				id BIGSERIAL NOT NULL PRIMARY KEY,
+				created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT timezone('utc'::text, now()) NOT NULL,
+				scheduled_config_change_id BIGINT NOT NULL,
+				user_id BIGINT NOT NULL,
+				decision TEXT NOT NULL,
+				comment TEXT,
+				CONSTRAINT scheduled_config_change_review_change_id_fk FOREIGN KEY (scheduled_config_change_id)
+					REFERENCES scheduled_config_change (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT scheduled_config_change_review_user_id_fk FOREIGN KEY (user_id)
+					REFERENCES system_user (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE
+			);
+			CREATE INDEX scheduled_config_change_review_change_id_idx ON scheduled_config_change_review USING btree (scheduled_config_change_id);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS scheduled_config_change_review;
+			ALTER TABLE scheduled_config_change
+				DROP COLUMN IF EXISTS approval_status,
+				DROP COLUMN IF EXISTS required_approvals;
+		`)
+		return err
+	})
+}
@@ -0,0 +1,37 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Create a table holding the audit trail of the changes made
+			-- by the users. The user login is copied to the record so the
+			-- record remains meaningful when the user is deleted.
+			CREATE TABLE IF NOT EXISTS audit_record (
+				id BIGSERIAL NOT NULL PRIMARY KEY,
+				created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT timezone('utc'::text, now()) NOT NULL,
+				user_id BIGINT,
+				user_login TEXT,
+				source_ip TEXT,
+				operation_id TEXT,
+				target_type TEXT NOT NULL,
+				target_id BIGINT,
+				changes JSONB,
+				CONSTRAINT audit_record_user_id_fk FOREIGN KEY (user_id)
+					REFERENCES system_user (id)
+					ON UPDATE CASCADE
+					ON DELETE SET NULL
+			);
+			CREATE INDEX audit_record_created_at_idx ON audit_record USING btree (created_at);
+			CREATE INDEX audit_record_target_idx ON audit_record USING btree (target_type, target_id);
+			CREATE INDEX audit_record_user_id_idx ON audit_record USING btree (user_id);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS audit_record;
+		`)
+		return err
+	})
+}
@@ -0,0 +1,47 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Create a table holding the leases assigned to the clients
+			-- other than the ones holding the reservations for the leased
+			-- addresses. The identifiers of the clients are copied from
+			-- the leases.
+			CREATE TABLE IF NOT EXISTS lease_conflict (
+				id BIGSERIAL NOT NULL PRIMARY KEY,
+				detected_at TIMESTAMP WITHOUT TIME ZONE DEFAULT timezone('utc'::text, now()) NOT NULL,
+				subnet_id BIGINT NOT NULL,
+				host_id BIGINT NOT NULL,
+				daemon_id BIGINT NOT NULL,
+				address TEXT NOT NULL,
+				hw_address TEXT,
+				client_id TEXT,
+				duid TEXT,
+				hostname TEXT,
+				CONSTRAINT lease_conflict_subnet_id_fk FOREIGN KEY (subnet_id)
+					REFERENCES subnet (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT lease_conflict_host_id_fk FOREIGN KEY (host_id)
+					REFERENCES host (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT lease_conflict_daemon_id_fk FOREIGN KEY (daemon_id)
+					REFERENCES daemon (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE
+			);
+			CREATE INDEX lease_conflict_subnet_id_idx ON lease_conflict USING btree (subnet_id);
+			CREATE INDEX lease_conflict_host_id_idx ON lease_conflict USING btree (host_id);
+			CREATE INDEX lease_conflict_daemon_id_idx ON lease_conflict USING btree (daemon_id);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS lease_conflict;
+		`)
+		return err
+	})
+}
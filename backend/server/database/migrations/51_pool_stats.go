@@ -0,0 +1,30 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Add the statistics and the utilization to the pools. The
+			-- utilization is expressed in percentage multiplied by 10
+			-- like in the subnet table.
+			ALTER TABLE address_pool ADD COLUMN IF NOT EXISTS stats JSONB;
+			ALTER TABLE address_pool ADD COLUMN IF NOT EXISTS utilization SMALLINT;
+			ALTER TABLE address_pool ADD COLUMN IF NOT EXISTS stats_collected_at TIMESTAMP WITHOUT TIME ZONE;
+			ALTER TABLE prefix_pool ADD COLUMN IF NOT EXISTS stats JSONB;
+			ALTER TABLE prefix_pool ADD COLUMN IF NOT EXISTS utilization SMALLINT;
+			ALTER TABLE prefix_pool ADD COLUMN IF NOT EXISTS stats_collected_at TIMESTAMP WITHOUT TIME ZONE;
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			ALTER TABLE address_pool DROP COLUMN IF EXISTS stats;
+			ALTER TABLE address_pool DROP COLUMN IF EXISTS utilization;
+			ALTER TABLE address_pool DROP COLUMN IF EXISTS stats_collected_at;
+			ALTER TABLE prefix_pool DROP COLUMN IF EXISTS stats;
+			ALTER TABLE prefix_pool DROP COLUMN IF EXISTS utilization;
+			ALTER TABLE prefix_pool DROP COLUMN IF EXISTS stats_collected_at;
+		`)
+		return err
+	})
+}
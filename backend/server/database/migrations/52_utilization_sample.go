@@ -0,0 +1,51 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Historical utilization of the subnets and shared networks.
+			-- The resolution is expressed in seconds. The samples with the
+			-- zero resolution are recorded on every statistics pull and are
+			-- periodically downsampled to the coarser resolutions. The
+			-- utilization is expressed in percentage multiplied by 10 like
+			-- in the subnet table.
+			CREATE TABLE IF NOT EXISTS utilization_sample (
+				id BIGSERIAL NOT NULL,
+				subnet_id BIGINT,
+				shared_network_id BIGINT,
+				resolution BIGINT NOT NULL DEFAULT 0,
+				sampled_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+				addr_utilization SMALLINT NOT NULL DEFAULT 0,
+				pd_utilization SMALLINT NOT NULL DEFAULT 0,
+				stats JSONB,
+				sample_count BIGINT NOT NULL DEFAULT 1,
+				CONSTRAINT utilization_sample_pkey PRIMARY KEY (id),
+				CONSTRAINT utilization_sample_subnet_id_fkey FOREIGN KEY (subnet_id)
+					REFERENCES subnet (id) MATCH SIMPLE
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT utilization_sample_shared_network_id_fkey FOREIGN KEY (shared_network_id)
+					REFERENCES shared_network (id) MATCH SIMPLE
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT utilization_sample_owner_check CHECK (
+					(subnet_id IS NULL) <> (shared_network_id IS NULL)
+				)
+			);
+			CREATE INDEX IF NOT EXISTS utilization_sample_subnet_idx
+				ON utilization_sample (subnet_id, sampled_at);
+			CREATE INDEX IF NOT EXISTS utilization_sample_shared_network_idx
+				ON utilization_sample (shared_network_id, sampled_at);
+			CREATE INDEX IF NOT EXISTS utilization_sample_resolution_idx
+				ON utilization_sample (resolution, sampled_at);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS utilization_sample;
+		`)
+		return err
+	})
+}
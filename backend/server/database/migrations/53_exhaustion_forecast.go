@@ -0,0 +1,51 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Record the utilization history of the pools.
+			ALTER TABLE utilization_sample ADD COLUMN IF NOT EXISTS address_pool_id BIGINT;
+			ALTER TABLE utilization_sample ADD COLUMN IF NOT EXISTS prefix_pool_id BIGINT;
+			ALTER TABLE utilization_sample ADD CONSTRAINT utilization_sample_address_pool_id_fkey
+				FOREIGN KEY (address_pool_id) REFERENCES address_pool (id) MATCH SIMPLE
+				ON UPDATE CASCADE
+				ON DELETE CASCADE;
+			ALTER TABLE utilization_sample ADD CONSTRAINT utilization_sample_prefix_pool_id_fkey
+				FOREIGN KEY (prefix_pool_id) REFERENCES prefix_pool (id) MATCH SIMPLE
+				ON UPDATE CASCADE
+				ON DELETE CASCADE;
+			ALTER TABLE utilization_sample DROP CONSTRAINT IF EXISTS utilization_sample_owner_check;
+			ALTER TABLE utilization_sample ADD CONSTRAINT utilization_sample_owner_check CHECK (
+				num_nonnulls(subnet_id, shared_network_id, address_pool_id, prefix_pool_id) = 1
+			);
+			CREATE INDEX IF NOT EXISTS utilization_sample_address_pool_idx
+				ON utilization_sample (address_pool_id, sampled_at);
+			CREATE INDEX IF NOT EXISTS utilization_sample_prefix_pool_idx
+				ON utilization_sample (prefix_pool_id, sampled_at);
+
+			-- Projected date of exhausting the addresses or delegated
+			-- prefixes. It is NULL when the exhaustion is not predicted.
+			ALTER TABLE subnet ADD COLUMN IF NOT EXISTS exhaustion_forecast TIMESTAMP WITHOUT TIME ZONE;
+			ALTER TABLE address_pool ADD COLUMN IF NOT EXISTS exhaustion_forecast TIMESTAMP WITHOUT TIME ZONE;
+			ALTER TABLE prefix_pool ADD COLUMN IF NOT EXISTS exhaustion_forecast TIMESTAMP WITHOUT TIME ZONE;
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			ALTER TABLE subnet DROP COLUMN IF EXISTS exhaustion_forecast;
+			ALTER TABLE address_pool DROP COLUMN IF EXISTS exhaustion_forecast;
+			ALTER TABLE prefix_pool DROP COLUMN IF EXISTS exhaustion_forecast;
+
+			DELETE FROM utilization_sample WHERE address_pool_id IS NOT NULL OR prefix_pool_id IS NOT NULL;
+			ALTER TABLE utilization_sample DROP CONSTRAINT IF EXISTS utilization_sample_owner_check;
+			ALTER TABLE utilization_sample DROP COLUMN IF EXISTS address_pool_id;
+			ALTER TABLE utilization_sample DROP COLUMN IF EXISTS prefix_pool_id;
+			ALTER TABLE utilization_sample ADD CONSTRAINT utilization_sample_owner_check CHECK (
+				(subnet_id IS NULL) <> (shared_network_id IS NULL)
+			);
+		`)
+		return err
+	})
+}
@@ -0,0 +1,60 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Threshold-based alert rules evaluated against the metrics
+			-- calculated by the server. The duration is expressed in
+			-- seconds and the severity is the level of the events
+			-- generated when the alert fires.
+			CREATE TABLE IF NOT EXISTS alert_rule (
+				id BIGSERIAL NOT NULL,
+				created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+				name TEXT NOT NULL,
+				metric TEXT NOT NULL,
+				operator TEXT NOT NULL,
+				threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+				duration BIGINT NOT NULL DEFAULT 0,
+				severity INTEGER NOT NULL DEFAULT 1,
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				CONSTRAINT alert_rule_pkey PRIMARY KEY (id),
+				CONSTRAINT alert_rule_name_unique UNIQUE (name),
+				CONSTRAINT alert_rule_duration_check CHECK (duration >= 0),
+				CONSTRAINT alert_rule_severity_check CHECK (severity >= 0 AND severity <= 2)
+			);
+
+			-- Alerts raised by the rules for the particular objects, e.g.
+			-- subnets. The alert is pending until the rule condition is
+			-- met for the rule duration. Then it fires. The alert is
+			-- removed when the condition is no longer met.
+			CREATE TABLE IF NOT EXISTS alert (
+				id BIGSERIAL NOT NULL,
+				rule_id BIGINT NOT NULL,
+				label TEXT NOT NULL DEFAULT '',
+				subnet_id BIGINT,
+				value DOUBLE PRECISION NOT NULL DEFAULT 0,
+				started_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+				fired_at TIMESTAMP WITHOUT TIME ZONE,
+				CONSTRAINT alert_pkey PRIMARY KEY (id),
+				CONSTRAINT alert_rule_label_unique UNIQUE (rule_id, label),
+				CONSTRAINT alert_rule_id_fkey FOREIGN KEY (rule_id)
+					REFERENCES alert_rule (id) MATCH SIMPLE
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT alert_subnet_id_fkey FOREIGN KEY (subnet_id)
+					REFERENCES subnet (id) MATCH SIMPLE
+					ON UPDATE CASCADE
+					ON DELETE SET NULL
+			);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS alert;
+			DROP TABLE IF EXISTS alert_rule;
+		`)
+		return err
+	})
+}
@@ -0,0 +1,34 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Endpoints receiving the events over HTTP. The filters have
+			-- the same meaning as the SSE subscriber filters. The zero
+			-- values match all events. The secret is used to sign the
+			-- payloads.
+			CREATE TABLE IF NOT EXISTS webhook (
+				id BIGSERIAL NOT NULL,
+				created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (now() AT TIME ZONE 'utc'),
+				url TEXT NOT NULL,
+				secret TEXT NOT NULL DEFAULT '',
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				level INTEGER NOT NULL DEFAULT 0,
+				machine_id BIGINT NOT NULL DEFAULT 0,
+				app_id BIGINT NOT NULL DEFAULT 0,
+				daemon_id BIGINT NOT NULL DEFAULT 0,
+				subnet_id BIGINT NOT NULL DEFAULT 0,
+				CONSTRAINT webhook_pkey PRIMARY KEY (id),
+				CONSTRAINT webhook_level_check CHECK (level >= 0 AND level <= 2)
+			);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS webhook;
+		`)
+		return err
+	})
+}
@@ -0,0 +1,36 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- Preferences of the users receiving the events by email. The
+			-- filters have the same meaning as the SSE subscriber filters.
+			-- The zero values match all events. The digest flag indicates
+			-- that the events are sent periodically in a single email.
+			CREATE TABLE IF NOT EXISTS email_subscription (
+				user_id BIGINT NOT NULL,
+				enabled BOOLEAN NOT NULL DEFAULT TRUE,
+				digest BOOLEAN NOT NULL DEFAULT FALSE,
+				level INTEGER NOT NULL DEFAULT 0,
+				machine_id BIGINT NOT NULL DEFAULT 0,
+				app_id BIGINT NOT NULL DEFAULT 0,
+				daemon_id BIGINT NOT NULL DEFAULT 0,
+				subnet_id BIGINT NOT NULL DEFAULT 0,
+				CONSTRAINT email_subscription_pkey PRIMARY KEY (user_id),
+				CONSTRAINT email_subscription_user_id_fk FOREIGN KEY (user_id)
+					REFERENCES system_user (id)
+					ON UPDATE CASCADE
+					ON DELETE CASCADE,
+				CONSTRAINT email_subscription_level_check CHECK (level >= 0 AND level <= 2)
+			);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP TABLE IF EXISTS email_subscription;
+		`)
+		return err
+	})
+}
@@ -0,0 +1,40 @@
+package dbmigs
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		_, err := db.Exec(`
+			-- The repeated events are merged into a single event. The template
+			-- is the event text before the object tags are substituted. The
+			-- created_at column holds the time when the event was first seen.
+			ALTER TABLE event ADD COLUMN IF NOT EXISTS template TEXT NOT NULL DEFAULT '';
+			ALTER TABLE event ADD COLUMN IF NOT EXISTS count BIGINT NOT NULL DEFAULT 1;
+			ALTER TABLE event ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP WITHOUT TIME ZONE;
+			UPDATE event SET last_seen_at = created_at;
+			ALTER TABLE event ALTER COLUMN last_seen_at SET DEFAULT (now() AT TIME ZONE 'utc');
+			ALTER TABLE event ALTER COLUMN last_seen_at SET NOT NULL;
+
+			-- The recovery event points to the failure event it resolves.
+			ALTER TABLE event ADD COLUMN IF NOT EXISTS resolves_id INTEGER;
+			ALTER TABLE event ADD CONSTRAINT event_resolves_id_fkey FOREIGN KEY (resolves_id)
+				REFERENCES event (id)
+				ON UPDATE CASCADE
+				ON DELETE SET NULL;
+
+			CREATE INDEX IF NOT EXISTS event_template_idx ON event (template);
+			CREATE INDEX IF NOT EXISTS event_resolves_id_idx ON event (resolves_id);
+		`)
+		return err
+	}, func(db migrations.DB) error {
+		_, err := db.Exec(`
+			DROP INDEX IF EXISTS event_resolves_id_idx;
+			DROP INDEX IF EXISTS event_template_idx;
+			ALTER TABLE event DROP COLUMN IF EXISTS resolves_id;
+			ALTER TABLE event DROP COLUMN IF EXISTS last_seen_at;
+			ALTER TABLE event DROP COLUMN IF EXISTS count;
+			ALTER TABLE event DROP COLUMN IF EXISTS template;
+		`)
+		return err
+	})
+}
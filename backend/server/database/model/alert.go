@@ -0,0 +1,276 @@
+package dbmodel
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+)
+
+// Name of the metric evaluated by the alert rule.
+type AlertMetric = string
+
+// Comparison operator used by the alert rule to compare the metric
+// value with the threshold.
+type AlertOperator = string
+
+const (
+	// Address utilization of a subnet in percent.
+	AlertMetricSubnetAddressUtilization AlertMetric = "subnet-address-utilization"
+	// Delegated prefix utilization of a subnet in percent.
+	AlertMetricSubnetPdUtilization AlertMetric = "subnet-pd-utilization"
+	// Address utilization of a shared network in percent.
+	AlertMetricSharedNetworkAddressUtilization AlertMetric = "shared-network-address-utilization"
+	// Delegated prefix utilization of a shared network in percent.
+	AlertMetricSharedNetworkPdUtilization AlertMetric = "shared-network-pd-utilization"
+	// Address utilization of a pool in percent.
+	AlertMetricPoolAddressUtilization AlertMetric = "pool-address-utilization"
+	// Number of the unreachable machines.
+	AlertMetricUnreachableMachines AlertMetric = "unreachable-machines"
+	// Number of the servers in an HA relationship which are unreachable
+	// or are not in the normal operation state.
+	AlertMetricHADegradedServers AlertMetric = "ha-degraded-servers"
+	// Number of the configuration review reports with issues.
+	AlertMetricConfigReviewIssues AlertMetric = "config-review-issues"
+
+	AlertOperatorGreater        AlertOperator = ">"
+	AlertOperatorGreaterOrEqual AlertOperator = ">="
+	AlertOperatorLess           AlertOperator = "<"
+	AlertOperatorLessOrEqual    AlertOperator = "<="
+	AlertOperatorEqual          AlertOperator = "=="
+	AlertOperatorNotEqual       AlertOperator = "!="
+)
+
+// Represents a threshold-based alert rule. The rule compares the value
+// of the metric with the threshold using the operator. The alert fires
+// when the comparison is true for at least the duration (in seconds).
+// The severity is the level of the events generated when the alert fires.
+type AlertRule struct {
+	ID        int64
+	CreatedAt time.Time
+	Name      string
+	Metric    AlertMetric
+	Operator  AlertOperator
+	Threshold float64 `pg:",use_zero"`
+	Duration  int64   `pg:",use_zero"`
+	Severity  int     `pg:",use_zero"`
+	Enabled   bool    `pg:",use_zero"`
+}
+
+// Represents an alert raised by the rule for a particular object, e.g.
+// a subnet. The label identifies the object. It is empty for the
+// metrics which are not associated with any objects. The alert is
+// pending until the fired time is set.
+type Alert struct {
+	ID        int64
+	RuleID    int64
+	Rule      *AlertRule `pg:"rel:has-one"`
+	Label     string     `pg:",use_zero"`
+	SubnetID  *int64
+	Value     float64 `pg:",use_zero"`
+	StartedAt time.Time
+	FiredAt   time.Time
+}
+
+// Checks if the metric name is supported by the alert rules.
+func IsValidAlertMetric(metric AlertMetric) bool {
+	switch metric {
+	case AlertMetricSubnetAddressUtilization,
+		AlertMetricSubnetPdUtilization,
+		AlertMetricSharedNetworkAddressUtilization,
+		AlertMetricSharedNetworkPdUtilization,
+		AlertMetricPoolAddressUtilization,
+		AlertMetricUnreachableMachines,
+		AlertMetricHADegradedServers,
+		AlertMetricConfigReviewIssues:
+		return true
+	default:
+		return false
+	}
+}
+
+// Compares the value with the threshold using the rule operator.
+func (rule *AlertRule) IsMet(value float64) bool {
+	switch rule.Operator {
+	case AlertOperatorGreater:
+		return value > rule.Threshold
+	case AlertOperatorGreaterOrEqual:
+		return value >= rule.Threshold
+	case AlertOperatorLess:
+		return value < rule.Threshold
+	case AlertOperatorLessOrEqual:
+		return value <= rule.Threshold
+	case AlertOperatorEqual:
+		return value == rule.Threshold
+	case AlertOperatorNotEqual:
+		return value != rule.Threshold
+	default:
+		return false
+	}
+}
+
+// Checks if the rule has a name, a supported metric and operator, a
+// non-negative duration and a valid severity.
+func (rule *AlertRule) Validate() error {
+	if len(rule.Name) == 0 {
+		return pkgerrors.New("alert rule name must not be empty")
+	}
+	if !IsValidAlertMetric(rule.Metric) {
+		return pkgerrors.Errorf("unsupported alert rule metric %s", rule.Metric)
+	}
+	switch rule.Operator {
+	case AlertOperatorGreater, AlertOperatorGreaterOrEqual,
+		AlertOperatorLess, AlertOperatorLessOrEqual,
+		AlertOperatorEqual, AlertOperatorNotEqual:
+	default:
+		return pkgerrors.Errorf("unsupported alert rule operator %s", rule.Operator)
+	}
+	if rule.Duration < 0 {
+		return pkgerrors.Errorf("alert rule duration must not be negative")
+	}
+	if rule.Severity < EvInfo || rule.Severity > EvError {
+		return pkgerrors.Errorf("invalid alert rule severity %d", rule.Severity)
+	}
+	return nil
+}
+
+// Checks if the alert has fired.
+func (alert *Alert) IsFiring() bool {
+	return !alert.FiredAt.IsZero()
+}
+
+// Adds the alert rule to the database.
+func AddAlertRule(dbi dbops.DBI, rule *AlertRule) error {
+	_, err := dbi.Model(rule).Insert()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem adding alert rule %s", rule.Name)
+	}
+	return err
+}
+
+// Updates the alert rule in the database.
+func UpdateAlertRule(dbi dbops.DBI, rule *AlertRule) error {
+	result, err := dbi.Model(rule).
+		ExcludeColumn("created_at").
+		WherePK().
+		Update()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem updating alert rule with ID %d", rule.ID)
+	} else if result.RowsAffected() <= 0 {
+		err = pkgerrors.Wrapf(ErrNotExists, "alert rule with ID %d does not exist", rule.ID)
+	}
+	return err
+}
+
+// Deletes the alert rule and its alerts from the database.
+func DeleteAlertRule(dbi dbops.DBI, id int64) error {
+	rule := &AlertRule{ID: id}
+	result, err := dbi.Model(rule).WherePK().Delete()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem deleting alert rule with ID %d", id)
+	} else if result.RowsAffected() <= 0 {
+		err = pkgerrors.Wrapf(ErrNotExists, "alert rule with ID %d does not exist", id)
+	}
+	return err
+}
+
+// Returns the alert rule by ID or nil if it does not exist.
+func GetAlertRule(dbi dbops.DBI, id int64) (*AlertRule, error) {
+	rule := &AlertRule{}
+	err := dbi.Model(rule).Where("id = ?", id).Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, pkgerrors.Wrapf(err, "problem getting alert rule with ID %d", id)
+	}
+	return rule, nil
+}
+
+// Returns all alert rules ordered by ID.
+func GetAllAlertRules(dbi dbops.DBI) ([]AlertRule, error) {
+	rules := []AlertRule{}
+	err := dbi.Model(&rules).OrderExpr("id ASC").Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrap(err, "problem getting alert rules")
+	}
+	return rules, nil
+}
+
+// Adds the alert to the database.
+func AddAlert(dbi dbops.DBI, alert *Alert) error {
+	_, err := dbi.Model(alert).Insert()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem adding alert for rule with ID %d", alert.RuleID)
+	}
+	return err
+}
+
+// Updates the value and the fired time of the alert.
+func UpdateAlert(dbi dbops.DBI, alert *Alert) error {
+	result, err := dbi.Model(alert).
+		Column("value", "fired_at", "subnet_id").
+		WherePK().
+		Update()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem updating alert with ID %d", alert.ID)
+	} else if result.RowsAffected() <= 0 {
+		err = pkgerrors.Wrapf(ErrNotExists, "alert with ID %d does not exist", alert.ID)
+	}
+	return err
+}
+
+// Deletes the alert from the database.
+func DeleteAlert(dbi dbops.DBI, id int64) error {
+	alert := &Alert{ID: id}
+	_, err := dbi.Model(alert).WherePK().Delete()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem deleting alert with ID %d", id)
+	}
+	return err
+}
+
+// Returns all alerts with their rules ordered by ID.
+func GetAllAlerts(dbi dbops.DBI) ([]Alert, error) {
+	alerts := []Alert{}
+	err := dbi.Model(&alerts).
+		Relation("Rule").
+		OrderExpr("alert.id ASC").
+		Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrap(err, "problem getting alerts")
+	}
+	return alerts, nil
+}
+
+// Returns a page of the alerts with their rules ordered by ID. If the
+// firing flag is specified, only the firing (true) or pending (false)
+// alerts are returned. A zero limit means that all alerts beginning
+// from the offset are returned. It returns the alerts and their total
+// number.
+func GetAlertsByPage(dbi dbops.DBI, offset, limit int64, firing *bool) ([]Alert, int64, error) {
+	alerts := []Alert{}
+	q := dbi.Model(&alerts).
+		Relation("Rule").
+		OrderExpr("alert.id ASC").
+		Offset(int(offset))
+
+	if firing != nil {
+		if *firing {
+			q = q.Where("alert.fired_at IS NOT NULL")
+		} else {
+			q = q.Where("alert.fired_at IS NULL")
+		}
+	}
+	if limit != 0 {
+		q = q.Limit(int(limit))
+	}
+
+	total, err := q.SelectAndCount()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, 0, pkgerrors.Wrap(err, "problem getting alerts")
+	}
+	return alerts, int64(total), nil
+}
@@ -0,0 +1,238 @@
+package dbmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test comparing the metric values with the rule threshold.
+func TestAlertRuleIsMet(t *testing.T) {
+	rule := &AlertRule{Threshold: 80}
+
+	rule.Operator = AlertOperatorGreater
+	require.True(t, rule.IsMet(81))
+	require.False(t, rule.IsMet(80))
+
+	rule.Operator = AlertOperatorGreaterOrEqual
+	require.True(t, rule.IsMet(80))
+	require.False(t, rule.IsMet(79))
+
+	rule.Operator = AlertOperatorLess
+	require.True(t, rule.IsMet(79))
+	require.False(t, rule.IsMet(80))
+
+	rule.Operator = AlertOperatorLessOrEqual
+	require.True(t, rule.IsMet(80))
+	require.False(t, rule.IsMet(81))
+
+	rule.Operator = AlertOperatorEqual
+	require.True(t, rule.IsMet(80))
+	require.False(t, rule.IsMet(81))
+
+	rule.Operator = AlertOperatorNotEqual
+	require.True(t, rule.IsMet(81))
+	require.False(t, rule.IsMet(80))
+
+	rule.Operator = "~"
+	require.False(t, rule.IsMet(80))
+}
+
+// Test validating the alert rules.
+func TestAlertRuleValidate(t *testing.T) {
+	rule := AlertRule{
+		Name:      "high utilization",
+		Metric:    AlertMetricSubnetAddressUtilization,
+		Operator:  AlertOperatorGreater,
+		Threshold: 90,
+		Duration:  300,
+		Severity:  EvWarning,
+	}
+	require.NoError(t, rule.Validate())
+
+	invalid := rule
+	invalid.Name = ""
+	require.Error(t, invalid.Validate())
+
+	invalid = rule
+	invalid.Metric = "foo"
+	require.Error(t, invalid.Validate())
+
+	invalid = rule
+	invalid.Operator = "=>"
+	require.Error(t, invalid.Validate())
+
+	invalid = rule
+	invalid.Duration = -1
+	require.Error(t, invalid.Validate())
+
+	invalid = rule
+	invalid.Severity = EvError + 1
+	require.Error(t, invalid.Validate())
+}
+
+// Test adding, updating, getting and deleting the alert rules.
+func TestAlertRules(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	rule := &AlertRule{
+		Name:      "unreachable",
+		Metric:    AlertMetricUnreachableMachines,
+		Operator:  AlertOperatorGreater,
+		Threshold: 0,
+		Severity:  EvError,
+		Enabled:   true,
+	}
+	err := AddAlertRule(db, rule)
+	require.NoError(t, err)
+	require.NotZero(t, rule.ID)
+
+	// The rule name must be unique.
+	err = AddAlertRule(db, &AlertRule{
+		Name:     "unreachable",
+		Metric:   AlertMetricConfigReviewIssues,
+		Operator: AlertOperatorGreater,
+	})
+	require.Error(t, err)
+
+	returned, err := GetAlertRule(db, rule.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, "unreachable", returned.Name)
+	require.Equal(t, AlertMetricUnreachableMachines, returned.Metric)
+	require.Zero(t, returned.Threshold)
+	require.EqualValues(t, EvError, returned.Severity)
+	require.True(t, returned.Enabled)
+	require.NotZero(t, returned.CreatedAt)
+
+	// Disable the rule and change the threshold.
+	returned.Enabled = false
+	returned.Threshold = 2
+	err = UpdateAlertRule(db, returned)
+	require.NoError(t, err)
+
+	rules, err := GetAllAlertRules(db)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.False(t, rules[0].Enabled)
+	require.EqualValues(t, 2, rules[0].Threshold)
+
+	// Non-existing rule.
+	returned, err = GetAlertRule(db, rule.ID+1)
+	require.NoError(t, err)
+	require.Nil(t, returned)
+
+	err = UpdateAlertRule(db, &AlertRule{ID: rule.ID + 1, Name: "foo"})
+	require.ErrorIs(t, err, ErrNotExists)
+
+	// Deleting the rule deletes its alerts.
+	err = AddAlert(db, &Alert{RuleID: rule.ID, StartedAt: time.Now().UTC()})
+	require.NoError(t, err)
+
+	err = DeleteAlertRule(db, rule.ID)
+	require.NoError(t, err)
+	err = DeleteAlertRule(db, rule.ID)
+	require.ErrorIs(t, err, ErrNotExists)
+
+	alerts, err := GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Empty(t, alerts)
+}
+
+// Test adding, updating, getting and deleting the alerts.
+func TestAlerts(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := &Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err := AddSubnet(db, subnet)
+	require.NoError(t, err)
+
+	rule := &AlertRule{
+		Name:      "high utilization",
+		Metric:    AlertMetricSubnetAddressUtilization,
+		Operator:  AlertOperatorGreater,
+		Threshold: 90,
+		Severity:  EvWarning,
+		Enabled:   true,
+	}
+	err = AddAlertRule(db, rule)
+	require.NoError(t, err)
+
+	startedAt := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	pending := &Alert{
+		RuleID:    rule.ID,
+		Label:     "192.0.2.0/24",
+		SubnetID:  &subnet.ID,
+		Value:     95,
+		StartedAt: startedAt,
+	}
+	err = AddAlert(db, pending)
+	require.NoError(t, err)
+	firing := &Alert{
+		RuleID:    rule.ID,
+		Label:     "192.0.3.0/24",
+		Value:     99,
+		StartedAt: startedAt,
+		FiredAt:   startedAt.Add(time.Minute),
+	}
+	err = AddAlert(db, firing)
+	require.NoError(t, err)
+
+	// Only one alert per rule and label is allowed.
+	err = AddAlert(db, &Alert{RuleID: rule.ID, Label: "192.0.2.0/24", StartedAt: startedAt})
+	require.Error(t, err)
+
+	alerts, total, err := GetAlertsByPage(db, 0, 10, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, alerts, 2)
+	require.NotNil(t, alerts[0].Rule)
+	require.Equal(t, "high utilization", alerts[0].Rule.Name)
+	require.NotNil(t, alerts[0].SubnetID)
+	require.Equal(t, subnet.ID, *alerts[0].SubnetID)
+	require.False(t, alerts[0].IsFiring())
+	require.True(t, alerts[1].IsFiring())
+
+	isFiring := true
+	alerts, total, err = GetAlertsByPage(db, 0, 10, &isFiring)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, firing.ID, alerts[0].ID)
+
+	isFiring = false
+	alerts, total, err = GetAlertsByPage(db, 0, 10, &isFiring)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, pending.ID, alerts[0].ID)
+
+	// Fire the pending alert.
+	pending.Value = 97
+	pending.FiredAt = startedAt.Add(2 * time.Minute)
+	err = UpdateAlert(db, pending)
+	require.NoError(t, err)
+
+	alerts, err = GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	require.EqualValues(t, 97, alerts[0].Value)
+	require.Equal(t, startedAt.Add(2*time.Minute), alerts[0].FiredAt)
+	require.Equal(t, startedAt, alerts[0].StartedAt)
+
+	// Deleting the subnet preserves the alert.
+	err = DeleteSubnet(db, subnet.ID)
+	require.NoError(t, err)
+
+	err = DeleteAlert(db, firing.ID)
+	require.NoError(t, err)
+
+	alerts, err = GetAllAlerts(db)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	require.Nil(t, alerts[0].SubnetID)
+}
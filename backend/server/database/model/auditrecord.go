@@ -0,0 +1,108 @@
+package dbmodel
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+	storkutil "isc.org/stork/util"
+)
+
+// Type of the object modified by the audited operation.
+type AuditTargetType string
+
+const (
+	AuditTargetHost          AuditTargetType = "host"
+	AuditTargetDaemon        AuditTargetType = "daemon"
+	AuditTargetMachine       AuditTargetType = "machine"
+	AuditTargetSettings      AuditTargetType = "settings"
+	AuditTargetUser          AuditTargetType = "user"
+	AuditTargetConfigChecker AuditTargetType = "config_checker"
+	AuditTargetAlertRule     AuditTargetType = "alert_rule"
+	AuditTargetWebhook       AuditTargetType = "webhook"
+	AuditTargetSubnet        AuditTargetType = "subnet"
+	AuditTargetSharedNetwork AuditTargetType = "shared_network"
+	AuditTargetConfigChange  AuditTargetType = "config_change"
+)
+
+// Represents a single record of the audit trail. It describes a change
+// made by a user through the REST API. The changes are the differences
+// between the modified object before and after the operation. The user
+// login is held in the record so the record remains meaningful after
+// deleting the user.
+type AuditRecord struct {
+	ID          int64
+	CreatedAt   time.Time
+	UserID      int64
+	UserLogin   string
+	SourceIP    string
+	OperationID string
+	TargetType  AuditTargetType
+	TargetID    int64
+	Changes     []storkutil.JSONDiffChange
+}
+
+// Criteria used to select the audit records. The nil criteria are
+// ignored. The from and to times specify the range of the creation
+// times of the records, inclusive.
+type AuditRecordFilters struct {
+	UserID      *int64
+	OperationID *string
+	TargetType  *string
+	TargetID    *int64
+	From        *time.Time
+	To          *time.Time
+}
+
+// Inserts the audit record into the database.
+func AddAuditRecord(dbi dbops.DBI, record *AuditRecord) error {
+	if _, err := dbi.Model(record).Insert(); err != nil {
+		return pkgerrors.Wrapf(err, "problem adding audit record of the %s operation", record.OperationID)
+	}
+	return nil
+}
+
+// Returns a page of the audit records matching the filters. The records
+// are ordered from the most recent. The offset and limit specify the
+// beginning of the page and the maximum size of the page. A zero limit
+// means that all matching records beginning from the offset are returned.
+// It returns the records and their total number.
+func GetAuditRecordsByPage(dbi dbops.DBI, offset, limit int64, filters *AuditRecordFilters) ([]AuditRecord, int64, error) {
+	records := []AuditRecord{}
+	q := dbi.Model(&records).
+		OrderExpr("audit_record.created_at DESC").
+		OrderExpr("audit_record.id DESC").
+		Offset(int(offset))
+
+	if filters != nil {
+		if filters.UserID != nil {
+			q = q.Where("audit_record.user_id = ?", *filters.UserID)
+		}
+		if filters.OperationID != nil {
+			q = q.Where("audit_record.operation_id = ?", *filters.OperationID)
+		}
+		if filters.TargetType != nil {
+			q = q.Where("audit_record.target_type = ?", *filters.TargetType)
+		}
+		if filters.TargetID != nil {
+			q = q.Where("audit_record.target_id = ?", *filters.TargetID)
+		}
+		if filters.From != nil {
+			q = q.Where("audit_record.created_at >= ?", *filters.From)
+		}
+		if filters.To != nil {
+			q = q.Where("audit_record.created_at <= ?", *filters.To)
+		}
+	}
+	if limit != 0 {
+		q = q.Limit(int(limit))
+	}
+
+	total, err := q.SelectAndCount()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, 0, pkgerrors.Wrapf(err, "problem getting audit records")
+	}
+	return records, int64(total), nil
+}
@@ -0,0 +1,164 @@
+package dbmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbtest "isc.org/stork/server/database/test"
+	storkutil "isc.org/stork/util"
+)
+
+// Test adding and filtering the audit records.
+func TestGetAuditRecordsByPage(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 1)
+
+	records := []*AuditRecord{
+		{
+			UserID:      int64(users[0].ID),
+			UserLogin:   users[0].Login,
+			SourceIP:    "192.0.2.1",
+			OperationID: "updateSettings",
+			TargetType:  AuditTargetSettings,
+			Changes: []storkutil.JSONDiffChange{
+				{
+					Path:      "/grafana_url",
+					Operation: storkutil.JSONDiffOperationReplace,
+					OldValue:  "",
+					NewValue:  "http://localhost:3000",
+				},
+			},
+		},
+		{
+			UserID:      int64(users[0].ID),
+			UserLogin:   users[0].Login,
+			SourceIP:    "192.0.2.1",
+			OperationID: "updateDaemon",
+			TargetType:  AuditTargetDaemon,
+			TargetID:    5,
+			Changes: []storkutil.JSONDiffChange{
+				{
+					Path:      "/monitored",
+					Operation: storkutil.JSONDiffOperationReplace,
+					OldValue:  true,
+					NewValue:  false,
+				},
+			},
+		},
+		{
+			OperationID: "createMachine",
+			TargetType:  AuditTargetMachine,
+			TargetID:    3,
+		},
+	}
+	for _, record := range records {
+		err := AddAuditRecord(db, record)
+		require.NoError(t, err)
+		require.NotZero(t, record.ID)
+	}
+
+	// Get all records. The most recent go first.
+	returned, total, err := GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, returned, 3)
+	require.Equal(t, records[2].ID, returned[0].ID)
+	require.Equal(t, records[1].ID, returned[1].ID)
+	require.Equal(t, records[0].ID, returned[2].ID)
+	require.NotZero(t, returned[0].CreatedAt)
+
+	// Check the record contents.
+	require.EqualValues(t, users[0].ID, returned[1].UserID)
+	require.Equal(t, users[0].Login, returned[1].UserLogin)
+	require.Equal(t, "192.0.2.1", returned[1].SourceIP)
+	require.Equal(t, "updateDaemon", returned[1].OperationID)
+	require.Equal(t, AuditTargetDaemon, returned[1].TargetType)
+	require.EqualValues(t, 5, returned[1].TargetID)
+	require.Len(t, returned[1].Changes, 1)
+	require.Equal(t, "/monitored", returned[1].Changes[0].Path)
+	require.Equal(t, storkutil.JSONDiffOperationReplace, returned[1].Changes[0].Operation)
+	require.Equal(t, true, returned[1].Changes[0].OldValue)
+	require.Equal(t, false, returned[1].Changes[0].NewValue)
+
+	// The record without user and changes.
+	require.Zero(t, returned[0].UserID)
+	require.Empty(t, returned[0].UserLogin)
+	require.Empty(t, returned[0].Changes)
+
+	// Get a page.
+	returned, total, err = GetAuditRecordsByPage(db, 1, 1, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, returned, 1)
+	require.Equal(t, records[1].ID, returned[0].ID)
+
+	// Filter by user.
+	userID := int64(users[0].ID)
+	returned, total, err = GetAuditRecordsByPage(db, 0, 0, &AuditRecordFilters{UserID: &userID})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, returned, 2)
+
+	// Filter by operation.
+	operationID := "updateSettings"
+	returned, total, err = GetAuditRecordsByPage(db, 0, 0, &AuditRecordFilters{OperationID: &operationID})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, records[0].ID, returned[0].ID)
+
+	// Filter by target.
+	targetType := string(AuditTargetMachine)
+	targetID := int64(3)
+	returned, total, err = GetAuditRecordsByPage(db, 0, 0, &AuditRecordFilters{TargetType: &targetType, TargetID: &targetID})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, records[2].ID, returned[0].ID)
+
+	targetID = 4
+	returned, total, err = GetAuditRecordsByPage(db, 0, 0, &AuditRecordFilters{TargetType: &targetType, TargetID: &targetID})
+	require.NoError(t, err)
+	require.Zero(t, total)
+	require.Empty(t, returned)
+
+	// Filter by time.
+	from := storkutil.UTCNow().Add(-time.Hour)
+	to := storkutil.UTCNow().Add(time.Hour)
+	returned, total, err = GetAuditRecordsByPage(db, 0, 0, &AuditRecordFilters{From: &from, To: &to})
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, returned, 3)
+
+	returned, total, err = GetAuditRecordsByPage(db, 0, 0, &AuditRecordFilters{To: &from})
+	require.NoError(t, err)
+	require.Zero(t, total)
+	require.Empty(t, returned)
+}
+
+// Test that the audit records are preserved when the user is deleted.
+func TestAuditRecordUserDeleted(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 1)
+
+	record := &AuditRecord{
+		UserID:      int64(users[0].ID),
+		UserLogin:   users[0].Login,
+		OperationID: "updateSettings",
+		TargetType:  AuditTargetSettings,
+	}
+	err := AddAuditRecord(db, record)
+	require.NoError(t, err)
+
+	_, err = db.Model(users[0]).WherePK().Delete()
+	require.NoError(t, err)
+
+	returned, total, err := GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Zero(t, returned[0].UserID)
+	require.Equal(t, users[0].Login, returned[0].UserLogin)
+}
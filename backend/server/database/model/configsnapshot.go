@@ -0,0 +1,132 @@
+package dbmodel
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+)
+
+// Indicates how the configuration change captured in the snapshot
+// has been detected.
+type ConfigSnapshotSource string
+
+const (
+	// The configuration change has been detected by the periodic
+	// state puller.
+	ConfigSnapshotSourceStatePuller ConfigSnapshotSource = "state_puller"
+	// The configuration change has been detected while fetching the
+	// machine state on user's request (e.g., machine refresh).
+	ConfigSnapshotSourceUserRequest ConfigSnapshotSource = "user_request"
+)
+
+// Represents a daemon's configuration snapshot. A new snapshot is taken
+// whenever Stork detects that the daemon's configuration has changed.
+// The snapshots constitute the daemon's configuration history.
+type ConfigSnapshot struct {
+	ID         int64
+	CreatedAt  time.Time
+	DaemonID   int64
+	Config     *KeaConfig
+	ConfigHash string
+	Source     ConfigSnapshotSource
+}
+
+// Inserts the configuration snapshot into the database.
+func AddConfigSnapshot(dbi dbops.DBI, snapshot *ConfigSnapshot) error {
+	if _, err := dbi.Model(snapshot).Insert(); err != nil {
+		return pkgerrors.Wrapf(err, "problem adding configuration snapshot for daemon %d", snapshot.DaemonID)
+	}
+	return nil
+}
+
+// Inserts the snapshot of the daemon's current configuration into the
+// database unless the configuration is the same as in the most recent
+// snapshot of this daemon. The configurations are compared using their
+// hashes. It returns the inserted snapshot or nil if no snapshot was
+// inserted.
+func AddConfigSnapshotIfChanged(dbi dbops.DBI, daemon *Daemon, source ConfigSnapshotSource) (*ConfigSnapshot, error) {
+	if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+		return nil, nil
+	}
+	latest, err := GetLatestConfigSnapshot(dbi, daemon.ID)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && len(daemon.KeaDaemon.ConfigHash) > 0 && latest.ConfigHash == daemon.KeaDaemon.ConfigHash {
+		return nil, nil
+	}
+	snapshot := &ConfigSnapshot{
+		DaemonID:   daemon.ID,
+		Config:     daemon.KeaDaemon.Config,
+		ConfigHash: daemon.KeaDaemon.ConfigHash,
+		Source:     source,
+	}
+	if err = AddConfigSnapshot(dbi, snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Fetches the most recent configuration snapshot of the daemon. It
+// returns nil if there are no snapshots for the daemon.
+func GetLatestConfigSnapshot(dbi dbops.DBI, daemonID int64) (*ConfigSnapshot, error) {
+	snapshot := &ConfigSnapshot{}
+	err := dbi.Model(snapshot).
+		Where("config_snapshot.daemon_id = ?", daemonID).
+		OrderExpr("config_snapshot.id DESC").
+		Limit(1).
+		Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, pkgerrors.Wrapf(err, "problem getting latest configuration snapshot for daemon %d", daemonID)
+	}
+	return snapshot, nil
+}
+
+// Fetches the configuration snapshot by ID. It returns nil if the snapshot
+// does not exist.
+func GetConfigSnapshot(dbi dbops.DBI, snapshotID int64) (*ConfigSnapshot, error) {
+	snapshot := &ConfigSnapshot{}
+	err := dbi.Model(snapshot).
+		Where("config_snapshot.id = ?", snapshotID).
+		Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, pkgerrors.Wrapf(err, "problem getting configuration snapshot with ID %d", snapshotID)
+	}
+	return snapshot, nil
+}
+
+// Fetches a collection of the daemon's configuration snapshots from the
+// database, from the most recent to the oldest one. The configurations
+// are not fetched to limit the amount of the returned data. The offset
+// and limit specify the beginning of the page and the maximum size of
+// the page. A zero limit means that all snapshots beginning from the
+// offset are returned. It returns the snapshots and the total number
+// of the daemon's snapshots.
+func GetConfigSnapshotsByDaemonID(dbi dbops.DBI, offset, limit int64, daemonID int64) ([]ConfigSnapshot, int64, error) {
+	var snapshots []ConfigSnapshot
+	q := dbi.Model(&snapshots).
+		ExcludeColumn("config").
+		Where("config_snapshot.daemon_id = ?", daemonID).
+		OrderExpr("config_snapshot.id DESC").
+		Offset(int(offset))
+
+	if limit != 0 {
+		q = q.Limit(int(limit))
+	}
+
+	total, err := q.SelectAndCount()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		err = pkgerrors.Wrapf(err, "problem getting configuration snapshots for daemon %d", daemonID)
+		return nil, 0, err
+	}
+	return snapshots, int64(total), nil
+}
@@ -0,0 +1,161 @@
+package dbmodel
+
+import (
+	"fmt"
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	dbops "isc.org/stork/server/database"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Adds a machine and a Kea app with a DHCPv4 daemon having a configuration.
+func addTestConfigSnapshotDaemon(t *testing.T, db *dbops.PgDB) *Daemon {
+	machine := &Machine{
+		Address:   "localhost",
+		AgentPort: 8080,
+	}
+	err := AddMachine(db, machine)
+	require.NoError(t, err)
+
+	daemon := NewKeaDaemon("dhcp4", true)
+	err = daemon.SetConfigFromJSON(`{"Dhcp4": {"valid-lifetime": 3600}}`)
+	require.NoError(t, err)
+
+	app := &App{
+		Type:      AppTypeKea,
+		MachineID: machine.ID,
+		Daemons:   []*Daemon{daemon},
+	}
+	daemons, err := AddApp(db, app)
+	require.NoError(t, err)
+	require.Len(t, daemons, 1)
+	return daemons[0]
+}
+
+// Test that the configuration snapshots are added only when the daemon's
+// configuration changes.
+func TestAddConfigSnapshotIfChanged(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestConfigSnapshotDaemon(t, db)
+
+	// There are no snapshots yet.
+	latest, err := GetLatestConfigSnapshot(db, daemon.ID)
+	require.NoError(t, err)
+	require.Nil(t, latest)
+
+	// The first snapshot should be added.
+	snapshot, err := AddConfigSnapshotIfChanged(db, daemon, ConfigSnapshotSourceStatePuller)
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+	require.NotZero(t, snapshot.ID)
+
+	// The configuration hasn't changed so no new snapshot is added.
+	snapshot, err = AddConfigSnapshotIfChanged(db, daemon, ConfigSnapshotSourceStatePuller)
+	require.NoError(t, err)
+	require.Nil(t, snapshot)
+
+	// Change the configuration. The new snapshot should be added.
+	err = daemon.SetConfigFromJSON(`{"Dhcp4": {"valid-lifetime": 7200}}`)
+	require.NoError(t, err)
+	snapshot, err = AddConfigSnapshotIfChanged(db, daemon, ConfigSnapshotSourceUserRequest)
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+
+	// The latest snapshot should hold the new configuration.
+	latest, err = GetLatestConfigSnapshot(db, daemon.ID)
+	require.NoError(t, err)
+	require.NotNil(t, latest)
+	require.Equal(t, snapshot.ID, latest.ID)
+	require.Equal(t, daemon.KeaDaemon.ConfigHash, latest.ConfigHash)
+	require.Equal(t, ConfigSnapshotSourceUserRequest, latest.Source)
+	require.NotNil(t, latest.Config)
+	require.EqualValues(t, 7200, (*latest.Config.Map)["Dhcp4"].(map[string]interface{})["valid-lifetime"])
+	require.NotZero(t, latest.CreatedAt)
+
+	// Get the snapshot by ID.
+	returned, err := GetConfigSnapshot(db, snapshot.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, snapshot.ID, returned.ID)
+
+	// Non-existing snapshot.
+	returned, err = GetConfigSnapshot(db, snapshot.ID+100)
+	require.NoError(t, err)
+	require.Nil(t, returned)
+}
+
+// Test that the daemon without configuration has no snapshots.
+func TestAddConfigSnapshotIfChangedNoConfig(t *testing.T) {
+	snapshot, err := AddConfigSnapshotIfChanged(nil, NewKeaDaemon("dhcp4", true), ConfigSnapshotSourceStatePuller)
+	require.NoError(t, err)
+	require.Nil(t, snapshot)
+}
+
+// Test getting paged configuration snapshots of the daemon.
+func TestGetConfigSnapshotsByDaemonID(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestConfigSnapshotDaemon(t, db)
+
+	for i := 0; i < 5; i++ {
+		err := daemon.SetConfigFromJSON(fmt.Sprintf(`{"Dhcp4": {"valid-lifetime": %d}}`, 1000+i))
+		require.NoError(t, err)
+		snapshot, err := AddConfigSnapshotIfChanged(db, daemon, ConfigSnapshotSourceStatePuller)
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+	}
+
+	// Get all snapshots.
+	snapshots, total, err := GetConfigSnapshotsByDaemonID(db, 0, 0, daemon.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, total)
+	require.Len(t, snapshots, 5)
+
+	// The snapshots should be ordered from the most recent one and
+	// lack the configurations.
+	for i := 1; i < len(snapshots); i++ {
+		require.Greater(t, snapshots[i-1].ID, snapshots[i].ID)
+	}
+	for _, snapshot := range snapshots {
+		require.Nil(t, snapshot.Config)
+		require.NotEmpty(t, snapshot.ConfigHash)
+	}
+
+	// Get a page.
+	page, total, err := GetConfigSnapshotsByDaemonID(db, 2, 2, daemon.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, total)
+	require.Len(t, page, 2)
+	require.Equal(t, snapshots[2].ID, page[0].ID)
+	require.Equal(t, snapshots[3].ID, page[1].ID)
+
+	// Other daemon has no snapshots.
+	snapshots, total, err = GetConfigSnapshotsByDaemonID(db, 0, 0, daemon.ID+1)
+	require.NoError(t, err)
+	require.Zero(t, total)
+	require.Empty(t, snapshots)
+}
+
+// Test that the snapshots are deleted together with the daemon.
+func TestDeleteAppWithConfigSnapshots(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	daemon := addTestConfigSnapshotDaemon(t, db)
+	snapshot, err := AddConfigSnapshotIfChanged(db, daemon, ConfigSnapshotSourceStatePuller)
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+
+	app, err := GetAppByID(db, daemon.AppID)
+	require.NoError(t, err)
+	err = DeleteApp(db, app)
+	require.NoError(t, err)
+
+	returned, err := GetConfigSnapshot(db, snapshot.ID)
+	require.NoError(t, err)
+	require.Nil(t, returned)
+}
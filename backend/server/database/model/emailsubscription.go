@@ -0,0 +1,85 @@
+package dbmodel
+
+import (
+	"errors"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+)
+
+// Represents the preferences of a user receiving the events by email.
+// The events are filtered by the level and the related machine, app,
+// daemon and subnet like for the SSE subscribers. The zero filter values
+// match all events. The matching events are sent immediately or
+// periodically in a single digest email.
+type EmailSubscription struct {
+	UserID    int   `pg:",pk"`
+	Enabled   bool  `pg:",use_zero"`
+	Digest    bool  `pg:",use_zero"`
+	Level     int   `pg:",use_zero"`
+	MachineID int64 `pg:",use_zero"`
+	AppID     int64 `pg:",use_zero"`
+	DaemonID  int64 `pg:",use_zero"`
+	SubnetID  int64 `pg:",use_zero"`
+
+	User *SystemUser `pg:"rel:has-one"`
+}
+
+// Checks if the level and the filters of the subscription are valid.
+func (subscription *EmailSubscription) Validate() error {
+	if subscription.Level < EvInfo || subscription.Level > EvError {
+		return pkgerrors.Errorf("invalid email subscription level %d", subscription.Level)
+	}
+	if subscription.MachineID < 0 || subscription.AppID < 0 || subscription.DaemonID < 0 || subscription.SubnetID < 0 {
+		return pkgerrors.New("email subscription filters must not be negative")
+	}
+	return nil
+}
+
+// Inserts or updates the email subscription of the user.
+func UpsertEmailSubscription(dbi dbops.DBI, subscription *EmailSubscription) error {
+	_, err := dbi.Model(subscription).
+		OnConflict("(user_id) DO UPDATE").
+		Set("enabled = EXCLUDED.enabled").
+		Set("digest = EXCLUDED.digest").
+		Set("level = EXCLUDED.level").
+		Set("machine_id = EXCLUDED.machine_id").
+		Set("app_id = EXCLUDED.app_id").
+		Set("daemon_id = EXCLUDED.daemon_id").
+		Set("subnet_id = EXCLUDED.subnet_id").
+		Insert()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem upserting email subscription of user with ID %d", subscription.UserID)
+	}
+	return err
+}
+
+// Returns the email subscription of the user or nil if the user has no
+// subscription.
+func GetEmailSubscription(dbi dbops.DBI, userID int) (*EmailSubscription, error) {
+	subscription := &EmailSubscription{}
+	err := dbi.Model(subscription).Where("user_id = ?", userID).Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, pkgerrors.Wrapf(err, "problem getting email subscription of user with ID %d", userID)
+	}
+	return subscription, nil
+}
+
+// Returns the enabled email subscriptions with the users ordered by
+// the user ID.
+func GetEnabledEmailSubscriptions(dbi dbops.DBI) ([]EmailSubscription, error) {
+	subscriptions := []EmailSubscription{}
+	err := dbi.Model(&subscriptions).
+		Relation("User").
+		Where("email_subscription.enabled").
+		OrderExpr("email_subscription.user_id ASC").
+		Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrap(err, "problem getting enabled email subscriptions")
+	}
+	return subscriptions, nil
+}
@@ -0,0 +1,104 @@
+package dbmodel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test validating the email subscriptions.
+func TestEmailSubscriptionValidate(t *testing.T) {
+	subscription := EmailSubscription{
+		Enabled: true,
+		Level:   EvError,
+		AppID:   1,
+	}
+	require.NoError(t, subscription.Validate())
+
+	invalid := subscription
+	invalid.Level = -1
+	require.Error(t, invalid.Validate())
+
+	invalid = subscription
+	invalid.SubnetID = -1
+	require.Error(t, invalid.Validate())
+}
+
+// Test inserting, updating and getting the email subscriptions.
+func TestEmailSubscriptions(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := []*SystemUser{
+		{Login: "first", Email: "first@example.org", Lastname: "Doe", Name: "John"},
+		{Login: "second", Email: "second@example.org", Lastname: "Doe", Name: "Jane"},
+	}
+	for _, user := range users {
+		con, err := CreateUser(db, user)
+		require.False(t, con)
+		require.NoError(t, err)
+	}
+
+	// No subscription yet.
+	subscription, err := GetEmailSubscription(db, users[0].ID)
+	require.NoError(t, err)
+	require.Nil(t, subscription)
+
+	err = UpsertEmailSubscription(db, &EmailSubscription{
+		UserID:    users[0].ID,
+		Enabled:   true,
+		Level:     EvWarning,
+		MachineID: 1,
+	})
+	require.NoError(t, err)
+	err = UpsertEmailSubscription(db, &EmailSubscription{
+		UserID: users[1].ID,
+	})
+	require.NoError(t, err)
+
+	subscription, err = GetEmailSubscription(db, users[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subscription)
+	require.True(t, subscription.Enabled)
+	require.False(t, subscription.Digest)
+	require.EqualValues(t, EvWarning, subscription.Level)
+	require.EqualValues(t, 1, subscription.MachineID)
+
+	subscriptions, err := GetEnabledEmailSubscriptions(db)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	require.Equal(t, users[0].ID, subscriptions[0].UserID)
+	require.NotNil(t, subscriptions[0].User)
+	require.Equal(t, "first@example.org", subscriptions[0].User.Email)
+
+	// Update the subscriptions.
+	err = UpsertEmailSubscription(db, &EmailSubscription{
+		UserID:  users[0].ID,
+		Enabled: true,
+		Digest:  true,
+	})
+	require.NoError(t, err)
+	err = UpsertEmailSubscription(db, &EmailSubscription{
+		UserID:  users[1].ID,
+		Enabled: true,
+		Level:   EvError,
+	})
+	require.NoError(t, err)
+
+	subscriptions, err = GetEnabledEmailSubscriptions(db)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 2)
+	require.True(t, subscriptions[0].Digest)
+	require.Zero(t, subscriptions[0].Level)
+	require.Zero(t, subscriptions[0].MachineID)
+	require.Equal(t, "second@example.org", subscriptions[1].User.Email)
+	require.EqualValues(t, EvError, subscriptions[1].Level)
+
+	// The subscription is deleted together with the user.
+	_, err = db.Model(users[1]).WherePK().Delete()
+	require.NoError(t, err)
+	subscription, err = GetEmailSubscription(db, users[1].ID)
+	require.NoError(t, err)
+	require.Nil(t, subscription)
+}
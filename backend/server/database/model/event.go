@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
 )
 
 // Event levels.
@@ -24,19 +26,33 @@ type Relations struct {
 	UserID    int64 `json:",omitempty"`
 }
 
-// Represents an event held in event table in the database.
+// Represents an event held in event table in the database. The repeated
+// events are merged into one event. The creation time is the time when
+// the event was first seen. The template is the event text before the
+// object tags were substituted. The recovery events point to the failure
+// events they resolve.
 type Event struct {
-	ID        int64
-	CreatedAt time.Time
-	Text      string
-	Level     int `pg:",use_zero"`
-	Relations *Relations
-	Details   string
+	ID         int64
+	CreatedAt  time.Time
+	Text       string
+	Level      int `pg:",use_zero"`
+	Relations  *Relations
+	Details    string
+	Template   string
+	Count      int64
+	LastSeenAt time.Time
+	ResolvesID int64
 }
 
 // Add given event to the database.
-func AddEvent(db *pg.DB, event *Event) error {
-	_, err := db.Model(event).Insert()
+func AddEvent(dbi dbops.DBI, event *Event) error {
+	if event.Count == 0 {
+		event.Count = 1
+	}
+	if event.LastSeenAt.IsZero() {
+		event.LastSeenAt = event.CreatedAt
+	}
+	_, err := dbi.Model(event).Insert()
 	if err != nil {
 		err = pkgerrors.Wrapf(err, "problem inserting event %+v", event)
 	}
@@ -96,3 +112,147 @@ func GetEventsByPage(db *pg.DB, offset int64, limit int64, level int64, daemonTy
 	}
 	return events, int64(total), nil
 }
+
+// Deletes at most limit oldest events of the given level last seen before
+// the specified time. It returns the deleted events.
+func DeleteEventsBefore(dbi dbops.DBI, level int, before time.Time, limit int64) ([]Event, error) {
+	events := []Event{}
+	_, err := dbi.Model(&events).
+		Where("id IN (SELECT id FROM event WHERE level = ? AND last_seen_at < ? ORDER BY id LIMIT ?)", level, before, limit).
+		Returning("*").
+		Delete()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrapf(err, "problem deleting events with level %d last seen before %s", level, before)
+	}
+	return events, nil
+}
+
+// Deletes at most limit oldest events of the given level exceeding the
+// specified number of events of this level. It returns the deleted events.
+func DeleteEventsExceedingCount(dbi dbops.DBI, level int, maxCount int64, limit int64) ([]Event, error) {
+	events := []Event{}
+	_, err := dbi.Model(&events).
+		Where(`id IN (SELECT id FROM event WHERE level = ? AND id NOT IN
+			(SELECT id FROM event WHERE level = ? ORDER BY id DESC LIMIT ?)
+			ORDER BY id LIMIT ?)`, level, level, maxCount, limit).
+		Returning("*").
+		Delete()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrapf(err, "problem deleting events with level %d exceeding count %d", level, maxCount)
+	}
+	return events, nil
+}
+
+// Adds a condition matching the events with the given relations to the
+// query.
+func whereEventRelations(q *orm.Query, relations *Relations) *orm.Query {
+	if relations == nil {
+		return q.Where("event.relations IS NULL")
+	}
+	return q.Where("event.relations = ?::jsonb", relations)
+}
+
+// Adds a condition matching the events not resolved by any other event
+// to the query.
+func whereEventUnresolved(q *orm.Query) *orm.Query {
+	return q.Where("NOT EXISTS (SELECT 1 FROM event AS recovery WHERE recovery.resolves_id = event.id)")
+}
+
+// Returns the most recent unresolved event having the same template,
+// level and relations as the specified event and last seen not earlier
+// than the specified time. It returns nil if there is no such event.
+func GetDuplicateEvent(dbi dbops.DBI, event *Event, since time.Time) (*Event, error) {
+	duplicate := &Event{}
+	q := dbi.Model(duplicate).
+		Where("event.template = ?", event.Template).
+		Where("event.level = ?", event.Level).
+		Where("event.last_seen_at >= ?", since)
+	q = whereEventRelations(q, event.Relations)
+	q = whereEventUnresolved(q)
+	err := q.OrderExpr("event.id DESC").Limit(1).For("UPDATE").Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, pkgerrors.Wrapf(err, "problem getting duplicate of event %q", event.Text)
+	}
+	return duplicate, nil
+}
+
+// Returns the most recent unresolved event with the specified relations
+// and the template starting with one of the specified prefixes. It returns
+// nil if there is no such event.
+func GetUnresolvedEvent(dbi dbops.DBI, templatePrefixes []string, relations *Relations) (*Event, error) {
+	if len(templatePrefixes) == 0 {
+		return nil, nil
+	}
+	event := &Event{}
+	q := dbi.Model(event).
+		WhereGroup(func(q *orm.Query) (*orm.Query, error) {
+			for _, prefix := range templatePrefixes {
+				q = q.WhereOr("left(event.template, length(?)) = ?", prefix, prefix)
+			}
+			return q, nil
+		})
+	q = whereEventRelations(q, relations)
+	q = whereEventUnresolved(q)
+	err := q.OrderExpr("event.id DESC").Limit(1).Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, pkgerrors.Wrapf(err, "problem getting unresolved event")
+	}
+	return event, nil
+}
+
+// Records another occurrence of the event. It updates the count, the time
+// when the event was last seen, the text and the details.
+func UpdateEventOccurrence(dbi dbops.DBI, event *Event) error {
+	result, err := dbi.Model(event).
+		Column("count", "last_seen_at", "text", "details").
+		WherePK().
+		Update()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem updating event with ID %d", event.ID)
+	} else if result.RowsAffected() <= 0 {
+		return pkgerrors.Wrapf(ErrNotExists, "event with ID %d does not exist", event.ID)
+	}
+	return nil
+}
+
+// Returns the events with the IDs greater than the specified ID. The level
+// indicates the lowest level of the returned events. The non-zero
+// relations select the events related to the specified objects. At most
+// limit most recent events are returned. The events are ordered by ID.
+func GetEventsAfter(dbi dbops.DBI, id int64, level int, relations *Relations, limit int) ([]Event, error) {
+	events := []Event{}
+	q := dbi.Model(&events).Where("event.id > ?", id)
+	if level > 0 {
+		q = q.Where("event.level >= ?", level)
+	}
+	if relations != nil {
+		filters := []struct {
+			name string
+			id   int64
+		}{
+			{"MachineID", relations.MachineID},
+			{"AppID", relations.AppID},
+			{"SubnetID", relations.SubnetID},
+			{"DaemonID", relations.DaemonID},
+			{"UserID", relations.UserID},
+		}
+		for _, filter := range filters {
+			if filter.id != 0 {
+				q = q.Where("CAST (event.relations->>? AS INTEGER) = ?", filter.name, filter.id)
+			}
+		}
+	}
+	err := q.OrderExpr("event.id DESC").Limit(limit).Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrapf(err, "problem getting events after ID %d", id)
+	}
+	// Return the events in the order they were added.
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
@@ -2,6 +2,7 @@ package dbmodel
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	dbtest "isc.org/stork/server/database/test"
@@ -167,3 +168,206 @@ func TestEvent(t *testing.T) {
 	require.NotNil(t, events)
 	require.Empty(t, events)
 }
+
+// Test deleting the events created before the specified time.
+func TestDeleteEventsBefore(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	now := time.Now().UTC()
+	events := []*Event{
+		{Text: "old info", Level: EvInfo, CreatedAt: now.Add(-48 * time.Hour)},
+		{Text: "older info", Level: EvInfo, CreatedAt: now.Add(-72 * time.Hour)},
+		{Text: "new info", Level: EvInfo, CreatedAt: now},
+		{Text: "old error", Level: EvError, CreatedAt: now.Add(-48 * time.Hour)},
+	}
+	for _, event := range events {
+		require.NoError(t, AddEvent(db, event))
+	}
+
+	// The number of deleted events is limited.
+	deleted, err := DeleteEventsBefore(db, EvInfo, now.Add(-24*time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Equal(t, events[0].ID, deleted[0].ID)
+	require.Equal(t, "old info", deleted[0].Text)
+
+	// Only the old info events are deleted.
+	deleted, err = DeleteEventsBefore(db, EvInfo, now.Add(-24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Equal(t, events[1].ID, deleted[0].ID)
+
+	// Nothing more to delete.
+	deleted, err = DeleteEventsBefore(db, EvInfo, now.Add(-24*time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+
+	_, total, err := GetEventsByPage(db, 0, 10, EvInfo, nil, nil, nil, nil, "", SortDirAny)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+}
+
+// Test deleting the oldest events exceeding the specified count.
+func TestDeleteEventsExceedingCount(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, AddEvent(db, &Event{Text: "warning", Level: EvWarning}))
+	}
+	require.NoError(t, AddEvent(db, &Event{Text: "error", Level: EvError}))
+
+	// The number of deleted events is limited.
+	deleted, err := DeleteEventsExceedingCount(db, EvWarning, 3, 1)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	oldestID := deleted[0].ID
+
+	// The two oldest warnings are deleted.
+	deleted, err = DeleteEventsExceedingCount(db, EvWarning, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	require.Greater(t, deleted[0].ID, oldestID)
+
+	events, total, err := GetEventsByPage(db, 0, 10, EvWarning, nil, nil, nil, nil, "", SortDirAny)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, total)
+	for _, event := range events {
+		for _, d := range deleted {
+			require.Greater(t, event.ID, d.ID)
+		}
+	}
+
+	// The count is not exceeded.
+	deleted, err = DeleteEventsExceedingCount(db, EvWarning, 3, 10)
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+}
+
+// Test finding the duplicates and the unresolved events and recording
+// the event occurrences.
+func TestEventDeduplication(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	now := time.Now().UTC()
+	failure := &Event{
+		Text:      "communication failed",
+		Template:  "Communication with {daemon} failed",
+		Level:     EvError,
+		Relations: &Relations{DaemonID: 1},
+		CreatedAt: now,
+	}
+	require.NoError(t, AddEvent(db, failure))
+	require.EqualValues(t, 1, failure.Count)
+	require.Equal(t, now, failure.LastSeenAt)
+
+	// Find the duplicate.
+	event := &Event{
+		Template:  failure.Template,
+		Level:     EvError,
+		Relations: &Relations{DaemonID: 1},
+	}
+	duplicate, err := GetDuplicateEvent(db, event, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.NotNil(t, duplicate)
+	require.Equal(t, failure.ID, duplicate.ID)
+
+	// The duplicate was last seen too long ago.
+	duplicate, err = GetDuplicateEvent(db, event, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Nil(t, duplicate)
+
+	// Different relations.
+	event.Relations = &Relations{DaemonID: 2}
+	duplicate, err = GetDuplicateEvent(db, event, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Nil(t, duplicate)
+
+	// Record another occurrence.
+	failure.Count++
+	failure.LastSeenAt = now.Add(time.Minute)
+	failure.Details = "timeout"
+	require.NoError(t, UpdateEventOccurrence(db, failure))
+	events, _, err := GetEventsByPage(db, 0, 10, EvInfo, nil, nil, nil, nil, "", SortDirAny)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.EqualValues(t, 2, events[0].Count)
+	require.Equal(t, "timeout", events[0].Details)
+	require.WithinDuration(t, now.Add(time.Minute), events[0].LastSeenAt, time.Millisecond)
+
+	// Find the unresolved failure by the template prefix.
+	unresolved, err := GetUnresolvedEvent(db, []string{"foo", "Communication with {daemon}"}, &Relations{DaemonID: 1})
+	require.NoError(t, err)
+	require.NotNil(t, unresolved)
+	require.Equal(t, failure.ID, unresolved.ID)
+
+	// Resolve the failure.
+	recovery := &Event{
+		Text:       "communication resumed",
+		Template:   "Communication with {daemon} resumed",
+		Level:      EvWarning,
+		Relations:  &Relations{DaemonID: 1},
+		ResolvesID: failure.ID,
+	}
+	require.NoError(t, AddEvent(db, recovery))
+
+	unresolved, err = GetUnresolvedEvent(db, []string{"Communication with {daemon} failed"}, &Relations{DaemonID: 1})
+	require.NoError(t, err)
+	require.Nil(t, unresolved)
+	event.Relations = &Relations{DaemonID: 1}
+	duplicate, err = GetDuplicateEvent(db, event, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Nil(t, duplicate)
+
+	// Updating the non-existing event fails.
+	require.ErrorIs(t, UpdateEventOccurrence(db, &Event{ID: 12345}), ErrNotExists)
+}
+
+// Test getting the events added after the specified event.
+func TestGetEventsAfter(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	events := []*Event{
+		{Text: "first", Level: EvError, Relations: &Relations{MachineID: 1}},
+		{Text: "second", Level: EvInfo, Relations: &Relations{MachineID: 1}},
+		{Text: "third", Level: EvError, Relations: &Relations{MachineID: 2}},
+		{Text: "fourth", Level: EvWarning, Relations: &Relations{MachineID: 1, DaemonID: 3}},
+	}
+	for _, event := range events {
+		require.NoError(t, AddEvent(db, event))
+	}
+
+	// All events after the first one.
+	returned, err := GetEventsAfter(db, events[0].ID, EvInfo, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, returned, 3)
+	require.Equal(t, "second", returned[0].Text)
+	require.Equal(t, "fourth", returned[2].Text)
+
+	// Only the most recent events within the limit.
+	returned, err = GetEventsAfter(db, 0, EvInfo, nil, 2)
+	require.NoError(t, err)
+	require.Len(t, returned, 2)
+	require.Equal(t, "third", returned[0].Text)
+	require.Equal(t, "fourth", returned[1].Text)
+
+	// Filter by the level and the relations.
+	returned, err = GetEventsAfter(db, 0, EvWarning, &Relations{MachineID: 1}, 10)
+	require.NoError(t, err)
+	require.Len(t, returned, 2)
+	require.Equal(t, "first", returned[0].Text)
+	require.Equal(t, "fourth", returned[1].Text)
+
+	returned, err = GetEventsAfter(db, 0, EvInfo, &Relations{DaemonID: 3}, 10)
+	require.NoError(t, err)
+	require.Len(t, returned, 1)
+	require.Equal(t, "fourth", returned[0].Text)
+
+	// No events after the last one.
+	returned, err = GetEventsAfter(db, events[3].ID, EvInfo, nil, 10)
+	require.NoError(t, err)
+	require.Empty(t, returned)
+}
@@ -0,0 +1,163 @@
+package dbmodel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+)
+
+// Represents an address (or a delegated prefix) leased by a daemon to
+// a client other than the one holding the reservation for this address.
+// The identifiers and the hostname are copied from the lease. The time
+// when the conflict was first detected is preserved as long as the
+// conflict persists.
+type LeaseConflict struct {
+	ID         int64
+	DetectedAt time.Time
+
+	SubnetID int64
+	Subnet   *Subnet `pg:"rel:has-one"`
+	HostID   int64
+	Host     *Host `pg:"rel:has-one"`
+	DaemonID int64
+	Daemon   *Daemon `pg:"rel:has-one"`
+
+	Address   string
+	HWAddress string
+	ClientID  string
+	DUID      string `pg:"duid"`
+	Hostname  string
+}
+
+// Checks if two lease conflicts describe the same lease assigned by the same
+// daemon against the same host reservation.
+func (c LeaseConflict) IsSame(other *LeaseConflict) bool {
+	return c.SubnetID == other.SubnetID &&
+		c.HostID == other.HostID &&
+		c.DaemonID == other.DaemonID &&
+		c.Address == other.Address &&
+		c.HWAddress == other.HWAddress &&
+		c.ClientID == other.ClientID &&
+		c.DUID == other.DUID
+}
+
+// Identifies the subnet and the daemon for which the lease conflicts
+// could not be detected, e.g. because the leases could not be fetched
+// from the daemon.
+type LeaseConflictScope struct {
+	SubnetID int64
+	DaemonID int64
+}
+
+// Checks if the lease conflict belongs to any of the scopes.
+func (c LeaseConflict) isInScopes(scopes []LeaseConflictScope) bool {
+	for _, scope := range scopes {
+		if c.SubnetID == scope.SubnetID && c.DaemonID == scope.DaemonID {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the lease conflicts in a transaction. The conflicts that
+// already exist in the database are preserved, the ones not found in the
+// specified slice are deleted and the remaining ones are inserted. The
+// existing conflicts belonging to the unchecked scopes are preserved
+// because it is unknown whether they still exist. It returns the inserted
+// conflicts.
+func replaceLeaseConflicts(tx *pg.Tx, conflicts []LeaseConflict, unchecked []LeaseConflictScope) ([]LeaseConflict, error) {
+	existing := []LeaseConflict{}
+	err := tx.Model(&existing).Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrap(err, "problem getting lease conflicts")
+	}
+
+	var (
+		added   []LeaseConflict
+		keptIDs = make(map[int64]bool)
+	)
+	for i := range conflicts {
+		found := false
+		for j := range existing {
+			if !keptIDs[existing[j].ID] && existing[j].IsSame(&conflicts[i]) {
+				keptIDs[existing[j].ID] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			added = append(added, conflicts[i])
+		}
+	}
+
+	var deletedIDs []int64
+	for _, c := range existing {
+		if !keptIDs[c.ID] && !c.isInScopes(unchecked) {
+			deletedIDs = append(deletedIDs, c.ID)
+		}
+	}
+	if len(deletedIDs) > 0 {
+		_, err = tx.Model((*LeaseConflict)(nil)).
+			Where("id IN (?)", pg.In(deletedIDs)).
+			Delete()
+		if err != nil {
+			return nil, pkgerrors.Wrap(err, "problem deleting resolved lease conflicts")
+		}
+	}
+
+	for i := range added {
+		_, err = tx.Model(&added[i]).ExcludeColumn("detected_at").Returning("*").Insert()
+		if err != nil {
+			return nil, pkgerrors.Wrapf(err, "problem inserting lease conflict for address %s", added[i].Address)
+		}
+	}
+	return added, nil
+}
+
+// Replaces the lease conflicts held in the database with the specified
+// ones. The conflicts that have been previously stored are preserved
+// with their detection times. The ones that are no longer reported are
+// deleted unless they belong to the unchecked scopes, i.e. the subnets
+// and daemons for which the conflicts could not be detected. It returns
+// the newly detected conflicts.
+func ReplaceLeaseConflicts(dbi dbops.DBI, conflicts []LeaseConflict, unchecked []LeaseConflictScope) (added []LeaseConflict, err error) {
+	if db, ok := dbi.(*pg.DB); ok {
+		err = db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			added, err = replaceLeaseConflicts(tx, conflicts, unchecked)
+			return err
+		})
+		return added, err
+	}
+	return replaceLeaseConflicts(dbi.(*pg.Tx), conflicts, unchecked)
+}
+
+// Returns a page of the lease conflicts, optionally filtered by the
+// subnet ID. The conflicts are ordered by ID. A zero limit means that
+// all conflicts beginning from the offset are returned. It returns the
+// conflicts and their total number.
+func GetLeaseConflictsByPage(dbi dbops.DBI, offset, limit int64, subnetID *int64) ([]LeaseConflict, int64, error) {
+	conflicts := []LeaseConflict{}
+	q := dbi.Model(&conflicts).
+		Relation("Subnet").
+		Relation("Host").
+		Relation("Daemon.App").
+		OrderExpr("lease_conflict.id ASC").
+		Offset(int(offset))
+
+	if subnetID != nil {
+		q = q.Where("lease_conflict.subnet_id = ?", *subnetID)
+	}
+	if limit != 0 {
+		q = q.Limit(int(limit))
+	}
+
+	total, err := q.SelectAndCount()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, 0, pkgerrors.Wrap(err, "problem getting lease conflicts")
+	}
+	return conflicts, int64(total), nil
+}
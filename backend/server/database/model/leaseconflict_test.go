@@ -0,0 +1,158 @@
+package dbmodel
+
+import (
+	"testing"
+
+	require "github.com/stretchr/testify/require"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test that two lease conflicts are the same when they describe the same
+// lease assigned against the same reservation.
+func TestLeaseConflictIsSame(t *testing.T) {
+	conflict := LeaseConflict{
+		SubnetID:  1,
+		HostID:    2,
+		DaemonID:  3,
+		Address:   "192.0.2.1",
+		HWAddress: "01:02:03:04:05:06",
+		Hostname:  "foo.example.org",
+	}
+	other := conflict
+	other.ID = 5
+	other.Hostname = "bar.example.org"
+	require.True(t, conflict.IsSame(&other))
+
+	other.HWAddress = "01:02:03:04:05:07"
+	require.False(t, conflict.IsSame(&other))
+
+	other = conflict
+	other.DaemonID = 4
+	require.False(t, conflict.IsSame(&other))
+}
+
+// Test that the lease conflicts are replaced preserving the existing ones.
+func TestReplaceLeaseConflicts(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	hosts := addTestHosts(t, db)
+	daemon := addTestConfigSnapshotDaemon(t, db)
+
+	conflicts := []LeaseConflict{
+		{
+			SubnetID:  1,
+			HostID:    hosts[0].ID,
+			DaemonID:  daemon.ID,
+			Address:   "192.0.2.4",
+			HWAddress: "01:01:01:01:01:01",
+		},
+		{
+			SubnetID: 2,
+			HostID:   hosts[2].ID,
+			DaemonID: daemon.ID,
+			Address:  "2001:db8:1::1",
+			DUID:     "01:02:03",
+			Hostname: "other.example.org",
+		},
+	}
+	added, err := ReplaceLeaseConflicts(db, conflicts, nil)
+	require.NoError(t, err)
+	require.Len(t, added, 2)
+	require.NotZero(t, added[0].ID)
+	require.NotZero(t, added[0].DetectedAt)
+
+	returned, total, err := GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, "192.0.2.4", returned[0].Address)
+	require.Equal(t, "01:01:01:01:01:01", returned[0].HWAddress)
+	require.NotNil(t, returned[0].Subnet)
+	require.Equal(t, "192.0.2.0/24", returned[0].Subnet.Prefix)
+	require.NotNil(t, returned[0].Host)
+	require.Equal(t, "first.example.org", returned[0].Host.Hostname)
+	require.NotNil(t, returned[0].Daemon)
+	require.NotNil(t, returned[0].Daemon.App)
+	require.Equal(t, "01:02:03", returned[1].DUID)
+	require.Equal(t, "other.example.org", returned[1].Hostname)
+
+	// Filter by subnet.
+	subnetID := int64(2)
+	returned, total, err = GetLeaseConflictsByPage(db, 0, 0, &subnetID)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, "2001:db8:1::1", returned[0].Address)
+
+	// Paging.
+	returned, total, err = GetLeaseConflictsByPage(db, 1, 1, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, returned, 1)
+	require.Equal(t, "2001:db8:1::1", returned[0].Address)
+
+	// The first conflict persists, the second one is resolved and a new
+	// one appears.
+	conflicts[1].Address = "2001:db8:1::2"
+	conflicts[1].HostID = hosts[3].ID
+	added, err = ReplaceLeaseConflicts(db, conflicts, nil)
+	require.NoError(t, err)
+	require.Len(t, added, 1)
+	require.Equal(t, "2001:db8:1::2", added[0].Address)
+
+	returnedAgain, total, err := GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, "192.0.2.4", returnedAgain[0].Address)
+	require.Equal(t, "2001:db8:1::2", returnedAgain[1].Address)
+
+	// The conflicts for the unchecked subnet and daemon are preserved.
+	added, err = ReplaceLeaseConflicts(db, []LeaseConflict{}, []LeaseConflictScope{
+		{
+			SubnetID: 2,
+			DaemonID: daemon.ID,
+		},
+	})
+	require.NoError(t, err)
+	require.Empty(t, added)
+
+	returned, total, err = GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, "2001:db8:1::2", returned[0].Address)
+
+	// Remove all conflicts.
+	added, err = ReplaceLeaseConflicts(db, []LeaseConflict{}, nil)
+	require.NoError(t, err)
+	require.Empty(t, added)
+
+	returned, total, err = GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Zero(t, total)
+	require.Empty(t, returned)
+}
+
+// Test that the lease conflicts are deleted together with the host.
+func TestDeleteHostDeletesLeaseConflicts(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	hosts := addTestHosts(t, db)
+	daemon := addTestConfigSnapshotDaemon(t, db)
+
+	_, err := ReplaceLeaseConflicts(db, []LeaseConflict{
+		{
+			SubnetID: 1,
+			HostID:   hosts[0].ID,
+			DaemonID: daemon.ID,
+			Address:  "192.0.2.4",
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	err = DeleteHost(db, hosts[0].ID)
+	require.NoError(t, err)
+
+	_, total, err := GetLeaseConflictsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
@@ -1,12 +1,16 @@
 package dbmodel
 
 import (
+	"fmt"
+
 	"github.com/go-pg/pg/v10"
 	"github.com/pkg/errors"
 )
 
 // Metric values calculated for specific subnet or shared network.
 type CalculatedNetworkMetrics struct {
+	// Subnet or shared network ID.
+	ID int64
 	// Subnet prefix or shared network name.
 	Label string
 	// Address utilization in percentage multiplied by 10.
@@ -15,13 +19,74 @@ type CalculatedNetworkMetrics struct {
 	PdUtilization int16
 }
 
+// Metric values calculated for specific address pool.
+type CalculatedPoolMetrics struct {
+	// Prefix of the subnet the pool belongs to.
+	Subnet string
+	// Address range of the pool, e.g. 192.0.2.10-192.0.2.20.
+	Pool string
+	// Address utilization in percentage multiplied by 10.
+	Utilization int16
+}
+
+// State of the specific HA service used to calculate the metrics.
+type CalculatedHAMetrics struct {
+	ServiceID          int64
+	Name               string
+	HAType             HAType
+	PrimaryID          int64
+	SecondaryID        int64
+	PrimaryLastState   HAState
+	SecondaryLastState HAState
+	PrimaryReachable   bool
+	SecondaryReachable bool
+}
+
+// Checks if the HA state indicates the normal operation of the server.
+func isNormalHAState(state HAState) bool {
+	switch state {
+	case HAStateLoadBalancing, HAStateHotStandby, HAStatePassiveBackup, HAStateBackup:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the label identifying the HA service in the metrics. It is
+// the service name or, if the name is not set, the HA type and the
+// service ID.
+func (m CalculatedHAMetrics) GetLabel() string {
+	if len(m.Name) > 0 {
+		return m.Name
+	}
+	return fmt.Sprintf("%s HA service %d", m.HAType, m.ServiceID)
+}
+
+// Returns the number of the servers in the HA relationship which are
+// unreachable or are not in one of the normal operation states, e.g.
+// are in the partner-down or waiting state.
+func (m CalculatedHAMetrics) GetDegradedServers() int64 {
+	var degraded int64
+	if m.PrimaryID != 0 && (!m.PrimaryReachable || !isNormalHAState(m.PrimaryLastState)) {
+		degraded++
+	}
+	if m.SecondaryID != 0 && (!m.SecondaryReachable || !isNormalHAState(m.SecondaryLastState)) {
+		degraded++
+	}
+	return degraded
+}
+
 // Metric values calculated from the database.
 type CalculatedMetrics struct {
 	AuthorizedMachines   int64
 	UnauthorizedMachines int64
 	UnreachableMachines  int64
+	// Number of the configuration review reports with issues.
+	ConfigReviewIssues   int64
 	SubnetMetrics        []CalculatedNetworkMetrics
 	SharedNetworkMetrics []CalculatedNetworkMetrics
+	PoolMetrics          []CalculatedPoolMetrics
+	HAMetrics            []CalculatedHAMetrics
 }
 
 // Calculates various metrics using several SELECT queries.
@@ -40,7 +105,8 @@ func GetCalculatedMetrics(db *pg.DB) (*CalculatedMetrics, error) {
 	err = db.Model().
 		Table("subnet").
 		ColumnExpr("\"prefix\" AS \"label\"").
-		Column("addr_utilization", "pd_utilization").
+		Column("id", "addr_utilization", "pd_utilization").
+		Order("id").
 		Select(&metrics.SubnetMetrics)
 
 	if err != nil {
@@ -50,12 +116,57 @@ func GetCalculatedMetrics(db *pg.DB) (*CalculatedMetrics, error) {
 	err = db.Model().
 		Table("shared_network").
 		ColumnExpr("\"name\" AS \"label\"").
-		Column("addr_utilization", "pd_utilization").
+		Column("id", "addr_utilization", "pd_utilization").
+		Order("id").
 		Select(&metrics.SharedNetworkMetrics)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "Cannot calculate shared network metrics")
 	}
 
+	// Only the pools for which the statistics have been collected are
+	// included.
+	err = db.Model().
+		Table("address_pool").
+		Join("JOIN subnet ON subnet.id = address_pool.subnet_id").
+		ColumnExpr("subnet.prefix AS \"subnet\"").
+		ColumnExpr("address_pool.lower_bound || '-' || address_pool.upper_bound AS \"pool\"").
+		ColumnExpr("address_pool.utilization").
+		Where("address_pool.stats_collected_at IS NOT NULL").
+		Order("address_pool.id").
+		Select(&metrics.PoolMetrics)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot calculate pool metrics")
+	}
+
+	err = db.Model().
+		Table("ha_service").
+		Join("JOIN service ON service.id = ha_service.service_id").
+		ColumnExpr("ha_service.service_id").
+		ColumnExpr("service.name").
+		ColumnExpr("ha_service.ha_type").
+		ColumnExpr("ha_service.primary_id").
+		ColumnExpr("ha_service.secondary_id").
+		ColumnExpr("ha_service.primary_last_state").
+		ColumnExpr("ha_service.secondary_last_state").
+		ColumnExpr("ha_service.primary_reachable").
+		ColumnExpr("ha_service.secondary_reachable").
+		Order("ha_service.service_id").
+		Select(&metrics.HAMetrics)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot calculate HA metrics")
+	}
+
+	configReviewIssues, err := db.Model((*ConfigReport)(nil)).
+		Where("content IS NOT NULL").
+		Count()
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot calculate config review metrics")
+	}
+	metrics.ConfigReviewIssues = int64(configReviewIssues)
+
 	return &metrics, nil
 }
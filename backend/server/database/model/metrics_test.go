@@ -137,3 +137,130 @@ func TestFilledSharedNetworksDatabaseMetrics(t *testing.T) {
 	require.Zero(t, metrics.SharedNetworkMetrics[2].AddrUtilization)
 	require.Zero(t, metrics.SharedNetworkMetrics[2].PdUtilization)
 }
+
+// Metrics per pool should be calculated only for the pools with the
+// collected statistics.
+func TestFilledPoolsDatabaseMetrics(t *testing.T) {
+	// Arrange
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+	subnet := &Subnet{
+		Prefix: "192.0.2.0/24",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "192.0.2.10",
+				UpperBound: "192.0.2.20",
+			},
+			{
+				LowerBound: "192.0.2.30",
+				UpperBound: "192.0.2.40",
+			},
+		},
+	}
+	_ = AddSubnet(db, subnet)
+	_ = subnet.AddressPools[0].UpdateStatistics(db, SubnetStats{}, 0.25)
+
+	// Act
+	metrics, err := GetCalculatedMetrics(db)
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, metrics.PoolMetrics, 1)
+	require.Equal(t, "192.0.2.0/24", metrics.PoolMetrics[0].Subnet)
+	require.Equal(t, "192.0.2.10-192.0.2.20", metrics.PoolMetrics[0].Pool)
+	require.EqualValues(t, 250, metrics.PoolMetrics[0].Utilization)
+}
+
+// Test counting the degraded servers in the HA relationship and labeling
+// the HA services.
+func TestCalculatedHAMetrics(t *testing.T) {
+	metrics := CalculatedHAMetrics{
+		ServiceID:          3,
+		HAType:             HATypeDhcp4,
+		PrimaryID:          1,
+		SecondaryID:        2,
+		PrimaryLastState:   HAStateLoadBalancing,
+		SecondaryLastState: HAStateLoadBalancing,
+		PrimaryReachable:   true,
+		SecondaryReachable: true,
+	}
+	require.Zero(t, metrics.GetDegradedServers())
+	require.Equal(t, "dhcp4 HA service 3", metrics.GetLabel())
+
+	metrics.Name = "foo"
+	require.Equal(t, "foo", metrics.GetLabel())
+
+	metrics.PrimaryLastState = HAStatePartnerDown
+	require.EqualValues(t, 1, metrics.GetDegradedServers())
+
+	metrics.SecondaryReachable = false
+	require.EqualValues(t, 2, metrics.GetDegradedServers())
+
+	// The passive-backup mode without the secondary server.
+	metrics = CalculatedHAMetrics{
+		PrimaryID:        1,
+		PrimaryLastState: HAStatePassiveBackup,
+		PrimaryReachable: true,
+	}
+	require.Zero(t, metrics.GetDegradedServers())
+}
+
+// Metrics based on the HA services and config reports should be properly
+// calculated.
+func TestFilledHAAndConfigReviewDatabaseMetrics(t *testing.T) {
+	// Arrange
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	machine := &Machine{
+		Address:   "localhost",
+		AgentPort: 8080,
+	}
+	_ = AddMachine(db, machine)
+	app := &App{
+		Type:      AppTypeKea,
+		MachineID: machine.ID,
+		Daemons: []*Daemon{
+			NewKeaDaemon("dhcp4", true),
+			NewKeaDaemon("dhcp6", true),
+		},
+	}
+	daemons, _ := AddApp(db, app)
+	service := &Service{
+		BaseService: BaseService{
+			ServiceType: "ha_dhcp",
+			Daemons:     daemons,
+		},
+		HAService: &BaseHAService{
+			HAType:             HATypeDhcp4,
+			HAMode:             HAModeHotStandby,
+			PrimaryID:          daemons[0].ID,
+			SecondaryID:        daemons[1].ID,
+			PrimaryLastState:   HAStatePartnerDown,
+			SecondaryLastState: HAStateUnavailable,
+			PrimaryReachable:   true,
+		},
+	}
+	_ = AddService(db, service)
+	_ = AddConfigReport(db, &ConfigReport{
+		CheckerName: "issue",
+		Content:     newPtr("issue found in {daemon}"),
+		DaemonID:    daemons[0].ID,
+		RefDaemons:  daemons[:1],
+	})
+	_ = AddConfigReport(db, &ConfigReport{
+		CheckerName: "empty",
+		DaemonID:    daemons[0].ID,
+	})
+
+	// Act
+	metrics, err := GetCalculatedMetrics(db)
+
+	// Assert
+	require.NoError(t, err)
+	require.EqualValues(t, 1, metrics.ConfigReviewIssues)
+	require.Len(t, metrics.HAMetrics, 1)
+	require.Equal(t, service.ID, metrics.HAMetrics[0].ServiceID)
+	require.Equal(t, HATypeDhcp4, metrics.HAMetrics[0].HAType)
+	require.EqualValues(t, 2, metrics.HAMetrics[0].GetDegradedServers())
+}
@@ -17,6 +17,14 @@ type AddressPool struct {
 	UpperBound string
 	SubnetID   int64
 	Subnet     *Subnet `pg:"rel:has-one"`
+
+	// Address utilization in percentage multiplied by 10.
+	Utilization      int16
+	Stats            SubnetStats
+	StatsCollectedAt time.Time
+	// Projected date of exhausting the addresses. It is zero when
+	// the exhaustion is not predicted.
+	ExhaustionForecast time.Time
 }
 
 // Reflects IPv6 address pool.
@@ -27,6 +35,14 @@ type PrefixPool struct {
 	DelegatedLen int
 	SubnetID     int64
 	Subnet       *Subnet `pg:"rel:has-one"`
+
+	// Delegated prefix utilization in percentage multiplied by 10.
+	Utilization      int16
+	Stats            SubnetStats
+	StatsCollectedAt time.Time
+	// Projected date of exhausting the delegated prefixes. It is zero
+	// when the exhaustion is not predicted.
+	ExhaustionForecast time.Time
 }
 
 // Creates new instance of the address pool from the address range. The
@@ -135,3 +151,73 @@ func DeletePrefixPool(db *dbops.PgDB, poolID int64) error {
 	}
 	return err
 }
+
+// Updates the statistics and the utilization of the address pool. The
+// utilization is a fraction of the assigned addresses.
+func (pool *AddressPool) UpdateStatistics(dbi dbops.DBI, stats SubnetStats, utilization float64) error {
+	pool.Utilization = int16(utilization * 1000)
+	pool.Stats = stats
+	pool.StatsCollectedAt = storkutil.UTCNow()
+	result, err := dbi.Model(pool).
+		Column("utilization", "stats", "stats_collected_at").
+		WherePK().
+		Update()
+	if err != nil {
+		err = errors.Wrapf(err, "problem updating statistics in the address pool %s-%s",
+			pool.LowerBound, pool.UpperBound)
+	} else if result.RowsAffected() <= 0 {
+		err = errors.Wrapf(ErrNotExists, "pool with ID %d does not exist", pool.ID)
+	}
+	return err
+}
+
+// Updates the statistics and the utilization of the prefix pool. The
+// utilization is a fraction of the assigned delegated prefixes.
+func (pool *PrefixPool) UpdateStatistics(dbi dbops.DBI, stats SubnetStats, utilization float64) error {
+	pool.Utilization = int16(utilization * 1000)
+	pool.Stats = stats
+	pool.StatsCollectedAt = storkutil.UTCNow()
+	result, err := dbi.Model(pool).
+		Column("utilization", "stats", "stats_collected_at").
+		WherePK().
+		Update()
+	if err != nil {
+		err = errors.Wrapf(err, "problem updating statistics in the prefix pool %s", pool.Prefix)
+	} else if result.RowsAffected() <= 0 {
+		err = errors.Wrapf(ErrNotExists, "pool with ID %d does not exist", pool.ID)
+	}
+	return err
+}
+
+// Updates the projected date of exhausting the addresses in the pool.
+// The zero forecast means that the exhaustion is not predicted.
+func (pool *AddressPool) UpdateExhaustionForecast(dbi dbops.DBI, forecast time.Time) error {
+	pool.ExhaustionForecast = forecast
+	result, err := dbi.Model(pool).
+		Column("exhaustion_forecast").
+		WherePK().
+		Update()
+	if err != nil {
+		err = errors.Wrapf(err, "problem updating exhaustion forecast in the address pool %s-%s",
+			pool.LowerBound, pool.UpperBound)
+	} else if result.RowsAffected() <= 0 {
+		err = errors.Wrapf(ErrNotExists, "pool with ID %d does not exist", pool.ID)
+	}
+	return err
+}
+
+// Updates the projected date of exhausting the delegated prefixes in the
+// pool. The zero forecast means that the exhaustion is not predicted.
+func (pool *PrefixPool) UpdateExhaustionForecast(dbi dbops.DBI, forecast time.Time) error {
+	pool.ExhaustionForecast = forecast
+	result, err := dbi.Model(pool).
+		Column("exhaustion_forecast").
+		WherePK().
+		Update()
+	if err != nil {
+		err = errors.Wrapf(err, "problem updating exhaustion forecast in the prefix pool %s", pool.Prefix)
+	} else if result.RowsAffected() <= 0 {
+		err = errors.Wrapf(ErrNotExists, "pool with ID %d does not exist", pool.ID)
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package dbmodel
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	dbtest "isc.org/stork/server/database/test"
@@ -135,3 +136,114 @@ func TestAddDeletePrefixPool(t *testing.T) {
 	returnedSubnet = returnedSubnets[0]
 	require.Empty(t, returnedSubnet.PrefixPools)
 }
+
+// Test that the statistics and utilization of the address and prefix
+// pools are updated.
+func TestUpdatePoolStatistics(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := Subnet{
+		Prefix: "2001:db8:1::/64",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "2001:db8:1::10",
+				UpperBound: "2001:db8:1::20",
+			},
+		},
+		PrefixPools: []PrefixPool{
+			{
+				Prefix:       "2001:db8:1:1::/80",
+				DelegatedLen: 96,
+			},
+		},
+	}
+	err := AddSubnet(db, &subnet)
+	require.NoError(t, err)
+
+	err = subnet.AddressPools[0].UpdateStatistics(db, SubnetStats{
+		"total-nas":    uint64(17),
+		"assigned-nas": uint64(4),
+	}, 0.235)
+	require.NoError(t, err)
+
+	err = subnet.PrefixPools[0].UpdateStatistics(db, SubnetStats{
+		"total-pds":    uint64(100),
+		"assigned-pds": uint64(50),
+	}, 0.5)
+	require.NoError(t, err)
+
+	returnedSubnet, err := GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.Len(t, returnedSubnet.AddressPools, 1)
+	require.EqualValues(t, 235, returnedSubnet.AddressPools[0].Utilization)
+	require.EqualValues(t, 17, returnedSubnet.AddressPools[0].Stats["total-nas"])
+	require.EqualValues(t, 4, returnedSubnet.AddressPools[0].Stats["assigned-nas"])
+	require.NotZero(t, returnedSubnet.AddressPools[0].StatsCollectedAt)
+
+	require.Len(t, returnedSubnet.PrefixPools, 1)
+	require.EqualValues(t, 500, returnedSubnet.PrefixPools[0].Utilization)
+	require.EqualValues(t, 50, returnedSubnet.PrefixPools[0].Stats["assigned-pds"])
+	require.NotZero(t, returnedSubnet.PrefixPools[0].StatsCollectedAt)
+
+	// Updating a non-existing pool should fail.
+	pool := AddressPool{ID: subnet.AddressPools[0].ID + 100}
+	err = pool.UpdateStatistics(db, SubnetStats{}, 0)
+	require.ErrorIs(t, err, ErrNotExists)
+}
+
+// Test that the exhaustion forecasts of the subnet and its pools are
+// updated and cleared.
+func TestUpdateExhaustionForecast(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := Subnet{
+		Prefix: "2001:db8:1::/64",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "2001:db8:1::10",
+				UpperBound: "2001:db8:1::20",
+			},
+		},
+		PrefixPools: []PrefixPool{
+			{
+				Prefix:       "2001:db8:1:1::/80",
+				DelegatedLen: 96,
+			},
+		},
+	}
+	err := AddSubnet(db, &subnet)
+	require.NoError(t, err)
+
+	forecast := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	err = subnet.UpdateExhaustionForecast(db, forecast)
+	require.NoError(t, err)
+	err = subnet.AddressPools[0].UpdateExhaustionForecast(db, forecast.Add(time.Hour))
+	require.NoError(t, err)
+	err = subnet.PrefixPools[0].UpdateExhaustionForecast(db, forecast.Add(2*time.Hour))
+	require.NoError(t, err)
+
+	returnedSubnet, err := GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.True(t, forecast.Equal(returnedSubnet.ExhaustionForecast))
+	require.True(t, forecast.Add(time.Hour).Equal(returnedSubnet.AddressPools[0].ExhaustionForecast))
+	require.True(t, forecast.Add(2*time.Hour).Equal(returnedSubnet.PrefixPools[0].ExhaustionForecast))
+
+	// Clear the forecasts.
+	err = subnet.UpdateExhaustionForecast(db, time.Time{})
+	require.NoError(t, err)
+	err = subnet.AddressPools[0].UpdateExhaustionForecast(db, time.Time{})
+	require.NoError(t, err)
+
+	returnedSubnet, err = GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.Zero(t, returnedSubnet.ExhaustionForecast)
+	require.Zero(t, returnedSubnet.AddressPools[0].ExhaustionForecast)
+	require.False(t, returnedSubnet.PrefixPools[0].ExhaustionForecast.IsZero())
+
+	// Non-existing pool.
+	pool := PrefixPool{ID: subnet.PrefixPools[0].ID + 100}
+	err = pool.UpdateExhaustionForecast(db, forecast)
+	require.ErrorIs(t, err, ErrNotExists)
+}
@@ -6,11 +6,40 @@ import (
 	"time"
 
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	pkgerrors "github.com/pkg/errors"
 	dbops "isc.org/stork/server/database"
 	storkutil "isc.org/stork/util"
 )
 
+// Approval status of the scheduled config change.
+type ScheduledConfigChangeApprovalStatus string
+
+const (
+	// The config change awaits the approvals.
+	ScheduledConfigChangeApprovalPending ScheduledConfigChangeApprovalStatus = "pending_approval"
+	// The config change has been approved and can be committed.
+	ScheduledConfigChangeApprovalApproved ScheduledConfigChangeApprovalStatus = "approved"
+	// The config change has been rejected and will not be committed.
+	ScheduledConfigChangeApprovalRejected ScheduledConfigChangeApprovalStatus = "rejected"
+)
+
+// Decision made by a user reviewing the scheduled config change.
+type ScheduledConfigChangeReviewDecision string
+
+const (
+	// The user approved the config change.
+	ScheduledConfigChangeReviewApprove ScheduledConfigChangeReviewDecision = "approve"
+	// The user rejected the config change.
+	ScheduledConfigChangeReviewReject ScheduledConfigChangeReviewDecision = "reject"
+	// The user commented on the config change.
+	ScheduledConfigChangeReviewComment ScheduledConfigChangeReviewDecision = "comment"
+)
+
+// Returned when the user is not allowed to review the scheduled config
+// change, e.g. the change has already been executed or rejected.
+var ErrScheduledConfigChangeReviewNotAllowed = errors.New("scheduled config change review not allowed")
+
 // Representation of the config changes scheduled by the config
 // manager (see server/apps). Each scheduled config change includes
 // a deadline (timestamp) indicating when this config change should
@@ -30,6 +59,27 @@ type ScheduledConfigChange struct {
 
 	Executed bool
 	Error    string
+
+	// The config change is committed when its deadline expires only when
+	// it has been approved by the required number of users other than
+	// the user who scheduled it.
+	ApprovalStatus    ScheduledConfigChangeApprovalStatus
+	RequiredApprovals int64
+	Reviews           []*ScheduledConfigChangeReview `pg:"rel:has-many"`
+}
+
+// Represents an approval, rejection or comment of the scheduled config
+// change made by a user.
+type ScheduledConfigChangeReview struct {
+	ID                      int64
+	CreatedAt               time.Time
+	ScheduledConfigChangeID int64
+
+	UserID int64
+	User   *SystemUser `pg:"rel:has-one"`
+
+	Decision ScheduledConfigChangeReviewDecision
+	Comment  string
 }
 
 // Represents a single config update belonging to a config change.
@@ -98,12 +148,51 @@ func GetScheduledConfigChanges(dbi dbops.DBI) ([]ScheduledConfigChange, error) {
 	return changes, err
 }
 
-// Returns scheduled and not executed config changes which deadline has expired.
+// Returns a page of the scheduled config changes with their owners and
+// reviews, ordered by deadline. The offset and limit specify the beginning
+// of the page and the maximum size of the page. A zero limit means that
+// all changes beginning from the offset are returned. If the executed
+// parameter is not nil, only the executed or not executed changes are
+// returned. The rejected changes are never executed, so they are not
+// returned when the executed parameter is false. It returns the changes
+// and their total number.
+func GetScheduledConfigChangesByPage(dbi dbops.DBI, offset, limit int64, executed *bool) ([]ScheduledConfigChange, int64, error) {
+	var changes []ScheduledConfigChange
+	q := dbi.Model(&changes).
+		Relation("User").
+		Relation("Reviews", func(q *orm.Query) (*orm.Query, error) {
+			return q.Order("scheduled_config_change_review.id ASC"), nil
+		}).
+		Relation("Reviews.User").
+		OrderExpr("scheduled_config_change.deadline_at ASC").
+		OrderExpr("scheduled_config_change.id ASC").
+		Offset(int(offset))
+
+	if executed != nil {
+		q = q.Where("scheduled_config_change.executed = ?", *executed)
+		if !*executed {
+			q = q.Where("scheduled_config_change.approval_status != ?", ScheduledConfigChangeApprovalRejected)
+		}
+	}
+	if limit != 0 {
+		q = q.Limit(int(limit))
+	}
+
+	total, err := q.SelectAndCount()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, 0, pkgerrors.Wrapf(err, "problem with getting scheduled config changes")
+	}
+	return changes, int64(total), nil
+}
+
+// Returns scheduled, approved and not executed config changes which deadline
+// has expired.
 func GetDueConfigChanges(dbi dbops.DBI) ([]ScheduledConfigChange, error) {
 	var changes []ScheduledConfigChange
 	err := dbi.Model(&changes).
 		OrderExpr("deadline_at ASC").
 		Where("executed = ?", false).
+		Where("approval_status = ?", ScheduledConfigChangeApprovalApproved).
 		Where("deadline_at < now() at time zone 'UTC'").
 		Select()
 	if err != nil {
@@ -115,6 +204,124 @@ func GetDueConfigChanges(dbi dbops.DBI) ([]ScheduledConfigChange, error) {
 	return changes, err
 }
 
+// Returns the scheduled config change with its owner and reviews. The
+// reviews are ordered by their creation time. It returns nil if the config
+// change does not exist.
+func GetScheduledConfigChange(dbi dbops.DBI, changeID int64) (*ScheduledConfigChange, error) {
+	change := &ScheduledConfigChange{}
+	err := dbi.Model(change).
+		Relation("User").
+		Relation("Reviews", func(q *orm.Query) (*orm.Query, error) {
+			return q.Order("scheduled_config_change_review.id ASC"), nil
+		}).
+		Relation("Reviews.User").
+		Where("scheduled_config_change.id = ?", changeID).
+		Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, pkgerrors.Wrapf(err, "problem with getting scheduled config change with id %d", changeID)
+	}
+	return change, nil
+}
+
+// Inserts the review of the scheduled config change in the transaction and
+// updates the approval status of the change. The approved change must
+// gather the required number of approvals from the users other than the
+// user who scheduled it. A single rejection rejects the change. The users
+// can comment on the change regardless of its approval status.
+func addScheduledConfigChangeReview(tx *pg.Tx, review *ScheduledConfigChangeReview) error {
+	change := &ScheduledConfigChange{}
+	err := tx.Model(change).
+		Where("id = ?", review.ScheduledConfigChangeID).
+		For("UPDATE").
+		Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return pkgerrors.Wrapf(ErrNotExists, "scheduled config change with id %d does not exist", review.ScheduledConfigChangeID)
+		}
+		return pkgerrors.Wrapf(err, "problem with getting scheduled config change with id %d", review.ScheduledConfigChangeID)
+	}
+	if change.Executed {
+		return pkgerrors.Wrapf(ErrScheduledConfigChangeReviewNotAllowed, "scheduled config change with id %d has already been executed", change.ID)
+	}
+	switch review.Decision {
+	case ScheduledConfigChangeReviewApprove, ScheduledConfigChangeReviewReject:
+		if change.ApprovalStatus != ScheduledConfigChangeApprovalPending {
+			return pkgerrors.Wrapf(ErrScheduledConfigChangeReviewNotAllowed, "scheduled config change with id %d is not pending approval", change.ID)
+		}
+	case ScheduledConfigChangeReviewComment:
+		if len(review.Comment) == 0 {
+			return pkgerrors.Wrapf(ErrScheduledConfigChangeReviewNotAllowed, "comment for scheduled config change with id %d is empty", change.ID)
+		}
+	default:
+		return pkgerrors.Errorf("invalid scheduled config change review decision %s", review.Decision)
+	}
+	var approvals int
+	if review.Decision == ScheduledConfigChangeReviewApprove {
+		if change.UserID == review.UserID {
+			return pkgerrors.Wrapf(ErrScheduledConfigChangeReviewNotAllowed, "user %d cannot approve own scheduled config change with id %d", review.UserID, change.ID)
+		}
+		// Each user can approve the change only once.
+		approvals, err = tx.Model((*ScheduledConfigChangeReview)(nil)).
+			Where("scheduled_config_change_id = ?", change.ID).
+			Where("decision = ?", ScheduledConfigChangeReviewApprove).
+			Where("user_id = ?", review.UserID).
+			Count()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem with counting approvals of scheduled config change with id %d", change.ID)
+		}
+		if approvals > 0 {
+			return pkgerrors.Wrapf(ErrScheduledConfigChangeReviewNotAllowed, "user %d has already approved scheduled config change with id %d", review.UserID, change.ID)
+		}
+	}
+	if _, err = tx.Model(review).Insert(); err != nil {
+		return pkgerrors.Wrapf(err, "problem with adding review of scheduled config change with id %d", change.ID)
+	}
+	switch review.Decision {
+	case ScheduledConfigChangeReviewApprove:
+		approvals, err = tx.Model((*ScheduledConfigChangeReview)(nil)).
+			Where("scheduled_config_change_id = ?", change.ID).
+			Where("decision = ?", ScheduledConfigChangeReviewApprove).
+			Count()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem with counting approvals of scheduled config change with id %d", change.ID)
+		}
+		if int64(approvals) < change.RequiredApprovals {
+			return nil
+		}
+		change.ApprovalStatus = ScheduledConfigChangeApprovalApproved
+	case ScheduledConfigChangeReviewReject:
+		change.ApprovalStatus = ScheduledConfigChangeApprovalRejected
+	default:
+		return nil
+	}
+	_, err = tx.Model(change).
+		Column("approval_status").
+		WherePK().
+		Update()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem with updating approval status of scheduled config change with id %d", change.ID)
+	}
+	return nil
+}
+
+// Inserts the review (approval, rejection or comment) of the scheduled
+// config change into the database and updates the approval status of the
+// change. It returns ErrNotExists when the change does not exist and
+// ErrScheduledConfigChangeReviewNotAllowed when the user is not allowed
+// to review the change, e.g. the change is not pending approval or the
+// user attempts to approve own change.
+func AddScheduledConfigChangeReview(dbi dbops.DBI, review *ScheduledConfigChangeReview) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return addScheduledConfigChangeReview(tx, review)
+		})
+	}
+	return addScheduledConfigChangeReview(dbi.(*pg.Tx), review)
+}
+
 // Marks specified config change as executed. Such changes are no longer
 // returned in queries for due config changes. The errtext specifies an optional
 // text describing an error that occurred during the config change execution.
@@ -138,6 +345,60 @@ func SetScheduledConfigChangeExecuted(dbi dbops.DBI, changeID int64, errtext str
 	return nil
 }
 
+// Sets new deadline for the scheduled config change in the transaction.
+// The approvals of the change are removed and the approved change becomes
+// pending approval again when the approvals are required. The users must
+// approve the change with the new deadline. The rejected change remains
+// rejected.
+func setScheduledConfigChangeDeadline(tx *pg.Tx, changeID int64, deadline time.Time) error {
+	change := &ScheduledConfigChange{}
+	err := tx.Model(change).
+		Where("id = ?", changeID).
+		Where("executed = ?", false).
+		For("UPDATE").
+		Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return pkgerrors.Wrapf(ErrNotExists, "pending config change with id %d does not exist", changeID)
+		}
+		return pkgerrors.Wrapf(err, "problem with getting config change %d", changeID)
+	}
+	change.DeadlineAt = deadline
+	if change.RequiredApprovals > 0 && change.ApprovalStatus != ScheduledConfigChangeApprovalRejected {
+		change.ApprovalStatus = ScheduledConfigChangeApprovalPending
+		_, err = tx.Model((*ScheduledConfigChangeReview)(nil)).
+			Where("scheduled_config_change_id = ?", change.ID).
+			Where("decision = ?", ScheduledConfigChangeReviewApprove).
+			Delete()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem with deleting approvals of config change %d", changeID)
+		}
+	}
+	_, err = tx.Model(change).
+		Column("deadline_at").
+		Column("approval_status").
+		WherePK().
+		Update()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem with updating deadline of config change %d", changeID)
+	}
+	return nil
+}
+
+// Sets new deadline for the scheduled config change which hasn't been
+// executed yet. When the change requires approvals, the approvals gathered
+// so far are discarded and the change becomes pending approval until it is
+// approved again. It returns ErrNotExists when the change does not exist
+// or it has been executed.
+func SetScheduledConfigChangeDeadline(dbi dbops.DBI, changeID int64, deadline time.Time) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return setScheduledConfigChangeDeadline(tx, changeID, deadline)
+		})
+	}
+	return setScheduledConfigChangeDeadline(dbi.(*pg.Tx), changeID, deadline)
+}
+
 // Returns time in seconds to next scheduled config change.
 func GetTimeToNextScheduledConfigChange(dbi dbops.DBI) (time.Duration, bool, error) {
 	var tm struct {
@@ -146,7 +407,7 @@ func GetTimeToNextScheduledConfigChange(dbi dbops.DBI) (time.Duration, bool, err
 	_, err := dbi.QueryOne(&tm,
 		`SELECT MIN(EXTRACT(EPOCH FROM(deadline_at - now() at time zone 'UTC'))) AS duration
          FROM scheduled_config_change
-         WHERE executed = FALSE`)
+         WHERE executed = FALSE AND approval_status = ?`, ScheduledConfigChangeApprovalApproved)
 	if err != nil {
 		return 0, false, pkgerrors.Wrapf(err, "problem with getting time to next config change")
 	}
@@ -154,7 +415,7 @@ func GetTimeToNextScheduledConfigChange(dbi dbops.DBI) (time.Duration, bool, err
 		// Scheduled config changes do not exist.
 		return 0, false, nil
 	}
-	return time.Duration(*tm.Duration) * time.Second, true, err
+	return time.Duration(*tm.Duration * float64(time.Second)), true, err
 }
 
 // Deletes selected scheduled config change from the database.
@@ -1,11 +1,13 @@
 package dbmodel
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
 	pkgerrors "github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	dbops "isc.org/stork/server/database"
 	dbtest "isc.org/stork/server/database/test"
 	storkutil "isc.org/stork/util"
 )
@@ -395,3 +397,410 @@ func TestDeleteScheduledConfigChange(t *testing.T) {
 	require.NoError(t, err)
 	require.Empty(t, returned)
 }
+
+// Creates test users who schedule and review the config changes.
+func addTestConfigChangeUsers(t *testing.T, db *dbops.PgDB, count int) (users []*SystemUser) {
+	for i := 0; i < count; i++ {
+		user := &SystemUser{
+			Login:    fmt.Sprintf("test%d", i),
+			Lastname: "test",
+			Name:     "test",
+			Password: "test",
+		}
+		_, err := CreateUser(db, user)
+		require.NoError(t, err)
+		require.NotZero(t, user.ID)
+		users = append(users, user)
+	}
+	return users
+}
+
+// Test that the config change scheduled before introducing approvals is
+// approved by default.
+func TestAddScheduledConfigChangeApprovedByDefault(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 1)
+
+	change := &ScheduledConfigChange{
+		DeadlineAt: storkutil.UTCNow().Add(-time.Second * 10),
+		UserID:     int64(users[0].ID),
+		Updates: []*ConfigUpdate{
+			NewConfigUpdate("kea", "host_add", 1),
+		},
+	}
+	err := AddScheduledConfigChange(db, change)
+	require.NoError(t, err)
+
+	returned, err := GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, ScheduledConfigChangeApprovalApproved, returned.ApprovalStatus)
+	require.Zero(t, returned.RequiredApprovals)
+	require.Empty(t, returned.Reviews)
+
+	// Non-existing config change.
+	returned, err = GetScheduledConfigChange(db, change.ID+1)
+	require.NoError(t, err)
+	require.Nil(t, returned)
+}
+
+// Test that the config change pending approval becomes due when it gathers
+// the required number of approvals.
+func TestApproveScheduledConfigChange(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 3)
+
+	change := &ScheduledConfigChange{
+		DeadlineAt: storkutil.UTCNow().Add(-time.Second * 10),
+		UserID:     int64(users[0].ID),
+		Updates: []*ConfigUpdate{
+			NewConfigUpdate("kea", "host_add", 1),
+		},
+		ApprovalStatus:    ScheduledConfigChangeApprovalPending,
+		RequiredApprovals: 2,
+	}
+	err := AddScheduledConfigChange(db, change)
+	require.NoError(t, err)
+
+	// The change pending approval is not due.
+	changes, err := GetDueConfigChanges(db)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	_, exists, err := GetTimeToNextScheduledConfigChange(db)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// The user cannot approve own change.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[0].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+	})
+	require.ErrorIs(t, err, ErrScheduledConfigChangeReviewNotAllowed)
+
+	// The first approval.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+		Comment:                 "looks good",
+	})
+	require.NoError(t, err)
+
+	returned, err := GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledConfigChangeApprovalPending, returned.ApprovalStatus)
+
+	// The same user cannot approve the change twice.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+	})
+	require.ErrorIs(t, err, ErrScheduledConfigChangeReviewNotAllowed)
+
+	// The second approval.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[2].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+	})
+	require.NoError(t, err)
+
+	returned, err = GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledConfigChangeApprovalApproved, returned.ApprovalStatus)
+	require.Len(t, returned.Reviews, 2)
+	require.Equal(t, "looks good", returned.Reviews[0].Comment)
+	require.NotNil(t, returned.Reviews[0].User)
+	require.Equal(t, users[1].Login, returned.Reviews[0].User.Login)
+	require.Equal(t, ScheduledConfigChangeReviewApprove, returned.Reviews[1].Decision)
+
+	// The approved change is due.
+	changes, err = GetDueConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	// The approved change can no longer be rejected.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[2].ID),
+		Decision:                ScheduledConfigChangeReviewReject,
+	})
+	require.ErrorIs(t, err, ErrScheduledConfigChangeReviewNotAllowed)
+}
+
+// Test that the rejected config change is never due and that the users
+// can comment on the change.
+func TestRejectScheduledConfigChange(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 2)
+
+	change := &ScheduledConfigChange{
+		DeadlineAt: storkutil.UTCNow().Add(-time.Second * 10),
+		UserID:     int64(users[0].ID),
+		Updates: []*ConfigUpdate{
+			NewConfigUpdate("kea", "host_add", 1),
+		},
+		ApprovalStatus:    ScheduledConfigChangeApprovalPending,
+		RequiredApprovals: 1,
+	}
+	err := AddScheduledConfigChange(db, change)
+	require.NoError(t, err)
+
+	// Empty comment is not allowed.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewComment,
+	})
+	require.ErrorIs(t, err, ErrScheduledConfigChangeReviewNotAllowed)
+
+	// The comment doesn't affect the approval status.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[0].ID),
+		Decision:                ScheduledConfigChangeReviewComment,
+		Comment:                 "please review",
+	})
+	require.NoError(t, err)
+
+	returned, err := GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledConfigChangeApprovalPending, returned.ApprovalStatus)
+
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewReject,
+		Comment:                 "wrong subnet",
+	})
+	require.NoError(t, err)
+
+	returned, err = GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledConfigChangeApprovalRejected, returned.ApprovalStatus)
+	require.Len(t, returned.Reviews, 2)
+
+	// The rejected change is not due and can't be approved.
+	changes, err := GetDueConfigChanges(db)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+	})
+	require.ErrorIs(t, err, ErrScheduledConfigChangeReviewNotAllowed)
+
+	// Non-existing change.
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID + 1,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewComment,
+		Comment:                 "foo",
+	})
+	require.ErrorIs(t, err, ErrNotExists)
+}
+
+// Test getting the scheduled config changes by page.
+func TestGetScheduledConfigChangesByPage(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 1)
+
+	// Add the changes with decreasing deadlines.
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		change := &ScheduledConfigChange{
+			DeadlineAt: storkutil.UTCNow().Add(time.Hour * time.Duration(10-i)),
+			UserID:     int64(users[0].ID),
+			Updates: []*ConfigUpdate{
+				NewConfigUpdate("kea", "host_add", 1),
+			},
+		}
+		err := AddScheduledConfigChange(db, change)
+		require.NoError(t, err)
+		ids = append(ids, change.ID)
+	}
+	err := SetScheduledConfigChangeExecuted(db, ids[0], "")
+	require.NoError(t, err)
+
+	// Reject one of the changes.
+	_, err = db.Model(&ScheduledConfigChange{ID: ids[1], ApprovalStatus: ScheduledConfigChangeApprovalRejected}).
+		Column("approval_status").
+		WherePK().
+		Update()
+	require.NoError(t, err)
+
+	// Get all changes. They should be ordered by deadline.
+	changes, total, err := GetScheduledConfigChangesByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, total)
+	require.Len(t, changes, 5)
+	for i := range changes {
+		require.Equal(t, ids[4-i], changes[i].ID)
+		require.NotNil(t, changes[i].User)
+		require.Equal(t, "test0", changes[i].User.Login)
+		require.Len(t, changes[i].Updates, 1)
+	}
+
+	// Get the second page.
+	changes, total, err = GetScheduledConfigChangesByPage(db, 2, 2, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, total)
+	require.Len(t, changes, 2)
+	require.Equal(t, ids[2], changes[0].ID)
+	require.Equal(t, ids[1], changes[1].ID)
+
+	// Get the executed changes only.
+	executed := true
+	changes, total, err = GetScheduledConfigChangesByPage(db, 0, 0, &executed)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Len(t, changes, 1)
+	require.Equal(t, ids[0], changes[0].ID)
+
+	// Get the pending changes only. The rejected change is not pending.
+	executed = false
+	changes, total, err = GetScheduledConfigChangesByPage(db, 0, 0, &executed)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, changes, 3)
+	for _, change := range changes {
+		require.NotEqual(t, ids[1], change.ID)
+	}
+}
+
+// Test setting new deadline for the scheduled config change.
+func TestSetScheduledConfigChangeDeadline(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 1)
+
+	change := &ScheduledConfigChange{
+		DeadlineAt: storkutil.UTCNow().Add(time.Hour),
+		UserID:     int64(users[0].ID),
+		Updates: []*ConfigUpdate{
+			NewConfigUpdate("kea", "host_add", 1),
+		},
+	}
+	err := AddScheduledConfigChange(db, change)
+	require.NoError(t, err)
+
+	deadline := storkutil.UTCNow().Add(-time.Minute).Truncate(time.Second)
+	err = SetScheduledConfigChangeDeadline(db, change.ID, deadline)
+	require.NoError(t, err)
+
+	returned, err := GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, deadline, returned.DeadlineAt)
+	require.Len(t, returned.Updates, 1)
+
+	// The change is now due.
+	changes, err := GetDueConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	// The executed change can't be rescheduled.
+	err = SetScheduledConfigChangeExecuted(db, change.ID, "")
+	require.NoError(t, err)
+	err = SetScheduledConfigChangeDeadline(db, change.ID, storkutil.UTCNow().Add(time.Hour))
+	require.ErrorIs(t, err, ErrNotExists)
+
+	// Non-existing change.
+	err = SetScheduledConfigChangeDeadline(db, change.ID+1, storkutil.UTCNow().Add(time.Hour))
+	require.ErrorIs(t, err, ErrNotExists)
+}
+
+// Test that rescheduling the config change discards its approvals.
+func TestSetScheduledConfigChangeDeadlineResetApprovals(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	users := addTestConfigChangeUsers(t, db, 2)
+
+	change := &ScheduledConfigChange{
+		DeadlineAt:        storkutil.UTCNow().Add(time.Hour),
+		UserID:            int64(users[0].ID),
+		ApprovalStatus:    ScheduledConfigChangeApprovalPending,
+		RequiredApprovals: 1,
+		Updates: []*ConfigUpdate{
+			NewConfigUpdate("kea", "host_add", 1),
+		},
+	}
+	err := AddScheduledConfigChange(db, change)
+	require.NoError(t, err)
+
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+	})
+	require.NoError(t, err)
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewComment,
+		Comment:                 "foo",
+	})
+	require.NoError(t, err)
+
+	returned, err := GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledConfigChangeApprovalApproved, returned.ApprovalStatus)
+
+	// Reschedule the change. It should be pending approval again.
+	deadline := storkutil.UTCNow().Add(-time.Minute).Truncate(time.Second)
+	err = SetScheduledConfigChangeDeadline(db, change.ID, deadline)
+	require.NoError(t, err)
+
+	returned, err = GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, deadline, returned.DeadlineAt)
+	require.Equal(t, ScheduledConfigChangeApprovalPending, returned.ApprovalStatus)
+
+	// The approval should be removed but the comment should be preserved.
+	require.Len(t, returned.Reviews, 1)
+	require.Equal(t, ScheduledConfigChangeReviewComment, returned.Reviews[0].Decision)
+
+	// The change is not due until it is approved again.
+	changes, err := GetDueConfigChanges(db)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	err = AddScheduledConfigChangeReview(db, &ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: change.ID,
+		UserID:                  int64(users[1].ID),
+		Decision:                ScheduledConfigChangeReviewApprove,
+	})
+	require.NoError(t, err)
+
+	changes, err = GetDueConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+
+	// The rejected change should remain rejected.
+	_, err = db.Model(&ScheduledConfigChange{ID: change.ID, ApprovalStatus: ScheduledConfigChangeApprovalRejected}).
+		Column("approval_status").
+		WherePK().
+		Update()
+	require.NoError(t, err)
+
+	err = SetScheduledConfigChangeDeadline(db, change.ID, storkutil.UTCNow().Add(time.Hour))
+	require.NoError(t, err)
+
+	returned, err = GetScheduledConfigChange(db, change.ID)
+	require.NoError(t, err)
+	require.Equal(t, ScheduledConfigChangeApprovalRejected, returned.ApprovalStatus)
+}
@@ -345,6 +345,27 @@ func GetDetailedServicesByAppID(dbi dbops.DBI, appID int64) ([]Service, error) {
 	return services, nil
 }
 
+// Fetches all services to which the given daemon belongs.
+func GetDetailedServicesByDaemonID(dbi dbops.DBI, daemonID int64) ([]Service, error) {
+	var services []Service
+
+	err := dbi.Model(&services).
+		Join("INNER JOIN daemon_to_service AS dtos ON dtos.service_id = service.id").
+		Relation("HAService").
+		Relation("Daemons.KeaDaemon.KeaDHCPDaemon").
+		Relation("Daemons.App").
+		Where("dtos.daemon_id = ?", daemonID).
+		OrderExpr("service.id ASC").
+		Select()
+
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		err = pkgerrors.Wrapf(err, "problem getting services for daemon ID %d", daemonID)
+		return services, err
+	}
+
+	return services, nil
+}
+
 // Fetches all services from the database.
 func GetDetailedAllServices(dbi dbops.DBI) ([]Service, error) {
 	var services []Service
@@ -67,6 +67,21 @@ func InitializeSettings(db *pg.DB, initialPullerInterval int64) error {
 			ValType: SettingValTypeInt,
 			Value:   longInterval,
 		},
+		{
+			Name:    "kea_lease_conflicts_puller_interval", // in seconds
+			ValType: SettingValTypeInt,
+			Value:   longInterval,
+		},
+		{
+			Name:    "exhaustion_forecast_puller_interval", // in seconds
+			ValType: SettingValTypeInt,
+			Value:   longInterval,
+		},
+		{
+			Name:    "exhaustion_forecast_horizon", // in days
+			ValType: SettingValTypeInt,
+			Value:   "30",
+		},
 		{
 			Name:    "kea_status_puller_interval", // in seconds
 			ValType: SettingValTypeInt,
@@ -92,6 +107,106 @@ func InitializeSettings(db *pg.DB, initialPullerInterval int64) error {
 			ValType: SettingValTypeInt,
 			Value:   shortInterval, // in seconds
 		},
+		{
+			Name:    "alert_rules_evaluation_interval", // in seconds
+			ValType: SettingValTypeInt,
+			Value:   mediumInterval,
+		},
+		{
+			Name:    "smtp_host", // empty disables the email notifications
+			ValType: SettingValTypeStr,
+			Value:   "",
+		},
+		{
+			Name:    "smtp_port",
+			ValType: SettingValTypeInt,
+			Value:   "25",
+		},
+		{
+			Name:    "smtp_tls", // implicit TLS, otherwise STARTTLS if offered
+			ValType: SettingValTypeBool,
+			Value:   "false",
+		},
+		{
+			Name:    "smtp_username",
+			ValType: SettingValTypeStr,
+			Value:   "",
+		},
+		{
+			Name:    "smtp_password",
+			ValType: SettingValTypePasswd,
+			Value:   "",
+		},
+		{
+			Name:    "smtp_sender",
+			ValType: SettingValTypeStr,
+			Value:   "",
+		},
+		{
+			Name:    "email_digest_interval", // in seconds
+			ValType: SettingValTypeInt,
+			Value:   "3600",
+		},
+		{
+			Name:    "syslog_address", // host:port, empty disables the forwarding
+			ValType: SettingValTypeStr,
+			Value:   "",
+		},
+		{
+			Name:    "syslog_transport", // udp, tcp or tls
+			ValType: SettingValTypeStr,
+			Value:   "udp",
+		},
+		{
+			Name:    "event_pruner_interval", // in seconds
+			ValType: SettingValTypeInt,
+			Value:   "3600",
+		},
+		{
+			Name:    "event_max_age_info", // in days, zero means no limit
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
+		{
+			Name:    "event_max_age_warning", // in days, zero means no limit
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
+		{
+			Name:    "event_max_age_error", // in days, zero means no limit
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
+		{
+			Name:    "event_max_count_info", // zero means no limit
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
+		{
+			Name:    "event_max_count_warning", // zero means no limit
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
+		{
+			Name:    "event_max_count_error", // zero means no limit
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
+		{
+			Name:    "event_deduplication_window", // in seconds, zero disables merging
+			ValType: SettingValTypeInt,
+			Value:   "300",
+		},
+		{
+			Name:    "event_archive_directory", // empty disables archiving
+			ValType: SettingValTypeStr,
+			Value:   "",
+		},
+		{
+			Name:    "config_change_required_approvals",
+			ValType: SettingValTypeInt,
+			Value:   "0",
+		},
 	}
 
 	// Check if there are new settings vs existing ones. Add new ones to DB.
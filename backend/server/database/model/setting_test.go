@@ -49,6 +49,38 @@ func TestInitializeSettings(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, 30, val)
 
+	val, err = GetSettingInt(db, "smtp_port")
+	require.NoError(t, err)
+	require.EqualValues(t, 25, val)
+
+	val, err = GetSettingInt(db, "email_digest_interval")
+	require.NoError(t, err)
+	require.EqualValues(t, 3600, val)
+
+	smtpTLS, err := GetSettingBool(db, "smtp_tls")
+	require.NoError(t, err)
+	require.False(t, smtpTLS)
+
+	val, err = GetSettingInt(db, "event_pruner_interval")
+	require.NoError(t, err)
+	require.EqualValues(t, 3600, val)
+
+	val, err = GetSettingInt(db, "event_max_count_error")
+	require.NoError(t, err)
+	require.Zero(t, val)
+
+	val, err = GetSettingInt(db, "event_deduplication_window")
+	require.NoError(t, err)
+	require.EqualValues(t, 300, val)
+
+	syslogTransport, err := GetSettingStr(db, "syslog_transport")
+	require.NoError(t, err)
+	require.Equal(t, "udp", syslogTransport)
+
+	smtpPassword, err := GetSettingPasswd(db, "smtp_password")
+	require.NoError(t, err)
+	require.Empty(t, smtpPassword)
+
 	// change the setting
 	err = SetSettingInt(db, "kea_stats_puller_interval", 123)
 	require.NoError(t, err)
@@ -67,7 +99,9 @@ func TestInitializeSettings(t *testing.T) {
 	settingsMap, err := GetAllSettings(db)
 	require.NoError(t, err)
 	require.EqualValues(t, 123, settingsMap["kea_stats_puller_interval"])
-	require.Len(t, settingsMap, count)
+	// The passwords are not returned.
+	require.NotContains(t, settingsMap, "smtp_password")
+	require.Len(t, settingsMap, count-1)
 }
 
 // Check if the intervals are set to a given value.
@@ -86,6 +120,9 @@ func TestInitializeSettingsWithInterval(t *testing.T) {
 	appsStateInterval, err6 := GetSettingInt(db, "apps_state_puller_interval")
 	haStatusInterval, err7 := GetSettingInt(db, "kea_status_puller_interval")
 	metricsInterval, err8 := GetSettingInt(db, "metrics_collector_interval")
+	leaseConflictsInterval, err9 := GetSettingInt(db, "kea_lease_conflicts_puller_interval")
+	exhaustionForecastInterval, err10 := GetSettingInt(db, "exhaustion_forecast_puller_interval")
+	alertRulesInterval, err11 := GetSettingInt(db, "alert_rules_evaluation_interval")
 
 	// Assert
 	require.NoError(t, err1)
@@ -96,6 +133,9 @@ func TestInitializeSettingsWithInterval(t *testing.T) {
 	require.NoError(t, err6)
 	require.NoError(t, err7)
 	require.NoError(t, err8)
+	require.NoError(t, err9)
+	require.NoError(t, err10)
+	require.NoError(t, err11)
 
 	require.EqualValues(t, 42, bind9Interval)
 	require.EqualValues(t, 42, keaStatsInterval)
@@ -103,6 +143,9 @@ func TestInitializeSettingsWithInterval(t *testing.T) {
 	require.EqualValues(t, 42, appsStateInterval)
 	require.EqualValues(t, 42, haStatusInterval)
 	require.EqualValues(t, 42, metricsInterval)
+	require.EqualValues(t, 42, leaseConflictsInterval)
+	require.EqualValues(t, 42, exhaustionForecastInterval)
+	require.EqualValues(t, 42, alertRulesInterval)
 }
 
 // Check getting and setting settings.
@@ -85,6 +85,134 @@ func UpdateSharedNetwork(dbi dbops.DBI, network *SharedNetwork) error {
 	return updateSharedNetwork(dbi.(*pg.Tx), network)
 }
 
+// Associates the existing subnets listed in the shared network with this
+// shared network in a transaction. The subnets which belong to the shared
+// network but are not listed are removed from it. The subnets are merely
+// identified by their IDs.
+func setSharedNetworkSubnets(tx *pg.Tx, network *SharedNetwork) error {
+	var subnetIDs []int64
+	for _, s := range network.Subnets {
+		subnetIDs = append(subnetIDs, s.ID)
+	}
+	q := tx.Model((*Subnet)(nil)).
+		Set("shared_network_id = NULL").
+		Where("subnet.shared_network_id = ?", network.ID)
+	if len(subnetIDs) > 0 {
+		q = q.Where("subnet.id NOT IN (?)", pg.In(subnetIDs))
+	}
+	_, err := q.Update()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return pkgerrors.Wrapf(err, "problem removing subnets from the shared network with ID %d", network.ID)
+	}
+	if len(subnetIDs) == 0 {
+		return nil
+	}
+	_, err = tx.Model((*Subnet)(nil)).
+		Set("shared_network_id = ?", network.ID).
+		Where("subnet.id IN (?)", pg.In(subnetIDs)).
+		Update()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem adding subnets to the shared network with ID %d", network.ID)
+	}
+	for i := range network.Subnets {
+		network.Subnets[i].SharedNetworkID = network.ID
+	}
+	return nil
+}
+
+// Adds new shared network and associates the existing subnets with it
+// in a transaction.
+func addSharedNetworkWithExistingSubnets(tx *pg.Tx, network *SharedNetwork) error {
+	_, err := tx.Model(network).Insert()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem adding new shared network %s to the database", network.Name)
+	}
+	return setSharedNetworkSubnets(tx, network)
+}
+
+// Adds new shared network to the database and moves the existing subnets
+// listed in the shared network into it. The subnets are merely identified
+// by their IDs. It begins a new transaction when dbi has a *pg.DB type or
+// uses an existing transaction when dbi has a *pg.Tx type.
+func AddSharedNetworkWithExistingSubnets(dbi dbops.DBI, network *SharedNetwork) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return addSharedNetworkWithExistingSubnets(tx, network)
+		})
+	}
+	return addSharedNetworkWithExistingSubnets(dbi.(*pg.Tx), network)
+}
+
+// Updates the shared network name and its associations with the existing
+// subnets in a transaction.
+func updateSharedNetworkWithExistingSubnets(tx *pg.Tx, network *SharedNetwork) error {
+	result, err := tx.Model(network).
+		Column("name").
+		WherePK().
+		Update()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem updating the shared network with ID %d", network.ID)
+	} else if result.RowsAffected() <= 0 {
+		return pkgerrors.Wrapf(ErrNotExists, "shared network with ID %d does not exist", network.ID)
+	}
+	return setSharedNetworkSubnets(tx, network)
+}
+
+// Updates the shared network name in the database and sets the existing
+// subnets belonging to the shared network. The subnets listed in the shared
+// network are moved into it and the other subnets are removed from it. The
+// subnets are merely identified by their IDs. It begins a new transaction
+// when dbi has a *pg.DB type or uses an existing transaction when dbi has
+// a *pg.Tx type.
+func UpdateSharedNetworkWithExistingSubnets(dbi dbops.DBI, network *SharedNetwork) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return updateSharedNetworkWithExistingSubnets(tx, network)
+		})
+	}
+	return updateSharedNetworkWithExistingSubnets(dbi.(*pg.Tx), network)
+}
+
+// Fetches the subnets listed in the shared network from the database. The
+// shared network information can be partial when it is created from the
+// request received over the REST API. In particular, the subnets can merely
+// contain their IDs. This function replaces them with the subnets fetched
+// from the database, including the daemons and their configurations. The
+// shared networks the subnets currently belong to are fetched with their
+// subnets, so it is possible to tell which of them become empty after the
+// subnets are moved. If any of the subnets does not exist or an error
+// occurs, the shared network is not updated.
+func (n *SharedNetwork) PopulateSubnets(dbi dbops.DBI) error {
+	var subnets []Subnet
+	for _, s := range n.Subnets {
+		subnet, err := GetSubnet(dbi, s.ID)
+		if err != nil {
+			return pkgerrors.WithMessage(err, "problem with populating subnets")
+		}
+		// Subnet does not exist.
+		if subnet == nil {
+			return pkgerrors.Errorf("problem with populating subnets for shared network %s: subnet %d does not exist", n.Name, s.ID)
+		}
+		// Fetch the daemons along with their configurations.
+		if err = subnet.PopulateDaemons(dbi); err != nil {
+			return err
+		}
+		if subnet.SharedNetworkID != 0 {
+			network, err := GetSharedNetworkWithSubnets(dbi, subnet.SharedNetworkID)
+			if err != nil {
+				return pkgerrors.WithMessage(err, "problem with populating subnets")
+			}
+			if network != nil {
+				subnet.SharedNetwork = network
+			}
+		}
+		subnets = append(subnets, *subnet)
+	}
+	// Everything fine. Assign fetched subnets to the shared network.
+	n.Subnets = subnets
+	return nil
+}
+
 // Fetches all shared networks without subnets. The family argument specifies
 // whether only IPv4 shared networks should be fetched (if 4), only IPv6 shared
 // networks should be fetched (if 6) or both otherwise.
@@ -136,6 +264,7 @@ func GetSharedNetworkWithSubnets(dbi dbops.DBI, networkID int64) (network *Share
 			return q.Order("prefix_pool.id ASC"), nil
 		}).
 		Relation("Subnets.LocalSubnets.Daemon.App.AccessPoints").
+		Relation("Subnets.LocalSubnets.Daemon.App.Machine").
 		Where("shared_network.id = ?", networkID).
 		Select()
 
@@ -234,6 +234,142 @@ func TestUpdateSharedNetwork(t *testing.T) {
 	require.InDelta(t, time.Now().Unix(), returned.StatsCollectedAt.Unix(), 10.0)
 }
 
+// Tests that the shared network can be added with the existing subnets
+// and that the subnets can be moved between the shared networks.
+func TestAddUpdateSharedNetworkWithExistingSubnets(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnets := []Subnet{
+		{
+			Prefix: "192.0.2.0/24",
+		},
+		{
+			Prefix: "192.0.3.0/24",
+		},
+		{
+			Prefix: "192.0.4.0/24",
+		},
+	}
+	for i := range subnets {
+		err := AddSubnet(db, &subnets[i])
+		require.NoError(t, err)
+	}
+
+	// Add the shared network with two existing subnets.
+	network := &SharedNetwork{
+		Name:   "foo",
+		Family: 4,
+		Subnets: []Subnet{
+			{
+				ID: subnets[0].ID,
+			},
+			{
+				ID: subnets[1].ID,
+			},
+		},
+	}
+	err := AddSharedNetworkWithExistingSubnets(db, network)
+	require.NoError(t, err)
+	require.NotZero(t, network.ID)
+
+	returned, err := GetSharedNetworkWithSubnets(db, network.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, "foo", returned.Name)
+	require.Len(t, returned.Subnets, 2)
+
+	// Rename the shared network, remove the first subnet from it and add
+	// the third subnet.
+	network.Name = "bar"
+	network.Subnets = []Subnet{
+		{
+			ID: subnets[1].ID,
+		},
+		{
+			ID: subnets[2].ID,
+		},
+	}
+	err = UpdateSharedNetworkWithExistingSubnets(db, network)
+	require.NoError(t, err)
+
+	returned, err = GetSharedNetworkWithSubnets(db, network.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, "bar", returned.Name)
+	require.Len(t, returned.Subnets, 2)
+	require.ElementsMatch(t, []int64{subnets[1].ID, subnets[2].ID},
+		[]int64{returned.Subnets[0].ID, returned.Subnets[1].ID})
+
+	// The first subnet should become a global subnet.
+	subnet, err := GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+	require.Zero(t, subnet.SharedNetworkID)
+
+	// Updating non-existing shared network should fail.
+	network.ID++
+	err = UpdateSharedNetworkWithExistingSubnets(db, network)
+	require.ErrorIs(t, err, ErrNotExists)
+}
+
+// Tests that the subnets in the shared network are populated from the
+// database and an error is returned when any of them does not exist.
+func TestSharedNetworkPopulateSubnets(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err := AddSubnet(db, &subnet)
+	require.NoError(t, err)
+
+	network := &SharedNetwork{
+		Name: "foo",
+		Subnets: []Subnet{
+			{
+				ID: subnet.ID,
+			},
+		},
+	}
+	err = network.PopulateSubnets(db)
+	require.NoError(t, err)
+	require.Len(t, network.Subnets, 1)
+	require.Equal(t, "192.0.2.0/24", network.Subnets[0].Prefix)
+	require.Nil(t, network.Subnets[0].SharedNetwork)
+
+	// The shared network the subnet belongs to should be fetched with
+	// its subnets.
+	existingNetwork := &SharedNetwork{
+		Name:   "bar",
+		Family: 4,
+	}
+	err = AddSharedNetwork(db, existingNetwork)
+	require.NoError(t, err)
+	memberSubnet := Subnet{
+		Prefix:          "192.0.3.0/24",
+		SharedNetworkID: existingNetwork.ID,
+	}
+	err = AddSubnet(db, &memberSubnet)
+	require.NoError(t, err)
+
+	network.Subnets = []Subnet{{ID: memberSubnet.ID}}
+	err = network.PopulateSubnets(db)
+	require.NoError(t, err)
+	require.NotNil(t, network.Subnets[0].SharedNetwork)
+	require.Equal(t, "bar", network.Subnets[0].SharedNetwork.Name)
+	require.Len(t, network.Subnets[0].SharedNetwork.Subnets, 1)
+	require.Equal(t, memberSubnet.ID, network.Subnets[0].SharedNetwork.Subnets[0].ID)
+
+	network.Subnets = append(network.Subnets, Subnet{
+		ID: memberSubnet.ID + 1,
+	})
+	err = network.PopulateSubnets(db)
+	require.Error(t, err)
+	require.Len(t, network.Subnets, 2)
+}
+
 // Tests that the shared network can be deleted.
 func TestDeleteSharedNetwork(t *testing.T) {
 	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
@@ -155,6 +155,9 @@ type Subnet struct {
 	PdUtilization    int16
 	Stats            SubnetStats
 	StatsCollectedAt time.Time
+	// Projected date of exhausting the addresses or delegated prefixes.
+	// It is zero when the exhaustion is not predicted.
+	ExhaustionForecast time.Time
 }
 
 // Hook executed after inserting a subnet to the database. It updates subnet
@@ -252,6 +255,7 @@ func GetSubnet(dbi dbops.DBI, subnetID int64) (*Subnet, error) {
 		}).
 		Relation("SharedNetwork").
 		Relation("LocalSubnets.Daemon.App.AccessPoints").
+		Relation("LocalSubnets.Daemon.App.Machine").
 		Where("subnet.id = ?", subnetID).
 		Select()
 	if err != nil {
@@ -711,6 +715,23 @@ func (s *Subnet) UpdateStatistics(dbi dbops.DBI, statistics utilizationStats) er
 	return err
 }
 
+// Updates the projected date of exhausting the addresses or delegated
+// prefixes in the subnet. The zero forecast means that the exhaustion is
+// not predicted.
+func (s *Subnet) UpdateExhaustionForecast(dbi dbops.DBI, forecast time.Time) error {
+	s.ExhaustionForecast = forecast
+	result, err := dbi.Model(s).
+		Column("exhaustion_forecast").
+		WherePK().
+		Update()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem updating exhaustion forecast in the subnet: %d", s.ID)
+	} else if result.RowsAffected() <= 0 {
+		err = pkgerrors.Wrapf(ErrNotExists, "subnet with ID %d does not exist", s.ID)
+	}
+	return err
+}
+
 // Deletes subnets which are not associated with any apps. Returns deleted subnet
 // count and an error.
 func DeleteOrphanedSubnets(dbi dbops.DBI) (int64, error) {
@@ -727,3 +748,308 @@ func DeleteOrphanedSubnets(dbi dbops.DBI) (int64, error) {
 	}
 	return int64(result.RowsAffected()), nil
 }
+
+// Associates the daemons with the subnet using the local subnet information
+// held in the subnet instance. Contrary to the addDaemonToSubnet, it uses
+// the local subnet IDs specified in the LocalSubnets rather than the ones
+// found in the daemons' configurations. It is useful when the subnet is
+// created or updated in Stork and the daemons' configurations have not been
+// fetched yet. It removes the associations with the daemons not present in
+// the LocalSubnets.
+func setSubnetLocalSubnets(tx *pg.Tx, subnet *Subnet) error {
+	q := tx.Model((*LocalSubnet)(nil)).
+		Where("subnet_id = ?", subnet.ID)
+	var daemonIDs []int64
+	for _, ls := range subnet.LocalSubnets {
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	if len(daemonIDs) > 0 {
+		q = q.Where("daemon_id NOT IN (?)", pg.In(daemonIDs))
+	}
+	_, err := q.Delete()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return pkgerrors.Wrapf(err, "problem deleting daemons from the subnet with ID %d", subnet.ID)
+	}
+	for _, ls := range subnet.LocalSubnets {
+		localSubnet := LocalSubnet{
+			SubnetID:      subnet.ID,
+			DaemonID:      ls.DaemonID,
+			LocalSubnetID: ls.LocalSubnetID,
+		}
+		_, err = tx.Model(&localSubnet).
+			Column("subnet_id").
+			Column("daemon_id").
+			Column("local_subnet_id").
+			OnConflict("(daemon_id, subnet_id) DO UPDATE").
+			Set("local_subnet_id = EXCLUDED.local_subnet_id").
+			Insert()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem associating the daemon %d with the subnet %s",
+				ls.DaemonID, subnet.Prefix)
+		}
+		ls.SubnetID = subnet.ID
+	}
+	return nil
+}
+
+// Adds a subnet with its pools and associates it with the daemons
+// specified in the LocalSubnets within a transaction.
+func addSubnetWithLocalSubnets(tx *pg.Tx, subnet *Subnet) error {
+	if err := addSubnetWithPools(tx, subnet); err != nil {
+		return err
+	}
+	return setSubnetLocalSubnets(tx, subnet)
+}
+
+// Adds a subnet with its pools into the database and associates it with
+// the daemons specified in the LocalSubnets. The local subnet IDs are taken
+// from the LocalSubnets. It begins a new transaction when dbi has a *pg.DB
+// type or uses an existing transaction when dbi has a *pg.Tx type.
+func AddSubnetWithLocalSubnets(dbi dbops.DBI, subnet *Subnet) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return addSubnetWithLocalSubnets(tx, subnet)
+		})
+	}
+	return addSubnetWithLocalSubnets(dbi.(*pg.Tx), subnet)
+}
+
+// Updates the pools of the subnet in a transaction. The existing pools
+// having the same boundaries as the pools specified in the subnet instance
+// are preserved with their statistics, utilization history and exhaustion
+// forecasts. The remaining existing pools are deleted and the new pools are
+// added. The pools in the subnet instance are replaced with the preserved
+// and added pools.
+func updateSubnetPools(tx *pg.Tx, subnet *Subnet) error {
+	existingAddressPools := []AddressPool{}
+	err := tx.Model(&existingAddressPools).
+		Where("subnet_id = ?", subnet.ID).
+		Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return pkgerrors.Wrapf(err, "problem getting address pools of the subnet with ID %d", subnet.ID)
+	}
+	existingPrefixPools := []PrefixPool{}
+	err = tx.Model(&existingPrefixPools).
+		Where("subnet_id = ?", subnet.ID).
+		Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return pkgerrors.Wrapf(err, "problem getting prefix pools of the subnet with ID %d", subnet.ID)
+	}
+
+	keptIDs := make(map[int64]bool)
+	var newAddressPools []AddressPool
+	for i := range subnet.AddressPools {
+		pool := &subnet.AddressPools[i]
+		pool.ID = 0
+		for _, existing := range existingAddressPools {
+			if !keptIDs[existing.ID] && existing.LowerBound == pool.LowerBound && existing.UpperBound == pool.UpperBound {
+				*pool = existing
+				keptIDs[existing.ID] = true
+				break
+			}
+		}
+		if pool.ID == 0 {
+			newAddressPools = append(newAddressPools, *pool)
+		}
+	}
+	var deletedIDs []int64
+	for _, existing := range existingAddressPools {
+		if !keptIDs[existing.ID] {
+			deletedIDs = append(deletedIDs, existing.ID)
+		}
+	}
+	if len(deletedIDs) > 0 {
+		_, err = tx.Model((*AddressPool)(nil)).
+			Where("id IN (?)", pg.In(deletedIDs)).
+			Delete()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem deleting address pools from the subnet with ID %d", subnet.ID)
+		}
+	}
+
+	keptIDs = make(map[int64]bool)
+	var newPrefixPools []PrefixPool
+	for i := range subnet.PrefixPools {
+		pool := &subnet.PrefixPools[i]
+		pool.ID = 0
+		for _, existing := range existingPrefixPools {
+			if !keptIDs[existing.ID] && existing.Prefix == pool.Prefix && existing.DelegatedLen == pool.DelegatedLen {
+				*pool = existing
+				keptIDs[existing.ID] = true
+				break
+			}
+		}
+		if pool.ID == 0 {
+			newPrefixPools = append(newPrefixPools, *pool)
+		}
+	}
+	deletedIDs = nil
+	for _, existing := range existingPrefixPools {
+		if !keptIDs[existing.ID] {
+			deletedIDs = append(deletedIDs, existing.ID)
+		}
+	}
+	if len(deletedIDs) > 0 {
+		_, err = tx.Model((*PrefixPool)(nil)).
+			Where("id IN (?)", pg.In(deletedIDs)).
+			Delete()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem deleting prefix pools from the subnet with ID %d", subnet.ID)
+		}
+	}
+
+	// Add the new pools and put them in place of the pools lacking IDs.
+	added := &Subnet{
+		ID:           subnet.ID,
+		AddressPools: newAddressPools,
+		PrefixPools:  newPrefixPools,
+	}
+	if err = addSubnetPools(tx, added); err != nil {
+		return err
+	}
+	for i, j := 0, 0; i < len(subnet.AddressPools); i++ {
+		if subnet.AddressPools[i].ID == 0 {
+			subnet.AddressPools[i] = added.AddressPools[j]
+			j++
+		}
+	}
+	for i, j := 0, 0; i < len(subnet.PrefixPools); i++ {
+		if subnet.PrefixPools[i].ID == 0 {
+			subnet.PrefixPools[i] = added.PrefixPools[j]
+			j++
+		}
+	}
+	return nil
+}
+
+// Updates a subnet, its pools and associations with the daemons within
+// a transaction. The pools are updated in place, so the pools that have
+// not changed preserve their statistics and history. The shared network
+// association is not modified.
+func updateSubnetWithLocalSubnets(tx *pg.Tx, subnet *Subnet) error {
+	result, err := tx.Model(subnet).
+		Column("prefix", "client_class").
+		WherePK().
+		Update()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem updating the subnet with ID %d", subnet.ID)
+	} else if result.RowsAffected() <= 0 {
+		return pkgerrors.Wrapf(ErrNotExists, "subnet with ID %d does not exist", subnet.ID)
+	}
+	if err = updateSubnetPools(tx, subnet); err != nil {
+		return err
+	}
+	return setSubnetLocalSubnets(tx, subnet)
+}
+
+// Updates a subnet in the database. It updates the subnet pools and
+// replaces the associations with the daemons with the ones specified in
+// the subnet instance. It begins a new transaction when dbi has a *pg.DB type or
+// uses an existing transaction when dbi has a *pg.Tx type.
+func UpdateSubnetWithLocalSubnets(dbi dbops.DBI, subnet *Subnet) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return updateSubnetWithLocalSubnets(tx, subnet)
+		})
+	}
+	return updateSubnetWithLocalSubnets(dbi.(*pg.Tx), subnet)
+}
+
+// Deletes a subnet with the specified ID. The pools, the associations with
+// the daemons and the hosts belonging to the subnet are deleted as well.
+func DeleteSubnet(dbi dbops.DBI, subnetID int64) error {
+	subnet := &Subnet{
+		ID: subnetID,
+	}
+	result, err := dbi.Model(subnet).WherePK().Delete()
+	if err != nil {
+		return pkgerrors.Wrapf(err, "problem deleting the subnet with ID %d", subnetID)
+	} else if result.RowsAffected() <= 0 {
+		return pkgerrors.Wrapf(ErrNotExists, "subnet with ID %d does not exist", subnetID)
+	}
+	return nil
+}
+
+// Fetches daemon information for each daemon ID within the local subnets.
+// The subnet information can be partial when it is created from the request
+// received over the REST API. In particular, the LocalSubnets can merely
+// contain DaemonID values and the Daemon pointers can be nil. In order
+// to initialize Daemon pointers, this function fetches the daemons from
+// the database and assigns them to the respective LocalSubnet instances.
+// If any of the daemons does not exist or an error occurs, the subnet
+// is not updated.
+func (s *Subnet) PopulateDaemons(dbi dbops.DBI) error {
+	var daemons []*Daemon
+	for _, ls := range s.LocalSubnets {
+		// DaemonID is required for this function to run.
+		if ls.DaemonID == 0 {
+			return pkgerrors.Errorf("problem with populating daemons: subnet %d lacks daemon ID", s.ID)
+		}
+		daemon, err := GetDaemonByID(dbi, ls.DaemonID)
+		if err != nil {
+			return pkgerrors.WithMessage(err, "problem with populating daemons")
+		}
+		// Daemon does not exist.
+		if daemon == nil {
+			return pkgerrors.Errorf("problem with populating daemons for subnet %d: daemon %d does not exist", s.ID, ls.DaemonID)
+		}
+		daemons = append(daemons, daemon)
+	}
+	// Everything fine. Assign fetched daemons to the subnet.
+	for i := range s.LocalSubnets {
+		s.LocalSubnets[i].Daemon = daemons[i]
+	}
+	return nil
+}
+
+// Returns subnet prefix. It implements the keaconfig.SubnetAccessor
+// interface.
+func (s Subnet) GetPrefix() string {
+	return s.Prefix
+}
+
+// Returns client class associated with the subnet. It implements the
+// keaconfig.SubnetAccessor interface.
+func (s Subnet) GetClientClass() string {
+	return s.ClientClass
+}
+
+// Returns address pools as ranges (lower and upper bound separated with
+// a hyphen). It implements the keaconfig.SubnetAccessor interface.
+func (s Subnet) GetAddressPoolRanges() (ranges []string) {
+	for _, p := range s.AddressPools {
+		ranges = append(ranges, fmt.Sprintf("%s-%s", p.LowerBound, p.UpperBound))
+	}
+	return
+}
+
+// Returns delegated prefix pools. It implements the keaconfig.SubnetAccessor
+// interface.
+func (s Subnet) GetPrefixPools() (pools []struct {
+	Prefix       string
+	DelegatedLen int
+},
+) {
+	for _, p := range s.PrefixPools {
+		pools = append(pools, struct {
+			Prefix       string
+			DelegatedLen int
+		}{
+			Prefix:       p.Prefix,
+			DelegatedLen: p.DelegatedLen,
+		})
+	}
+	return
+}
+
+// Returns local subnet ID for a given daemon. It returns an error when the
+// subnet is not associated with the daemon. It implements the
+// keaconfig.SubnetAccessor interface.
+func (s Subnet) GetLocalSubnetID(daemonID int64) (int64, error) {
+	for _, ls := range s.LocalSubnets {
+		if ls.DaemonID == daemonID {
+			return ls.LocalSubnetID, nil
+		}
+	}
+	return 0, pkgerrors.Errorf("local subnet id not found in subnet %s for daemon %d", s.Prefix, daemonID)
+}
@@ -1133,3 +1133,241 @@ func BenchmarkAddDaemonToSubnet(b *testing.B) {
 		})
 	}
 }
+
+// Test that the subnet is added to the database along with the
+// associations with the daemons and the local subnet IDs.
+func TestAddSubnetWithLocalSubnets(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	apps := addTestSubnetApps(t, db)
+	require.Len(t, apps, 2)
+
+	subnet := &Subnet{
+		Prefix: "192.0.3.0/24",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "192.0.3.10",
+				UpperBound: "192.0.3.20",
+			},
+		},
+		LocalSubnets: []*LocalSubnet{
+			{
+				DaemonID:      apps[0].Daemons[0].ID,
+				LocalSubnetID: 5,
+			},
+			{
+				DaemonID:      apps[1].Daemons[0].ID,
+				LocalSubnetID: 6,
+			},
+		},
+	}
+	err := AddSubnetWithLocalSubnets(db, subnet)
+	require.NoError(t, err)
+	require.NotZero(t, subnet.ID)
+
+	returnedSubnet, err := GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returnedSubnet)
+	require.Len(t, returnedSubnet.AddressPools, 1)
+	require.Len(t, returnedSubnet.LocalSubnets, 2)
+	require.EqualValues(t, 5, returnedSubnet.LocalSubnets[0].LocalSubnetID)
+	require.EqualValues(t, 6, returnedSubnet.LocalSubnets[1].LocalSubnetID)
+}
+
+// Test that the subnet, its pools and the associations with the daemons
+// are updated in the database.
+func TestUpdateSubnetWithLocalSubnets(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	apps := addTestSubnetApps(t, db)
+	require.Len(t, apps, 2)
+
+	subnet := &Subnet{
+		Prefix: "192.0.3.0/24",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "192.0.3.10",
+				UpperBound: "192.0.3.20",
+			},
+			{
+				LowerBound: "192.0.3.50",
+				UpperBound: "192.0.3.60",
+			},
+		},
+		LocalSubnets: []*LocalSubnet{
+			{
+				DaemonID:      apps[0].Daemons[0].ID,
+				LocalSubnetID: 5,
+			},
+		},
+	}
+	err := AddSubnetWithLocalSubnets(db, subnet)
+	require.NoError(t, err)
+	require.NotZero(t, subnet.ID)
+	require.Len(t, subnet.AddressPools, 2)
+	keptPoolID := subnet.AddressPools[1].ID
+
+	// Set the utilization of the pool that is kept.
+	_, err = db.Model(&AddressPool{ID: keptPoolID, Utilization: 150}).
+		Column("utilization").
+		WherePK().
+		Update()
+	require.NoError(t, err)
+
+	// Replace one of the pools and the daemon.
+	updatedSubnet := &Subnet{
+		ID:          subnet.ID,
+		Prefix:      "192.0.3.0/24",
+		ClientClass: "foo",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "192.0.3.30",
+				UpperBound: "192.0.3.40",
+			},
+			{
+				LowerBound: "192.0.3.50",
+				UpperBound: "192.0.3.60",
+			},
+		},
+		LocalSubnets: []*LocalSubnet{
+			{
+				DaemonID:      apps[1].Daemons[0].ID,
+				LocalSubnetID: 7,
+			},
+		},
+	}
+	err = UpdateSubnetWithLocalSubnets(db, updatedSubnet)
+	require.NoError(t, err)
+
+	returnedSubnet, err := GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returnedSubnet)
+	require.Equal(t, "foo", returnedSubnet.ClientClass)
+	require.Len(t, returnedSubnet.AddressPools, 2)
+	// The unchanged pool should be preserved with its utilization.
+	require.Equal(t, keptPoolID, updatedSubnet.AddressPools[1].ID)
+	require.NotZero(t, updatedSubnet.AddressPools[0].ID)
+	require.NotEqual(t, subnet.AddressPools[0].ID, updatedSubnet.AddressPools[0].ID)
+	require.ElementsMatch(t,
+		[]string{"192.0.3.30", "192.0.3.50"},
+		[]string{returnedSubnet.AddressPools[0].LowerBound, returnedSubnet.AddressPools[1].LowerBound})
+	for _, pool := range returnedSubnet.AddressPools {
+		if pool.ID == keptPoolID {
+			require.Equal(t, "192.0.3.50", pool.LowerBound)
+			require.EqualValues(t, 150, pool.Utilization)
+		} else {
+			require.Zero(t, pool.Utilization)
+		}
+	}
+	require.Len(t, returnedSubnet.LocalSubnets, 1)
+	require.Equal(t, apps[1].Daemons[0].ID, returnedSubnet.LocalSubnets[0].DaemonID)
+	require.EqualValues(t, 7, returnedSubnet.LocalSubnets[0].LocalSubnetID)
+
+	// Updating non-existing subnet should fail.
+	updatedSubnet.ID = subnet.ID + 1
+	err = UpdateSubnetWithLocalSubnets(db, updatedSubnet)
+	require.ErrorIs(t, err, ErrNotExists)
+}
+
+// Test that the subnet can be deleted from the database.
+func TestDeleteSubnet(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := &Subnet{
+		Prefix: "192.0.3.0/24",
+	}
+	err := AddSubnet(db, subnet)
+	require.NoError(t, err)
+	require.NotZero(t, subnet.ID)
+
+	err = DeleteSubnet(db, subnet.ID)
+	require.NoError(t, err)
+
+	returnedSubnet, err := GetSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	require.Nil(t, returnedSubnet)
+
+	// The subnet no longer exists.
+	err = DeleteSubnet(db, subnet.ID)
+	require.ErrorIs(t, err, ErrNotExists)
+}
+
+// Test that the daemons are fetched from the database and assigned to
+// the local subnets.
+func TestSubnetPopulateDaemons(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	apps := addTestSubnetApps(t, db)
+	require.Len(t, apps, 2)
+
+	subnet := &Subnet{
+		Prefix: "192.0.3.0/24",
+		LocalSubnets: []*LocalSubnet{
+			{
+				DaemonID: apps[0].Daemons[0].ID,
+			},
+			{
+				DaemonID: apps[1].Daemons[0].ID,
+			},
+		},
+	}
+	err := subnet.PopulateDaemons(db)
+	require.NoError(t, err)
+	require.NotNil(t, subnet.LocalSubnets[0].Daemon)
+	require.NotNil(t, subnet.LocalSubnets[1].Daemon)
+	require.Equal(t, apps[0].Daemons[0].ID, subnet.LocalSubnets[0].Daemon.ID)
+	require.Equal(t, apps[1].Daemons[0].ID, subnet.LocalSubnets[1].Daemon.ID)
+
+	// Non-existing daemon.
+	subnet.LocalSubnets = append(subnet.LocalSubnets, &LocalSubnet{
+		DaemonID: 1000,
+	})
+	err = subnet.PopulateDaemons(db)
+	require.Error(t, err)
+}
+
+// Test the functions implementing the keaconfig.SubnetAccessor interface.
+func TestSubnetAccessor(t *testing.T) {
+	subnet := Subnet{
+		Prefix:      "2001:db8:1::/64",
+		ClientClass: "foo",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "2001:db8:1::10",
+				UpperBound: "2001:db8:1::20",
+			},
+		},
+		PrefixPools: []PrefixPool{
+			{
+				Prefix:       "3000::/48",
+				DelegatedLen: 64,
+			},
+		},
+		LocalSubnets: []*LocalSubnet{
+			{
+				DaemonID:      1,
+				LocalSubnetID: 123,
+			},
+		},
+	}
+	var _ keaconfig.SubnetAccessor = subnet
+
+	require.Equal(t, "2001:db8:1::/64", subnet.GetPrefix())
+	require.Equal(t, "foo", subnet.GetClientClass())
+	require.Equal(t, []string{"2001:db8:1::10-2001:db8:1::20"}, subnet.GetAddressPoolRanges())
+	prefixPools := subnet.GetPrefixPools()
+	require.Len(t, prefixPools, 1)
+	require.Equal(t, "3000::/48", prefixPools[0].Prefix)
+	require.Equal(t, 64, prefixPools[0].DelegatedLen)
+
+	localSubnetID, err := subnet.GetLocalSubnetID(1)
+	require.NoError(t, err)
+	require.EqualValues(t, 123, localSubnetID)
+
+	_, err = subnet.GetLocalSubnetID(2)
+	require.Error(t, err)
+}
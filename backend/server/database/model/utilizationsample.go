@@ -0,0 +1,212 @@
+package dbmodel
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+)
+
+// Describes how long the utilization samples of a given resolution are
+// kept in the database before they are downsampled to the next resolution
+// or deleted.
+type UtilizationHistoryLevel struct {
+	// Resolution of the samples. Zero means that the samples are recorded
+	// on every statistics pull.
+	Resolution time.Duration
+	// Maximum age of the samples of this resolution.
+	Retention time.Duration
+}
+
+// Levels of the utilization history ordered from the finest resolution.
+// The raw samples are kept for a day, the hourly samples for a month and
+// the daily samples for two years.
+var UtilizationHistoryLevels = []UtilizationHistoryLevel{
+	{Resolution: 0, Retention: 24 * time.Hour},
+	{Resolution: time.Hour, Retention: 31 * 24 * time.Hour},
+	{Resolution: 24 * time.Hour, Retention: 2 * 365 * 24 * time.Hour},
+}
+
+// Represents a historical utilization of a subnet, a shared network or a
+// pool. Exactly one of the SubnetID, SharedNetworkID, AddressPoolID and
+// PrefixPoolID is set. The downsampled
+// samples hold the average utilization and the last statistics in the
+// period described by the resolution.
+type UtilizationSample struct {
+	ID              int64
+	SubnetID        int64
+	SharedNetworkID int64
+	AddressPoolID   int64
+	PrefixPoolID    int64
+	// Resolution in seconds.
+	Resolution      int64 `pg:",use_zero"`
+	SampledAt       time.Time
+	AddrUtilization int16 `pg:",use_zero"`
+	PdUtilization   int16 `pg:",use_zero"`
+	Stats           SubnetStats
+	// Number of raw samples aggregated in this sample.
+	SampleCount int64 `pg:",use_zero"`
+}
+
+// Creates a raw utilization sample from the statistics. The caller is
+// responsible for setting the subnet, shared network or pool ID.
+func NewUtilizationSample(statistics utilizationStats, sampledAt time.Time) *UtilizationSample {
+	return &UtilizationSample{
+		SampledAt:       sampledAt,
+		AddrUtilization: int16(statistics.GetAddressUtilization() * 1000),
+		PdUtilization:   int16(statistics.GetDelegatedPrefixUtilization() * 1000),
+		Stats:           statistics.GetStatistics(),
+		SampleCount:     1,
+	}
+}
+
+// Inserts the utilization samples into the database.
+func AddUtilizationSamples(dbi dbops.DBI, samples []*UtilizationSample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	_, err := dbi.Model(&samples).Insert()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem inserting %d utilization samples", len(samples))
+	}
+	return err
+}
+
+// Returns an SQL expression truncating the sampled_at column to the
+// beginning of the period of the specified length in seconds.
+func utilizationBucketExpr(seconds int64) string {
+	return "TIMESTAMP 'epoch' + FLOOR(EXTRACT(EPOCH FROM sampled_at) / " + strconv.FormatInt(seconds, 10) +
+		") * " + strconv.FormatInt(seconds, 10) + " * INTERVAL '1 second'"
+}
+
+// Downsamples the utilization samples in a transaction.
+func downsampleUtilizationSamples(tx *pg.Tx, now time.Time) error {
+	for i, level := range UtilizationHistoryLevels {
+		cutoff := now.Add(-level.Retention)
+		if i == len(UtilizationHistoryLevels)-1 {
+			_, err := tx.Model((*UtilizationSample)(nil)).
+				Where("resolution = ?", int64(level.Resolution.Seconds())).
+				Where("sampled_at < ?", cutoff).
+				Delete()
+			if err != nil {
+				return pkgerrors.Wrapf(err, "problem deleting utilization samples older than %s", cutoff)
+			}
+			break
+		}
+		// Only the complete periods of the next resolution are aggregated.
+		// It guarantees that the aggregated period never receives more
+		// samples of the current resolution.
+		next := UtilizationHistoryLevels[i+1].Resolution
+		cutoff = cutoff.Truncate(next)
+		nextSeconds := int64(next.Seconds())
+		bucket := utilizationBucketExpr(nextSeconds)
+		_, err := tx.Exec(`
+			INSERT INTO utilization_sample (subnet_id, shared_network_id, address_pool_id, prefix_pool_id,
+				resolution, sampled_at, addr_utilization, pd_utilization, stats, sample_count)
+			SELECT subnet_id, shared_network_id, address_pool_id, prefix_pool_id, ?0, `+bucket+`,
+				(SUM(addr_utilization::BIGINT * sample_count) / SUM(sample_count))::SMALLINT,
+				(SUM(pd_utilization::BIGINT * sample_count) / SUM(sample_count))::SMALLINT,
+				(ARRAY_AGG(stats ORDER BY sampled_at DESC))[1],
+				SUM(sample_count)
+			FROM utilization_sample
+			WHERE resolution = ?1 AND sampled_at < ?2
+			GROUP BY subnet_id, shared_network_id, address_pool_id, prefix_pool_id, `+bucket,
+			nextSeconds, int64(level.Resolution.Seconds()), cutoff)
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem downsampling utilization samples older than %s", cutoff)
+		}
+		_, err = tx.Model((*UtilizationSample)(nil)).
+			Where("resolution = ?", int64(level.Resolution.Seconds())).
+			Where("sampled_at < ?", cutoff).
+			Delete()
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem deleting downsampled utilization samples older than %s", cutoff)
+		}
+	}
+	return nil
+}
+
+// Aggregates the utilization samples older than the retention time of
+// their resolution into the samples of the next resolution. The samples
+// of the coarsest resolution older than its retention time are deleted.
+func DownsampleUtilizationSamples(dbi dbops.DBI, now time.Time) error {
+	if db, ok := dbi.(*pg.DB); ok {
+		return db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			return downsampleUtilizationSamples(tx, now)
+		})
+	}
+	return downsampleUtilizationSamples(dbi.(*pg.Tx), now)
+}
+
+// Returns the utilization samples of the subnet, shared network or pool in
+// the specified time range. The ownerColumn is one of subnet_id,
+// shared_network_id, address_pool_id and prefix_pool_id.
+func getUtilizationHistory(dbi dbops.DBI, ownerColumn string, ownerID int64, from, to time.Time, resolution time.Duration) ([]UtilizationSample, error) {
+	samples := []UtilizationSample{}
+	seconds := int64(resolution.Seconds())
+	var err error
+	if seconds <= 0 {
+		err = dbi.Model(&samples).
+			Where("? = ?", pg.Ident(ownerColumn), ownerID).
+			Where("sampled_at >= ?", from).
+			Where("sampled_at <= ?", to).
+			OrderExpr("sampled_at ASC").
+			Select()
+	} else {
+		// Aggregate the samples in the periods of the requested resolution.
+		// The samples of the coarser resolution yield one sample each.
+		bucket := utilizationBucketExpr(seconds)
+		_, err = dbi.Query(&samples, `
+			SELECT ?0 AS `+ownerColumn+`,
+				GREATEST(?1, MAX(resolution)) AS resolution,
+				MIN(sampled_at) AS sampled_at,
+				(SUM(addr_utilization::BIGINT * sample_count) / SUM(sample_count))::SMALLINT AS addr_utilization,
+				(SUM(pd_utilization::BIGINT * sample_count) / SUM(sample_count))::SMALLINT AS pd_utilization,
+				(ARRAY_AGG(stats ORDER BY sampled_at DESC))[1] AS stats,
+				SUM(sample_count) AS sample_count
+			FROM utilization_sample
+			WHERE `+ownerColumn+` = ?0 AND sampled_at >= ?2 AND sampled_at <= ?3
+			GROUP BY `+bucket+`
+			ORDER BY sampled_at ASC`,
+			ownerID, seconds, from, to)
+	}
+	if err != nil {
+		return nil, pkgerrors.Wrapf(err, "problem getting utilization history for %s %d", ownerColumn, ownerID)
+	}
+	return samples, nil
+}
+
+// Returns the utilization history of the subnet in the specified time
+// range. A zero resolution returns the samples as stored in the database.
+// Otherwise, the samples are aggregated in the periods of the specified
+// resolution.
+func GetSubnetUtilizationHistory(dbi dbops.DBI, subnetID int64, from, to time.Time, resolution time.Duration) ([]UtilizationSample, error) {
+	return getUtilizationHistory(dbi, "subnet_id", subnetID, from, to, resolution)
+}
+
+// Returns the utilization history of the shared network in the specified
+// time range. A zero resolution returns the samples as stored in the
+// database. Otherwise, the samples are aggregated in the periods of the
+// specified resolution.
+func GetSharedNetworkUtilizationHistory(dbi dbops.DBI, sharedNetworkID int64, from, to time.Time, resolution time.Duration) ([]UtilizationSample, error) {
+	return getUtilizationHistory(dbi, "shared_network_id", sharedNetworkID, from, to, resolution)
+}
+
+// Returns the utilization history of the address pool in the specified
+// time range. A zero resolution returns the samples as stored in the
+// database. Otherwise, the samples are aggregated in the periods of the
+// specified resolution.
+func GetAddressPoolUtilizationHistory(dbi dbops.DBI, poolID int64, from, to time.Time, resolution time.Duration) ([]UtilizationSample, error) {
+	return getUtilizationHistory(dbi, "address_pool_id", poolID, from, to, resolution)
+}
+
+// Returns the utilization history of the prefix pool in the specified
+// time range. A zero resolution returns the samples as stored in the
+// database. Otherwise, the samples are aggregated in the periods of the
+// specified resolution.
+func GetPrefixPoolUtilizationHistory(dbi dbops.DBI, poolID int64, from, to time.Time, resolution time.Duration) ([]UtilizationSample, error) {
+	return getUtilizationHistory(dbi, "prefix_pool_id", poolID, from, to, resolution)
+}
@@ -0,0 +1,236 @@
+package dbmodel
+
+import (
+	"testing"
+	"time"
+
+	require "github.com/stretchr/testify/require"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test that the utilization sample is created from the statistics.
+func TestNewUtilizationSample(t *testing.T) {
+	sampledAt := time.Date(2023, 5, 10, 12, 30, 0, 0, time.UTC)
+	stats := SubnetStats{"total-nas": uint64(100)}
+	sample := NewUtilizationSample(newUtilizationStatsMock(0.25, 0.5, stats), sampledAt)
+	require.Equal(t, sampledAt, sample.SampledAt)
+	require.Zero(t, sample.Resolution)
+	require.EqualValues(t, 250, sample.AddrUtilization)
+	require.EqualValues(t, 500, sample.PdUtilization)
+	require.Equal(t, stats, sample.Stats)
+	require.EqualValues(t, 1, sample.SampleCount)
+	require.Zero(t, sample.SubnetID)
+	require.Zero(t, sample.SharedNetworkID)
+}
+
+// Test that the utilization samples are downsampled to the coarser
+// resolutions and returned at the requested resolution.
+func TestUtilizationHistory(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := &Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err := AddSubnet(db, subnet)
+	require.NoError(t, err)
+
+	network := &SharedNetwork{
+		Name:   "foo",
+		Family: 4,
+	}
+	err = AddSharedNetwork(db, network)
+	require.NoError(t, err)
+
+	now := time.Date(2023, 5, 10, 12, 30, 0, 0, time.UTC)
+	newSample := func(sampledAt time.Time, resolution time.Duration, utilization int16, count int64) *UtilizationSample {
+		return &UtilizationSample{
+			SubnetID:        subnet.ID,
+			Resolution:      int64(resolution.Seconds()),
+			SampledAt:       sampledAt,
+			AddrUtilization: utilization,
+			Stats:           SubnetStats{"assigned-addresses": uint64(utilization)},
+			SampleCount:     count,
+		}
+	}
+	samples := []*UtilizationSample{
+		// Daily sample older than two years.
+		newSample(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), 24*time.Hour, 100, 24),
+		// Hourly samples older than a month.
+		newSample(time.Date(2023, 4, 1, 5, 0, 0, 0, time.UTC), time.Hour, 100, 3),
+		newSample(time.Date(2023, 4, 1, 7, 0, 0, 0, time.UTC), time.Hour, 400, 1),
+		// Raw samples older than a day.
+		newSample(time.Date(2023, 5, 9, 10, 10, 0, 0, time.UTC), 0, 200, 1),
+		newSample(time.Date(2023, 5, 9, 10, 40, 0, 0, time.UTC), 0, 400, 1),
+		// Raw sample older than a day but in the incomplete hour.
+		newSample(time.Date(2023, 5, 9, 12, 10, 0, 0, time.UTC), 0, 600, 1),
+		// Recent raw samples.
+		newSample(time.Date(2023, 5, 10, 11, 30, 0, 0, time.UTC), 0, 500, 1),
+		newSample(time.Date(2023, 5, 10, 12, 20, 0, 0, time.UTC), 0, 700, 1),
+		// Shared network sample.
+		{
+			SharedNetworkID: network.ID,
+			SampledAt:       time.Date(2023, 5, 10, 12, 20, 0, 0, time.UTC),
+			AddrUtilization: 900,
+			SampleCount:     1,
+		},
+	}
+	err = AddUtilizationSamples(db, samples)
+	require.NoError(t, err)
+
+	err = DownsampleUtilizationSamples(db, now)
+	require.NoError(t, err)
+
+	from := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	history, err := GetSubnetUtilizationHistory(db, subnet.ID, from, now, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 5)
+
+	require.Equal(t, time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), history[0].SampledAt)
+	require.EqualValues(t, 86400, history[0].Resolution)
+	require.EqualValues(t, 175, history[0].AddrUtilization)
+	require.EqualValues(t, 4, history[0].SampleCount)
+	require.EqualValues(t, 400, history[0].Stats["assigned-addresses"])
+
+	require.Equal(t, time.Date(2023, 5, 9, 10, 0, 0, 0, time.UTC), history[1].SampledAt)
+	require.EqualValues(t, 3600, history[1].Resolution)
+	require.EqualValues(t, 300, history[1].AddrUtilization)
+	require.EqualValues(t, 2, history[1].SampleCount)
+
+	require.Equal(t, time.Date(2023, 5, 9, 12, 10, 0, 0, time.UTC), history[2].SampledAt)
+	require.Zero(t, history[2].Resolution)
+	require.EqualValues(t, 600, history[2].AddrUtilization)
+
+	require.Equal(t, time.Date(2023, 5, 10, 11, 30, 0, 0, time.UTC), history[3].SampledAt)
+	require.Equal(t, time.Date(2023, 5, 10, 12, 20, 0, 0, time.UTC), history[4].SampledAt)
+
+	// Aggregate the samples daily.
+	history, err = GetSubnetUtilizationHistory(db, subnet.ID, from, now, 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+
+	require.EqualValues(t, subnet.ID, history[0].SubnetID)
+	require.EqualValues(t, 86400, history[0].Resolution)
+	require.EqualValues(t, 175, history[0].AddrUtilization)
+
+	require.Equal(t, time.Date(2023, 5, 9, 10, 0, 0, 0, time.UTC), history[1].SampledAt)
+	require.EqualValues(t, 86400, history[1].Resolution)
+	require.EqualValues(t, 400, history[1].AddrUtilization)
+	require.EqualValues(t, 3, history[1].SampleCount)
+	require.EqualValues(t, 600, history[1].Stats["assigned-addresses"])
+
+	require.EqualValues(t, 600, history[2].AddrUtilization)
+	require.EqualValues(t, 2, history[2].SampleCount)
+
+	// Limit the time range.
+	history, err = GetSubnetUtilizationHistory(db, subnet.ID, time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC), now, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	// Shared network history.
+	history, err = GetSharedNetworkUtilizationHistory(db, network.ID, from, now, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.EqualValues(t, network.ID, history[0].SharedNetworkID)
+	require.EqualValues(t, 900, history[0].AddrUtilization)
+	require.EqualValues(t, 3600, history[0].Resolution)
+}
+
+// Test that the utilization history is deleted together with the subnet.
+func TestDeleteSubnetDeletesUtilizationHistory(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := &Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err := AddSubnet(db, subnet)
+	require.NoError(t, err)
+
+	sample := NewUtilizationSample(newUtilizationStatsMock(0.1, 0, SubnetStats{}), time.Now().UTC())
+	sample.SubnetID = subnet.ID
+	err = AddUtilizationSamples(db, []*UtilizationSample{sample})
+	require.NoError(t, err)
+
+	err = DeleteSubnet(db, subnet.ID)
+	require.NoError(t, err)
+
+	count, err := db.Model((*UtilizationSample)(nil)).Count()
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+// Test that the utilization history of the address and prefix pools is
+// stored and returned.
+func TestPoolUtilizationHistory(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	subnet := &Subnet{
+		Prefix: "2001:db8:1::/64",
+		AddressPools: []AddressPool{
+			{
+				LowerBound: "2001:db8:1::10",
+				UpperBound: "2001:db8:1::20",
+			},
+		},
+		PrefixPools: []PrefixPool{
+			{
+				Prefix:       "2001:db8:1:1::/80",
+				DelegatedLen: 96,
+			},
+		},
+	}
+	err := AddSubnet(db, subnet)
+	require.NoError(t, err)
+
+	now := time.Date(2023, 5, 10, 12, 30, 0, 0, time.UTC)
+	err = AddUtilizationSamples(db, []*UtilizationSample{
+		{
+			AddressPoolID:   subnet.AddressPools[0].ID,
+			SampledAt:       now.Add(-2 * time.Hour),
+			AddrUtilization: 100,
+			SampleCount:     1,
+		},
+		{
+			AddressPoolID:   subnet.AddressPools[0].ID,
+			SampledAt:       now.Add(-time.Hour),
+			AddrUtilization: 300,
+			SampleCount:     1,
+		},
+		{
+			PrefixPoolID:  subnet.PrefixPools[0].ID,
+			SampledAt:     now.Add(-time.Hour),
+			PdUtilization: 500,
+			SampleCount:   1,
+		},
+	})
+	require.NoError(t, err)
+
+	from := now.Add(-24 * time.Hour)
+	history, err := GetAddressPoolUtilizationHistory(db, subnet.AddressPools[0].ID, from, now, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.EqualValues(t, subnet.AddressPools[0].ID, history[0].AddressPoolID)
+	require.EqualValues(t, 100, history[0].AddrUtilization)
+	require.EqualValues(t, 300, history[1].AddrUtilization)
+
+	history, err = GetAddressPoolUtilizationHistory(db, subnet.AddressPools[0].ID, from, now, 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.EqualValues(t, 200, history[0].AddrUtilization)
+	require.EqualValues(t, 2, history[0].SampleCount)
+
+	history, err = GetPrefixPoolUtilizationHistory(db, subnet.PrefixPools[0].ID, from, now, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.EqualValues(t, subnet.PrefixPools[0].ID, history[0].PrefixPoolID)
+	require.EqualValues(t, 500, history[0].PdUtilization)
+
+	// The pool history is deleted together with the subnet.
+	err = DeleteSubnet(db, subnet.ID)
+	require.NoError(t, err)
+	count, err := db.Model((*UtilizationSample)(nil)).Count()
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
@@ -0,0 +1,118 @@
+package dbmodel
+
+import (
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	pkgerrors "github.com/pkg/errors"
+	dbops "isc.org/stork/server/database"
+)
+
+// Represents an HTTP endpoint to which the events are posted. The
+// events are filtered by the level and the related machine, app, daemon
+// and subnet like for the SSE subscribers. The zero filter values match
+// all events. The payloads are signed with the secret when it is set.
+type Webhook struct {
+	ID        int64
+	CreatedAt time.Time
+	URL       string `pg:"url"`
+	Secret    string `pg:",use_zero"`
+	Enabled   bool   `pg:",use_zero"`
+	Level     int    `pg:",use_zero"`
+	MachineID int64  `pg:",use_zero"`
+	AppID     int64  `pg:",use_zero"`
+	DaemonID  int64  `pg:",use_zero"`
+	SubnetID  int64  `pg:",use_zero"`
+}
+
+// Checks if the webhook URL is a valid HTTP or HTTPS URL and the level
+// and the filters are valid.
+func (webhook *Webhook) Validate() error {
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil {
+		return pkgerrors.Wrapf(err, "invalid webhook URL %s", webhook.URL)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return pkgerrors.Errorf("webhook URL %s is not a valid HTTP or HTTPS URL", webhook.URL)
+	}
+	if webhook.Level < EvInfo || webhook.Level > EvError {
+		return pkgerrors.Errorf("invalid webhook level %d", webhook.Level)
+	}
+	if webhook.MachineID < 0 || webhook.AppID < 0 || webhook.DaemonID < 0 || webhook.SubnetID < 0 {
+		return pkgerrors.New("webhook filters must not be negative")
+	}
+	return nil
+}
+
+// Adds the webhook to the database.
+func AddWebhook(dbi dbops.DBI, webhook *Webhook) error {
+	_, err := dbi.Model(webhook).Insert()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem adding webhook %s", webhook.URL)
+	}
+	return err
+}
+
+// Updates the webhook in the database.
+func UpdateWebhook(dbi dbops.DBI, webhook *Webhook) error {
+	result, err := dbi.Model(webhook).
+		ExcludeColumn("created_at").
+		WherePK().
+		Update()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem updating webhook with ID %d", webhook.ID)
+	} else if result.RowsAffected() <= 0 {
+		err = pkgerrors.Wrapf(ErrNotExists, "webhook with ID %d does not exist", webhook.ID)
+	}
+	return err
+}
+
+// Deletes the webhook from the database.
+func DeleteWebhook(dbi dbops.DBI, id int64) error {
+	webhook := &Webhook{ID: id}
+	result, err := dbi.Model(webhook).WherePK().Delete()
+	if err != nil {
+		err = pkgerrors.Wrapf(err, "problem deleting webhook with ID %d", id)
+	} else if result.RowsAffected() <= 0 {
+		err = pkgerrors.Wrapf(ErrNotExists, "webhook with ID %d does not exist", id)
+	}
+	return err
+}
+
+// Returns the webhook by ID or nil if it does not exist.
+func GetWebhook(dbi dbops.DBI, id int64) (*Webhook, error) {
+	webhook := &Webhook{}
+	err := dbi.Model(webhook).Where("id = ?", id).Select()
+	if err != nil {
+		if errors.Is(err, pg.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, pkgerrors.Wrapf(err, "problem getting webhook with ID %d", id)
+	}
+	return webhook, nil
+}
+
+// Returns all webhooks ordered by ID.
+func GetAllWebhooks(dbi dbops.DBI) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := dbi.Model(&webhooks).OrderExpr("id ASC").Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrap(err, "problem getting webhooks")
+	}
+	return webhooks, nil
+}
+
+// Returns the enabled webhooks ordered by ID.
+func GetEnabledWebhooks(dbi dbops.DBI) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := dbi.Model(&webhooks).
+		Where("enabled").
+		OrderExpr("id ASC").
+		Select()
+	if err != nil && !errors.Is(err, pg.ErrNoRows) {
+		return nil, pkgerrors.Wrap(err, "problem getting enabled webhooks")
+	}
+	return webhooks, nil
+}
@@ -0,0 +1,114 @@
+package dbmodel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test validating the webhooks.
+func TestWebhookValidate(t *testing.T) {
+	webhook := Webhook{
+		URL:      "https://example.org/hooks/stork",
+		Level:    EvWarning,
+		SubnetID: 1,
+	}
+	require.NoError(t, webhook.Validate())
+
+	invalid := webhook
+	invalid.URL = "ftp://example.org"
+	require.Error(t, invalid.Validate())
+
+	invalid = webhook
+	invalid.URL = "http://"
+	require.Error(t, invalid.Validate())
+
+	invalid = webhook
+	invalid.URL = ":foo"
+	require.Error(t, invalid.Validate())
+
+	invalid = webhook
+	invalid.Level = EvError + 1
+	require.Error(t, invalid.Validate())
+
+	invalid = webhook
+	invalid.MachineID = -1
+	require.Error(t, invalid.Validate())
+}
+
+// Test adding, updating, getting and deleting the webhooks.
+func TestWebhooks(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	webhook := &Webhook{
+		URL:     "http://example.org/first",
+		Secret:  "secret",
+		Enabled: true,
+		Level:   EvWarning,
+	}
+	err := AddWebhook(db, webhook)
+	require.NoError(t, err)
+	require.NotZero(t, webhook.ID)
+
+	err = AddWebhook(db, &Webhook{
+		URL:       "http://example.org/second",
+		MachineID: 2,
+	})
+	require.NoError(t, err)
+
+	returned, err := GetWebhook(db, webhook.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, "http://example.org/first", returned.URL)
+	require.Equal(t, "secret", returned.Secret)
+	require.True(t, returned.Enabled)
+	require.EqualValues(t, EvWarning, returned.Level)
+	require.NotZero(t, returned.CreatedAt)
+
+	webhooks, err := GetAllWebhooks(db)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	require.EqualValues(t, 2, webhooks[1].MachineID)
+	require.False(t, webhooks[1].Enabled)
+
+	webhooks, err = GetEnabledWebhooks(db)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+	require.Equal(t, webhook.ID, webhooks[0].ID)
+
+	// Disable the webhook and clear its secret.
+	returned.Enabled = false
+	returned.Secret = ""
+	returned.Level = EvInfo
+	err = UpdateWebhook(db, returned)
+	require.NoError(t, err)
+
+	returned, err = GetWebhook(db, webhook.ID)
+	require.NoError(t, err)
+	require.False(t, returned.Enabled)
+	require.Empty(t, returned.Secret)
+	require.Zero(t, returned.Level)
+
+	webhooks, err = GetEnabledWebhooks(db)
+	require.NoError(t, err)
+	require.Empty(t, webhooks)
+
+	// Non-existing webhook.
+	returned, err = GetWebhook(db, webhook.ID+100)
+	require.NoError(t, err)
+	require.Nil(t, returned)
+
+	err = UpdateWebhook(db, &Webhook{ID: webhook.ID + 100, URL: "http://example.org"})
+	require.ErrorIs(t, err, ErrNotExists)
+
+	err = DeleteWebhook(db, webhook.ID)
+	require.NoError(t, err)
+	err = DeleteWebhook(db, webhook.ID)
+	require.ErrorIs(t, err, ErrNotExists)
+
+	webhooks, err = GetAllWebhooks(db)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+}
@@ -0,0 +1,132 @@
+package eventcenter
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	storkutil "isc.org/stork/util"
+)
+
+// Describes how to find the failure event resolved by a recovery event.
+// The pattern matches the template of the recovery event. The failure
+// templates are the prefixes of the templates of the failure events. They
+// may refer to the submatches of the pattern.
+type eventCorrelationRule struct {
+	pattern          *regexp.Regexp
+	failureTemplates []string
+}
+
+// Rules correlating the recovery events with the failure events. The first
+// matching rule is used.
+var eventCorrelationRules = []eventCorrelationRule{
+	{
+		pattern: regexp.MustCompile(`^Communication with stork agent on \{machine\} resumed$`),
+		failureTemplates: []string{
+			"Cannot connect to agent on {machine}",
+			"cannot connect to agent on {machine}",
+		},
+	},
+	{
+		pattern:          regexp.MustCompile(`^Communication with (.+) resumed$`),
+		failureTemplates: []string{"Communication with $1 failed"},
+	},
+	{
+		pattern:          regexp.MustCompile(`^\{daemon\} is reachable now$`),
+		failureTemplates: []string{"{daemon} is unreachable"},
+	},
+	{
+		pattern:          regexp.MustCompile(`^alert (.+) resolved: (.+) is \S+ \(threshold .+\)$`),
+		failureTemplates: []string{"alert $1 is firing: $2 is "},
+	},
+}
+
+// Returns the prefixes of the templates of the failure events resolved by
+// the event with the specified template. It returns nil if the event is
+// not a recovery event.
+func getResolvedEventTemplates(template string) []string {
+	for _, rule := range eventCorrelationRules {
+		match := rule.pattern.FindStringSubmatchIndex(template)
+		if match == nil {
+			continue
+		}
+		templates := []string{}
+		for _, failureTemplate := range rule.failureTemplates {
+			templates = append(templates, string(rule.pattern.ExpandString(nil, failureTemplate, template, match)))
+		}
+		return templates
+	}
+	return nil
+}
+
+// Returns the time window within which the repeated events are merged.
+func getEventDeduplicationWindow(db *dbops.PgDB) (time.Duration, error) {
+	window, err := dbmodel.GetSettingInt(db, "event_deduplication_window")
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(window) * time.Second, nil
+}
+
+// Stores the event in the database. If it is a recovery event, it is
+// linked to the failure event it resolves. Otherwise, the event is merged
+// into the unresolved event having the same template, level and relations
+// and seen within the deduplication window. In that case, the event gets
+// the ID, the creation time and the count of the merged event and the
+// function returns true. The events are not merged when the deduplication
+// window is zero.
+func storeEvent(db *dbops.PgDB, event *dbmodel.Event) (merged bool, err error) {
+	if len(event.Template) == 0 {
+		event.Template = event.Text
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = storkutil.UTCNow()
+	}
+	// The event must not be lost when the setting is unavailable. It is
+	// stored without merging instead.
+	window, err := getEventDeduplicationWindow(db)
+	if err != nil {
+		log.Errorf("Problem getting event deduplication window: %s", err)
+		window = 0
+	}
+
+	err = db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if templates := getResolvedEventTemplates(event.Template); len(templates) > 0 {
+			failure, err := dbmodel.GetUnresolvedEvent(tx, templates, event.Relations)
+			if err != nil {
+				return err
+			}
+			if failure != nil {
+				// The recovery event resolving a failure is never merged.
+				event.ResolvesID = failure.ID
+				return dbmodel.AddEvent(tx, event)
+			}
+		}
+
+		if window > 0 {
+			duplicate, err := dbmodel.GetDuplicateEvent(tx, event, event.CreatedAt.Add(-window))
+			if err != nil {
+				return err
+			}
+			if duplicate != nil {
+				duplicate.Count++
+				duplicate.LastSeenAt = event.CreatedAt
+				duplicate.Text = event.Text
+				duplicate.Details = event.Details
+				if err = dbmodel.UpdateEventOccurrence(tx, duplicate); err != nil {
+					return err
+				}
+				*event = *duplicate
+				merged = true
+				return nil
+			}
+		}
+		return dbmodel.AddEvent(tx, event)
+	})
+	return merged, errors.WithMessage(err, "problem storing event")
+}
@@ -0,0 +1,137 @@
+package eventcenter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test getting the templates of the failure events resolved by the
+// recovery events.
+func TestGetResolvedEventTemplates(t *testing.T) {
+	require.Equal(t, []string{
+		"Cannot connect to agent on {machine}",
+		"cannot connect to agent on {machine}",
+	}, getResolvedEventTemplates("Communication with stork agent on {machine} resumed"))
+
+	require.Equal(t, []string{"Communication with {daemon} of {app} failed"},
+		getResolvedEventTemplates("Communication with {daemon} of {app} resumed"))
+
+	require.Equal(t, []string{"Communication with CA daemon of {app} failed"},
+		getResolvedEventTemplates("Communication with CA daemon of {app} resumed"))
+
+	require.Equal(t, []string{"{daemon} is unreachable"},
+		getResolvedEventTemplates("{daemon} is reachable now"))
+
+	require.Equal(t, []string{"alert high utilization is firing: subnet-address-utilization of 192.0.2.0/24 is "},
+		getResolvedEventTemplates("alert high utilization resolved: subnet-address-utilization of 192.0.2.0/24 is 50 (threshold > 90)"))
+
+	require.Nil(t, getResolvedEventTemplates("Communication with {daemon} of {app} failed"))
+	require.Nil(t, getResolvedEventTemplates("added {machine}"))
+}
+
+// Test that the repeated events are merged within the deduplication
+// window.
+func TestStoreEventDeduplication(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	machine := &dbmodel.Machine{ID: 1, Address: "192.0.2.1"}
+	now := time.Now().UTC()
+
+	event := CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", "first", machine)
+	event.CreatedAt = now
+	merged, err := storeEvent(db, event)
+	require.NoError(t, err)
+	require.False(t, merged)
+	require.NotZero(t, event.ID)
+	require.EqualValues(t, 1, event.Count)
+	firstID := event.ID
+
+	// The same event is merged.
+	event = CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", "second", machine)
+	event.CreatedAt = now.Add(time.Minute)
+	merged, err = storeEvent(db, event)
+	require.NoError(t, err)
+	require.True(t, merged)
+	require.Equal(t, firstID, event.ID)
+	require.EqualValues(t, 2, event.Count)
+
+	// The event related to another machine is not merged.
+	event = CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", &dbmodel.Machine{ID: 2})
+	event.CreatedAt = now.Add(time.Minute)
+	merged, err = storeEvent(db, event)
+	require.NoError(t, err)
+	require.False(t, merged)
+
+	// The event seen after the window elapsed is not merged.
+	event = CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", machine)
+	event.CreatedAt = now.Add(time.Hour)
+	merged, err = storeEvent(db, event)
+	require.NoError(t, err)
+	require.False(t, merged)
+
+	events, total, err := dbmodel.GetEventsByPage(db, 0, 10, dbmodel.EvInfo, nil, nil, nil, nil, "id", dbmodel.SortDirAsc)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Equal(t, firstID, events[0].ID)
+	require.EqualValues(t, 2, events[0].Count)
+	require.Equal(t, "second", events[0].Details)
+	require.WithinDuration(t, now, events[0].CreatedAt, time.Millisecond)
+	require.WithinDuration(t, now.Add(time.Minute), events[0].LastSeenAt, time.Millisecond)
+
+	// Disable the deduplication.
+	err = dbmodel.SetSettingInt(db, "event_deduplication_window", 0)
+	require.NoError(t, err)
+	event = CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", machine)
+	event.CreatedAt = now.Add(time.Hour)
+	merged, err = storeEvent(db, event)
+	require.NoError(t, err)
+	require.False(t, merged)
+}
+
+// Test that the recovery events are linked to the failure events they
+// resolve.
+func TestStoreEventCorrelation(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	machine := &dbmodel.Machine{ID: 1, Address: "192.0.2.1"}
+
+	failure := CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", machine)
+	_, err = storeEvent(db, failure)
+	require.NoError(t, err)
+
+	// The recovery related to another machine doesn't resolve the failure.
+	recovery := CreateEvent(dbmodel.EvWarning, "Communication with stork agent on {machine} resumed", &dbmodel.Machine{ID: 2})
+	_, err = storeEvent(db, recovery)
+	require.NoError(t, err)
+	require.Zero(t, recovery.ResolvesID)
+
+	recovery = CreateEvent(dbmodel.EvWarning, "Communication with stork agent on {machine} resumed", machine)
+	_, err = storeEvent(db, recovery)
+	require.NoError(t, err)
+	require.Equal(t, failure.ID, recovery.ResolvesID)
+
+	// The failure is resolved, so the next failure is not merged into it
+	// and the next recovery doesn't resolve it.
+	nextFailure := CreateEvent(dbmodel.EvError, "Cannot connect to agent on {machine}", machine)
+	merged, err := storeEvent(db, nextFailure)
+	require.NoError(t, err)
+	require.False(t, merged)
+	require.NotEqual(t, failure.ID, nextFailure.ID)
+
+	recovery = CreateEvent(dbmodel.EvWarning, "Communication with stork agent on {machine} resumed", machine)
+	_, err = storeEvent(db, recovery)
+	require.NoError(t, err)
+	require.Equal(t, nextFailure.ID, recovery.ResolvesID)
+}
@@ -0,0 +1,444 @@
+package eventcenter
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	storkutil "isc.org/stork/util"
+)
+
+const (
+	// Maximum number of the events waiting for the email notifier. The
+	// events are dropped when the queue is full.
+	emailQueueSize = 256
+	// Interval of checking if the digests should be sent.
+	emailDigestCheckInterval = time.Minute
+	// Maximum number of the events held in a single digest. The excess
+	// events are only counted.
+	emailDigestMaxEvents = 1000
+	// Timeout of connecting to the SMTP server.
+	emailDialTimeout = 10 * time.Second
+	// Timeout of the whole SMTP session, including connecting to the
+	// server.
+	emailSessionTimeout = time.Minute
+)
+
+var (
+	// Matches the tags describing the objects in the event text, e.g.
+	// <machine id="1" address="192.0.2.1" hostname="foo">.
+	eventTagRegexp = regexp.MustCompile(`<(daemon|app|machine|subnet|user)((?:\s+\w+="[^"]*")*)>`)
+	// Matches the attributes of the tag.
+	eventTagAttrRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+// SMTP server settings stored in the database.
+type smtpSettings struct {
+	host     string
+	port     int64
+	tls      bool
+	username string
+	password string
+	sender   string
+}
+
+// Events waiting to be sent to a user in a digest.
+type emailDigest struct {
+	address string
+	events  []*dbmodel.Event
+	dropped int
+}
+
+// Sends the events by email to the users who subscribed to them. The
+// subscriptions and the SMTP server settings are stored in the database.
+// The events are sent immediately or collected and sent periodically in
+// a single digest email, depending on the user preference. The emails are
+// not sent when the SMTP server host is not configured.
+type emailNotifier struct {
+	db            *dbops.PgDB
+	events        chan *dbmodel.Event
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            *sync.WaitGroup
+	digests       map[int]*emailDigest
+	lastDigest    time.Time
+	checkInterval time.Duration
+}
+
+// Creates a new email notifier. The notifier must be started with the
+// start function.
+func newEmailNotifier(db *dbops.PgDB) *emailNotifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &emailNotifier{
+		db:            db,
+		events:        make(chan *dbmodel.Event, emailQueueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+		wg:            &sync.WaitGroup{},
+		digests:       make(map[int]*emailDigest),
+		lastDigest:    storkutil.UTCNow(),
+		checkInterval: emailDigestCheckInterval,
+	}
+}
+
+// Starts the goroutine sending the emails.
+func (n *emailNotifier) start() {
+	n.wg.Add(1)
+	go n.mainLoop()
+}
+
+// Stops sending the emails. The events waiting for the digest are
+// discarded.
+func (n *emailNotifier) shutdown() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+// Queues the event for the notification. It doesn't block when the queue
+// is full. The event is dropped instead.
+func (n *emailNotifier) dispatchEvent(event *dbmodel.Event) {
+	select {
+	case n.events <- event:
+	default:
+		log.Warnf("Email notification queue is full; dropping event %d", event.ID)
+	}
+}
+
+// Sends the notifications about the queued events and periodically sends
+// the digests until the notifier is stopped.
+func (n *emailNotifier) mainLoop() {
+	defer n.wg.Done()
+	ticker := time.NewTicker(n.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case event := <-n.events:
+			n.notify(event)
+		case <-ticker.C:
+			n.sendDigests(storkutil.UTCNow())
+		}
+	}
+}
+
+// Returns the SMTP server settings from the database.
+func getSMTPSettings(db *dbops.PgDB) (*smtpSettings, error) {
+	var (
+		settings smtpSettings
+		err      error
+	)
+	if settings.host, err = dbmodel.GetSettingStr(db, "smtp_host"); err != nil {
+		return nil, err
+	}
+	if settings.port, err = dbmodel.GetSettingInt(db, "smtp_port"); err != nil {
+		return nil, err
+	}
+	if settings.tls, err = dbmodel.GetSettingBool(db, "smtp_tls"); err != nil {
+		return nil, err
+	}
+	if settings.username, err = dbmodel.GetSettingStr(db, "smtp_username"); err != nil {
+		return nil, err
+	}
+	if settings.password, err = dbmodel.GetSettingPasswd(db, "smtp_password"); err != nil {
+		return nil, err
+	}
+	if settings.sender, err = dbmodel.GetSettingStr(db, "smtp_sender"); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Checks if the subscription filters accept the event.
+func emailSubscriptionAcceptsEvent(subscription *dbmodel.EmailSubscription, event *dbmodel.Event) bool {
+	filters := &subscriberFilters{
+		MachineID: subscription.MachineID,
+		AppID:     subscription.AppID,
+		DaemonID:  subscription.DaemonID,
+		SubnetID:  subscription.SubnetID,
+	}
+	return filters.matches(subscription.Level, event)
+}
+
+// Sends the event to the users who subscribed to it or adds it to their
+// digests.
+func (n *emailNotifier) notify(event *dbmodel.Event) {
+	settings, err := getSMTPSettings(n.db)
+	if err != nil {
+		log.Errorf("Problem getting SMTP settings: %+v", err)
+		return
+	}
+	if len(settings.host) == 0 {
+		return
+	}
+	subscriptions, err := dbmodel.GetEnabledEmailSubscriptions(n.db)
+	if err != nil {
+		log.Errorf("Problem getting email subscriptions: %+v", err)
+		return
+	}
+	for i := range subscriptions {
+		subscription := subscriptions[i]
+		if subscription.User == nil || len(subscription.User.Email) == 0 {
+			continue
+		}
+		if !emailSubscriptionAcceptsEvent(&subscription, event) {
+			continue
+		}
+		if subscription.Digest {
+			n.addToDigest(subscription.UserID, subscription.User.Email, event)
+			continue
+		}
+		subject := fmt.Sprintf("[Stork] %s: %s", eventLevelName(event.Level), formatEventText(event.Text))
+		message := composeEmail(settings.sender, subscription.User.Email, subject, formatEvent(event), storkutil.UTCNow())
+		if err := sendEmail(n.ctx, settings, subscription.User.Email, message); err != nil {
+			log.WithField("user", subscription.User.Identity()).Errorf("Problem sending event %d by email: %s", event.ID, err)
+		}
+	}
+}
+
+// Adds the event to the digest of the user.
+func (n *emailNotifier) addToDigest(userID int, address string, event *dbmodel.Event) {
+	digest, ok := n.digests[userID]
+	if !ok {
+		digest = &emailDigest{}
+		n.digests[userID] = digest
+	}
+	// The user could have changed the address in the meantime.
+	digest.address = address
+	if len(digest.events) >= emailDigestMaxEvents {
+		digest.dropped++
+		return
+	}
+	digest.events = append(digest.events, event)
+}
+
+// Sends the digests if the digest interval has elapsed since the last
+// digests were sent.
+func (n *emailNotifier) sendDigests(now time.Time) {
+	interval, err := dbmodel.GetSettingInt(n.db, "email_digest_interval")
+	if err != nil {
+		log.Errorf("Problem getting email digest interval: %+v", err)
+		return
+	}
+	if now.Sub(n.lastDigest) < time.Duration(interval)*time.Second {
+		return
+	}
+	n.lastDigest = now
+	if len(n.digests) == 0 {
+		return
+	}
+	digests := n.digests
+	n.digests = make(map[int]*emailDigest)
+
+	settings, err := getSMTPSettings(n.db)
+	if err != nil {
+		log.Errorf("Problem getting SMTP settings: %+v", err)
+		return
+	}
+	if len(settings.host) == 0 {
+		return
+	}
+	for _, digest := range digests {
+		count := len(digest.events) + digest.dropped
+		subject := fmt.Sprintf("[Stork] Digest of %d events", count)
+		if count == 1 {
+			subject = "[Stork] Digest of 1 event"
+		}
+		message := composeEmail(settings.sender, digest.address, subject, formatDigest(digest), now)
+		if err := sendEmail(n.ctx, settings, digest.address, message); err != nil {
+			log.WithField("address", digest.address).Errorf("Problem sending email digest: %s", err)
+		}
+	}
+}
+
+// Returns the name of the event level.
+func eventLevelName(level int) string {
+	switch level {
+	case dbmodel.EvWarning:
+		return "warning"
+	case dbmodel.EvError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// Replaces the tags describing the objects in the event text with the
+// names of these objects, e.g. the machine tag is replaced with "machine"
+// followed by the machine hostname or address.
+func formatEventText(text string) string {
+	return eventTagRegexp.ReplaceAllStringFunc(text, func(tag string) string {
+		match := eventTagRegexp.FindStringSubmatch(tag)
+		kind := match[1]
+		attrs := make(map[string]string)
+		for _, attr := range eventTagAttrRegexp.FindAllStringSubmatch(match[2], -1) {
+			attrs[attr[1]] = attr[2]
+		}
+		var name string
+		switch kind {
+		case "daemon", "app":
+			name = attrs["name"]
+		case "machine":
+			name = attrs["hostname"]
+			if len(name) == 0 {
+				name = attrs["address"]
+			}
+		case "subnet":
+			name = attrs["prefix"]
+		case "user":
+			name = attrs["login"]
+			if len(name) == 0 {
+				name = attrs["email"]
+			}
+		}
+		if len(name) == 0 {
+			name = attrs["id"]
+		}
+		return fmt.Sprintf("%s %s", kind, name)
+	})
+}
+
+// Returns the body of the email notifying about a single event.
+func formatEvent(event *dbmodel.Event) string {
+	lines := []string{
+		fmt.Sprintf("Level: %s", eventLevelName(event.Level)),
+		fmt.Sprintf("Time: %s", event.CreatedAt.UTC().Format("2006-01-02 15:04:05 MST")),
+		fmt.Sprintf("Event: %s", formatEventText(event.Text)),
+	}
+	if len(event.Details) > 0 {
+		lines = append(lines, fmt.Sprintf("Details: %s", event.Details))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// Returns the body of the digest email.
+func formatDigest(digest *emailDigest) string {
+	lines := []string{}
+	for _, event := range digest.events {
+		lines = append(lines, fmt.Sprintf("%s [%s] %s",
+			event.CreatedAt.UTC().Format("2006-01-02 15:04:05 MST"),
+			eventLevelName(event.Level),
+			formatEventText(event.Text)))
+		if len(event.Details) > 0 {
+			lines = append(lines, fmt.Sprintf("    %s", event.Details))
+		}
+	}
+	if digest.dropped > 0 {
+		lines = append(lines, fmt.Sprintf("... and %d more events", digest.dropped))
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+// Returns the email message with the headers and the body.
+func composeEmail(sender, recipient, subject, body string, date time.Time) []byte {
+	headers := []string{
+		fmt.Sprintf("From: %s", sender),
+		fmt.Sprintf("To: %s", recipient),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", subject)),
+		fmt.Sprintf("Date: %s", date.Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
+
+// Sends the email message to the recipient using the SMTP server. The
+// connection uses implicit TLS when it is enabled in the settings.
+// Otherwise, STARTTLS is used when the server supports it. The client
+// authenticates when the user name is specified. The session is
+// interrupted when it exceeds the session timeout or the context is
+// canceled.
+func sendEmail(ctx context.Context, settings *smtpSettings, recipient string, message []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, emailSessionTimeout)
+	defer cancel()
+
+	address := net.JoinHostPort(settings.host, strconv.FormatInt(settings.port, 10))
+	tlsConfig := &tls.Config{
+		ServerName: settings.host,
+		MinVersion: tls.VersionTLS12,
+	}
+	dialer := &net.Dialer{Timeout: emailDialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if settings.tls {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "problem connecting to SMTP server %s", address)
+	}
+
+	// Limit the duration of the SMTP commands. The connection is also
+	// closed when the context is canceled, e.g., on the server shutdown.
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return errors.Wrapf(err, "problem setting deadline for SMTP server %s", address)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, settings.host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrapf(err, "problem starting session with SMTP server %s", address)
+	}
+	defer client.Close()
+
+	if !settings.tls {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err = client.StartTLS(tlsConfig); err != nil {
+				return errors.Wrapf(err, "problem starting TLS with SMTP server %s", address)
+			}
+		}
+	}
+	if len(settings.username) > 0 {
+		auth := smtp.PlainAuth("", settings.username, settings.password, settings.host)
+		if err = client.Auth(auth); err != nil {
+			return errors.Wrapf(err, "problem authenticating to SMTP server %s", address)
+		}
+	}
+	if err = client.Mail(settings.sender); err != nil {
+		return errors.Wrapf(err, "SMTP server %s rejected sender %s", address, settings.sender)
+	}
+	if err = client.Rcpt(recipient); err != nil {
+		return errors.Wrapf(err, "SMTP server %s rejected recipient %s", address, recipient)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return errors.Wrapf(err, "problem sending email to SMTP server %s", address)
+	}
+	if _, err = writer.Write(message); err != nil {
+		writer.Close()
+		return errors.Wrapf(err, "problem sending email to SMTP server %s", address)
+	}
+	if err = writer.Close(); err != nil {
+		return errors.Wrapf(err, "problem sending email to SMTP server %s", address)
+	}
+	return client.Quit()
+}
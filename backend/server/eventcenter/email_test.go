@@ -0,0 +1,346 @@
+package eventcenter
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Email received by the fake SMTP server.
+type fakeEmail struct {
+	auth string
+	from string
+	to   string
+	data string
+}
+
+// Minimal SMTP server accepting all emails. It advertises the PLAIN
+// authentication and accepts any credentials.
+type fakeSMTPServer struct {
+	listener net.Listener
+	emails   chan fakeEmail
+}
+
+// Starts the fake SMTP server listening on a random local port.
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeSMTPServer{
+		listener: listener,
+		emails:   make(chan fakeEmail, 10),
+	}
+	go server.serve()
+	return server
+}
+
+// Returns the port the server listens on.
+func (server *fakeSMTPServer) port() int64 {
+	return int64(server.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// Stops the server.
+func (server *fakeSMTPServer) close() {
+	server.listener.Close()
+}
+
+// Accepts the connections until the server is stopped.
+func (server *fakeSMTPServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handle(conn)
+	}
+}
+
+// Handles the SMTP session. The received email is sent over the channel
+// before the server confirms it.
+func (server *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+	email := fakeEmail{}
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(strings.Fields(line)[0]) {
+		case "EHLO", "HELO":
+			_ = text.PrintfLine("250-localhost")
+			_ = text.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			email.auth = line
+			_ = text.PrintfLine("235 Authentication successful")
+		case "MAIL":
+			email.from = line
+			_ = text.PrintfLine("250 OK")
+		case "RCPT":
+			email.to = line
+			_ = text.PrintfLine("250 OK")
+		case "DATA":
+			_ = text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			email.data = string(data)
+			server.emails <- email
+			email = fakeEmail{}
+			_ = text.PrintfLine("250 OK")
+		case "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			return
+		default:
+			_ = text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+// Test replacing the object tags in the event text.
+func TestFormatEventText(t *testing.T) {
+	require.Equal(t, "Cannot connect to agent on machine foo",
+		formatEventText(`Cannot connect to agent on <machine id="1" address="192.0.2.1" hostname="foo">`))
+	require.Equal(t, "machine 192.0.2.1 added",
+		formatEventText(`<machine id="1" address="192.0.2.1" hostname="">`+" added"))
+	require.Equal(t, "daemon dhcp4 is unreachable",
+		formatEventText(`<daemon id="1" name="dhcp4" appId="2" appType="kea"> is unreachable`))
+	require.Equal(t, "app kea@foo is unreachable",
+		formatEventText(`<app id="2" name="kea@foo" type="kea" version="2.2.0"> is unreachable`))
+	require.Equal(t, "subnet 192.0.2.0/24 is running out of addresses",
+		formatEventText(`<subnet id="3" prefix="192.0.2.0/24"> is running out of addresses`))
+	require.Equal(t, "user admin deleted lease",
+		formatEventText(`<user id="1" login="admin" email="admin@example.org"> deleted lease`))
+	require.Equal(t, "plain text", formatEventText("plain text"))
+}
+
+// Test getting the names of the event levels.
+func TestEventLevelName(t *testing.T) {
+	require.Equal(t, "info", eventLevelName(dbmodel.EvInfo))
+	require.Equal(t, "warning", eventLevelName(dbmodel.EvWarning))
+	require.Equal(t, "error", eventLevelName(dbmodel.EvError))
+}
+
+// Test composing the email message.
+func TestComposeEmail(t *testing.T) {
+	date := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	message := string(composeEmail("stork@example.org", "admin@example.org", "[Stork] error: failed", "body", date))
+	require.Contains(t, message, "From: stork@example.org\r\n")
+	require.Contains(t, message, "To: admin@example.org\r\n")
+	require.Contains(t, message, "Subject: [Stork] error: failed\r\n")
+	require.Contains(t, message, "Date: Wed, 10 May 2023 12:00:00 +0000\r\n")
+	require.Contains(t, message, "Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	require.True(t, strings.HasSuffix(message, "\r\n\r\nbody\r\n"))
+
+	// The non-ASCII subject is encoded.
+	message = string(composeEmail("stork@example.org", "admin@example.org", "zażółć", "body", date))
+	require.Contains(t, message, "Subject: =?utf-8?q?")
+}
+
+// Test formatting the body of the emails.
+func TestFormatEventAndDigest(t *testing.T) {
+	createdAt := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	event := &dbmodel.Event{
+		CreatedAt: createdAt,
+		Level:     dbmodel.EvError,
+		Text:      `Cannot connect to agent on <machine id="1" address="192.0.2.1" hostname="foo">`,
+		Details:   "connection refused",
+	}
+	body := formatEvent(event)
+	require.Contains(t, body, "Level: error\r\n")
+	require.Contains(t, body, "Time: 2023-05-10 12:00:00 UTC\r\n")
+	require.Contains(t, body, "Event: Cannot connect to agent on machine foo\r\n")
+	require.Contains(t, body, "Details: connection refused")
+
+	digest := &emailDigest{
+		events: []*dbmodel.Event{
+			event,
+			{CreatedAt: createdAt, Level: dbmodel.EvInfo, Text: "foo"},
+		},
+		dropped: 3,
+	}
+	body = formatDigest(digest)
+	require.Equal(t, "2023-05-10 12:00:00 UTC [error] Cannot connect to agent on machine foo\r\n"+
+		"    connection refused\r\n"+
+		"2023-05-10 12:00:00 UTC [info] foo\r\n"+
+		"... and 3 more events", body)
+}
+
+// Test that the number of events in a digest is limited.
+func TestAddToDigest(t *testing.T) {
+	notifier := newEmailNotifier(nil)
+	for i := 0; i < emailDigestMaxEvents+2; i++ {
+		notifier.addToDigest(1, "old@example.org", &dbmodel.Event{ID: int64(i)})
+	}
+	notifier.addToDigest(1, "new@example.org", &dbmodel.Event{})
+	require.Len(t, notifier.digests, 1)
+	require.Equal(t, "new@example.org", notifier.digests[1].address)
+	require.Len(t, notifier.digests[1].events, emailDigestMaxEvents)
+	require.Equal(t, 3, notifier.digests[1].dropped)
+}
+
+// Test sending the email to the SMTP server.
+func TestSendEmail(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	defer server.close()
+
+	settings := &smtpSettings{
+		host:     "127.0.0.1",
+		port:     server.port(),
+		username: "stork",
+		password: "secret",
+		sender:   "stork@example.org",
+	}
+	message := composeEmail(settings.sender, "admin@example.org", "subject", "body", time.Now())
+	err := sendEmail(context.Background(), settings, "admin@example.org", message)
+	require.NoError(t, err)
+
+	email := <-server.emails
+	require.Contains(t, email.auth, "AUTH PLAIN")
+	require.Contains(t, email.from, "<stork@example.org>")
+	require.Contains(t, email.to, "<admin@example.org>")
+	require.Contains(t, email.data, "Subject: subject")
+	require.Contains(t, email.data, "body")
+
+	// No authentication without the user name.
+	settings.username = ""
+	err = sendEmail(context.Background(), settings, "admin@example.org", message)
+	require.NoError(t, err)
+	email = <-server.emails
+	require.Empty(t, email.auth)
+}
+
+// Test that an error is returned when the SMTP server is unreachable.
+func TestSendEmailConnectionError(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	port := server.port()
+	server.close()
+
+	settings := &smtpSettings{
+		host:   "127.0.0.1",
+		port:   port,
+		sender: "stork@example.org",
+	}
+	err := sendEmail(context.Background(), settings, "admin@example.org", []byte("foo"))
+	require.ErrorContains(t, err, "problem connecting to SMTP server")
+}
+
+// Test that the SMTP session is interrupted when the server doesn't respond
+// and the context is canceled.
+func TestSendEmailCanceled(t *testing.T) {
+	// The server accepts the connections but never responds.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				_, _ = io.Copy(io.Discard, conn)
+			}(conn)
+		}
+	}()
+
+	settings := &smtpSettings{
+		host:   "127.0.0.1",
+		port:   int64(listener.Addr().(*net.TCPAddr).Port),
+		sender: "stork@example.org",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	started := time.Now()
+	err = sendEmail(ctx, settings, "admin@example.org", []byte("foo"))
+	require.ErrorContains(t, err, "problem starting session with SMTP server")
+	require.Less(t, time.Since(started), emailDialTimeout)
+}
+
+// Test that the events are sent immediately or in a digest to the users
+// who subscribed to them.
+func TestEmailNotifierNotify(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	server := newFakeSMTPServer(t)
+	defer server.close()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+	require.NoError(t, dbmodel.SetSettingStr(db, "smtp_host", "127.0.0.1"))
+	require.NoError(t, dbmodel.SetSettingInt(db, "smtp_port", server.port()))
+	require.NoError(t, dbmodel.SetSettingStr(db, "smtp_sender", "stork@example.org"))
+
+	users := []*dbmodel.SystemUser{
+		{Login: "immediate", Email: "immediate@example.org", Lastname: "Doe", Name: "John"},
+		{Login: "digest", Email: "digest@example.org", Lastname: "Doe", Name: "Jane"},
+		{Login: "disabled", Email: "disabled@example.org", Lastname: "Doe", Name: "Jim"},
+	}
+	for _, user := range users {
+		_, err = dbmodel.CreateUser(db, user)
+		require.NoError(t, err)
+	}
+	subscriptions := []dbmodel.EmailSubscription{
+		{UserID: users[0].ID, Enabled: true, Level: dbmodel.EvWarning},
+		{UserID: users[1].ID, Enabled: true, Digest: true},
+		{UserID: users[2].ID, Enabled: false},
+	}
+	for i := range subscriptions {
+		err = dbmodel.UpsertEmailSubscription(db, &subscriptions[i])
+		require.NoError(t, err)
+	}
+
+	notifier := newEmailNotifier(db)
+
+	// The info event is only added to the digest.
+	notifier.notify(&dbmodel.Event{ID: 1, Level: dbmodel.EvInfo, Text: "info", Relations: &dbmodel.Relations{}})
+	require.Empty(t, server.emails)
+	require.Len(t, notifier.digests, 1)
+	require.Len(t, notifier.digests[users[1].ID].events, 1)
+
+	// The error event is sent immediately to the first user.
+	notifier.notify(&dbmodel.Event{ID: 2, Level: dbmodel.EvError, Text: "failure", Relations: &dbmodel.Relations{}})
+	require.Len(t, server.emails, 1)
+	email := <-server.emails
+	require.Contains(t, email.to, "<immediate@example.org>")
+	require.Contains(t, email.data, "Subject: [Stork] error: failure")
+	require.Len(t, notifier.digests[users[1].ID].events, 2)
+
+	// The digest interval has not elapsed.
+	now := notifier.lastDigest.Add(time.Minute)
+	notifier.sendDigests(now)
+	require.Empty(t, server.emails)
+	require.Len(t, notifier.digests, 1)
+
+	// Send the digest.
+	now = notifier.lastDigest.Add(2 * time.Hour)
+	notifier.sendDigests(now)
+	require.Len(t, server.emails, 1)
+	email = <-server.emails
+	require.Contains(t, email.to, "<digest@example.org>")
+	require.Contains(t, email.data, "Subject: [Stork] Digest of 2 events")
+	require.Contains(t, email.data, "[info] info")
+	require.Contains(t, email.data, "[error] failure")
+	require.Empty(t, notifier.digests)
+	require.Equal(t, now, notifier.lastDigest)
+
+	// The notifications are disabled when the SMTP server is not set.
+	require.NoError(t, dbmodel.SetSettingStr(db, "smtp_host", ""))
+	notifier.notify(&dbmodel.Event{ID: 3, Level: dbmodel.EvError, Text: "failure", Relations: &dbmodel.Relations{}})
+	require.Empty(t, server.emails)
+	require.Empty(t, notifier.digests)
+}
@@ -22,8 +22,10 @@ type EventCenter interface {
 	ServeHTTP(w http.ResponseWriter, req *http.Request)
 }
 
-// EventCenter. It has channel for receiving events
-// and a SSE broker for dispatching events to subscribers.
+// EventCenter. It has channel for receiving events, a SSE broker
+// for dispatching events to subscribers, a dispatcher posting
+// the events to the webhooks, a notifier sending them by email
+// and a sink forwarding them to syslog.
 type eventCenter struct {
 	db     *dbops.PgDB
 	done   chan bool
@@ -31,6 +33,9 @@ type eventCenter struct {
 	events chan *dbmodel.Event
 
 	sseBroker *SSEBroker
+	webhooks  *webhookDispatcher
+	emails    *emailNotifier
+	syslog    *syslogSink
 }
 
 // Create new EventCenter object.
@@ -41,7 +46,13 @@ func NewEventCenter(db *pg.DB) EventCenter {
 		wg:        &sync.WaitGroup{},
 		events:    make(chan *dbmodel.Event),
 		sseBroker: NewSSEBroker(db),
+		webhooks:  newWebhookDispatcher(db),
+		emails:    newEmailNotifier(db),
+		syslog:    newSyslogSink(db),
 	}
+	ec.webhooks.start()
+	ec.emails.start()
+	ec.syslog.start()
 	ec.wg.Add(1)
 	go ec.mainLoop()
 
@@ -70,6 +81,7 @@ func (ec *eventCenter) AddErrorEvent(text string, objects ...interface{}) {
 // Create an event without passing it to EventCenter. It can be added later using
 // AddEvent method of EventCenter. It takes event level, text and relating objects.
 func CreateEvent(level int, text string, objects ...interface{}) *dbmodel.Event {
+	template := text
 	relations := &dbmodel.Relations{}
 	var details string
 	for _, obj := range objects {
@@ -101,6 +113,7 @@ func CreateEvent(level int, text string, objects ...interface{}) *dbmodel.Event
 		Level:     level,
 		Relations: relations,
 		Details:   details,
+		Template:  template,
 	}
 	return e
 }
@@ -123,11 +136,16 @@ func (ec *eventCenter) Shutdown() {
 	log.Printf("Stopping EventCenter")
 	ec.done <- true
 	ec.wg.Wait()
+	ec.webhooks.shutdown()
+	ec.emails.shutdown()
+	ec.syslog.shutdown()
 	log.Printf("Stopped EventCenter")
 }
 
 // A main loop of EventCenter. It receives events via channel, stores
-// them into database and dispatches them to subscribers using SSE broker.
+// them into database and dispatches them to subscribers using SSE broker,
+// to the webhooks, to the email notifier and to the syslog sink. The
+// repeated events merged into the existing events are not dispatched.
 func (ec *eventCenter) mainLoop() {
 	defer ec.wg.Done()
 	for {
@@ -137,12 +155,19 @@ func (ec *eventCenter) mainLoop() {
 			return
 		// get events from channel
 		case event := <-ec.events:
-			err := dbmodel.AddEvent(ec.db, event)
+			merged, err := storeEvent(ec.db, event)
 			if err != nil {
 				log.Errorf("Problem adding event to db: %+v", err)
 				continue
 			}
+			if merged {
+				log.Debugf("Merged event '%s' into event %d seen %d times", event.Text, event.ID, event.Count)
+				continue
+			}
 			ec.sseBroker.dispatchEvent(event)
+			ec.webhooks.dispatchEvent(event)
+			ec.emails.dispatchEvent(event)
+			ec.syslog.dispatchEvent(event)
 		}
 	}
 }
@@ -0,0 +1,195 @@
+package eventcenter
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	storkutil "isc.org/stork/util"
+)
+
+// Maximum number of the events deleted and archived in a single
+// transaction.
+const eventPruneBatchSize = 1000
+
+// Event pruner. It periodically deletes the events exceeding the maximum
+// age or the maximum count specified for their level in the database.
+// The pruned events are optionally archived in a compressed JSON file.
+type EventPruner struct {
+	db       *dbops.PgDB
+	executor *storkutil.PeriodicExecutor
+}
+
+// Maximum age in days and maximum count of the events of a level. The
+// zero values mean no limit.
+type eventRetentionPolicy struct {
+	level    int
+	maxAge   int64
+	maxCount int64
+}
+
+// Creates an instance of the event pruner and starts pruning the events
+// according to the interval specified in the database.
+func NewEventPruner(db *dbops.PgDB) (*EventPruner, error) {
+	pruner := &EventPruner{
+		db: db,
+	}
+	intervalSettingName := "event_pruner_interval"
+
+	executor, err := storkutil.NewPeriodicExecutor("event pruner",
+		pruner.prune,
+		func() (int64, error) {
+			interval, err := dbmodel.GetSettingInt(db, intervalSettingName)
+			return interval, errors.WithMessagef(err, "problem getting interval setting %s from db",
+				intervalSettingName)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	pruner.executor = executor
+	return pruner, nil
+}
+
+// Stops pruning the events.
+func (pruner *EventPruner) Shutdown() {
+	pruner.executor.Shutdown()
+}
+
+// Prunes the events according to the current retention policy.
+func (pruner *EventPruner) prune() error {
+	return pruneEvents(pruner.db, storkutil.UTCNow(), eventPruneBatchSize)
+}
+
+// Returns the event retention policies for all levels.
+func getEventRetentionPolicies(db *dbops.PgDB) ([]eventRetentionPolicy, error) {
+	policies := []eventRetentionPolicy{}
+	for level, name := range []string{"info", "warning", "error"} {
+		maxAge, err := dbmodel.GetSettingInt(db, fmt.Sprintf("event_max_age_%s", name))
+		if err != nil {
+			return nil, err
+		}
+		maxCount, err := dbmodel.GetSettingInt(db, fmt.Sprintf("event_max_count_%s", name))
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, eventRetentionPolicy{
+			level:    level,
+			maxAge:   maxAge,
+			maxCount: maxCount,
+		})
+	}
+	return policies, nil
+}
+
+// Deletes the events exceeding the retention policy. If the archive
+// directory is specified, the deleted events are written to compressed
+// JSON files in this directory. The events are deleted and archived in
+// batches of the specified size, each batch in a separate transaction and
+// a separate file. The events of a batch are not deleted when archiving
+// fails.
+func pruneEvents(db *dbops.PgDB, now time.Time, batchSize int64) error {
+	policies, err := getEventRetentionPolicies(db)
+	if err != nil {
+		return err
+	}
+	archiveDirectory, err := dbmodel.GetSettingStr(db, "event_archive_directory")
+	if err != nil {
+		return err
+	}
+
+	// Functions deleting a batch of the events exceeding the policies.
+	deleteFns := []func(tx *pg.Tx) ([]dbmodel.Event, error){}
+	for i := range policies {
+		policy := policies[i]
+		if policy.maxAge > 0 {
+			before := now.Add(-time.Duration(policy.maxAge) * 24 * time.Hour)
+			deleteFns = append(deleteFns, func(tx *pg.Tx) ([]dbmodel.Event, error) {
+				return dbmodel.DeleteEventsBefore(tx, policy.level, before, batchSize)
+			})
+		}
+		if policy.maxCount > 0 {
+			deleteFns = append(deleteFns, func(tx *pg.Tx) ([]dbmodel.Event, error) {
+				return dbmodel.DeleteEventsExceedingCount(tx, policy.level, policy.maxCount, batchSize)
+			})
+		}
+	}
+
+	pruned := 0
+	batch := 0
+	for _, deleteFn := range deleteFns {
+		for {
+			var count int
+			err = db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+				events, err := deleteFn(tx)
+				if err != nil {
+					return err
+				}
+				count = len(events)
+				if count == 0 || len(archiveDirectory) == 0 {
+					return nil
+				}
+				name, err := archiveEvents(archiveDirectory, events, now, batch)
+				if err != nil {
+					return err
+				}
+				batch++
+				log.Infof("Archived %d pruned events in %s", count, name)
+				return nil
+			})
+			if err != nil {
+				if pruned > 0 {
+					log.Infof("Pruned %d events", pruned)
+				}
+				return err
+			}
+			pruned += count
+			if int64(count) < batchSize {
+				break
+			}
+		}
+	}
+	if pruned > 0 {
+		log.Infof("Pruned %d events", pruned)
+	}
+	return nil
+}
+
+// Writes the events ordered by ID to a new gzip compressed JSON file in
+// the specified directory. The file name contains the specified time and
+// the sequence number of the batch. It returns the file name.
+func archiveEvents(directory string, events []dbmodel.Event, now time.Time, batch int) (string, error) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+
+	name := filepath.Join(directory, fmt.Sprintf("stork-events-%s-%d.json.gz", now.UTC().Format("20060102T150405.000000000Z"), batch))
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem creating event archive %s", name)
+	}
+
+	writer := gzip.NewWriter(file)
+	err = json.NewEncoder(writer).Encode(events)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(name)
+		return "", errors.Wrapf(err, "problem writing event archive %s", name)
+	}
+	return name, nil
+}
@@ -0,0 +1,176 @@
+package eventcenter
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Reads the events from the compressed JSON archive.
+func readEventArchive(t *testing.T, name string) []dbmodel.Event {
+	file, err := os.Open(name)
+	require.NoError(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	events := []dbmodel.Event{}
+	require.NoError(t, json.NewDecoder(reader).Decode(&events))
+	return events
+}
+
+// Test writing the events to the compressed JSON archive.
+func TestArchiveEvents(t *testing.T) {
+	directory := t.TempDir()
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	events := []dbmodel.Event{
+		{ID: 3, Level: dbmodel.EvError, Text: "baz"},
+		{ID: 1, Level: dbmodel.EvInfo, Text: "foo"},
+		{ID: 2, Level: dbmodel.EvWarning, Text: "bar"},
+	}
+
+	name, err := archiveEvents(directory, events, now, 2)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(directory, "stork-events-20230510T120000.000000000Z-2.json.gz"), name)
+
+	// The events are ordered by ID.
+	archived := readEventArchive(t, name)
+	require.Len(t, archived, 3)
+	for i, event := range archived {
+		require.EqualValues(t, i+1, event.ID)
+	}
+	require.Equal(t, "foo", archived[0].Text)
+
+	// The existing archive is not overwritten.
+	_, err = archiveEvents(directory, events, now, 2)
+	require.ErrorContains(t, err, "problem creating event archive")
+}
+
+// Test that an error is returned when the archive directory doesn't exist.
+func TestArchiveEventsMissingDirectory(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "missing")
+	_, err := archiveEvents(directory, []dbmodel.Event{{ID: 1}}, time.Now(), 0)
+	require.ErrorContains(t, err, "problem creating event archive")
+}
+
+// Test pruning the events according to the retention policy.
+func TestPruneEvents(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	events := []*dbmodel.Event{
+		{Text: "old info", Level: dbmodel.EvInfo, CreatedAt: now.Add(-10 * 24 * time.Hour)},
+		{Text: "new info", Level: dbmodel.EvInfo, CreatedAt: now},
+		{Text: "first error", Level: dbmodel.EvError, CreatedAt: now.Add(-10 * 24 * time.Hour)},
+		{Text: "second error", Level: dbmodel.EvError, CreatedAt: now},
+		{Text: "third error", Level: dbmodel.EvError, CreatedAt: now},
+	}
+	for _, event := range events {
+		require.NoError(t, dbmodel.AddEvent(db, event))
+	}
+
+	// Nothing is pruned by default.
+	require.NoError(t, pruneEvents(db, now, eventPruneBatchSize))
+	_, total, err := dbmodel.GetEventsByPage(db, 0, 10, dbmodel.EvInfo, nil, nil, nil, nil, "", dbmodel.SortDirAny)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, total)
+
+	directory := t.TempDir()
+	require.NoError(t, dbmodel.SetSettingInt(db, "event_max_age_info", 7))
+	require.NoError(t, dbmodel.SetSettingInt(db, "event_max_count_error", 2))
+	require.NoError(t, dbmodel.SetSettingStr(db, "event_archive_directory", directory))
+
+	require.NoError(t, pruneEvents(db, now, eventPruneBatchSize))
+	remaining, total, err := dbmodel.GetEventsByPage(db, 0, 10, dbmodel.EvInfo, nil, nil, nil, nil, "", dbmodel.SortDirAny)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	for _, event := range remaining {
+		require.NotEqual(t, "old info", event.Text)
+		require.NotEqual(t, "first error", event.Text)
+	}
+
+	// The pruned events are archived in separate batches.
+	files, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	archived := readEventArchive(t, filepath.Join(directory, files[0].Name()))
+	require.Len(t, archived, 1)
+	require.Equal(t, "old info", archived[0].Text)
+	archived = readEventArchive(t, filepath.Join(directory, files[1].Name()))
+	require.Len(t, archived, 1)
+	require.Equal(t, "first error", archived[0].Text)
+}
+
+// Test that the events are pruned and archived in batches.
+func TestPruneEventsBatches(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, dbmodel.AddEvent(db, &dbmodel.Event{
+			Text:      fmt.Sprintf("old info %d", i),
+			Level:     dbmodel.EvInfo,
+			CreatedAt: now.Add(-10 * 24 * time.Hour),
+		}))
+	}
+	directory := t.TempDir()
+	require.NoError(t, dbmodel.SetSettingInt(db, "event_max_age_info", 7))
+	require.NoError(t, dbmodel.SetSettingStr(db, "event_archive_directory", directory))
+
+	require.NoError(t, pruneEvents(db, now, 2))
+	_, total, err := dbmodel.GetEventsByPage(db, 0, 10, dbmodel.EvInfo, nil, nil, nil, nil, "", dbmodel.SortDirAny)
+	require.NoError(t, err)
+	require.Zero(t, total)
+
+	// Each batch is archived in a separate file.
+	files, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	texts := []string{}
+	for _, file := range files {
+		archived := readEventArchive(t, filepath.Join(directory, file.Name()))
+		require.LessOrEqual(t, len(archived), 2)
+		for _, event := range archived {
+			texts = append(texts, event.Text)
+		}
+	}
+	require.ElementsMatch(t, []string{"old info 0", "old info 1", "old info 2", "old info 3", "old info 4"}, texts)
+}
+
+// Test that the events are not deleted when archiving fails.
+func TestPruneEventsArchiveError(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	require.NoError(t, dbmodel.AddEvent(db, &dbmodel.Event{
+		Text:      "old info",
+		Level:     dbmodel.EvInfo,
+		CreatedAt: now.Add(-10 * 24 * time.Hour),
+	}))
+	require.NoError(t, dbmodel.SetSettingInt(db, "event_max_age_info", 7))
+	require.NoError(t, dbmodel.SetSettingStr(db, "event_archive_directory", filepath.Join(t.TempDir(), "missing")))
+
+	require.Error(t, pruneEvents(db, now, eventPruneBatchSize))
+	_, total, err := dbmodel.GetEventsByPage(db, 0, 10, dbmodel.EvInfo, nil, nil, nil, nil, "", dbmodel.SortDirAny)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+}
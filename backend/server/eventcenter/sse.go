@@ -4,17 +4,37 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	dbops "isc.org/stork/server/database"
 	dbmodel "isc.org/stork/server/database/model"
 )
 
+const (
+	// Maximum number of the missed events sent to the reconnecting
+	// subscriber.
+	sseReplayMaxEvents = 1000
+	// Maximum number of the events waiting to be sent to the subscriber.
+	// The subscriber is disconnected when its queue is full. It can
+	// reconnect and receive the missed events then.
+	sseSubscriberQueueSize = 256
+)
+
+// Message sent to the SSE subscriber. It holds the ID of the event and
+// the message formatted according to the SSE specification.
+type sseMessage struct {
+	id   int64
+	data []byte
+}
+
 // SSE Broker. It stores subscribers in a map which is protected by mutex.
 type SSEBroker struct {
 	db               *dbops.PgDB
-	subscribers      map[chan []byte]*Subscriber
+	subscribers      map[chan *sseMessage]*Subscriber
 	subscribersMutex *sync.Mutex
 }
 
@@ -22,13 +42,92 @@ type SSEBroker struct {
 func NewSSEBroker(db *dbops.PgDB) *SSEBroker {
 	sb := &SSEBroker{
 		db:               db,
-		subscribers:      map[chan []byte]*Subscriber{},
+		subscribers:      map[chan *sseMessage]*Subscriber{},
 		subscribersMutex: &sync.Mutex{},
 	}
 	return sb
 }
 
-// Server SSE request for new session.
+// Formats the event as the SSE message. The event ID is included in the
+// message, so the subscriber can resume the stream after reconnecting.
+func formatSSEMessage(event *dbmodel.Event) (*sseMessage, error) {
+	evJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem serializing event %d to json", event.ID)
+	}
+	return &sseMessage{
+		id:   event.ID,
+		data: []byte(fmt.Sprintf("id: %d\ndata: %s\n\n", event.ID, evJSON)),
+	}, nil
+}
+
+// Returns the ID of the last event received by the reconnecting subscriber.
+// The ID is sent in the Last-Event-ID header. The boolean value is false
+// when the header is not specified.
+func getLastEventID(req *http.Request) (int64, bool, error) {
+	value := strings.TrimSpace(req.Header.Get("Last-Event-ID"))
+	if len(value) == 0 {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, errors.Errorf("invalid Last-Event-ID header value %s", value)
+	}
+	return id, true, nil
+}
+
+// Sends the message to the subscriber and flushes the connection.
+func sendSSEMessage(w http.ResponseWriter, message *sseMessage) {
+	_, _ = w.Write(message.data)
+	// Not all ResponseWriter instances implement http.Flusher interface.
+	// Test if this instance implement it before attempting to use it.
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Returns the messages with the events having the IDs greater than the
+// specified ID and accepted by the subscriber.
+func (sb *SSEBroker) getReplayMessages(s *Subscriber, lastEventID int64) ([]*sseMessage, error) {
+	events, err := dbmodel.GetEventsAfter(sb.db, lastEventID, s.level,
+		(*dbmodel.Relations)(&s.filters), sseReplayMaxEvents)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == sseReplayMaxEvents {
+		log.Warnf("SSE subscriber %p may have missed more than %d events", s, sseReplayMaxEvents)
+	}
+	messages := []*sseMessage{}
+	for i := range events {
+		message, err := formatSSEMessage(&events[i])
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// Sends the messages to the subscriber. It returns the ID of the last
+// sent event.
+func sendSSEMessages(w http.ResponseWriter, messages []*sseMessage, lastEventID int64) int64 {
+	for _, message := range messages {
+		sendSSEMessage(w, message)
+		lastEventID = message.id
+	}
+	return lastEventID
+}
+
+// Removes the subscriber, so the events are no longer dispatched to it.
+func (sb *SSEBroker) unsubscribe(ch chan *sseMessage) {
+	sb.subscribersMutex.Lock()
+	defer sb.subscribersMutex.Unlock()
+	delete(sb.subscribers, ch)
+}
+
+// Server SSE request for new session. If the Last-Event-ID header is
+// specified, the events added after the specified event are sent to the
+// subscriber before the new events.
 func (sb *SSEBroker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	s := newSubscriber(req.URL)
 
@@ -38,6 +137,13 @@ func (sb *SSEBroker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	lastEventID, resume, err := getLastEventID(req)
+	if err != nil {
+		log.Errorf("Failed to accept new SSE connection: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	log.Printf("New SSE subscriber from %s", req.RemoteAddr)
 
 	// prepare proper HTTP headers for SSE response
@@ -48,34 +154,64 @@ func (sb *SSEBroker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	h.Set("Access-Control-Allow-Origin", "*")
 	h.Set("X-Accel-Buffering", "no") // make nginx working: https://blog.icod.de/2018/12/17/angular-eventsource-go-and-wasted-lifetime/
 
+	// Send the missed events before subscribing, so the event center is
+	// not blocked while they are sent. The response status can be still
+	// changed when getting the missed events fails.
+	if resume {
+		messages, err := sb.getReplayMessages(s, lastEventID)
+		if err != nil {
+			log.Errorf("Problem replaying events to SSE subscriber: %+v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		lastEventID = sendSSEMessages(w, messages, lastEventID)
+	}
+
 	// create a subscriber and a channel which is used
-	// to dispatch an event to this subscriber
-	ch := make(chan []byte)
+	// to dispatch an event to this subscriber; the events dispatched
+	// while the subscriber is busy are queued in the channel
+	ch := make(chan *sseMessage, sseSubscriberQueueSize)
 
 	// store subscriber and its channel in a map, protect the map with mutex
 	sb.subscribersMutex.Lock()
 	sb.subscribers[ch] = s
 	sb.subscribersMutex.Unlock()
 
+	// Send the events added before the subscriber was registered. The
+	// dispatched events that have already been sent are skipped below.
+	// The response has already been started, so the connection is closed
+	// on error. The subscriber can reconnect to receive the missed events.
+	if resume {
+		messages, err := sb.getReplayMessages(s, lastEventID)
+		if err != nil {
+			log.Errorf("Problem replaying events to SSE subscriber: %+v", err)
+			sb.unsubscribe(ch)
+			return
+		}
+		lastEventID = sendSSEMessages(w, messages, lastEventID)
+	}
+
 	// and now listen for events dispatched to this subscriber
 	for {
 		select {
-		case event := <-ch:
-			// send received event to subscriber and flush the connection
-			log.Printf("to %p sent %s", s, event)
-			fmt.Fprintf(w, "data: %s\n\n", event)
-			// Not all ResponseWriter instances implement http.Flusher interface.
-			// Test if this instance implement it before attempting to use it.
-			if flusher, ok := w.(http.Flusher); ok {
-				flusher.Flush()
+		case message, ok := <-ch:
+			if !ok {
+				// The subscriber has been removed because its queue
+				// was full.
+				log.Warnf("Closing connection with slow SSE subscriber %p", s)
+				return
+			}
+			if resume && message.id <= lastEventID {
+				continue
 			}
+			// send received event to subscriber and flush the connection
+			log.Printf("to %p sent %s", s, message.data)
+			sendSSEMessage(w, message)
 
 		case <-req.Context().Done():
 			// connection is closed so unsubscribe subscriber
 			log.Printf("Connection with %p closed", s)
-			sb.subscribersMutex.Lock()
-			delete(sb.subscribers, ch)
-			sb.subscribersMutex.Unlock()
+			sb.unsubscribe(ch)
 			return
 		}
 	}
@@ -86,15 +222,24 @@ func (sb *SSEBroker) dispatchEvent(event *dbmodel.Event) {
 	sb.subscribersMutex.Lock()
 	defer sb.subscribersMutex.Unlock()
 
-	evJSON, err := json.Marshal(event)
+	message, err := formatSSEMessage(event)
 	if err != nil {
 		log.Errorf("Problem serializing event to json: %+v", err)
 		return
 	}
 
-	for ch := range sb.subscribers {
-		if sb.subscribers[ch].AcceptsEvent(event) {
-			ch <- evJSON
+	for ch, s := range sb.subscribers {
+		if !s.AcceptsEvent(event) {
+			continue
+		}
+		// Don't block the event center when the subscriber doesn't keep
+		// up with the events. Disconnect it instead.
+		select {
+		case ch <- message:
+		default:
+			log.Warnf("Queue of SSE subscriber %p is full; disconnecting it", s)
+			delete(sb.subscribers, ch)
+			close(ch)
 		}
 	}
 }
@@ -2,8 +2,12 @@ package eventcenter
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +16,22 @@ import (
 	dbtest "isc.org/stork/server/database/test"
 )
 
+// Waits until the events queued for the SSE subscribers are sent.
+func waitForSSEQueues(sb *SSEBroker) {
+	for i := 1; i <= 100; i++ {
+		sb.subscribersMutex.Lock()
+		pending := 0
+		for ch := range sb.subscribers {
+			pending += len(ch)
+		}
+		sb.subscribersMutex.Unlock()
+		if pending == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // Check SSEBroker.
 func TestSSEBroker(t *testing.T) {
 	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
@@ -37,6 +57,7 @@ func TestSSEBroker(t *testing.T) {
 			Level: dbmodel.EvInfo,
 		}
 		ec.(*eventCenter).sseBroker.dispatchEvent(ev)
+		waitForSSEQueues(ec.(*eventCenter).sseBroker)
 
 		cancel()
 	}()
@@ -46,5 +67,116 @@ func TestSSEBroker(t *testing.T) {
 	body, _ := io.ReadAll(resp.Body)
 	resp.Body.Close()
 	require.Equal(t, 200, resp.StatusCode)
-	require.Equal(t, "data: {\"ID\":0,\"CreatedAt\":\"0001-01-01T00:00:00Z\",\"Text\":\"some text\",\"Level\":0,\"Relations\":null,\"Details\":\"\"}\n\n", string(body))
+	require.Equal(t, "id: 0\ndata: {\"ID\":0,\"CreatedAt\":\"0001-01-01T00:00:00Z\",\"Text\":\"some text\",\"Level\":0,\"Relations\":null,\"Details\":\"\",\"Template\":\"\",\"Count\":0,\"LastSeenAt\":\"0001-01-01T00:00:00Z\",\"ResolvesID\":0}\n\n", string(body))
+}
+
+// Test formatting the event as the SSE message.
+func TestFormatSSEMessage(t *testing.T) {
+	message, err := formatSSEMessage(&dbmodel.Event{ID: 12, Text: "foo"})
+	require.NoError(t, err)
+	require.EqualValues(t, 12, message.id)
+	require.True(t, strings.HasPrefix(string(message.data), "id: 12\ndata: {\"ID\":12,"))
+	require.True(t, strings.HasSuffix(string(message.data), "}\n\n"))
+}
+
+// Test getting the ID of the last event received by the subscriber.
+func TestGetLastEventID(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://localhost/sse", nil)
+	_, resume, err := getLastEventID(req)
+	require.NoError(t, err)
+	require.False(t, resume)
+
+	req.Header.Set("Last-Event-ID", "42")
+	id, resume, err := getLastEventID(req)
+	require.NoError(t, err)
+	require.True(t, resume)
+	require.EqualValues(t, 42, id)
+
+	req.Header.Set("Last-Event-ID", "foo")
+	_, _, err = getLastEventID(req)
+	require.ErrorContains(t, err, "invalid Last-Event-ID header value foo")
+
+	req.Header.Set("Last-Event-ID", "-1")
+	_, _, err = getLastEventID(req)
+	require.Error(t, err)
+}
+
+// Test that the events missed by the reconnecting subscriber are sent
+// before the new events and that the subscriber filters are applied to
+// them.
+func TestSSEBrokerReplay(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	events := []*dbmodel.Event{
+		{Text: "received", Level: dbmodel.EvError},
+		{Text: "missed info", Level: dbmodel.EvInfo},
+		{Text: "missed error", Level: dbmodel.EvError},
+	}
+	for _, event := range events {
+		require.NoError(t, dbmodel.AddEvent(db, event))
+	}
+
+	sb := NewSSEBroker(db)
+
+	req := httptest.NewRequest("GET", "http://localhost/sse?level=1", nil)
+	req.Header.Set("Last-Event-ID", fmt.Sprint(events[0].ID))
+	w := httptest.NewRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	req = req.WithContext(ctx)
+
+	go func() {
+		for i := 1; i <= 100 && sb.getSubscribersCount() == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// The event that has already been replayed is skipped.
+		sb.dispatchEvent(events[2])
+		sb.dispatchEvent(&dbmodel.Event{ID: events[2].ID + 1, Text: "new error", Level: dbmodel.EvError})
+		waitForSSEQueues(sb)
+		cancel()
+	}()
+
+	sb.ServeHTTP(w, req)
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	messages := strings.Split(strings.TrimSuffix(string(body), "\n\n"), "\n\n")
+	require.Len(t, messages, 2)
+	require.True(t, strings.HasPrefix(messages[0], fmt.Sprintf("id: %d\n", events[2].ID)))
+	require.Contains(t, messages[0], "missed error")
+	require.True(t, strings.HasPrefix(messages[1], fmt.Sprintf("id: %d\n", events[2].ID+1)))
+	require.Contains(t, messages[1], "new error")
+
+	// Invalid header.
+	req = httptest.NewRequest("GET", "http://localhost/sse", nil)
+	req.Header.Set("Last-Event-ID", "foo")
+	w = httptest.NewRecorder()
+	sb.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+}
+
+// Test that the subscriber whose queue is full is disconnected instead of
+// blocking the event dispatch.
+func TestSSEBrokerDisconnectSlowSubscriber(t *testing.T) {
+	sb := NewSSEBroker(nil)
+	serverURL, err := url.Parse("http://localhost/sse")
+	require.NoError(t, err)
+	ch := make(chan *sseMessage, 1)
+	sb.subscribers[ch] = newSubscriber(serverURL)
+
+	sb.dispatchEvent(&dbmodel.Event{ID: 1, Text: "foo", Level: dbmodel.EvInfo})
+	require.Equal(t, 1, sb.getSubscribersCount())
+
+	// The queue is full, so the subscriber is removed.
+	sb.dispatchEvent(&dbmodel.Event{ID: 2, Text: "bar", Level: dbmodel.EvInfo})
+	require.Zero(t, sb.getSubscribersCount())
+
+	// The queued event is still delivered and then the channel is closed.
+	message, ok := <-ch
+	require.True(t, ok)
+	require.EqualValues(t, 1, message.id)
+	_, ok = <-ch
+	require.False(t, ok)
 }
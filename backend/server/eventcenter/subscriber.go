@@ -168,14 +168,24 @@ func (s *Subscriber) applyFiltersFromQuery(db *dbops.PgDB) (err error) {
 	return nil
 }
 
+// Returns a boolean value indicating if the event relates to the objects
+// specified in the filters and has at least the specified level. The zero
+// filter values match all events.
+func (f *subscriberFilters) matches(level int, event *dbmodel.Event) bool {
+	relations := event.Relations
+	if relations == nil {
+		relations = &dbmodel.Relations{}
+	}
+	return (f.MachineID == 0 || relations.MachineID == f.MachineID) &&
+		(f.AppID == 0 || relations.AppID == f.AppID) &&
+		(f.SubnetID == 0 || relations.SubnetID == f.SubnetID) &&
+		(f.DaemonID == 0 || relations.DaemonID == f.DaemonID) &&
+		(f.UserID == 0 || relations.UserID == f.UserID) &&
+		(level == 0 || event.Level >= level)
+}
+
 // Returns a boolean value indicating if the subscriber is eligible to receive
 // the specified event.
 func (s *Subscriber) AcceptsEvent(event *dbmodel.Event) bool {
-	return !s.useFilter ||
-		((s.filters.MachineID == 0 || event.Relations.MachineID == s.filters.MachineID) &&
-			(s.filters.AppID == 0 || event.Relations.AppID == s.filters.AppID) &&
-			(s.filters.SubnetID == 0 || event.Relations.SubnetID == s.filters.SubnetID) &&
-			(s.filters.DaemonID == 0 || event.Relations.DaemonID == s.filters.DaemonID) &&
-			(s.filters.UserID == 0 || event.Relations.UserID == s.filters.UserID) &&
-			(s.level == 0 || event.Level >= s.level))
+	return !s.useFilter || s.filters.matches(s.level, event)
 }
@@ -0,0 +1,270 @@
+package eventcenter
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+)
+
+const (
+	// Maximum number of the events waiting for the syslog sink. The events
+	// are dropped when the queue is full.
+	syslogQueueSize = 256
+	// Timeout of connecting and writing to the syslog server.
+	syslogTimeout = 10 * time.Second
+	// Facility of the forwarded messages (local0).
+	syslogFacility = 16
+	// Name of the application included in the forwarded messages.
+	syslogAppName = "stork-server"
+	// Identifier of the structured data element holding the event
+	// relations. The number is the ISC private enterprise number.
+	syslogSDID = "stork@2495"
+)
+
+// Syslog severities (RFC 5424, section 6.2.1).
+const (
+	syslogSeverityError         = 3
+	syslogSeverityWarning       = 4
+	syslogSeverityInformational = 6
+)
+
+// Syslog server settings stored in the database.
+type syslogSettings struct {
+	address   string
+	transport string
+}
+
+// Forwards the events to the syslog server using the RFC 5424 format.
+// The messages are sent over UDP, TCP or TLS. The stream transports use
+// the octet counting framing (RFC 6587). The server address and the
+// transport are stored in the database. The events are not forwarded
+// when the address is not configured.
+type syslogSink struct {
+	db       *dbops.PgDB
+	events   chan *dbmodel.Event
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       *sync.WaitGroup
+	hostname string
+	pid      int
+	conn     net.Conn
+	settings syslogSettings
+}
+
+// Creates a new syslog sink. The sink must be started with the start
+// function.
+func newSyslogSink(db *dbops.PgDB) *syslogSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	hostname, err := os.Hostname()
+	if err != nil || len(hostname) == 0 {
+		hostname = "-"
+	}
+	return &syslogSink{
+		db:       db,
+		events:   make(chan *dbmodel.Event, syslogQueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		wg:       &sync.WaitGroup{},
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+}
+
+// Starts the goroutine forwarding the events.
+func (s *syslogSink) start() {
+	s.wg.Add(1)
+	go s.mainLoop()
+}
+
+// Stops forwarding the events and closes the connection to the syslog
+// server.
+func (s *syslogSink) shutdown() {
+	s.cancel()
+	s.wg.Wait()
+	s.close()
+}
+
+// Queues the event for forwarding. It doesn't block when the queue is
+// full. The event is dropped instead.
+func (s *syslogSink) dispatchEvent(event *dbmodel.Event) {
+	select {
+	case s.events <- event:
+	default:
+		log.Warnf("Syslog queue is full; dropping event %d", event.ID)
+	}
+}
+
+// Forwards the queued events until the sink is stopped.
+func (s *syslogSink) mainLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case event := <-s.events:
+			s.forward(event)
+		}
+	}
+}
+
+// Returns the syslog server settings from the database.
+func getSyslogSettings(db *dbops.PgDB) (*syslogSettings, error) {
+	var (
+		settings syslogSettings
+		err      error
+	)
+	if settings.address, err = dbmodel.GetSettingStr(db, "syslog_address"); err != nil {
+		return nil, err
+	}
+	if settings.transport, err = dbmodel.GetSettingStr(db, "syslog_transport"); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Forwards the event to the syslog server configured in the database.
+func (s *syslogSink) forward(event *dbmodel.Event) {
+	settings, err := getSyslogSettings(s.db)
+	if err != nil {
+		log.Errorf("Problem getting syslog settings: %+v", err)
+		return
+	}
+	if len(settings.address) == 0 {
+		s.close()
+		return
+	}
+	message := formatSyslogMessage(event, s.hostname, s.pid)
+	if err = s.send(settings, message); err != nil {
+		log.Errorf("Problem forwarding event %d to syslog: %s", event.ID, err)
+	}
+}
+
+// Sends the message to the syslog server. The connection is reused
+// between the messages and re-established when the settings change.
+// A failed stream connection is re-established once.
+func (s *syslogSink) send(settings *syslogSettings, message []byte) error {
+	if s.conn != nil && s.settings != *settings {
+		s.close()
+	}
+	if settings.transport != "udp" {
+		message = append([]byte(fmt.Sprintf("%d ", len(message))), message...)
+	}
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if err = s.connect(settings); err != nil {
+				return err
+			}
+		}
+		_ = s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err = s.conn.Write(message); err == nil {
+			return nil
+		}
+		s.close()
+	}
+	return errors.Wrapf(err, "problem sending message to syslog server %s", settings.address)
+}
+
+// Connects to the syslog server using the specified transport.
+func (s *syslogSink) connect(settings *syslogSettings) (err error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	switch settings.transport {
+	case "udp", "tcp":
+		s.conn, err = dialer.Dial(settings.transport, settings.address)
+	case "tls":
+		host, _, _ := net.SplitHostPort(settings.address)
+		s.conn, err = tls.DialWithDialer(dialer, "tcp", settings.address, &tls.Config{
+			ServerName: host,
+			MinVersion: tls.VersionTLS12,
+		})
+	default:
+		return errors.Errorf("unsupported syslog transport %s", settings.transport)
+	}
+	if err != nil {
+		s.conn = nil
+		return errors.Wrapf(err, "problem connecting to syslog server %s over %s", settings.address, settings.transport)
+	}
+	s.settings = *settings
+	return nil
+}
+
+// Closes the connection to the syslog server if it is open.
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Returns the syslog severity corresponding to the event level.
+func syslogSeverity(level int) int {
+	switch level {
+	case dbmodel.EvWarning:
+		return syslogSeverityWarning
+	case dbmodel.EvError:
+		return syslogSeverityError
+	default:
+		return syslogSeverityInformational
+	}
+}
+
+// Escapes the structured data parameter value (RFC 5424, section 6.3.3).
+func escapeSyslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// Formats the event as the RFC 5424 syslog message. The event relations,
+// the level and the details are included in the structured data. The
+// message contains the event text with the object tags replaced with the
+// object names.
+func formatSyslogMessage(event *dbmodel.Event, hostname string, pid int) []byte {
+	timestamp := "-"
+	if !event.CreatedAt.IsZero() {
+		timestamp = event.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+
+	params := []string{
+		fmt.Sprintf(`eventId="%d"`, event.ID),
+		fmt.Sprintf(`level="%s"`, eventLevelName(event.Level)),
+	}
+	if event.Relations != nil {
+		relations := []struct {
+			name string
+			id   int64
+		}{
+			{"machineId", event.Relations.MachineID},
+			{"appId", event.Relations.AppID},
+			{"daemonId", event.Relations.DaemonID},
+			{"subnetId", event.Relations.SubnetID},
+			{"userId", event.Relations.UserID},
+		}
+		for _, relation := range relations {
+			if relation.id != 0 {
+				params = append(params, fmt.Sprintf(`%s="%d"`, relation.name, relation.id))
+			}
+		}
+	}
+	if len(event.Details) > 0 {
+		params = append(params, fmt.Sprintf(`details="%s"`, escapeSyslogParamValue(event.Details)))
+	}
+
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d event [%s %s] %s",
+		syslogFacility*8+syslogSeverity(event.Level),
+		timestamp,
+		hostname,
+		syslogAppName,
+		pid,
+		syslogSDID,
+		strings.Join(params, " "),
+		formatEventText(event.Text)))
+}
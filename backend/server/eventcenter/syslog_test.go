@@ -0,0 +1,198 @@
+package eventcenter
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Test mapping the event levels to the syslog severities.
+func TestSyslogSeverity(t *testing.T) {
+	require.Equal(t, 6, syslogSeverity(dbmodel.EvInfo))
+	require.Equal(t, 4, syslogSeverity(dbmodel.EvWarning))
+	require.Equal(t, 3, syslogSeverity(dbmodel.EvError))
+}
+
+// Test escaping the structured data parameter values.
+func TestEscapeSyslogParamValue(t *testing.T) {
+	require.Equal(t, `foo`, escapeSyslogParamValue(`foo`))
+	require.Equal(t, `a\"b\\c\]d`, escapeSyslogParamValue(`a"b\c]d`))
+}
+
+// Test formatting the event as the RFC 5424 message.
+func TestFormatSyslogMessage(t *testing.T) {
+	event := &dbmodel.Event{
+		ID:        12,
+		CreatedAt: time.Date(2023, 5, 10, 12, 0, 0, 123456000, time.UTC),
+		Level:     dbmodel.EvError,
+		Text:      `<daemon id="3" name="dhcp4" appId="2" appType="kea"> is unreachable`,
+		Details:   `connection "refused"`,
+		Relations: &dbmodel.Relations{
+			MachineID: 1,
+			AppID:     2,
+			DaemonID:  3,
+		},
+	}
+	message := string(formatSyslogMessage(event, "stork.example.org", 42))
+	require.Equal(t, `<131>1 2023-05-10T12:00:00.123456Z stork.example.org stork-server 42 event `+
+		`[stork@2495 eventId="12" level="error" machineId="1" appId="2" daemonId="3" details="connection \"refused\""] `+
+		`daemon dhcp4 is unreachable`, message)
+
+	// Event without relations, details and timestamp.
+	event = &dbmodel.Event{
+		ID:    13,
+		Level: dbmodel.EvInfo,
+		Text:  "foo",
+	}
+	message = string(formatSyslogMessage(event, "-", 42))
+	require.Equal(t, `<134>1 - - stork-server 42 event [stork@2495 eventId="13" level="info"] foo`, message)
+}
+
+// Test sending the messages over UDP.
+func TestSyslogSendUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink := newSyslogSink(nil)
+	defer sink.close()
+	settings := &syslogSettings{
+		address:   conn.LocalAddr().String(),
+		transport: "udp",
+	}
+	err = sink.send(settings, []byte("<134>1 - - stork-server 1 event - foo"))
+	require.NoError(t, err)
+
+	buffer := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buffer)
+	require.NoError(t, err)
+	// The datagram holds a single message without the framing.
+	require.Equal(t, "<134>1 - - stork-server 1 event - foo", string(buffer[:n]))
+}
+
+// Test sending the messages over TCP. The connection is reused and
+// re-established when the settings change.
+func TestSyslogSendTCP(t *testing.T) {
+	listen := func() (net.Listener, chan string) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		received := make(chan string, 10)
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for {
+				// Read the message length followed by a space and the
+				// message.
+				length, err := reader.ReadString(' ')
+				if err != nil {
+					return
+				}
+				n, err := strconv.Atoi(strings.TrimSpace(length))
+				if err != nil {
+					return
+				}
+				message := make([]byte, n)
+				if _, err = io.ReadFull(reader, message); err != nil {
+					return
+				}
+				received <- string(message)
+			}
+		}()
+		return listener, received
+	}
+	listener1, received1 := listen()
+	defer listener1.Close()
+	listener2, received2 := listen()
+	defer listener2.Close()
+
+	sink := newSyslogSink(nil)
+	defer sink.close()
+	settings := &syslogSettings{
+		address:   listener1.Addr().String(),
+		transport: "tcp",
+	}
+
+	// The messages are framed with the octet counting. The second message
+	// is sent over the same connection because the listener accepts one.
+	require.NoError(t, sink.send(settings, []byte("foo")))
+	require.NoError(t, sink.send(settings, []byte("bar")))
+	require.Equal(t, "foo", <-received1)
+	require.Equal(t, "bar", <-received1)
+
+	// Connect to the other server when the address changes.
+	settings = &syslogSettings{
+		address:   listener2.Addr().String(),
+		transport: "tcp",
+	}
+	require.NoError(t, sink.send(settings, []byte("foobar")))
+	require.Equal(t, "foobar", <-received2)
+}
+
+// Test that an error is returned when the syslog server is unreachable.
+func TestSyslogSendConnectionError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	sink := newSyslogSink(nil)
+	err = sink.send(&syslogSettings{address: address, transport: "tcp"}, []byte("foo"))
+	require.ErrorContains(t, err, "problem connecting to syslog server")
+	require.Nil(t, sink.conn)
+
+	err = sink.send(&syslogSettings{address: address, transport: "sctp"}, []byte("foo"))
+	require.ErrorContains(t, err, "unsupported syslog transport sctp")
+}
+
+// Test forwarding the events to the syslog server configured in the
+// database.
+func TestSyslogForward(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	err = dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	sink := newSyslogSink(db)
+	defer sink.close()
+
+	// The forwarding is disabled by default.
+	sink.forward(&dbmodel.Event{ID: 1, Text: "foo"})
+	require.Nil(t, sink.conn)
+
+	err = dbmodel.SetSettingStr(db, "syslog_address", conn.LocalAddr().String())
+	require.NoError(t, err)
+
+	sink.forward(&dbmodel.Event{ID: 2, Level: dbmodel.EvWarning, Text: "bar"})
+	require.NotNil(t, sink.conn)
+
+	buffer := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buffer)
+	require.NoError(t, err)
+	require.Contains(t, string(buffer[:n]), `<132>1 `)
+	require.Contains(t, string(buffer[:n]), `eventId="2"`)
+
+	// Disable the forwarding.
+	err = dbmodel.SetSettingStr(db, "syslog_address", "")
+	require.NoError(t, err)
+	sink.forward(&dbmodel.Event{ID: 3, Text: "baz"})
+	require.Nil(t, sink.conn)
+}
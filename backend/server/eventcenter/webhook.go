@@ -0,0 +1,249 @@
+package eventcenter
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+)
+
+const (
+	// Name of the HTTP header holding the HMAC-SHA256 signature of the
+	// payload. The signature is computed using the webhook secret and
+	// is hex encoded with the sha256= prefix.
+	WebhookSignatureHeader = "X-Stork-Signature"
+	// Maximum number of the events waiting for the delivery. The events
+	// are dropped when the queue is full.
+	webhookQueueSize = 256
+	// Number of the goroutines delivering the events to the webhooks. It
+	// limits the number of the concurrent requests to the webhooks.
+	webhookWorkerCount = 4
+	// Maximum number of attempts to deliver an event to a webhook.
+	webhookMaxAttempts = 5
+	// Delay before the first retry. It is doubled after each attempt.
+	webhookInitialBackoff = time.Second
+	// Timeout of a single HTTP request to a webhook.
+	webhookRequestTimeout = 10 * time.Second
+)
+
+// Posts the events to the webhooks registered in the database. The events
+// are serialized to JSON like for the SSE subscribers. The delivery is
+// retried with the exponential backoff when the webhook is unreachable or
+// responds with a server error. The deliveries of the event to the
+// particular webhooks are queued and handled by a fixed pool of workers,
+// so a slow webhook does not delay the others as long as a worker is
+// available.
+type webhookDispatcher struct {
+	db             *dbops.PgDB
+	client         *http.Client
+	events         chan *dbmodel.Event
+	deliveries     chan *webhookDelivery
+	workers        int
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             *sync.WaitGroup
+	maxAttempts    int
+	initialBackoff time.Duration
+}
+
+// Creates a new webhook dispatcher. The dispatcher must be started with
+// the start function.
+func newWebhookDispatcher(db *dbops.PgDB) *webhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhookDispatcher{
+		db: db,
+		client: &http.Client{
+			Timeout: webhookRequestTimeout,
+		},
+		events:         make(chan *dbmodel.Event, webhookQueueSize),
+		deliveries:     make(chan *webhookDelivery, webhookQueueSize),
+		workers:        webhookWorkerCount,
+		ctx:            ctx,
+		cancel:         cancel,
+		wg:             &sync.WaitGroup{},
+		maxAttempts:    webhookMaxAttempts,
+		initialBackoff: webhookInitialBackoff,
+	}
+}
+
+// A single event to be posted to a single webhook.
+type webhookDelivery struct {
+	webhook dbmodel.Webhook
+	event   *dbmodel.Event
+	payload []byte
+}
+
+// Starts the goroutines queuing and delivering the events.
+func (d *webhookDispatcher) start() {
+	d.wg.Add(1)
+	go d.mainLoop()
+	for i := 0; i < d.workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+}
+
+// Stops delivering the events. The pending retries are abandoned.
+func (d *webhookDispatcher) shutdown() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Queues the event for the delivery. It doesn't block when the queue
+// is full. The event is dropped instead.
+func (d *webhookDispatcher) dispatchEvent(event *dbmodel.Event) {
+	select {
+	case d.events <- event:
+	default:
+		log.Warnf("Webhook queue is full; dropping event %d", event.ID)
+	}
+}
+
+// Queues the deliveries of the events to the webhooks until the dispatcher
+// is stopped.
+func (d *webhookDispatcher) mainLoop() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case event := <-d.events:
+			d.deliverEvent(event)
+		}
+	}
+}
+
+// Posts the queued events to the webhooks until the dispatcher is stopped.
+func (d *webhookDispatcher) worker() {
+	defer d.wg.Done()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case delivery := <-d.deliveries:
+			if err := d.deliver(&delivery.webhook, delivery.payload); err != nil {
+				log.WithField("webhook", delivery.webhook.URL).Errorf("Problem delivering event %d: %s", delivery.event.ID, err)
+			}
+		}
+	}
+}
+
+// Checks if the webhook filters accept the event.
+func webhookAcceptsEvent(webhook *dbmodel.Webhook, event *dbmodel.Event) bool {
+	filters := &subscriberFilters{
+		MachineID: webhook.MachineID,
+		AppID:     webhook.AppID,
+		DaemonID:  webhook.DaemonID,
+		SubnetID:  webhook.SubnetID,
+	}
+	return filters.matches(webhook.Level, event)
+}
+
+// Returns the hex encoded HMAC-SHA256 of the payload.
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Queues the delivery of the event to all enabled webhooks accepting it.
+func (d *webhookDispatcher) deliverEvent(event *dbmodel.Event) {
+	webhooks, err := dbmodel.GetEnabledWebhooks(d.db)
+	if err != nil {
+		log.Errorf("Problem getting webhooks: %+v", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	d.queueDeliveries(webhooks, event)
+}
+
+// Queues the delivery of the event to the specified webhooks accepting it.
+// It blocks when the delivery queue is full, so the new events are dropped
+// by the dispatchEvent function until the workers catch up.
+func (d *webhookDispatcher) queueDeliveries(webhooks []dbmodel.Webhook, event *dbmodel.Event) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("Problem serializing event to json: %+v", err)
+		return
+	}
+	for i := range webhooks {
+		if !webhookAcceptsEvent(&webhooks[i], event) {
+			continue
+		}
+		delivery := &webhookDelivery{
+			webhook: webhooks[i],
+			event:   event,
+			payload: payload,
+		}
+		select {
+		case <-d.ctx.Done():
+			return
+		case d.deliveries <- delivery:
+		}
+	}
+}
+
+// Posts the payload to the webhook. It retries with the exponential
+// backoff as long as the failure is transient and the number of attempts
+// has not been exceeded.
+func (d *webhookDispatcher) deliver(webhook *dbmodel.Webhook, payload []byte) error {
+	backoff := d.initialBackoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(webhook, payload)
+		if err == nil || !retry {
+			return err
+		}
+		if attempt >= d.maxAttempts {
+			return errors.WithMessagef(err, "giving up after %d attempts", attempt)
+		}
+		select {
+		case <-d.ctx.Done():
+			return errors.WithMessage(err, "delivery canceled")
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Sends a single HTTP request with the payload to the webhook. It returns
+// a boolean flag indicating if the failed request should be retried. The
+// request is retried when the webhook is unreachable or responds with a
+// server error, the request timeout or the too many requests status.
+func (d *webhookDispatcher) post(webhook *dbmodel.Webhook, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, errors.Wrapf(err, "problem creating request to webhook %s", webhook.URL)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(webhook.Secret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhookPayload(webhook.Secret, payload))
+	}
+
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		return true, errors.Wrapf(err, "problem sending request to webhook %s", webhook.URL)
+	}
+	defer rsp.Body.Close()
+	_, _ = io.Copy(io.Discard, rsp.Body)
+
+	if rsp.StatusCode >= 200 && rsp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := rsp.StatusCode >= 500 ||
+		rsp.StatusCode == http.StatusRequestTimeout ||
+		rsp.StatusCode == http.StatusTooManyRequests
+	return retry, errors.Errorf("webhook %s responded with status %d", webhook.URL, rsp.StatusCode)
+}
@@ -0,0 +1,223 @@
+package eventcenter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+)
+
+// Creates the webhook dispatcher with short backoff for the tests.
+func newTestWebhookDispatcher() *webhookDispatcher {
+	dispatcher := newWebhookDispatcher(nil)
+	dispatcher.maxAttempts = 3
+	dispatcher.initialBackoff = time.Millisecond
+	return dispatcher
+}
+
+// Test filtering the events by the webhook filters.
+func TestWebhookAcceptsEvent(t *testing.T) {
+	event := &dbmodel.Event{
+		Level: dbmodel.EvWarning,
+		Relations: &dbmodel.Relations{
+			MachineID: 1,
+			AppID:     2,
+			DaemonID:  3,
+			SubnetID:  4,
+		},
+	}
+	require.True(t, webhookAcceptsEvent(&dbmodel.Webhook{}, event))
+	require.True(t, webhookAcceptsEvent(&dbmodel.Webhook{Level: dbmodel.EvWarning, MachineID: 1, SubnetID: 4}, event))
+	require.False(t, webhookAcceptsEvent(&dbmodel.Webhook{Level: dbmodel.EvError}, event))
+	require.False(t, webhookAcceptsEvent(&dbmodel.Webhook{MachineID: 5}, event))
+	require.False(t, webhookAcceptsEvent(&dbmodel.Webhook{AppID: 5}, event))
+	require.False(t, webhookAcceptsEvent(&dbmodel.Webhook{DaemonID: 5}, event))
+	require.False(t, webhookAcceptsEvent(&dbmodel.Webhook{SubnetID: 5}, event))
+
+	// Event without relations.
+	event.Relations = nil
+	require.True(t, webhookAcceptsEvent(&dbmodel.Webhook{}, event))
+	require.False(t, webhookAcceptsEvent(&dbmodel.Webhook{SubnetID: 4}, event))
+}
+
+// Test computing the HMAC signature of the payload.
+func TestSignWebhookPayload(t *testing.T) {
+	// The test vector from RFC 4231, test case 2.
+	signature := signWebhookPayload("Jefe", []byte("what do ya want for nothing?"))
+	require.Equal(t, "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843", signature)
+}
+
+// Test that the signed payload is posted to the webhook.
+func TestWebhookDeliver(t *testing.T) {
+	var (
+		body      []byte
+		signature string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(WebhookSignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestWebhookDispatcher()
+	payload := []byte(`{"Text":"foo"}`)
+
+	err := dispatcher.deliver(&dbmodel.Webhook{URL: server.URL, Secret: "secret"}, payload)
+	require.NoError(t, err)
+	require.Equal(t, payload, body)
+	require.Equal(t, "sha256="+signWebhookPayload("secret", payload), signature)
+
+	// No signature without the secret.
+	err = dispatcher.deliver(&dbmodel.Webhook{URL: server.URL}, payload)
+	require.NoError(t, err)
+	require.Empty(t, signature)
+}
+
+// Test that the delivery is retried when the webhook responds with
+// a server error.
+func TestWebhookDeliverRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestWebhookDispatcher()
+	err := dispatcher.deliver(&dbmodel.Webhook{URL: server.URL}, []byte("{}"))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, atomic.LoadInt32(&attempts))
+
+	// Give up after the maximum number of attempts.
+	atomic.StoreInt32(&attempts, -10)
+	err = dispatcher.deliver(&dbmodel.Webhook{URL: server.URL}, []byte("{}"))
+	require.ErrorContains(t, err, "giving up after 3 attempts")
+	require.EqualValues(t, -7, atomic.LoadInt32(&attempts))
+}
+
+// Test that the delivery is not retried when the webhook rejects the
+// request.
+func TestWebhookDeliverNoRetry(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestWebhookDispatcher()
+	err := dispatcher.deliver(&dbmodel.Webhook{URL: server.URL}, []byte("{}"))
+	require.ErrorContains(t, err, "responded with status 400")
+	require.EqualValues(t, 1, atomic.LoadInt32(&attempts))
+}
+
+// Test that the events are posted to the enabled webhooks accepting them.
+func TestWebhookDeliverEvent(t *testing.T) {
+	db, _, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	var (
+		mutex    sync.Mutex
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event dbmodel.Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, r.URL.Path+" "+event.Text)
+	}))
+	defer server.Close()
+
+	webhooks := []dbmodel.Webhook{
+		{URL: server.URL + "/all", Enabled: true},
+		{URL: server.URL + "/errors", Enabled: true, Level: dbmodel.EvError},
+		{URL: server.URL + "/disabled", Enabled: false},
+	}
+	for i := range webhooks {
+		err := dbmodel.AddWebhook(db, &webhooks[i])
+		require.NoError(t, err)
+	}
+
+	dispatcher := newTestWebhookDispatcher()
+	dispatcher.db = db
+	dispatcher.start()
+
+	dispatcher.dispatchEvent(&dbmodel.Event{ID: 1, Text: "info", Level: dbmodel.EvInfo, Relations: &dbmodel.Relations{}})
+	dispatcher.dispatchEvent(&dbmodel.Event{ID: 2, Text: "error", Level: dbmodel.EvError, Relations: &dbmodel.Relations{}})
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	dispatcher.shutdown()
+
+	require.ElementsMatch(t, []string{"/all info", "/all error", "/errors error"}, received)
+}
+
+// Test that the number of the concurrent deliveries is limited by the
+// number of the workers.
+func TestWebhookDeliveryWorkers(t *testing.T) {
+	var (
+		active    int32
+		maxActive int32
+		delivered int32
+	)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&active, 1)
+		for {
+			observed := atomic.LoadInt32(&maxActive)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxActive, observed, current) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&active, -1)
+		atomic.AddInt32(&delivered, 1)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestWebhookDispatcher()
+	dispatcher.workers = 2
+	dispatcher.start()
+	defer dispatcher.shutdown()
+
+	webhooks := []dbmodel.Webhook{
+		{URL: server.URL + "/first", Enabled: true},
+		{URL: server.URL + "/second", Enabled: true},
+		{URL: server.URL + "/third", Enabled: true},
+	}
+	for i := int64(1); i <= 2; i++ {
+		dispatcher.queueDeliveries(webhooks, &dbmodel.Event{ID: i, Level: dbmodel.EvInfo, Relations: &dbmodel.Relations{}})
+	}
+
+	// Only two requests should be in progress.
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&active) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 2, atomic.LoadInt32(&active))
+
+	// All deliveries should complete when the webhook responds.
+	close(release)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&delivered) == 6
+	}, 5*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 2, atomic.LoadInt32(&maxActive))
+}
@@ -0,0 +1,285 @@
+package restservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	log "github.com/sirupsen/logrus"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/events"
+)
+
+// Converts the alert rule to the format used in REST API.
+func alertRuleToRestAPI(rule *dbmodel.AlertRule) *models.AlertRule {
+	return &models.AlertRule{
+		ID:        rule.ID,
+		CreatedAt: strfmt.DateTime(rule.CreatedAt),
+		Name:      rule.Name,
+		Metric:    rule.Metric,
+		Operator:  rule.Operator,
+		Threshold: rule.Threshold,
+		Duration:  rule.Duration,
+		Severity:  int64(rule.Severity),
+		Enabled:   rule.Enabled,
+	}
+}
+
+// Converts the alert rule received over the REST API to the database
+// model.
+func alertRuleFromRestAPI(rule *models.AlertRule) *dbmodel.AlertRule {
+	return &dbmodel.AlertRule{
+		Name:      rule.Name,
+		Metric:    rule.Metric,
+		Operator:  rule.Operator,
+		Threshold: rule.Threshold,
+		Duration:  rule.Duration,
+		Severity:  int(rule.Severity),
+		Enabled:   rule.Enabled,
+	}
+}
+
+// Converts the alert to the format used in REST API.
+func alertToRestAPI(a *dbmodel.Alert) *models.Alert {
+	alert := &models.Alert{
+		ID:        a.ID,
+		RuleID:    a.RuleID,
+		Label:     a.Label,
+		Value:     a.Value,
+		State:     "pending",
+		StartedAt: strfmt.DateTime(a.StartedAt),
+	}
+	if a.SubnetID != nil {
+		alert.SubnetID = *a.SubnetID
+	}
+	if a.IsFiring() {
+		alert.State = "firing"
+		firedAt := strfmt.DateTime(a.FiredAt)
+		alert.FiredAt = &firedAt
+	}
+	if a.Rule != nil {
+		alert.RuleName = a.Rule.Name
+		alert.Metric = a.Rule.Metric
+		alert.Operator = a.Rule.Operator
+		alert.Threshold = a.Rule.Threshold
+		alert.Severity = int64(a.Rule.Severity)
+	}
+	return alert
+}
+
+// Returns the pending and firing alerts. The alerts can be filtered by
+// the state.
+func (r *RestAPI) GetAlerts(ctx context.Context, params events.GetAlertsParams) middleware.Responder {
+	var start int64
+	if params.Start != nil {
+		start = *params.Start
+	}
+
+	var limit int64 = 10
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	var firing *bool
+	if params.State != nil {
+		isFiring := *params.State == "firing"
+		firing = &isFiring
+	}
+
+	dbAlerts, total, err := dbmodel.GetAlertsByPage(r.DB, start, limit, firing)
+	if err != nil {
+		msg := "Problem fetching alerts from the database"
+		log.Error(err)
+		rsp := events.NewGetAlertsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	alerts := &models.Alerts{
+		Items: []*models.Alert{},
+		Total: total,
+	}
+	for i := range dbAlerts {
+		alerts.Items = append(alerts.Items, alertToRestAPI(&dbAlerts[i]))
+	}
+
+	rsp := events.NewGetAlertsOK().WithPayload(alerts)
+	return rsp
+}
+
+// Returns all alert rules.
+func (r *RestAPI) GetAlertRules(ctx context.Context, params events.GetAlertRulesParams) middleware.Responder {
+	dbRules, err := dbmodel.GetAllAlertRules(r.DB)
+	if err != nil {
+		msg := "Problem fetching alert rules from the database"
+		log.Error(err)
+		rsp := events.NewGetAlertRulesDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rules := &models.AlertRules{
+		Items: []*models.AlertRule{},
+		Total: int64(len(dbRules)),
+	}
+	for i := range dbRules {
+		rules.Items = append(rules.Items, alertRuleToRestAPI(&dbRules[i]))
+	}
+
+	rsp := events.NewGetAlertRulesOK().WithPayload(rules)
+	return rsp
+}
+
+// Returns the alert rule by ID.
+func (r *RestAPI) GetAlertRule(ctx context.Context, params events.GetAlertRuleParams) middleware.Responder {
+	rule, err := dbmodel.GetAlertRule(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching alert rule with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := events.NewGetAlertRuleDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if rule == nil {
+		msg := fmt.Sprintf("Cannot find alert rule with ID %d", params.ID)
+		rsp := events.NewGetAlertRuleDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rsp := events.NewGetAlertRuleOK().WithPayload(alertRuleToRestAPI(rule))
+	return rsp
+}
+
+// Creates new alert rule. The rule is evaluated during the next
+// evaluation of the alert rules.
+func (r *RestAPI) CreateAlertRule(ctx context.Context, params events.CreateAlertRuleParams) middleware.Responder {
+	if params.Rule == nil {
+		msg := "Missing alert rule"
+		rsp := events.NewCreateAlertRuleDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rule := alertRuleFromRestAPI(params.Rule)
+	if err := rule.Validate(); err != nil {
+		msg := fmt.Sprintf("Invalid alert rule: %s", err)
+		rsp := events.NewCreateAlertRuleDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	if err := dbmodel.AddAlertRule(r.DB, rule); err != nil {
+		msg := fmt.Sprintf("Cannot create alert rule %s", rule.Name)
+		log.Error(err)
+		rsp := events.NewCreateAlertRuleDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	// Get the rule back to fetch its creation time.
+	if returned, err := dbmodel.GetAlertRule(r.DB, rule.ID); err == nil && returned != nil {
+		rule = returned
+	}
+
+	payload := alertRuleToRestAPI(rule)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetAlertRule, rule.ID, nil, payload)
+
+	rsp := events.NewCreateAlertRuleOK().WithPayload(payload)
+	return rsp
+}
+
+// Updates the alert rule.
+func (r *RestAPI) UpdateAlertRule(ctx context.Context, params events.UpdateAlertRuleParams) middleware.Responder {
+	if params.Rule == nil {
+		msg := "Missing alert rule"
+		rsp := events.NewUpdateAlertRuleDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	ruleBefore, err := dbmodel.GetAlertRule(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching alert rule with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := events.NewUpdateAlertRuleDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if ruleBefore == nil {
+		msg := fmt.Sprintf("Cannot find alert rule with ID %d", params.ID)
+		rsp := events.NewUpdateAlertRuleDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rule := alertRuleFromRestAPI(params.Rule)
+	rule.ID = params.ID
+	rule.CreatedAt = ruleBefore.CreatedAt
+	if err = rule.Validate(); err != nil {
+		msg := fmt.Sprintf("Invalid alert rule: %s", err)
+		rsp := events.NewUpdateAlertRuleDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	if err = dbmodel.UpdateAlertRule(r.DB, rule); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dbmodel.ErrNotExists) {
+			status = http.StatusNotFound
+		}
+		msg := fmt.Sprintf("Cannot update alert rule with ID %d", params.ID)
+		log.Error(err)
+		rsp := events.NewUpdateAlertRuleDefault(status).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	payload := alertRuleToRestAPI(rule)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetAlertRule, rule.ID, alertRuleToRestAPI(ruleBefore), payload)
+
+	rsp := events.NewUpdateAlertRuleOK().WithPayload(payload)
+	return rsp
+}
+
+// Deletes the alert rule and its alerts. Deleting a non-existing rule
+// is not an error.
+func (r *RestAPI) DeleteAlertRule(ctx context.Context, params events.DeleteAlertRuleParams) middleware.Responder {
+	rule, err := dbmodel.GetAlertRule(r.DB, params.ID)
+	if err == nil && rule == nil {
+		rsp := events.NewDeleteAlertRuleOK()
+		return rsp
+	}
+	if err == nil {
+		err = dbmodel.DeleteAlertRule(r.DB, params.ID)
+	}
+	if err != nil && !errors.Is(err, dbmodel.ErrNotExists) {
+		msg := fmt.Sprintf("Cannot delete alert rule with ID %d", params.ID)
+		log.Error(err)
+		rsp := events.NewDeleteAlertRuleDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	r.addAuditRecord(ctx, dbmodel.AuditTargetAlertRule, params.ID, alertRuleToRestAPI(rule), nil)
+
+	rsp := events.NewDeleteAlertRuleOK()
+	return rsp
+}
@@ -0,0 +1,223 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/events"
+)
+
+// Test converting the alert to the REST API format.
+func TestAlertToRestAPI(t *testing.T) {
+	subnetID := int64(3)
+	startedAt := time.Date(2023, 5, 10, 12, 0, 0, 0, time.UTC)
+	alert := &dbmodel.Alert{
+		ID:       1,
+		RuleID:   2,
+		Label:    "192.0.2.0/24",
+		SubnetID: &subnetID,
+		Value:    95,
+		Rule: &dbmodel.AlertRule{
+			Name:      "high utilization",
+			Metric:    dbmodel.AlertMetricSubnetAddressUtilization,
+			Operator:  dbmodel.AlertOperatorGreater,
+			Threshold: 90,
+			Severity:  dbmodel.EvWarning,
+		},
+		StartedAt: startedAt,
+	}
+	restAlert := alertToRestAPI(alert)
+	require.EqualValues(t, 1, restAlert.ID)
+	require.EqualValues(t, 2, restAlert.RuleID)
+	require.Equal(t, "high utilization", restAlert.RuleName)
+	require.Equal(t, dbmodel.AlertMetricSubnetAddressUtilization, restAlert.Metric)
+	require.Equal(t, ">", restAlert.Operator)
+	require.EqualValues(t, 90, restAlert.Threshold)
+	require.EqualValues(t, dbmodel.EvWarning, restAlert.Severity)
+	require.EqualValues(t, 3, restAlert.SubnetID)
+	require.EqualValues(t, 95, restAlert.Value)
+	require.Equal(t, "pending", restAlert.State)
+	require.Nil(t, restAlert.FiredAt)
+
+	alert.FiredAt = startedAt.Add(time.Minute)
+	restAlert = alertToRestAPI(alert)
+	require.Equal(t, "firing", restAlert.State)
+	require.NotNil(t, restAlert.FiredAt)
+	require.Equal(t, alert.FiredAt, time.Time(*restAlert.FiredAt))
+}
+
+// Test creating, getting, updating and deleting the alert rules over
+// the REST API.
+func TestAlertRulesCRUD(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, err := NewRestAPI(dbSettings, db, fa)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Create the rule.
+	rsp := rapi.CreateAlertRule(ctx, events.CreateAlertRuleParams{
+		Rule: &models.AlertRule{
+			Name:      "high utilization",
+			Metric:    dbmodel.AlertMetricSubnetAddressUtilization,
+			Operator:  dbmodel.AlertOperatorGreaterOrEqual,
+			Threshold: 90,
+			Duration:  300,
+			Severity:  dbmodel.EvWarning,
+			Enabled:   true,
+		},
+	})
+	require.IsType(t, &events.CreateAlertRuleOK{}, rsp)
+	created := rsp.(*events.CreateAlertRuleOK).Payload
+	require.NotZero(t, created.ID)
+	require.NotZero(t, created.CreatedAt)
+
+	// Invalid rule.
+	rsp = rapi.CreateAlertRule(ctx, events.CreateAlertRuleParams{
+		Rule: &models.AlertRule{
+			Name:     "invalid",
+			Metric:   "foo",
+			Operator: dbmodel.AlertOperatorGreater,
+		},
+	})
+	require.IsType(t, &events.CreateAlertRuleDefault{}, rsp)
+	defaultRsp := rsp.(*events.CreateAlertRuleDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Get the rule.
+	rsp = rapi.GetAlertRule(ctx, events.GetAlertRuleParams{ID: created.ID})
+	require.IsType(t, &events.GetAlertRuleOK{}, rsp)
+	rule := rsp.(*events.GetAlertRuleOK).Payload
+	require.Equal(t, "high utilization", rule.Name)
+	require.Equal(t, ">=", rule.Operator)
+	require.EqualValues(t, 300, rule.Duration)
+	require.True(t, rule.Enabled)
+
+	rsp = rapi.GetAlertRule(ctx, events.GetAlertRuleParams{ID: created.ID + 1})
+	require.IsType(t, &events.GetAlertRuleDefault{}, rsp)
+	getDefaultRsp := rsp.(*events.GetAlertRuleDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*getDefaultRsp))
+
+	// Update the rule.
+	rule.Threshold = 95
+	rule.Enabled = false
+	rsp = rapi.UpdateAlertRule(ctx, events.UpdateAlertRuleParams{
+		ID:   created.ID,
+		Rule: rule,
+	})
+	require.IsType(t, &events.UpdateAlertRuleOK{}, rsp)
+
+	rsp = rapi.UpdateAlertRule(ctx, events.UpdateAlertRuleParams{
+		ID:   created.ID + 1,
+		Rule: rule,
+	})
+	require.IsType(t, &events.UpdateAlertRuleDefault{}, rsp)
+	updateDefaultRsp := rsp.(*events.UpdateAlertRuleDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*updateDefaultRsp))
+
+	rule.Severity = 5
+	rsp = rapi.UpdateAlertRule(ctx, events.UpdateAlertRuleParams{
+		ID:   created.ID,
+		Rule: rule,
+	})
+	require.IsType(t, &events.UpdateAlertRuleDefault{}, rsp)
+	updateDefaultRsp = rsp.(*events.UpdateAlertRuleDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*updateDefaultRsp))
+
+	// List the rules.
+	rsp = rapi.GetAlertRules(ctx, events.GetAlertRulesParams{})
+	require.IsType(t, &events.GetAlertRulesOK{}, rsp)
+	rules := rsp.(*events.GetAlertRulesOK).Payload
+	require.EqualValues(t, 1, rules.Total)
+	require.Len(t, rules.Items, 1)
+	require.EqualValues(t, 95, rules.Items[0].Threshold)
+	require.False(t, rules.Items[0].Enabled)
+
+	// The changes are recorded in the audit trail.
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 10, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, records, 2)
+	require.Equal(t, dbmodel.AuditTargetAlertRule, records[0].TargetType)
+
+	// Delete the rule.
+	rsp = rapi.DeleteAlertRule(ctx, events.DeleteAlertRuleParams{ID: created.ID})
+	require.IsType(t, &events.DeleteAlertRuleOK{}, rsp)
+	rsp = rapi.DeleteAlertRule(ctx, events.DeleteAlertRuleParams{ID: created.ID})
+	require.IsType(t, &events.DeleteAlertRuleOK{}, rsp)
+
+	rsp = rapi.GetAlertRules(ctx, events.GetAlertRulesParams{})
+	require.IsType(t, &events.GetAlertRulesOK{}, rsp)
+	require.Empty(t, rsp.(*events.GetAlertRulesOK).Payload.Items)
+}
+
+// Test getting the alerts over the REST API.
+func TestGetAlerts(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	rule := &dbmodel.AlertRule{
+		Name:     "ha degraded",
+		Metric:   dbmodel.AlertMetricHADegradedServers,
+		Operator: dbmodel.AlertOperatorGreater,
+		Severity: dbmodel.EvError,
+		Enabled:  true,
+	}
+	err := dbmodel.AddAlertRule(db, rule)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	err = dbmodel.AddAlert(db, &dbmodel.Alert{
+		RuleID:    rule.ID,
+		Label:     "foo",
+		Value:     1,
+		StartedAt: now,
+	})
+	require.NoError(t, err)
+	err = dbmodel.AddAlert(db, &dbmodel.Alert{
+		RuleID:    rule.ID,
+		Label:     "bar",
+		Value:     2,
+		StartedAt: now,
+		FiredAt:   now,
+	})
+	require.NoError(t, err)
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, err := NewRestAPI(dbSettings, db, fa)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	rsp := rapi.GetAlerts(ctx, events.GetAlertsParams{})
+	require.IsType(t, &events.GetAlertsOK{}, rsp)
+	alerts := rsp.(*events.GetAlertsOK).Payload
+	require.EqualValues(t, 2, alerts.Total)
+	require.Len(t, alerts.Items, 2)
+	require.Equal(t, "foo", alerts.Items[0].Label)
+	require.Equal(t, "ha degraded", alerts.Items[0].RuleName)
+	require.Equal(t, "pending", alerts.Items[0].State)
+	require.Equal(t, "firing", alerts.Items[1].State)
+
+	state := "firing"
+	rsp = rapi.GetAlerts(ctx, events.GetAlertsParams{State: &state})
+	require.IsType(t, &events.GetAlertsOK{}, rsp)
+	alerts = rsp.(*events.GetAlertsOK).Payload
+	require.EqualValues(t, 1, alerts.Total)
+	require.Equal(t, "bar", alerts.Items[0].Label)
+
+	limit := int64(1)
+	rsp = rapi.GetAlerts(ctx, events.GetAlertsParams{Limit: &limit})
+	require.IsType(t, &events.GetAlertsOK{}, rsp)
+	alerts = rsp.(*events.GetAlertsOK).Payload
+	require.EqualValues(t, 2, alerts.Total)
+	require.Len(t, alerts.Items, 1)
+}
@@ -0,0 +1,292 @@
+package restservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	pkgerrors "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/events"
+	storkutil "isc.org/stork/util"
+)
+
+// Type of the context key holding the audit information about the request.
+type auditRequestInfoKeyType int
+
+// Context key holding the audit information about the request.
+const auditRequestInfoKey auditRequestInfoKeyType = iota
+
+// Information about the request stored in the audit records. It is
+// stored in the request context by the audit middleware.
+type auditRequestInfo struct {
+	operationID string
+	sourceIP    string
+	userID      int64
+	userLogin   string
+}
+
+// Converts the audited object to the decoded JSON form. The nil objects
+// (including nil pointers) are converted to nil.
+func normalizeAuditedObject(object interface{}) (interface{}, error) {
+	if object == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return nil, pkgerrors.Wrap(err, "problem encoding audited object")
+	}
+	var decoded interface{}
+	if err = json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, pkgerrors.Wrap(err, "problem decoding audited object")
+	}
+	return decoded, nil
+}
+
+// Returns the differences between the audited object before and after
+// the operation. The before object is nil when the object has been
+// created. The after object is nil when the object has been deleted.
+func diffAuditedObjects(before, after interface{}) ([]storkutil.JSONDiffChange, error) {
+	from, err := normalizeAuditedObject(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := normalizeAuditedObject(after)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case from == nil && to == nil:
+		return []storkutil.JSONDiffChange{}, nil
+	case from == nil:
+		return []storkutil.JSONDiffChange{
+			{Operation: storkutil.JSONDiffOperationAdd, NewValue: to},
+		}, nil
+	case to == nil:
+		return []storkutil.JSONDiffChange{
+			{Operation: storkutil.JSONDiffOperationRemove, OldValue: from},
+		}, nil
+	default:
+		return storkutil.DiffJSON(from, to), nil
+	}
+}
+
+// Writes the audit record of the operation modifying the specified object.
+// The before and after arguments hold the object before and after the
+// operation. They are converted to JSON and only their differences are
+// stored. The logged user, the source IP address and the REST API
+// operation ID are taken from the context populated by the audit
+// middleware. The audit record is not written when the differences
+// cannot be computed. The errors are logged because the audited operation
+// has already been completed.
+func (r *RestAPI) addAuditRecord(ctx context.Context, targetType dbmodel.AuditTargetType, targetID int64, before, after interface{}) {
+	record := &dbmodel.AuditRecord{
+		TargetType: targetType,
+		TargetID:   targetID,
+	}
+	if info, ok := ctx.Value(auditRequestInfoKey).(*auditRequestInfo); ok {
+		record.OperationID = info.operationID
+		record.SourceIP = info.sourceIP
+		record.UserID = info.userID
+		record.UserLogin = info.userLogin
+	}
+	changes, err := diffAuditedObjects(before, after)
+	if err != nil {
+		log.WithError(err).Errorf("Cannot create audit record of the %s change", targetType)
+		return
+	}
+	record.Changes = changes
+	if err = dbmodel.AddAuditRecord(r.DB, record); err != nil {
+		log.WithError(err).Errorf("Cannot store audit record of the %s change", targetType)
+	}
+}
+
+// Converts the audit record to the format used in REST API.
+func auditRecordToRestAPI(record *dbmodel.AuditRecord) *models.AuditRecord {
+	restRecord := &models.AuditRecord{
+		ID:          record.ID,
+		CreatedAt:   strfmt.DateTime(record.CreatedAt),
+		UserID:      record.UserID,
+		UserLogin:   record.UserLogin,
+		SourceIP:    record.SourceIP,
+		OperationID: record.OperationID,
+		TargetType:  string(record.TargetType),
+		TargetID:    record.TargetID,
+		Changes:     []*models.ConfigDiffChange{},
+	}
+	for _, change := range record.Changes {
+		restRecord.Changes = append(restRecord.Changes, &models.ConfigDiffChange{
+			Path:      change.Path,
+			Operation: string(change.Operation),
+			OldValue:  change.OldValue,
+			NewValue:  change.NewValue,
+		})
+	}
+	return restRecord
+}
+
+// Creates the audit record filters from the REST API parameters.
+func newAuditRecordFilters(user *int64, operation, targetType *string, targetID *int64, from, to *strfmt.DateTime) *dbmodel.AuditRecordFilters {
+	filters := &dbmodel.AuditRecordFilters{
+		UserID:      user,
+		OperationID: operation,
+		TargetType:  targetType,
+		TargetID:    targetID,
+	}
+	if from != nil {
+		fromTime := time.Time(*from).UTC()
+		filters.From = &fromTime
+	}
+	if to != nil {
+		toTime := time.Time(*to).UTC()
+		filters.To = &toTime
+	}
+	return filters
+}
+
+// Get the audit records with specifying an offset, a limit and the
+// filtering criteria.
+func (r *RestAPI) GetAuditRecords(ctx context.Context, params events.GetAuditRecordsParams) middleware.Responder {
+	var start int64
+	if params.Start != nil {
+		start = *params.Start
+	}
+
+	var limit int64 = 10
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	filters := newAuditRecordFilters(params.User, params.Operation, params.TargetType, params.TargetID, params.From, params.To)
+
+	dbRecords, total, err := dbmodel.GetAuditRecordsByPage(r.DB, start, limit, filters)
+	if err != nil {
+		msg := "Problem fetching audit records from the database"
+		log.Error(err)
+		rsp := events.NewGetAuditRecordsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	records := &models.AuditRecords{
+		Items: []*models.AuditRecord{},
+		Total: total,
+	}
+	for i := range dbRecords {
+		records.Items = append(records.Items, auditRecordToRestAPI(&dbRecords[i]))
+	}
+
+	rsp := events.NewGetAuditRecordsOK().WithPayload(records)
+	return rsp
+}
+
+// Writes the audit records in the CSV format. The changes are written
+// as a JSON list in the last column.
+func writeAuditRecordsCSV(w io.Writer, records []*models.AuditRecord) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"id", "created_at", "user_id", "user_login", "source_ip",
+		"operation_id", "target_type", "target_id", "changes",
+	})
+	if err != nil {
+		return pkgerrors.Wrap(err, "problem writing audit records header")
+	}
+	for _, record := range records {
+		changes, err := json.Marshal(record.Changes)
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem encoding changes of the audit record %d", record.ID)
+		}
+		err = writer.Write([]string{
+			strconv.FormatInt(record.ID, 10),
+			record.CreatedAt.String(),
+			strconv.FormatInt(record.UserID, 10),
+			record.UserLogin,
+			record.SourceIP,
+			record.OperationID,
+			record.TargetType,
+			strconv.FormatInt(record.TargetID, 10),
+			string(changes),
+		})
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem writing audit record %d", record.ID)
+		}
+	}
+	writer.Flush()
+	return pkgerrors.Wrap(writer.Error(), "problem writing audit records")
+}
+
+// Exports all audit records matching the filtering criteria to a file.
+// The file is in the CSV format unless the JSON format is requested.
+func (r *RestAPI) ExportAuditRecords(ctx context.Context, params events.ExportAuditRecordsParams) middleware.Responder {
+	format := "csv"
+	if params.Format != nil {
+		format = *params.Format
+	}
+	if format != "csv" && format != "json" {
+		msg := fmt.Sprintf("Unsupported audit records export format %s", format)
+		rsp := events.NewExportAuditRecordsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	filters := newAuditRecordFilters(params.User, params.Operation, params.TargetType, params.TargetID, params.From, params.To)
+
+	dbRecords, _, err := dbmodel.GetAuditRecordsByPage(r.DB, 0, 0, filters)
+	if err != nil {
+		msg := "Problem fetching audit records from the database"
+		log.Error(err)
+		rsp := events.NewExportAuditRecordsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	records := []*models.AuditRecord{}
+	for i := range dbRecords {
+		records = append(records, auditRecordToRestAPI(&dbRecords[i]))
+	}
+
+	var buffer bytes.Buffer
+	contentType := "text/csv"
+	if format == "json" {
+		contentType = "application/json"
+		err = json.NewEncoder(&buffer).Encode(records)
+	} else {
+		err = writeAuditRecordsCSV(&buffer, records)
+	}
+	if err != nil {
+		msg := "Problem exporting audit records"
+		log.Error(err)
+		rsp := events.NewExportAuditRecordsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	dispositionHeaderValue := fmt.Sprintf(
+		"attachment; filename=\"stork-audit-records_%s.%s\"",
+		strings.ReplaceAll(time.Now().UTC().Format(time.RFC3339), ":", "-"),
+		format,
+	)
+
+	rsp := events.
+		NewExportAuditRecordsOK().
+		WithContentType(contentType).
+		WithContentDisposition(dispositionHeaderValue).
+		WithPayload(io.NopCloser(&buffer))
+	return rsp
+}
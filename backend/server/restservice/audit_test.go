@@ -0,0 +1,246 @@
+package restservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/events"
+	"isc.org/stork/server/gen/restapi/operations/settings"
+	storktest "isc.org/stork/server/test/dbmodel"
+	storkutil "isc.org/stork/util"
+)
+
+// Test finding the differences between the audited objects.
+func TestDiffAuditedObjects(t *testing.T) {
+	type object struct {
+		Name  string
+		Value int
+	}
+
+	// Created object.
+	changes, err := diffAuditedObjects(nil, &object{Name: "foo", Value: 1})
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, storkutil.JSONDiffOperationAdd, changes[0].Operation)
+	require.Empty(t, changes[0].Path)
+	require.Nil(t, changes[0].OldValue)
+	require.Equal(t, map[string]interface{}{"Name": "foo", "Value": float64(1)}, changes[0].NewValue)
+
+	// Deleted object.
+	changes, err = diffAuditedObjects(&object{Name: "foo", Value: 1}, nil)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, storkutil.JSONDiffOperationRemove, changes[0].Operation)
+	require.Nil(t, changes[0].NewValue)
+
+	// Updated object.
+	changes, err = diffAuditedObjects(&object{Name: "foo", Value: 1}, &object{Name: "foo", Value: 2})
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, storkutil.JSONDiffOperationReplace, changes[0].Operation)
+	require.Equal(t, "/Value", changes[0].Path)
+	require.EqualValues(t, 1, changes[0].OldValue)
+	require.EqualValues(t, 2, changes[0].NewValue)
+
+	// Nil pointers are treated as no objects.
+	var nilObject *object
+	changes, err = diffAuditedObjects(nilObject, nil)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+
+	// Objects that cannot be converted to JSON.
+	_, err = diffAuditedObjects(nil, make(chan int))
+	require.Error(t, err)
+}
+
+// Test writing the audit records in the CSV format.
+func TestWriteAuditRecordsCSV(t *testing.T) {
+	records := []*models.AuditRecord{
+		{
+			ID:          1,
+			UserID:      2,
+			UserLogin:   "admin",
+			SourceIP:    "192.0.2.1",
+			OperationID: "updateSettings",
+			TargetType:  "settings",
+			Changes: []*models.ConfigDiffChange{
+				{
+					Path:      "/grafana_url",
+					Operation: "replace",
+					OldValue:  "",
+					NewValue:  "http://localhost:3000",
+				},
+			},
+		},
+	}
+	var buffer bytes.Buffer
+	err := writeAuditRecordsCSV(&buffer, records)
+	require.NoError(t, err)
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Len(t, rows[0], 9)
+	require.Equal(t, "id", rows[0][0])
+	require.Equal(t, "changes", rows[0][8])
+	require.Equal(t, "1", rows[1][0])
+	require.Equal(t, "2", rows[1][2])
+	require.Equal(t, "admin", rows[1][3])
+	require.Equal(t, "192.0.2.1", rows[1][4])
+	require.Equal(t, "updateSettings", rows[1][5])
+	require.Equal(t, "settings", rows[1][6])
+	require.Equal(t, "0", rows[1][7])
+	require.JSONEq(t, `[{"path": "/grafana_url", "operation": "replace", "oldValue": "", "newValue": "http://localhost:3000"}]`, rows[1][8])
+}
+
+// Test that the audit records are written for the changes made via the
+// REST API and that they can be listed and exported.
+func TestGetAndExportAuditRecords(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	fd := &storktest.FakeDispatcher{}
+	rapi, err := NewRestAPI(dbSettings, db, fa, fd)
+	require.NoError(t, err)
+
+	err = dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), auditRequestInfoKey, &auditRequestInfo{
+		operationID: "updateSettings",
+		sourceIP:    "192.0.2.1",
+		userID:      1,
+		userLogin:   "admin",
+	})
+
+	rsp := rapi.UpdateSettings(ctx, settings.UpdateSettingsParams{
+		Settings: &models.Settings{
+			Bind9StatsPullerInterval: 60,
+			GrafanaURL:               "http://localhost:3000",
+			KeaHostsPullerInterval:   60,
+			KeaStatsPullerInterval:   60,
+			KeaStatusPullerInterval:  30,
+			MetricsCollectorInterval: 10,
+		},
+	})
+	require.IsType(t, &settings.UpdateSettingsOK{}, rsp)
+
+	// The change made without the audit request information should
+	// also be recorded.
+	rsp = rapi.UpdateSettings(context.Background(), settings.UpdateSettingsParams{
+		Settings: &models.Settings{
+			Bind9StatsPullerInterval: 60,
+			GrafanaURL:               "http://localhost:3000",
+			KeaHostsPullerInterval:   60,
+			KeaStatsPullerInterval:   60,
+			KeaStatusPullerInterval:  30,
+			MetricsCollectorInterval: 10,
+			PrometheusURL:            "http://localhost:9090",
+		},
+	})
+	require.IsType(t, &settings.UpdateSettingsOK{}, rsp)
+
+	// Get all records.
+	rsp2 := rapi.GetAuditRecords(ctx, events.GetAuditRecordsParams{})
+	require.IsType(t, &events.GetAuditRecordsOK{}, rsp2)
+	okRsp2 := rsp2.(*events.GetAuditRecordsOK)
+	require.EqualValues(t, 2, okRsp2.Payload.Total)
+	require.Len(t, okRsp2.Payload.Items, 2)
+
+	// The most recent record goes first.
+	record := okRsp2.Payload.Items[1]
+	require.Equal(t, "updateSettings", record.OperationID)
+	require.Equal(t, "192.0.2.1", record.SourceIP)
+	require.EqualValues(t, 1, record.UserID)
+	require.Equal(t, "admin", record.UserLogin)
+	require.Equal(t, "settings", record.TargetType)
+	require.Zero(t, record.TargetID)
+	require.NotEmpty(t, record.Changes)
+
+	var grafanaChange *models.ConfigDiffChange
+	for _, change := range record.Changes {
+		if change.Path == "/grafana_url" {
+			grafanaChange = change
+		}
+	}
+	require.NotNil(t, grafanaChange)
+	require.Equal(t, "replace", grafanaChange.Operation)
+	require.Equal(t, "", grafanaChange.OldValue)
+	require.Equal(t, "http://localhost:3000", grafanaChange.NewValue)
+
+	record = okRsp2.Payload.Items[0]
+	require.Empty(t, record.OperationID)
+	require.Zero(t, record.UserID)
+	require.Len(t, record.Changes, 1)
+	require.Equal(t, "/prometheus_url", record.Changes[0].Path)
+
+	// Filter by user.
+	userID := int64(1)
+	rsp2 = rapi.GetAuditRecords(ctx, events.GetAuditRecordsParams{
+		User: &userID,
+	})
+	require.IsType(t, &events.GetAuditRecordsOK{}, rsp2)
+	okRsp2 = rsp2.(*events.GetAuditRecordsOK)
+	require.EqualValues(t, 1, okRsp2.Payload.Total)
+
+	// Filter by time.
+	from := strfmt.DateTime(storkutil.UTCNow().AddDate(0, 0, 1))
+	rsp2 = rapi.GetAuditRecords(ctx, events.GetAuditRecordsParams{
+		From: &from,
+	})
+	require.IsType(t, &events.GetAuditRecordsOK{}, rsp2)
+	okRsp2 = rsp2.(*events.GetAuditRecordsOK)
+	require.Zero(t, okRsp2.Payload.Total)
+	require.Empty(t, okRsp2.Payload.Items)
+
+	// Export the records to JSON.
+	format := "json"
+	rsp3 := rapi.ExportAuditRecords(ctx, events.ExportAuditRecordsParams{
+		Format: &format,
+	})
+	require.IsType(t, &events.ExportAuditRecordsOK{}, rsp3)
+	okRsp3 := rsp3.(*events.ExportAuditRecordsOK)
+	require.Equal(t, "application/json", okRsp3.ContentType)
+	require.Contains(t, okRsp3.ContentDisposition, ".json")
+	exported, err := io.ReadAll(okRsp3.Payload)
+	require.NoError(t, err)
+	var exportedRecords []*models.AuditRecord
+	err = json.Unmarshal(exported, &exportedRecords)
+	require.NoError(t, err)
+	require.Len(t, exportedRecords, 2)
+
+	// Export the records to CSV.
+	operation := "updateSettings"
+	rsp3 = rapi.ExportAuditRecords(ctx, events.ExportAuditRecordsParams{
+		Operation: &operation,
+	})
+	require.IsType(t, &events.ExportAuditRecordsOK{}, rsp3)
+	okRsp3 = rsp3.(*events.ExportAuditRecordsOK)
+	require.Equal(t, "text/csv", okRsp3.ContentType)
+	require.Contains(t, okRsp3.ContentDisposition, ".csv")
+	rows, err := csv.NewReader(okRsp3.Payload).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Equal(t, "updateSettings", rows[1][5])
+
+	// Unsupported format.
+	format = "xml"
+	rsp3 = rapi.ExportAuditRecords(ctx, events.ExportAuditRecordsParams{
+		Format: &format,
+	})
+	require.IsType(t, &events.ExportAuditRecordsDefault{}, rsp3)
+	defaultRsp3 := rsp3.(*events.ExportAuditRecordsDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp3))
+}
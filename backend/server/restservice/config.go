@@ -13,6 +13,7 @@ import (
 	dbmodel "isc.org/stork/server/database/model"
 	"isc.org/stork/server/gen/models"
 	"isc.org/stork/server/gen/restapi/operations/services"
+	storkutil "isc.org/stork/util"
 )
 
 // Get daemon config. Only Kea daemon supported.
@@ -324,6 +325,17 @@ func (r *RestAPI) PutDaemonConfigCheckerPreferences(ctx context.Context, params
 		return rsp
 	}
 
+	// Remember the checkers' state before the update for the audit trail.
+	metadataBefore, err := r.ReviewDispatcher.GetCheckersMetadata(daemon)
+	if err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot get checkers metadata for daemon (ID: %d, Name: %s)", daemon.ID, daemon.Name)
+		rsp := services.NewPutDaemonConfigCheckerPreferencesDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
 	var newOrUpdatedPreferences []*dbmodel.ConfigCheckerPreference
 	var deletedPreferences []*dbmodel.ConfigCheckerPreference
 	for _, change := range params.Changes.Items {
@@ -387,6 +399,7 @@ func (r *RestAPI) PutDaemonConfigCheckerPreferences(ctx context.Context, params
 	}
 
 	payload := convertConfigCheckerMetadataToRestAPI(metadata)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetConfigChecker, daemon.ID, convertConfigCheckerMetadataToRestAPI(metadataBefore), payload)
 
 	rsp := services.NewPutDaemonConfigCheckerPreferencesOK().WithPayload(payload)
 	return rsp
@@ -395,6 +408,17 @@ func (r *RestAPI) PutDaemonConfigCheckerPreferences(ctx context.Context, params
 // Modifies the global checker preferences. The changes are persistent.
 // It returns a list of actual global config checker metadata.
 func (r *RestAPI) PutGlobalConfigCheckerPreferences(ctx context.Context, params services.PutGlobalConfigCheckerPreferencesParams) middleware.Responder {
+	// Remember the checkers' state before the update for the audit trail.
+	metadataBefore, err := r.ReviewDispatcher.GetCheckersMetadata(nil)
+	if err != nil {
+		log.Error(err)
+		msg := "Cannot get global checkers metadata"
+		rsp := services.NewPutDaemonConfigCheckerPreferencesDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
 	var newOrUpdatedPreferences []*dbmodel.ConfigCheckerPreference
 	var deletedPreferences []*dbmodel.ConfigCheckerPreference
 
@@ -425,7 +449,7 @@ func (r *RestAPI) PutGlobalConfigCheckerPreferences(ctx context.Context, params
 		}
 	}
 
-	err := dbmodel.CommitCheckerPreferences(r.DB, newOrUpdatedPreferences, deletedPreferences)
+	err = dbmodel.CommitCheckerPreferences(r.DB, newOrUpdatedPreferences, deletedPreferences)
 	if err != nil {
 		log.Error(err)
 		msg := "Cannot commit the config checker changes into DB"
@@ -446,7 +470,151 @@ func (r *RestAPI) PutGlobalConfigCheckerPreferences(ctx context.Context, params
 	}
 
 	payload := convertConfigCheckerMetadataToRestAPI(metadata)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetConfigChecker, 0, convertConfigCheckerMetadataToRestAPI(metadataBefore), payload)
 
 	rsp := services.NewGetDaemonConfigCheckersOK().WithPayload(payload)
 	return rsp
 }
+
+// Converts the configuration snapshot to the format used in REST API.
+// The configuration is included when it is present in the snapshot.
+func configSnapshotToRestAPI(snapshot *dbmodel.ConfigSnapshot) *models.ConfigSnapshot {
+	restSnapshot := &models.ConfigSnapshot{
+		ID:         snapshot.ID,
+		DaemonID:   snapshot.DaemonID,
+		CreatedAt:  strfmt.DateTime(snapshot.CreatedAt),
+		ConfigHash: snapshot.ConfigHash,
+		Source:     string(snapshot.Source),
+	}
+	if snapshot.Config != nil && snapshot.Config.Map != nil {
+		restSnapshot.Config = snapshot.Config
+	}
+	return restSnapshot
+}
+
+// Fetches the daemon's configuration snapshot from the database. The
+// configuration sensitive data are hidden unless the logged user is a
+// super admin. It returns the HTTP error code and an error message when
+// the snapshot cannot be fetched or it doesn't belong to the daemon.
+func (r *RestAPI) getDaemonConfigSnapshot(ctx context.Context, daemonID, snapshotID int64) (*dbmodel.ConfigSnapshot, int, string) {
+	snapshot, err := dbmodel.GetConfigSnapshot(r.DB, snapshotID)
+	if err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot get configuration snapshot with ID %d from db", snapshotID)
+		return nil, http.StatusInternalServerError, msg
+	}
+	if snapshot == nil || snapshot.DaemonID != daemonID {
+		msg := fmt.Sprintf("Cannot find configuration snapshot with ID %d for daemon with ID %d", snapshotID, daemonID)
+		return nil, http.StatusNotFound, msg
+	}
+	_, dbUser := r.SessionManager.Logged(ctx)
+	if snapshot.Config != nil && snapshot.Config.Map != nil && !dbUser.InGroup(&dbmodel.SystemGroup{ID: dbmodel.SuperAdminGroupID}) {
+		snapshot.Config.HideSensitiveData()
+	}
+	return snapshot, 0, ""
+}
+
+// Get the configuration history of the specified daemon. The start and
+// limit values are optional. They are used to retrieve paged configuration
+// snapshots. If they are not specified, all snapshots are returned. The
+// returned snapshots lack the configurations.
+func (r *RestAPI) GetDaemonConfigSnapshots(ctx context.Context, params services.GetDaemonConfigSnapshotsParams) middleware.Responder {
+	start := int64(0)
+	if params.Start != nil {
+		start = *params.Start
+	}
+
+	limit := int64(0)
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	if start < 0 || limit < 0 {
+		msg := "Pagination start and limit must not be negative"
+		log.Error(msg)
+		rsp := services.NewGetDaemonConfigSnapshotsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	dbSnapshots, total, err := dbmodel.GetConfigSnapshotsByDaemonID(r.DB, start, limit, params.ID)
+	if err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot get configuration snapshots for daemon with ID %d from db", params.ID)
+		rsp := services.NewGetDaemonConfigSnapshotsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	snapshots := &models.ConfigSnapshots{
+		Items: []*models.ConfigSnapshot{},
+		Total: total,
+	}
+	for i := range dbSnapshots {
+		snapshots.Items = append(snapshots.Items, configSnapshotToRestAPI(&dbSnapshots[i]))
+	}
+
+	rsp := services.NewGetDaemonConfigSnapshotsOK().WithPayload(snapshots)
+	return rsp
+}
+
+// Get the specified configuration snapshot of the daemon including the
+// configuration.
+func (r *RestAPI) GetDaemonConfigSnapshot(ctx context.Context, params services.GetDaemonConfigSnapshotParams) middleware.Responder {
+	snapshot, code, msg := r.getDaemonConfigSnapshot(ctx, params.ID, params.SnapshotID)
+	if code != 0 {
+		rsp := services.NewGetDaemonConfigSnapshotDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rsp := services.NewGetDaemonConfigSnapshotOK().WithPayload(configSnapshotToRestAPI(snapshot))
+	return rsp
+}
+
+// Get the differences between the configurations captured in two
+// snapshots of the daemon. The returned snapshots lack the configurations.
+func (r *RestAPI) GetDaemonConfigDiff(ctx context.Context, params services.GetDaemonConfigDiffParams) middleware.Responder {
+	var snapshots []*dbmodel.ConfigSnapshot
+	for _, snapshotID := range []int64{params.From, params.To} {
+		snapshot, code, msg := r.getDaemonConfigSnapshot(ctx, params.ID, snapshotID)
+		if code != 0 {
+			rsp := services.NewGetDaemonConfigDiffDefault(code).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	var configs []interface{}
+	for _, snapshot := range snapshots {
+		var config interface{}
+		if snapshot.Config != nil && snapshot.Config.Map != nil {
+			config = map[string]interface{}(*snapshot.Config.Map)
+		}
+		configs = append(configs, config)
+		// Do not return the configurations because they can be large.
+		snapshot.Config = nil
+	}
+
+	diff := &models.ConfigDiff{
+		From:    configSnapshotToRestAPI(snapshots[0]),
+		To:      configSnapshotToRestAPI(snapshots[1]),
+		Changes: []*models.ConfigDiffChange{},
+	}
+	for _, change := range storkutil.DiffJSON(configs[0], configs[1]) {
+		diff.Changes = append(diff.Changes, &models.ConfigDiffChange{
+			Path:      change.Path,
+			Operation: string(change.Operation),
+			OldValue:  change.OldValue,
+			NewValue:  change.NewValue,
+		})
+	}
+
+	rsp := services.NewGetDaemonConfigDiffOK().WithPayload(diff)
+	return rsp
+}
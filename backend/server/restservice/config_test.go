@@ -1378,3 +1378,194 @@ func TestPutDaemonConfigCheckerPreferencesForMissingDaemon(t *testing.T) {
 	preferences, _ := dbmodel.GetCheckerPreferences(db, daemonID)
 	require.Empty(t, preferences)
 }
+
+// Test that the daemon's configuration history and the differences between
+// the configurations are returned.
+func TestGetDaemonConfigSnapshotsAndDiff(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	fd := &storktest.FakeDispatcher{}
+	rapi, err := NewRestAPI(dbSettings, db, fa, fd)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// setup a user session, it is required to check user role
+	user, err := dbmodel.GetUserByID(rapi.DB, 1)
+	require.NoError(t, err)
+	ctx, err = rapi.SessionManager.Load(ctx, "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	m := &dbmodel.Machine{
+		Address:   "localhost",
+		AgentPort: 8080,
+	}
+	err = dbmodel.AddMachine(db, m)
+	require.NoError(t, err)
+
+	app := &dbmodel.App{
+		MachineID: m.ID,
+		Type:      dbmodel.AppTypeKea,
+		Name:      "test-app",
+		Active:    true,
+		Daemons: []*dbmodel.Daemon{
+			dbmodel.NewKeaDaemon("dhcp4", true),
+		},
+	}
+	_, err = dbmodel.AddApp(db, app)
+	require.NoError(t, err)
+	daemon := app.Daemons[0]
+
+	// Add two configuration snapshots.
+	var snapshots []*dbmodel.ConfigSnapshot
+	for _, config := range []string{
+		`{"Dhcp4": {"valid-lifetime": 3600, "renew-timer": 900}}`,
+		`{"Dhcp4": {"valid-lifetime": 7200, "rebind-timer": 1800}}`,
+	} {
+		err = daemon.SetConfigFromJSON(config)
+		require.NoError(t, err)
+		snapshot, err := dbmodel.AddConfigSnapshotIfChanged(db, daemon, dbmodel.ConfigSnapshotSourceStatePuller)
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		snapshots = append(snapshots, snapshot)
+	}
+
+	// Get the configuration history.
+	params := services.GetDaemonConfigSnapshotsParams{
+		ID: daemon.ID,
+	}
+	rsp := rapi.GetDaemonConfigSnapshots(ctx, params)
+	require.IsType(t, &services.GetDaemonConfigSnapshotsOK{}, rsp)
+	okRsp := rsp.(*services.GetDaemonConfigSnapshotsOK)
+	require.EqualValues(t, 2, okRsp.Payload.Total)
+	require.Len(t, okRsp.Payload.Items, 2)
+	require.Equal(t, snapshots[1].ID, okRsp.Payload.Items[0].ID)
+	require.Equal(t, snapshots[0].ID, okRsp.Payload.Items[1].ID)
+	for _, item := range okRsp.Payload.Items {
+		require.Equal(t, daemon.ID, item.DaemonID)
+		require.Equal(t, "state_puller", item.Source)
+		require.NotEmpty(t, item.ConfigHash)
+		require.Nil(t, item.Config)
+	}
+
+	// Negative pagination parameters should be rejected.
+	negative := int64(-1)
+	for _, params := range []services.GetDaemonConfigSnapshotsParams{
+		{ID: daemon.ID, Start: &negative},
+		{ID: daemon.ID, Limit: &negative},
+	} {
+		rsp := rapi.GetDaemonConfigSnapshots(ctx, params)
+		require.IsType(t, &services.GetDaemonConfigSnapshotsDefault{}, rsp)
+		defaultRsp := rsp.(*services.GetDaemonConfigSnapshotsDefault)
+		require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+	}
+
+	// Get a single snapshot with the configuration.
+	params2 := services.GetDaemonConfigSnapshotParams{
+		ID:         daemon.ID,
+		SnapshotID: snapshots[0].ID,
+	}
+	rsp2 := rapi.GetDaemonConfigSnapshot(ctx, params2)
+	require.IsType(t, &services.GetDaemonConfigSnapshotOK{}, rsp2)
+	okRsp2 := rsp2.(*services.GetDaemonConfigSnapshotOK)
+	require.Equal(t, snapshots[0].ID, okRsp2.Payload.ID)
+	require.NotNil(t, okRsp2.Payload.Config)
+
+	// Get the differences between the configurations.
+	params3 := services.GetDaemonConfigDiffParams{
+		ID:   daemon.ID,
+		From: snapshots[0].ID,
+		To:   snapshots[1].ID,
+	}
+	rsp3 := rapi.GetDaemonConfigDiff(ctx, params3)
+	require.IsType(t, &services.GetDaemonConfigDiffOK{}, rsp3)
+	okRsp3 := rsp3.(*services.GetDaemonConfigDiffOK)
+	require.Equal(t, snapshots[0].ID, okRsp3.Payload.From.ID)
+	require.Equal(t, snapshots[1].ID, okRsp3.Payload.To.ID)
+	require.Nil(t, okRsp3.Payload.From.Config)
+	require.Nil(t, okRsp3.Payload.To.Config)
+	require.Len(t, okRsp3.Payload.Changes, 3)
+
+	require.Equal(t, "/Dhcp4/rebind-timer", okRsp3.Payload.Changes[0].Path)
+	require.Equal(t, "add", okRsp3.Payload.Changes[0].Operation)
+	require.EqualValues(t, 1800, okRsp3.Payload.Changes[0].NewValue)
+
+	require.Equal(t, "/Dhcp4/renew-timer", okRsp3.Payload.Changes[1].Path)
+	require.Equal(t, "remove", okRsp3.Payload.Changes[1].Operation)
+	require.EqualValues(t, 900, okRsp3.Payload.Changes[1].OldValue)
+
+	require.Equal(t, "/Dhcp4/valid-lifetime", okRsp3.Payload.Changes[2].Path)
+	require.Equal(t, "replace", okRsp3.Payload.Changes[2].Operation)
+	require.EqualValues(t, 3600, okRsp3.Payload.Changes[2].OldValue)
+	require.EqualValues(t, 7200, okRsp3.Payload.Changes[2].NewValue)
+}
+
+// Test that the configuration snapshot of another daemon or a non-existing
+// snapshot is not returned.
+func TestGetDaemonConfigSnapshotNotFound(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	fd := &storktest.FakeDispatcher{}
+	rapi, err := NewRestAPI(dbSettings, db, fa, fd)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	user, err := dbmodel.GetUserByID(rapi.DB, 1)
+	require.NoError(t, err)
+	ctx, err = rapi.SessionManager.Load(ctx, "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	m := &dbmodel.Machine{
+		Address:   "localhost",
+		AgentPort: 8080,
+	}
+	err = dbmodel.AddMachine(db, m)
+	require.NoError(t, err)
+
+	app := &dbmodel.App{
+		MachineID: m.ID,
+		Type:      dbmodel.AppTypeKea,
+		Name:      "test-app",
+		Active:    true,
+		Daemons: []*dbmodel.Daemon{
+			dbmodel.NewKeaDaemon("dhcp4", true),
+			dbmodel.NewKeaDaemon("dhcp6", true),
+		},
+	}
+	_, err = dbmodel.AddApp(db, app)
+	require.NoError(t, err)
+
+	err = app.Daemons[0].SetConfigFromJSON(`{"Dhcp4": {}}`)
+	require.NoError(t, err)
+	snapshot, err := dbmodel.AddConfigSnapshotIfChanged(db, app.Daemons[0], dbmodel.ConfigSnapshotSourceUserRequest)
+	require.NoError(t, err)
+	require.NotNil(t, snapshot)
+
+	// The snapshot belongs to another daemon.
+	params := services.GetDaemonConfigSnapshotParams{
+		ID:         app.Daemons[1].ID,
+		SnapshotID: snapshot.ID,
+	}
+	rsp := rapi.GetDaemonConfigSnapshot(ctx, params)
+	require.IsType(t, &services.GetDaemonConfigSnapshotDefault{}, rsp)
+	defaultRsp := rsp.(*services.GetDaemonConfigSnapshotDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+
+	// The snapshot doesn't exist.
+	params2 := services.GetDaemonConfigDiffParams{
+		ID:   app.Daemons[0].ID,
+		From: snapshot.ID,
+		To:   snapshot.ID + 1,
+	}
+	rsp2 := rapi.GetDaemonConfigDiff(ctx, params2)
+	require.IsType(t, &services.GetDaemonConfigDiffDefault{}, rsp2)
+	defaultRsp2 := rsp2.(*services.GetDaemonConfigDiffDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp2))
+}
@@ -0,0 +1,325 @@
+package restservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	log "github.com/sirupsen/logrus"
+	keaconfig "isc.org/stork/appcfg/kea"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+)
+
+// Converts the scheduled config change to the format used in REST API.
+// The recipes of the config updates may include daemons' configurations.
+// The sensitive data in the recipes are hidden when hideSensitiveData is
+// true. The recipes are modified in place.
+func configChangeToRestAPI(change *dbmodel.ScheduledConfigChange, hideSensitiveData bool) *models.ConfigChange {
+	restChange := &models.ConfigChange{
+		ID:                change.ID,
+		CreatedAt:         strfmt.DateTime(change.CreatedAt),
+		DeadlineAt:        strfmt.DateTime(change.DeadlineAt),
+		UserID:            change.UserID,
+		Executed:          change.Executed,
+		Error:             change.Error,
+		ApprovalStatus:    string(change.ApprovalStatus),
+		RequiredApprovals: change.RequiredApprovals,
+		Reviews:           []*models.ConfigChangeReview{},
+		Updates:           []*models.ConfigUpdate{},
+	}
+	if change.User != nil {
+		restChange.UserLogin = change.User.Login
+	}
+	for _, update := range change.Updates {
+		if hideSensitiveData {
+			recipe := keaconfig.Map(update.Recipe)
+			recipe.HideSensitiveData()
+		}
+		restChange.Updates = append(restChange.Updates, &models.ConfigUpdate{
+			Target:    update.Target,
+			Operation: update.Operation,
+			DaemonIds: update.DaemonIDs,
+			Recipe:    update.Recipe,
+		})
+	}
+	for _, review := range change.Reviews {
+		restReview := &models.ConfigChangeReview{
+			ID:        review.ID,
+			CreatedAt: strfmt.DateTime(review.CreatedAt),
+			UserID:    review.UserID,
+			Decision:  string(review.Decision),
+			Comment:   review.Comment,
+		}
+		if review.User != nil {
+			restReview.UserLogin = review.User.Login
+		}
+		if review.Decision == dbmodel.ScheduledConfigChangeReviewApprove {
+			restChange.Approvals++
+		}
+		restChange.Reviews = append(restChange.Reviews, restReview)
+	}
+	return restChange
+}
+
+// Wakes up the scheduler committing the scheduled config changes, so it
+// takes into account the added, approved or rescheduled change.
+func (r *RestAPI) wakeConfigChangeScheduler() {
+	if r.ConfigChangeScheduler != nil {
+		r.ConfigChangeScheduler.Wake()
+	}
+}
+
+// Adds the review of the scheduled config change made by the logged user
+// and returns the reviewed change. It returns the HTTP error code if an
+// error occurs or 0 when there is no error. In addition it returns an
+// error string to be included in the HTTP response or an empty string
+// if there is no error.
+func (r *RestAPI) commonReviewConfigChange(ctx context.Context, changeID int64, decision dbmodel.ScheduledConfigChangeReviewDecision, comment *models.ConfigChangeReviewComment) (*models.ConfigChange, int, string) {
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to review the config change because user is not logged in"
+		log.Error("problem with reviewing the config change because user has no session")
+		return nil, http.StatusForbidden, msg
+	}
+	review := &dbmodel.ScheduledConfigChangeReview{
+		ScheduledConfigChangeID: changeID,
+		UserID:                  int64(user.ID),
+		Decision:                decision,
+	}
+	if comment != nil {
+		review.Comment = comment.Comment
+	}
+	// Remember the change before the review for the audit trail.
+	changeBefore, err := dbmodel.GetScheduledConfigChange(r.DB, changeID)
+	if err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot get scheduled config change with ID %d from db", changeID)
+		return nil, http.StatusInternalServerError, msg
+	}
+	if err := dbmodel.AddScheduledConfigChangeReview(r.DB, review); err != nil {
+		log.Error(err)
+		switch {
+		case errors.Is(err, dbmodel.ErrNotExists):
+			msg := fmt.Sprintf("Cannot find scheduled config change with ID %d", changeID)
+			return nil, http.StatusNotFound, msg
+		case errors.Is(err, dbmodel.ErrScheduledConfigChangeReviewNotAllowed):
+			msg := fmt.Sprintf("Cannot review scheduled config change with ID %d: %s", changeID, err)
+			return nil, http.StatusConflict, msg
+		default:
+			msg := fmt.Sprintf("Problem with reviewing scheduled config change with ID %d", changeID)
+			return nil, http.StatusInternalServerError, msg
+		}
+	}
+	change, err := dbmodel.GetScheduledConfigChange(r.DB, changeID)
+	if err != nil || change == nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot get scheduled config change with ID %d from db", changeID)
+		return nil, http.StatusInternalServerError, msg
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetConfigChange, changeID, configChangeToRestAPI(changeBefore, true), configChangeToRestAPI(change, true))
+	return configChangeToRestAPI(change, !user.InGroup(&dbmodel.SystemGroup{ID: dbmodel.SuperAdminGroupID})), 0, ""
+}
+
+// Approves the scheduled config change. The change is committed when
+// its deadline expires only when it gathers the required number of
+// approvals.
+func (r *RestAPI) ApproveConfigChange(ctx context.Context, params dhcp.ApproveConfigChangeParams) middleware.Responder {
+	change, code, msg := r.commonReviewConfigChange(ctx, params.ID, dbmodel.ScheduledConfigChangeReviewApprove, params.Review)
+	if code != 0 {
+		rsp := dhcp.NewApproveConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// The approved change may be due already.
+	r.wakeConfigChangeScheduler()
+	rsp := dhcp.NewApproveConfigChangeOK().WithPayload(change)
+	return rsp
+}
+
+// Rejects the scheduled config change. The rejected change is never
+// committed.
+func (r *RestAPI) RejectConfigChange(ctx context.Context, params dhcp.RejectConfigChangeParams) middleware.Responder {
+	change, code, msg := r.commonReviewConfigChange(ctx, params.ID, dbmodel.ScheduledConfigChangeReviewReject, params.Review)
+	if code != 0 {
+		rsp := dhcp.NewRejectConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewRejectConfigChangeOK().WithPayload(change)
+	return rsp
+}
+
+// Adds a comment to the scheduled config change.
+func (r *RestAPI) CommentConfigChange(ctx context.Context, params dhcp.CommentConfigChangeParams) middleware.Responder {
+	if params.Review == nil || len(params.Review.Comment) == 0 {
+		msg := "Comment on the scheduled config change not specified"
+		rsp := dhcp.NewCommentConfigChangeDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	change, code, msg := r.commonReviewConfigChange(ctx, params.ID, dbmodel.ScheduledConfigChangeReviewComment, params.Review)
+	if code != 0 {
+		rsp := dhcp.NewCommentConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewCommentConfigChangeOK().WithPayload(change)
+	return rsp
+}
+
+// Get the scheduled config changes. The start and limit values are optional.
+// They are used to retrieve paged config changes. If they are not specified,
+// all config changes are returned. The executed flag selects executed or
+// pending config changes.
+func (r *RestAPI) GetConfigChanges(ctx context.Context, params dhcp.GetConfigChangesParams) middleware.Responder {
+	start := int64(0)
+	if params.Start != nil {
+		start = *params.Start
+	}
+
+	limit := int64(0)
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	dbChanges, total, err := dbmodel.GetScheduledConfigChangesByPage(r.DB, start, limit, params.Executed)
+	if err != nil {
+		log.Error(err)
+		msg := "Cannot get scheduled config changes from db"
+		rsp := dhcp.NewGetConfigChangesDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	_, dbUser := r.SessionManager.Logged(ctx)
+	hideSensitiveData := !dbUser.InGroup(&dbmodel.SystemGroup{ID: dbmodel.SuperAdminGroupID})
+
+	changes := &models.ConfigChanges{
+		Items: []*models.ConfigChange{},
+		Total: total,
+	}
+	for i := range dbChanges {
+		changes.Items = append(changes.Items, configChangeToRestAPI(&dbChanges[i], hideSensitiveData))
+	}
+
+	rsp := dhcp.NewGetConfigChangesOK().WithPayload(changes)
+	return rsp
+}
+
+// Fetches the scheduled config change from the database. It returns the
+// HTTP error code and an error message when the change cannot be fetched
+// or it doesn't exist. When the pending flag is set it also returns an
+// error when the change has already been executed.
+func (r *RestAPI) getConfigChange(changeID int64, pending bool) (*dbmodel.ScheduledConfigChange, int, string) {
+	change, err := dbmodel.GetScheduledConfigChange(r.DB, changeID)
+	if err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot get scheduled config change with ID %d from db", changeID)
+		return nil, http.StatusInternalServerError, msg
+	}
+	if change == nil {
+		msg := fmt.Sprintf("Cannot find scheduled config change with ID %d", changeID)
+		return nil, http.StatusNotFound, msg
+	}
+	if pending && change.Executed {
+		msg := fmt.Sprintf("Scheduled config change with ID %d has already been executed", changeID)
+		return nil, http.StatusConflict, msg
+	}
+	return change, 0, ""
+}
+
+// Get the scheduled config change by ID.
+func (r *RestAPI) GetConfigChange(ctx context.Context, params dhcp.GetConfigChangeParams) middleware.Responder {
+	change, code, msg := r.getConfigChange(params.ID, false)
+	if code != 0 {
+		rsp := dhcp.NewGetConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	_, dbUser := r.SessionManager.Logged(ctx)
+	hideSensitiveData := !dbUser.InGroup(&dbmodel.SystemGroup{ID: dbmodel.SuperAdminGroupID})
+
+	rsp := dhcp.NewGetConfigChangeOK().WithPayload(configChangeToRestAPI(change, hideSensitiveData))
+	return rsp
+}
+
+// Sets new deadline for the scheduled config change which hasn't been
+// executed yet. The change requiring approvals must be approved again.
+func (r *RestAPI) RescheduleConfigChange(ctx context.Context, params dhcp.RescheduleConfigChangeParams) middleware.Responder {
+	if params.Deadline == nil || params.Deadline.DeadlineAt == nil {
+		msg := "New deadline of the scheduled config change not specified"
+		rsp := dhcp.NewRescheduleConfigChangeDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	changeBefore, code, msg := r.getConfigChange(params.ID, true)
+	if code != 0 {
+		rsp := dhcp.NewRescheduleConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	deadline := time.Time(*params.Deadline.DeadlineAt).UTC()
+	if err := dbmodel.SetScheduledConfigChangeDeadline(r.DB, params.ID, deadline); err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot reschedule config change with ID %d", params.ID)
+		code := http.StatusInternalServerError
+		if errors.Is(err, dbmodel.ErrNotExists) {
+			// The change has been executed in the meantime.
+			code = http.StatusConflict
+		}
+		rsp := dhcp.NewRescheduleConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	change, code, msg := r.getConfigChange(params.ID, false)
+	if code != 0 {
+		rsp := dhcp.NewRescheduleConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetConfigChange, params.ID, configChangeToRestAPI(changeBefore, true), configChangeToRestAPI(change, true))
+	r.wakeConfigChangeScheduler()
+	_, dbUser := r.SessionManager.Logged(ctx)
+	hideSensitiveData := !dbUser.InGroup(&dbmodel.SystemGroup{ID: dbmodel.SuperAdminGroupID})
+
+	rsp := dhcp.NewRescheduleConfigChangeOK().WithPayload(configChangeToRestAPI(change, hideSensitiveData))
+	return rsp
+}
+
+// Cancels the scheduled config change which hasn't been executed yet.
+func (r *RestAPI) DeleteConfigChange(ctx context.Context, params dhcp.DeleteConfigChangeParams) middleware.Responder {
+	change, code, msg := r.getConfigChange(params.ID, true)
+	if code != 0 {
+		rsp := dhcp.NewDeleteConfigChangeDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if err := dbmodel.DeleteScheduledConfigChange(r.DB, params.ID); err != nil {
+		log.Error(err)
+		msg := fmt.Sprintf("Cannot delete scheduled config change with ID %d", params.ID)
+		rsp := dhcp.NewDeleteConfigChangeDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetConfigChange, params.ID, configChangeToRestAPI(change, true), nil)
+	rsp := dhcp.NewDeleteConfigChangeOK()
+	return rsp
+}
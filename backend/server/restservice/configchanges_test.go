@@ -0,0 +1,414 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	"isc.org/stork/server/apps"
+	appstest "isc.org/stork/server/apps/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storktest "isc.org/stork/server/test/dbmodel"
+	storkutil "isc.org/stork/util"
+)
+
+// Test converting the scheduled config change to the REST API format.
+func TestConfigChangeToRestAPI(t *testing.T) {
+	change := &dbmodel.ScheduledConfigChange{
+		ID:                1,
+		CreatedAt:         storkutil.UTCNow(),
+		DeadlineAt:        storkutil.UTCNow().Add(time.Hour),
+		UserID:            2,
+		ApprovalStatus:    dbmodel.ScheduledConfigChangeApprovalPending,
+		RequiredApprovals: 2,
+		Reviews: []*dbmodel.ScheduledConfigChangeReview{
+			{
+				ID:       1,
+				UserID:   3,
+				User:     &dbmodel.SystemUser{ID: 3, Login: "approver"},
+				Decision: dbmodel.ScheduledConfigChangeReviewApprove,
+			},
+			{
+				ID:       2,
+				UserID:   2,
+				Decision: dbmodel.ScheduledConfigChangeReviewComment,
+				Comment:  "thanks",
+			},
+		},
+	}
+	restChange := configChangeToRestAPI(change, false)
+	require.NotNil(t, restChange)
+	require.EqualValues(t, 1, restChange.ID)
+	require.EqualValues(t, 2, restChange.UserID)
+	require.Equal(t, "pending_approval", restChange.ApprovalStatus)
+	require.EqualValues(t, 2, restChange.RequiredApprovals)
+	require.EqualValues(t, 1, restChange.Approvals)
+	require.Len(t, restChange.Reviews, 2)
+	require.Equal(t, "approve", restChange.Reviews[0].Decision)
+	require.Equal(t, "approver", restChange.Reviews[0].UserLogin)
+	require.Equal(t, "comment", restChange.Reviews[1].Decision)
+	require.Equal(t, "thanks", restChange.Reviews[1].Comment)
+	require.Empty(t, restChange.Reviews[1].UserLogin)
+	require.Empty(t, restChange.Updates)
+}
+
+// Test that the sensitive data are hidden in the recipes of the config
+// updates when the conversion requires it.
+func TestConfigChangeToRestAPIHideSensitiveData(t *testing.T) {
+	newChange := func() *dbmodel.ScheduledConfigChange {
+		update := dbmodel.NewConfigUpdate("kea", "global_parameters_update", 1)
+		update.Recipe = map[string]interface{}{
+			"parameters": map[string]interface{}{
+				"password": "secret",
+			},
+		}
+		return &dbmodel.ScheduledConfigChange{
+			ID:         1,
+			UserID:     2,
+			User:       &dbmodel.SystemUser{ID: 2, Login: "owner"},
+			DeadlineAt: storkutil.UTCNow().Add(time.Hour),
+			Updates:    []*dbmodel.ConfigUpdate{update},
+		}
+	}
+
+	restChange := configChangeToRestAPI(newChange(), false)
+	require.Equal(t, "owner", restChange.UserLogin)
+	require.Len(t, restChange.Updates, 1)
+	require.Equal(t, "kea", restChange.Updates[0].Target)
+	require.Equal(t, "global_parameters_update", restChange.Updates[0].Operation)
+	require.EqualValues(t, []int64{1}, restChange.Updates[0].DaemonIds)
+	recipe := restChange.Updates[0].Recipe.(map[string]interface{})
+	require.Equal(t, "secret", recipe["parameters"].(map[string]interface{})["password"])
+
+	restChange = configChangeToRestAPI(newChange(), true)
+	require.Len(t, restChange.Updates, 1)
+	recipe = restChange.Updates[0].Recipe.(map[string]interface{})
+	require.Nil(t, recipe["parameters"].(map[string]interface{})["password"])
+}
+
+// Test approving, rejecting and commenting on the scheduled config changes.
+func TestReviewConfigChange(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	fd := &storktest.FakeDispatcher{}
+	rapi, err := NewRestAPI(dbSettings, db, fa, fd)
+	require.NoError(t, err)
+
+	// The admin schedules the changes.
+	admin, err := dbmodel.GetUserByID(db, 1)
+	require.NoError(t, err)
+	adminCtx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(adminCtx, admin)
+	require.NoError(t, err)
+
+	// Another user reviews them.
+	reviewer := &dbmodel.SystemUser{
+		Login:    "reviewer",
+		Lastname: "Smith",
+		Name:     "John",
+		Password: "pass",
+	}
+	_, err = dbmodel.CreateUser(db, reviewer)
+	require.NoError(t, err)
+	reviewerCtx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(reviewerCtx, reviewer)
+	require.NoError(t, err)
+
+	var changes []*dbmodel.ScheduledConfigChange
+	for i := 0; i < 2; i++ {
+		change := &dbmodel.ScheduledConfigChange{
+			DeadlineAt: storkutil.UTCNow().Add(time.Hour),
+			UserID:     int64(admin.ID),
+			Updates: []*dbmodel.ConfigUpdate{
+				dbmodel.NewConfigUpdate("kea", "host_add", 1),
+			},
+			ApprovalStatus:    dbmodel.ScheduledConfigChangeApprovalPending,
+			RequiredApprovals: 1,
+		}
+		err = dbmodel.AddScheduledConfigChange(db, change)
+		require.NoError(t, err)
+		changes = append(changes, change)
+	}
+
+	// The admin cannot approve own change.
+	rsp := rapi.ApproveConfigChange(adminCtx, dhcp.ApproveConfigChangeParams{
+		ID: changes[0].ID,
+	})
+	require.IsType(t, &dhcp.ApproveConfigChangeDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.ApproveConfigChangeDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp))
+
+	// The admin can comment on own change.
+	rsp2 := rapi.CommentConfigChange(adminCtx, dhcp.CommentConfigChangeParams{
+		ID: changes[0].ID,
+		Review: &models.ConfigChangeReviewComment{
+			Comment: "please approve",
+		},
+	})
+	require.IsType(t, &dhcp.CommentConfigChangeOK{}, rsp2)
+
+	// The comment must not be empty.
+	rsp2 = rapi.CommentConfigChange(adminCtx, dhcp.CommentConfigChangeParams{
+		ID:     changes[0].ID,
+		Review: &models.ConfigChangeReviewComment{},
+	})
+	require.IsType(t, &dhcp.CommentConfigChangeDefault{}, rsp2)
+	defaultRsp2 := rsp2.(*dhcp.CommentConfigChangeDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp2))
+
+	// The reviewer approves the first change.
+	rsp = rapi.ApproveConfigChange(reviewerCtx, dhcp.ApproveConfigChangeParams{
+		ID: changes[0].ID,
+		Review: &models.ConfigChangeReviewComment{
+			Comment: "approved",
+		},
+	})
+	require.IsType(t, &dhcp.ApproveConfigChangeOK{}, rsp)
+	okRsp := rsp.(*dhcp.ApproveConfigChangeOK)
+	require.Equal(t, "approved", okRsp.Payload.ApprovalStatus)
+	require.EqualValues(t, 1, okRsp.Payload.Approvals)
+	require.Len(t, okRsp.Payload.Reviews, 2)
+	require.Equal(t, "comment", okRsp.Payload.Reviews[0].Decision)
+	require.Equal(t, "approve", okRsp.Payload.Reviews[1].Decision)
+	require.Equal(t, "reviewer", okRsp.Payload.Reviews[1].UserLogin)
+
+	// The reviewer rejects the second change.
+	rsp3 := rapi.RejectConfigChange(reviewerCtx, dhcp.RejectConfigChangeParams{
+		ID: changes[1].ID,
+	})
+	require.IsType(t, &dhcp.RejectConfigChangeOK{}, rsp3)
+	okRsp3 := rsp3.(*dhcp.RejectConfigChangeOK)
+	require.Equal(t, "rejected", okRsp3.Payload.ApprovalStatus)
+
+	// The rejected change can't be approved.
+	rsp = rapi.ApproveConfigChange(reviewerCtx, dhcp.ApproveConfigChangeParams{
+		ID: changes[1].ID,
+	})
+	require.IsType(t, &dhcp.ApproveConfigChangeDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.ApproveConfigChangeDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp))
+
+	// Non-existing change.
+	rsp3 = rapi.RejectConfigChange(reviewerCtx, dhcp.RejectConfigChangeParams{
+		ID: changes[1].ID + 100,
+	})
+	require.IsType(t, &dhcp.RejectConfigChangeDefault{}, rsp3)
+	defaultRsp3 := rsp3.(*dhcp.RejectConfigChangeDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp3))
+}
+
+// Test that the due config change is executed after it is approved.
+func TestApproveConfigChangeExecutes(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	err := dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	fd := &storktest.FakeDispatcher{}
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:               db,
+		Agents:           fa,
+		DefLookup:        dbmodel.NewDHCPOptionDefinitionLookup(),
+		ReviewDispatcher: fd,
+	})
+	scheduler := apps.NewConfigChangeScheduler(db, cm)
+	defer scheduler.Shutdown()
+	rapi, err := NewRestAPI(dbSettings, db, fa, fd, cm, scheduler)
+	require.NoError(t, err)
+
+	admin, err := dbmodel.GetUserByID(db, 1)
+	require.NoError(t, err)
+	reviewer := &dbmodel.SystemUser{
+		Login:    "reviewer",
+		Lastname: "Smith",
+		Name:     "John",
+		Password: "pass",
+	}
+	_, err = dbmodel.CreateUser(db, reviewer)
+	require.NoError(t, err)
+	reviewerCtx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(reviewerCtx, reviewer)
+	require.NoError(t, err)
+
+	// The deadline of the change has expired but it awaits approval.
+	change := &dbmodel.ScheduledConfigChange{
+		DeadlineAt: storkutil.UTCNow().Add(-time.Minute),
+		UserID:     int64(admin.ID),
+		Updates: []*dbmodel.ConfigUpdate{
+			dbmodel.NewConfigUpdate("kea", "host_add", 1),
+		},
+		ApprovalStatus:    dbmodel.ScheduledConfigChangeApprovalPending,
+		RequiredApprovals: 1,
+	}
+	err = dbmodel.AddScheduledConfigChange(db, change)
+	require.NoError(t, err)
+
+	rsp := rapi.ApproveConfigChange(reviewerCtx, dhcp.ApproveConfigChangeParams{
+		ID: change.ID,
+	})
+	require.IsType(t, &dhcp.ApproveConfigChangeOK{}, rsp)
+
+	// The approved change should be executed right away.
+	require.Eventually(t, func() bool {
+		executed, err := dbmodel.GetScheduledConfigChange(db, change.ID)
+		return err == nil && executed != nil && executed.Executed
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+// Test listing, getting, rescheduling and cancelling the scheduled config
+// changes.
+func TestManageConfigChanges(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	fd := &storktest.FakeDispatcher{}
+	rapi, err := NewRestAPI(dbSettings, db, fa, fd)
+	require.NoError(t, err)
+
+	admin, err := dbmodel.GetUserByID(db, 1)
+	require.NoError(t, err)
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, admin)
+	require.NoError(t, err)
+
+	var changes []*dbmodel.ScheduledConfigChange
+	for i := 0; i < 3; i++ {
+		change := &dbmodel.ScheduledConfigChange{
+			DeadlineAt: storkutil.UTCNow().Add(time.Hour * time.Duration(i+1)),
+			UserID:     int64(admin.ID),
+			Updates: []*dbmodel.ConfigUpdate{
+				dbmodel.NewConfigUpdate("kea", "host_add", 1),
+			},
+		}
+		err = dbmodel.AddScheduledConfigChange(db, change)
+		require.NoError(t, err)
+		changes = append(changes, change)
+	}
+	err = dbmodel.SetScheduledConfigChangeExecuted(db, changes[0].ID, "")
+	require.NoError(t, err)
+
+	// List all changes.
+	rsp := rapi.GetConfigChanges(ctx, dhcp.GetConfigChangesParams{})
+	require.IsType(t, &dhcp.GetConfigChangesOK{}, rsp)
+	okRsp := rsp.(*dhcp.GetConfigChangesOK)
+	require.EqualValues(t, 3, okRsp.Payload.Total)
+	require.Len(t, okRsp.Payload.Items, 3)
+	require.Equal(t, changes[0].ID, okRsp.Payload.Items[0].ID)
+	require.Equal(t, "admin", okRsp.Payload.Items[0].UserLogin)
+	require.Len(t, okRsp.Payload.Items[0].Updates, 1)
+	require.Equal(t, "host_add", okRsp.Payload.Items[0].Updates[0].Operation)
+
+	// List pending changes.
+	executed := false
+	start := int64(1)
+	limit := int64(1)
+	rsp = rapi.GetConfigChanges(ctx, dhcp.GetConfigChangesParams{
+		Start:    &start,
+		Limit:    &limit,
+		Executed: &executed,
+	})
+	require.IsType(t, &dhcp.GetConfigChangesOK{}, rsp)
+	okRsp = rsp.(*dhcp.GetConfigChangesOK)
+	require.EqualValues(t, 2, okRsp.Payload.Total)
+	require.Len(t, okRsp.Payload.Items, 1)
+	require.Equal(t, changes[2].ID, okRsp.Payload.Items[0].ID)
+
+	// Get a single change.
+	rsp2 := rapi.GetConfigChange(ctx, dhcp.GetConfigChangeParams{
+		ID: changes[1].ID,
+	})
+	require.IsType(t, &dhcp.GetConfigChangeOK{}, rsp2)
+	okRsp2 := rsp2.(*dhcp.GetConfigChangeOK)
+	require.Equal(t, changes[1].ID, okRsp2.Payload.ID)
+	require.False(t, okRsp2.Payload.Executed)
+
+	// Non-existing change.
+	rsp2 = rapi.GetConfigChange(ctx, dhcp.GetConfigChangeParams{
+		ID: changes[2].ID + 100,
+	})
+	require.IsType(t, &dhcp.GetConfigChangeDefault{}, rsp2)
+	defaultRsp2 := rsp2.(*dhcp.GetConfigChangeDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp2))
+
+	// Reschedule the pending change.
+	deadline := strfmt.DateTime(storkutil.UTCNow().Add(time.Hour * 24).Truncate(time.Second))
+	rsp3 := rapi.RescheduleConfigChange(ctx, dhcp.RescheduleConfigChangeParams{
+		ID: changes[1].ID,
+		Deadline: &models.ConfigChangeDeadline{
+			DeadlineAt: &deadline,
+		},
+	})
+	require.IsType(t, &dhcp.RescheduleConfigChangeOK{}, rsp3)
+	okRsp3 := rsp3.(*dhcp.RescheduleConfigChangeOK)
+	require.Equal(t, time.Time(deadline), time.Time(okRsp3.Payload.DeadlineAt).UTC())
+
+	// The executed change can't be rescheduled.
+	rsp3 = rapi.RescheduleConfigChange(ctx, dhcp.RescheduleConfigChangeParams{
+		ID: changes[0].ID,
+		Deadline: &models.ConfigChangeDeadline{
+			DeadlineAt: &deadline,
+		},
+	})
+	require.IsType(t, &dhcp.RescheduleConfigChangeDefault{}, rsp3)
+	defaultRsp3 := rsp3.(*dhcp.RescheduleConfigChangeDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp3))
+
+	// The deadline must be specified.
+	rsp3 = rapi.RescheduleConfigChange(ctx, dhcp.RescheduleConfigChangeParams{
+		ID: changes[1].ID,
+	})
+	require.IsType(t, &dhcp.RescheduleConfigChangeDefault{}, rsp3)
+	defaultRsp3 = rsp3.(*dhcp.RescheduleConfigChangeDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp3))
+
+	// The executed change can't be cancelled.
+	rsp4 := rapi.DeleteConfigChange(ctx, dhcp.DeleteConfigChangeParams{
+		ID: changes[0].ID,
+	})
+	require.IsType(t, &dhcp.DeleteConfigChangeDefault{}, rsp4)
+	defaultRsp4 := rsp4.(*dhcp.DeleteConfigChangeDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp4))
+
+	// Cancel the pending change.
+	rsp4 = rapi.DeleteConfigChange(ctx, dhcp.DeleteConfigChangeParams{
+		ID: changes[1].ID,
+	})
+	require.IsType(t, &dhcp.DeleteConfigChangeOK{}, rsp4)
+
+	// Cancelling it again should fail.
+	rsp4 = rapi.DeleteConfigChange(ctx, dhcp.DeleteConfigChangeParams{
+		ID: changes[1].ID,
+	})
+	require.IsType(t, &dhcp.DeleteConfigChangeDefault{}, rsp4)
+	defaultRsp4 = rsp4.(*dhcp.DeleteConfigChangeDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp4))
+
+	returned, err := dbmodel.GetScheduledConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, returned, 2)
+
+	// Rescheduling and cancelling the change should be audited.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		require.Equal(t, dbmodel.AuditTargetConfigChange, record.TargetType)
+		require.Equal(t, changes[1].ID, record.TargetID)
+	}
+}
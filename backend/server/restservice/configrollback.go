@@ -0,0 +1,229 @@
+package restservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"isc.org/stork/server/config"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/services"
+)
+
+// Implements the POST call to create new transaction for restoring one of
+// the earlier configurations of the specified daemon (config-rollback/transaction).
+func (r *RestAPI) ConfigRollbackBegin(ctx context.Context, params services.ConfigRollbackBeginParams) middleware.Responder {
+	// Make sure that the daemon is specified.
+	if params.Daemon == nil || params.Daemon.DaemonID == 0 {
+		msg := "daemon for which configuration should be restored not specified"
+		log.Error(msg)
+		rsp := services.NewConfigRollbackBeginDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Get the logged user's ID.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to begin transaction because user is not logged in"
+		log.Error("problem with creating transaction context because user has no session")
+		rsp := services.NewConfigRollbackBeginDefault(http.StatusForbidden).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Create configuration context.
+	cctx, err := r.ConfigManager.CreateContext(int64(user.ID))
+	if err != nil {
+		msg := "problem with creating transaction context"
+		log.Error(err)
+		rsp := services.NewConfigRollbackBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Begin configuration rollback transaction. It retrieves the daemon and
+	// locks it for updates.
+	cctx, err = r.ConfigManager.GetKeaModule().BeginConfigRollback(cctx, params.Daemon.DaemonID)
+	if err != nil {
+		var (
+			daemonNotFound *config.DaemonNotFoundError
+			lock           *config.LockError
+		)
+		switch {
+		case errors.As(err, &daemonNotFound):
+			// Failed to find daemon.
+			msg := err.Error()
+			log.Error(err)
+			rsp := services.NewConfigRollbackBeginDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		case errors.As(err, &lock):
+			// Failed to lock daemon.
+			msg := err.Error()
+			log.Error(err)
+			rsp := services.NewConfigRollbackBeginDefault(http.StatusLocked).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		default:
+			// Other error.
+			msg := fmt.Sprintf("problem with initializing transaction for configuration rollback: %s", err)
+			log.Error(err)
+			rsp := services.NewConfigRollbackBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+	}
+	state, _ := config.GetTransactionState(cctx)
+	daemon := state.Updates[0].Recipe["daemon_before_rollback"].(dbmodel.Daemon)
+
+	// Get the daemon's configuration history.
+	dbSnapshots, _, err := dbmodel.GetConfigSnapshotsByDaemonID(r.DB, 0, 0, daemon.ID)
+	if err != nil {
+		r.ConfigManager.Done(cctx)
+		msg := fmt.Sprintf("problem with retrieving configuration snapshots for daemon with ID %d", daemon.ID)
+		log.Error(err)
+		rsp := services.NewConfigRollbackBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	snapshots := []*models.ConfigSnapshot{}
+	for i := range dbSnapshots {
+		snapshots = append(snapshots, configSnapshotToRestAPI(&dbSnapshots[i]))
+	}
+
+	// Retrieve the generated context ID.
+	cctxID, ok := config.GetValueAsInt64(cctx, config.ContextIDKey)
+	if !ok {
+		r.ConfigManager.Done(cctx)
+		msg := "problem with retrieving context ID for a transaction"
+		log.Error(msg)
+		rsp := services.NewConfigRollbackBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Remember the context, i.e. new transaction has been successfully created.
+	_ = r.ConfigManager.RememberContext(cctx, time.Minute*10)
+
+	// Return transaction ID, the daemon and its configuration snapshots
+	// to the user.
+	contents := &models.ConfigRollbackBeginResponse{
+		ID:        cctxID,
+		Daemon:    keaDaemonToRestAPI(&daemon),
+		Snapshots: snapshots,
+	}
+	rsp := services.NewConfigRollbackBeginOK().WithPayload(contents)
+	return rsp
+}
+
+// Applies and commits or schedules the configuration rollback within the
+// transaction having the specified ID. It returns the HTTP error code if
+// an error occurs or 0 when there is no error. In addition it returns an
+// error string to be included in the HTTP response or an empty string if
+// there is no error.
+func (r *RestAPI) commonConfigRollbackSubmit(ctx context.Context, transactionID int64, rollback *models.ConfigRollback) (int, string) {
+	// Make sure that the snapshot is specified.
+	if rollback == nil || rollback.SnapshotID == 0 {
+		msg := "configuration snapshot to be restored not specified"
+		log.Errorf(msg)
+		return http.StatusBadRequest, msg
+	}
+	// Get the user ID and recover the transaction context.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to submit because user is not logged in"
+		log.Error("problem with recovering transaction context because user has no session")
+		return http.StatusForbidden, msg
+	}
+	// Retrieve the context from the config manager.
+	cctx, _ := r.ConfigManager.RecoverContext(transactionID, int64(user.ID))
+	if cctx == nil {
+		msg := "transaction expired"
+		log.Errorf("problem with recovering transaction context for transaction ID %d and user ID %d", transactionID, user.ID)
+		return http.StatusNotFound, msg
+	}
+	// Get the snapshot holding the configuration to be restored.
+	snapshot, err := dbmodel.GetConfigSnapshot(r.DB, rollback.SnapshotID)
+	if err != nil {
+		msg := fmt.Sprintf("problem with retrieving configuration snapshot with ID %d", rollback.SnapshotID)
+		log.Error(err)
+		return http.StatusInternalServerError, msg
+	}
+	if snapshot == nil {
+		msg := fmt.Sprintf("cannot find configuration snapshot with ID %d", rollback.SnapshotID)
+		log.Error(msg)
+		return http.StatusBadRequest, msg
+	}
+	// Apply the rollback (create Kea commands).
+	cctx, err = r.ConfigManager.GetKeaModule().ApplyConfigRollback(cctx, snapshot)
+	if err != nil {
+		msg := fmt.Sprintf("problem with applying configuration rollback: %s", err)
+		log.Error(err)
+		return http.StatusBadRequest, msg
+	}
+	if rollback.Deadline != nil {
+		// Schedule the rollback for the specified time.
+		cctx, err = r.ConfigManager.Schedule(cctx, time.Time(*rollback.Deadline).UTC())
+		if err != nil {
+			msg := fmt.Sprintf("problem with scheduling configuration rollback: %s", err)
+			log.Error(err)
+			return http.StatusInternalServerError, msg
+		}
+		r.wakeConfigChangeScheduler()
+	} else {
+		// Test the configuration and send it to Kea server.
+		cctx, err = r.ConfigManager.Commit(cctx)
+		if err != nil {
+			msg := fmt.Sprintf("problem with committing configuration rollback: %s", err)
+			log.Error(err)
+			return http.StatusConflict, msg
+		}
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, snapshot.DaemonID, nil, rollback)
+	// Everything ok. Cleanup and send OK to the client.
+	r.ConfigManager.Done(cctx)
+	return 0, ""
+}
+
+// Implements the POST call to apply and commit the configuration rollback
+// (config-rollback/transaction/{id}/submit). The configuration is first
+// tested in the daemon. If the daemon rejects the configuration, the
+// Conflict status code is returned with the error reported by the daemon.
+// If the deadline is specified, the rollback is scheduled instead.
+func (r *RestAPI) ConfigRollbackSubmit(ctx context.Context, params services.ConfigRollbackSubmitParams) middleware.Responder {
+	code, msg := r.commonConfigRollbackSubmit(ctx, params.ID, params.Rollback)
+	if code != 0 {
+		// Error case.
+		rsp := services.NewConfigRollbackSubmitDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := services.NewConfigRollbackSubmitOK()
+	return rsp
+}
+
+// Implements the DELETE call to cancel the configuration rollback
+// (config-rollback/transaction/{id}). It removes the specified
+// transaction from the config manager, if the transaction exists.
+func (r *RestAPI) ConfigRollbackDelete(ctx context.Context, params services.ConfigRollbackDeleteParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateHostDelete(ctx, params.ID); code != 0 {
+		// Error case.
+		rsp := services.NewConfigRollbackDeleteDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := services.NewConfigRollbackDeleteOK()
+	return rsp
+}
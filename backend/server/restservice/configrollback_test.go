@@ -0,0 +1,240 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	apps "isc.org/stork/server/apps"
+	appstest "isc.org/stork/server/apps/test"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/services"
+	storktest "isc.org/stork/server/test/dbmodel"
+	storkutil "isc.org/stork/util"
+)
+
+// Creates the REST API with the config manager and the logged user, adds
+// the test hosts and two configuration snapshots of the first daemon. It
+// returns the API, the context with the user session, the daemon and the
+// snapshots.
+func newTestConfigRollbackAPI(t *testing.T, db *dbops.PgDB, dbSettings *dbops.DatabaseSettings, fa *agentcommtest.FakeAgents) (*RestAPI, context.Context, *dbmodel.Daemon, []*dbmodel.ConfigSnapshot) {
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	// The settings hold the number of approvals required by the scheduled
+	// config changes.
+	err = dbmodel.InitializeSettings(db, 0)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Log in the existing user because the scheduled config changes
+	// are associated with the user in the database.
+	user, err := dbmodel.GetUserByID(db, 1)
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, apps := storktest.AddTestHosts(t, db)
+	daemon, err := dbmodel.GetDaemonByID(db, apps[0].Daemons[0].ID)
+	require.NoError(t, err)
+
+	var snapshots []*dbmodel.ConfigSnapshot
+	for _, config := range []string{
+		`{"Dhcp4": {"valid-lifetime": 3600}}`,
+		`{"Dhcp4": {"valid-lifetime": 7200}}`,
+	} {
+		err = daemon.SetConfigFromJSON(config)
+		require.NoError(t, err)
+		snapshot, err := dbmodel.AddConfigSnapshotIfChanged(db, daemon, dbmodel.ConfigSnapshotSourceStatePuller)
+		require.NoError(t, err)
+		require.NotNil(t, snapshot)
+		snapshots = append(snapshots, snapshot)
+	}
+	return rapi, ctx, daemon, snapshots
+}
+
+// Test that the daemon's configuration can be restored via the transaction.
+func TestConfigRollbackBeginSubmit(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, ctx, daemon, snapshots := newTestConfigRollbackAPI(t, db, dbSettings, fa)
+
+	// Begin transaction and cancel it.
+	params := services.ConfigRollbackBeginParams{
+		Daemon: &models.ConfigRollbackDaemon{
+			DaemonID: daemon.ID,
+		},
+	}
+	rsp := rapi.ConfigRollbackBegin(ctx, params)
+	require.IsType(t, &services.ConfigRollbackBeginOK{}, rsp)
+	okRsp := rsp.(*services.ConfigRollbackBeginOK)
+	require.NotZero(t, okRsp.Payload.ID)
+
+	params2 := services.ConfigRollbackDeleteParams{
+		ID: okRsp.Payload.ID,
+	}
+	rsp2 := rapi.ConfigRollbackDelete(ctx, params2)
+	require.IsType(t, &services.ConfigRollbackDeleteOK{}, rsp2)
+
+	// Begin transaction again. The daemon should have been unlocked.
+	rsp = rapi.ConfigRollbackBegin(ctx, params)
+	require.IsType(t, &services.ConfigRollbackBeginOK{}, rsp)
+	okRsp = rsp.(*services.ConfigRollbackBeginOK)
+	contents := okRsp.Payload
+	require.NotZero(t, contents.ID)
+	require.NotNil(t, contents.Daemon)
+	require.Equal(t, daemon.ID, contents.Daemon.ID)
+	require.Len(t, contents.Snapshots, 2)
+	require.Equal(t, snapshots[1].ID, contents.Snapshots[0].ID)
+
+	// Restore the older configuration.
+	params3 := services.ConfigRollbackSubmitParams{
+		ID: contents.ID,
+		Rollback: &models.ConfigRollback{
+			SnapshotID: snapshots[0].ID,
+		},
+	}
+	rsp3 := rapi.ConfigRollbackSubmit(ctx, params3)
+	require.IsType(t, &services.ConfigRollbackSubmitOK{}, rsp3)
+
+	// The configuration should have been tested and restored.
+	require.Len(t, fa.RecordedCommands, 3)
+	expected := []string{"config-test", "config-set", "config-write"}
+	for i, c := range fa.RecordedCommands {
+		require.Equal(t, expected[i], c.GetCommand())
+	}
+	require.JSONEq(t, `{
+        "command": "config-set",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "Dhcp4": {
+                "valid-lifetime": 3600
+            }
+        }
+    }`, fa.RecordedCommands[1].Marshal())
+}
+
+// Test that the configuration rollback can be scheduled.
+func TestConfigRollbackSubmitScheduled(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, ctx, daemon, snapshots := newTestConfigRollbackAPI(t, db, dbSettings, fa)
+
+	params := services.ConfigRollbackBeginParams{
+		Daemon: &models.ConfigRollbackDaemon{
+			DaemonID: daemon.ID,
+		},
+	}
+	rsp := rapi.ConfigRollbackBegin(ctx, params)
+	require.IsType(t, &services.ConfigRollbackBeginOK{}, rsp)
+	okRsp := rsp.(*services.ConfigRollbackBeginOK)
+
+	deadline := strfmt.DateTime(storkutil.UTCNow().Add(time.Hour))
+	params2 := services.ConfigRollbackSubmitParams{
+		ID: okRsp.Payload.ID,
+		Rollback: &models.ConfigRollback{
+			SnapshotID: snapshots[0].ID,
+			Deadline:   &deadline,
+		},
+	}
+	rsp2 := rapi.ConfigRollbackSubmit(ctx, params2)
+	require.IsType(t, &services.ConfigRollbackSubmitOK{}, rsp2)
+
+	// No commands should have been sent yet.
+	require.Empty(t, fa.RecordedCommands)
+
+	// The rollback should have been scheduled.
+	changes, err := dbmodel.GetScheduledConfigChanges(db)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Len(t, changes[0].Updates, 1)
+	require.Equal(t, "config_rollback", changes[0].Updates[0].Operation)
+	require.Equal(t, []int64{daemon.ID}, changes[0].Updates[0].DaemonIDs)
+
+	// The daemon should be unlocked.
+	rsp = rapi.ConfigRollbackBegin(ctx, params)
+	require.IsType(t, &services.ConfigRollbackBeginOK{}, rsp)
+}
+
+// Test that the snapshot of another daemon cannot be used in the rollback.
+func TestConfigRollbackSubmitOtherDaemonSnapshot(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, ctx, _, snapshots := newTestConfigRollbackAPI(t, db, dbSettings, fa)
+
+	apps, err := dbmodel.GetAllApps(db, true)
+	require.NoError(t, err)
+	require.NotEmpty(t, apps)
+	otherDaemonID := apps[len(apps)-1].Daemons[0].ID
+	require.NotEqual(t, snapshots[0].DaemonID, otherDaemonID)
+
+	params := services.ConfigRollbackBeginParams{
+		Daemon: &models.ConfigRollbackDaemon{
+			DaemonID: otherDaemonID,
+		},
+	}
+	rsp := rapi.ConfigRollbackBegin(ctx, params)
+	require.IsType(t, &services.ConfigRollbackBeginOK{}, rsp)
+	okRsp := rsp.(*services.ConfigRollbackBeginOK)
+	require.Empty(t, okRsp.Payload.Snapshots)
+
+	params2 := services.ConfigRollbackSubmitParams{
+		ID: okRsp.Payload.ID,
+		Rollback: &models.ConfigRollback{
+			SnapshotID: snapshots[0].ID,
+		},
+	}
+	rsp2 := rapi.ConfigRollbackSubmit(ctx, params2)
+	require.IsType(t, &services.ConfigRollbackSubmitDefault{}, rsp2)
+	defaultRsp := rsp2.(*services.ConfigRollbackSubmitDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+	require.Empty(t, fa.RecordedCommands)
+}
+
+// Test error case when a user attempts to begin a transaction for
+// restoring the configuration of a non-existing daemon.
+func TestConfigRollbackBeginNonExistingDaemon(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, ctx, _, _ := newTestConfigRollbackAPI(t, db, dbSettings, fa)
+
+	params := services.ConfigRollbackBeginParams{
+		Daemon: &models.ConfigRollbackDaemon{
+			DaemonID: 1000,
+		},
+	}
+	rsp := rapi.ConfigRollbackBegin(ctx, params)
+	require.IsType(t, &services.ConfigRollbackBeginDefault{}, rsp)
+	defaultRsp := rsp.(*services.ConfigRollbackBeginDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
@@ -27,11 +27,14 @@ func (r *RestAPI) getEvents(offset, limit int64, level int64, daemonType *string
 	// Convert events fetched from the database to REST.
 	for _, dbEvent := range dbEvents {
 		event := models.Event{
-			ID:        dbEvent.ID,
-			CreatedAt: strfmt.DateTime(dbEvent.CreatedAt),
-			Text:      dbEvent.Text,
-			Level:     int64(dbEvent.Level),
-			Details:   dbEvent.Details,
+			ID:         dbEvent.ID,
+			CreatedAt:  strfmt.DateTime(dbEvent.CreatedAt),
+			Text:       dbEvent.Text,
+			Level:      int64(dbEvent.Level),
+			Details:    dbEvent.Details,
+			Count:      dbEvent.Count,
+			LastSeenAt: strfmt.DateTime(dbEvent.LastSeenAt),
+			ResolvesID: dbEvent.ResolvesID,
 		}
 		events.Items = append(events.Items, &event)
 	}
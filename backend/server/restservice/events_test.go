@@ -43,3 +43,44 @@ func TestEvents(t *testing.T) {
 	require.EqualValues(t, "some event", ev2.Text)
 	require.EqualValues(t, dbmodel.EvInfo, ev2.Level)
 }
+
+// Check that the number of occurrences of the event, the time when it was
+// last seen and the resolved event are returned.
+func TestEventsOccurrences(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	failure := &dbmodel.Event{
+		Text:  "failure",
+		Level: dbmodel.EvError,
+		Count: 3,
+	}
+	err := dbmodel.AddEvent(db, failure)
+	require.NoError(t, err)
+	recovery := &dbmodel.Event{
+		Text:       "recovery",
+		Level:      dbmodel.EvWarning,
+		ResolvesID: failure.ID,
+	}
+	err = dbmodel.AddEvent(db, recovery)
+	require.NoError(t, err)
+
+	rapi, err := NewRestAPI(dbSettings, db)
+	require.NoError(t, err)
+
+	rsp := rapi.GetEvents(context.Background(), events.GetEventsParams{})
+	require.IsType(t, &events.GetEventsOK{}, rsp)
+	items := rsp.(*events.GetEventsOK).Payload.Items
+	require.Len(t, items, 2)
+	for _, item := range items {
+		switch item.Text {
+		case "failure":
+			require.EqualValues(t, 3, item.Count)
+			require.Zero(t, item.ResolvesID)
+		case "recovery":
+			require.EqualValues(t, 1, item.Count)
+			require.Equal(t, failure.ID, item.ResolvesID)
+		}
+		require.NotZero(t, item.LastSeenAt)
+	}
+}
@@ -0,0 +1,296 @@
+package restservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	keaconfig "isc.org/stork/appcfg/kea"
+	"isc.org/stork/server/config"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+)
+
+// Converts the global parameters of the daemon to the format used in REST
+// API. The parameters exclude the subnets, shared networks and host
+// reservations which are managed using other calls. The sensitive data
+// are hidden. The daemon's configuration is not modified.
+func globalParametersToRestAPI(daemon *dbmodel.Daemon) (*models.DaemonGlobalParameters, error) {
+	// Create a deep copy of the configuration so the sensitive data can be
+	// hidden without affecting the daemon's configuration.
+	raw, err := json.Marshal(daemon.KeaDaemon.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem serializing configuration of the daemon %d", daemon.ID)
+	}
+	cfg, err := keaconfig.NewFromJSON(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	cfg.HideSensitiveData()
+
+	parameters := make(map[string]any)
+	if rootName, ok := cfg.GetRootName(); ok {
+		if rootNode, ok := (*cfg)[rootName].(map[string]any); ok {
+			for key, value := range rootNode {
+				switch key {
+				case "subnet4", "subnet6", "shared-networks", "reservations":
+					continue
+				}
+				parameters[key] = value
+			}
+		}
+	}
+	return &models.DaemonGlobalParameters{
+		Daemon:     keaDaemonToRestAPI(daemon),
+		Parameters: parameters,
+	}, nil
+}
+
+// Returns the global parameters in the format stored in the audit trail.
+// It returns a copy of the parameters with the sensitive data hidden.
+func globalParametersToAuditState(parameters map[string]any) (map[string]any, error) {
+	raw, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem serializing global parameters")
+	}
+	cfg, err := keaconfig.NewFromJSON(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	cfg.HideSensitiveData()
+	return *cfg, nil
+}
+
+// Writes the audit records of the global parameters update in the daemons.
+// The recorded state before the update includes only the parameters that
+// have been updated.
+func (r *RestAPI) addGlobalParametersAuditRecords(ctx context.Context, daemons []dbmodel.Daemon, parameters map[string]any) {
+	parametersAfter, err := globalParametersToAuditState(parameters)
+	if err != nil {
+		log.WithError(err).Error("Cannot create audit records of the global parameters update")
+		return
+	}
+	for i := range daemons {
+		parametersBefore := make(map[string]any)
+		restParameters, err := globalParametersToRestAPI(&daemons[i])
+		if err != nil {
+			log.WithError(err).Errorf("Cannot create audit record of the global parameters update in daemon %d", daemons[i].ID)
+			continue
+		}
+		if daemonParameters, ok := restParameters.Parameters.(map[string]any); ok {
+			for key := range parameters {
+				if value, ok := daemonParameters[key]; ok {
+					parametersBefore[key] = value
+				}
+			}
+		}
+		r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, daemons[i].ID, parametersBefore, parametersAfter)
+	}
+}
+
+// Implements the POST call to create new transaction for updating global
+// parameters of the specified daemons (global-parameters/transaction).
+func (r *RestAPI) UpdateGlobalParametersBegin(ctx context.Context, params dhcp.UpdateGlobalParametersBeginParams) middleware.Responder {
+	// Make sure that the daemons are specified.
+	if params.Daemons == nil || len(params.Daemons.DaemonIds) == 0 {
+		msg := "daemons for which global parameters should be updated not specified"
+		log.Error(msg)
+		rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Get the logged user's ID.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to begin transaction because user is not logged in"
+		log.Error("problem with creating transaction context because user has no session")
+		rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusForbidden).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Create configuration context.
+	cctx, err := r.ConfigManager.CreateContext(int64(user.ID))
+	if err != nil {
+		msg := "problem with creating transaction context"
+		log.Error(err)
+		rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Begin global parameters update transaction. It retrieves current daemons'
+	// configurations and locks the daemons for updates.
+	cctx, err = r.ConfigManager.GetKeaModule().BeginGlobalParametersUpdate(cctx, params.Daemons.DaemonIds)
+	if err != nil {
+		var (
+			daemonNotFound *config.DaemonNotFoundError
+			lock           *config.LockError
+		)
+		switch {
+		case errors.As(err, &daemonNotFound):
+			// Failed to find daemon.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		case errors.As(err, &lock):
+			// Failed to lock daemons.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusLocked).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		default:
+			// Other error.
+			msg := fmt.Sprintf("problem with initializing transaction for global parameters update: %s", err)
+			log.Error(err)
+			rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+	}
+	state, _ := config.GetTransactionState(cctx)
+	daemons := state.Updates[0].Recipe["daemons_before_update"].([]dbmodel.Daemon)
+
+	// Convert the daemons and their global parameters to REST API format.
+	respDaemons := []*models.DaemonGlobalParameters{}
+	for i := range daemons {
+		respDaemon, err := globalParametersToRestAPI(&daemons[i])
+		if err != nil {
+			r.ConfigManager.Done(cctx)
+			msg := "problem with retrieving global parameters of the daemons"
+			log.Error(err)
+			rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		respDaemons = append(respDaemons, respDaemon)
+	}
+
+	// Retrieve the generated context ID.
+	cctxID, ok := config.GetValueAsInt64(cctx, config.ContextIDKey)
+	if !ok {
+		r.ConfigManager.Done(cctx)
+		msg := "problem with retrieving context ID for a transaction"
+		log.Error(msg)
+		rsp := dhcp.NewUpdateGlobalParametersBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Remember the context, i.e. new transaction has been successfully created.
+	_ = r.ConfigManager.RememberContext(cctx, time.Minute*10)
+
+	// Return transaction ID and the daemons with their global parameters
+	// to the user.
+	contents := &models.UpdateGlobalParametersBeginResponse{
+		ID:      cctxID,
+		Daemons: respDaemons,
+	}
+	rsp := dhcp.NewUpdateGlobalParametersBeginOK().WithPayload(contents)
+	return rsp
+}
+
+// Applies and commits the global parameters within the transaction having
+// the specified ID. It returns the HTTP error code if an error occurs or 0
+// when there is no error. In addition it returns an error string to be
+// included in the HTTP response or an empty string if there is no error.
+func (r *RestAPI) commonUpdateGlobalParametersSubmit(ctx context.Context, transactionID int64, restParameters *models.EditedGlobalParameters) (int, string) {
+	// Make sure that the global parameters are present.
+	if restParameters == nil || restParameters.Parameters == nil {
+		msg := "global parameters not specified"
+		log.Errorf(msg)
+		return http.StatusBadRequest, msg
+	}
+	parameters, ok := restParameters.Parameters.(map[string]any)
+	if !ok {
+		msg := "global parameters must be a map"
+		log.Errorf(msg)
+		return http.StatusBadRequest, msg
+	}
+	// Get the user ID and recover the transaction context.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to submit because user is not logged in"
+		log.Error("problem with recovering transaction context because user has no session")
+		return http.StatusForbidden, msg
+	}
+	// Retrieve the context from the config manager.
+	cctx, _ := r.ConfigManager.RecoverContext(transactionID, int64(user.ID))
+	if cctx == nil {
+		msg := "transaction expired"
+		log.Errorf("problem with recovering transaction context for transaction ID %d and user ID %d", transactionID, user.ID)
+		return http.StatusNotFound, msg
+	}
+	// Remember the daemons before the update for the audit trail.
+	var daemonsBefore []dbmodel.Daemon
+	if daemonsIface, err := config.GetValueForUpdate(cctx, 0, "daemons_before_update"); err == nil {
+		daemonsBefore, _ = daemonsIface.([]dbmodel.Daemon)
+	}
+	// Apply the global parameters (create Kea commands).
+	cctx, err := r.ConfigManager.GetKeaModule().ApplyGlobalParametersUpdate(cctx, parameters)
+	if err != nil {
+		msg := fmt.Sprintf("problem with applying global parameters: %s", err)
+		log.Error(err)
+		r.ConfigManager.Done(cctx)
+		return http.StatusBadRequest, msg
+	}
+	// Test the configurations and send them to Kea servers.
+	cctx, err = r.ConfigManager.Commit(cctx)
+	if err != nil {
+		msg := fmt.Sprintf("problem with committing global parameters: %s", err)
+		log.Error(err)
+		r.ConfigManager.Done(cctx)
+		return http.StatusConflict, msg
+	}
+	r.addGlobalParametersAuditRecords(ctx, daemonsBefore, parameters)
+	// Everything ok. Cleanup and send OK to the client.
+	r.ConfigManager.Done(cctx)
+	return 0, ""
+}
+
+// Implements the POST call to apply and commit updated global parameters
+// (global-parameters/transaction/{id}/submit). The new configurations are
+// first tested in all daemons. If any of the daemons rejects its new
+// configuration, the update is aborted and the Conflict status code is
+// returned with the error reported by the daemon.
+func (r *RestAPI) UpdateGlobalParametersSubmit(ctx context.Context, params dhcp.UpdateGlobalParametersSubmitParams) middleware.Responder {
+	code, msg := r.commonUpdateGlobalParametersSubmit(ctx, params.ID, params.GlobalParameters)
+	if code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateGlobalParametersSubmitDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewUpdateGlobalParametersSubmitOK()
+	return rsp
+}
+
+// Implements the DELETE call to cancel updating global parameters
+// (global-parameters/transaction/{id}). It removes the specified
+// transaction from the config manager, if the transaction exists.
+func (r *RestAPI) UpdateGlobalParametersDelete(ctx context.Context, params dhcp.UpdateGlobalParametersDeleteParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateHostDelete(ctx, params.ID); code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateGlobalParametersDeleteDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewUpdateGlobalParametersDeleteOK()
+	return rsp
+}
@@ -0,0 +1,333 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	keactrl "isc.org/stork/appctrl/kea"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	apps "isc.org/stork/server/apps"
+	appstest "isc.org/stork/server/apps/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storktest "isc.org/stork/server/test/dbmodel"
+)
+
+// Test conversion of the daemon's global parameters to the REST API
+// format. The subnets and sensitive data should be excluded.
+func TestGlobalParametersToRestAPI(t *testing.T) {
+	daemon := &dbmodel.Daemon{
+		ID:   1,
+		Name: "dhcp4",
+		App: &dbmodel.App{
+			ID:   2,
+			Name: "kea@192.0.2.1",
+		},
+		KeaDaemon: &dbmodel.KeaDaemon{},
+	}
+	err := daemon.SetConfigFromJSON(`{
+        "Dhcp4": {
+            "valid-lifetime": 3600,
+            "lease-database": {
+                "type": "postgresql",
+                "password": "secret"
+            },
+            "subnet4": [
+                {
+                    "id": 1,
+                    "subnet": "192.0.2.0/24"
+                }
+            ]
+        }
+    }`)
+	require.NoError(t, err)
+
+	parameters, err := globalParametersToRestAPI(daemon)
+	require.NoError(t, err)
+	require.NotNil(t, parameters)
+	require.NotNil(t, parameters.Daemon)
+	require.EqualValues(t, 1, parameters.Daemon.ID)
+
+	params, ok := parameters.Parameters.(map[string]any)
+	require.True(t, ok)
+	require.Len(t, params, 2)
+	require.EqualValues(t, 3600, params["valid-lifetime"])
+	require.NotContains(t, params, "subnet4")
+	require.Nil(t, params["lease-database"].(map[string]any)["password"])
+
+	// The daemon's configuration should not be modified.
+	leaseDatabase, ok := daemon.KeaDaemon.Config.GetTopLevelMap("lease-database")
+	require.True(t, ok)
+	require.Equal(t, "secret", leaseDatabase["password"])
+}
+
+// Test that the global parameters can be updated via the transaction.
+func TestUpdateGlobalParametersBeginSubmit(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents returning the current configurations in response
+	// to the config-get commands and receiving config-test, config-set and
+	// config-write commands.
+	fa := agentcommtest.NewKeaFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		if callNo >= 2 {
+			return
+		}
+		json := []byte(`[
+            {
+                "result": 0,
+                "arguments": {
+                    "Dhcp4": {
+                        "valid-lifetime": 3600
+                    }
+                }
+            }
+        ]`)
+		command := keactrl.NewCommand("config-get", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	// Create session manager.
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, apps := storktest.AddTestHosts(t, db)
+
+	// Begin transaction and cancel it.
+	params := dhcp.UpdateGlobalParametersBeginParams{
+		Daemons: &models.GlobalParametersDaemons{
+			DaemonIds: []int64{apps[0].Daemons[0].ID, apps[1].Daemons[0].ID},
+		},
+	}
+	rsp := rapi.UpdateGlobalParametersBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateGlobalParametersBeginOK{}, rsp)
+	okRsp := rsp.(*dhcp.UpdateGlobalParametersBeginOK)
+	require.NotZero(t, okRsp.Payload.ID)
+
+	params2 := dhcp.UpdateGlobalParametersDeleteParams{
+		ID: okRsp.Payload.ID,
+	}
+	rsp2 := rapi.UpdateGlobalParametersDelete(ctx, params2)
+	require.IsType(t, &dhcp.UpdateGlobalParametersDeleteOK{}, rsp2)
+
+	// Begin transaction again. The daemons should have been unlocked.
+	rsp = rapi.UpdateGlobalParametersBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateGlobalParametersBeginOK{}, rsp)
+	okRsp = rsp.(*dhcp.UpdateGlobalParametersBeginOK)
+	contents := okRsp.Payload
+
+	transactionID := contents.ID
+	require.NotZero(t, transactionID)
+	require.Len(t, contents.Daemons, 2)
+	for _, daemon := range contents.Daemons {
+		require.NotNil(t, daemon.Daemon)
+		require.NotNil(t, daemon.Parameters)
+	}
+
+	// Submit transaction.
+	params3 := dhcp.UpdateGlobalParametersSubmitParams{
+		ID: transactionID,
+		GlobalParameters: &models.EditedGlobalParameters{
+			Parameters: map[string]any{
+				"valid-lifetime": 7200,
+			},
+		},
+	}
+	rsp3 := rapi.UpdateGlobalParametersSubmit(ctx, params3)
+	require.IsType(t, &dhcp.UpdateGlobalParametersSubmitOK{}, rsp3)
+
+	// The configurations should have been fetched, tested and applied in
+	// both servers.
+	require.Len(t, fa.RecordedCommands, 8)
+	for i, c := range fa.RecordedCommands[:2] {
+		require.Equal(t, "config-get", c.GetCommand(), i)
+	}
+	for i, c := range fa.RecordedCommands[2:4] {
+		require.Equal(t, "config-test", c.GetCommand(), i)
+	}
+	for _, c := range fa.RecordedCommands[4:] {
+		require.Contains(t, []string{"config-set", "config-write"}, c.GetCommand())
+	}
+
+	// The update should be audited for both daemons.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, record := range records {
+		require.Equal(t, dbmodel.AuditTargetDaemon, record.TargetType)
+		require.Contains(t, params.Daemons.DaemonIds, record.TargetID)
+	}
+
+	// Make sure that the transaction is done.
+	cctx, _ := cm.RecoverContext(transactionID, int64(user.ID))
+	if cctx != nil {
+		cm.Done(cctx)
+	}
+	require.Nil(t, cctx)
+}
+
+// Test that the global parameters update is aborted with the Conflict
+// status code when a daemon rejects the new configuration.
+func TestUpdateGlobalParametersSubmitRejected(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents returning the current configuration and rejecting
+	// the new configuration.
+	fa := agentcommtest.NewKeaFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 0,
+                "arguments": {
+                    "Dhcp4": {
+                        "valid-lifetime": 3600
+                    }
+                }
+            }
+        ]`)
+		command := keactrl.NewCommand("config-get", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	}, func(callNo int, cmdResponses []interface{}) {
+		json := []byte(`[
+            {
+                "result": 1,
+                "text": "invalid configuration"
+            }
+        ]`)
+		command := keactrl.NewCommand("config-test", []string{"dhcp4"}, nil)
+		_ = keactrl.UnmarshalResponseList(command, json, cmdResponses[0])
+	})
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, apps := storktest.AddTestHosts(t, db)
+
+	params := dhcp.UpdateGlobalParametersBeginParams{
+		Daemons: &models.GlobalParametersDaemons{
+			DaemonIds: []int64{apps[0].Daemons[0].ID},
+		},
+	}
+	rsp := rapi.UpdateGlobalParametersBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateGlobalParametersBeginOK{}, rsp)
+	okRsp := rsp.(*dhcp.UpdateGlobalParametersBeginOK)
+
+	params2 := dhcp.UpdateGlobalParametersSubmitParams{
+		ID: okRsp.Payload.ID,
+		GlobalParameters: &models.EditedGlobalParameters{
+			Parameters: map[string]any{
+				"valid-lifetime": -1,
+			},
+		},
+	}
+	rsp2 := rapi.UpdateGlobalParametersSubmit(ctx, params2)
+	require.IsType(t, &dhcp.UpdateGlobalParametersSubmitDefault{}, rsp2)
+	defaultRsp := rsp2.(*dhcp.UpdateGlobalParametersSubmitDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp))
+	require.Contains(t, *defaultRsp.Payload.Message, "invalid configuration")
+
+	// Only the config-get and config-test commands should have been sent.
+	require.Len(t, fa.RecordedCommands, 2)
+	require.Equal(t, "config-get", fa.RecordedCommands[0].GetCommand())
+	require.Equal(t, "config-test", fa.RecordedCommands[1].GetCommand())
+
+	// The daemon should have been unlocked, so a new transaction can begin.
+	rsp = rapi.UpdateGlobalParametersBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateGlobalParametersBeginOK{}, rsp)
+}
+
+// Test error case when a user attempts to begin a transaction for
+// updating global parameters of a non-existing daemon.
+func TestUpdateGlobalParametersBeginNonExistingDaemon(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	params := dhcp.UpdateGlobalParametersBeginParams{
+		Daemons: &models.GlobalParametersDaemons{
+			DaemonIds: []int64{1000},
+		},
+	}
+	rsp := rapi.UpdateGlobalParametersBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateGlobalParametersBeginDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.UpdateGlobalParametersBeginDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
@@ -0,0 +1,306 @@
+package restservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	pkgerrors "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	keaconfig "isc.org/stork/appcfg/kea"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+)
+
+// Host reservation exported in the CSV or JSON format. There is one
+// exported host reservation per host and daemon because the client
+// classes and DHCP options can differ between the daemons. The subnet
+// ID is the ID used in the daemon's configuration.
+type exportedHost struct {
+	HostID     int64  `json:"host-id"`
+	AppID      int64  `json:"app-id"`
+	AppName    string `json:"app-name"`
+	DaemonID   int64  `json:"daemon-id"`
+	DaemonName string `json:"daemon-name"`
+	DataSource string `json:"data-source"`
+	Subnet     string `json:"subnet,omitempty"`
+	SubnetID   int64  `json:"subnet-id"`
+	keaconfig.Reservation
+}
+
+// Host reservations from a single subnet exported in the Kea format.
+type exportedSubnetReservations struct {
+	ID           int64                   `json:"id"`
+	Subnet       string                  `json:"subnet"`
+	Reservations []keaconfig.Reservation `json:"reservations"`
+}
+
+// Host reservations of a single daemon exported in the Kea format. The
+// global reservations and the reservations of each subnet can be pasted
+// into the respective reservations lists in the daemon's configuration.
+type exportedDaemonReservations struct {
+	AppID        int64                         `json:"app-id"`
+	AppName      string                        `json:"app-name"`
+	DaemonID     int64                         `json:"daemon-id"`
+	DaemonName   string                        `json:"daemon-name"`
+	Reservations []keaconfig.Reservation       `json:"reservations"`
+	Subnets      []*exportedSubnetReservations `json:"subnets"`
+}
+
+// Converts the host reservations to the exported format. The subnets of
+// the host reservations must include the local subnets. The reservations
+// are rendered in the Kea format using the option definition lookup.
+// If the app ID is non-zero, only the reservations of the daemons
+// belonging to this app are exported.
+func (r *RestAPI) exportHosts(hosts []dbmodel.Host, appID int64) ([]*exportedHost, error) {
+	exported := []*exportedHost{}
+	for i := range hosts {
+		host := &hosts[i]
+		for _, lh := range host.LocalHosts {
+			if appID != 0 && (lh.Daemon == nil || lh.Daemon.AppID != appID) {
+				continue
+			}
+			reservation, err := keaconfig.CreateReservation(lh.DaemonID, r.DHCPOptionDefinitionLookup, host)
+			if err != nil {
+				return nil, pkgerrors.WithMessagef(err, "problem exporting host %d", host.ID)
+			}
+			subnetID, err := host.GetSubnetID(lh.DaemonID)
+			if err != nil {
+				return nil, err
+			}
+			exportedHost := &exportedHost{
+				HostID:      host.ID,
+				DaemonID:    lh.DaemonID,
+				DataSource:  lh.DataSource.String(),
+				SubnetID:    subnetID,
+				Reservation: *reservation,
+			}
+			if lh.Daemon != nil {
+				exportedHost.DaemonName = lh.Daemon.Name
+				if lh.Daemon.App != nil {
+					exportedHost.AppID = lh.Daemon.App.ID
+					exportedHost.AppName = lh.Daemon.App.Name
+				}
+			}
+			if host.Subnet != nil {
+				exportedHost.Subnet = host.Subnet.Prefix
+			}
+			exported = append(exported, exportedHost)
+		}
+	}
+	return exported, nil
+}
+
+// Groups the exported host reservations by daemons and subnets. The
+// daemons are ordered by ID and the subnets by the IDs used in the
+// daemons' configurations.
+func groupExportedHostsByDaemon(hosts []*exportedHost) []*exportedDaemonReservations {
+	daemons := make(map[int64]*exportedDaemonReservations)
+	subnets := make(map[int64]map[int64]*exportedSubnetReservations)
+	for _, host := range hosts {
+		daemon, ok := daemons[host.DaemonID]
+		if !ok {
+			daemon = &exportedDaemonReservations{
+				AppID:        host.AppID,
+				AppName:      host.AppName,
+				DaemonID:     host.DaemonID,
+				DaemonName:   host.DaemonName,
+				Reservations: []keaconfig.Reservation{},
+				Subnets:      []*exportedSubnetReservations{},
+			}
+			daemons[host.DaemonID] = daemon
+			subnets[host.DaemonID] = make(map[int64]*exportedSubnetReservations)
+		}
+		if len(host.Subnet) == 0 {
+			daemon.Reservations = append(daemon.Reservations, host.Reservation)
+			continue
+		}
+		subnet, ok := subnets[host.DaemonID][host.SubnetID]
+		if !ok {
+			subnet = &exportedSubnetReservations{
+				ID:           host.SubnetID,
+				Subnet:       host.Subnet,
+				Reservations: []keaconfig.Reservation{},
+			}
+			subnets[host.DaemonID][host.SubnetID] = subnet
+			daemon.Subnets = append(daemon.Subnets, subnet)
+		}
+		subnet.Reservations = append(subnet.Reservations, host.Reservation)
+	}
+	grouped := []*exportedDaemonReservations{}
+	for _, daemon := range daemons {
+		sort.Slice(daemon.Subnets, func(i, j int) bool {
+			return daemon.Subnets[i].ID < daemon.Subnets[j].ID
+		})
+		grouped = append(grouped, daemon)
+	}
+	sort.Slice(grouped, func(i, j int) bool {
+		return grouped[i].DaemonID < grouped[j].DaemonID
+	})
+	return grouped
+}
+
+// Writes the exported host reservations in the CSV format. The columns
+// holding the Kea host reservation parameters are named after these
+// parameters. The lists are separated with semicolons and the DHCP
+// options are written as a JSON list in the Kea option-data format.
+func writeExportedHostsCSV(w io.Writer, hosts []*exportedHost) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"host-id", "app-id", "app-name", "daemon-id", "daemon-name", "data-source",
+		"subnet", "subnet-id", "hw-address", "duid", "circuit-id", "client-id",
+		"flex-id", "ip-address", "ip-addresses", "prefixes", "hostname",
+		"client-classes", "option-data",
+	})
+	if err != nil {
+		return pkgerrors.Wrap(err, "problem writing host reservations header")
+	}
+	for _, host := range hosts {
+		var optionData string
+		if len(host.OptionData) > 0 {
+			encoded, err := json.Marshal(host.OptionData)
+			if err != nil {
+				return pkgerrors.Wrapf(err, "problem encoding options of the host %d", host.HostID)
+			}
+			optionData = string(encoded)
+		}
+		err = writer.Write([]string{
+			strconv.FormatInt(host.HostID, 10),
+			strconv.FormatInt(host.AppID, 10),
+			host.AppName,
+			strconv.FormatInt(host.DaemonID, 10),
+			host.DaemonName,
+			host.DataSource,
+			host.Subnet,
+			strconv.FormatInt(host.SubnetID, 10),
+			host.HWAddress,
+			host.DUID,
+			host.CircuitID,
+			host.ClientID,
+			host.FlexID,
+			host.IPAddress,
+			strings.Join(host.IPAddresses, ";"),
+			strings.Join(host.Prefixes, ";"),
+			host.Hostname,
+			strings.Join(host.ClientClasses, ";"),
+			optionData,
+		})
+		if err != nil {
+			return pkgerrors.Wrapf(err, "problem writing host %d", host.HostID)
+		}
+	}
+	writer.Flush()
+	return pkgerrors.Wrap(writer.Error(), "problem writing host reservations")
+}
+
+// Exports all host reservations matching the filtering criteria to a
+// file. The file is in the CSV format unless the JSON or Kea format is
+// requested.
+func (r *RestAPI) ExportHosts(ctx context.Context, params dhcp.ExportHostsParams) middleware.Responder {
+	format := "csv"
+	if params.Format != nil {
+		format = *params.Format
+	}
+	if format != "csv" && format != "json" && format != "kea" {
+		msg := fmt.Sprintf("Unsupported host reservations export format %s", format)
+		rsp := dhcp.NewExportHostsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	var appID int64
+	if params.AppID != nil {
+		appID = *params.AppID
+	}
+
+	dbHosts, _, err := dbmodel.GetHostsByPage(r.DB, 0, 0, appID, params.SubnetID, params.Text, params.Global, "", dbmodel.SortDirAny)
+	if err != nil {
+		msg := "Problem fetching hosts from the database"
+		log.Error(err)
+		rsp := dhcp.NewExportHostsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	// The subnet IDs used in the daemons' configurations are held in the
+	// local subnets. They are not fetched with the hosts.
+	subnets := make(map[int64]*dbmodel.Subnet)
+	for i := range dbHosts {
+		if dbHosts[i].SubnetID == 0 {
+			continue
+		}
+		if _, ok := subnets[dbHosts[i].SubnetID]; !ok {
+			subnets[dbHosts[i].SubnetID], err = dbmodel.GetSubnet(r.DB, dbHosts[i].SubnetID)
+			if err != nil {
+				msg := "Problem fetching subnets from the database"
+				log.Error(err)
+				rsp := dhcp.NewExportHostsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+					Message: &msg,
+				})
+				return rsp
+			}
+		}
+		dbHosts[i].Subnet = subnets[dbHosts[i].SubnetID]
+	}
+
+	hosts, err := r.exportHosts(dbHosts, appID)
+	if err != nil {
+		msg := "Problem exporting host reservations"
+		log.Error(err)
+		rsp := dhcp.NewExportHostsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	var buffer bytes.Buffer
+	contentType := "application/json"
+	switch format {
+	case "json":
+		err = json.NewEncoder(&buffer).Encode(hosts)
+	case "kea":
+		err = json.NewEncoder(&buffer).Encode(groupExportedHostsByDaemon(hosts))
+	default:
+		contentType = "text/csv"
+		err = writeExportedHostsCSV(&buffer, hosts)
+	}
+	if err != nil {
+		msg := "Problem exporting host reservations"
+		log.Error(err)
+		rsp := dhcp.NewExportHostsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	extension := format
+	if format == "kea" {
+		extension = "json"
+	}
+	dispositionHeaderValue := fmt.Sprintf(
+		"attachment; filename=\"stork-hosts-%s_%s.%s\"",
+		format,
+		strings.ReplaceAll(time.Now().UTC().Format(time.RFC3339), ":", "-"),
+		extension,
+	)
+
+	rsp := dhcp.
+		NewExportHostsOK().
+		WithContentType(contentType).
+		WithContentDisposition(dispositionHeaderValue).
+		WithPayload(io.NopCloser(&buffer))
+	return rsp
+}
@@ -0,0 +1,359 @@
+package restservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	keaconfig "isc.org/stork/appcfg/kea"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storktestdbmodel "isc.org/stork/server/test/dbmodel"
+	storkutil "isc.org/stork/util"
+)
+
+// Returns the hosts used in the export tests. The first host belongs to
+// a subnet and is associated with two daemons. The second host is global.
+func getTestExportedHosts() []dbmodel.Host {
+	daemons := []*dbmodel.Daemon{
+		{
+			ID:    1,
+			Name:  dbmodel.DaemonNameDHCPv4,
+			AppID: 10,
+			App: &dbmodel.App{
+				ID:   10,
+				Name: "kea1",
+			},
+		},
+		{
+			ID:    2,
+			Name:  dbmodel.DaemonNameDHCPv4,
+			AppID: 20,
+			App: &dbmodel.App{
+				ID:   20,
+				Name: "kea2",
+			},
+		},
+	}
+	return []dbmodel.Host{
+		{
+			ID:       1,
+			SubnetID: 1,
+			Subnet: &dbmodel.Subnet{
+				ID:     1,
+				Prefix: "192.0.2.0/24",
+				LocalSubnets: []*dbmodel.LocalSubnet{
+					{
+						DaemonID:      1,
+						LocalSubnetID: 111,
+					},
+					{
+						DaemonID:      2,
+						LocalSubnetID: 222,
+					},
+				},
+			},
+			Hostname: "first.example.org",
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "hw-address",
+					Value: []byte{1, 2, 3, 4, 5, 6},
+				},
+			},
+			IPReservations: []dbmodel.IPReservation{
+				{
+					Address: "192.0.2.10",
+				},
+			},
+			LocalHosts: []dbmodel.LocalHost{
+				{
+					DaemonID:      1,
+					Daemon:        daemons[0],
+					DataSource:    dbmodel.HostDataSourceAPI,
+					ClientClasses: []string{"foo", "bar"},
+					DHCPOptionSet: []dbmodel.DHCPOption{
+						{
+							Code:     3,
+							Space:    keaconfig.DHCPv4OptionSpace,
+							Universe: storkutil.IPv4,
+							Fields: []dbmodel.DHCPOptionField{
+								{
+									FieldType: keaconfig.IPv4AddressField,
+									Values:    []any{"192.0.2.1"},
+								},
+							},
+						},
+					},
+				},
+				{
+					DaemonID:   2,
+					Daemon:     daemons[1],
+					DataSource: dbmodel.HostDataSourceConfig,
+				},
+			},
+		},
+		{
+			ID:       2,
+			Hostname: "second.example.org",
+			HostIdentifiers: []dbmodel.HostIdentifier{
+				{
+					Type:  "client-id",
+					Value: []byte{1, 2, 3, 4},
+				},
+			},
+			LocalHosts: []dbmodel.LocalHost{
+				{
+					DaemonID:   1,
+					Daemon:     daemons[0],
+					DataSource: dbmodel.HostDataSourceAPI,
+				},
+			},
+		},
+	}
+}
+
+// Test converting the host reservations to the exported format.
+func TestExportHostsConvert(t *testing.T) {
+	r := &RestAPI{
+		DHCPOptionDefinitionLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	}
+	hosts, err := r.exportHosts(getTestExportedHosts(), 0)
+	require.NoError(t, err)
+	require.Len(t, hosts, 3)
+
+	require.EqualValues(t, 1, hosts[0].HostID)
+	require.EqualValues(t, 10, hosts[0].AppID)
+	require.Equal(t, "kea1", hosts[0].AppName)
+	require.EqualValues(t, 1, hosts[0].DaemonID)
+	require.Equal(t, "dhcp4", hosts[0].DaemonName)
+	require.Equal(t, "api", hosts[0].DataSource)
+	require.Equal(t, "192.0.2.0/24", hosts[0].Subnet)
+	require.EqualValues(t, 111, hosts[0].SubnetID)
+	require.Equal(t, "010203040506", hosts[0].HWAddress)
+	require.Equal(t, "192.0.2.10", hosts[0].IPAddress)
+	require.Equal(t, "first.example.org", hosts[0].Hostname)
+	require.Equal(t, []string{"foo", "bar"}, hosts[0].ClientClasses)
+	require.Len(t, hosts[0].OptionData, 1)
+	require.EqualValues(t, 3, hosts[0].OptionData[0].Code)
+	require.Equal(t, "192.0.2.1", hosts[0].OptionData[0].Data)
+
+	// The same host for the second daemon.
+	require.EqualValues(t, 1, hosts[1].HostID)
+	require.EqualValues(t, 2, hosts[1].DaemonID)
+	require.Equal(t, "config", hosts[1].DataSource)
+	require.EqualValues(t, 222, hosts[1].SubnetID)
+	require.Empty(t, hosts[1].ClientClasses)
+	require.Empty(t, hosts[1].OptionData)
+
+	// Global host.
+	require.EqualValues(t, 2, hosts[2].HostID)
+	require.Empty(t, hosts[2].Subnet)
+	require.Zero(t, hosts[2].SubnetID)
+	require.Equal(t, "01020304", hosts[2].ClientID)
+}
+
+// Test that only the reservations of the daemons belonging to the
+// specified app are exported.
+func TestExportHostsConvertByApp(t *testing.T) {
+	r := &RestAPI{
+		DHCPOptionDefinitionLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	}
+	hosts, err := r.exportHosts(getTestExportedHosts(), 20)
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	require.EqualValues(t, 1, hosts[0].HostID)
+	require.EqualValues(t, 20, hosts[0].AppID)
+	require.EqualValues(t, 2, hosts[0].DaemonID)
+	require.EqualValues(t, 222, hosts[0].SubnetID)
+
+	hosts, err = r.exportHosts(getTestExportedHosts(), 10)
+	require.NoError(t, err)
+	require.Len(t, hosts, 2)
+	require.EqualValues(t, 1, hosts[0].DaemonID)
+	require.EqualValues(t, 1, hosts[1].DaemonID)
+	require.EqualValues(t, 2, hosts[1].HostID)
+}
+
+// Test grouping the exported host reservations by daemons for the
+// Kea format.
+func TestGroupExportedHostsByDaemon(t *testing.T) {
+	r := &RestAPI{
+		DHCPOptionDefinitionLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	}
+	hosts, err := r.exportHosts(getTestExportedHosts(), 0)
+	require.NoError(t, err)
+
+	encoded, err := json.Marshal(groupExportedHostsByDaemon(hosts))
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+		{
+			"app-id": 10,
+			"app-name": "kea1",
+			"daemon-id": 1,
+			"daemon-name": "dhcp4",
+			"reservations": [
+				{
+					"client-id": "01020304",
+					"hostname": "second.example.org"
+				}
+			],
+			"subnets": [
+				{
+					"id": 111,
+					"subnet": "192.0.2.0/24",
+					"reservations": [
+						{
+							"hw-address": "010203040506",
+							"ip-address": "192.0.2.10",
+							"hostname": "first.example.org",
+							"client-classes": [ "foo", "bar" ],
+							"option-data": [
+								{
+									"code": 3,
+									"csv-format": true,
+									"data": "192.0.2.1",
+									"space": "dhcp4"
+								}
+							]
+						}
+					]
+				}
+			]
+		},
+		{
+			"app-id": 20,
+			"app-name": "kea2",
+			"daemon-id": 2,
+			"daemon-name": "dhcp4",
+			"reservations": [],
+			"subnets": [
+				{
+					"id": 222,
+					"subnet": "192.0.2.0/24",
+					"reservations": [
+						{
+							"hw-address": "010203040506",
+							"ip-address": "192.0.2.10",
+							"hostname": "first.example.org"
+						}
+					]
+				}
+			]
+		}
+	]`, string(encoded))
+}
+
+// Test writing the exported host reservations in the CSV format.
+func TestWriteExportedHostsCSV(t *testing.T) {
+	r := &RestAPI{
+		DHCPOptionDefinitionLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	}
+	hosts, err := r.exportHosts(getTestExportedHosts(), 0)
+	require.NoError(t, err)
+
+	var buffer bytes.Buffer
+	err = writeExportedHostsCSV(&buffer, hosts)
+	require.NoError(t, err)
+
+	rows, err := csv.NewReader(&buffer).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Len(t, rows[0], 19)
+	require.Equal(t, "host-id", rows[0][0])
+	require.Equal(t, "option-data", rows[0][18])
+
+	require.Equal(t, []string{
+		"1", "10", "kea1", "1", "dhcp4", "api", "192.0.2.0/24", "111",
+		"010203040506", "", "", "", "", "192.0.2.10", "", "",
+		"first.example.org", "foo;bar",
+	}, rows[1][:18])
+	require.JSONEq(t, `[{"code": 3, "csv-format": true, "data": "192.0.2.1", "space": "dhcp4"}]`, rows[1][18])
+	require.Empty(t, rows[2][18])
+	require.Equal(t, "01020304", rows[3][11])
+}
+
+// Test exporting the host reservations to a file.
+func TestExportHosts(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	rapi, err := NewRestAPI(dbSettings, db, dbmodel.NewDHCPOptionDefinitionLookup())
+	require.NoError(t, err)
+
+	hosts, _ := storktestdbmodel.AddTestHosts(t, db)
+
+	// Export all hosts to CSV.
+	rsp := rapi.ExportHosts(context.Background(), dhcp.ExportHostsParams{})
+	require.IsType(t, &dhcp.ExportHostsOK{}, rsp)
+	okRsp := rsp.(*dhcp.ExportHostsOK)
+	require.Equal(t, "text/csv", okRsp.ContentType)
+	require.Contains(t, okRsp.ContentDisposition, ".csv")
+	rows, err := csv.NewReader(okRsp.Payload).ReadAll()
+	require.NoError(t, err)
+	exportedCount := 1
+	for _, host := range hosts {
+		exportedCount += len(host.LocalHosts)
+	}
+	require.Len(t, rows, exportedCount)
+
+	// Export global hosts to JSON.
+	format := "json"
+	global := true
+	rsp = rapi.ExportHosts(context.Background(), dhcp.ExportHostsParams{
+		Format: &format,
+		Global: &global,
+	})
+	require.IsType(t, &dhcp.ExportHostsOK{}, rsp)
+	okRsp = rsp.(*dhcp.ExportHostsOK)
+	require.Equal(t, "application/json", okRsp.ContentType)
+	content, err := io.ReadAll(okRsp.Payload)
+	require.NoError(t, err)
+	var exported []*exportedHost
+	err = json.Unmarshal(content, &exported)
+	require.NoError(t, err)
+	require.NotEmpty(t, exported)
+	for _, host := range exported {
+		require.Empty(t, host.Subnet)
+		require.Zero(t, host.SubnetID)
+	}
+
+	// Export hosts from the subnet in the Kea format.
+	format = "kea"
+	subnetID := int64(1)
+	rsp = rapi.ExportHosts(context.Background(), dhcp.ExportHostsParams{
+		Format:   &format,
+		SubnetID: &subnetID,
+	})
+	require.IsType(t, &dhcp.ExportHostsOK{}, rsp)
+	okRsp = rsp.(*dhcp.ExportHostsOK)
+	require.Equal(t, "application/json", okRsp.ContentType)
+	require.Contains(t, okRsp.ContentDisposition, "stork-hosts-kea")
+	content, err = io.ReadAll(okRsp.Payload)
+	require.NoError(t, err)
+	var daemons []*exportedDaemonReservations
+	err = json.Unmarshal(content, &daemons)
+	require.NoError(t, err)
+	require.NotEmpty(t, daemons)
+	for _, daemon := range daemons {
+		require.Empty(t, daemon.Reservations)
+		require.Len(t, daemon.Subnets, 1)
+		require.EqualValues(t, 111, daemon.Subnets[0].ID)
+		require.Equal(t, "192.0.2.0/24", daemon.Subnets[0].Subnet)
+		require.NotEmpty(t, daemon.Subnets[0].Reservations)
+	}
+
+	// Unsupported format.
+	format = "xml"
+	rsp = rapi.ExportHosts(context.Background(), dhcp.ExportHostsParams{
+		Format: &format,
+	})
+	require.IsType(t, &dhcp.ExportHostsDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.ExportHostsDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
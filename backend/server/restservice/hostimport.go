@@ -0,0 +1,523 @@
+package restservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-openapi/runtime/middleware"
+	pkgerrors "github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	keaconfig "isc.org/stork/appcfg/kea"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storkutil "isc.org/stork/util"
+)
+
+// Statuses of the host reservations in the import report.
+const (
+	hostImportStatusImported = "imported"
+	hostImportStatusInvalid  = "invalid"
+	hostImportStatusFailed   = "failed"
+)
+
+// Default maximum number of the imported host reservations sent to the
+// Kea servers in one transaction.
+const defaultHostImportBatchSize = 100
+
+// Host reservation read from the imported file. It comprises the Kea host
+// reservation parameters and the prefix of the subnet the reservation
+// belongs to. The reservation is global when the subnet is not specified.
+type importedHost struct {
+	keaconfig.Reservation
+	Subnet string `json:"subnet,omitempty"`
+}
+
+// Host reservation read from the imported file along with its number in
+// the file. The error is set when the reservation cannot be parsed.
+type importedHostRow struct {
+	row  int64
+	host *importedHost
+	err  error
+}
+
+// Splits the list of values held in a single CSV column. The values are
+// separated with semicolons.
+func splitImportedHostList(value string) (values []string) {
+	for _, v := range strings.Split(value, ";") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return
+}
+
+// Functions setting the host reservation parameters from the CSV columns.
+// The CSV columns are named after the Kea host reservation parameters.
+// The DHCP options are specified as a JSON list in the Kea option-data
+// format.
+var importedHostCSVColumns = map[string]func(host *importedHost, value string) error{
+	"hw-address": func(host *importedHost, value string) error {
+		host.HWAddress = value
+		return nil
+	},
+	"duid": func(host *importedHost, value string) error {
+		host.DUID = value
+		return nil
+	},
+	"circuit-id": func(host *importedHost, value string) error {
+		host.CircuitID = value
+		return nil
+	},
+	"client-id": func(host *importedHost, value string) error {
+		host.ClientID = value
+		return nil
+	},
+	"flex-id": func(host *importedHost, value string) error {
+		host.FlexID = value
+		return nil
+	},
+	"ip-address": func(host *importedHost, value string) error {
+		host.IPAddress = value
+		return nil
+	},
+	"ip-addresses": func(host *importedHost, value string) error {
+		host.IPAddresses = splitImportedHostList(value)
+		return nil
+	},
+	"prefixes": func(host *importedHost, value string) error {
+		host.Prefixes = splitImportedHostList(value)
+		return nil
+	},
+	"hostname": func(host *importedHost, value string) error {
+		host.Hostname = value
+		return nil
+	},
+	"client-classes": func(host *importedHost, value string) error {
+		host.ClientClasses = splitImportedHostList(value)
+		return nil
+	},
+	"option-data": func(host *importedHost, value string) error {
+		return pkgerrors.Wrap(json.Unmarshal([]byte(value), &host.OptionData), "problem parsing option-data")
+	},
+	"subnet": func(host *importedHost, value string) error {
+		host.Subnet = value
+		return nil
+	},
+}
+
+// Parses the host reservations from the CSV file. The file must begin
+// with a header naming the columns. It returns an error when the file
+// or its header is malformed. The errors in the individual rows are
+// returned in the rows.
+func parseImportedHostsCSV(content string) ([]importedHostRow, error) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, pkgerrors.New("CSV file with host reservations is empty")
+		}
+		return nil, pkgerrors.Wrap(err, "problem parsing header of the CSV file with host reservations")
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		if _, ok := importedHostCSVColumns[header[i]]; !ok {
+			return nil, pkgerrors.Errorf("unsupported column %s in the CSV file with host reservations", header[i])
+		}
+	}
+	rows := []importedHostRow{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		row := importedHostRow{
+			row: int64(len(rows) + 1),
+		}
+		if err != nil {
+			if !errors.Is(err, csv.ErrFieldCount) {
+				return nil, pkgerrors.Wrap(err, "problem parsing CSV file with host reservations")
+			}
+			row.err = pkgerrors.Errorf("expected %d columns but found %d", len(header), len(record))
+			rows = append(rows, row)
+			continue
+		}
+		host := &importedHost{}
+		for i, value := range record {
+			if value = strings.TrimSpace(value); len(value) == 0 {
+				continue
+			}
+			if err = importedHostCSVColumns[header[i]](host, value); err != nil {
+				row.err = err
+				break
+			}
+		}
+		if row.err == nil {
+			row.host = host
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Parses the host reservations from the JSON file. The file must contain
+// a list of host reservations. It returns an error when the file is
+// malformed. The errors in the individual host reservations are returned
+// in the rows.
+func parseImportedHostsJSON(content string) ([]importedHostRow, error) {
+	var rawHosts []json.RawMessage
+	if err := json.Unmarshal([]byte(content), &rawHosts); err != nil {
+		return nil, pkgerrors.Wrap(err, "problem parsing JSON file with host reservations")
+	}
+	rows := []importedHostRow{}
+	for i, rawHost := range rawHosts {
+		row := importedHostRow{
+			row: int64(i + 1),
+		}
+		host := &importedHost{}
+		decoder := json.NewDecoder(bytes.NewReader(rawHost))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(host); err != nil {
+			row.err = pkgerrors.Wrap(err, "problem parsing host reservation")
+		} else {
+			row.host = host
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Returns the DHCP identifiers of the imported host reservation in the
+// format used in REST API.
+func importedHostIdentifiersToRestAPI(host *importedHost) []*models.HostIdentifier {
+	identifiers := []*models.HostIdentifier{}
+	for _, id := range []struct {
+		idType string
+		value  string
+	}{
+		{"hw-address", host.HWAddress},
+		{"duid", host.DUID},
+		{"circuit-id", host.CircuitID},
+		{"client-id", host.ClientID},
+		{"flex-id", host.FlexID},
+	} {
+		if len(id.value) > 0 {
+			identifiers = append(identifiers, &models.HostIdentifier{
+				IDType:     id.idType,
+				IDHexValue: id.value,
+			})
+		}
+	}
+	return identifiers
+}
+
+// Validates the imported host reservations and converts them to the
+// database model. It holds the daemons receiving the host reservations,
+// the subnets fetched from the database and the identifiers of the
+// already validated host reservations.
+type hostImportValidator struct {
+	r       *RestAPI
+	daemons []*dbmodel.Daemon
+	subnets map[string]*dbmodel.Subnet
+	rows    map[string]int64
+}
+
+// Creates the validator of the host reservations imported to the
+// specified daemons.
+func newHostImportValidator(r *RestAPI, daemons []*dbmodel.Daemon) *hostImportValidator {
+	return &hostImportValidator{
+		r:       r,
+		daemons: daemons,
+		subnets: make(map[string]*dbmodel.Subnet),
+		rows:    make(map[string]int64),
+	}
+}
+
+// Returns the subnet with the specified prefix. The subnets are cached
+// to avoid fetching them from the database for each host reservation.
+func (v *hostImportValidator) getSubnet(prefix string) (*dbmodel.Subnet, error) {
+	if subnet, ok := v.subnets[prefix]; ok {
+		return subnet, nil
+	}
+	subnets, err := dbmodel.GetSubnetsByPrefix(v.r.DB, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(subnets) == 0 {
+		return nil, pkgerrors.Errorf("subnet %s does not exist", prefix)
+	}
+	v.subnets[prefix] = &subnets[0]
+	return v.subnets[prefix], nil
+}
+
+// Converts the imported host reservation to the database model and checks
+// that it can be sent to all daemons. The host reservation must contain a
+// DHCP identifier, the IP reservations must match the daemons' families
+// and the subnet must be served by all daemons. The host reservation is
+// converted to the Kea format using the option definition lookup to
+// validate the DHCP options. Finally, it checks that the same host
+// reservation has not been specified in one of the previous rows.
+func (v *hostImportValidator) validate(row int64, imported *importedHost) (*dbmodel.Host, error) {
+	var host *dbmodel.Host
+	for _, daemon := range v.daemons {
+		// Kea assumes the top-level option space when it is not specified.
+		reservation := imported.Reservation
+		reservation.OptionData = make([]keaconfig.SingleOptionData, len(imported.OptionData))
+		for i, optionData := range imported.OptionData {
+			if len(optionData.Space) == 0 {
+				optionData.Space = keaconfig.DHCPv4OptionSpace
+				if daemon.Name == dbmodel.DaemonNameDHCPv6 {
+					optionData.Space = keaconfig.DHCPv6OptionSpace
+				}
+			}
+			reservation.OptionData[i] = optionData
+		}
+		daemonHost, err := dbmodel.NewHostFromKeaConfigReservation(reservation, daemon, dbmodel.HostDataSourceAPI, v.r.DHCPOptionDefinitionLookup)
+		if err != nil {
+			return nil, pkgerrors.WithMessagef(err, "invalid host reservation for %s server %d", daemon.Name, daemon.ID)
+		}
+		daemonHost.LocalHosts[0].Daemon = daemon
+		if host == nil {
+			host = daemonHost
+		} else {
+			host.LocalHosts = append(host.LocalHosts, daemonHost.LocalHosts[0])
+		}
+	}
+	if len(host.HostIdentifiers) == 0 {
+		return nil, pkgerrors.New("host reservation lacks a DHCP identifier")
+	}
+	var ipv4Addresses int
+	for _, ipr := range host.IPReservations {
+		parsed := storkutil.ParseIP(ipr.Address)
+		if parsed == nil {
+			return nil, pkgerrors.Errorf("invalid IP reservation %s", ipr.Address)
+		}
+		if parsed.Protocol == storkutil.IPv4 {
+			if parsed.Prefix {
+				return nil, pkgerrors.Errorf("invalid IPv4 address reservation %s", ipr.Address)
+			}
+			ipv4Addresses++
+		}
+		for _, daemon := range v.daemons {
+			if (daemon.Name == dbmodel.DaemonNameDHCPv4) != (parsed.Protocol == storkutil.IPv4) {
+				return nil, pkgerrors.Errorf("IP reservation %s cannot be sent to %s server %d", ipr.Address, daemon.Name, daemon.ID)
+			}
+		}
+	}
+	if ipv4Addresses > 1 {
+		return nil, pkgerrors.New("host reservation contains more than one IPv4 address")
+	}
+	if len(imported.Subnet) > 0 {
+		subnet, err := v.getSubnet(imported.Subnet)
+		if err != nil {
+			return nil, err
+		}
+		host.SubnetID = subnet.ID
+		host.Subnet = subnet
+	}
+	for _, lh := range host.LocalHosts {
+		if _, err := host.GetSubnetID(lh.DaemonID); err != nil {
+			return nil, pkgerrors.Errorf("subnet %s is not served by %s server %d", imported.Subnet, lh.Daemon.Name, lh.DaemonID)
+		}
+		if _, err := keaconfig.CreateReservation(lh.DaemonID, v.r.DHCPOptionDefinitionLookup, host); err != nil {
+			return nil, pkgerrors.WithMessagef(err, "invalid host reservation for %s server %d", lh.Daemon.Name, lh.DaemonID)
+		}
+	}
+	for _, id := range host.HostIdentifiers {
+		key := fmt.Sprintf("%d:%s:%s", host.SubnetID, id.Type, id.ToHex(""))
+		if previous, ok := v.rows[key]; ok {
+			return nil, pkgerrors.Errorf("duplicate %s %s in the same subnet as in row %d", id.Type, id.ToHex(":"), previous)
+		}
+		v.rows[key] = row
+	}
+	return host, nil
+}
+
+// Sends the batch of the imported host reservations to the Kea servers in
+// a single transaction. The transaction is committed immediately.
+func (r *RestAPI) commitImportedHosts(userID int64, hosts []*dbmodel.Host) error {
+	cctx, err := r.ConfigManager.CreateContext(userID)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		r.ConfigManager.Done(cctx)
+	}()
+	if cctx, err = r.ConfigManager.GetKeaModule().BeginHostAdd(cctx); err != nil {
+		return err
+	}
+	if cctx, err = r.ConfigManager.GetKeaModule().ApplyHostsAdd(cctx, hosts); err != nil {
+		return err
+	}
+	cctx, err = r.ConfigManager.Commit(cctx)
+	return err
+}
+
+// Implements the POST call to import host reservations from the CSV or
+// JSON file (hosts/import). Each host reservation is validated and the
+// valid ones are sent to the Kea servers in batches. A batch is sent in
+// a single transaction. If committing the batch fails, all host
+// reservations in the batch are reported as failed, although Kea may have
+// created the ones preceding the failed host reservation. They are
+// fetched from Kea by the host reservations puller. The returned report
+// contains the result of importing each host reservation.
+func (r *RestAPI) ImportHosts(ctx context.Context, params dhcp.ImportHostsParams) middleware.Responder {
+	if params.Hosts == nil || params.Hosts.Format == nil || params.Hosts.Content == nil {
+		msg := "imported host reservations not specified"
+		log.Error(msg)
+		rsp := dhcp.NewImportHostsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to import host reservations because user is not logged in"
+		log.Error("problem with importing host reservations because user has no session")
+		rsp := dhcp.NewImportHostsDefault(http.StatusForbidden).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if len(params.Hosts.DaemonIds) == 0 {
+		msg := "no servers specified for the imported host reservations"
+		log.Error(msg)
+		rsp := dhcp.NewImportHostsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Make sure that the daemons exist and are capable of receiving the
+	// host reservations.
+	var daemons []*dbmodel.Daemon
+	for _, daemonID := range params.Hosts.DaemonIds {
+		daemon, err := dbmodel.GetDaemonByID(r.DB, daemonID)
+		if err != nil {
+			msg := fmt.Sprintf("problem with fetching server %d from the database", daemonID)
+			log.WithError(err).Error(msg)
+			rsp := dhcp.NewImportHostsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		if daemon == nil {
+			msg := fmt.Sprintf("unable to import host reservations to non-existing server %d", daemonID)
+			log.Error(msg)
+			rsp := dhcp.NewImportHostsDefault(http.StatusNotFound).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		if daemon.KeaDaemon == nil || daemon.KeaDaemon.Config == nil {
+			msg := fmt.Sprintf("unable to import host reservations to server %d because it is not a Kea DHCP server", daemonID)
+			log.Error(msg)
+			rsp := dhcp.NewImportHostsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		if _, _, exists := daemon.KeaDaemon.Config.GetHooksLibrary("libdhcp_host_cmds"); !exists {
+			msg := fmt.Sprintf("unable to import host reservations to server %d because it lacks host_cmds hooks library", daemonID)
+			log.Error(msg)
+			rsp := dhcp.NewImportHostsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		daemons = append(daemons, daemon)
+	}
+
+	var (
+		rows []importedHostRow
+		err  error
+	)
+	switch *params.Hosts.Format {
+	case "csv":
+		rows, err = parseImportedHostsCSV(*params.Hosts.Content)
+	case "json":
+		rows, err = parseImportedHostsJSON(*params.Hosts.Content)
+	default:
+		err = pkgerrors.Errorf("unsupported host reservations import format %s", *params.Hosts.Format)
+	}
+	if err != nil {
+		msg := err.Error()
+		log.Error(err)
+		rsp := dhcp.NewImportHostsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	batchSize := int(params.Hosts.BatchSize)
+	if batchSize <= 0 {
+		batchSize = defaultHostImportBatchSize
+	}
+
+	// Validate the host reservations.
+	report := &models.HostImportReport{
+		Total: int64(len(rows)),
+		Rows:  []*models.HostImportRow{},
+	}
+	var (
+		hosts      []*dbmodel.Host
+		hostReport []*models.HostImportRow
+	)
+	validator := newHostImportValidator(r, daemons)
+	for _, row := range rows {
+		reportRow := &models.HostImportRow{
+			Row: row.row,
+		}
+		report.Rows = append(report.Rows, reportRow)
+		if row.err != nil {
+			reportRow.Status = hostImportStatusInvalid
+			reportRow.Error = row.err.Error()
+			report.Invalid++
+			continue
+		}
+		reportRow.Hostname = row.host.Hostname
+		reportRow.HostIdentifiers = importedHostIdentifiersToRestAPI(row.host)
+		host, err := validator.validate(row.row, row.host)
+		if err != nil {
+			reportRow.Status = hostImportStatusInvalid
+			reportRow.Error = err.Error()
+			report.Invalid++
+			continue
+		}
+		hosts = append(hosts, host)
+		hostReport = append(hostReport, reportRow)
+	}
+
+	// Send the valid host reservations in batches.
+	for start := 0; start < len(hosts); start += batchSize {
+		end := start + batchSize
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		if err = r.commitImportedHosts(int64(user.ID), hosts[start:end]); err != nil {
+			log.WithError(err).Errorf("Problem with committing imported host reservations")
+			for _, reportRow := range hostReport[start:end] {
+				reportRow.Status = hostImportStatusFailed
+				reportRow.Error = fmt.Sprintf("problem with committing host reservations: %s", err)
+				report.Failed++
+			}
+			continue
+		}
+		for _, reportRow := range hostReport[start:end] {
+			reportRow.Status = hostImportStatusImported
+			report.Imported++
+		}
+		r.addNewHostsAuditRecords(ctx, hosts[start:end])
+	}
+
+	rsp := dhcp.NewImportHostsOK().WithPayload(report)
+	return rsp
+}
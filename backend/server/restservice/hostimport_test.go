@@ -0,0 +1,426 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	keaconfig "isc.org/stork/appcfg/kea"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	"isc.org/stork/server/apps"
+	appstest "isc.org/stork/server/apps/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storktestdbmodel "isc.org/stork/server/test/dbmodel"
+)
+
+// Test parsing host reservations from the CSV file.
+func TestParseImportedHostsCSV(t *testing.T) {
+	content := `hw-address,ip-addresses,hostname,client-classes,option-data,subnet
+01:02:03:04:05:06,2001:db8:1::1;2001:db8:1::2,first.example.org,foo; bar,"[{""code"": 23, ""data"": ""2001:db8:2::1""}]",2001:db8:1::/64
+01:02:03:04:05:07,,second.example.org
+01:02:03:04:05:08,,third.example.org,,[,
+`
+	rows, err := parseImportedHostsCSV(content)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	require.EqualValues(t, 1, rows[0].row)
+	require.NoError(t, rows[0].err)
+	require.NotNil(t, rows[0].host)
+	require.Equal(t, "01:02:03:04:05:06", rows[0].host.HWAddress)
+	require.Equal(t, []string{"2001:db8:1::1", "2001:db8:1::2"}, rows[0].host.IPAddresses)
+	require.Equal(t, "first.example.org", rows[0].host.Hostname)
+	require.Equal(t, []string{"foo", "bar"}, rows[0].host.ClientClasses)
+	require.Len(t, rows[0].host.OptionData, 1)
+	require.EqualValues(t, 23, rows[0].host.OptionData[0].Code)
+	require.Equal(t, "2001:db8:2::1", rows[0].host.OptionData[0].Data)
+	require.Equal(t, "2001:db8:1::/64", rows[0].host.Subnet)
+
+	// Wrong number of columns.
+	require.EqualValues(t, 2, rows[1].row)
+	require.Error(t, rows[1].err)
+	require.Nil(t, rows[1].host)
+
+	// Invalid option data.
+	require.EqualValues(t, 3, rows[2].row)
+	require.Error(t, rows[2].err)
+	require.Nil(t, rows[2].host)
+
+	// Unsupported column.
+	_, err = parseImportedHostsCSV("hw-address,foo\n01:02:03:04:05:06,bar\n")
+	require.ErrorContains(t, err, "unsupported column foo")
+
+	// Empty file.
+	_, err = parseImportedHostsCSV("")
+	require.Error(t, err)
+}
+
+// Test parsing host reservations from the JSON file.
+func TestParseImportedHostsJSON(t *testing.T) {
+	content := `[
+		{
+			"hw-address": "01:02:03:04:05:06",
+			"ip-address": "192.0.2.10",
+			"hostname": "first.example.org",
+			"client-classes": [ "foo" ],
+			"option-data": [ { "code": 3, "data": "192.0.2.1" } ],
+			"subnet": "192.0.2.0/24"
+		},
+		{
+			"hw-address": "01:02:03:04:05:07",
+			"unknown": "foo"
+		}
+	]`
+	rows, err := parseImportedHostsJSON(content)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+
+	require.EqualValues(t, 1, rows[0].row)
+	require.NoError(t, rows[0].err)
+	require.Equal(t, "01:02:03:04:05:06", rows[0].host.HWAddress)
+	require.Equal(t, "192.0.2.10", rows[0].host.IPAddress)
+	require.Equal(t, "first.example.org", rows[0].host.Hostname)
+	require.Equal(t, []string{"foo"}, rows[0].host.ClientClasses)
+	require.Len(t, rows[0].host.OptionData, 1)
+	require.Equal(t, "192.0.2.0/24", rows[0].host.Subnet)
+
+	// Unknown parameter.
+	require.EqualValues(t, 2, rows[1].row)
+	require.Error(t, rows[1].err)
+	require.Nil(t, rows[1].host)
+
+	// Not a list.
+	_, err = parseImportedHostsJSON(`{"hw-address": "01:02:03:04:05:06"}`)
+	require.Error(t, err)
+}
+
+// Test validating the imported global host reservations.
+func TestValidateImportedHost(t *testing.T) {
+	r := &RestAPI{
+		DHCPOptionDefinitionLookup: dbmodel.NewDHCPOptionDefinitionLookup(),
+	}
+	daemons := []*dbmodel.Daemon{
+		{
+			ID:   1,
+			Name: dbmodel.DaemonNameDHCPv4,
+			App:  &dbmodel.App{},
+		},
+		{
+			ID:   2,
+			Name: dbmodel.DaemonNameDHCPv4,
+			App:  &dbmodel.App{},
+		},
+	}
+	validator := newHostImportValidator(r, daemons)
+
+	// Valid host reservation.
+	host, err := validator.validate(1, &importedHost{
+		Reservation: keaconfig.Reservation{
+			HWAddress:     "01:02:03:04:05:06",
+			IPAddress:     "192.0.2.10",
+			Hostname:      "first.example.org",
+			ClientClasses: []string{"foo"},
+			OptionData: []keaconfig.SingleOptionData{
+				{
+					Code:      3,
+					CSVFormat: true,
+					Data:      "192.0.2.1",
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, host)
+	require.Equal(t, "first.example.org", host.Hostname)
+	require.Len(t, host.HostIdentifiers, 1)
+	require.Equal(t, "hw-address", host.HostIdentifiers[0].Type)
+	require.Len(t, host.IPReservations, 1)
+	require.Len(t, host.LocalHosts, 2)
+	for i, lh := range host.LocalHosts {
+		require.Equal(t, daemons[i], lh.Daemon)
+		require.Equal(t, dbmodel.HostDataSourceAPI, lh.DataSource)
+		require.Equal(t, []string{"foo"}, lh.ClientClasses)
+		require.Len(t, lh.DHCPOptionSet, 1)
+	}
+
+	// Duplicate host reservation.
+	_, err = validator.validate(2, &importedHost{
+		Reservation: keaconfig.Reservation{
+			HWAddress: "01:02:03:04:05:06",
+		},
+	})
+	require.ErrorContains(t, err, "row 1")
+
+	// No identifier.
+	_, err = validator.validate(3, &importedHost{
+		Reservation: keaconfig.Reservation{
+			Hostname: "foo.example.org",
+		},
+	})
+	require.Error(t, err)
+
+	// Invalid identifier.
+	_, err = validator.validate(4, &importedHost{
+		Reservation: keaconfig.Reservation{
+			HWAddress: "foo",
+		},
+	})
+	require.Error(t, err)
+
+	// IPv6 address reserved in the DHCPv4 servers.
+	_, err = validator.validate(5, &importedHost{
+		Reservation: keaconfig.Reservation{
+			HWAddress:   "01:02:03:04:05:07",
+			IPAddresses: []string{"2001:db8:1::1"},
+		},
+	})
+	require.Error(t, err)
+
+	// Invalid IP address.
+	_, err = validator.validate(6, &importedHost{
+		Reservation: keaconfig.Reservation{
+			HWAddress: "01:02:03:04:05:07",
+			IPAddress: "192.0.2.300",
+		},
+	})
+	require.Error(t, err)
+
+	// Option not matching its definition.
+	validator = newHostImportValidator(r, []*dbmodel.Daemon{
+		{
+			ID:   3,
+			Name: dbmodel.DaemonNameDHCPv6,
+			App:  &dbmodel.App{},
+		},
+	})
+	_, err = validator.validate(7, &importedHost{
+		Reservation: keaconfig.Reservation{
+			DUID: "01:02:03:04",
+			OptionData: []keaconfig.SingleOptionData{
+				{
+					Code:      90,
+					CSVFormat: true,
+					Data:      "foo",
+					Space:     "s46-cont-mape-options",
+				},
+			},
+		},
+	})
+	require.Error(t, err)
+}
+
+// Test importing host reservations to the Kea servers.
+func TestImportHosts(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, &dbmodel.SystemUser{ID: 1})
+	require.NoError(t, err)
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	content := `hw-address,ip-address,hostname,subnet
+01:02:03:04:05:06,192.0.2.10,first.example.org,192.0.2.0/24
+01:02:03:04:05:07,192.0.2.11,second.example.org,192.0.2.0/24
+01:02:03:04:05:08,192.0.2.12,third.example.org,
+01:02:03:04:05:06,192.0.2.13,fourth.example.org,192.0.2.0/24
+01:02:03:04:05:09,192.0.2.14,fifth.example.org,10.0.0.0/8
+`
+	format := "csv"
+	params := dhcp.ImportHostsParams{
+		Hosts: &models.HostImport{
+			Format:    &format,
+			Content:   &content,
+			DaemonIds: []int64{apps[0].Daemons[0].ID, apps[1].Daemons[0].ID},
+			BatchSize: 2,
+		},
+	}
+	rsp := rapi.ImportHosts(ctx, params)
+	require.IsType(t, &dhcp.ImportHostsOK{}, rsp)
+	report := rsp.(*dhcp.ImportHostsOK).Payload
+	require.EqualValues(t, 5, report.Total)
+	require.EqualValues(t, 3, report.Imported)
+	require.EqualValues(t, 2, report.Invalid)
+	require.Zero(t, report.Failed)
+	require.Len(t, report.Rows, 5)
+
+	for i, status := range []string{"imported", "imported", "imported", "invalid", "invalid"} {
+		require.EqualValues(t, i+1, report.Rows[i].Row)
+		require.Equal(t, status, report.Rows[i].Status)
+	}
+	require.Equal(t, "first.example.org", report.Rows[0].Hostname)
+	require.Len(t, report.Rows[0].HostIdentifiers, 1)
+	require.Equal(t, "hw-address", report.Rows[0].HostIdentifiers[0].IDType)
+	require.Equal(t, "01:02:03:04:05:06", report.Rows[0].HostIdentifiers[0].IDHexValue)
+	require.Contains(t, report.Rows[3].Error, "duplicate")
+	require.Contains(t, report.Rows[4].Error, "10.0.0.0/8")
+
+	// Each valid host reservation is sent to two servers.
+	require.Len(t, fa.RecordedCommands, 6)
+	require.JSONEq(t, `{
+		"command": "reservation-add",
+		"service": ["dhcp4"],
+		"arguments": {
+			"reservation": {
+				"hw-address": "010203040506",
+				"ip-address": "192.0.2.10",
+				"hostname": "first.example.org",
+				"subnet-id": 111
+			}
+		}
+	}`, fa.RecordedCommands[0].Marshal())
+	require.JSONEq(t, `{
+		"command": "reservation-add",
+		"service": ["dhcp4"],
+		"arguments": {
+			"reservation": {
+				"hw-address": "010203040508",
+				"ip-address": "192.0.2.12",
+				"hostname": "third.example.org",
+				"subnet-id": 0
+			}
+		}
+	}`, fa.RecordedCommands[4].Marshal())
+
+	// The imported host reservations should be audited for each batch
+	// and each daemon receiving them.
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 4, total)
+	require.Len(t, records, 4)
+	for _, record := range records {
+		require.Equal(t, dbmodel.AuditTargetDaemon, record.TargetType)
+		require.Contains(t, params.Hosts.DaemonIds, record.TargetID)
+	}
+}
+
+// Test that the Kea failures are reported for the imported host
+// reservations.
+func TestImportHostsCommitError(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		mockStatusError("reservation-add", cmdResponses)
+	}, nil)
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, &dbmodel.SystemUser{ID: 1})
+	require.NoError(t, err)
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	content := `[
+		{ "hw-address": "01:02:03:04:05:06" },
+		{ "hw-address": "01:02:03:04:05:07" }
+	]`
+	format := "json"
+	params := dhcp.ImportHostsParams{
+		Hosts: &models.HostImport{
+			Format:    &format,
+			Content:   &content,
+			DaemonIds: []int64{apps[0].Daemons[0].ID},
+		},
+	}
+	rsp := rapi.ImportHosts(ctx, params)
+	require.IsType(t, &dhcp.ImportHostsOK{}, rsp)
+	report := rsp.(*dhcp.ImportHostsOK).Payload
+	require.EqualValues(t, 2, report.Total)
+	require.Zero(t, report.Imported)
+	require.EqualValues(t, 2, report.Failed)
+	for _, row := range report.Rows {
+		require.Equal(t, "failed", row.Status)
+		require.NotEmpty(t, row.Error)
+	}
+}
+
+// Test the errors returned when the imported host reservations cannot
+// be processed.
+func TestImportHostsErrors(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	_, apps := storktestdbmodel.AddTestHosts(t, db)
+
+	content := "hw-address\n01:02:03:04:05:06\n"
+	format := "csv"
+	params := dhcp.ImportHostsParams{
+		Hosts: &models.HostImport{
+			Format:    &format,
+			Content:   &content,
+			DaemonIds: []int64{apps[0].Daemons[0].ID},
+		},
+	}
+
+	// User not logged in.
+	rsp := rapi.ImportHosts(ctx, params)
+	require.IsType(t, &dhcp.ImportHostsDefault{}, rsp)
+	require.Equal(t, http.StatusForbidden, getStatusCode(*rsp.(*dhcp.ImportHostsDefault)))
+
+	err = rapi.SessionManager.LoginHandler(ctx, &dbmodel.SystemUser{ID: 1})
+	require.NoError(t, err)
+
+	// Non-existing daemon.
+	params.Hosts.DaemonIds = []int64{1000}
+	rsp = rapi.ImportHosts(ctx, params)
+	require.IsType(t, &dhcp.ImportHostsDefault{}, rsp)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*rsp.(*dhcp.ImportHostsDefault)))
+
+	// No daemons.
+	params.Hosts.DaemonIds = []int64{}
+	rsp = rapi.ImportHosts(ctx, params)
+	require.IsType(t, &dhcp.ImportHostsDefault{}, rsp)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*rsp.(*dhcp.ImportHostsDefault)))
+
+	// Unsupported format.
+	params.Hosts.DaemonIds = []int64{apps[0].Daemons[0].ID}
+	format = "xml"
+	rsp = rapi.ImportHosts(ctx, params)
+	require.IsType(t, &dhcp.ImportHostsDefault{}, rsp)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*rsp.(*dhcp.ImportHostsDefault)))
+
+	// No hosts.
+	rsp = rapi.ImportHosts(ctx, dhcp.ImportHostsParams{})
+	require.IsType(t, &dhcp.ImportHostsDefault{}, rsp)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*rsp.(*dhcp.ImportHostsDefault)))
+
+	require.Empty(t, fa.RecordedCommands)
+}
@@ -383,6 +383,14 @@ func (r *RestAPI) commonCreateOrUpdateHostSubmit(ctx context.Context, transactio
 		log.Error(err)
 		return http.StatusInternalServerError, msg
 	}
+	// Remember the host before the update for the audit trail. It is
+	// not present when a new host is created.
+	var hostBefore *models.Host
+	if state, ok := config.GetTransactionState(cctx); ok && len(state.Updates) > 0 {
+		if dbHostBefore, ok := state.Updates[0].Recipe["host_before_update"].(dbmodel.Host); ok {
+			hostBefore = r.convertFromHost(&dbHostBefore)
+		}
+	}
 	// Apply the host information (create Kea commands).
 	cctx, err = applyFunc(cctx, host)
 	if err != nil {
@@ -397,11 +405,39 @@ func (r *RestAPI) commonCreateOrUpdateHostSubmit(ctx context.Context, transactio
 		log.Error(err)
 		return http.StatusConflict, msg
 	}
+	if hostBefore != nil {
+		r.addAuditRecord(ctx, dbmodel.AuditTargetHost, host.ID, hostBefore, r.convertFromHost(host))
+	} else {
+		r.addNewHostsAuditRecords(ctx, []*dbmodel.Host{host})
+	}
 	// Everything ok. Cleanup and send OK to the client.
 	r.ConfigManager.Done(cctx)
 	return 0, ""
 }
 
+// Writes the audit records of the new host reservations. The new host
+// reservations are stored in the database when they are fetched from Kea
+// by the host reservations puller, so they have no IDs yet. Therefore,
+// the audit records are written for the daemons receiving them.
+func (r *RestAPI) addNewHostsAuditRecords(ctx context.Context, hosts []*dbmodel.Host) {
+	var daemonIDs []int64
+	daemonHosts := make(map[int64][]*models.Host)
+	for _, host := range hosts {
+		restHost := r.convertFromHost(host)
+		for _, lh := range host.LocalHosts {
+			if _, ok := daemonHosts[lh.DaemonID]; !ok {
+				daemonIDs = append(daemonIDs, lh.DaemonID)
+			}
+			daemonHosts[lh.DaemonID] = append(daemonHosts[lh.DaemonID], restHost)
+		}
+	}
+	for _, daemonID := range daemonIDs {
+		r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, daemonID, nil, map[string]interface{}{
+			"hosts": daemonHosts[daemonID],
+		})
+	}
+}
+
 // Implements the POST call to apply and commit host reservation (hosts/new/transaction/{id}/submit).
 func (r *RestAPI) CreateHostSubmit(ctx context.Context, params dhcp.CreateHostSubmitParams) middleware.Responder {
 	if code, msg := r.commonCreateOrUpdateHostSubmit(ctx, params.ID, params.Host, r.ConfigManager.GetKeaModule().ApplyHostAdd); code != 0 {
@@ -623,6 +659,7 @@ func (r *RestAPI) DeleteHost(ctx context.Context, params dhcp.DeleteHostParams)
 		})
 		return rsp
 	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetHost, dbHost.ID, r.convertFromHost(dbHost), nil)
 	// Send OK to the client.
 	rsp := dhcp.NewDeleteHostOK()
 	return rsp
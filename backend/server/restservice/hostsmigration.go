@@ -0,0 +1,103 @@
+package restservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"isc.org/stork/server/config"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/services"
+)
+
+// Begins, applies and commits the migration of the host reservations from
+// the daemon's configuration into the host database. It returns the number
+// of the migrated host reservations, the HTTP error code if an error occurs
+// or 0 when there is no error and an error string to be included in the
+// HTTP response.
+func (r *RestAPI) commonMigrateDaemonHosts(ctx context.Context, daemonID int64) (int64, int, string) {
+	// Get the logged user's ID.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to migrate host reservations because user is not logged in"
+		log.Error("problem with creating transaction context because user has no session")
+		return 0, http.StatusForbidden, msg
+	}
+	// Create configuration context.
+	cctx, err := r.ConfigManager.CreateContext(int64(user.ID))
+	if err != nil {
+		msg := "problem with creating transaction context"
+		log.Error(err)
+		return 0, http.StatusInternalServerError, msg
+	}
+	// Begin the migration. It retrieves the daemon and locks it for updates.
+	cctx, err = r.ConfigManager.GetKeaModule().BeginHostsMigration(cctx, daemonID)
+	if err != nil {
+		var (
+			daemonNotFound *config.DaemonNotFoundError
+			lock           *config.LockError
+		)
+		switch {
+		case errors.As(err, &daemonNotFound):
+			// Failed to find daemon.
+			msg := err.Error()
+			log.Error(err)
+			return 0, http.StatusNotFound, msg
+		case errors.As(err, &lock):
+			// Failed to lock daemon.
+			msg := err.Error()
+			log.Error(err)
+			return 0, http.StatusLocked, msg
+		default:
+			// The daemon does not qualify for the migration.
+			msg := fmt.Sprintf("problem with initializing host reservations migration: %s", err)
+			log.Error(err)
+			return 0, http.StatusBadRequest, msg
+		}
+	}
+	// Unlock the daemon when done.
+	defer r.ConfigManager.Done(cctx)
+
+	// Apply the migration (create Kea commands).
+	cctx, migrated, err := r.ConfigManager.GetKeaModule().ApplyHostsMigration(cctx)
+	if err != nil {
+		msg := fmt.Sprintf("problem with applying host reservations migration: %s", err)
+		log.Error(err)
+		return 0, http.StatusBadRequest, msg
+	}
+	// Test the configuration and send the commands to Kea server.
+	cctx, err = r.ConfigManager.Commit(cctx)
+	if err != nil {
+		msg := fmt.Sprintf("problem with committing host reservations migration: %s", err)
+		log.Error(err)
+		return 0, http.StatusConflict, msg
+	}
+	return migrated, 0, ""
+}
+
+// Implements the POST call to migrate the host reservations from the
+// daemon's configuration into the host database (daemons/{id}/hosts-migration).
+// If the daemon rejects the configuration without the reservations, the
+// Conflict status code is returned with the error reported by the daemon.
+func (r *RestAPI) MigrateDaemonHosts(ctx context.Context, params services.MigrateDaemonHostsParams) middleware.Responder {
+	migrated, code, msg := r.commonMigrateDaemonHosts(ctx, params.ID)
+	if code != 0 {
+		// Error case.
+		rsp := services.NewMigrateDaemonHostsDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	result := &models.HostsMigrationResult{
+		DaemonID:      params.ID,
+		MigratedHosts: migrated,
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, params.ID, nil, result)
+
+	rsp := services.NewMigrateDaemonHostsOK().WithPayload(result)
+	return rsp
+}
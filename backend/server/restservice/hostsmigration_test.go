@@ -0,0 +1,237 @@
+package restservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	keactrl "isc.org/stork/appctrl/kea"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	apps "isc.org/stork/server/apps"
+	appstest "isc.org/stork/server/apps/test"
+	dbops "isc.org/stork/server/database"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/restapi/operations/services"
+	storktest "isc.org/stork/server/test/dbmodel"
+)
+
+// Configuration of the daemon whose host reservations are migrated.
+const testHostsMigrationConfig = `{
+    "Dhcp4": {
+        "hosts-database": {
+            "type": "mysql",
+            "name": "kea"
+        },
+        "reservations": [
+            {
+                "hw-address": "0a:0b:0c:0d:0e:0f",
+                "hostname": "migrated.example.org"
+            }
+        ],
+        "hooks-libraries": [
+            {
+                "library": "libdhcp_host_cmds.so"
+            }
+        ]
+    }
+}`
+
+// Creates the fake agents returning the daemon's configuration in response
+// to the config-get command. The responses to the remaining commands are
+// generated by the specified function, if it is not nil.
+func newTestHostsMigrationFakeAgents(mock func(command string, cmdResponses []interface{})) *agentcommtest.FakeAgents {
+	var fa *agentcommtest.FakeAgents
+	fa = agentcommtest.NewFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		command := fa.RecordedCommands[len(fa.RecordedCommands)-1].GetCommand()
+		if command == "config-get" {
+			json := fmt.Sprintf(`[
+                {
+                    "result": 0,
+                    "arguments": %s
+                }
+            ]`, testHostsMigrationConfig)
+			_ = keactrl.UnmarshalResponseList(keactrl.NewCommand(command, []string{"dhcp4"}, nil), []byte(json), cmdResponses[0])
+			return
+		}
+		if mock != nil {
+			mock(command, cmdResponses)
+		}
+	}, nil)
+	return fa
+}
+
+// Creates the REST API with the config manager and the logged user, and
+// adds the test hosts. The configuration of the first daemon is replaced
+// with the configuration using a host database and including a global
+// host reservation. The reservation is also added to the database. It
+// returns the API, the context with the user session and the apps.
+func newTestHostsMigrationAPI(t *testing.T, db *dbops.PgDB, dbSettings *dbops.DatabaseSettings, fa *agentcommtest.FakeAgents) (*RestAPI, context.Context, []dbmodel.App) {
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	user, err := dbmodel.GetUserByID(db, 1)
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, apps := storktest.AddTestHosts(t, db)
+
+	daemon := apps[0].Daemons[0]
+	err = daemon.SetConfigFromJSON(testHostsMigrationConfig)
+	require.NoError(t, err)
+	err = dbmodel.UpdateDaemon(db, daemon)
+	require.NoError(t, err)
+
+	host := &dbmodel.Host{
+		Hostname: "migrated.example.org",
+		HostIdentifiers: []dbmodel.HostIdentifier{
+			{
+				Type:  "hw-address",
+				Value: []byte{10, 11, 12, 13, 14, 15},
+			},
+		},
+		LocalHosts: []dbmodel.LocalHost{
+			{
+				DaemonID:   daemon.ID,
+				DataSource: dbmodel.HostDataSourceConfig,
+			},
+		},
+	}
+	err = dbmodel.AddHost(db, host)
+	require.NoError(t, err)
+
+	return rapi, ctx, apps
+}
+
+// Test that the host reservations are migrated from the daemon's
+// configuration into the host database.
+func TestMigrateDaemonHosts(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := newTestHostsMigrationFakeAgents(nil)
+	rapi, ctx, apps := newTestHostsMigrationAPI(t, db, dbSettings, fa)
+
+	params := services.MigrateDaemonHostsParams{
+		ID: apps[0].Daemons[0].ID,
+	}
+	rsp := rapi.MigrateDaemonHosts(ctx, params)
+	require.IsType(t, &services.MigrateDaemonHostsOK{}, rsp)
+	okRsp := rsp.(*services.MigrateDaemonHostsOK)
+	require.Equal(t, apps[0].Daemons[0].ID, okRsp.Payload.DaemonID)
+	require.EqualValues(t, 1, okRsp.Payload.MigratedHosts)
+
+	// The configuration should have been fetched and tested, the
+	// reservation added to the host database, verified and removed from
+	// the configuration.
+	require.Len(t, fa.RecordedCommands, 6)
+	expected := []string{"config-get", "config-test", "reservation-add", "reservation-get", "config-set", "config-write"}
+	for i, c := range fa.RecordedCommands {
+		require.Equal(t, expected[i], c.GetCommand())
+	}
+	require.JSONEq(t, `{
+        "command": "reservation-add",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "reservation": {
+                "hw-address": "0a0b0c0d0e0f",
+                "hostname": "migrated.example.org",
+                "subnet-id": 0
+            }
+        }
+    }`, fa.RecordedCommands[2].Marshal())
+	require.NotContains(t, fa.RecordedCommands[4].Marshal(), "reservations")
+
+	// The migration should have been audited.
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, dbmodel.AuditTargetDaemon, records[0].TargetType)
+	require.Equal(t, apps[0].Daemons[0].ID, records[0].TargetID)
+
+	// The daemon should have been unlocked, so the migration can be
+	// repeated.
+	rsp = rapi.MigrateDaemonHosts(ctx, params)
+	require.IsType(t, &services.MigrateDaemonHostsOK{}, rsp)
+}
+
+// Test that the migration is refused for the daemon without a host
+// database.
+func TestMigrateDaemonHostsNoHostsDatabase(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, ctx, apps := newTestHostsMigrationAPI(t, db, dbSettings, fa)
+
+	params := services.MigrateDaemonHostsParams{
+		ID: apps[1].Daemons[0].ID,
+	}
+	rsp := rapi.MigrateDaemonHosts(ctx, params)
+	require.IsType(t, &services.MigrateDaemonHostsDefault{}, rsp)
+	defaultRsp := rsp.(*services.MigrateDaemonHostsDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+	require.Empty(t, fa.RecordedCommands)
+}
+
+// Test that the migration is aborted when the daemon rejects the
+// configuration without the host reservations.
+func TestMigrateDaemonHostsRejected(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := newTestHostsMigrationFakeAgents(func(command string, cmdResponses []interface{}) {
+		mockStatusError(command, cmdResponses)
+	})
+	rapi, ctx, apps := newTestHostsMigrationAPI(t, db, dbSettings, fa)
+
+	params := services.MigrateDaemonHostsParams{
+		ID: apps[0].Daemons[0].ID,
+	}
+	rsp := rapi.MigrateDaemonHosts(ctx, params)
+	require.IsType(t, &services.MigrateDaemonHostsDefault{}, rsp)
+	defaultRsp := rsp.(*services.MigrateDaemonHostsDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp))
+
+	// The reservations should not be migrated.
+	require.Len(t, fa.RecordedCommands, 2)
+	require.Equal(t, "config-get", fa.RecordedCommands[0].GetCommand())
+	require.Equal(t, "config-test", fa.RecordedCommands[1].GetCommand())
+}
+
+// Test error case when a user attempts to migrate the host reservations
+// of a non-existing daemon.
+func TestMigrateDaemonHostsNonExistingDaemon(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, ctx, _ := newTestHostsMigrationAPI(t, db, dbSettings, fa)
+
+	params := services.MigrateDaemonHostsParams{
+		ID: 1000,
+	}
+	rsp := rapi.MigrateDaemonHosts(ctx, params)
+	require.IsType(t, &services.MigrateDaemonHostsDefault{}, rsp)
+	defaultRsp := rsp.(*services.MigrateDaemonHostsDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+}
@@ -0,0 +1,76 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	log "github.com/sirupsen/logrus"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+)
+
+// Converts the lease conflict to the format used in REST API.
+func leaseConflictToRestAPI(c *dbmodel.LeaseConflict) *models.LeaseConflict {
+	conflict := &models.LeaseConflict{
+		ID:         c.ID,
+		DetectedAt: strfmt.DateTime(c.DetectedAt),
+		SubnetID:   c.SubnetID,
+		HostID:     c.HostID,
+		DaemonID:   c.DaemonID,
+		IPAddress:  c.Address,
+		HwAddress:  c.HWAddress,
+		ClientID:   c.ClientID,
+		Duid:       c.DUID,
+		Hostname:   c.Hostname,
+	}
+	if c.Subnet != nil {
+		conflict.SubnetPrefix = c.Subnet.Prefix
+	}
+	if c.Host != nil {
+		conflict.ReservedHostname = c.Host.Hostname
+	}
+	if c.Daemon != nil && c.Daemon.App != nil {
+		conflict.AppID = c.Daemon.App.ID
+		conflict.AppName = c.Daemon.App.Name
+	}
+	return conflict
+}
+
+// Returns the conflicts between the leases and the host reservations
+// detected by the lease conflicts puller. The conflicts can be filtered
+// by the subnet ID.
+func (r *RestAPI) GetLeaseConflicts(ctx context.Context, params dhcp.GetLeaseConflictsParams) middleware.Responder {
+	var start int64
+	if params.Start != nil {
+		start = *params.Start
+	}
+
+	var limit int64 = 10
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	dbConflicts, total, err := dbmodel.GetLeaseConflictsByPage(r.DB, start, limit, params.SubnetID)
+	if err != nil {
+		msg := "Problem fetching lease conflicts from the database"
+		log.Error(err)
+		rsp := dhcp.NewGetLeaseConflictsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	conflicts := &models.LeaseConflicts{
+		Items: []*models.LeaseConflict{},
+		Total: total,
+	}
+	for i := range dbConflicts {
+		conflicts.Items = append(conflicts.Items, leaseConflictToRestAPI(&dbConflicts[i]))
+	}
+
+	rsp := dhcp.NewGetLeaseConflictsOK().WithPayload(conflicts)
+	return rsp
+}
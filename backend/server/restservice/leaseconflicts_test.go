@@ -0,0 +1,90 @@
+package restservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storktest "isc.org/stork/server/test/dbmodel"
+)
+
+// Test getting the lease conflicts over the REST API.
+func TestGetLeaseConflicts(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	hosts, apps := storktest.AddTestHosts(t, db)
+
+	_, err := dbmodel.ReplaceLeaseConflicts(db, []dbmodel.LeaseConflict{
+		{
+			SubnetID:  1,
+			HostID:    hosts[0].ID,
+			DaemonID:  apps[0].Daemons[0].ID,
+			Address:   "192.0.2.4",
+			HWAddress: "01:01:01:01:01:01",
+			Hostname:  "other.example.org",
+		},
+		{
+			SubnetID: 2,
+			HostID:   hosts[2].ID,
+			DaemonID: apps[0].Daemons[1].ID,
+			Address:  "2001:db8:1::1",
+			DUID:     "01:02:03",
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, err := NewRestAPI(dbSettings, db, fa)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Get all conflicts.
+	rsp := rapi.GetLeaseConflicts(ctx, dhcp.GetLeaseConflictsParams{})
+	require.IsType(t, &dhcp.GetLeaseConflictsOK{}, rsp)
+	okRsp := rsp.(*dhcp.GetLeaseConflictsOK)
+	require.EqualValues(t, 2, okRsp.Payload.Total)
+	require.Len(t, okRsp.Payload.Items, 2)
+
+	conflict := okRsp.Payload.Items[0]
+	require.NotZero(t, conflict.ID)
+	require.NotZero(t, conflict.DetectedAt)
+	require.EqualValues(t, 1, conflict.SubnetID)
+	require.Equal(t, "192.0.2.0/24", conflict.SubnetPrefix)
+	require.Equal(t, hosts[0].ID, conflict.HostID)
+	require.Equal(t, hosts[0].Hostname, conflict.ReservedHostname)
+	require.Equal(t, apps[0].Daemons[0].ID, conflict.DaemonID)
+	require.Equal(t, apps[0].ID, conflict.AppID)
+	require.Equal(t, apps[0].Name, conflict.AppName)
+	require.Equal(t, "192.0.2.4", conflict.IPAddress)
+	require.Equal(t, "01:01:01:01:01:01", conflict.HwAddress)
+	require.Equal(t, "other.example.org", conflict.Hostname)
+
+	// Filter by subnet.
+	subnetID := int64(2)
+	rsp = rapi.GetLeaseConflicts(ctx, dhcp.GetLeaseConflictsParams{
+		SubnetID: &subnetID,
+	})
+	require.IsType(t, &dhcp.GetLeaseConflictsOK{}, rsp)
+	okRsp = rsp.(*dhcp.GetLeaseConflictsOK)
+	require.EqualValues(t, 1, okRsp.Payload.Total)
+	require.Equal(t, "2001:db8:1::1", okRsp.Payload.Items[0].IPAddress)
+	require.Equal(t, "01:02:03", okRsp.Payload.Items[0].Duid)
+
+	// Get the second page.
+	start := int64(1)
+	limit := int64(1)
+	rsp = rapi.GetLeaseConflicts(ctx, dhcp.GetLeaseConflictsParams{
+		Start: &start,
+		Limit: &limit,
+	})
+	require.IsType(t, &dhcp.GetLeaseConflictsOK{}, rsp)
+	okRsp = rsp.(*dhcp.GetLeaseConflictsOK)
+	require.EqualValues(t, 2, okRsp.Payload.Total)
+	require.Len(t, okRsp.Payload.Items, 1)
+	require.Equal(t, "2001:db8:1::1", okRsp.Payload.Items[0].IPAddress)
+}
@@ -1,20 +1,66 @@
 package restservice
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/go-openapi/runtime/middleware"
 	log "github.com/sirupsen/logrus"
 
+	keadata "isc.org/stork/appdata/kea"
 	"isc.org/stork/server/apps/kea"
 	dbmodel "isc.org/stork/server/database/model"
 	"isc.org/stork/server/gen/models"
 	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storkutil "isc.org/stork/util"
 )
 
+// Converts the lease to the format used in REST API.
+func leaseToRestAPI(l *dbmodel.Lease) *models.Lease {
+	var appName string
+	if l.App != nil {
+		appName = l.App.Name
+	}
+	cltt := int64(l.CLTT)
+	state := int64(l.State)
+	subnetID := int64(l.SubnetID)
+	validLifetime := int64(l.ValidLifetime)
+
+	// Handle a special case when returned DUID is equal to 00. Kea returns such DUID
+	// in declined DHCPv6 leases. We treat is as empty DUID.
+	duid := ""
+	if len(l.DUID) > 0 && l.DUID != "00" {
+		duid = l.DUID
+	}
+	return &models.Lease{
+		ID:                &l.ID,
+		AppID:             &l.AppID,
+		AppName:           &appName,
+		ClientID:          l.ClientID,
+		Cltt:              &cltt,
+		Duid:              duid,
+		FqdnFwd:           l.FqdnFwd,
+		FqdnRev:           l.FqdnRev,
+		Hostname:          l.Hostname,
+		HwAddress:         l.HWAddress,
+		Iaid:              int64(l.IAID),
+		IPAddress:         &l.IPAddress,
+		LeaseType:         l.Type,
+		PreferredLifetime: int64(l.PreferredLifetime),
+		PrefixLength:      int64(l.PrefixLength),
+		State:             &state,
+		SubnetID:          &subnetID,
+		ValidLifetime:     &validLifetime,
+	}
+}
+
 // This call searches for leases allocated by monitored DHCP servers.
 // The text parameter may contain an IP address, delegated prefix,
 // MAC address, client identifier, hostname or the text state:declined.
@@ -77,43 +123,7 @@ func (r *RestAPI) GetLeases(ctx context.Context, params dhcp.GetLeasesParams) mi
 
 	// Return leases over the REST API.
 	for i := range keaLeases {
-		l := keaLeases[i]
-		var appName string
-		if l.App != nil {
-			appName = l.App.Name
-		}
-		cltt := int64(l.CLTT)
-		state := int64(l.State)
-		subnetID := int64(l.SubnetID)
-		validLifetime := int64(l.ValidLifetime)
-
-		// Handle a special case when returned DUID is equal to 00. Kea returns such DUID
-		// in declined DHCPv6 leases. We treat is as empty DUID.
-		duid := ""
-		if len(l.DUID) > 0 && l.DUID != "00" {
-			duid = l.DUID
-		}
-		lease := models.Lease{
-			ID:                &l.ID,
-			AppID:             &l.AppID,
-			AppName:           &appName,
-			ClientID:          l.ClientID,
-			Cltt:              &cltt,
-			Duid:              duid,
-			FqdnFwd:           l.FqdnFwd,
-			FqdnRev:           l.FqdnRev,
-			Hostname:          l.Hostname,
-			HwAddress:         l.HWAddress,
-			Iaid:              int64(l.IAID),
-			IPAddress:         &l.IPAddress,
-			LeaseType:         l.Type,
-			PreferredLifetime: int64(l.PreferredLifetime),
-			PrefixLength:      int64(l.PrefixLength),
-			State:             &state,
-			SubnetID:          &subnetID,
-			ValidLifetime:     &validLifetime,
-		}
-		leases.Items = append(leases.Items, &lease)
+		leases.Items = append(leases.Items, leaseToRestAPI(&keaLeases[i]))
 	}
 
 	// Record conflicting leases and leases count.
@@ -131,3 +141,416 @@ func (r *RestAPI) GetLeases(ctx context.Context, params dhcp.GetLeasesParams) mi
 	rsp := dhcp.NewGetLeasesOK().WithPayload(leases)
 	return rsp
 }
+
+// Returns the logged user and fetches the Kea app with the daemon
+// receiving the lease command. The permission to modify leases is checked
+// by the authorization middleware. The daemon must
+// use the lease_cmds hooks library. It returns the HTTP error code if an
+// error occurs or 0 when there is no error. In addition it returns an
+// error string to be included in the HTTP response or an empty string if
+// there is no error.
+func (r *RestAPI) getLeaseActionDaemon(ctx context.Context, appID int64, daemonName string) (*dbmodel.SystemUser, *dbmodel.Daemon, int, string) {
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "Unable to modify leases because user is not logged in"
+		log.Error(msg)
+		return nil, nil, http.StatusForbidden, msg
+	}
+	app, err := dbmodel.GetAppByID(r.DB, appID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching app with ID %d from the database", appID)
+		log.Error(err)
+		return nil, nil, http.StatusInternalServerError, msg
+	}
+	if app == nil {
+		msg := fmt.Sprintf("Cannot find app with ID %d", appID)
+		log.Error(msg)
+		return nil, nil, http.StatusNotFound, msg
+	}
+	daemon := app.GetDaemonByName(daemonName)
+	if app.Type != dbmodel.AppTypeKea || daemon == nil || daemon.KeaDaemon == nil {
+		msg := fmt.Sprintf("App with ID %d has no Kea %s daemon", appID, daemonName)
+		log.Error(msg)
+		return nil, nil, http.StatusBadRequest, msg
+	}
+	if daemon.KeaDaemon.Config == nil {
+		msg := fmt.Sprintf("Configuration of the Kea %s daemon in app with ID %d is unknown", daemonName, appID)
+		log.Error(msg)
+		return nil, nil, http.StatusBadRequest, msg
+	}
+	if _, _, ok := daemon.KeaDaemon.Config.GetHooksLibrary("libdhcp_lease_cmds"); !ok {
+		msg := fmt.Sprintf("Kea %s daemon in app with ID %d does not use the lease_cmds hooks library", daemonName, appID)
+		log.Error(msg)
+		return nil, nil, http.StatusBadRequest, msg
+	}
+	daemon.App = app
+	return user, daemon, 0, ""
+}
+
+// Converts an error returned by a lease command to the HTTP error code
+// and the error string to be included in the HTTP response.
+func getLeaseActionError(err error, operation string) (int, string) {
+	var notFound *kea.LeaseNotFoundError
+	if errors.As(err, &notFound) {
+		log.Error(err)
+		return http.StatusNotFound, notFound.Error()
+	}
+	msg := fmt.Sprintf("Problem with %s: %s", operation, err)
+	log.Error(err)
+	return http.StatusInternalServerError, msg
+}
+
+// Deletes the lease for the specified IP address or delegated prefix in
+// the Kea server. The lease4-del or lease6-del command is sent depending
+// on the address family.
+func (r *RestAPI) DeleteLease(ctx context.Context, params dhcp.DeleteLeaseParams) middleware.Responder {
+	if params.Lease == nil || params.Lease.AppID == nil || params.Lease.IPAddress == nil {
+		msg := "Lease to be deleted not specified"
+		log.Error(msg)
+		rsp := dhcp.NewDeleteLeaseDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	ipAddress := strings.TrimSpace(*params.Lease.IPAddress)
+	parsedIP := storkutil.ParseIP(ipAddress)
+	if parsedIP == nil || (parsedIP.Protocol == storkutil.IPv4 && parsedIP.Prefix) {
+		msg := fmt.Sprintf("Invalid IP address or prefix %s", ipAddress)
+		log.Error(msg)
+		rsp := dhcp.NewDeleteLeaseDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	daemonName := dbmodel.DaemonNameDHCPv4
+	if parsedIP.Protocol == storkutil.IPv6 {
+		daemonName = dbmodel.DaemonNameDHCPv6
+	}
+	user, daemon, code, msg := r.getLeaseActionDaemon(ctx, *params.Lease.AppID, daemonName)
+	if code == 0 {
+		var err error
+		if parsedIP.Protocol == storkutil.IPv6 {
+			leaseType := params.Lease.LeaseType
+			if len(leaseType) == 0 {
+				leaseType = "IA_NA"
+				if parsedIP.Prefix {
+					leaseType = "IA_PD"
+				}
+			}
+			err = kea.DeleteLease6(r.Agents, daemon.App, leaseType, parsedIP.NetworkPrefix)
+		} else {
+			err = kea.DeleteLease4(r.Agents, daemon.App, ipAddress)
+		}
+		if err != nil {
+			code, msg = getLeaseActionError(err, "deleting the lease")
+		}
+	}
+	if code != 0 {
+		rsp := dhcp.NewDeleteLeaseDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.EventCenter.AddWarningEvent(fmt.Sprintf("{user} deleted lease %s in {daemon}", ipAddress), user, daemon, daemon.App, daemon.App.Machine)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, daemon.ID, map[string]interface{}{
+		"lease": params.Lease,
+	}, nil)
+
+	rsp := dhcp.NewDeleteLeaseOK()
+	return rsp
+}
+
+// Updates an existing DHCPv4 lease in the Kea server with the
+// lease4-update command.
+func (r *RestAPI) UpdateLease(ctx context.Context, params dhcp.UpdateLeaseParams) middleware.Responder {
+	if params.Lease == nil || params.Lease.AppID == nil || params.Lease.IPAddress == nil ||
+		params.Lease.HwAddress == nil || params.Lease.SubnetID == nil {
+		msg := "Updated lease not specified"
+		log.Error(msg)
+		rsp := dhcp.NewUpdateLeaseDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	ipAddress := strings.TrimSpace(*params.Lease.IPAddress)
+	if parsedIP := storkutil.ParseIP(ipAddress); parsedIP == nil || parsedIP.Protocol != storkutil.IPv4 || parsedIP.Prefix {
+		msg := fmt.Sprintf("Invalid IPv4 address %s", ipAddress)
+		log.Error(msg)
+		rsp := dhcp.NewUpdateLeaseDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	user, daemon, code, msg := r.getLeaseActionDaemon(ctx, *params.Lease.AppID, dbmodel.DaemonNameDHCPv4)
+	if code == 0 {
+		lease := keadata.Lease{
+			ClientID:      params.Lease.ClientID,
+			FqdnFwd:       params.Lease.FqdnFwd,
+			FqdnRev:       params.Lease.FqdnRev,
+			Hostname:      params.Lease.Hostname,
+			HWAddress:     *params.Lease.HwAddress,
+			IPAddress:     ipAddress,
+			SubnetID:      uint32(*params.Lease.SubnetID),
+			ValidLifetime: uint32(params.Lease.ValidLifetime),
+		}
+		if err := kea.UpdateLease4(r.Agents, daemon.App, lease); err != nil {
+			code, msg = getLeaseActionError(err, "updating the lease")
+		}
+	}
+	if code != 0 {
+		rsp := dhcp.NewUpdateLeaseDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.EventCenter.AddInfoEvent(fmt.Sprintf("{user} updated lease %s in {daemon}", ipAddress), user, daemon, daemon.App, daemon.App.Machine)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, daemon.ID, nil, map[string]interface{}{
+		"lease": params.Lease,
+	})
+
+	rsp := dhcp.NewUpdateLeaseOK()
+	return rsp
+}
+
+// Deletes all DHCPv4 leases in the subnet in the Kea server with the
+// lease4-wipe command.
+func (r *RestAPI) WipeLeases(ctx context.Context, params dhcp.WipeLeasesParams) middleware.Responder {
+	if params.Wipe == nil || params.Wipe.AppID == nil || params.Wipe.SubnetID == nil {
+		msg := "Subnet whose leases should be deleted not specified"
+		log.Error(msg)
+		rsp := dhcp.NewWipeLeasesDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	subnetID := *params.Wipe.SubnetID
+	user, daemon, code, msg := r.getLeaseActionDaemon(ctx, *params.Wipe.AppID, dbmodel.DaemonNameDHCPv4)
+	if code == 0 {
+		if err := kea.WipeLeases4(r.Agents, daemon.App, subnetID); err != nil {
+			code, msg = getLeaseActionError(err, "deleting the leases")
+		}
+	}
+	if code != 0 {
+		rsp := dhcp.NewWipeLeasesDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.EventCenter.AddWarningEvent(fmt.Sprintf("{user} deleted all leases in subnet with ID %d in {daemon}", subnetID), user, daemon, daemon.App, daemon.App.Machine)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, daemon.ID, map[string]interface{}{
+		"leases": params.Wipe,
+	}, nil)
+
+	rsp := dhcp.NewWipeLeasesOK()
+	return rsp
+}
+
+// Requests the Kea server to resend the DNS update for the DHCPv4 lease
+// with the lease4-resend-ddns command.
+func (r *RestAPI) ResendLeaseDdns(ctx context.Context, params dhcp.ResendLeaseDdnsParams) middleware.Responder {
+	if params.Lease == nil || params.Lease.AppID == nil || params.Lease.IPAddress == nil {
+		msg := "Lease for which the DNS update should be sent not specified"
+		log.Error(msg)
+		rsp := dhcp.NewResendLeaseDdnsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	ipAddress := strings.TrimSpace(*params.Lease.IPAddress)
+	user, daemon, code, msg := r.getLeaseActionDaemon(ctx, *params.Lease.AppID, dbmodel.DaemonNameDHCPv4)
+	if code == 0 {
+		if err := kea.ResendLease4DDNS(r.Agents, daemon.App, ipAddress); err != nil {
+			code, msg = getLeaseActionError(err, "resending the DNS update")
+		}
+	}
+	if code != 0 {
+		rsp := dhcp.NewResendLeaseDdnsDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.EventCenter.AddInfoEvent(fmt.Sprintf("{user} resent DNS update for lease %s in {daemon}", ipAddress), user, daemon, daemon.App, daemon.App.Machine)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, daemon.ID, nil, map[string]interface{}{
+		"ddnsUpdate": params.Lease,
+	})
+
+	rsp := dhcp.NewResendLeaseDdnsOK()
+	return rsp
+}
+
+// Sorts the leases by the specified field, i.e. expiry, state, hostname
+// or IP address. The leases are sorted by IP address when the field is
+// not recognized. The leases having equal values of the field are sorted
+// by IP address and then by app ID.
+func sortLeases(leases []dbmodel.Lease, sortField string, sortDir dbmodel.SortDirEnum) {
+	compareAddresses := func(i, j int) int {
+		ipi := net.ParseIP(leases[i].IPAddress)
+		ipj := net.ParseIP(leases[j].IPAddress)
+		if c := bytes.Compare(ipi.To16(), ipj.To16()); c != 0 {
+			return c
+		}
+		switch {
+		case leases[i].AppID < leases[j].AppID:
+			return -1
+		case leases[i].AppID > leases[j].AppID:
+			return 1
+		default:
+			return 0
+		}
+	}
+	sort.SliceStable(leases, func(i, j int) bool {
+		var c int
+		switch sortField {
+		case "expiry":
+			expiryi := leases[i].CLTT + uint64(leases[i].ValidLifetime)
+			expiryj := leases[j].CLTT + uint64(leases[j].ValidLifetime)
+			switch {
+			case expiryi < expiryj:
+				c = -1
+			case expiryi > expiryj:
+				c = 1
+			}
+		case "state":
+			c = leases[i].State - leases[j].State
+		case "hostname":
+			c = strings.Compare(leases[i].Hostname, leases[j].Hostname)
+		}
+		if c == 0 {
+			c = compareAddresses(i, j)
+		}
+		if sortDir == dbmodel.SortDirDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// Removes the duplicated leases returned by the Kea servers sharing the
+// subnet, e.g. the HA peers. The leases are duplicated when they have the
+// same IP address or delegated prefix. The most recently renewed lease is
+// preserved. The order of the remaining leases is not changed.
+func deduplicateLeases(leases []dbmodel.Lease) []dbmodel.Lease {
+	indexes := make(map[string]int)
+	deduplicated := []dbmodel.Lease{}
+	for _, lease := range leases {
+		key := fmt.Sprintf("%s/%d", lease.IPAddress, lease.PrefixLength)
+		if i, ok := indexes[key]; ok {
+			if lease.CLTT > deduplicated[i].CLTT {
+				deduplicated[i] = lease
+			}
+			continue
+		}
+		indexes[key] = len(deduplicated)
+		deduplicated = append(deduplicated, lease)
+	}
+	return deduplicated
+}
+
+// Fetches the leases in the subnet from the Kea servers serving this
+// subnet. The leases returned by multiple servers (e.g., HA peers) are
+// reported once. The leases are sorted and paginated by the server, so
+// all leases in the subnet are fetched from the Kea servers for each page.
+func (r *RestAPI) GetSubnetLeases(ctx context.Context, params dhcp.GetSubnetLeasesParams) middleware.Responder {
+	var start int64
+	if params.Start != nil {
+		start = *params.Start
+	}
+
+	var limit int64 = 10
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	if start < 0 || limit < 0 {
+		msg := "Pagination start and limit must not be negative"
+		log.Error(msg)
+		rsp := dhcp.NewGetSubnetLeasesDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	var sortField string
+	if params.SortField != nil {
+		sortField = *params.SortField
+	}
+	if len(sortField) > 0 && sortField != "expiry" && sortField != "state" && sortField != "hostname" && sortField != "ipAddress" {
+		msg := fmt.Sprintf("Unsupported lease sort field %s", sortField)
+		log.Error(msg)
+		rsp := dhcp.NewGetSubnetLeasesDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	sortDir := dbmodel.SortDirAsc
+	if params.SortDir != nil {
+		switch *params.SortDir {
+		case "asc":
+		case "desc":
+			sortDir = dbmodel.SortDirDesc
+		default:
+			msg := fmt.Sprintf("Unsupported lease sort direction %s", *params.SortDir)
+			log.Error(msg)
+			rsp := dhcp.NewGetSubnetLeasesDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+	}
+
+	subnet, err := dbmodel.GetSubnet(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching subnet with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := dhcp.NewGetSubnetLeasesDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if subnet == nil {
+		msg := fmt.Sprintf("Cannot find subnet with ID %d", params.ID)
+		log.Error(msg)
+		rsp := dhcp.NewGetSubnetLeasesDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	keaLeases, erredApps, err := kea.FindLeasesBySubnet(r.DB, r.Agents, subnet)
+	if err != nil {
+		msg := "Problem searching leases on Kea servers due to Stork database errors"
+		log.Error(err)
+		rsp := dhcp.NewGetSubnetLeasesDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	keaLeases = deduplicateLeases(keaLeases)
+	sortLeases(keaLeases, sortField, sortDir)
+
+	leases := &models.Leases{
+		Items: []*models.Lease{},
+		Total: int64(len(keaLeases)),
+	}
+	if start < int64(len(keaLeases)) {
+		end := int64(len(keaLeases))
+		if limit > 0 && start+limit < end {
+			end = start + limit
+		}
+		for i := start; i < end; i++ {
+			leases.Items = append(leases.Items, leaseToRestAPI(&keaLeases[i]))
+		}
+	}
+
+	// Record apps for which there was an error communicating with the Kea servers.
+	for i := range erredApps {
+		leases.ErredApps = append(leases.ErredApps, &models.LeasesSearchErredApp{
+			ID:   &erredApps[i].ID,
+			Name: &erredApps[i].Name,
+		})
+	}
+
+	rsp := dhcp.NewGetSubnetLeasesOK().WithPayload(leases)
+	return rsp
+}
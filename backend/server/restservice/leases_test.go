@@ -2,14 +2,20 @@ package restservice
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	keactrl "isc.org/stork/appctrl/kea"
+	keadata "isc.org/stork/appdata/kea"
 	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbops "isc.org/stork/server/database"
 	dbmodel "isc.org/stork/server/database/model"
 	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
 	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storktestdbmodel "isc.org/stork/server/test/dbmodel"
+	storkutil "isc.org/stork/util"
 )
 
 // Generates a success mock response to a command fetching a DHCPv4
@@ -680,3 +686,531 @@ func TestFindLeasesByHostID(t *testing.T) {
 	require.Len(t, okRsp.Payload.Conflicts, 1)
 	require.EqualValues(t, *okRsp.Payload.Items[1].ID, okRsp.Payload.Conflicts[0])
 }
+
+// Generates a success mock response to the commands modifying leases.
+func mockLeaseCommandSuccess(callNo int, responses []interface{}) {
+	json := []byte(`[
+        {
+            "result": 0,
+            "text": "Lease command successful"
+        }
+    ]`)
+	command := keactrl.NewCommand("lease4-del", []string{"dhcp4"}, nil)
+	_ = keactrl.UnmarshalResponseList(command, json, responses[0])
+}
+
+// Generates an empty mock response to the commands modifying leases.
+// It indicates that the lease does not exist.
+func mockLeaseCommandEmpty(callNo int, responses []interface{}) {
+	json := []byte(`[
+        {
+            "result": 3,
+            "text": "Lease not found"
+        }
+    ]`)
+	command := keactrl.NewCommand("lease4-del", []string{"dhcp4"}, nil)
+	_ = keactrl.UnmarshalResponseList(command, json, responses[0])
+}
+
+// Creates the REST API with the fake agents and the fake event center,
+// and the logged user. It adds the Kea app with the DHCPv4 daemon using
+// the lease_cmds hooks library and the DHCPv6 daemon without this
+// library. It returns the API, the context with the user session and
+// the app.
+func newTestLeaseActionsAPI(t *testing.T, db *dbops.PgDB, dbSettings *dbops.DatabaseSettings, fa *agentcommtest.FakeAgents, fec *storktestdbmodel.FakeEventCenter) (*RestAPI, context.Context, *dbmodel.App) {
+	machine := &dbmodel.Machine{
+		Address:   "machine",
+		AgentPort: 8080,
+	}
+	err := dbmodel.AddMachine(db, machine)
+	require.NoError(t, err)
+
+	accessPoints := []*dbmodel.AccessPoint{}
+	accessPoints = dbmodel.AppendAccessPoint(accessPoints, dbmodel.AccessPointControl, "localhost", "", 8000, true)
+	app := &dbmodel.App{
+		Name:         "kea",
+		MachineID:    machine.ID,
+		Type:         dbmodel.AppTypeKea,
+		AccessPoints: accessPoints,
+		Daemons: []*dbmodel.Daemon{
+			{
+				Name: dbmodel.DaemonNameDHCPv4,
+				KeaDaemon: &dbmodel.KeaDaemon{
+					Config: dbmodel.NewKeaConfig(&map[string]interface{}{
+						"Dhcp4": map[string]interface{}{
+							"hooks-libraries": []interface{}{
+								map[string]interface{}{
+									"library": "libdhcp_lease_cmds.so",
+								},
+							},
+						},
+					}),
+				},
+			},
+			{
+				Name: dbmodel.DaemonNameDHCPv6,
+				KeaDaemon: &dbmodel.KeaDaemon{
+					Config: dbmodel.NewKeaConfig(&map[string]interface{}{
+						"Dhcp6": map[string]interface{}{},
+					}),
+				},
+			},
+		},
+	}
+	_, err = dbmodel.AddApp(db, app)
+	require.NoError(t, err)
+
+	rapi, err := NewRestAPI(dbSettings, db, fa, fec)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	user, err := dbmodel.GetUserByID(db, 1)
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	return rapi, ctx, app
+}
+
+// Test deleting a lease over the REST API.
+func TestDeleteLease(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeaseCommandSuccess, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	ipAddress := "192.0.2.1"
+	params := dhcp.DeleteLeaseParams{
+		Lease: &models.LeaseDelete{
+			AppID:     &app.ID,
+			IPAddress: &ipAddress,
+		},
+	}
+	rsp := rapi.DeleteLease(ctx, params)
+	require.IsType(t, &dhcp.DeleteLeaseOK{}, rsp)
+
+	require.Len(t, fa.RecordedCommands, 1)
+	require.Equal(t, "lease4-del", fa.RecordedCommands[0].GetCommand())
+
+	require.Len(t, fec.Events, 1)
+	require.Contains(t, fec.Events[0].Text, "deleted lease 192.0.2.1")
+	require.EqualValues(t, 1, fec.Events[0].Relations.UserID)
+	require.Equal(t, app.Daemons[0].ID, fec.Events[0].Relations.DaemonID)
+	require.Equal(t, app.ID, fec.Events[0].Relations.AppID)
+
+	// The lease deletion should have been audited.
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, dbmodel.AuditTargetDaemon, records[0].TargetType)
+	require.Equal(t, app.Daemons[0].ID, records[0].TargetID)
+	require.Len(t, records[0].Changes, 1)
+	require.Equal(t, storkutil.JSONDiffOperationRemove, records[0].Changes[0].Operation)
+}
+
+// Test that deleting a non-existing lease returns NotFound status code.
+func TestDeleteLeaseNotFound(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeaseCommandEmpty, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	ipAddress := "192.0.2.1"
+	params := dhcp.DeleteLeaseParams{
+		Lease: &models.LeaseDelete{
+			AppID:     &app.ID,
+			IPAddress: &ipAddress,
+		},
+	}
+	rsp := rapi.DeleteLease(ctx, params)
+	require.IsType(t, &dhcp.DeleteLeaseDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.DeleteLeaseDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+	require.Empty(t, fec.Events)
+}
+
+// Test that the lease commands are not sent to the daemon without the
+// lease_cmds hooks library, to non-existing app and by the user who is
+// not logged in.
+func TestDeleteLeaseInvalid(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeaseCommandSuccess, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	// The DHCPv6 daemon lacks the lease_cmds hooks library.
+	ipAddress := "2001:db8:1::1"
+	params := dhcp.DeleteLeaseParams{
+		Lease: &models.LeaseDelete{
+			AppID:     &app.ID,
+			IPAddress: &ipAddress,
+		},
+	}
+	rsp := rapi.DeleteLease(ctx, params)
+	require.IsType(t, &dhcp.DeleteLeaseDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.DeleteLeaseDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Invalid IP address.
+	ipAddress = "192.0.2.0/24"
+	rsp = rapi.DeleteLease(ctx, params)
+	require.IsType(t, &dhcp.DeleteLeaseDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.DeleteLeaseDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Non-existing app.
+	ipAddress = "192.0.2.1"
+	appID := app.ID + 1
+	params.Lease.AppID = &appID
+	rsp = rapi.DeleteLease(ctx, params)
+	require.IsType(t, &dhcp.DeleteLeaseDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.DeleteLeaseDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+
+	// User not logged in.
+	params.Lease.AppID = &app.ID
+	rsp = rapi.DeleteLease(context.Background(), params)
+	require.IsType(t, &dhcp.DeleteLeaseDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.DeleteLeaseDefault)
+	require.Equal(t, http.StatusForbidden, getStatusCode(*defaultRsp))
+
+	require.Empty(t, fa.RecordedCommands)
+	require.Empty(t, fec.Events)
+}
+
+// Test updating a DHCPv4 lease over the REST API.
+func TestUpdateLease(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeaseCommandSuccess, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	ipAddress := "192.0.2.1"
+	hwAddress := "01:02:03:04:05:06"
+	subnetID := int64(1)
+	params := dhcp.UpdateLeaseParams{
+		Lease: &models.LeaseUpdate{
+			AppID:         &app.ID,
+			IPAddress:     &ipAddress,
+			HwAddress:     &hwAddress,
+			SubnetID:      &subnetID,
+			ValidLifetime: 3600,
+		},
+	}
+	rsp := rapi.UpdateLease(ctx, params)
+	require.IsType(t, &dhcp.UpdateLeaseOK{}, rsp)
+
+	require.Len(t, fa.RecordedCommands, 1)
+	require.JSONEq(t, `{
+        "command": "lease4-update",
+        "service": [ "dhcp4" ],
+        "arguments": {
+            "ip-address": "192.0.2.1",
+            "hw-address": "01:02:03:04:05:06",
+            "subnet-id": 1,
+            "valid-lft": 3600,
+            "fqdn-fwd": false,
+            "fqdn-rev": false
+        }
+    }`, fa.RecordedCommands[0].Marshal())
+
+	require.Len(t, fec.Events, 1)
+	require.Contains(t, fec.Events[0].Text, "updated lease 192.0.2.1")
+
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, dbmodel.AuditTargetDaemon, records[0].TargetType)
+	require.Equal(t, app.Daemons[0].ID, records[0].TargetID)
+}
+
+// Test deleting all leases in a subnet over the REST API.
+func TestWipeLeases(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeaseCommandSuccess, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	subnetID := int64(12)
+	params := dhcp.WipeLeasesParams{
+		Wipe: &models.LeasesWipe{
+			AppID:    &app.ID,
+			SubnetID: &subnetID,
+		},
+	}
+	rsp := rapi.WipeLeases(ctx, params)
+	require.IsType(t, &dhcp.WipeLeasesOK{}, rsp)
+
+	require.Len(t, fa.RecordedCommands, 1)
+	require.Equal(t, "lease4-wipe", fa.RecordedCommands[0].GetCommand())
+
+	require.Len(t, fec.Events, 1)
+	require.Contains(t, fec.Events[0].Text, "deleted all leases in subnet with ID 12")
+	require.Equal(t, dbmodel.EvWarning, fec.Events[0].Level)
+
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, dbmodel.AuditTargetDaemon, records[0].TargetType)
+	require.Equal(t, app.Daemons[0].ID, records[0].TargetID)
+}
+
+// Test requesting the DNS update for a lease over the REST API.
+func TestResendLeaseDdns(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeaseCommandSuccess, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	ipAddress := "192.0.2.1"
+	params := dhcp.ResendLeaseDdnsParams{
+		Lease: &models.LeaseResendDdns{
+			AppID:     &app.ID,
+			IPAddress: &ipAddress,
+		},
+	}
+	rsp := rapi.ResendLeaseDdns(ctx, params)
+	require.IsType(t, &dhcp.ResendLeaseDdnsOK{}, rsp)
+
+	require.Len(t, fa.RecordedCommands, 1)
+	require.Equal(t, "lease4-resend-ddns", fa.RecordedCommands[0].GetCommand())
+
+	require.Len(t, fec.Events, 1)
+	require.Contains(t, fec.Events[0].Text, "resent DNS update for lease 192.0.2.1")
+
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, dbmodel.AuditTargetDaemon, records[0].TargetType)
+	require.Equal(t, app.Daemons[0].ID, records[0].TargetID)
+}
+
+// Generates a success mock response to lease4-get-all command.
+func mockLeases4GetAll(callNo int, responses []interface{}) {
+	json := []byte(`[
+        {
+            "result": 0,
+            "text": "3 IPv4 lease(s) found.",
+            "arguments": {
+                "leases": [
+                    {
+                        "cltt": 1000,
+                        "hostname": "b.example.org",
+                        "hw-address": "08:08:08:08:08:08",
+                        "ip-address": "192.0.2.10",
+                        "state": 0,
+                        "subnet-id": 1,
+                        "valid-lft": 3600
+                    },
+                    {
+                        "cltt": 2000,
+                        "hostname": "a.example.org",
+                        "hw-address": "09:09:09:09:09:09",
+                        "ip-address": "192.0.2.9",
+                        "state": 1,
+                        "subnet-id": 1,
+                        "valid-lft": 100
+                    },
+                    {
+                        "cltt": 3000,
+                        "hostname": "c.example.org",
+                        "hw-address": "0a:0a:0a:0a:0a:0a",
+                        "ip-address": "192.0.2.100",
+                        "state": 0,
+                        "subnet-id": 1,
+                        "valid-lft": 3600
+                    }
+                ]
+            }
+        }
+    ]`)
+	command := keactrl.NewCommand("lease4-get-all", []string{"dhcp4"}, nil)
+	_ = keactrl.UnmarshalResponseList(command, json, responses[0])
+}
+
+// Returns the IP addresses of the leases.
+func getLeaseAddresses(leases []dbmodel.Lease) (addresses []string) {
+	for _, lease := range leases {
+		addresses = append(addresses, lease.IPAddress)
+	}
+	return
+}
+
+// Test sorting the leases by different fields.
+func TestSortLeases(t *testing.T) {
+	leases := []dbmodel.Lease{
+		{
+			AppID: 2,
+			Lease: keadata.Lease{IPAddress: "192.0.2.10", CLTT: 1000, ValidLifetime: 3600, Hostname: "b"},
+		},
+		{
+			AppID: 1,
+			Lease: keadata.Lease{IPAddress: "192.0.2.9", CLTT: 2000, ValidLifetime: 100, Hostname: "a", State: 1},
+		},
+		{
+			AppID: 1,
+			Lease: keadata.Lease{IPAddress: "192.0.2.10", CLTT: 3000, ValidLifetime: 3600, Hostname: "c"},
+		},
+	}
+
+	// By IP address, then by app ID.
+	sortLeases(leases, "", dbmodel.SortDirAny)
+	require.Equal(t, []string{"192.0.2.9", "192.0.2.10", "192.0.2.10"}, getLeaseAddresses(leases))
+	require.EqualValues(t, 1, leases[1].AppID)
+
+	sortLeases(leases, "ipAddress", dbmodel.SortDirDesc)
+	require.Equal(t, []string{"192.0.2.10", "192.0.2.10", "192.0.2.9"}, getLeaseAddresses(leases))
+	require.EqualValues(t, 2, leases[0].AppID)
+
+	// By expiry.
+	sortLeases(leases, "expiry", dbmodel.SortDirAsc)
+	require.EqualValues(t, 2100, leases[0].CLTT+uint64(leases[0].ValidLifetime))
+	require.EqualValues(t, 4600, leases[1].CLTT+uint64(leases[1].ValidLifetime))
+	require.EqualValues(t, 6600, leases[2].CLTT+uint64(leases[2].ValidLifetime))
+
+	// By state.
+	sortLeases(leases, "state", dbmodel.SortDirDesc)
+	require.EqualValues(t, 1, leases[0].State)
+
+	// By hostname.
+	sortLeases(leases, "hostname", dbmodel.SortDirAsc)
+	require.Equal(t, "a", leases[0].Hostname)
+	require.Equal(t, "b", leases[1].Hostname)
+	require.Equal(t, "c", leases[2].Hostname)
+}
+
+// Test that the leases returned by multiple servers are deduplicated.
+func TestDeduplicateLeases(t *testing.T) {
+	leases := []dbmodel.Lease{
+		{
+			AppID: 1,
+			Lease: keadata.Lease{IPAddress: "2001:db8:1::", PrefixLength: 64, CLTT: 1000},
+		},
+		{
+			AppID: 1,
+			Lease: keadata.Lease{IPAddress: "2001:db8:1::", CLTT: 1000},
+		},
+		{
+			AppID: 2,
+			Lease: keadata.Lease{IPAddress: "2001:db8:1::", PrefixLength: 64, CLTT: 2000},
+		},
+		{
+			AppID: 2,
+			Lease: keadata.Lease{IPAddress: "2001:db8:1::", CLTT: 500},
+		},
+	}
+	leases = deduplicateLeases(leases)
+	require.Len(t, leases, 2)
+
+	// The most recently renewed leases should be preserved.
+	require.EqualValues(t, 64, leases[0].PrefixLength)
+	require.EqualValues(t, 2, leases[0].AppID)
+	require.Zero(t, leases[1].PrefixLength)
+	require.EqualValues(t, 1, leases[1].AppID)
+}
+
+// Test fetching the paginated and sorted leases in a subnet over the
+// REST API.
+func TestGetSubnetLeases(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(mockLeases4GetAll, nil)
+	fec := &storktestdbmodel.FakeEventCenter{}
+	rapi, ctx, app := newTestLeaseActionsAPI(t, db, dbSettings, fa, fec)
+
+	subnet := &dbmodel.Subnet{
+		Prefix: "192.0.2.0/24",
+	}
+	err := dbmodel.AddSubnet(db, subnet)
+	require.NoError(t, err)
+	err = dbmodel.AddDaemonToSubnet(db, subnet, app.Daemons[0])
+	require.NoError(t, err)
+
+	// Get the second page sorted by hostname in descending order.
+	start := int64(1)
+	limit := int64(1)
+	sortField := "hostname"
+	sortDir := "desc"
+	params := dhcp.GetSubnetLeasesParams{
+		ID:        subnet.ID,
+		Start:     &start,
+		Limit:     &limit,
+		SortField: &sortField,
+		SortDir:   &sortDir,
+	}
+	rsp := rapi.GetSubnetLeases(ctx, params)
+	require.IsType(t, &dhcp.GetSubnetLeasesOK{}, rsp)
+	okRsp := rsp.(*dhcp.GetSubnetLeasesOK)
+	require.EqualValues(t, 3, okRsp.Payload.Total)
+	require.Len(t, okRsp.Payload.Items, 1)
+	require.Equal(t, "b.example.org", okRsp.Payload.Items[0].Hostname)
+	require.Equal(t, app.ID, *okRsp.Payload.Items[0].AppID)
+	require.Empty(t, okRsp.Payload.ErredApps)
+
+	require.Len(t, fa.RecordedCommands, 1)
+	require.Equal(t, "lease4-get-all", fa.RecordedCommands[0].GetCommand())
+
+	// Get all leases sorted by IP address.
+	rsp = rapi.GetSubnetLeases(ctx, dhcp.GetSubnetLeasesParams{
+		ID: subnet.ID,
+	})
+	require.IsType(t, &dhcp.GetSubnetLeasesOK{}, rsp)
+	okRsp = rsp.(*dhcp.GetSubnetLeasesOK)
+	require.Len(t, okRsp.Payload.Items, 3)
+	require.Equal(t, "192.0.2.9", *okRsp.Payload.Items[0].IPAddress)
+	require.Equal(t, "192.0.2.10", *okRsp.Payload.Items[1].IPAddress)
+	require.Equal(t, "192.0.2.100", *okRsp.Payload.Items[2].IPAddress)
+
+	// Page beyond the leases.
+	start = 5
+	rsp = rapi.GetSubnetLeases(ctx, params)
+	require.IsType(t, &dhcp.GetSubnetLeasesOK{}, rsp)
+	okRsp = rsp.(*dhcp.GetSubnetLeasesOK)
+	require.EqualValues(t, 3, okRsp.Payload.Total)
+	require.Empty(t, okRsp.Payload.Items)
+
+	// Negative start.
+	start = -1
+	rsp = rapi.GetSubnetLeases(ctx, params)
+	require.IsType(t, &dhcp.GetSubnetLeasesDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.GetSubnetLeasesDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Negative limit.
+	start = 0
+	limit = -1
+	rsp = rapi.GetSubnetLeases(ctx, params)
+	require.IsType(t, &dhcp.GetSubnetLeasesDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.GetSubnetLeasesDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Unsupported sort field.
+	limit = 1
+	sortField = "foo"
+	rsp = rapi.GetSubnetLeases(ctx, params)
+	require.IsType(t, &dhcp.GetSubnetLeasesDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.GetSubnetLeasesDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Non-existing subnet.
+	rsp = rapi.GetSubnetLeases(ctx, dhcp.GetSubnetLeasesParams{
+		ID: subnet.ID + 1,
+	})
+	require.IsType(t, &dhcp.GetSubnetLeasesDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.GetSubnetLeasesDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+}
@@ -78,6 +78,16 @@ func (r *RestAPI) machineToRestAPI(dbMachine dbmodel.Machine) *models.Machine {
 	return &m
 }
 
+// Returns the machine properties which can be modified via REST API in
+// the format stored in the audit trail.
+func machineToAuditState(dbMachine *dbmodel.Machine) map[string]interface{} {
+	return map[string]interface{}{
+		"address":    dbMachine.Address,
+		"agentPort":  dbMachine.AgentPort,
+		"authorized": dbMachine.Authorized,
+	}
+}
+
 // Get runtime state of indicated machine.
 func (r *RestAPI) GetMachineState(ctx context.Context, params services.GetMachineStateParams) middleware.Responder {
 	dbMachine, err := dbmodel.GetMachineByID(r.DB, params.ID)
@@ -388,6 +398,7 @@ func (r *RestAPI) CreateMachine(ctx context.Context, params services.CreateMachi
 		defer r.Pullers.AppsStatePuller.Unpause()
 	}
 
+	var machineBefore map[string]interface{}
 	if dbMachine == nil {
 		dbMachine = &dbmodel.Machine{
 			Address:         addr,
@@ -407,6 +418,7 @@ func (r *RestAPI) CreateMachine(ctx context.Context, params services.CreateMachi
 		}
 		r.EventCenter.AddInfoEvent("added {machine}", dbMachine)
 	} else {
+		machineBefore = machineToAuditState(dbMachine)
 		dbMachine.AgentToken = *params.Machine.AgentToken
 		dbMachine.CertFingerprint = agentCertFingerprint
 		dbMachine.Authorized = machineAuthorized
@@ -421,6 +433,7 @@ func (r *RestAPI) CreateMachine(ctx context.Context, params services.CreateMachi
 		}
 		r.EventCenter.AddInfoEvent("re-registered {machine}", dbMachine)
 	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetMachine, dbMachine.ID, machineBefore, machineToAuditState(dbMachine))
 
 	m := &models.NewMachineResp{
 		ID:           dbMachine.ID,
@@ -568,6 +581,8 @@ func (r *RestAPI) UpdateMachine(ctx context.Context, params services.UpdateMachi
 		}
 	}
 
+	machineBefore := machineToAuditState(dbMachine)
+
 	// copy fields
 	dbMachine.Address = addr
 	dbMachine.AgentPort = params.Machine.AgentPort
@@ -582,6 +597,7 @@ func (r *RestAPI) UpdateMachine(ctx context.Context, params services.UpdateMachi
 		})
 		return rsp
 	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetMachine, dbMachine.ID, machineBefore, machineToAuditState(dbMachine))
 
 	// as we just authorized machine so get its state now
 	if !prevAuthorized && dbMachine.Authorized {
@@ -693,6 +709,7 @@ func (r *RestAPI) DeleteMachine(ctx context.Context, params services.DeleteMachi
 	}
 
 	r.EventCenter.AddInfoEvent("removed {machine}", dbMachine)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetMachine, dbMachine.ID, machineToAuditState(dbMachine), nil)
 
 	rsp := services.NewDeleteMachineOK()
 
@@ -1498,6 +1515,10 @@ func (r *RestAPI) UpdateDaemon(ctx context.Context, params services.UpdateDaemon
 		return rsp
 	}
 
+	r.addAuditRecord(ctx, dbmodel.AuditTargetDaemon, dbDaemon.ID,
+		map[string]interface{}{"monitored": oldMonitored},
+		map[string]interface{}{"monitored": dbDaemon.Monitored})
+
 	_, dbUser := r.SessionManager.Logged(ctx)
 
 	if oldMonitored != params.Daemon.Monitored {
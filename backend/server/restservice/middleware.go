@@ -1,7 +1,9 @@
 package restservice
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path"
@@ -9,10 +11,12 @@ import (
 	"text/template"
 	"time"
 
+	openapimiddleware "github.com/go-openapi/runtime/middleware"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"isc.org/stork/server/auth"
+	dbsession "isc.org/stork/server/database/session"
 	"isc.org/stork/server/eventcenter"
 	"isc.org/stork/server/metrics"
 )
@@ -94,6 +98,79 @@ func loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Returns the IP address of the remote end of the connection.
+func getRemoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Checks if the IP address belongs to one of the trusted proxies. The
+// trusted proxies are specified as IP addresses or prefixes.
+func isTrustedProxy(address string, trustedProxies []string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the IP address specified in the X-Real-IP header. The header is
+// ignored unless the request comes from one of the trusted proxies because
+// any client can set it. The second returned value is false when the
+// header is absent or ignored.
+func getRealIP(r *http.Request, trustedProxies []string) (string, bool) {
+	realIP := r.Header.Get("X-Real-IP")
+	if realIP == "" || !isTrustedProxy(getRemoteIP(r), trustedProxies) {
+		return "", false
+	}
+	return realIP, true
+}
+
+// Returns the IP address of the client sending the request. The address
+// specified in the X-Real-IP header set by the trusted reverse proxy takes
+// precedence over the remote address of the connection.
+func getSourceIP(r *http.Request, trustedProxies []string) string {
+	if realIP, ok := getRealIP(r, trustedProxies); ok {
+		return realIP
+	}
+	return getRemoteIP(r)
+}
+
+// Install a middleware that stores the information about the request
+// required by the audit trail in the request context. It must be
+// installed after routing because it stores the REST API operation ID.
+// It must also be installed after the session middleware because it
+// stores the logged user.
+func auditMiddleware(next http.Handler, sessionManager *dbsession.SessionMgr, trustedProxies []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &auditRequestInfo{
+			sourceIP: getSourceIP(r, trustedProxies),
+		}
+		if route := openapimiddleware.MatchedRouteFrom(r); route != nil && route.Operation != nil {
+			info.operationID = route.Operation.ID
+		}
+		if ok, user := sessionManager.Logged(r.Context()); ok {
+			info.userID = int64(user.ID)
+			info.userLogin = user.Login
+		}
+		ctx := context.WithValue(r.Context(), auditRequestInfoKey, info)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // Install a middleware that is serving static files for UI
 // and assets/pkgs content ie. stork rpm and deb packages.
 func fileServerMiddleware(next http.Handler, staticFilesDir string) http.Handler {
@@ -245,6 +322,15 @@ func metricsMiddleware(next http.Handler, collector metrics.Collector) http.Hand
 	})
 }
 
+// Returns the addresses of the reverse proxies allowed to specify the
+// client's IP address in the X-Real-IP header recorded in the audit trail.
+func (r *RestAPI) getTrustedProxies() []string {
+	if r.Settings == nil {
+		return nil
+	}
+	return r.Settings.TrustedProxies
+}
+
 // Global middleware function provides a common place to setup middlewares for
 // the server. It is invoked before everything.
 func (r *RestAPI) GlobalMiddleware(handler http.Handler, staticFilesDir string, eventCenter eventcenter.EventCenter) http.Handler {
@@ -261,6 +347,7 @@ func (r *RestAPI) GlobalMiddleware(handler http.Handler, staticFilesDir string,
 // the server. It is invoked after routing but before authentication, binding and validation.
 func (r *RestAPI) InnerMiddleware(handler http.Handler) http.Handler {
 	// last handler is executed first for incoming request
+	handler = auditMiddleware(handler, r.SessionManager, r.getTrustedProxies())
 	handler = r.SessionManager.SessionMiddleware(handler)
 	return handler
 }
@@ -216,3 +216,60 @@ func TestLoggingMiddlewareHelpers(t *testing.T) {
 	hdr := lrw.Header()
 	require.Empty(t, hdr)
 }
+
+// Check that the source IP address is taken from the X-Real-IP header
+// or from the remote address of the request.
+func TestGetSourceIP(t *testing.T) {
+	trustedProxies := []string{"192.0.2.1", "2001:db8:1::/64"}
+
+	req := httptest.NewRequest("GET", "http://localhost/api/users", nil)
+	req.RemoteAddr = "192.0.2.1:8080"
+	require.Equal(t, "192.0.2.1", getSourceIP(req, trustedProxies))
+
+	req.RemoteAddr = "192.0.2.1"
+	require.Equal(t, "192.0.2.1", getSourceIP(req, trustedProxies))
+
+	// The header set by the trusted proxy takes precedence.
+	req.Header.Set("X-Real-IP", "192.0.2.2")
+	require.Equal(t, "192.0.2.2", getSourceIP(req, trustedProxies))
+
+	req.RemoteAddr = "[2001:db8:1::5]:8080"
+	require.Equal(t, "192.0.2.2", getSourceIP(req, trustedProxies))
+
+	// The header set by other clients is ignored.
+	req.RemoteAddr = "192.0.2.3:8080"
+	require.Equal(t, "192.0.2.3", getSourceIP(req, trustedProxies))
+
+	req.RemoteAddr = "[2001:db8:2::5]:8080"
+	require.Equal(t, "2001:db8:2::5", getSourceIP(req, trustedProxies))
+
+	req.RemoteAddr = "192.0.2.1:8080"
+	require.Equal(t, "192.0.2.1", getSourceIP(req, nil))
+}
+
+// Check that the audit middleware stores the request information in
+// the request context.
+func TestAuditMiddleware(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+	rapi, err := NewRestAPI(dbSettings, db)
+	require.NoError(t, err)
+
+	var info *auditRequestInfo
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, _ = r.Context().Value(auditRequestInfoKey).(*auditRequestInfo)
+	})
+	handler := rapi.SessionManager.SessionMiddleware(auditMiddleware(nextHandler, rapi.SessionManager, nil))
+
+	req := httptest.NewRequest("GET", "http://localhost/api/users", nil)
+	req.RemoteAddr = "192.0.2.1:8080"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	require.NotNil(t, info)
+	require.Equal(t, "192.0.2.1", info.sourceIP)
+	// The request hasn't been routed and the user is not logged in.
+	require.Empty(t, info.operationID)
+	require.Zero(t, info.userID)
+	require.Empty(t, info.userLogin)
+}
@@ -50,6 +50,8 @@ type RestAPISettings struct {
 	TLSCACertificate  flags.Filename `long:"rest-tls-ca" description:"The certificate authority file to be used with mutual tls auth" env:"STORK_REST_TLS_CA_CERTIFICATE"`
 
 	StaticFilesDir string `long:"rest-static-files-dir" description:"The directory with static files for the UI" default:"" env:"STORK_REST_STATIC_FILES_DIR"`
+
+	TrustedProxies []string `long:"rest-trusted-proxy" description:"The IP address or prefix of the reverse proxy allowed to specify the client's IP address in the X-Real-IP header for the audit trail; it can be specified multiple times" env:"STORK_REST_TRUSTED_PROXIES" env-delim:","`
 }
 
 // Runtime information and settings for RestAPI service.
@@ -63,6 +65,7 @@ type RestAPI struct {
 	ReviewDispatcher           configreview.Dispatcher
 	MetricsCollector           metrics.Collector
 	ConfigManager              config.Manager
+	ConfigChangeScheduler      *apps.ConfigChangeScheduler
 	DHCPOptionDefinitionLookup keaconfig.DHCPOptionDefinitionLookup
 
 	Agents agentcomm.ConnectedAgents
@@ -174,6 +177,10 @@ func NewRestAPI(args ...interface{}) (*RestAPI, error) {
 			api.Pullers = arg.(*apps.Pullers)
 			continue
 		}
+		if argType.AssignableTo(reflect.TypeOf((*apps.ConfigChangeScheduler)(nil))) {
+			api.ConfigChangeScheduler = arg.(*apps.ConfigChangeScheduler)
+			continue
+		}
 		if argType.AssignableTo(reflect.TypeOf((*RestAPISettings)(nil))) {
 			api.Settings = arg.(*RestAPISettings)
 			continue
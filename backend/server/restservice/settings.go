@@ -2,7 +2,10 @@ package restservice
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"path/filepath"
 
 	"github.com/go-openapi/runtime/middleware"
 	log "github.com/sirupsen/logrus"
@@ -24,15 +27,59 @@ func (r *RestAPI) GetSettings(ctx context.Context, params settings.GetSettingsPa
 		return rsp
 	}
 
+	requiredApprovals := dbSettingsMap["config_change_required_approvals"].(int64)
+	leaseConflictsPullerInterval := dbSettingsMap["kea_lease_conflicts_puller_interval"].(int64)
+	exhaustionForecastPullerInterval := dbSettingsMap["exhaustion_forecast_puller_interval"].(int64)
+	exhaustionForecastHorizon := dbSettingsMap["exhaustion_forecast_horizon"].(int64)
+	alertRulesEvaluationInterval := dbSettingsMap["alert_rules_evaluation_interval"].(int64)
+	smtpHost := dbSettingsMap["smtp_host"].(string)
+	smtpPort := dbSettingsMap["smtp_port"].(int64)
+	smtpTLS := dbSettingsMap["smtp_tls"].(bool)
+	smtpUsername := dbSettingsMap["smtp_username"].(string)
+	smtpSender := dbSettingsMap["smtp_sender"].(string)
+	emailDigestInterval := dbSettingsMap["email_digest_interval"].(int64)
+	syslogAddress := dbSettingsMap["syslog_address"].(string)
+	syslogTransport := dbSettingsMap["syslog_transport"].(string)
+	eventPrunerInterval := dbSettingsMap["event_pruner_interval"].(int64)
+	eventMaxAgeInfo := dbSettingsMap["event_max_age_info"].(int64)
+	eventMaxAgeWarning := dbSettingsMap["event_max_age_warning"].(int64)
+	eventMaxAgeError := dbSettingsMap["event_max_age_error"].(int64)
+	eventMaxCountInfo := dbSettingsMap["event_max_count_info"].(int64)
+	eventMaxCountWarning := dbSettingsMap["event_max_count_warning"].(int64)
+	eventMaxCountError := dbSettingsMap["event_max_count_error"].(int64)
+	eventDeduplicationWindow := dbSettingsMap["event_deduplication_window"].(int64)
+	eventArchiveDirectory := dbSettingsMap["event_archive_directory"].(string)
 	s := &models.Settings{
-		Bind9StatsPullerInterval: dbSettingsMap["bind9_stats_puller_interval"].(int64),
-		GrafanaURL:               dbSettingsMap["grafana_url"].(string),
-		KeaHostsPullerInterval:   dbSettingsMap["kea_hosts_puller_interval"].(int64),
-		KeaStatsPullerInterval:   dbSettingsMap["kea_stats_puller_interval"].(int64),
-		KeaStatusPullerInterval:  dbSettingsMap["kea_status_puller_interval"].(int64),
-		AppsStatePullerInterval:  dbSettingsMap["apps_state_puller_interval"].(int64),
-		PrometheusURL:            dbSettingsMap["prometheus_url"].(string),
-		MetricsCollectorInterval: dbSettingsMap["metrics_collector_interval"].(int64),
+		Bind9StatsPullerInterval:         dbSettingsMap["bind9_stats_puller_interval"].(int64),
+		GrafanaURL:                       dbSettingsMap["grafana_url"].(string),
+		KeaHostsPullerInterval:           dbSettingsMap["kea_hosts_puller_interval"].(int64),
+		KeaStatsPullerInterval:           dbSettingsMap["kea_stats_puller_interval"].(int64),
+		KeaStatusPullerInterval:          dbSettingsMap["kea_status_puller_interval"].(int64),
+		KeaLeaseConflictsPullerInterval:  &leaseConflictsPullerInterval,
+		ExhaustionForecastPullerInterval: &exhaustionForecastPullerInterval,
+		ExhaustionForecastHorizon:        &exhaustionForecastHorizon,
+		AlertRulesEvaluationInterval:     &alertRulesEvaluationInterval,
+		SMTPHost:                         &smtpHost,
+		SMTPPort:                         &smtpPort,
+		SMTPTLS:                          &smtpTLS,
+		SMTPUsername:                     &smtpUsername,
+		SMTPSender:                       &smtpSender,
+		EmailDigestInterval:              &emailDigestInterval,
+		SyslogAddress:                    &syslogAddress,
+		SyslogTransport:                  &syslogTransport,
+		EventPrunerInterval:              &eventPrunerInterval,
+		EventMaxAgeInfo:                  &eventMaxAgeInfo,
+		EventMaxAgeWarning:               &eventMaxAgeWarning,
+		EventMaxAgeError:                 &eventMaxAgeError,
+		EventMaxCountInfo:                &eventMaxCountInfo,
+		EventMaxCountWarning:             &eventMaxCountWarning,
+		EventMaxCountError:               &eventMaxCountError,
+		EventDeduplicationWindow:         &eventDeduplicationWindow,
+		EventArchiveDirectory:            &eventArchiveDirectory,
+		AppsStatePullerInterval:          dbSettingsMap["apps_state_puller_interval"].(int64),
+		PrometheusURL:                    dbSettingsMap["prometheus_url"].(string),
+		MetricsCollectorInterval:         dbSettingsMap["metrics_collector_interval"].(int64),
+		ConfigChangeRequiredApprovals:    &requiredApprovals,
 	}
 	rsp := settings.NewGetSettingsOK().WithPayload(s)
 
@@ -51,12 +98,50 @@ func (r *RestAPI) UpdateSettings(ctx context.Context, params settings.UpdateSett
 		return rsp
 	}
 
+	// The pruned events are written by the server to the archive directory.
+	// Only the super admin is allowed to change it.
+	if s.EventArchiveDirectory != nil {
+		archiveDirectory, err := dbmodel.GetSettingStr(r.DB, "event_archive_directory")
+		if err != nil {
+			log.Error(err)
+			msg := "Problem getting event archive directory"
+			rsp := settings.NewGetSettingsDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		_, dbUser := r.SessionManager.Logged(ctx)
+		if *s.EventArchiveDirectory != archiveDirectory && (dbUser == nil || !dbUser.InGroup(&dbmodel.SystemGroup{ID: dbmodel.SuperAdminGroupID})) {
+			msg := "Only the super admin can change the event archive directory"
+			log.Error(msg)
+			rsp := settings.NewGetSettingsDefault(http.StatusForbidden).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		if len(*s.EventArchiveDirectory) > 0 && !filepath.IsAbs(*s.EventArchiveDirectory) {
+			msg := fmt.Sprintf("Event archive directory %s is not an absolute path", *s.EventArchiveDirectory)
+			log.Error(msg)
+			rsp := settings.NewGetSettingsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+	}
+
 	msg := "Problem updating settings"
 	errRsp := settings.NewGetSettingsDefault(http.StatusBadRequest).WithPayload(&models.APIError{
 		Message: &msg,
 	})
 
-	err := dbmodel.SetSettingInt(r.DB, "bind9_stats_puller_interval", s.Bind9StatsPullerInterval)
+	// Remember the settings before the update for the audit trail.
+	settingsBefore, err := dbmodel.GetAllSettings(r.DB)
+	if err != nil {
+		log.Error(err)
+		return errRsp
+	}
+
+	err = dbmodel.SetSettingInt(r.DB, "bind9_stats_puller_interval", s.Bind9StatsPullerInterval)
 	if err != nil {
 		log.Error(err)
 		return errRsp
@@ -86,6 +171,152 @@ func (r *RestAPI) UpdateSettings(ctx context.Context, params settings.UpdateSett
 		log.Error(err)
 		return errRsp
 	}
+	if s.KeaLeaseConflictsPullerInterval != nil {
+		err = dbmodel.SetSettingInt(r.DB, "kea_lease_conflicts_puller_interval", *s.KeaLeaseConflictsPullerInterval)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.ExhaustionForecastPullerInterval != nil {
+		err = dbmodel.SetSettingInt(r.DB, "exhaustion_forecast_puller_interval", *s.ExhaustionForecastPullerInterval)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.ExhaustionForecastHorizon != nil {
+		if *s.ExhaustionForecastHorizon < 0 {
+			log.Errorf("Invalid exhaustion forecast horizon %d", *s.ExhaustionForecastHorizon)
+			return errRsp
+		}
+		err = dbmodel.SetSettingInt(r.DB, "exhaustion_forecast_horizon", *s.ExhaustionForecastHorizon)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.AlertRulesEvaluationInterval != nil {
+		err = dbmodel.SetSettingInt(r.DB, "alert_rules_evaluation_interval", *s.AlertRulesEvaluationInterval)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SMTPHost != nil {
+		err = dbmodel.SetSettingStr(r.DB, "smtp_host", *s.SMTPHost)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SMTPPort != nil {
+		if *s.SMTPPort <= 0 || *s.SMTPPort > 65535 {
+			log.Errorf("Invalid SMTP port %d", *s.SMTPPort)
+			return errRsp
+		}
+		err = dbmodel.SetSettingInt(r.DB, "smtp_port", *s.SMTPPort)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SMTPTLS != nil {
+		err = dbmodel.SetSettingBool(r.DB, "smtp_tls", *s.SMTPTLS)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SMTPUsername != nil {
+		err = dbmodel.SetSettingStr(r.DB, "smtp_username", *s.SMTPUsername)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SMTPPassword != nil {
+		err = dbmodel.SetSettingPasswd(r.DB, "smtp_password", *s.SMTPPassword)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SMTPSender != nil {
+		err = dbmodel.SetSettingStr(r.DB, "smtp_sender", *s.SMTPSender)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.EmailDigestInterval != nil {
+		err = dbmodel.SetSettingInt(r.DB, "email_digest_interval", *s.EmailDigestInterval)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SyslogAddress != nil {
+		if len(*s.SyslogAddress) > 0 {
+			if _, _, err = net.SplitHostPort(*s.SyslogAddress); err != nil {
+				log.Errorf("Invalid syslog server address %s: %s", *s.SyslogAddress, err)
+				return errRsp
+			}
+		}
+		err = dbmodel.SetSettingStr(r.DB, "syslog_address", *s.SyslogAddress)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.SyslogTransport != nil {
+		switch *s.SyslogTransport {
+		case "udp", "tcp", "tls":
+		default:
+			log.Errorf("Invalid syslog transport %s", *s.SyslogTransport)
+			return errRsp
+		}
+		err = dbmodel.SetSettingStr(r.DB, "syslog_transport", *s.SyslogTransport)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	// The event retention and deduplication settings must not be negative.
+	eventRetentionSettings := []struct {
+		name  string
+		value *int64
+	}{
+		{"event_pruner_interval", s.EventPrunerInterval},
+		{"event_max_age_info", s.EventMaxAgeInfo},
+		{"event_max_age_warning", s.EventMaxAgeWarning},
+		{"event_max_age_error", s.EventMaxAgeError},
+		{"event_max_count_info", s.EventMaxCountInfo},
+		{"event_max_count_warning", s.EventMaxCountWarning},
+		{"event_max_count_error", s.EventMaxCountError},
+		{"event_deduplication_window", s.EventDeduplicationWindow},
+	}
+	for _, setting := range eventRetentionSettings {
+		if setting.value == nil {
+			continue
+		}
+		if *setting.value < 0 {
+			log.Errorf("Invalid value %d of setting %s", *setting.value, setting.name)
+			return errRsp
+		}
+		err = dbmodel.SetSettingInt(r.DB, setting.name, *setting.value)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+	if s.EventArchiveDirectory != nil {
+		err = dbmodel.SetSettingStr(r.DB, "event_archive_directory", *s.EventArchiveDirectory)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
 	err = dbmodel.SetSettingStr(r.DB, "prometheus_url", s.PrometheusURL)
 	if err != nil {
 		log.Error(err)
@@ -96,6 +327,24 @@ func (r *RestAPI) UpdateSettings(ctx context.Context, params settings.UpdateSett
 		log.Error(err)
 		return errRsp
 	}
+	if s.ConfigChangeRequiredApprovals != nil {
+		if *s.ConfigChangeRequiredApprovals < 0 {
+			log.Errorf("Invalid number of required config change approvals %d", *s.ConfigChangeRequiredApprovals)
+			return errRsp
+		}
+		err = dbmodel.SetSettingInt(r.DB, "config_change_required_approvals", *s.ConfigChangeRequiredApprovals)
+		if err != nil {
+			log.Error(err)
+			return errRsp
+		}
+	}
+
+	settingsAfter, err := dbmodel.GetAllSettings(r.DB)
+	if err != nil {
+		log.Error(err)
+	} else {
+		r.addAuditRecord(ctx, dbmodel.AuditTargetSettings, 0, settingsBefore, settingsAfter)
+	}
 
 	rsp := settings.NewUpdateSettingsOK()
 	return rsp
@@ -2,6 +2,7 @@ package restservice
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -31,6 +32,15 @@ func TestSettings(t *testing.T) {
 	err = dbmodel.InitializeSettings(db, 0)
 	require.NoError(t, err)
 
+	// setup a super admin session, it is required to change the event
+	// archive directory
+	user, err := dbmodel.GetUserByID(rapi.DB, 1)
+	require.NoError(t, err)
+	ctx, err = rapi.SessionManager.Load(ctx, "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
 	// get all settings
 	paramsGS := settings.GetSettingsParams{}
 	rsp := rapi.GetSettings(ctx, paramsGS)
@@ -38,6 +48,37 @@ func TestSettings(t *testing.T) {
 	okRsp := rsp.(*settings.GetSettingsOK)
 	require.EqualValues(t, 60, okRsp.Payload.Bind9StatsPullerInterval)
 	require.Empty(t, okRsp.Payload.GrafanaURL)
+	require.NotNil(t, okRsp.Payload.ConfigChangeRequiredApprovals)
+	require.Zero(t, *okRsp.Payload.ConfigChangeRequiredApprovals)
+	require.NotNil(t, okRsp.Payload.KeaLeaseConflictsPullerInterval)
+	require.EqualValues(t, 60, *okRsp.Payload.KeaLeaseConflictsPullerInterval)
+	require.NotNil(t, okRsp.Payload.ExhaustionForecastPullerInterval)
+	require.EqualValues(t, 60, *okRsp.Payload.ExhaustionForecastPullerInterval)
+	require.NotNil(t, okRsp.Payload.ExhaustionForecastHorizon)
+	require.EqualValues(t, 30, *okRsp.Payload.ExhaustionForecastHorizon)
+	require.NotNil(t, okRsp.Payload.AlertRulesEvaluationInterval)
+	require.EqualValues(t, 30, *okRsp.Payload.AlertRulesEvaluationInterval)
+	require.NotNil(t, okRsp.Payload.SMTPHost)
+	require.Empty(t, *okRsp.Payload.SMTPHost)
+	require.NotNil(t, okRsp.Payload.SMTPPort)
+	require.EqualValues(t, 25, *okRsp.Payload.SMTPPort)
+	require.NotNil(t, okRsp.Payload.SMTPTLS)
+	require.False(t, *okRsp.Payload.SMTPTLS)
+	require.NotNil(t, okRsp.Payload.EmailDigestInterval)
+	require.EqualValues(t, 3600, *okRsp.Payload.EmailDigestInterval)
+	require.Nil(t, okRsp.Payload.SMTPPassword)
+	require.NotNil(t, okRsp.Payload.SyslogAddress)
+	require.Empty(t, *okRsp.Payload.SyslogAddress)
+	require.NotNil(t, okRsp.Payload.SyslogTransport)
+	require.Equal(t, "udp", *okRsp.Payload.SyslogTransport)
+	require.NotNil(t, okRsp.Payload.EventPrunerInterval)
+	require.EqualValues(t, 3600, *okRsp.Payload.EventPrunerInterval)
+	require.NotNil(t, okRsp.Payload.EventMaxAgeInfo)
+	require.Zero(t, *okRsp.Payload.EventMaxAgeInfo)
+	require.NotNil(t, okRsp.Payload.EventDeduplicationWindow)
+	require.EqualValues(t, 300, *okRsp.Payload.EventDeduplicationWindow)
+	require.NotNil(t, okRsp.Payload.EventArchiveDirectory)
+	require.Empty(t, *okRsp.Payload.EventArchiveDirectory)
 
 	// update settings
 	paramsUS := settings.UpdateSettingsParams{
@@ -56,4 +97,141 @@ func TestSettings(t *testing.T) {
 	okRsp = rsp.(*settings.GetSettingsOK)
 	require.EqualValues(t, 10, okRsp.Payload.Bind9StatsPullerInterval)
 	require.EqualValues(t, "http://localhost:3000", okRsp.Payload.GrafanaURL)
+	// The required approvals have not been specified so they should
+	// remain unchanged.
+	require.Zero(t, *okRsp.Payload.ConfigChangeRequiredApprovals)
+	require.EqualValues(t, 60, *okRsp.Payload.KeaLeaseConflictsPullerInterval)
+
+	// Require approvals of the scheduled config changes.
+	requiredApprovals := int64(2)
+	paramsUS.Settings.ConfigChangeRequiredApprovals = &requiredApprovals
+	leaseConflictsPullerInterval := int64(120)
+	paramsUS.Settings.KeaLeaseConflictsPullerInterval = &leaseConflictsPullerInterval
+	exhaustionForecastHorizon := int64(90)
+	paramsUS.Settings.ExhaustionForecastHorizon = &exhaustionForecastHorizon
+	alertRulesEvaluationInterval := int64(15)
+	paramsUS.Settings.AlertRulesEvaluationInterval = &alertRulesEvaluationInterval
+	smtpHost := "smtp.example.org"
+	paramsUS.Settings.SMTPHost = &smtpHost
+	smtpPort := int64(465)
+	paramsUS.Settings.SMTPPort = &smtpPort
+	smtpTLS := true
+	paramsUS.Settings.SMTPTLS = &smtpTLS
+	smtpPassword := "secret"
+	paramsUS.Settings.SMTPPassword = &smtpPassword
+	syslogAddress := "syslog.example.org:6514"
+	paramsUS.Settings.SyslogAddress = &syslogAddress
+	syslogTransport := "tls"
+	paramsUS.Settings.SyslogTransport = &syslogTransport
+	eventMaxAgeInfo := int64(30)
+	paramsUS.Settings.EventMaxAgeInfo = &eventMaxAgeInfo
+	eventMaxCountError := int64(100000)
+	paramsUS.Settings.EventMaxCountError = &eventMaxCountError
+	eventDeduplicationWindow := int64(0)
+	paramsUS.Settings.EventDeduplicationWindow = &eventDeduplicationWindow
+	eventArchiveDirectory := "/var/lib/stork/events"
+	paramsUS.Settings.EventArchiveDirectory = &eventArchiveDirectory
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.UpdateSettingsOK{}, rsp)
+
+	rsp = rapi.GetSettings(ctx, paramsGS)
+	require.IsType(t, &settings.GetSettingsOK{}, rsp)
+	okRsp = rsp.(*settings.GetSettingsOK)
+	require.EqualValues(t, 2, *okRsp.Payload.ConfigChangeRequiredApprovals)
+	require.EqualValues(t, 120, *okRsp.Payload.KeaLeaseConflictsPullerInterval)
+	require.EqualValues(t, 90, *okRsp.Payload.ExhaustionForecastHorizon)
+	require.EqualValues(t, 60, *okRsp.Payload.ExhaustionForecastPullerInterval)
+	require.EqualValues(t, 15, *okRsp.Payload.AlertRulesEvaluationInterval)
+	require.Equal(t, "smtp.example.org", *okRsp.Payload.SMTPHost)
+	require.EqualValues(t, 465, *okRsp.Payload.SMTPPort)
+	require.True(t, *okRsp.Payload.SMTPTLS)
+	require.Nil(t, okRsp.Payload.SMTPPassword)
+	require.EqualValues(t, 3600, *okRsp.Payload.EmailDigestInterval)
+
+	require.Equal(t, "syslog.example.org:6514", *okRsp.Payload.SyslogAddress)
+	require.Equal(t, "tls", *okRsp.Payload.SyslogTransport)
+	require.EqualValues(t, 30, *okRsp.Payload.EventMaxAgeInfo)
+	require.Zero(t, *okRsp.Payload.EventMaxAgeWarning)
+	require.EqualValues(t, 100000, *okRsp.Payload.EventMaxCountError)
+	require.Zero(t, *okRsp.Payload.EventDeduplicationWindow)
+	require.Equal(t, "/var/lib/stork/events", *okRsp.Payload.EventArchiveDirectory)
+
+	password, err := dbmodel.GetSettingPasswd(db, "smtp_password")
+	require.NoError(t, err)
+	require.Equal(t, "secret", password)
+
+	// Negative number of approvals is invalid.
+	requiredApprovals = -1
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// Negative exhaustion forecast horizon is invalid.
+	requiredApprovals = 2
+	exhaustionForecastHorizon = -1
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// Invalid SMTP port.
+	exhaustionForecastHorizon = 90
+	smtpPort = 70000
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// Invalid syslog server address.
+	smtpPort = 25
+	syslogAddress = "syslog.example.org"
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// Invalid syslog transport.
+	syslogAddress = "syslog.example.org:514"
+	syslogTransport = "sctp"
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// Negative maximum age of the events is invalid.
+	syslogTransport = "udp"
+	eventMaxAgeInfo = -1
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// Negative deduplication window is invalid.
+	eventMaxAgeInfo = 30
+	eventDeduplicationWindow = -1
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+
+	// The event archive directory must be an absolute path.
+	eventDeduplicationWindow = 0
+	eventArchiveDirectory = "events"
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*rsp.(*settings.GetSettingsDefault)))
+
+	// Log-in the user who is not a super admin.
+	admin := &dbmodel.SystemUser{
+		Email:    "john@example.org",
+		Lastname: "Smith",
+		Name:     "John",
+		Password: "pass",
+		Groups:   []*dbmodel.SystemGroup{{ID: dbmodel.AdminGroupID}},
+	}
+	conflict, err := dbmodel.CreateUser(rapi.DB, admin)
+	require.False(t, conflict)
+	require.NoError(t, err)
+	ctx, err = rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+	err = rapi.SessionManager.LoginHandler(ctx, admin)
+	require.NoError(t, err)
+
+	// The admin can't change the event archive directory.
+	eventArchiveDirectory = "/tmp"
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.GetSettingsDefault{}, rsp)
+	require.Equal(t, http.StatusForbidden, getStatusCode(*rsp.(*settings.GetSettingsDefault)))
+
+	// The admin can update the other settings.
+	eventArchiveDirectory = "/var/lib/stork/events"
+	rsp = rapi.UpdateSettings(ctx, paramsUS)
+	require.IsType(t, &settings.UpdateSettingsOK{}, rsp)
 }
@@ -2,30 +2,64 @@ package restservice
 
 import (
 	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/go-openapi/strfmt"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"isc.org/stork/server/config"
 	dbmodel "isc.org/stork/server/database/model"
 
 	"isc.org/stork/server/gen/models"
 	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
 )
 
+// Converts the projected exhaustion date to the format used in REST API.
+// The zero date means that the exhaustion is not predicted and is
+// converted to nil.
+func exhaustionForecastToRestAPI(forecast time.Time) *strfmt.DateTime {
+	if forecast.IsZero() {
+		return nil
+	}
+	converted := strfmt.DateTime(forecast)
+	return &converted
+}
+
 func subnetToRestAPI(sn *dbmodel.Subnet) *models.Subnet {
 	subnet := &models.Subnet{
-		ID:               sn.ID,
-		Subnet:           sn.Prefix,
-		ClientClass:      sn.ClientClass,
-		AddrUtilization:  float64(sn.AddrUtilization) / 10,
-		Stats:            sn.Stats,
-		StatsCollectedAt: strfmt.DateTime(sn.StatsCollectedAt),
+		ID:                 sn.ID,
+		Subnet:             sn.Prefix,
+		ClientClass:        sn.ClientClass,
+		AddrUtilization:    float64(sn.AddrUtilization) / 10,
+		Stats:              sn.Stats,
+		StatsCollectedAt:   strfmt.DateTime(sn.StatsCollectedAt),
+		ExhaustionForecast: exhaustionForecastToRestAPI(sn.ExhaustionForecast),
 	}
 
 	for _, poolDetails := range sn.AddressPools {
 		pool := poolDetails.LowerBound + "-" + poolDetails.UpperBound
 		subnet.Pools = append(subnet.Pools, pool)
+		subnet.AddressPools = append(subnet.AddressPools, &models.AddressPool{
+			Pool:               pool,
+			Utilization:        float64(poolDetails.Utilization) / 10,
+			Stats:              poolDetails.Stats,
+			StatsCollectedAt:   strfmt.DateTime(poolDetails.StatsCollectedAt),
+			ExhaustionForecast: exhaustionForecastToRestAPI(poolDetails.ExhaustionForecast),
+		})
+	}
+
+	for _, prefixPoolDetails := range sn.PrefixPools {
+		subnet.PrefixDelegationPools = append(subnet.PrefixDelegationPools, &models.DelegatedPrefixPool{
+			Prefix:             prefixPoolDetails.Prefix,
+			DelegatedLength:    int64(prefixPoolDetails.DelegatedLen),
+			Utilization:        float64(prefixPoolDetails.Utilization) / 10,
+			Stats:              prefixPoolDetails.Stats,
+			StatsCollectedAt:   strfmt.DateTime(prefixPoolDetails.StatsCollectedAt),
+			ExhaustionForecast: exhaustionForecastToRestAPI(prefixPoolDetails.ExhaustionForecast),
+		})
 	}
 
 	if sn.SharedNetwork != nil {
@@ -106,6 +140,77 @@ func (r *RestAPI) GetSubnets(ctx context.Context, params dhcp.GetSubnetsParams)
 	return rsp
 }
 
+// Returns the subnet properties which can be modified via REST API in
+// the format stored in the audit trail.
+func subnetToAuditState(subnet *dbmodel.Subnet) map[string]interface{} {
+	pools := []string{}
+	for _, pool := range subnet.AddressPools {
+		pools = append(pools, pool.LowerBound+"-"+pool.UpperBound)
+	}
+	prefixPools := []string{}
+	for _, pool := range subnet.PrefixPools {
+		prefixPools = append(prefixPools, fmt.Sprintf("%s (delegated length %d)", pool.Prefix, pool.DelegatedLen))
+	}
+	localSubnets := []map[string]interface{}{}
+	for _, ls := range subnet.LocalSubnets {
+		localSubnets = append(localSubnets, map[string]interface{}{
+			"daemonId": ls.DaemonID,
+			"id":       ls.LocalSubnetID,
+		})
+	}
+	return map[string]interface{}{
+		"subnet":                subnet.Prefix,
+		"clientClass":           subnet.ClientClass,
+		"sharedNetworkId":       subnet.SharedNetworkID,
+		"pools":                 pools,
+		"prefixDelegationPools": prefixPools,
+		"localSubnets":          localSubnets,
+	}
+}
+
+// Returns the shared network properties which can be modified via REST
+// API in the format stored in the audit trail. The parameters are the Kea
+// parameters of the shared network specified by the user. They are not
+// stored in the database, so they are only included in the state after
+// the change.
+func sharedNetworkToAuditState(network *dbmodel.SharedNetwork, parameters map[string]any) map[string]interface{} {
+	subnetIDs := []int64{}
+	for _, subnet := range network.Subnets {
+		subnetIDs = append(subnetIDs, subnet.ID)
+	}
+	state := map[string]interface{}{
+		"name":      network.Name,
+		"subnetIds": subnetIDs,
+	}
+	if parameters != nil {
+		state["parameters"] = parameters
+	}
+	return state
+}
+
+// Converts the shared network with its subnets to the format used in
+// REST API.
+func sharedNetworkToRestAPI(net *dbmodel.SharedNetwork) *models.SharedNetwork {
+	subnets := []*models.Subnet{}
+	// Exclude the subnets that are not attached to any app. This shouldn't
+	// be the case but let's be safe.
+	for _, snTmp := range net.Subnets {
+		sn := snTmp
+		subnet := subnetToRestAPI(&sn)
+		subnets = append(subnets, subnet)
+	}
+	// Create shared network.
+	sharedNetwork := &models.SharedNetwork{
+		ID:               net.ID,
+		Name:             net.Name,
+		Subnets:          subnets,
+		AddrUtilization:  float64(net.AddrUtilization) / 10,
+		Stats:            net.Stats,
+		StatsCollectedAt: strfmt.DateTime(net.StatsCollectedAt),
+	}
+	return sharedNetwork
+}
+
 func (r *RestAPI) getSharedNetworks(offset, limit, appID, family int64, filterText *string, sortField string, sortDir dbmodel.SortDirEnum) (*models.SharedNetworks, error) {
 	// get shared networks from db
 	dbSharedNetworks, total, err := dbmodel.GetSharedNetworksByPage(r.DB, offset, limit, appID, family, filterText, sortField, sortDir)
@@ -119,27 +224,12 @@ func (r *RestAPI) getSharedNetworks(offset, limit, appID, family int64, filterTe
 	}
 
 	// go through shared networks and their subnets from db and change their format to ReST one
-	for _, net := range dbSharedNetworks {
+	for i := range dbSharedNetworks {
+		net := &dbSharedNetworks[i]
 		if len(net.Subnets) == 0 || len(net.Subnets[0].LocalSubnets) == 0 {
 			continue
 		}
-		subnets := []*models.Subnet{}
-		// Exclude the subnets that are not attached to any app. This shouldn't
-		// be the case but let's be safe.
-		for _, snTmp := range net.Subnets {
-			sn := snTmp
-			subnet := subnetToRestAPI(&sn)
-			subnets = append(subnets, subnet)
-		}
-		// Create shared network.
-		sharedNetwork := &models.SharedNetwork{
-			ID:               net.ID,
-			Name:             net.Name,
-			Subnets:          subnets,
-			AddrUtilization:  float64(net.AddrUtilization) / 10,
-			Stats:            net.Stats,
-			StatsCollectedAt: strfmt.DateTime(net.StatsCollectedAt),
-		}
+		sharedNetwork := sharedNetworkToRestAPI(net)
 		sharedNetworks.Items = append(sharedNetworks.Items, sharedNetwork)
 	}
 
@@ -182,3 +272,753 @@ func (r *RestAPI) GetSharedNetworks(ctx context.Context, params dhcp.GetSharedNe
 	rsp := dhcp.NewGetSharedNetworksOK().WithPayload(sharedNetworks)
 	return rsp
 }
+
+// Converts subnet data from the REST API format to the database model.
+// The local subnets merely contain daemon IDs and local subnet IDs.
+// The daemon information must be populated by the caller when required.
+func convertToSubnet(restSubnet *models.Subnet) (*dbmodel.Subnet, error) {
+	subnet := &dbmodel.Subnet{
+		ID:          restSubnet.ID,
+		Prefix:      restSubnet.Subnet,
+		ClientClass: restSubnet.ClientClass,
+	}
+	for _, p := range restSubnet.Pools {
+		pool, err := dbmodel.NewAddressPoolFromRange(p)
+		if err != nil {
+			return nil, err
+		}
+		subnet.AddressPools = append(subnet.AddressPools, *pool)
+	}
+	for _, p := range restSubnet.PrefixDelegationPools {
+		if p == nil {
+			continue
+		}
+		pool, err := dbmodel.NewPrefixPool(p.Prefix, int(p.DelegatedLength))
+		if err != nil {
+			return nil, err
+		}
+		subnet.PrefixPools = append(subnet.PrefixPools, *pool)
+	}
+	for _, ls := range restSubnet.LocalSubnets {
+		if ls == nil {
+			continue
+		}
+		subnet.LocalSubnets = append(subnet.LocalSubnets, &dbmodel.LocalSubnet{
+			DaemonID:      ls.DaemonID,
+			LocalSubnetID: ls.ID,
+		})
+	}
+	return subnet, nil
+}
+
+// Common function executed when creating a new transaction for adding or
+// updating a subnet. It fetches the available DHCP daemons with the
+// subnet_cmds hooks library loaded. It also creates transaction context.
+// If an error occurs, an http error code and message are returned.
+func (r *RestAPI) commonCreateOrUpdateSubnetBegin(ctx context.Context) ([]*models.KeaDaemon, context.Context, int, string) {
+	// A list of Kea DHCP daemons will be needed in the user form,
+	// so the user can select which servers send the subnet to.
+	daemons, err := dbmodel.GetKeaDHCPDaemons(r.DB)
+	if err != nil {
+		msg := "problem with fetching Kea daemons from the database"
+		log.Error(err)
+		return nil, nil, http.StatusInternalServerError, msg
+	}
+	respDaemons := []*models.KeaDaemon{}
+	for i := range daemons {
+		if daemons[i].KeaDaemon != nil && daemons[i].KeaDaemon.Config != nil {
+			// Filter the daemons with subnet_cmds hook library.
+			if _, _, exists := daemons[i].KeaDaemon.Config.GetHooksLibrary("libdhcp_subnet_cmds"); exists {
+				respDaemons = append(respDaemons, keaDaemonToRestAPI(&daemons[i]))
+			}
+		}
+	}
+	// If there are no daemons with subnet_cmds hooks library loaded there is no way
+	// to add or update a subnet. In that case, we don't begin a transaction.
+	if len(respDaemons) == 0 {
+		msg := "unable to begin transaction for the subnet because there are no Kea servers with subnet_cmds hooks library available"
+		log.Error(msg)
+		return nil, nil, http.StatusBadRequest, msg
+	}
+	// Get the logged user's ID.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to begin transaction because user is not logged in"
+		log.Error("problem with creating transaction context because user has no session")
+		return nil, nil, http.StatusForbidden, msg
+	}
+	// Create configuration context.
+	cctx, err := r.ConfigManager.CreateContext(int64(user.ID))
+	if err != nil {
+		msg := "problem with creating transaction context"
+		log.Error(err)
+		return nil, nil, http.StatusInternalServerError, msg
+	}
+	return respDaemons, cctx, 0, ""
+}
+
+// Implements the POST call to create new transaction for adding a new
+// subnet (subnets/new/transaction).
+func (r *RestAPI) CreateSubnetBegin(ctx context.Context, params dhcp.CreateSubnetBeginParams) middleware.Responder {
+	// Execute the common part between create and update operations. It retrieves
+	// the daemons and creates the transaction context.
+	respDaemons, cctx, code, msg := r.commonCreateOrUpdateSubnetBegin(ctx)
+	if code != 0 {
+		// Error case.
+		rsp := dhcp.NewCreateSubnetBeginDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Begin subnet add transaction.
+	var err error
+	if cctx, err = r.ConfigManager.GetKeaModule().BeginSubnetAdd(cctx); err != nil {
+		msg := "problem with initializing transaction for creating new subnet"
+		log.Error(msg)
+		rsp := dhcp.NewCreateSubnetBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	// Retrieve the generated context ID.
+	cctxID, ok := config.GetValueAsInt64(cctx, config.ContextIDKey)
+	if !ok {
+		msg := "problem with retrieving context ID for a transaction"
+		log.Error(msg)
+		rsp := dhcp.NewCreateSubnetBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Remember the context, i.e. new transaction has been successfully created.
+	_ = r.ConfigManager.RememberContext(cctx, time.Minute*10)
+
+	// Return transaction ID and daemons to the user.
+	contents := &models.CreateSubnetBeginResponse{
+		ID:      cctxID,
+		Daemons: respDaemons,
+	}
+	rsp := dhcp.NewCreateSubnetBeginOK().WithPayload(contents)
+	return rsp
+}
+
+// Common function that implements the POST calls to apply and commit a new
+// or updated subnet. The transactionID is the identifier of the current
+// configuration transaction used by the function to recover the transaction
+// context. The restSubnet is the pointer to the subnet specified by the user.
+// It is converted by this function to the database model. The applyFunc is
+// one of the ApplySubnetAdd or ApplySubnetUpdate, depending on whether the
+// subnet is created or updated. This function returns the HTTP error code
+// if an error occurs or 0 when there is no error. In addition it returns an
+// error string to be included in the HTTP response or an empty string if
+// there is no error.
+func (r *RestAPI) commonCreateOrUpdateSubnetSubmit(ctx context.Context, transactionID int64, restSubnet *models.Subnet, applyFunc func(context.Context, *dbmodel.Subnet) (context.Context, error)) (int, string) {
+	// Make sure that the subnet information is present.
+	if restSubnet == nil {
+		msg := "subnet information not specified"
+		log.Errorf(msg)
+		return http.StatusBadRequest, msg
+	}
+	// Get the user ID and recover the transaction context.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to submit because user is not logged in"
+		log.Error("problem with recovering transaction context because user has no session")
+		return http.StatusForbidden, msg
+	}
+	// Retrieve the context from the config manager.
+	cctx, _ := r.ConfigManager.RecoverContext(transactionID, int64(user.ID))
+	if cctx == nil {
+		msg := "transaction expired"
+		log.Errorf("problem with recovering transaction context for transaction ID %d and user ID %d", transactionID, user.ID)
+		return http.StatusNotFound, msg
+	}
+
+	// Convert subnet information from REST API to database format.
+	subnet, err := convertToSubnet(restSubnet)
+	if err != nil {
+		msg := "error parsing specified subnet"
+		log.Error(err)
+		return http.StatusBadRequest, msg
+	}
+	err = subnet.PopulateDaemons(r.DB)
+	if err != nil {
+		msg := "specified subnet is associated with daemons that no longer exist"
+		log.Error(err)
+		return http.StatusNotFound, msg
+	}
+	// The transaction ends regardless of the result. It releases the daemons
+	// locked by this transaction.
+	defer func() {
+		r.ConfigManager.Done(cctx)
+	}()
+	// Remember the subnet before the update for the audit trail. It is
+	// not present when a new subnet is created.
+	var subnetBefore map[string]interface{}
+	if state, ok := config.GetTransactionState(cctx); ok && len(state.Updates) > 0 {
+		if dbSubnetBefore, ok := state.Updates[0].Recipe["subnet_before_update"].(dbmodel.Subnet); ok {
+			subnetBefore = subnetToAuditState(&dbSubnetBefore)
+		}
+	}
+	// Apply the subnet information (create Kea commands).
+	cctx, err = applyFunc(cctx, subnet)
+	if err != nil {
+		var lock *config.LockError
+		if errors.As(err, &lock) {
+			// Failed to lock daemons.
+			msg := err.Error()
+			log.Error(err)
+			return http.StatusLocked, msg
+		}
+		msg := "problem with applying subnet information"
+		log.Error(err)
+		return http.StatusInternalServerError, msg
+	}
+	// Send the commands to Kea servers.
+	cctx, err = r.ConfigManager.Commit(cctx)
+	if err != nil {
+		msg := fmt.Sprintf("problem with committing subnet information: %s", err)
+		log.Error(err)
+		return http.StatusConflict, msg
+	}
+	// The committed subnet holds the ID assigned to the new subnet.
+	if state, ok := config.GetTransactionState(cctx); ok && len(state.Updates) > 0 {
+		if committed, ok := state.Updates[0].Recipe["subnet"].(dbmodel.Subnet); ok {
+			r.addAuditRecord(ctx, dbmodel.AuditTargetSubnet, committed.ID, subnetBefore, subnetToAuditState(&committed))
+		}
+	}
+	// Everything ok. Send OK to the client.
+	return 0, ""
+}
+
+// Implements the POST call to apply and commit a new subnet (subnets/new/transaction/{id}/submit).
+func (r *RestAPI) CreateSubnetSubmit(ctx context.Context, params dhcp.CreateSubnetSubmitParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateSubnetSubmit(ctx, params.ID, params.Subnet, r.ConfigManager.GetKeaModule().ApplySubnetAdd); code != 0 {
+		// Error case.
+		rsp := dhcp.NewCreateSubnetSubmitDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewCreateSubnetSubmitOK()
+	return rsp
+}
+
+// Implements the DELETE call to cancel adding new subnet (subnets/new/transaction/{id}). It
+// removes the specified transaction from the config manager, if the transaction exists.
+func (r *RestAPI) CreateSubnetDelete(ctx context.Context, params dhcp.CreateSubnetDeleteParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateHostDelete(ctx, params.ID); code != 0 {
+		// Error case.
+		rsp := dhcp.NewCreateSubnetDeleteDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewCreateSubnetDeleteOK()
+	return rsp
+}
+
+// Implements the POST call to create new transaction for updating an
+// existing subnet (subnets/{subnetId}/transaction).
+func (r *RestAPI) UpdateSubnetBegin(ctx context.Context, params dhcp.UpdateSubnetBeginParams) middleware.Responder {
+	// Execute the common part between create and update operations. It retrieves
+	// the daemons and creates the transaction context.
+	respDaemons, cctx, code, msg := r.commonCreateOrUpdateSubnetBegin(ctx)
+	if code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateSubnetBeginDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Begin subnet update transaction. It retrieves current subnet information
+	// and locks daemons for updates.
+	var err error
+	cctx, err = r.ConfigManager.GetKeaModule().BeginSubnetUpdate(cctx, params.SubnetID)
+	if err != nil {
+		var (
+			subnetNotFound *config.SubnetNotFoundError
+			lock           *config.LockError
+		)
+		switch {
+		case errors.As(err, &subnetNotFound):
+			// Failed to find subnet.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewUpdateSubnetBeginDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		case errors.As(err, &lock):
+			// Failed to lock daemons.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewUpdateSubnetBeginDefault(http.StatusLocked).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		default:
+			// Other error.
+			msg := "problem with initializing transaction for subnet update"
+			log.Error(msg)
+			rsp := dhcp.NewUpdateSubnetBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+	}
+	state, _ := config.GetTransactionState(cctx)
+	subnet := state.Updates[0].Recipe["subnet_before_update"].(dbmodel.Subnet)
+
+	// Retrieve the generated context ID.
+	cctxID, ok := config.GetValueAsInt64(cctx, config.ContextIDKey)
+	if !ok {
+		msg := "problem with retrieving context ID for a transaction"
+		log.Error(msg)
+		rsp := dhcp.NewUpdateSubnetBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Remember the context, i.e. new transaction has been successfully created.
+	_ = r.ConfigManager.RememberContext(cctx, time.Minute*10)
+
+	// Return transaction ID, subnet and daemons to the user.
+	contents := &models.UpdateSubnetBeginResponse{
+		ID:      cctxID,
+		Subnet:  subnetToRestAPI(&subnet),
+		Daemons: respDaemons,
+	}
+	rsp := dhcp.NewUpdateSubnetBeginOK().WithPayload(contents)
+	return rsp
+}
+
+// Implements the POST call and commit an updated subnet (subnets/{subnetId}/transaction/{id}/submit).
+func (r *RestAPI) UpdateSubnetSubmit(ctx context.Context, params dhcp.UpdateSubnetSubmitParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateSubnetSubmit(ctx, params.ID, params.Subnet, r.ConfigManager.GetKeaModule().ApplySubnetUpdate); code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateSubnetSubmitDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewUpdateSubnetSubmitOK()
+	return rsp
+}
+
+// Implements the DELETE call to cancel updating a subnet (subnets/{subnetId}/transaction/{id}).
+// It removes the specified transaction from the config manager, if the transaction exists.
+func (r *RestAPI) UpdateSubnetDelete(ctx context.Context, params dhcp.UpdateSubnetDeleteParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateHostDelete(ctx, params.ID); code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateSubnetDeleteDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewUpdateSubnetDeleteOK()
+	return rsp
+}
+
+// Implements the DELETE call for a subnet (subnets/{id}). It sends suitable commands
+// to the Kea servers owning the subnet. Similarly to deleting a host reservation,
+// this operation is not transactional.
+func (r *RestAPI) DeleteSubnet(ctx context.Context, params dhcp.DeleteSubnetParams) middleware.Responder {
+	dbSubnet, err := dbmodel.GetSubnet(r.DB, params.ID)
+	if err != nil {
+		// Error while communicating with the database.
+		msg := fmt.Sprintf("Problem fetching subnet with ID %d from db", params.ID)
+		log.Error(err)
+		rsp := dhcp.NewDeleteSubnetDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if dbSubnet == nil {
+		// Subnet not found.
+		msg := fmt.Sprintf("Cannot find subnet with ID %d", params.ID)
+		rsp := dhcp.NewDeleteSubnetDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Get the logged user's ID.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to begin transaction because user is not logged in"
+		log.Error("problem with creating transaction context because user has no session")
+		rsp := dhcp.NewDeleteSubnetDefault(http.StatusForbidden).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Create configuration context.
+	cctx, err := r.ConfigManager.CreateContext(int64(user.ID))
+	if err != nil {
+		msg := "problem with creating transaction context"
+		log.Error(err)
+		rsp := dhcp.NewDeleteSubnetDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Release the daemons locked by this operation regardless of the result.
+	defer func() {
+		r.ConfigManager.Done(cctx)
+	}()
+	// Create Kea commands to delete the subnet.
+	cctx, err = r.ConfigManager.GetKeaModule().ApplySubnetDelete(cctx, dbSubnet)
+	if err != nil {
+		var lock *config.LockError
+		if errors.As(err, &lock) {
+			// Failed to lock daemons.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewDeleteSubnetDefault(http.StatusLocked).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+		msg := "problem with preparing commands for deleting subnet"
+		log.Error(err)
+		rsp := dhcp.NewDeleteSubnetDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Send the commands to Kea servers.
+	cctx, err = r.ConfigManager.Commit(cctx)
+	if err != nil {
+		msg := fmt.Sprintf("problem with deleting subnet: %s", err)
+		log.Error(err)
+		rsp := dhcp.NewDeleteSubnetDefault(http.StatusConflict).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetSubnet, dbSubnet.ID, subnetToAuditState(dbSubnet), nil)
+	// Send OK to the client.
+	rsp := dhcp.NewDeleteSubnetOK()
+	return rsp
+}
+
+// Converts the shared network specified by the user to the database model.
+// The subnets merely contain their IDs. It also returns the Kea parameters
+// of the shared network to be set.
+func convertToSharedNetwork(restNetwork *models.EditedSharedNetwork) (*dbmodel.SharedNetwork, map[string]any, error) {
+	network := &dbmodel.SharedNetwork{
+		Name: restNetwork.Name,
+	}
+	for _, subnetID := range restNetwork.SubnetIds {
+		network.Subnets = append(network.Subnets, dbmodel.Subnet{
+			ID: subnetID,
+		})
+	}
+	var parameters map[string]any
+	if restNetwork.Parameters != nil {
+		var ok bool
+		if parameters, ok = restNetwork.Parameters.(map[string]any); !ok {
+			return nil, nil, errors.New("shared network parameters must be a map")
+		}
+	}
+	return network, parameters, nil
+}
+
+// Common function executed when creating a new transaction for adding or
+// updating a shared network. It fetches the available DHCP daemons with
+// the subnet_cmds hooks library loaded and the subnets. It also creates
+// transaction context. If an error occurs, an http error code and message
+// are returned.
+func (r *RestAPI) commonCreateOrUpdateSharedNetworkBegin(ctx context.Context) ([]*models.KeaDaemon, []*models.Subnet, context.Context, int, string) {
+	respDaemons, cctx, code, msg := r.commonCreateOrUpdateSubnetBegin(ctx)
+	if code != 0 {
+		return nil, nil, nil, code, msg
+	}
+	// The user needs a current list of available subnets to select the
+	// ones belonging to the shared network.
+	subnets, err := dbmodel.GetAllSubnets(r.DB, 0)
+	if err != nil {
+		r.ConfigManager.Done(cctx)
+		msg := "problem with fetching subnets from the database"
+		log.Error(err)
+		return nil, nil, nil, http.StatusInternalServerError, msg
+	}
+	// Convert subnets list to REST API format.
+	respSubnets := []*models.Subnet{}
+	for i := range subnets {
+		respSubnets = append(respSubnets, subnetToRestAPI(&subnets[i]))
+	}
+	return respDaemons, respSubnets, cctx, 0, ""
+}
+
+// Implements the POST call to create new transaction for adding a new
+// shared network (shared-networks/new/transaction).
+func (r *RestAPI) CreateSharedNetworkBegin(ctx context.Context, params dhcp.CreateSharedNetworkBeginParams) middleware.Responder {
+	// Execute the common part between create and update operations. It retrieves
+	// the daemons, subnets and creates the transaction context.
+	respDaemons, respSubnets, cctx, code, msg := r.commonCreateOrUpdateSharedNetworkBegin(ctx)
+	if code != 0 {
+		// Error case.
+		rsp := dhcp.NewCreateSharedNetworkBeginDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Begin shared network add transaction.
+	var err error
+	if cctx, err = r.ConfigManager.GetKeaModule().BeginSharedNetworkAdd(cctx); err != nil {
+		msg := "problem with initializing transaction for creating new shared network"
+		log.Error(msg)
+		rsp := dhcp.NewCreateSharedNetworkBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	// Retrieve the generated context ID.
+	cctxID, ok := config.GetValueAsInt64(cctx, config.ContextIDKey)
+	if !ok {
+		msg := "problem with retrieving context ID for a transaction"
+		log.Error(msg)
+		rsp := dhcp.NewCreateSharedNetworkBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Remember the context, i.e. new transaction has been successfully created.
+	_ = r.ConfigManager.RememberContext(cctx, time.Minute*10)
+
+	// Return transaction ID, daemons and subnets to the user.
+	contents := &models.CreateSharedNetworkBeginResponse{
+		ID:      cctxID,
+		Daemons: respDaemons,
+		Subnets: respSubnets,
+	}
+	rsp := dhcp.NewCreateSharedNetworkBeginOK().WithPayload(contents)
+	return rsp
+}
+
+// Common function that implements the POST calls to apply and commit a new
+// or updated shared network. The transactionID is the identifier of the
+// current configuration transaction used by the function to recover the
+// transaction context. The restNetwork is the pointer to the shared network
+// specified by the user. It is converted by this function to the database
+// model. The applyFunc is one of the ApplySharedNetworkAdd or
+// ApplySharedNetworkUpdate, depending on whether the shared network is
+// created or updated. This function returns the HTTP error code if an error
+// occurs or 0 when there is no error. In addition it returns an error string
+// to be included in the HTTP response or an empty string if there is no error.
+func (r *RestAPI) commonCreateOrUpdateSharedNetworkSubmit(ctx context.Context, transactionID int64, restNetwork *models.EditedSharedNetwork, applyFunc func(context.Context, *dbmodel.SharedNetwork, map[string]any) (context.Context, error)) (int, string) {
+	// Make sure that the shared network information is present.
+	if restNetwork == nil {
+		msg := "shared network information not specified"
+		log.Errorf(msg)
+		return http.StatusBadRequest, msg
+	}
+	// Get the user ID and recover the transaction context.
+	ok, user := r.SessionManager.Logged(ctx)
+	if !ok {
+		msg := "unable to submit because user is not logged in"
+		log.Error("problem with recovering transaction context because user has no session")
+		return http.StatusForbidden, msg
+	}
+	// Retrieve the context from the config manager.
+	cctx, _ := r.ConfigManager.RecoverContext(transactionID, int64(user.ID))
+	if cctx == nil {
+		msg := "transaction expired"
+		log.Errorf("problem with recovering transaction context for transaction ID %d and user ID %d", transactionID, user.ID)
+		return http.StatusNotFound, msg
+	}
+
+	// Convert shared network information from REST API to database format.
+	network, parameters, err := convertToSharedNetwork(restNetwork)
+	if err != nil {
+		msg := "error parsing specified shared network"
+		log.Error(err)
+		return http.StatusBadRequest, msg
+	}
+	err = network.PopulateSubnets(r.DB)
+	if err != nil {
+		msg := "specified shared network contains subnets that no longer exist"
+		log.Error(err)
+		return http.StatusNotFound, msg
+	}
+	// The transaction ends regardless of the result. It releases the daemons
+	// locked by this transaction.
+	defer func() {
+		r.ConfigManager.Done(cctx)
+	}()
+	// Remember the shared network before the update for the audit trail.
+	// It is not present when a new shared network is created.
+	var networkBefore map[string]interface{}
+	if state, ok := config.GetTransactionState(cctx); ok && len(state.Updates) > 0 {
+		if dbNetworkBefore, ok := state.Updates[0].Recipe["shared_network_before_update"].(dbmodel.SharedNetwork); ok {
+			networkBefore = sharedNetworkToAuditState(&dbNetworkBefore, nil)
+		}
+	}
+	// Apply the shared network information (create Kea commands).
+	cctx, err = applyFunc(cctx, network, parameters)
+	if err != nil {
+		var lock *config.LockError
+		if errors.As(err, &lock) {
+			// Failed to lock daemons.
+			msg := err.Error()
+			log.Error(err)
+			return http.StatusLocked, msg
+		}
+		msg := "problem with applying shared network information"
+		log.Error(err)
+		return http.StatusInternalServerError, msg
+	}
+	// Send the commands to Kea servers.
+	cctx, err = r.ConfigManager.Commit(cctx)
+	if err != nil {
+		msg := fmt.Sprintf("problem with committing shared network information: %s", err)
+		log.Error(err)
+		return http.StatusConflict, msg
+	}
+	// The committed shared network holds the ID assigned to the new
+	// shared network.
+	if state, ok := config.GetTransactionState(cctx); ok && len(state.Updates) > 0 {
+		if committed, ok := state.Updates[0].Recipe["shared_network"].(dbmodel.SharedNetwork); ok {
+			r.addAuditRecord(ctx, dbmodel.AuditTargetSharedNetwork, committed.ID, networkBefore, sharedNetworkToAuditState(&committed, parameters))
+		}
+	}
+	// Everything ok. Send OK to the client.
+	return 0, ""
+}
+
+// Implements the POST call to apply and commit a new shared network
+// (shared-networks/new/transaction/{id}/submit).
+func (r *RestAPI) CreateSharedNetworkSubmit(ctx context.Context, params dhcp.CreateSharedNetworkSubmitParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateSharedNetworkSubmit(ctx, params.ID, params.SharedNetwork, r.ConfigManager.GetKeaModule().ApplySharedNetworkAdd); code != 0 {
+		// Error case.
+		rsp := dhcp.NewCreateSharedNetworkSubmitDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewCreateSharedNetworkSubmitOK()
+	return rsp
+}
+
+// Implements the DELETE call to cancel adding new shared network
+// (shared-networks/new/transaction/{id}). It removes the specified
+// transaction from the config manager, if the transaction exists.
+func (r *RestAPI) CreateSharedNetworkDelete(ctx context.Context, params dhcp.CreateSharedNetworkDeleteParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateHostDelete(ctx, params.ID); code != 0 {
+		// Error case.
+		rsp := dhcp.NewCreateSharedNetworkDeleteDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewCreateSharedNetworkDeleteOK()
+	return rsp
+}
+
+// Implements the POST call to create new transaction for updating an
+// existing shared network (shared-networks/{sharedNetworkId}/transaction).
+func (r *RestAPI) UpdateSharedNetworkBegin(ctx context.Context, params dhcp.UpdateSharedNetworkBeginParams) middleware.Responder {
+	// Execute the common part between create and update operations. It retrieves
+	// the daemons, subnets and creates the transaction context.
+	respDaemons, respSubnets, cctx, code, msg := r.commonCreateOrUpdateSharedNetworkBegin(ctx)
+	if code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateSharedNetworkBeginDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Begin shared network update transaction. It retrieves current shared
+	// network information and locks daemons for updates.
+	var err error
+	cctx, err = r.ConfigManager.GetKeaModule().BeginSharedNetworkUpdate(cctx, params.SharedNetworkID)
+	if err != nil {
+		var (
+			networkNotFound *config.SharedNetworkNotFoundError
+			lock            *config.LockError
+		)
+		switch {
+		case errors.As(err, &networkNotFound):
+			// Failed to find shared network.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewUpdateSharedNetworkBeginDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		case errors.As(err, &lock):
+			// Failed to lock daemons.
+			msg := err.Error()
+			log.Error(err)
+			rsp := dhcp.NewUpdateSharedNetworkBeginDefault(http.StatusLocked).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		default:
+			// Other error.
+			msg := "problem with initializing transaction for shared network update"
+			log.Error(msg)
+			rsp := dhcp.NewUpdateSharedNetworkBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+				Message: &msg,
+			})
+			return rsp
+		}
+	}
+	state, _ := config.GetTransactionState(cctx)
+	network := state.Updates[0].Recipe["shared_network_before_update"].(dbmodel.SharedNetwork)
+
+	// Retrieve the generated context ID.
+	cctxID, ok := config.GetValueAsInt64(cctx, config.ContextIDKey)
+	if !ok {
+		msg := "problem with retrieving context ID for a transaction"
+		log.Error(msg)
+		rsp := dhcp.NewUpdateSharedNetworkBeginDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	// Remember the context, i.e. new transaction has been successfully created.
+	_ = r.ConfigManager.RememberContext(cctx, time.Minute*10)
+
+	// Return transaction ID, shared network, daemons and subnets to the user.
+	contents := &models.UpdateSharedNetworkBeginResponse{
+		ID:            cctxID,
+		SharedNetwork: sharedNetworkToRestAPI(&network),
+		Daemons:       respDaemons,
+		Subnets:       respSubnets,
+	}
+	rsp := dhcp.NewUpdateSharedNetworkBeginOK().WithPayload(contents)
+	return rsp
+}
+
+// Implements the POST call and commit an updated shared network
+// (shared-networks/{sharedNetworkId}/transaction/{id}/submit).
+func (r *RestAPI) UpdateSharedNetworkSubmit(ctx context.Context, params dhcp.UpdateSharedNetworkSubmitParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateSharedNetworkSubmit(ctx, params.ID, params.SharedNetwork, r.ConfigManager.GetKeaModule().ApplySharedNetworkUpdate); code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateSharedNetworkSubmitDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewUpdateSharedNetworkSubmitOK()
+	return rsp
+}
+
+// Implements the DELETE call to cancel updating a shared network
+// (shared-networks/{sharedNetworkId}/transaction/{id}). It removes the
+// specified transaction from the config manager, if the transaction exists.
+func (r *RestAPI) UpdateSharedNetworkDelete(ctx context.Context, params dhcp.UpdateSharedNetworkDeleteParams) middleware.Responder {
+	if code, msg := r.commonCreateOrUpdateHostDelete(ctx, params.ID); code != 0 {
+		// Error case.
+		rsp := dhcp.NewUpdateSharedNetworkDeleteDefault(code).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	rsp := dhcp.NewUpdateSharedNetworkDeleteOK()
+	return rsp
+}
@@ -2,13 +2,17 @@ package restservice
 
 import (
 	"context"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	agentcommtest "isc.org/stork/server/agentcomm/test"
+	apps "isc.org/stork/server/apps"
+	appstest "isc.org/stork/server/apps/test"
 	dbmodel "isc.org/stork/server/database/model"
 	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
 	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
 	storktest "isc.org/stork/server/test/dbmodel"
 )
@@ -539,3 +543,864 @@ func TestGetSharedNetworks(t *testing.T) {
 	require.Nil(t, okRsp.Payload.Items[1].Subnets[0].LocalSubnets[0].Stats)
 	require.ElementsMatch(t, []string{"mouse", "frog"}, []string{okRsp.Payload.Items[0].Name, okRsp.Payload.Items[1].Name})
 }
+
+// Test conversion of the subnet from the REST API format to the
+// database model.
+func TestConvertToSubnet(t *testing.T) {
+	restSubnet := &models.Subnet{
+		ID:          1,
+		Subnet:      "2001:db8:1::/64",
+		ClientClass: "foo",
+		Pools:       []string{"2001:db8:1::10-2001:db8:1::20"},
+		PrefixDelegationPools: []*models.DelegatedPrefixPool{
+			{
+				Prefix:          "3000::/48",
+				DelegatedLength: 64,
+			},
+		},
+		LocalSubnets: []*models.LocalSubnet{
+			{
+				ID:       123,
+				DaemonID: 2,
+			},
+		},
+	}
+	subnet, err := convertToSubnet(restSubnet)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+	require.EqualValues(t, 1, subnet.ID)
+	require.Equal(t, "2001:db8:1::/64", subnet.Prefix)
+	require.Equal(t, "foo", subnet.ClientClass)
+	require.Len(t, subnet.AddressPools, 1)
+	require.Equal(t, "2001:db8:1::10", subnet.AddressPools[0].LowerBound)
+	require.Equal(t, "2001:db8:1::20", subnet.AddressPools[0].UpperBound)
+	require.Len(t, subnet.PrefixPools, 1)
+	require.Equal(t, "3000::/48", subnet.PrefixPools[0].Prefix)
+	require.Equal(t, 64, subnet.PrefixPools[0].DelegatedLen)
+	require.Len(t, subnet.LocalSubnets, 1)
+	require.EqualValues(t, 2, subnet.LocalSubnets[0].DaemonID)
+	require.EqualValues(t, 123, subnet.LocalSubnets[0].LocalSubnetID)
+
+	// Invalid pool.
+	restSubnet.Pools = []string{"foo"}
+	_, err = convertToSubnet(restSubnet)
+	require.Error(t, err)
+}
+
+// Test that the pool utilization and statistics are included in the
+// subnet returned over the REST API.
+func TestSubnetToRestAPIPoolStats(t *testing.T) {
+	collectedAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	subnet := &dbmodel.Subnet{
+		ID:     1,
+		Prefix: "2001:db8:1::/64",
+		AddressPools: []dbmodel.AddressPool{
+			{
+				LowerBound:       "2001:db8:1::10",
+				UpperBound:       "2001:db8:1::20",
+				Utilization:      235,
+				Stats:            dbmodel.SubnetStats{"total-nas": uint64(17)},
+				StatsCollectedAt: collectedAt,
+			},
+		},
+		PrefixPools: []dbmodel.PrefixPool{
+			{
+				Prefix:             "3000::/48",
+				DelegatedLen:       64,
+				Utilization:        500,
+				Stats:              dbmodel.SubnetStats{"assigned-pds": uint64(50)},
+				StatsCollectedAt:   collectedAt,
+				ExhaustionForecast: collectedAt.Add(24 * time.Hour),
+			},
+		},
+	}
+	restSubnet := subnetToRestAPI(subnet)
+	require.NotNil(t, restSubnet)
+
+	require.Equal(t, []string{"2001:db8:1::10-2001:db8:1::20"}, restSubnet.Pools)
+	require.Len(t, restSubnet.AddressPools, 1)
+	require.Equal(t, "2001:db8:1::10-2001:db8:1::20", restSubnet.AddressPools[0].Pool)
+	require.InDelta(t, 23.5, restSubnet.AddressPools[0].Utilization, 0.001)
+	require.EqualValues(t, 17, restSubnet.AddressPools[0].Stats.(dbmodel.SubnetStats)["total-nas"])
+	require.Equal(t, collectedAt, time.Time(restSubnet.AddressPools[0].StatsCollectedAt))
+
+	require.Len(t, restSubnet.PrefixDelegationPools, 1)
+	require.InDelta(t, 50, restSubnet.PrefixDelegationPools[0].Utilization, 0.001)
+	require.EqualValues(t, 50, restSubnet.PrefixDelegationPools[0].Stats.(dbmodel.SubnetStats)["assigned-pds"])
+	require.Equal(t, collectedAt, time.Time(restSubnet.PrefixDelegationPools[0].StatsCollectedAt))
+
+	// The exhaustion is only forecast for the prefix pool.
+	require.Nil(t, restSubnet.ExhaustionForecast)
+	require.Nil(t, restSubnet.AddressPools[0].ExhaustionForecast)
+	require.NotNil(t, restSubnet.PrefixDelegationPools[0].ExhaustionForecast)
+	require.Equal(t, collectedAt.Add(24*time.Hour), time.Time(*restSubnet.PrefixDelegationPools[0].ExhaustionForecast))
+}
+
+// Test that the new subnet can be created via the transaction.
+func TestCreateSubnetBeginSubmit(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents receiving subnet4-add commands.
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	// Create session manager.
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, apps := storktest.AddTestHosts(t, db)
+
+	// Begin transaction.
+	params := dhcp.CreateSubnetBeginParams{}
+	rsp := rapi.CreateSubnetBegin(ctx, params)
+	require.IsType(t, &dhcp.CreateSubnetBeginOK{}, rsp)
+	okRsp := rsp.(*dhcp.CreateSubnetBeginOK)
+	contents := okRsp.Payload
+
+	// Make sure the server returned transaction ID and daemons.
+	transactionID := contents.ID
+	require.NotZero(t, transactionID)
+	require.Len(t, contents.Daemons, 4)
+
+	// Submit transaction.
+	params2 := dhcp.CreateSubnetSubmitParams{
+		ID: transactionID,
+		Subnet: &models.Subnet{
+			Subnet: "192.0.3.0/24",
+			Pools:  []string{"192.0.3.10-192.0.3.20"},
+			LocalSubnets: []*models.LocalSubnet{
+				{
+					ID:       333,
+					DaemonID: apps[0].Daemons[0].ID,
+				},
+				{
+					ID:       333,
+					DaemonID: apps[1].Daemons[0].ID,
+				},
+			},
+		},
+	}
+	rsp2 := rapi.CreateSubnetSubmit(ctx, params2)
+	require.IsType(t, &dhcp.CreateSubnetSubmitOK{}, rsp2)
+
+	// It should result in sending commands to two Kea servers.
+	require.Len(t, fa.RecordedCommands, 2)
+
+	for _, c := range fa.RecordedCommands {
+		require.JSONEq(t, `{
+            "command": "subnet4-add",
+            "service": ["dhcp4"],
+            "arguments": {
+                "subnet4": [
+                    {
+                        "id": 333,
+                        "subnet": "192.0.3.0/24",
+                        "pools": [
+                            {
+                                "pool": "192.0.3.10-192.0.3.20"
+                            }
+                        ]
+                    }
+                ]
+            }
+        }`, c.Marshal())
+	}
+
+	// The subnet should have been added to the database.
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.3.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+	require.Len(t, subnets[0].LocalSubnets, 2)
+
+	// The new subnet should be audited.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, dbmodel.AuditTargetSubnet, records[0].TargetType)
+	require.Equal(t, subnets[0].ID, records[0].TargetID)
+
+	// Make sure that the transaction is done.
+	cctx, _ := cm.RecoverContext(transactionID, int64(user.ID))
+	if cctx != nil {
+		cm.Done(cctx)
+	}
+	require.Nil(t, cctx)
+}
+
+// Test error case when a user attempts to begin a new transaction when
+// there are no servers with subnet_cmds hook library found.
+func TestCreateSubnetBeginNoServers(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Begin transaction.
+	params := dhcp.CreateSubnetBeginParams{}
+	rsp := rapi.CreateSubnetBegin(ctx, params)
+	require.IsType(t, &dhcp.CreateSubnetBeginDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.CreateSubnetBeginDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
+
+// Test that the subnet can be updated via the transaction and that
+// the transaction can be cancelled.
+func TestUpdateSubnetBeginSubmit(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents receiving subnet4-update commands.
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	// Create session manager.
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, apps := storktest.AddTestHosts(t, db)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	// Begin transaction and cancel it.
+	params := dhcp.UpdateSubnetBeginParams{
+		SubnetID: subnets[0].ID,
+	}
+	rsp := rapi.UpdateSubnetBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateSubnetBeginOK{}, rsp)
+	okRsp := rsp.(*dhcp.UpdateSubnetBeginOK)
+	require.NotZero(t, okRsp.Payload.ID)
+
+	params2 := dhcp.UpdateSubnetDeleteParams{
+		SubnetID: subnets[0].ID,
+		ID:       okRsp.Payload.ID,
+	}
+	rsp2 := rapi.UpdateSubnetDelete(ctx, params2)
+	require.IsType(t, &dhcp.UpdateSubnetDeleteOK{}, rsp2)
+
+	// Begin transaction again. The daemons should have been unlocked.
+	rsp = rapi.UpdateSubnetBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateSubnetBeginOK{}, rsp)
+	okRsp = rsp.(*dhcp.UpdateSubnetBeginOK)
+	contents := okRsp.Payload
+
+	transactionID := contents.ID
+	require.NotZero(t, transactionID)
+	require.Len(t, contents.Daemons, 4)
+	require.NotNil(t, contents.Subnet)
+	require.Equal(t, "192.0.2.0/24", contents.Subnet.Subnet)
+	require.Len(t, contents.Subnet.LocalSubnets, 2)
+
+	// Submit transaction.
+	params3 := dhcp.UpdateSubnetSubmitParams{
+		SubnetID: subnets[0].ID,
+		ID:       transactionID,
+		Subnet: &models.Subnet{
+			ID:     subnets[0].ID,
+			Subnet: "192.0.2.0/24",
+			Pools:  []string{"192.0.2.10-192.0.2.20"},
+			LocalSubnets: []*models.LocalSubnet{
+				{
+					ID:       111,
+					DaemonID: apps[0].Daemons[0].ID,
+				},
+				{
+					ID:       111,
+					DaemonID: apps[1].Daemons[0].ID,
+				},
+			},
+		},
+	}
+	rsp3 := rapi.UpdateSubnetSubmit(ctx, params3)
+	require.IsType(t, &dhcp.UpdateSubnetSubmitOK{}, rsp3)
+
+	// It should result in sending commands to two Kea servers.
+	require.Len(t, fa.RecordedCommands, 2)
+	for _, c := range fa.RecordedCommands {
+		require.Equal(t, "subnet4-update", c.GetCommand())
+	}
+
+	// The subnet should have been updated in the database.
+	subnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+	require.Len(t, subnet.AddressPools, 1)
+	require.Equal(t, "192.0.2.10", subnet.AddressPools[0].LowerBound)
+	require.Equal(t, "192.0.2.20", subnet.AddressPools[0].UpperBound)
+
+	// The subnet update should be audited.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, dbmodel.AuditTargetSubnet, records[0].TargetType)
+	require.Equal(t, subnets[0].ID, records[0].TargetID)
+	require.NotEmpty(t, records[0].Changes)
+}
+
+// Test error case when a user attempts to begin a transaction for
+// updating a non-existing subnet.
+func TestUpdateSubnetBeginNonExistingSubnetID(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, _ = storktest.AddTestHosts(t, db)
+
+	params := dhcp.UpdateSubnetBeginParams{
+		SubnetID: 1000,
+	}
+	rsp := rapi.UpdateSubnetBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateSubnetBeginDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.UpdateSubnetBeginDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
+
+// Test deleting a subnet.
+func TestDeleteSubnet(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents receiving subnet4-del commands.
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	_, _ = storktest.AddTestHosts(t, db)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	// Non-existing subnet.
+	params := dhcp.DeleteSubnetParams{
+		ID: 1000,
+	}
+	rsp := rapi.DeleteSubnet(ctx, params)
+	require.IsType(t, &dhcp.DeleteSubnetDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.DeleteSubnetDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+
+	// Existing subnet.
+	params = dhcp.DeleteSubnetParams{
+		ID: subnets[0].ID,
+	}
+	rsp = rapi.DeleteSubnet(ctx, params)
+	require.IsType(t, &dhcp.DeleteSubnetOK{}, rsp)
+
+	// The subnet4-del commands should be sent to two Kea servers.
+	require.Len(t, fa.RecordedCommands, 2)
+	for _, c := range fa.RecordedCommands {
+		require.JSONEq(t, `{
+            "command": "subnet4-del",
+            "service": ["dhcp4"],
+            "arguments": {
+                "id": 111
+            }
+        }`, c.Marshal())
+	}
+
+	subnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.Nil(t, subnet)
+
+	// The deleted subnet should be audited.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, dbmodel.AuditTargetSubnet, records[0].TargetType)
+	require.Equal(t, subnets[0].ID, records[0].TargetID)
+}
+
+// Test that the daemons are unlocked when deleting the subnet fails, so
+// the next attempt to modify their configurations is not rejected.
+func TestDeleteSubnetError(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents returning an error for the subnet4-del command.
+	fa := agentcommtest.NewFakeAgents(func(callNo int, cmdResponses []interface{}) {
+		mockStatusError("subnet4-del", cmdResponses)
+	}, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	_, _ = storktest.AddTestHosts(t, db)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	params := dhcp.DeleteSubnetParams{
+		ID: subnets[0].ID,
+	}
+	rsp := rapi.DeleteSubnet(ctx, params)
+	require.IsType(t, &dhcp.DeleteSubnetDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.DeleteSubnetDefault)
+	require.Equal(t, http.StatusConflict, getStatusCode(*defaultRsp))
+
+	// The subnet should still exist.
+	subnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+
+	// The daemons should have been unlocked.
+	var daemonIDs []int64
+	for _, ls := range subnet.LocalSubnets {
+		daemonIDs = append(daemonIDs, ls.DaemonID)
+	}
+	cctx, err := cm.CreateContext(int64(user.ID))
+	require.NoError(t, err)
+	cctx, err = cm.Lock(cctx, daemonIDs...)
+	require.NoError(t, err)
+
+	// Deleting the subnet now fails because the daemons are locked by
+	// another transaction.
+	rsp = rapi.DeleteSubnet(ctx, params)
+	require.IsType(t, &dhcp.DeleteSubnetDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.DeleteSubnetDefault)
+	require.Equal(t, http.StatusLocked, getStatusCode(*defaultRsp))
+	cm.Done(cctx)
+}
+
+// Test conversion of the shared network from the REST API format to the
+// database model.
+func TestConvertToSharedNetwork(t *testing.T) {
+	restNetwork := &models.EditedSharedNetwork{
+		Name:      "foo",
+		SubnetIds: []int64{1, 2},
+		Parameters: map[string]any{
+			"interface": "eth0",
+		},
+	}
+	network, parameters, err := convertToSharedNetwork(restNetwork)
+	require.NoError(t, err)
+	require.NotNil(t, network)
+	require.Equal(t, "foo", network.Name)
+	require.Len(t, network.Subnets, 2)
+	require.EqualValues(t, 1, network.Subnets[0].ID)
+	require.EqualValues(t, 2, network.Subnets[1].ID)
+	require.Len(t, parameters, 1)
+	require.Equal(t, "eth0", parameters["interface"])
+
+	// Parameters must be a map.
+	restNetwork.Parameters = "foo"
+	_, _, err = convertToSharedNetwork(restNetwork)
+	require.Error(t, err)
+}
+
+// Test that the new shared network can be created via the transaction.
+func TestCreateSharedNetworkBeginSubmit(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents receiving network4-add commands.
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	// Create session manager.
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps and subnets in the database.
+	_, _ = storktest.AddTestHosts(t, db)
+
+	// Begin transaction.
+	params := dhcp.CreateSharedNetworkBeginParams{}
+	rsp := rapi.CreateSharedNetworkBegin(ctx, params)
+	require.IsType(t, &dhcp.CreateSharedNetworkBeginOK{}, rsp)
+	okRsp := rsp.(*dhcp.CreateSharedNetworkBeginOK)
+	contents := okRsp.Payload
+
+	// Make sure the server returned transaction ID, daemons and subnets.
+	transactionID := contents.ID
+	require.NotZero(t, transactionID)
+	require.Len(t, contents.Daemons, 4)
+	require.NotEmpty(t, contents.Subnets)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	// Submit transaction.
+	params2 := dhcp.CreateSharedNetworkSubmitParams{
+		ID: transactionID,
+		SharedNetwork: &models.EditedSharedNetwork{
+			Name:      "foo",
+			SubnetIds: []int64{subnets[0].ID},
+			Parameters: map[string]any{
+				"interface": "eth0",
+			},
+		},
+	}
+	rsp2 := rapi.CreateSharedNetworkSubmit(ctx, params2)
+	require.IsType(t, &dhcp.CreateSharedNetworkSubmitOK{}, rsp2)
+
+	// It should result in creating the shared network in two Kea servers
+	// and moving the subnet into it.
+	require.Len(t, fa.RecordedCommands, 4)
+	for i, c := range fa.RecordedCommands {
+		if i < 2 {
+			require.JSONEq(t, `{
+                "command": "network4-add",
+                "service": ["dhcp4"],
+                "arguments": {
+                    "shared-networks": [
+                        {
+                            "name": "foo",
+                            "interface": "eth0"
+                        }
+                    ]
+                }
+            }`, c.Marshal())
+			continue
+		}
+		require.Equal(t, "network4-subnet-add", c.GetCommand())
+	}
+
+	// The shared network should have been added to the database.
+	subnet, err := dbmodel.GetSubnet(db, subnets[0].ID)
+	require.NoError(t, err)
+	require.NotNil(t, subnet)
+	require.NotNil(t, subnet.SharedNetwork)
+	require.Equal(t, "foo", subnet.SharedNetwork.Name)
+
+	// The new shared network should be audited.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, dbmodel.AuditTargetSharedNetwork, records[0].TargetType)
+	require.Equal(t, subnet.SharedNetwork.ID, records[0].TargetID)
+
+	// Make sure that the transaction is done.
+	cctx, _ := cm.RecoverContext(transactionID, int64(user.ID))
+	if cctx != nil {
+		cm.Done(cctx)
+	}
+	require.Nil(t, cctx)
+}
+
+// Test that the shared network can be updated via the transaction and
+// that the transaction can be cancelled.
+func TestUpdateSharedNetworkBeginSubmit(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	// Create fake agents receiving network4 commands.
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	// Create session manager.
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps and subnets in the database.
+	_, _ = storktest.AddTestHosts(t, db)
+
+	subnets, err := dbmodel.GetSubnetsByPrefix(db, "192.0.2.0/24")
+	require.NoError(t, err)
+	require.Len(t, subnets, 1)
+
+	// Create the shared network with the subnet.
+	network := &dbmodel.SharedNetwork{
+		Name:   "foo",
+		Family: 4,
+		Subnets: []dbmodel.Subnet{
+			{
+				ID: subnets[0].ID,
+			},
+		},
+	}
+	err = dbmodel.AddSharedNetworkWithExistingSubnets(db, network)
+	require.NoError(t, err)
+
+	// Begin transaction and cancel it.
+	params := dhcp.UpdateSharedNetworkBeginParams{
+		SharedNetworkID: network.ID,
+	}
+	rsp := rapi.UpdateSharedNetworkBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateSharedNetworkBeginOK{}, rsp)
+	okRsp := rsp.(*dhcp.UpdateSharedNetworkBeginOK)
+	require.NotZero(t, okRsp.Payload.ID)
+
+	params2 := dhcp.UpdateSharedNetworkDeleteParams{
+		SharedNetworkID: network.ID,
+		ID:              okRsp.Payload.ID,
+	}
+	rsp2 := rapi.UpdateSharedNetworkDelete(ctx, params2)
+	require.IsType(t, &dhcp.UpdateSharedNetworkDeleteOK{}, rsp2)
+
+	// Begin transaction again. The daemons should have been unlocked.
+	rsp = rapi.UpdateSharedNetworkBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateSharedNetworkBeginOK{}, rsp)
+	okRsp = rsp.(*dhcp.UpdateSharedNetworkBeginOK)
+	contents := okRsp.Payload
+
+	transactionID := contents.ID
+	require.NotZero(t, transactionID)
+	require.Len(t, contents.Daemons, 4)
+	require.NotEmpty(t, contents.Subnets)
+	require.NotNil(t, contents.SharedNetwork)
+	require.Equal(t, "foo", contents.SharedNetwork.Name)
+	require.Len(t, contents.SharedNetwork.Subnets, 1)
+
+	// Submit transaction renaming the shared network.
+	params3 := dhcp.UpdateSharedNetworkSubmitParams{
+		SharedNetworkID: network.ID,
+		ID:              transactionID,
+		SharedNetwork: &models.EditedSharedNetwork{
+			Name:      "bar",
+			SubnetIds: []int64{subnets[0].ID},
+		},
+	}
+	rsp3 := rapi.UpdateSharedNetworkSubmit(ctx, params3)
+	require.IsType(t, &dhcp.UpdateSharedNetworkSubmitOK{}, rsp3)
+
+	// The shared network should have been re-created in two Kea servers.
+	require.Len(t, fa.RecordedCommands, 6)
+
+	// The shared network should have been renamed in the database.
+	returned, err := dbmodel.GetSharedNetwork(db, network.ID)
+	require.NoError(t, err)
+	require.NotNil(t, returned)
+	require.Equal(t, "bar", returned.Name)
+}
+
+// Test error case when a user attempts to begin a transaction for
+// updating a non-existing shared network.
+func TestUpdateSharedNetworkBeginNonExistingID(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	require.NotNil(t, fa)
+
+	lookup := dbmodel.NewDHCPOptionDefinitionLookup()
+	require.NotNil(t, lookup)
+
+	// Create the config manager.
+	cm := apps.NewManager(&appstest.ManagerAccessorsWrapper{
+		DB:        db,
+		Agents:    fa,
+		DefLookup: lookup,
+	})
+	require.NotNil(t, cm)
+
+	// Create API.
+	rapi, err := NewRestAPI(dbSettings, db, fa, cm, lookup)
+	require.NoError(t, err)
+
+	ctx, err := rapi.SessionManager.Load(context.Background(), "")
+	require.NoError(t, err)
+
+	// Create user session.
+	user := &dbmodel.SystemUser{
+		ID: 1234,
+	}
+	err = rapi.SessionManager.LoginHandler(ctx, user)
+	require.NoError(t, err)
+
+	// Make sure we have some Kea apps in the database.
+	_, _ = storktest.AddTestHosts(t, db)
+
+	params := dhcp.UpdateSharedNetworkBeginParams{
+		SharedNetworkID: 1000,
+	}
+	rsp := rapi.UpdateSharedNetworkBegin(ctx, params)
+	require.IsType(t, &dhcp.UpdateSharedNetworkBeginDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.UpdateSharedNetworkBeginDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
@@ -231,6 +231,7 @@ func (r *RestAPI) CreateUser(ctx context.Context, params users.CreateUserParams)
 	}
 
 	*u.ID = int64(su.ID)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetUser, int64(su.ID), nil, newRestUser(*su))
 	return users.NewCreateUserOK().WithPayload(u)
 }
 
@@ -271,6 +272,12 @@ func (r *RestAPI) UpdateUser(ctx context.Context, params users.UpdateUserParams)
 		su.Groups = append(su.Groups, &dbmodel.SystemGroup{ID: int(gid)})
 	}
 
+	// Remember the user before the update for the audit trail.
+	var userBefore *models.User
+	if suBefore, err := dbmodel.GetUserByID(r.DB, su.ID); err == nil && suBefore != nil {
+		userBefore = newRestUser(*suBefore)
+	}
+
 	con, err := dbmodel.UpdateUser(r.DB, su)
 	if con {
 		log.WithFields(log.Fields{
@@ -299,6 +306,12 @@ func (r *RestAPI) UpdateUser(ctx context.Context, params users.UpdateUserParams)
 		return rsp
 	}
 
+	var userAfter *models.User
+	if suAfter, err := dbmodel.GetUserByID(r.DB, su.ID); err == nil && suAfter != nil {
+		userAfter = newRestUser(*suAfter)
+	}
+	r.addAuditRecord(ctx, dbmodel.AuditTargetUser, int64(su.ID), userBefore, userAfter)
+
 	return users.NewUpdateUserOK()
 }
 
@@ -348,7 +361,9 @@ func (r *RestAPI) UpdateUserPassword(ctx context.Context, params users.UpdateUse
 		return rsp
 	}
 
-	// Password successfully changed.
+	// Password successfully changed. The passwords are never stored in
+	// the audit trail, so the audit record holds no changes.
+	r.addAuditRecord(ctx, dbmodel.AuditTargetUser, int64(id), nil, nil)
 	return users.NewUpdateUserPasswordOK()
 }
 
@@ -394,3 +409,137 @@ func (r *RestAPI) GetGroups(ctx context.Context, params users.GetGroupsParams) m
 	rsp := users.NewGetGroupsOK().WithPayload(groups)
 	return rsp
 }
+
+// Converts the email subscription to the format used in REST API.
+func newRestEmailSubscription(subscription *dbmodel.EmailSubscription) *models.EmailSubscription {
+	return &models.EmailSubscription{
+		Enabled:   subscription.Enabled,
+		Digest:    subscription.Digest,
+		Level:     int64(subscription.Level),
+		MachineID: subscription.MachineID,
+		AppID:     subscription.AppID,
+		DaemonID:  subscription.DaemonID,
+		SubnetID:  subscription.SubnetID,
+	}
+}
+
+// Returns the email subscription of the given user. The disabled
+// subscription is returned when the user has not subscribed yet.
+func (r *RestAPI) GetUserEmailSubscription(ctx context.Context, params users.GetUserEmailSubscriptionParams) middleware.Responder {
+	id := int(params.ID)
+	su, err := dbmodel.GetUserByID(r.DB, id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userid": id,
+		}).Errorf("Failed to fetch user with ID %v from the database with error: %s", id,
+			err.Error())
+
+		msg := fmt.Sprintf("Failed to fetch user with ID %v from the database", id)
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewGetUserEmailSubscriptionDefault(http.StatusInternalServerError).WithPayload(&rspErr)
+		return rsp
+	} else if su == nil {
+		msg := fmt.Sprintf("Failed to find user with ID %v in the database", id)
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewGetUserEmailSubscriptionDefault(http.StatusNotFound).WithPayload(&rspErr)
+		return rsp
+	}
+
+	subscription, err := dbmodel.GetEmailSubscription(r.DB, id)
+	if err != nil {
+		log.Error(err)
+
+		msg := fmt.Sprintf("Failed to fetch email subscription of user %s from the database", su.Identity())
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewGetUserEmailSubscriptionDefault(http.StatusInternalServerError).WithPayload(&rspErr)
+		return rsp
+	}
+	if subscription == nil {
+		subscription = &dbmodel.EmailSubscription{
+			UserID: id,
+		}
+	}
+
+	return users.NewGetUserEmailSubscriptionOK().WithPayload(newRestEmailSubscription(subscription))
+}
+
+// Updates the email subscription of the given user.
+func (r *RestAPI) UpdateUserEmailSubscription(ctx context.Context, params users.UpdateUserEmailSubscriptionParams) middleware.Responder {
+	id := int(params.ID)
+	if params.Subscription == nil {
+		msg := "Failed to update email subscription: missing data"
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewUpdateUserEmailSubscriptionDefault(http.StatusBadRequest).WithPayload(&rspErr)
+		return rsp
+	}
+
+	su, err := dbmodel.GetUserByID(r.DB, id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"userid": id,
+		}).Errorf("Failed to fetch user with ID %v from the database with error: %s", id,
+			err.Error())
+
+		msg := fmt.Sprintf("Failed to fetch user with ID %v from the database", id)
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewUpdateUserEmailSubscriptionDefault(http.StatusInternalServerError).WithPayload(&rspErr)
+		return rsp
+	} else if su == nil {
+		msg := fmt.Sprintf("Failed to find user with ID %v in the database", id)
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewUpdateUserEmailSubscriptionDefault(http.StatusNotFound).WithPayload(&rspErr)
+		return rsp
+	}
+
+	var subscriptionBefore *models.EmailSubscription
+	if dbSubscription, err := dbmodel.GetEmailSubscription(r.DB, id); err == nil && dbSubscription != nil {
+		subscriptionBefore = newRestEmailSubscription(dbSubscription)
+	}
+
+	subscription := &dbmodel.EmailSubscription{
+		UserID:    id,
+		Enabled:   params.Subscription.Enabled,
+		Digest:    params.Subscription.Digest,
+		Level:     int(params.Subscription.Level),
+		MachineID: params.Subscription.MachineID,
+		AppID:     params.Subscription.AppID,
+		DaemonID:  params.Subscription.DaemonID,
+		SubnetID:  params.Subscription.SubnetID,
+	}
+	if err = subscription.Validate(); err != nil {
+		msg := fmt.Sprintf("Invalid email subscription: %s", err)
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewUpdateUserEmailSubscriptionDefault(http.StatusBadRequest).WithPayload(&rspErr)
+		return rsp
+	}
+
+	if err = dbmodel.UpsertEmailSubscription(r.DB, subscription); err != nil {
+		log.Error(err)
+
+		msg := fmt.Sprintf("Failed to update email subscription of user %s", su.Identity())
+		rspErr := models.APIError{
+			Message: &msg,
+		}
+		rsp := users.NewUpdateUserEmailSubscriptionDefault(http.StatusInternalServerError).WithPayload(&rspErr)
+		return rsp
+	}
+
+	subscriptionAfter := newRestEmailSubscription(subscription)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetUser, int64(id), subscriptionBefore, subscriptionAfter)
+
+	return users.NewUpdateUserEmailSubscriptionOK().WithPayload(subscriptionAfter)
+}
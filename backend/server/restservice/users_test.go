@@ -377,6 +377,93 @@ func TestGetUser(t *testing.T) {
 	// require.Len(t, okRsp.Payload.Groups, 1)
 }
 
+// Tests that the email subscription of the user can be fetched and
+// updated via REST API.
+func TestUserEmailSubscription(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	ctx := context.Background()
+	rapi, err := NewRestAPI(dbSettings, db)
+	require.NoError(t, err)
+
+	user := &dbmodel.SystemUser{
+		Email:    "jd@example.org",
+		Lastname: "Doe",
+		Login:    "johndoe",
+		Name:     "John",
+		Password: "pass",
+	}
+	con, err := dbmodel.CreateUser(db, user)
+	require.False(t, con)
+	require.NoError(t, err)
+	id := int64(user.ID)
+
+	// The user has not subscribed yet.
+	rsp := rapi.GetUserEmailSubscription(ctx, users.GetUserEmailSubscriptionParams{ID: id})
+	require.IsType(t, &users.GetUserEmailSubscriptionOK{}, rsp)
+	require.False(t, rsp.(*users.GetUserEmailSubscriptionOK).Payload.Enabled)
+
+	// Subscribe to the errors related to the machine.
+	rsp = rapi.UpdateUserEmailSubscription(ctx, users.UpdateUserEmailSubscriptionParams{
+		ID: id,
+		Subscription: &models.EmailSubscription{
+			Enabled:   true,
+			Level:     dbmodel.EvError,
+			MachineID: 3,
+		},
+	})
+	require.IsType(t, &users.UpdateUserEmailSubscriptionOK{}, rsp)
+
+	rsp = rapi.GetUserEmailSubscription(ctx, users.GetUserEmailSubscriptionParams{ID: id})
+	require.IsType(t, &users.GetUserEmailSubscriptionOK{}, rsp)
+	subscription := rsp.(*users.GetUserEmailSubscriptionOK).Payload
+	require.True(t, subscription.Enabled)
+	require.False(t, subscription.Digest)
+	require.EqualValues(t, dbmodel.EvError, subscription.Level)
+	require.EqualValues(t, 3, subscription.MachineID)
+
+	// Switch to the digest.
+	subscription.Digest = true
+	rsp = rapi.UpdateUserEmailSubscription(ctx, users.UpdateUserEmailSubscriptionParams{
+		ID:           id,
+		Subscription: subscription,
+	})
+	require.IsType(t, &users.UpdateUserEmailSubscriptionOK{}, rsp)
+	require.True(t, rsp.(*users.UpdateUserEmailSubscriptionOK).Payload.Digest)
+
+	// Invalid level.
+	subscription.Level = 3
+	rsp = rapi.UpdateUserEmailSubscription(ctx, users.UpdateUserEmailSubscriptionParams{
+		ID:           id,
+		Subscription: subscription,
+	})
+	require.IsType(t, &users.UpdateUserEmailSubscriptionDefault{}, rsp)
+	defaultRsp := rsp.(*users.UpdateUserEmailSubscriptionDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Non-existing user.
+	rsp = rapi.GetUserEmailSubscription(ctx, users.GetUserEmailSubscriptionParams{ID: id + 1})
+	require.IsType(t, &users.GetUserEmailSubscriptionDefault{}, rsp)
+	getDefaultRsp := rsp.(*users.GetUserEmailSubscriptionDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*getDefaultRsp))
+
+	subscription.Level = dbmodel.EvError
+	rsp = rapi.UpdateUserEmailSubscription(ctx, users.UpdateUserEmailSubscriptionParams{
+		ID:           id + 1,
+		Subscription: subscription,
+	})
+	require.IsType(t, &users.UpdateUserEmailSubscriptionDefault{}, rsp)
+	defaultRsp = rsp.(*users.UpdateUserEmailSubscriptionDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+
+	// The changes are recorded in the audit trail.
+	records, total, err := dbmodel.GetAuditRecordsByPage(db, 0, 10, nil)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, dbmodel.AuditTargetUser, records[0].TargetType)
+}
+
 // Tests that new session can be created for a logged user.
 func TestCreateSession(t *testing.T) {
 	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
@@ -0,0 +1,152 @@
+package restservice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	log "github.com/sirupsen/logrus"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+	storkutil "isc.org/stork/util"
+)
+
+// Default length of the time range of the utilization history when the
+// beginning of the range is not specified.
+const defaultUtilizationHistoryRange = 24 * time.Hour
+
+// Converts the time range and the resolution specified in the request
+// to the form used by the database model. It uses the default values
+// for the unspecified parameters. It returns an error when the range is
+// invalid.
+func parseUtilizationHistoryParams(from, to *strfmt.DateTime, resolution *int64) (time.Time, time.Time, time.Duration, error) {
+	end := storkutil.UTCNow()
+	if to != nil {
+		end = time.Time(*to).UTC()
+	}
+	start := end.Add(-defaultUtilizationHistoryRange)
+	if from != nil {
+		start = time.Time(*from).UTC()
+	}
+	if start.After(end) {
+		return start, end, 0, fmt.Errorf("beginning of the time range %s is after its end %s", start, end)
+	}
+	var duration time.Duration
+	if resolution != nil {
+		if *resolution < 0 {
+			return start, end, 0, fmt.Errorf("resolution must not be negative")
+		}
+		duration = time.Duration(*resolution) * time.Second
+	}
+	return start, end, duration, nil
+}
+
+// Converts the utilization samples to the format used in REST API.
+func utilizationSamplesToRestAPI(samples []dbmodel.UtilizationSample) *models.UtilizationHistory {
+	history := &models.UtilizationHistory{
+		Items: []*models.UtilizationSample{},
+	}
+	for _, sample := range samples {
+		history.Items = append(history.Items, &models.UtilizationSample{
+			SampledAt:       strfmt.DateTime(sample.SampledAt),
+			Resolution:      sample.Resolution,
+			AddrUtilization: float64(sample.AddrUtilization) / 10,
+			PdUtilization:   float64(sample.PdUtilization) / 10,
+			Stats:           sample.Stats,
+			SampleCount:     sample.SampleCount,
+		})
+	}
+	return history
+}
+
+// Returns the utilization history of the subnet in the specified time
+// range and resolution.
+func (r *RestAPI) GetSubnetUtilizationHistory(ctx context.Context, params dhcp.GetSubnetUtilizationHistoryParams) middleware.Responder {
+	from, to, resolution, err := parseUtilizationHistoryParams(params.From, params.To, params.Resolution)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid utilization history parameters: %s", err)
+		log.Error(msg)
+		rsp := dhcp.NewGetSubnetUtilizationHistoryDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	subnet, err := dbmodel.GetSubnet(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching subnet with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := dhcp.NewGetSubnetUtilizationHistoryDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if subnet == nil {
+		msg := fmt.Sprintf("Cannot find subnet with ID %d", params.ID)
+		rsp := dhcp.NewGetSubnetUtilizationHistoryDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	samples, err := dbmodel.GetSubnetUtilizationHistory(r.DB, params.ID, from, to, resolution)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching utilization history of subnet with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := dhcp.NewGetSubnetUtilizationHistoryDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rsp := dhcp.NewGetSubnetUtilizationHistoryOK().WithPayload(utilizationSamplesToRestAPI(samples))
+	return rsp
+}
+
+// Returns the utilization history of the shared network in the specified
+// time range and resolution.
+func (r *RestAPI) GetSharedNetworkUtilizationHistory(ctx context.Context, params dhcp.GetSharedNetworkUtilizationHistoryParams) middleware.Responder {
+	from, to, resolution, err := parseUtilizationHistoryParams(params.From, params.To, params.Resolution)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid utilization history parameters: %s", err)
+		log.Error(msg)
+		rsp := dhcp.NewGetSharedNetworkUtilizationHistoryDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	sharedNetwork, err := dbmodel.GetSharedNetwork(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching shared network with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := dhcp.NewGetSharedNetworkUtilizationHistoryDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if sharedNetwork == nil {
+		msg := fmt.Sprintf("Cannot find shared network with ID %d", params.ID)
+		rsp := dhcp.NewGetSharedNetworkUtilizationHistoryDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	samples, err := dbmodel.GetSharedNetworkUtilizationHistory(r.DB, params.ID, from, to, resolution)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching utilization history of shared network with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := dhcp.NewGetSharedNetworkUtilizationHistoryDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rsp := dhcp.NewGetSharedNetworkUtilizationHistoryOK().WithPayload(utilizationSamplesToRestAPI(samples))
+	return rsp
+}
@@ -0,0 +1,159 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	dhcp "isc.org/stork/server/gen/restapi/operations/d_h_c_p"
+)
+
+// Test that the default time range and resolution are used when they
+// are not specified and that the invalid values are rejected.
+func TestParseUtilizationHistoryParams(t *testing.T) {
+	from, to, resolution, err := parseUtilizationHistoryParams(nil, nil, nil)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().UTC(), to, 10*time.Second)
+	require.Equal(t, defaultUtilizationHistoryRange, to.Sub(from))
+	require.Zero(t, resolution)
+
+	start := strfmt.DateTime(time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC))
+	end := strfmt.DateTime(time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC))
+	seconds := int64(3600)
+	from, to, resolution, err = parseUtilizationHistoryParams(&start, &end, &seconds)
+	require.NoError(t, err)
+	require.Equal(t, time.Time(start), from)
+	require.Equal(t, time.Time(end), to)
+	require.Equal(t, time.Hour, resolution)
+
+	// The beginning of the range after its end.
+	_, _, _, err = parseUtilizationHistoryParams(&end, &start, nil)
+	require.Error(t, err)
+
+	// Negative resolution.
+	seconds = -1
+	_, _, _, err = parseUtilizationHistoryParams(&start, &end, &seconds)
+	require.Error(t, err)
+}
+
+// Test getting the utilization history of the subnet and the shared
+// network over the REST API.
+func TestGetUtilizationHistory(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	network := &dbmodel.SharedNetwork{
+		Name:   "foo",
+		Family: 4,
+		Subnets: []dbmodel.Subnet{
+			{
+				Prefix: "192.0.2.0/24",
+			},
+		},
+	}
+	err := dbmodel.AddSharedNetwork(db, network)
+	require.NoError(t, err)
+	subnet := &network.Subnets[0]
+
+	now := time.Now().UTC()
+	err = dbmodel.AddUtilizationSamples(db, []*dbmodel.UtilizationSample{
+		{
+			SubnetID:        subnet.ID,
+			SampledAt:       now.Add(-2 * time.Hour),
+			AddrUtilization: 100,
+			Stats:           dbmodel.SubnetStats{"total-addresses": uint64(256)},
+			SampleCount:     1,
+		},
+		{
+			SubnetID:        subnet.ID,
+			SampledAt:       now.Add(-time.Hour),
+			AddrUtilization: 300,
+			SampleCount:     1,
+		},
+		{
+			SharedNetworkID: network.ID,
+			SampledAt:       now.Add(-time.Hour),
+			PdUtilization:   250,
+			SampleCount:     1,
+		},
+	})
+	require.NoError(t, err)
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, err := NewRestAPI(dbSettings, db, fa)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Subnet history at the stored resolution.
+	rsp := rapi.GetSubnetUtilizationHistory(ctx, dhcp.GetSubnetUtilizationHistoryParams{
+		ID: subnet.ID,
+	})
+	require.IsType(t, &dhcp.GetSubnetUtilizationHistoryOK{}, rsp)
+	history := rsp.(*dhcp.GetSubnetUtilizationHistoryOK).Payload
+	require.Len(t, history.Items, 2)
+	require.InDelta(t, 10, history.Items[0].AddrUtilization, 0.001)
+	require.Zero(t, history.Items[0].Resolution)
+	require.EqualValues(t, 1, history.Items[0].SampleCount)
+	require.NotNil(t, history.Items[0].Stats)
+	require.InDelta(t, 30, history.Items[1].AddrUtilization, 0.001)
+
+	// Subnet history aggregated in two-day periods.
+	resolution := int64(2 * 86400)
+	rsp = rapi.GetSubnetUtilizationHistory(ctx, dhcp.GetSubnetUtilizationHistoryParams{
+		ID:         subnet.ID,
+		Resolution: &resolution,
+	})
+	require.IsType(t, &dhcp.GetSubnetUtilizationHistoryOK{}, rsp)
+	history = rsp.(*dhcp.GetSubnetUtilizationHistoryOK).Payload
+	require.NotEmpty(t, history.Items)
+	require.EqualValues(t, resolution, history.Items[0].Resolution)
+
+	// Shared network history.
+	rsp = rapi.GetSharedNetworkUtilizationHistory(ctx, dhcp.GetSharedNetworkUtilizationHistoryParams{
+		ID: network.ID,
+	})
+	require.IsType(t, &dhcp.GetSharedNetworkUtilizationHistoryOK{}, rsp)
+	history = rsp.(*dhcp.GetSharedNetworkUtilizationHistoryOK).Payload
+	require.Len(t, history.Items, 1)
+	require.InDelta(t, 25, history.Items[0].PdUtilization, 0.001)
+
+	// Non-existing subnet.
+	rsp = rapi.GetSubnetUtilizationHistory(ctx, dhcp.GetSubnetUtilizationHistoryParams{
+		ID: subnet.ID + 100,
+	})
+	require.IsType(t, &dhcp.GetSubnetUtilizationHistoryDefault{}, rsp)
+	defaultRsp := rsp.(*dhcp.GetSubnetUtilizationHistoryDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*defaultRsp))
+
+	// Non-existing shared network.
+	rsp = rapi.GetSharedNetworkUtilizationHistory(ctx, dhcp.GetSharedNetworkUtilizationHistoryParams{
+		ID: network.ID + 100,
+	})
+	require.IsType(t, &dhcp.GetSharedNetworkUtilizationHistoryDefault{}, rsp)
+
+	// No samples in the time range.
+	end := strfmt.DateTime(now.Add(-48 * time.Hour))
+	rsp = rapi.GetSubnetUtilizationHistory(ctx, dhcp.GetSubnetUtilizationHistoryParams{
+		ID: subnet.ID,
+		To: &end,
+	})
+	require.IsType(t, &dhcp.GetSubnetUtilizationHistoryOK{}, rsp)
+	require.Empty(t, rsp.(*dhcp.GetSubnetUtilizationHistoryOK).Payload.Items)
+
+	// Invalid time range.
+	start := strfmt.DateTime(now)
+	rsp = rapi.GetSubnetUtilizationHistory(ctx, dhcp.GetSubnetUtilizationHistoryParams{
+		ID:   subnet.ID,
+		From: &start,
+		To:   &end,
+	})
+	require.IsType(t, &dhcp.GetSubnetUtilizationHistoryDefault{}, rsp)
+	defaultRsp = rsp.(*dhcp.GetSubnetUtilizationHistoryDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+}
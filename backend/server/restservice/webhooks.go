@@ -0,0 +1,217 @@
+package restservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime/middleware"
+	"github.com/go-openapi/strfmt"
+	log "github.com/sirupsen/logrus"
+	dbmodel "isc.org/stork/server/database/model"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/events"
+)
+
+// Converts the webhook to the format used in REST API. The secret is
+// not included.
+func webhookToRestAPI(webhook *dbmodel.Webhook) *models.Webhook {
+	return &models.Webhook{
+		ID:        webhook.ID,
+		CreatedAt: strfmt.DateTime(webhook.CreatedAt),
+		URL:       webhook.URL,
+		HasSecret: len(webhook.Secret) > 0,
+		Enabled:   webhook.Enabled,
+		Level:     int64(webhook.Level),
+		MachineID: webhook.MachineID,
+		AppID:     webhook.AppID,
+		DaemonID:  webhook.DaemonID,
+		SubnetID:  webhook.SubnetID,
+	}
+}
+
+// Copies the webhook received over the REST API to the database model.
+// The secret is copied only when it is specified.
+func webhookFromRestAPI(restWebhook *models.Webhook, webhook *dbmodel.Webhook) {
+	webhook.URL = restWebhook.URL
+	webhook.Enabled = restWebhook.Enabled
+	webhook.Level = int(restWebhook.Level)
+	webhook.MachineID = restWebhook.MachineID
+	webhook.AppID = restWebhook.AppID
+	webhook.DaemonID = restWebhook.DaemonID
+	webhook.SubnetID = restWebhook.SubnetID
+	if restWebhook.Secret != nil {
+		webhook.Secret = *restWebhook.Secret
+	}
+}
+
+// Returns all webhooks.
+func (r *RestAPI) GetWebhooks(ctx context.Context, params events.GetWebhooksParams) middleware.Responder {
+	dbWebhooks, err := dbmodel.GetAllWebhooks(r.DB)
+	if err != nil {
+		msg := "Problem fetching webhooks from the database"
+		log.Error(err)
+		rsp := events.NewGetWebhooksDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	webhooks := &models.Webhooks{
+		Items: []*models.Webhook{},
+		Total: int64(len(dbWebhooks)),
+	}
+	for i := range dbWebhooks {
+		webhooks.Items = append(webhooks.Items, webhookToRestAPI(&dbWebhooks[i]))
+	}
+
+	rsp := events.NewGetWebhooksOK().WithPayload(webhooks)
+	return rsp
+}
+
+// Returns the webhook by ID.
+func (r *RestAPI) GetWebhook(ctx context.Context, params events.GetWebhookParams) middleware.Responder {
+	webhook, err := dbmodel.GetWebhook(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching webhook with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := events.NewGetWebhookDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if webhook == nil {
+		msg := fmt.Sprintf("Cannot find webhook with ID %d", params.ID)
+		rsp := events.NewGetWebhookDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	rsp := events.NewGetWebhookOK().WithPayload(webhookToRestAPI(webhook))
+	return rsp
+}
+
+// Registers new webhook.
+func (r *RestAPI) CreateWebhook(ctx context.Context, params events.CreateWebhookParams) middleware.Responder {
+	if params.Webhook == nil {
+		msg := "Missing webhook"
+		rsp := events.NewCreateWebhookDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	webhook := &dbmodel.Webhook{}
+	webhookFromRestAPI(params.Webhook, webhook)
+	if err := webhook.Validate(); err != nil {
+		msg := fmt.Sprintf("Invalid webhook: %s", err)
+		rsp := events.NewCreateWebhookDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	if err := dbmodel.AddWebhook(r.DB, webhook); err != nil {
+		msg := fmt.Sprintf("Cannot create webhook %s", webhook.URL)
+		log.Error(err)
+		rsp := events.NewCreateWebhookDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	// Get the webhook back to fetch its creation time.
+	if returned, err := dbmodel.GetWebhook(r.DB, webhook.ID); err == nil && returned != nil {
+		webhook = returned
+	}
+
+	payload := webhookToRestAPI(webhook)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetWebhook, webhook.ID, nil, payload)
+
+	rsp := events.NewCreateWebhookOK().WithPayload(payload)
+	return rsp
+}
+
+// Updates the webhook. The secret is preserved when it is not specified.
+func (r *RestAPI) UpdateWebhook(ctx context.Context, params events.UpdateWebhookParams) middleware.Responder {
+	if params.Webhook == nil {
+		msg := "Missing webhook"
+		rsp := events.NewUpdateWebhookDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	webhook, err := dbmodel.GetWebhook(r.DB, params.ID)
+	if err != nil {
+		msg := fmt.Sprintf("Problem fetching webhook with ID %d from the database", params.ID)
+		log.Error(err)
+		rsp := events.NewUpdateWebhookDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	if webhook == nil {
+		msg := fmt.Sprintf("Cannot find webhook with ID %d", params.ID)
+		rsp := events.NewUpdateWebhookDefault(http.StatusNotFound).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+	webhookBefore := webhookToRestAPI(webhook)
+
+	webhookFromRestAPI(params.Webhook, webhook)
+	if err = webhook.Validate(); err != nil {
+		msg := fmt.Sprintf("Invalid webhook: %s", err)
+		rsp := events.NewUpdateWebhookDefault(http.StatusBadRequest).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	if err = dbmodel.UpdateWebhook(r.DB, webhook); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, dbmodel.ErrNotExists) {
+			status = http.StatusNotFound
+		}
+		msg := fmt.Sprintf("Cannot update webhook with ID %d", params.ID)
+		log.Error(err)
+		rsp := events.NewUpdateWebhookDefault(status).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	payload := webhookToRestAPI(webhook)
+	r.addAuditRecord(ctx, dbmodel.AuditTargetWebhook, webhook.ID, webhookBefore, payload)
+
+	rsp := events.NewUpdateWebhookOK().WithPayload(payload)
+	return rsp
+}
+
+// Deletes the webhook. Deleting a non-existing webhook is not an error.
+func (r *RestAPI) DeleteWebhook(ctx context.Context, params events.DeleteWebhookParams) middleware.Responder {
+	webhook, err := dbmodel.GetWebhook(r.DB, params.ID)
+	if err == nil && webhook == nil {
+		rsp := events.NewDeleteWebhookOK()
+		return rsp
+	}
+	if err == nil {
+		err = dbmodel.DeleteWebhook(r.DB, params.ID)
+	}
+	if err != nil && !errors.Is(err, dbmodel.ErrNotExists) {
+		msg := fmt.Sprintf("Cannot delete webhook with ID %d", params.ID)
+		log.Error(err)
+		rsp := events.NewDeleteWebhookDefault(http.StatusInternalServerError).WithPayload(&models.APIError{
+			Message: &msg,
+		})
+		return rsp
+	}
+
+	r.addAuditRecord(ctx, dbmodel.AuditTargetWebhook, params.ID, webhookToRestAPI(webhook), nil)
+
+	rsp := events.NewDeleteWebhookOK()
+	return rsp
+}
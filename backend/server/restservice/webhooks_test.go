@@ -0,0 +1,160 @@
+package restservice
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	agentcommtest "isc.org/stork/server/agentcomm/test"
+	dbmodel "isc.org/stork/server/database/model"
+	dbtest "isc.org/stork/server/database/test"
+	"isc.org/stork/server/gen/models"
+	"isc.org/stork/server/gen/restapi/operations/events"
+)
+
+// Test that the webhook secret is not returned over the REST API.
+func TestWebhookToRestAPI(t *testing.T) {
+	webhook := &dbmodel.Webhook{
+		ID:       1,
+		URL:      "http://example.org",
+		Secret:   "secret",
+		Enabled:  true,
+		Level:    dbmodel.EvError,
+		SubnetID: 3,
+	}
+	restWebhook := webhookToRestAPI(webhook)
+	require.EqualValues(t, 1, restWebhook.ID)
+	require.Equal(t, "http://example.org", restWebhook.URL)
+	require.Nil(t, restWebhook.Secret)
+	require.True(t, restWebhook.HasSecret)
+	require.True(t, restWebhook.Enabled)
+	require.EqualValues(t, dbmodel.EvError, restWebhook.Level)
+	require.EqualValues(t, 3, restWebhook.SubnetID)
+
+	webhook.Secret = ""
+	require.False(t, webhookToRestAPI(webhook).HasSecret)
+}
+
+// Test creating, getting, updating and deleting the webhooks over the
+// REST API.
+func TestWebhooksCRUD(t *testing.T) {
+	db, dbSettings, teardown := dbtest.SetupDatabaseTestCase(t)
+	defer teardown()
+
+	fa := agentcommtest.NewFakeAgents(nil, nil)
+	rapi, err := NewRestAPI(dbSettings, db, fa)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Create the webhook.
+	secret := "secret"
+	rsp := rapi.CreateWebhook(ctx, events.CreateWebhookParams{
+		Webhook: &models.Webhook{
+			URL:       "https://example.org/hook",
+			Secret:    &secret,
+			Enabled:   true,
+			Level:     dbmodel.EvWarning,
+			MachineID: 1,
+		},
+	})
+	require.IsType(t, &events.CreateWebhookOK{}, rsp)
+	created := rsp.(*events.CreateWebhookOK).Payload
+	require.NotZero(t, created.ID)
+	require.True(t, created.HasSecret)
+	require.Nil(t, created.Secret)
+
+	// Invalid URL.
+	rsp = rapi.CreateWebhook(ctx, events.CreateWebhookParams{
+		Webhook: &models.Webhook{
+			URL: "example.org",
+		},
+	})
+	require.IsType(t, &events.CreateWebhookDefault{}, rsp)
+	defaultRsp := rsp.(*events.CreateWebhookDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*defaultRsp))
+
+	// Get the webhook.
+	rsp = rapi.GetWebhook(ctx, events.GetWebhookParams{ID: created.ID})
+	require.IsType(t, &events.GetWebhookOK{}, rsp)
+	webhook := rsp.(*events.GetWebhookOK).Payload
+	require.Equal(t, "https://example.org/hook", webhook.URL)
+	require.EqualValues(t, 1, webhook.MachineID)
+
+	rsp = rapi.GetWebhook(ctx, events.GetWebhookParams{ID: created.ID + 1})
+	require.IsType(t, &events.GetWebhookDefault{}, rsp)
+	getDefaultRsp := rsp.(*events.GetWebhookDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*getDefaultRsp))
+
+	// Update the webhook without specifying the secret.
+	webhook.Enabled = false
+	webhook.Level = dbmodel.EvError
+	rsp = rapi.UpdateWebhook(ctx, events.UpdateWebhookParams{
+		ID:      created.ID,
+		Webhook: webhook,
+	})
+	require.IsType(t, &events.UpdateWebhookOK{}, rsp)
+
+	dbWebhook, err := dbmodel.GetWebhook(db, created.ID)
+	require.NoError(t, err)
+	require.Equal(t, "secret", dbWebhook.Secret)
+	require.False(t, dbWebhook.Enabled)
+	require.EqualValues(t, dbmodel.EvError, dbWebhook.Level)
+
+	// Clear the secret.
+	secret = ""
+	webhook.Secret = &secret
+	rsp = rapi.UpdateWebhook(ctx, events.UpdateWebhookParams{
+		ID:      created.ID,
+		Webhook: webhook,
+	})
+	require.IsType(t, &events.UpdateWebhookOK{}, rsp)
+	require.False(t, rsp.(*events.UpdateWebhookOK).Payload.HasSecret)
+
+	// Non-existing webhook.
+	rsp = rapi.UpdateWebhook(ctx, events.UpdateWebhookParams{
+		ID:      created.ID + 1,
+		Webhook: webhook,
+	})
+	require.IsType(t, &events.UpdateWebhookDefault{}, rsp)
+	updateDefaultRsp := rsp.(*events.UpdateWebhookDefault)
+	require.Equal(t, http.StatusNotFound, getStatusCode(*updateDefaultRsp))
+
+	// Invalid level.
+	webhook.Level = 3
+	rsp = rapi.UpdateWebhook(ctx, events.UpdateWebhookParams{
+		ID:      created.ID,
+		Webhook: webhook,
+	})
+	require.IsType(t, &events.UpdateWebhookDefault{}, rsp)
+	updateDefaultRsp = rsp.(*events.UpdateWebhookDefault)
+	require.Equal(t, http.StatusBadRequest, getStatusCode(*updateDefaultRsp))
+
+	// List the webhooks.
+	rsp = rapi.GetWebhooks(ctx, events.GetWebhooksParams{})
+	require.IsType(t, &events.GetWebhooksOK{}, rsp)
+	webhooks := rsp.(*events.GetWebhooksOK).Payload
+	require.EqualValues(t, 1, webhooks.Total)
+	require.Len(t, webhooks.Items, 1)
+
+	// Delete the webhook.
+	rsp = rapi.DeleteWebhook(ctx, events.DeleteWebhookParams{ID: created.ID})
+	require.IsType(t, &events.DeleteWebhookOK{}, rsp)
+	rsp = rapi.DeleteWebhook(ctx, events.DeleteWebhookParams{ID: created.ID})
+	require.IsType(t, &events.DeleteWebhookOK{}, rsp)
+
+	rsp = rapi.GetWebhooks(ctx, events.GetWebhooksParams{})
+	require.IsType(t, &events.GetWebhooksOK{}, rsp)
+	require.Empty(t, rsp.(*events.GetWebhooksOK).Payload.Items)
+
+	// The audit trail does not contain the secrets.
+	records, _, err := dbmodel.GetAuditRecordsByPage(db, 0, 10, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	for _, record := range records {
+		require.Equal(t, dbmodel.AuditTargetWebhook, record.TargetType)
+		for _, change := range record.Changes {
+			require.NotContains(t, change.Path, "secret")
+		}
+	}
+}
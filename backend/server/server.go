@@ -11,6 +11,7 @@ import (
 	"isc.org/stork"
 	keaconfig "isc.org/stork/appcfg/kea"
 	"isc.org/stork/server/agentcomm"
+	"isc.org/stork/server/alerts"
 	"isc.org/stork/server/apps"
 	"isc.org/stork/server/apps/bind9"
 	"isc.org/stork/server/apps/kea"
@@ -51,11 +52,16 @@ type StorkServer struct {
 	EnableMetricsEndpoint bool
 	MetricsCollector      metrics.Collector
 
+	AlertEngine *alerts.Engine
+
+	EventPruner *eventcenter.EventPruner
+
 	EventCenter eventcenter.EventCenter
 
 	ReviewDispatcher configreview.Dispatcher
 
 	ConfigManager              config.Manager
+	ConfigChangeScheduler      *apps.ConfigChangeScheduler
 	DHCPOptionDefinitionLookup keaconfig.DHCPOptionDefinitionLookup
 	shutdownOnce               sync.Once
 }
@@ -245,7 +251,19 @@ func (ss *StorkServer) Bootstrap(reload bool) (err error) {
 	}
 
 	// Setup Kea HA status puller.
-	ss.Pullers.HAStatusPuller, err = kea.NewHAStatusPuller(ss.DB, ss.Agents)
+	ss.Pullers.HAStatusPuller, err = kea.NewHAStatusPuller(ss.DB, ss.Agents, ss.EventCenter)
+	if err != nil {
+		return err
+	}
+
+	// Setup Kea lease conflicts puller.
+	ss.Pullers.LeaseConflictsPuller, err = kea.NewLeaseConflictsPuller(ss.DB, ss.Agents, ss.EventCenter)
+	if err != nil {
+		return err
+	}
+
+	// Setup subnets and pools exhaustion forecast puller.
+	ss.Pullers.ExhaustionForecastPuller, err = kea.NewExhaustionForecastPuller(ss.DB, ss.Agents, ss.EventCenter)
 	if err != nil {
 		return err
 	}
@@ -260,6 +278,18 @@ func (ss *StorkServer) Bootstrap(reload bool) (err error) {
 		log.Warn("The metric endpoint is disabled (it can be enabled with the -m flag)")
 	}
 
+	// Setup the alert rules engine.
+	ss.AlertEngine, err = alerts.NewEngine(ss.DB, ss.EventCenter)
+	if err != nil {
+		return err
+	}
+
+	// Setup the pruner deleting the events according to the retention policy.
+	ss.EventPruner, err = eventcenter.NewEventPruner(ss.DB)
+	if err != nil {
+		return err
+	}
+
 	// Create the config manager instance. It takes config.ManagerAccessors interface
 	// as a parameter. The manager uses this interface to setup its state. For example,
 	// it stores the instance of the DHCP option definition lookup. Note, that it is
@@ -268,17 +298,26 @@ func (ss *StorkServer) Bootstrap(reload bool) (err error) {
 	// server startup.
 	ss.ConfigManager = apps.NewManager(ss)
 
+	// Setup the scheduler committing the scheduled config changes when
+	// their deadlines expire.
+	ss.ConfigChangeScheduler = apps.NewConfigChangeScheduler(ss.DB, ss.ConfigManager)
+
 	// setup ReST API service
 	r, err := restservice.NewRestAPI(&ss.RestAPISettings, &ss.DBSettings,
 		ss.DB, ss.Agents, ss.EventCenter,
 		ss.Pullers, ss.ReviewDispatcher, ss.MetricsCollector, ss.ConfigManager,
-		ss.DHCPOptionDefinitionLookup)
+		ss.ConfigChangeScheduler, ss.DHCPOptionDefinitionLookup)
 	if err != nil {
+		ss.ConfigChangeScheduler.Shutdown()
+		ss.Pullers.ExhaustionForecastPuller.Shutdown()
+		ss.Pullers.LeaseConflictsPuller.Shutdown()
 		ss.Pullers.HAStatusPuller.Shutdown()
 		ss.Pullers.KeaHostsPuller.Shutdown()
 		ss.Pullers.KeaStatsPuller.Shutdown()
 		ss.Pullers.Bind9StatsPuller.Shutdown()
 		ss.Pullers.AppsStatePuller.Shutdown()
+		ss.AlertEngine.Shutdown()
+		ss.EventPruner.Shutdown()
 		if ss.MetricsCollector != nil {
 			ss.MetricsCollector.Shutdown()
 		}
@@ -320,11 +359,16 @@ func (ss *StorkServer) Shutdown(reload bool) {
 			log.Println("Shutting down Stork Server")
 		}
 		ss.RestAPI.Shutdown()
+		ss.ConfigChangeScheduler.Shutdown()
+		ss.Pullers.ExhaustionForecastPuller.Shutdown()
+		ss.Pullers.LeaseConflictsPuller.Shutdown()
 		ss.Pullers.HAStatusPuller.Shutdown()
 		ss.Pullers.KeaHostsPuller.Shutdown()
 		ss.Pullers.KeaStatsPuller.Shutdown()
 		ss.Pullers.Bind9StatsPuller.Shutdown()
 		ss.Pullers.AppsStatePuller.Shutdown()
+		ss.AlertEngine.Shutdown()
+		ss.EventPruner.Shutdown()
 		ss.Agents.Shutdown()
 		ss.EventCenter.Shutdown()
 		ss.ReviewDispatcher.Shutdown()
@@ -354,3 +398,8 @@ func (ss *StorkServer) GetConnectedAgents() agentcomm.ConnectedAgents {
 func (ss *StorkServer) GetDHCPOptionDefinitionLookup() keaconfig.DHCPOptionDefinitionLookup {
 	return ss.DHCPOptionDefinitionLookup
 }
+
+// Returns an interface to the dispatcher running configuration reviews.
+func (ss *StorkServer) GetReviewDispatcher() configreview.Dispatcher {
+	return ss.ReviewDispatcher
+}
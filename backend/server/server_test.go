@@ -288,16 +288,16 @@ func TestBootstrap(t *testing.T) {
 
 	// Checks if the config review checker states were loaded from the database.
 	configReviewCheckerPreferences, _ := server.ReviewDispatcher.GetCheckersMetadata(daemons[0])
-	require.GreaterOrEqual(t, len(configReviewCheckerPreferences), 5)
-	require.EqualValues(t, "host_cmds_presence", configReviewCheckerPreferences[3].Name)
-	require.False(t, configReviewCheckerPreferences[3].GloballyEnabled)
-	require.EqualValues(t, "out_of_pool_reservation", configReviewCheckerPreferences[4].Name)
-	require.True(t, configReviewCheckerPreferences[4].GloballyEnabled)
+	require.GreaterOrEqual(t, len(configReviewCheckerPreferences), 6)
+	require.EqualValues(t, "host_cmds_presence", configReviewCheckerPreferences[4].Name)
+	require.False(t, configReviewCheckerPreferences[4].GloballyEnabled)
+	require.EqualValues(t, "out_of_pool_reservation", configReviewCheckerPreferences[5].Name)
+	require.True(t, configReviewCheckerPreferences[5].GloballyEnabled)
 	configReviewCheckerPreferences, _ = server.ReviewDispatcher.GetCheckersMetadata(daemons[1])
-	require.EqualValues(t, "host_cmds_presence", configReviewCheckerPreferences[3].Name)
-	require.False(t, configReviewCheckerPreferences[3].GloballyEnabled)
-	require.EqualValues(t, "out_of_pool_reservation", configReviewCheckerPreferences[4].Name)
-	require.True(t, configReviewCheckerPreferences[4].GloballyEnabled)
+	require.EqualValues(t, "host_cmds_presence", configReviewCheckerPreferences[4].Name)
+	require.False(t, configReviewCheckerPreferences[4].GloballyEnabled)
+	require.EqualValues(t, "out_of_pool_reservation", configReviewCheckerPreferences[5].Name)
+	require.True(t, configReviewCheckerPreferences[5].GloballyEnabled)
 
 	// Run Bootstrap again with the reload flag set.
 	err = server.Bootstrap(true)
@@ -58,6 +58,9 @@ func AddTestHosts(t *testing.T, db *pg.DB) (hosts []dbmodel.Host, apps []dbmodel
                 "hooks-libraries": [
                     {
                         "library": "libdhcp_host_cmds.so"
+                    },
+                    {
+                        "library": "libdhcp_subnet_cmds.so"
                     }
                 ]
             }
@@ -83,6 +86,9 @@ func AddTestHosts(t *testing.T, db *pg.DB) (hosts []dbmodel.Host, apps []dbmodel
                 "hooks-libraries": [
                     {
                         "library": "libdhcp_host_cmds.so"
+                    },
+                    {
+                        "library": "libdhcp_subnet_cmds.so"
                     }
                 ]
             }
@@ -2,6 +2,10 @@ package storkutil
 
 import (
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -31,3 +35,95 @@ func ExtractJSONInt64(container map[string]interface{}, key string) (int64, erro
 	}
 	return 0, errors.Errorf("value not found in the container for key %s", key)
 }
+
+// Type of the operation in the JSON diff.
+type JSONDiffOperation string
+
+const (
+	// The value has been added.
+	JSONDiffOperationAdd JSONDiffOperation = "add"
+	// The value has been removed.
+	JSONDiffOperationRemove JSONDiffOperation = "remove"
+	// The value has been replaced.
+	JSONDiffOperationReplace JSONDiffOperation = "replace"
+)
+
+// Represents a single difference between two JSON documents. The path is
+// a JSON pointer (RFC 6901) to the modified value. The old value is nil
+// for the added values and the new value is nil for the removed values.
+type JSONDiffChange struct {
+	Path      string
+	Operation JSONDiffOperation
+	OldValue  interface{}
+	NewValue  interface{}
+}
+
+// Compares two decoded JSON documents and returns a list of differences
+// between them. The maps are compared by keys and the arrays are compared
+// by indexes. If the values at the same path have different types they are
+// reported as replaced. The map keys are compared in alphabetical order
+// so the returned differences are deterministic.
+func DiffJSON(from, to interface{}) []JSONDiffChange {
+	changes := []JSONDiffChange{}
+	diffJSONValues("", from, to, &changes)
+	return changes
+}
+
+// Recursively compares the JSON values and appends the differences to the
+// list of changes.
+func diffJSONValues(path string, from, to interface{}, changes *[]JSONDiffChange) {
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		if toValue, ok := to.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(fromValue)+len(toValue))
+			for key := range fromValue {
+				keys = append(keys, key)
+			}
+			for key := range toValue {
+				if _, ok := fromValue[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				keyPath := path + "/" + escapeJSONPointerToken(key)
+				fromItem, fromOk := fromValue[key]
+				toItem, toOk := toValue[key]
+				switch {
+				case !fromOk:
+					*changes = append(*changes, JSONDiffChange{Path: keyPath, Operation: JSONDiffOperationAdd, NewValue: toItem})
+				case !toOk:
+					*changes = append(*changes, JSONDiffChange{Path: keyPath, Operation: JSONDiffOperationRemove, OldValue: fromItem})
+				default:
+					diffJSONValues(keyPath, fromItem, toItem, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if toValue, ok := to.([]interface{}); ok {
+			for i := 0; i < len(fromValue) || i < len(toValue); i++ {
+				indexPath := fmt.Sprintf("%s/%d", path, i)
+				switch {
+				case i >= len(fromValue):
+					*changes = append(*changes, JSONDiffChange{Path: indexPath, Operation: JSONDiffOperationAdd, NewValue: toValue[i]})
+				case i >= len(toValue):
+					*changes = append(*changes, JSONDiffChange{Path: indexPath, Operation: JSONDiffOperationRemove, OldValue: fromValue[i]})
+				default:
+					diffJSONValues(indexPath, fromValue[i], toValue[i], changes)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, JSONDiffChange{Path: path, Operation: JSONDiffOperationReplace, OldValue: from, NewValue: to})
+	}
+}
+
+// Escapes the special characters in the JSON pointer token as described
+// in RFC 6901.
+func escapeJSONPointerToken(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
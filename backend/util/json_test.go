@@ -52,3 +52,85 @@ func TestExtractJSONInt64(t *testing.T) {
 	require.Error(t, err)
 	require.Zero(t, v)
 }
+
+// Test that the differences between two JSON documents are found.
+func TestDiffJSON(t *testing.T) {
+	var from, to interface{}
+	err := json.Unmarshal([]byte(`{
+        "Dhcp4": {
+            "valid-lifetime": 3600,
+            "renew-timer": 900,
+            "interfaces-config": {
+                "interfaces": [ "eth0", "eth1" ]
+            },
+            "a/b": "foo",
+            "option-data": 1
+        }
+    }`), &from)
+	require.NoError(t, err)
+	err = json.Unmarshal([]byte(`{
+        "Dhcp4": {
+            "valid-lifetime": 7200,
+            "rebind-timer": 1800,
+            "interfaces-config": {
+                "interfaces": [ "eth0", "eth2", "eth3" ]
+            },
+            "a/b": "foo",
+            "option-data": [ ]
+        }
+    }`), &to)
+	require.NoError(t, err)
+
+	changes := DiffJSON(from, to)
+	require.Len(t, changes, 6)
+
+	require.Equal(t, "/Dhcp4/interfaces-config/interfaces/1", changes[0].Path)
+	require.Equal(t, JSONDiffOperationReplace, changes[0].Operation)
+	require.Equal(t, "eth1", changes[0].OldValue)
+	require.Equal(t, "eth2", changes[0].NewValue)
+
+	require.Equal(t, "/Dhcp4/interfaces-config/interfaces/2", changes[1].Path)
+	require.Equal(t, JSONDiffOperationAdd, changes[1].Operation)
+	require.Nil(t, changes[1].OldValue)
+	require.Equal(t, "eth3", changes[1].NewValue)
+
+	// Values having different types should be replaced.
+	require.Equal(t, "/Dhcp4/option-data", changes[2].Path)
+	require.Equal(t, JSONDiffOperationReplace, changes[2].Operation)
+	require.EqualValues(t, 1, changes[2].OldValue)
+	require.Empty(t, changes[2].NewValue)
+
+	require.Equal(t, "/Dhcp4/rebind-timer", changes[3].Path)
+	require.Equal(t, JSONDiffOperationAdd, changes[3].Operation)
+	require.EqualValues(t, 1800, changes[3].NewValue)
+
+	require.Equal(t, "/Dhcp4/renew-timer", changes[4].Path)
+	require.Equal(t, JSONDiffOperationRemove, changes[4].Operation)
+	require.EqualValues(t, 900, changes[4].OldValue)
+	require.Nil(t, changes[4].NewValue)
+
+	require.Equal(t, "/Dhcp4/valid-lifetime", changes[5].Path)
+	require.Equal(t, JSONDiffOperationReplace, changes[5].Operation)
+	require.EqualValues(t, 3600, changes[5].OldValue)
+	require.EqualValues(t, 7200, changes[5].NewValue)
+}
+
+// Test that no differences are returned for the same documents and that
+// the special characters in the paths are escaped.
+func TestDiffJSONEscapeAndSame(t *testing.T) {
+	from := map[string]interface{}{
+		"a/b": "foo",
+		"c~d": []interface{}{1, 2},
+	}
+	require.Empty(t, DiffJSON(from, from))
+
+	to := map[string]interface{}{
+		"a/b": "bar",
+		"c~d": []interface{}{1},
+	}
+	changes := DiffJSON(from, to)
+	require.Len(t, changes, 2)
+	require.Equal(t, "/a~1b", changes[0].Path)
+	require.Equal(t, "/c~0d/1", changes[1].Path)
+	require.Equal(t, JSONDiffOperationRemove, changes[1].Operation)
+}